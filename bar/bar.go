@@ -55,12 +55,16 @@ type Segment struct {
 	text      string
 	pango     bool
 	shortText string
+	tooltip   string
 	err       error
 
 	color      color.Color
 	background color.Color
 	border     color.Color
 
+	// Border widths in px, in the order top, right, bottom, left.
+	borderWidths [4]int
+
 	// Minimum width can be specified as either a numeric pixel value
 	// or a string placeholder value. The unexported field is interface{}
 	// but there are two methods on Segment that set this, one for each type.
@@ -79,6 +83,10 @@ const (
 	saUrgent
 	saSeparator
 	saPadding
+	saBorderTop
+	saBorderRight
+	saBorderBottom
+	saBorderLeft
 )
 
 // Output is an interface for displaying objects on the bar.
@@ -94,6 +102,14 @@ type TimedOutput interface {
 	NextRefresh() time.Time
 }
 
+// TransientOutput extends bar.Output with a duration for which the output is
+// shown, after which the module's previous output is shown again. This can be
+// used, for example, to briefly flash a confirmation message.
+type TransientOutput interface {
+	Output
+	TransientDuration() time.Duration
+}
+
 // Segments implements Output for []*Segment.
 type Segments []*Segment
 
@@ -162,6 +178,18 @@ type ErrorEvent struct {
 	Event
 }
 
+/*
+TooltipEvent represents a request to show the tooltip of a segment on a bar
+that cannot display tooltips itself. On i3bar, which does not report the
+pointer hovering over segments, this is fired when a segment with a tooltip is
+right clicked, before the click is passed on to the segment as usual. The
+default handler shows the tooltip as a desktop notification.
+*/
+type TooltipEvent struct {
+	Tooltip string
+	Event
+}
+
 // Sink represents a destination for module output.
 type Sink func(Output)
 
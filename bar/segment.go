@@ -72,6 +72,20 @@ func (s *Segment) GetShortText() (string, bool) {
 	return s.shortText, s.attrSet&saShortText != 0
 }
 
+// Tooltip sets additional text to show when the pointer is over the segment,
+// for detail that would otherwise clutter the bar. Bars that cannot display
+// tooltips fall back to showing it elsewhere, see TooltipEvent.
+func (s *Segment) Tooltip(tooltip string) *Segment {
+	s.tooltip = tooltip
+	return s
+}
+
+// GetTooltip returns the tooltip of this segment.
+// The second value indicates whether it was explicitly set.
+func (s *Segment) GetTooltip() (string, bool) {
+	return s.tooltip, s.tooltip != ""
+}
+
 // Error associates an error with the segment. Setting an error
 // changes event handling to display the full error text on left
 // click, and restart the module on right/middle click.
@@ -123,6 +137,76 @@ func (s *Segment) GetBorder() (color.Color, bool) {
 	return s.border, s.border != nil
 }
 
+// BorderWidth sets the width of the border on all sides of the segment, in px.
+func (s *Segment) BorderWidth(width int) *Segment {
+	return s.BorderWidths(width, width, width, width)
+}
+
+// BorderWidths sets the width of the border on each side of the segment, in px,
+// in the same order as CSS: top, right, bottom, left. A width of 0 hides the
+// border on that side.
+func (s *Segment) BorderWidths(top, right, bottom, left int) *Segment {
+	return s.BorderTop(top).BorderRight(right).BorderBottom(bottom).BorderLeft(left)
+}
+
+// BorderTop sets the width of the top border of the segment, in px.
+func (s *Segment) BorderTop(width int) *Segment {
+	return s.setBorderWidth(0, saBorderTop, width)
+}
+
+// BorderRight sets the width of the right border of the segment, in px.
+func (s *Segment) BorderRight(width int) *Segment {
+	return s.setBorderWidth(1, saBorderRight, width)
+}
+
+// BorderBottom sets the width of the bottom border of the segment, in px.
+func (s *Segment) BorderBottom(width int) *Segment {
+	return s.setBorderWidth(2, saBorderBottom, width)
+}
+
+// BorderLeft sets the width of the left border of the segment, in px.
+func (s *Segment) BorderLeft(width int) *Segment {
+	return s.setBorderWidth(3, saBorderLeft, width)
+}
+
+func (s *Segment) setBorderWidth(side int, attr int, width int) *Segment {
+	s.borderWidths[side] = width
+	s.attrSet |= attr
+	return s
+}
+
+// GetBorderTop returns the width of the top border of this segment.
+// The second value indicates whether it was explicitly set.
+func (s *Segment) GetBorderTop() (int, bool) {
+	return s.getBorderWidth(0, saBorderTop)
+}
+
+// GetBorderRight returns the width of the right border of this segment.
+// The second value indicates whether it was explicitly set.
+func (s *Segment) GetBorderRight() (int, bool) {
+	return s.getBorderWidth(1, saBorderRight)
+}
+
+// GetBorderBottom returns the width of the bottom border of this segment.
+// The second value indicates whether it was explicitly set.
+func (s *Segment) GetBorderBottom() (int, bool) {
+	return s.getBorderWidth(2, saBorderBottom)
+}
+
+// GetBorderLeft returns the width of the left border of this segment.
+// The second value indicates whether it was explicitly set.
+func (s *Segment) GetBorderLeft() (int, bool) {
+	return s.getBorderWidth(3, saBorderLeft)
+}
+
+func (s *Segment) getBorderWidth(side int, attr int) (int, bool) {
+	if s.attrSet&attr != 0 {
+		return s.borderWidths[side], true
+	}
+	// Default border width is 1px.
+	return 1, false
+}
+
 // MinWidth sets the minimum width for the segment.
 func (s *Segment) MinWidth(minWidth int) *Segment {
 	s.minWidth = minWidth
@@ -54,6 +54,7 @@ func TestSegment(t *testing.T) {
 	}
 
 	assertUnset(segment.GetShortText())
+	assertUnset(segment.GetTooltip())
 	assertUnset(segment.GetAlignment())
 	assertUnset(segment.GetColor())
 	assertUnset(segment.GetBackground())
@@ -70,6 +71,13 @@ func TestSegment(t *testing.T) {
 	defaultSepWidth := assertUnset(segment.GetPadding())
 	require.Equal(9, defaultSepWidth)
 
+	for _, w := range []func() (int, bool){
+		segment.GetBorderTop, segment.GetBorderRight,
+		segment.GetBorderBottom, segment.GetBorderLeft,
+	} {
+		require.Equal(1, assertUnset(w()), "default border width")
+	}
+
 	segment = PangoSegment("<b>bold</b>")
 	txt, pango = segment.Content()
 	require.Equal("<b>bold</b>", txt)
@@ -86,6 +94,11 @@ func TestSegment(t *testing.T) {
 	segment.ShortText("")
 	require.Equal("", assertSet(segment.GetShortText()))
 
+	segment.Tooltip("not bold at all")
+	require.Equal("not bold at all", assertSet(segment.GetTooltip()))
+	segment.Tooltip("")
+	assertUnset(segment.GetTooltip())
+
 	segment.Color(color.Gray{0x77})
 	assertColorEqual(t, color.RGBA{0x77, 0x77, 0x77, 0xff},
 		assertSet(segment.GetColor()).(color.Color))
@@ -98,6 +111,23 @@ func TestSegment(t *testing.T) {
 	assertColorEqual(t, color.RGBA{0, 0, 0, 0},
 		assertSet(segment.GetBorder()).(color.Color))
 
+	segment.BorderWidth(0)
+	require.Equal(0, assertSet(segment.GetBorderTop()))
+	require.Equal(0, assertSet(segment.GetBorderRight()))
+	require.Equal(0, assertSet(segment.GetBorderBottom()))
+	require.Equal(0, assertSet(segment.GetBorderLeft()))
+
+	segment.BorderWidths(1, 2, 3, 4)
+	require.Equal(1, assertSet(segment.GetBorderTop()))
+	require.Equal(2, assertSet(segment.GetBorderRight()))
+	require.Equal(3, assertSet(segment.GetBorderBottom()))
+	require.Equal(4, assertSet(segment.GetBorderLeft()))
+
+	borderOnly := TextSegment("bottom").BorderBottom(2)
+	require.Equal(2, assertSet(borderOnly.GetBorderBottom()))
+	assertUnset(borderOnly.GetBorderTop())
+	assertUnset(borderOnly.GetBorderLeft())
+
 	segment.Urgent(true)
 	require.True(assertSet(segment.IsUrgent()).(bool))
 
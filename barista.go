@@ -17,21 +17,21 @@ package barista // import "barista.run"
 import (
 	"encoding/json"
 	"errors"
-	"image/color"
 	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strconv"
 	"sync"
+	"time"
 
 	"barista.run/bar"
+	"barista.run/base/sdnotify"
 	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/oauth"
 	"barista.run/timing"
 
-	"github.com/lucasb-eyer/go-colorful"
 	"golang.org/x/sys/unix"
 )
 
@@ -55,10 +55,25 @@ type i3Bar struct {
 	// The list of modules that make up this bar.
 	modules   []bar.Module
 	moduleSet *core.ModuleSet
-	// A map of previously set click handlers for each segment.
-	clickHandlers map[string]func(bar.Event)
+	// The click handlers for each segment in the last output, indexed by the
+	// segment's name.
+	clickHandlers []func(bar.Event)
 	// The function to call when an error segment is right-clicked.
 	errorHandler func(bar.ErrorEvent)
+	// The function to call when a segment with a tooltip is right-clicked.
+	tooltipHandler func(bar.TooltipEvent)
+	// The output to show for each module until it produces its first output.
+	placeholder bar.Output
+	// Middleware applied to the output of every module, in order.
+	middleware []Middleware
+	// The address for the debug HTTP server, if enabled.
+	debugAddr string
+	// The path for the control socket, if enabled.
+	controlPath string
+	// The function that provides new modules for the control socket's reload.
+	reloadFn func() []bar.Module
+	// The time the bar was started, used for module update statistics.
+	startTime time.Time
 	// The channel that receives a signal on module updates.
 	update chan struct{}
 	// The channel that aggregates all events from i3.
@@ -67,8 +82,8 @@ type i3Bar struct {
 	reader io.Reader
 	// The Writer to write bar output to (e.g. stdout)
 	writer io.Writer
-	// A json encoder set to write to the output stream.
-	encoder *json.Encoder
+	// Encodes the bar's output, reusing buffers between updates.
+	encoder i3Encoder
 	// Flipped when Run() is called, to prevent issues with modules
 	// being added after the bar has been started.
 	started bool
@@ -116,6 +131,8 @@ func construct() {
 			paused: true,
 			// Default to i3-nagbar when right-clicking errors.
 			errorHandler: DefaultErrorHandler,
+			// i3bar cannot show tooltips, so use desktop notifications.
+			tooltipHandler: DefaultTooltipHandler,
 		}
 	})
 }
@@ -152,16 +169,49 @@ func SetErrorHandler(handler func(bar.ErrorEvent)) {
 	instance.errorHandler = handler
 }
 
+// SetTooltipHandler sets the function to be called when a segment with a
+// tooltip is right clicked, since i3bar cannot show tooltips on hover. The
+// click is still passed on to the segment afterwards. This replaces the
+// DefaultTooltipHandler.
+func SetTooltipHandler(handler func(bar.TooltipEvent)) {
+	construct()
+	instance.Lock()
+	defer instance.Unlock()
+	instance.tooltipHandler = handler
+}
+
+// SetPlaceholder sets the output shown in place of each module until it
+// produces its first output, so that the bar appears in full even if some
+// modules are slow to start (e.g. waiting on the network). A timed output,
+// such as outputs.Repeat(...).Every(...), can be used for an animated spinner.
+// Must be called before Run.
+func SetPlaceholder(placeholder bar.Output) {
+	construct()
+	instance.Lock()
+	defer instance.Unlock()
+	if instance.started {
+		panic("Cannot set placeholder after .Run()")
+	}
+	instance.placeholder = placeholder
+}
+
 // Run sets up all the streams and enters the main loop.
 // If any modules are provided, they are added to the bar now.
 // This allows both styles of bar construction:
 // `bar.Add(a); bar.Add(b); bar.Run()`, and `bar.Run(a, b)`.
+//
+// The i3bar protocol does not say which output the bar is shown on, so the
+// same modules are shown on all outputs. To show different modules on each
+// output, configure a bar block for each output, each running its own bar, or
+// use the wayland renderer, which supports per-output modules.
 func Run(modules ...bar.Module) error {
 	// Oauth configs are setup by modules when they're created.
 	// Now that all modules are created, the oauth system knows about all providers.
 	// So if the 'setup-oauth' arg was given, enter interactive setup instead.
 	// (InteractiveSetup calls os.Exit, so the rest of the bar will not run).
 	oauth.InteractiveSetup()
+	// Similarly, 'systemd-unit' prints a unit for the bar and exits.
+	sdnotify.GenerateUnit()
 	construct()
 	// To allow TestMode to work, we need to avoid any references
 	// to instance in the run loop.
@@ -175,10 +225,22 @@ func Run(modules ...bar.Module) error {
 
 	b.modules = append(b.modules, modules...)
 	b.moduleSet = core.NewModuleSet(b.modules)
+	if b.placeholder != nil {
+		b.moduleSet.SetPlaceholder(b.placeholder)
+	}
 
 	// Mark the bar as started.
 	b.started = true
+	b.startTime = timing.Now()
 	l.Log("Bar started")
+	if b.debugAddr != "" {
+		go b.serveDebug()
+	}
+	if b.controlPath != "" {
+		if err := b.serveControl(); err != nil {
+			return err
+		}
+	}
 
 	go func(i <-chan int) {
 		for range i {
@@ -204,10 +266,7 @@ func Run(modules ...bar.Module) error {
 		header.StopSignal = int(unix.SIGUSR1)
 		header.ContSignal = int(unix.SIGUSR2)
 	}
-	// Set up the encoder for the output stream,
-	// so that module outputs can be written directly.
-	b.encoder = json.NewEncoder(b.writer)
-	if err := b.encoder.Encode(&header); err != nil {
+	if err := json.NewEncoder(b.writer).Encode(&header); err != nil {
 		return err
 	}
 	// Start the infinite array.
@@ -218,6 +277,10 @@ func Run(modules ...bar.Module) error {
 	// Bar starts paused, so resume it to get the initial output.
 	b.resume()
 
+	// Pet the watchdog from the main loop, so that a wedged bar is restarted.
+	watchdog := sdnotify.Watchdog()
+	ready := false
+
 	// Infinite arrays on both sides.
 	for {
 		select {
@@ -226,9 +289,16 @@ func Run(modules ...bar.Module) error {
 			if err := b.print(); err != nil {
 				return err
 			}
+			if !ready {
+				ready = true
+				sdnotify.Ready()
+			}
+		case <-watchdog:
+			sdnotify.Pet()
 		case event := <-b.events:
-			if onClick, ok := b.clickHandlers[event.Name]; ok {
-				go onClick(event.Event)
+			if idx, err := strconv.Atoi(event.Name); err == nil &&
+				idx >= 0 && idx < len(b.clickHandlers) {
+				go b.clickHandlers[idx](event.Event)
 			}
 		case sig := <-signalChan:
 			switch sig {
@@ -243,55 +313,39 @@ func Run(modules ...bar.Module) error {
 	}
 }
 
+// Reload replaces the bar's modules with the given list, e.g. after its
+// configuration has been re-read. Modules that are in both the current and new
+// lists keep running with their state and last output, modules that are not
+// in the new list are stopped, and new modules are started. Since modules
+// cannot be interrupted, a module that has been removed must not be added
+// again. If the bar is not yet running, this replaces the modules added so far.
+func Reload(modules ...bar.Module) {
+	construct()
+	instance.reload(modules)
+}
+
+func (b *i3Bar) reload(modules []bar.Module) {
+	b.Lock()
+	b.modules = modules
+	if !b.started {
+		b.Unlock()
+		return
+	}
+	b.moduleSet.Replace(modules)
+	b.Unlock()
+	l.Log("Bar reloaded with %d modules", len(modules))
+	b.refresh()
+}
+
 // DefaultErrorHandler invokes i3-nagbar to show the full error message.
 func DefaultErrorHandler(e bar.ErrorEvent) {
 	exec.Command("i3-nagbar", "-m", e.Error.Error()).Run()
 }
 
-func colorString(c color.Color) string {
-	cful, _ := colorful.MakeColor(c)
-	return cful.Hex()
-}
-
-// i3map serialises the attributes of the Segment in
-// the format used by i3bar.
-func i3map(s *bar.Segment) map[string]interface{} {
-	i3map := make(map[string]interface{})
-	txt, pango := s.Content()
-	i3map["full_text"] = txt
-	if shortText, ok := s.GetShortText(); ok {
-		i3map["short_text"] = shortText
-	}
-	if color, ok := s.GetColor(); ok {
-		i3map["color"] = colorString(color)
-	}
-	if background, ok := s.GetBackground(); ok {
-		i3map["background"] = colorString(background)
-	}
-	if border, ok := s.GetBorder(); ok {
-		i3map["border"] = colorString(border)
-	}
-	if minWidth, ok := s.GetMinWidth(); ok {
-		i3map["min_width"] = minWidth
-	}
-	if align, ok := s.GetAlignment(); ok {
-		i3map["align"] = align
-	}
-	if urgent, ok := s.IsUrgent(); ok {
-		i3map["urgent"] = urgent
-	}
-	if separator, ok := s.HasSeparator(); ok {
-		i3map["separator"] = separator
-	}
-	if padding, ok := s.GetPadding(); ok {
-		i3map["separator_block_width"] = padding
-	}
-	if pango {
-		i3map["markup"] = "pango"
-	} else {
-		i3map["markup"] = "none"
-	}
-	return i3map
+// DefaultTooltipHandler invokes notify-send to show the tooltip as a desktop
+// notification.
+func DefaultTooltipHandler(e bar.TooltipEvent) {
+	exec.Command("notify-send", "-a", "barista", e.Tooltip).Run()
 }
 
 // print outputs the entire bar, using the last output for each module.
@@ -299,13 +353,17 @@ func (b *i3Bar) print() error {
 	// Store the set of click handlers for any segments that can handle clicks.
 	// When i3bar sends us the click event, it will include an identifier that
 	// we can use to look up the function to call.
-	b.clickHandlers = map[string]func(bar.Event){}
+	// Clear the previous handlers, so that they can be garbage collected.
+	for i := range b.clickHandlers {
+		b.clickHandlers[i] = nil
+	}
+	b.clickHandlers = b.clickHandlers[:0]
 	// i3bar requires the entire bar to be printed at once, so we just take the
 	// last cached value for each module and construct the current bar.
-	output := make([]map[string]interface{}, 0)
+	b.encoder.begin()
 	for _, segments := range b.moduleSet.LastOutputs() {
-		for _, segment := range segments {
-			out := i3map(segment)
+		for _, segment := range b.transform(segments) {
+			name := ""
 			var clickHandler func(bar.Event)
 			if err := segment.GetError(); err != nil {
 				// because go.
@@ -317,21 +375,26 @@ func (b *i3Bar) print() error {
 						segment.Click(e)
 					}
 				}
+			} else if tooltip, ok := segment.GetTooltip(); ok {
+				segment := segment
+				clickHandler = func(e bar.Event) {
+					if e.Button == bar.ButtonRight {
+						b.tooltipHandler(bar.TooltipEvent{Tooltip: tooltip, Event: e})
+					}
+					// The segment may have its own right click action too.
+					segment.Click(e)
+				}
 			} else if segment.HasClick() {
 				clickHandler = segment.Click
 			}
 			if clickHandler != nil {
-				name := strconv.Itoa(len(b.clickHandlers))
-				out["name"] = name
-				b.clickHandlers[name] = clickHandler
+				name = strconv.Itoa(len(b.clickHandlers))
+				b.clickHandlers = append(b.clickHandlers, clickHandler)
 			}
-			output = append(output, out)
+			b.encoder.segment(segment, name)
 		}
 	}
-	if err := b.encoder.Encode(output); err != nil {
-		return err
-	}
-	_, err := io.WriteString(b.writer, ",\n")
+	_, err := b.writer.Write(b.encoder.end())
 	return err
 }
 
@@ -19,8 +19,12 @@ import (
 	"errors"
 	"fmt"
 	"image/color"
+	"io/ioutil"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
@@ -120,6 +124,51 @@ func TestSingleModule(t *testing.T) {
 		"adding a module to a running bar")
 }
 
+func TestPlaceholder(t *testing.T) {
+	mockStdin := mockio.Stdin()
+	mockStdout := mockio.Stdout()
+	TestMode(mockStdin, mockStdout)
+
+	fast := testModule.New(t)
+	slow := testModule.New(t)
+	SetPlaceholder(outputs.Text("..."))
+
+	Add(fast)
+	Add(slow)
+	go Run()
+
+	_, err := mockStdout.ReadUntil('[', time.Second)
+	require.Nil(t, err, "output array started without any errors")
+
+	fast.AssertStarted()
+	slow.AssertStarted()
+	// Placeholders for each module may be printed in one or more updates.
+	readUntil := func(expected ...string) []string {
+		var out []string
+		for i := 0; i < 5; i++ {
+			out = readOutputTexts(t, mockStdout)
+			if reflect.DeepEqual(out, expected) {
+				break
+			}
+		}
+		return out
+	}
+	require.Equal(t, []string{"...", "..."}, readUntil("...", "..."),
+		"placeholder shown for all modules on start")
+
+	fast.OutputText("fast")
+	require.Equal(t, []string{"fast", "..."}, readUntil("fast", "..."),
+		"placeholder shown until module updates")
+
+	slow.OutputText("slow")
+	require.Equal(t, []string{"fast", "slow"}, readUntil("fast", "slow"),
+		"placeholder replaced by module output")
+
+	require.Panics(t,
+		func() { SetPlaceholder(outputs.Text("")) },
+		"setting placeholder on a running bar")
+}
+
 func TestEmptyOutputs(t *testing.T) {
 	mockStdin := mockio.Stdin()
 	mockStdout := mockio.Stdout()
@@ -552,6 +601,52 @@ func TestErrorHandling(t *testing.T) {
 		"restarting from regular segment also clears errors")
 }
 
+func TestTooltipHandling(t *testing.T) {
+	mockStdin := mockio.Stdin()
+	mockStdout := mockio.Stdout()
+	TestMode(mockStdin, mockStdout)
+	tooltips := make(chan bar.TooltipEvent)
+	SetTooltipHandler(func(e bar.TooltipEvent) { tooltips <- e })
+	SetErrorHandler(func(bar.ErrorEvent) {})
+
+	module := testModule.New(t)
+	go Run(module)
+
+	module.AssertStarted()
+	mockStdin.WriteString("[")
+	mockStdout.ReadUntil('[', time.Second)
+
+	module.Output(outputs.Group(
+		outputs.Text("tip").Tooltip("some details"),
+		outputs.Errorf("foo").Tooltip("error details"),
+	))
+	out := readOutput(t, mockStdout)
+	require.Equal(t, 2, len(out), "All segments in output")
+	require.NotContains(t, out[0], "tooltip", "not sent to i3bar")
+	tooltipSegmentName := out[0]["name"].(string)
+
+	mockStdin.WriteString(fmt.Sprintf(`{"name": "%s", "button": 1},`, tooltipSegmentName))
+	module.AssertClicked("on left click of tooltip segment")
+
+	mockStdin.WriteString(fmt.Sprintf(`{"name": "%s", "x": 4, "button": 3},`, tooltipSegmentName))
+	select {
+	case e := <-tooltips:
+		require.Equal(t, "some details", e.Tooltip)
+		require.Equal(t, bar.Event{ScreenX: 4, Button: bar.ButtonRight}, e.Event)
+	case <-time.After(time.Second):
+		require.Fail(t, "should trigger tooltip handler on right click")
+	}
+	e := module.AssertClicked("right click is passed on to the segment")
+	require.Equal(t, bar.ButtonRight, e.Button)
+
+	mockStdin.WriteString(fmt.Sprintf(`{"name": "%s", "button": 3},`, out[1]["name"]))
+	select {
+	case e := <-tooltips:
+		require.Fail(t, "error handler takes precedence over tooltip", "%+v", e)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
 func testIoError(
 	t *testing.T,
 	setup func(*mockio.Readable, *mockio.Writable),
@@ -585,6 +680,84 @@ func testIoError(
 	}
 }
 
+func TestReload(t *testing.T) {
+	mockStdin := mockio.Stdin()
+	mockStdout := mockio.Stdout()
+	TestMode(mockStdin, mockStdout)
+
+	module1 := testModule.New(t)
+	module2 := testModule.New(t)
+	module3 := testModule.New(t)
+	Add(module3)
+	Reload(module1)
+	go Run(module2)
+
+	_, err := mockStdout.ReadUntil('[', time.Second)
+	require.Nil(t, err, "output array started without any errors")
+	module1.AssertStarted()
+	module2.AssertStarted()
+	module3.AssertNotStarted("replaced before run")
+
+	module1.OutputText("one")
+	require.Equal(t, []string{"one"}, readOutputTexts(t, mockStdout))
+	module2.OutputText("two")
+	require.Equal(t, []string{"one", "two"}, readOutputTexts(t, mockStdout))
+
+	Reload(module2, module3)
+	require.Equal(t, []string{"two"}, readOutputTexts(t, mockStdout),
+		"redrawn on reload, keeping output of existing modules")
+	module3.AssertStarted("on reload")
+	module3.OutputText("three")
+	require.Equal(t, []string{"two", "three"}, readOutputTexts(t, mockStdout))
+
+	module1.OutputText("removed")
+	_, err = mockStdout.ReadUntil(']', 10*time.Millisecond)
+	require.Error(t, err, "no output from removed module")
+}
+
+func TestSystemdNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "barista")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	addr := &net.UnixAddr{Name: filepath.Join(dir, "notify"), Net: "unixgram"}
+	notify, err := net.ListenUnixgram("unixgram", addr)
+	require.NoError(t, err)
+	defer notify.Close()
+	os.Setenv("NOTIFY_SOCKET", addr.Name)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	os.Setenv("WATCHDOG_USEC", "20000")
+	defer os.Unsetenv("WATCHDOG_USEC")
+
+	mockStdin := mockio.Stdin()
+	mockStdout := mockio.Stdout()
+	TestMode(mockStdin, mockStdout)
+
+	module := testModule.New(t)
+	go Run(module)
+	module.AssertStarted()
+	mockStdout.ReadUntil('[', time.Second)
+
+	readState := func() string {
+		notify.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 256)
+		n, err := notify.Read(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	module.OutputText("foo")
+	readOutput(t, mockStdout)
+	states := map[string]bool{}
+	for !states["READY=1"] || !states["WATCHDOG=1"] {
+		states[readState()] = true
+	}
+	module.OutputText("bar")
+	readOutput(t, mockStdout)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, "WATCHDOG=1", readState(), "watchdog pet periodically")
+	}
+}
+
 func TestIOErrors(t *testing.T) {
 	testIoError(t,
 		func(in *mockio.Readable, out *mockio.Writable) {
@@ -646,7 +819,7 @@ type segmentAssertions struct {
 
 func (s segmentAssertions) AssertEqual(message string) {
 	actualMap := make(map[string]string)
-	for k, v := range i3map(s.actual) {
+	for k, v := range encodeSegment(s.T, s.actual) {
 		actualMap[k] = fmt.Sprintf("%v", v)
 	}
 	require.Equal(s.T, s.Expected, actualMap, message)
@@ -696,6 +869,17 @@ func TestI3Map(t *testing.T) {
 	a.Expected["border"] = "#000000"
 	a.AssertEqual("sets border color")
 
+	segment.BorderBottom(3)
+	a.Expected["border_bottom"] = "3"
+	a.AssertEqual("sets single border width")
+
+	segment.BorderWidths(0, 1, 2, 4)
+	a.Expected["border_top"] = "0"
+	a.Expected["border_right"] = "1"
+	a.Expected["border_bottom"] = "2"
+	a.Expected["border_left"] = "4"
+	a.AssertEqual("sets all border widths")
+
 	segment.Align(bar.AlignStart)
 	a.Expected["align"] = "left"
 	a.AssertEqual("alignment strings are preserved")
@@ -720,4 +904,11 @@ func TestI3Map(t *testing.T) {
 	segment.Urgent(false)
 	a.Expected["urgent"] = "false"
 	a.AssertEqual("urgent = false")
+
+	urgentPango := bar.PangoSegment("<i>!</i>").Urgent(true)
+	a4 := segmentAssertions{t, urgentPango, make(map[string]string)}
+	a4.Expected["full_text"] = "<i>!</i>"
+	a4.Expected["markup"] = "pango"
+	a4.Expected["urgent"] = "true"
+	a4.AssertEqual("urgent with pango markup")
 }
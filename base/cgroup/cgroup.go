@@ -0,0 +1,251 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cgroup reads the resource usage and limits of the cgroup (v2) that
+// the current process belongs to. Inside containers and systemd slices, these
+// are often a more accurate picture of the resources available to the user
+// than the system-wide values in /proc.
+package cgroup // import "barista.run/base/cgroup"
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Unlimited is used for limits that are not set, i.e. "max".
+const Unlimited = math.MaxUint64
+
+// ErrNotAvailable is returned when the process is not in a cgroup v2
+// hierarchy, e.g. on systems that only use legacy (v1) cgroups.
+var ErrNotAvailable = errors.New("cgroup v2 not available")
+
+// Memory represents the memory usage and limits of a cgroup.
+type Memory struct {
+	// Current memory usage, in bytes.
+	Current uint64
+	// Max is the effective memory limit in bytes, taking into account the
+	// limits of all ancestors, or Unlimited.
+	Max uint64
+	// SwapAccounting is true if swap usage is tracked for the cgroup. If
+	// false, SwapCurrent and SwapMax should be ignored.
+	SwapAccounting bool
+	// SwapCurrent is the current swap usage, in bytes.
+	SwapCurrent uint64
+	// SwapMax is the effective swap limit in bytes, or Unlimited.
+	SwapMax uint64
+	// Stat contains the values from memory.stat, e.g. "file", "anon",
+	// "inactive_file". Memory amounts are in bytes.
+	Stat map[string]uint64
+}
+
+// CPU represents the CPU usage and limits of a cgroup.
+type CPU struct {
+	// Usage is the total CPU time consumed by the cgroup.
+	Usage time.Duration
+	// User is the CPU time spent in user mode.
+	User time.Duration
+	// System is the CPU time spent in kernel mode.
+	System time.Duration
+	// Limit is the effective CPU bandwidth limit in CPUs (e.g. 1.5), taking
+	// into account the limits of all ancestors, or 0 if not limited.
+	Limit float64
+	// CPUs is the number of CPUs the cgroup is allowed to run on, or 0 if
+	// not known.
+	CPUs int
+}
+
+// Overridden in tests.
+var fs = afero.NewOsFs()
+
+const root = "/sys/fs/cgroup"
+
+// SetFsForTest replaces the filesystem used to read /proc/self/cgroup and
+// /sys/fs/cgroup, for testing.
+func SetFsForTest(testFs afero.Fs) {
+	fs = testFs
+}
+
+// Current returns the path of the current process' cgroup, relative to the
+// root of the cgroup v2 hierarchy, e.g. "/user.slice/user-1000.slice".
+func Current() (string, error) {
+	f, err := fs.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// The unified hierarchy always has ID 0 and no controllers.
+		if p := strings.TrimPrefix(s.Text(), "0::"); p != s.Text() {
+			return p, nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", ErrNotAvailable
+}
+
+// ReadMemory reads the memory usage and limits of the current cgroup.
+func ReadMemory() (Memory, error) {
+	mem := Memory{Max: Unlimited, SwapMax: Unlimited}
+	dir, err := Current()
+	if err != nil {
+		return mem, err
+	}
+	if mem.Current, err = readUint(dir, "memory.current"); err != nil {
+		return mem, err
+	}
+	if mem.Stat, err = readKeyed(dir, "memory.stat"); err != nil {
+		return mem, err
+	}
+	if mem.SwapCurrent, err = readUint(dir, "memory.swap.current"); err == nil {
+		mem.SwapAccounting = true
+	}
+	forEach(dir, func(d string) {
+		if max, err := readUint(d, "memory.max"); err == nil && max < mem.Max {
+			mem.Max = max
+		}
+		if max, err := readUint(d, "memory.swap.max"); err == nil && max < mem.SwapMax {
+			mem.SwapMax = max
+		}
+	})
+	return mem, nil
+}
+
+// ReadCPU reads the CPU usage and limits of the current cgroup.
+func ReadCPU() (CPU, error) {
+	var cpu CPU
+	dir, err := Current()
+	if err != nil {
+		return cpu, err
+	}
+	stat, err := readKeyed(dir, "cpu.stat")
+	if err != nil {
+		return cpu, err
+	}
+	cpu.Usage = time.Duration(stat["usage_usec"]) * time.Microsecond
+	cpu.User = time.Duration(stat["user_usec"]) * time.Microsecond
+	cpu.System = time.Duration(stat["system_usec"]) * time.Microsecond
+	forEach(dir, func(d string) {
+		if limit := readCPUMax(d); limit > 0 && (cpu.Limit == 0 || limit < cpu.Limit) {
+			cpu.Limit = limit
+		}
+	})
+	if cpus, err := readFile(dir, "cpuset.cpus.effective"); err == nil {
+		cpu.CPUs = countCPUs(cpus)
+	}
+	return cpu, nil
+}
+
+// forEach calls fn for the given cgroup and each of its ancestors.
+func forEach(dir string, fn func(string)) {
+	for {
+		fn(dir)
+		if dir == "/" || dir == "" {
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+func readFile(dir, file string) (string, error) {
+	contents, err := afero.ReadFile(fs, path.Join(root, dir, file))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// readUint reads a file containing a single value, which can be "max".
+func readUint(dir, file string) (uint64, error) {
+	contents, err := readFile(dir, file)
+	if err != nil {
+		return 0, err
+	}
+	if contents == "max" {
+		return Unlimited, nil
+	}
+	return strconv.ParseUint(contents, 10, 64)
+}
+
+// readKeyed reads a file containing "key value" lines.
+func readKeyed(dir, file string) (map[string]uint64, error) {
+	contents, err := readFile(dir, file)
+	if err != nil {
+		return nil, err
+	}
+	vals := map[string]uint64{}
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			vals[fields[0]] = v
+		}
+	}
+	return vals, nil
+}
+
+// readCPUMax returns the CPU limit from cpu.max ("$QUOTA $PERIOD"), or 0 if
+// there is no limit.
+func readCPUMax(dir string) float64 {
+	contents, err := readFile(dir, "cpu.max")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(contents)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	quota, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0
+	}
+	return quota / period
+}
+
+// countCPUs counts the CPUs in a cpuset list, e.g. "0-3,6" is 5 CPUs.
+func countCPUs(list string) int {
+	count := 0
+	for _, r := range strings.Split(list, ",") {
+		var lo, hi int
+		var err error
+		if dash := strings.Index(r, "-"); dash >= 0 {
+			lo, err = strconv.Atoi(r[:dash])
+			if err == nil {
+				hi, err = strconv.Atoi(r[dash+1:])
+			}
+		} else {
+			lo, err = strconv.Atoi(r)
+			hi = lo
+		}
+		if err == nil && hi >= lo {
+			count += hi - lo + 1
+		}
+	}
+	return count
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgroup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestFs(files map[string]string) {
+	testFs := afero.NewMemMapFs()
+	for name, contents := range files {
+		afero.WriteFile(testFs, name, []byte(contents), 0644)
+	}
+	SetFsForTest(testFs)
+}
+
+func TestCurrent(t *testing.T) {
+	setupTestFs(nil)
+	_, err := Current()
+	require.Error(t, err, "without /proc/self/cgroup")
+
+	setupTestFs(map[string]string{
+		"/proc/self/cgroup": "12:cpu,cpuacct:/user.slice\n1:name=systemd:/user.slice\n",
+	})
+	_, err = Current()
+	require.Equal(t, ErrNotAvailable, err, "cgroup v1 only")
+
+	setupTestFs(map[string]string{
+		"/proc/self/cgroup": "1:name=systemd:/foo\n0::/user.slice/user-1000.slice/session-2.scope\n",
+	})
+	p, err := Current()
+	require.NoError(t, err)
+	require.Equal(t, "/user.slice/user-1000.slice/session-2.scope", p)
+}
+
+func TestMemory(t *testing.T) {
+	files := map[string]string{
+		"/proc/self/cgroup":                      "0::/a/b\n",
+		"/sys/fs/cgroup/a/b/memory.current":      "1000\n",
+		"/sys/fs/cgroup/a/b/memory.max":          "max\n",
+		"/sys/fs/cgroup/a/b/memory.stat":         "anon 600\nfile 400\ninactive_file 300\n",
+		"/sys/fs/cgroup/a/memory.max":            "4000\n",
+		"/sys/fs/cgroup/memory.stat":             "anon 1\n",
+		"/sys/fs/cgroup/a/b/memory.swap.current": "0\n",
+		"/sys/fs/cgroup/a/b/memory.swap.max":     "0\n",
+		"/sys/fs/cgroup/a/memory.swap.max":       "max\n",
+	}
+	setupTestFs(files)
+	mem, err := ReadMemory()
+	require.NoError(t, err)
+	require.Equal(t, Memory{
+		Current:        1000,
+		Max:            4000,
+		SwapAccounting: true,
+		SwapCurrent:    0,
+		SwapMax:        0,
+		Stat:           map[string]uint64{"anon": 600, "file": 400, "inactive_file": 300},
+	}, mem, "uses the lowest limit from ancestors")
+
+	delete(files, "/sys/fs/cgroup/a/memory.max")
+	delete(files, "/sys/fs/cgroup/a/b/memory.swap.current")
+	setupTestFs(files)
+	mem, err = ReadMemory()
+	require.NoError(t, err)
+	require.Equal(t, uint64(Unlimited), mem.Max)
+	require.False(t, mem.SwapAccounting)
+
+	delete(files, "/sys/fs/cgroup/a/b/memory.current")
+	setupTestFs(files)
+	_, err = ReadMemory()
+	require.Error(t, err, "without memory controller")
+
+	setupTestFs(map[string]string{"/proc/self/cgroup": "3:memory:/\n"})
+	_, err = ReadMemory()
+	require.Equal(t, ErrNotAvailable, err)
+}
+
+func TestCPU(t *testing.T) {
+	files := map[string]string{
+		"/proc/self/cgroup":                       "0::/\n",
+		"/sys/fs/cgroup/cpu.stat":                 "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n",
+		"/sys/fs/cgroup/cpuset.cpus.effective":    "0-3,6,8-9\n",
+		"/sys/fs/cgroup/cpu.max":                  "max 100000\n",
+		"/sys/fs/cgroup/container/cpu.max":        "50000 100000\n",
+		"/sys/fs/cgroup/container/cpu.stat":       "usage_usec 10\n",
+		"/sys/fs/cgroup/container/inner/cpu.max":  "150000 100000\n",
+		"/sys/fs/cgroup/container/inner/cpu.stat": "usage_usec 10\n",
+	}
+	setupTestFs(files)
+	cpu, err := ReadCPU()
+	require.NoError(t, err)
+	require.Equal(t, CPU{
+		Usage:  2500 * time.Millisecond,
+		User:   2 * time.Second,
+		System: 500 * time.Millisecond,
+		CPUs:   7,
+	}, cpu)
+
+	files["/proc/self/cgroup"] = "0::/container/inner\n"
+	setupTestFs(files)
+	cpu, err = ReadCPU()
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Microsecond, cpu.Usage)
+	require.Equal(t, 0.5, cpu.Limit, "uses the lowest limit from ancestors")
+	require.Equal(t, 0, cpu.CPUs, "without cpuset")
+
+	files["/sys/fs/cgroup/container/cpu.max"] = "garbage"
+	setupTestFs(files)
+	cpu, err = ReadCPU()
+	require.NoError(t, err)
+	require.Equal(t, 1.5, cpu.Limit)
+
+	delete(files, "/sys/fs/cgroup/container/inner/cpu.stat")
+	setupTestFs(files)
+	_, err = ReadCPU()
+	require.Error(t, err, "without cpu controller")
+}
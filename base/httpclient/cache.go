@@ -0,0 +1,174 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpclient
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Responses larger than maxCachedSize are not cached.
+const maxCachedSize = 1 << 20
+
+// maxCachedEntries and maxCachedBytes limit the number of cached responses
+// and the total size of their bodies. The oldest responses are evicted when
+// either limit is exceeded.
+const (
+	maxCachedEntries = 100
+	maxCachedBytes   = 8 << 20
+)
+
+type entry struct {
+	status       string
+	statusCode   int
+	header       http.Header
+	body         []byte
+	etag         string
+	lastModified string
+}
+
+// conditional returns a copy of the request that asks the server to respond
+// with 304 Not Modified if the cached response is still valid.
+func (e *entry) conditional(req *http.Request) *http.Request {
+	req = req.Clone(req.Context())
+	if e.etag != "" {
+		req.Header.Set("If-None-Match", e.etag)
+	}
+	if e.lastModified != "" {
+		req.Header.Set("If-Modified-Since", e.lastModified)
+	}
+	return req
+}
+
+// response returns a new response from the cached data.
+func (e *entry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        e.status,
+		StatusCode:    e.statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+type cache struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	keys    []string // in insertion order, for eviction.
+	size    int      // total size of all cached bodies.
+}
+
+var responses = &cache{entries: map[string]*entry{}}
+
+// ClearCache removes all cached responses.
+func ClearCache() {
+	responses.mu.Lock()
+	defer responses.mu.Unlock()
+	responses.entries = map[string]*entry{}
+	responses.keys = nil
+	responses.size = 0
+}
+
+// cacheKey returns the key for a request, or false if the request cannot
+// use the cache. Requests with their own conditional or range headers, or
+// that disallow caching, bypass the cache.
+func cacheKey(req *http.Request) (string, bool) {
+	if req.Method != "" && req.Method != "GET" {
+		return "", false
+	}
+	for _, h := range []string{"If-None-Match", "If-Modified-Since", "Range"} {
+		if req.Header.Get(h) != "" {
+			return "", false
+		}
+	}
+	if strings.Contains(req.Header.Get("Cache-Control"), "no-store") {
+		return "", false
+	}
+	// Different credentials or formats may produce different responses.
+	return strings.Join([]string{
+		req.URL.String(),
+		req.Header.Get("Authorization"),
+		req.Header.Get("Accept"),
+	}, "\x00"), true
+}
+
+func (c *cache) lookup(req *http.Request) *entry {
+	key, ok := cacheKey(req)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+// store caches a successful response if it has validators, and returns a
+// response that can be read by the caller.
+func (c *cache) store(req *http.Request, resp *http.Response) (*http.Response, error) {
+	key, ok := cacheKey(req)
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if !ok || resp.StatusCode != http.StatusOK ||
+		(etag == "" && lastModified == "") ||
+		strings.Contains(resp.Header.Get("Cache-Control"), "no-store") ||
+		resp.ContentLength > maxCachedSize {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCachedSize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > maxCachedSize {
+		// Too large to cache, return the full body to the caller.
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.entries[key]; ok {
+		c.size -= len(old.body)
+	} else {
+		c.keys = append(c.keys, key)
+	}
+	c.size += len(body)
+	c.entries[key] = &entry{
+		status:       resp.Status,
+		statusCode:   resp.StatusCode,
+		header:       resp.Header.Clone(),
+		body:         body,
+		etag:         etag,
+		lastModified: lastModified,
+	}
+	for len(c.keys) > maxCachedEntries || c.size > maxCachedBytes {
+		c.size -= len(c.entries[c.keys[0]].body)
+		delete(c.entries, c.keys[0])
+		c.keys = c.keys[1:]
+	}
+	return resp, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type versionedServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	version     int
+	full        int
+	notModified int
+}
+
+func newVersionedServer(t *testing.T, validator string) *versionedServer {
+	s := &versionedServer{version: 1}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		etag := fmt.Sprintf(`"v%d"`, s.version)
+		modified := fmt.Sprintf("Mon, 0%d Jan 2018 00:00:00 GMT", s.version)
+		switch validator {
+		case "etag":
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				s.notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "last-modified":
+			w.Header().Set("Last-Modified", modified)
+			if r.Header.Get("If-Modified-Since") == modified {
+				s.notModified++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		s.full++
+		fmt.Fprintf(w, "version %d for %s", s.version, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *versionedServer) set(version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+func (s *versionedServer) counts() (full, notModified int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.full, s.notModified
+}
+
+func TestCache(t *testing.T) {
+	for _, validator := range []string{"etag", "last-modified"} {
+		s := newVersionedServer(t, validator)
+		resp, err := Get(s.URL)
+		require.Equal(t, "version 1 for ", body(t, resp, err), validator)
+		resp, err = Get(s.URL)
+		require.Equal(t, http.StatusOK, resp.StatusCode, validator)
+		require.Equal(t, "version 1 for ", body(t, resp, err), validator)
+		full, notModified := s.counts()
+		require.Equal(t, 1, full, validator)
+		require.Equal(t, 1, notModified, "%s: served from cache", validator)
+
+		s.set(2)
+		resp, err = Get(s.URL)
+		require.Equal(t, "version 2 for ", body(t, resp, err), validator)
+		resp, err = Get(s.URL)
+		require.Equal(t, "version 2 for ", body(t, resp, err), validator)
+		full, notModified = s.counts()
+		require.Equal(t, 2, full, validator)
+		require.Equal(t, 2, notModified, "%s: cache updated", validator)
+	}
+
+	s := newVersionedServer(t, "")
+	for i := 0; i < 2; i++ {
+		resp, err := Get(s.URL)
+		require.Equal(t, "version 1 for ", body(t, resp, err))
+	}
+	full, _ := s.counts()
+	require.Equal(t, 2, full, "not cached without validators")
+}
+
+func TestCacheBypass(t *testing.T) {
+	s := newVersionedServer(t, "etag")
+	get := func(header ...string) string {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := Do(req)
+		return body(t, resp, err)
+	}
+	get()
+	require.Equal(t, "version 1 for token", get("Authorization", "token"),
+		"different credentials")
+	get("Authorization", "token")
+	full, notModified := s.counts()
+	require.Equal(t, 2, full)
+	require.Equal(t, 1, notModified)
+
+	require.Equal(t, "", get("If-None-Match", `"v1"`), "caller's conditional request")
+	get("Cache-Control", "no-store")
+	full, notModified = s.counts()
+	require.Equal(t, 3, full)
+	require.Equal(t, 2, notModified)
+
+	ClearCache()
+	get()
+	full, _ = s.counts()
+	require.Equal(t, 4, full, "cache cleared")
+}
+
+func cacheSize() (entries, keys int) {
+	responses.mu.Lock()
+	defer responses.mu.Unlock()
+	return len(responses.entries), len(responses.keys)
+}
+
+func TestCacheLimits(t *testing.T) {
+	ClearCache()
+	large := strings.Repeat("x", maxCachedSize+10)
+	var requests int
+	var mu sync.Mutex
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Header().Set("ETag", `"large"`)
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		// Without a content length, to exercise partially reading the body.
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, large)
+	}))
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := Get(s.URL)
+		require.Equal(t, large, body(t, resp, err), "large responses are not truncated")
+	}
+	entries, keys := cacheSize()
+	require.Equal(t, 0, entries, "large response not cached")
+
+	for i := 0; i < maxCachedEntries+5; i++ {
+		vs := newVersionedServer(t, "etag")
+		resp, err := Get(vs.URL)
+		body(t, resp, err)
+	}
+	entries, keys = cacheSize()
+	require.Equal(t, maxCachedEntries, entries)
+	require.Equal(t, maxCachedEntries, keys)
+
+	ClearCache()
+	half := strings.Repeat("x", maxCachedSize/2)
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"half"`)
+		fmt.Fprint(w, half)
+	}))
+	defer s.Close()
+	for i := 0; i < 2*maxCachedBytes/len(half); i++ {
+		resp, err := Get(fmt.Sprintf("%s/%d", s.URL, i))
+		require.Equal(t, half, body(t, resp, err))
+	}
+	entries, _ = cacheSize()
+	require.Equal(t, maxCachedBytes/len(half), entries, "limited by total size")
+	responses.mu.Lock()
+	require.Equal(t, maxCachedBytes, responses.size)
+	responses.mu.Unlock()
+}
@@ -0,0 +1,291 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package httpclient provides the HTTP client shared by network modules. When
+compared to http.DefaultClient, it adds caching, retries, rate limiting, and a
+configurable proxy.
+
+Responses with an ETag or Last-Modified header are cached, and later requests
+for the same URL are conditional, so unchanged responses are served from the
+cache. This saves bandwidth, and often does not count towards API quotas.
+
+Idempotent requests that fail with a network error or a transient server
+error are retried with jittered exponential backoff, respecting Retry-After.
+Requests are also rate limited per host, to avoid exceeding API quotas. Local
+services (on loopback addresses) are not rate limited by default.
+
+Requests are sent using http.DefaultTransport unless a proxy is set, so
+replacing it (e.g. with testing/httpcache) affects all modules.
+*/
+package httpclient // import "barista.run/base/httpclient"
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	l "barista.run/logging"
+
+	"golang.org/x/time/rate"
+)
+
+// Overridden in tests.
+var (
+	retryBase     = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+type limit struct {
+	every rate.Limit
+	burst int
+}
+
+var (
+	mu             sync.Mutex
+	proxyTransport http.RoundTripper
+	retries        = 2
+	defaultLimit   = limit{rate.Every(time.Second), 10}
+	limits         = map[string]limit{}
+	limiters       = map[string]*rate.Limiter{}
+)
+
+var client = &http.Client{Transport: transport{}, Timeout: 30 * time.Second}
+
+// Client returns the shared HTTP client. Requests time out after 30 seconds,
+// including any retries.
+func Client() *http.Client {
+	return client
+}
+
+// Get issues a GET request to the given URL using the shared client.
+func Get(url string) (*http.Response, error) {
+	return client.Get(url)
+}
+
+// Do sends a request using the shared client.
+func Do(req *http.Request) (*http.Response, error) {
+	return client.Do(req)
+}
+
+// SetProxy sets the proxy for all requests, e.g. "http://proxy:3128" or
+// "socks5://localhost:1080". An empty URL restores the default, which uses
+// the proxy environment variables.
+func SetProxy(proxyURL string) error {
+	if proxyURL == "" {
+		mu.Lock()
+		proxyTransport = nil
+		mu.Unlock()
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return err
+	}
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return errors.New("http.DefaultTransport is not an *http.Transport")
+	}
+	t = t.Clone()
+	t.Proxy = http.ProxyURL(u)
+	mu.Lock()
+	proxyTransport = t
+	mu.Unlock()
+	return nil
+}
+
+// SetRateLimit limits requests to a host, as it appears in the URL (including
+// the port if specified), to one per interval on average, allowing bursts of
+// up to burst requests. An empty host sets the limit for all non-local hosts
+// that do not have their own limit, which is initially one request per second
+// with bursts of up to 10 requests. An interval of 0 removes the limit.
+func SetRateLimit(host string, interval time.Duration, burst int) {
+	lim := limit{rate.Inf, burst}
+	if interval > 0 {
+		lim.every = rate.Every(interval)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if host == "" {
+		defaultLimit = lim
+		// Recreate limiters for hosts using the default limit.
+		for h := range limiters {
+			if _, ok := limits[h]; !ok {
+				delete(limiters, h)
+			}
+		}
+	} else {
+		limits[host] = lim
+		delete(limiters, host)
+	}
+}
+
+// SetRetries sets the maximum number of retries for idempotent requests that
+// fail with a network error or a transient server error (429, 502, 503, or
+// 504). The default is 2, and 0 disables retries.
+func SetRetries(n int) {
+	mu.Lock()
+	defer mu.Unlock()
+	retries = n
+}
+
+func limiter(host string) *rate.Limiter {
+	mu.Lock()
+	defer mu.Unlock()
+	if lim, ok := limiters[host]; ok {
+		return lim
+	}
+	cfg, ok := limits[host]
+	if !ok {
+		cfg = defaultLimit
+		if isLoopback(host) {
+			cfg = limit{rate.Inf, 0}
+		}
+	}
+	lim := rate.NewLimiter(cfg.every, cfg.burst)
+	limiters[host] = lim
+	return lim
+}
+
+func isLoopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func baseTransport() http.RoundTripper {
+	mu.Lock()
+	defer mu.Unlock()
+	if proxyTransport != nil {
+		return proxyTransport
+	}
+	return http.DefaultTransport
+}
+
+func maxRetries() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return retries
+}
+
+// transport adds caching, retries, and rate limiting to the base transport.
+type transport struct{}
+
+func (transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cached := responses.lookup(req)
+	sent := req
+	if cached != nil {
+		sent = cached.conditional(req)
+	}
+	resp, err := roundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		drain(resp)
+		l.Fine("%s: not modified, using cached response", req.URL)
+		return cached.response(req), nil
+	}
+	return responses.store(req, resp)
+}
+
+func roundTrip(req *http.Request) (*http.Response, error) {
+	base := baseTransport()
+	max := 0
+	if idempotent(req) {
+		max = maxRetries()
+	}
+	lim := limiter(req.URL.Host)
+	for attempt := 0; ; attempt++ {
+		if err := lim.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+		resp, err := base.RoundTrip(req)
+		if attempt >= max || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+		delay := backoff(attempt, resp)
+		if err != nil {
+			l.Log("%s: %v, retrying in %v", req.URL, err, delay)
+		} else {
+			l.Log("%s: HTTP %s, retrying in %v", req.URL, resp.Status, delay)
+			drain(resp)
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// idempotent returns true if the request can be safely retried.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", "GET", "HEAD", "OPTIONS":
+		return req.Body == nil || req.Body == http.NoBody
+	}
+	return false
+}
+
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before a retry, using the Retry-After header if
+// present, or an exponential backoff with jitter.
+func backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			return capDelay(time.Duration(secs) * time.Second)
+		}
+	}
+	d := capDelay(retryBase << uint(attempt))
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func capDelay(d time.Duration) time.Duration {
+	if d > maxRetryDelay || d < 0 {
+		return maxRetryDelay
+	}
+	return d
+}
+
+// drain reads and closes a response body, so the connection can be reused.
+func drain(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+}
@@ -0,0 +1,196 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func init() {
+	retryBase = 10 * time.Millisecond
+	maxRetryDelay = 50 * time.Millisecond
+}
+
+// server is a test server that responds with a sequence of status codes.
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+}
+
+func newServer(t *testing.T, statuses ...int) *server {
+	s := &server{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		s.mu.Unlock()
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "status %d", status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *server) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func body(t *testing.T, resp *http.Response, err error) string {
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestRetries(t *testing.T) {
+	s := newServer(t, 503, 429, 200)
+	resp, err := Get(s.URL)
+	require.Equal(t, "status 200", body(t, resp, err))
+	require.Equal(t, 3, s.count(), "retries transient errors")
+
+	s = newServer(t, 502, 504, 503, 200)
+	resp, err = Get(s.URL)
+	require.Equal(t, "status 503", body(t, resp, err), "gives up after retries")
+	require.Equal(t, 3, s.count())
+
+	s = newServer(t, 500, 200)
+	resp, err = Get(s.URL)
+	require.Equal(t, "status 500", body(t, resp, err), "does not retry other errors")
+
+	s = newServer(t, 503, 200)
+	resp, err = Client().Post(s.URL, "text/plain", strings.NewReader("data"))
+	require.Equal(t, "status 503", body(t, resp, err), "does not retry POST")
+
+	SetRetries(0)
+	defer SetRetries(2)
+	s = newServer(t, 503, 200)
+	resp, err = Get(s.URL)
+	require.Equal(t, "status 503", body(t, resp, err), "retries disabled")
+
+	s = newServer(t)
+	s.Close()
+	_, err = Get(s.URL)
+	require.Error(t, err)
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 5; attempt++ {
+		max := retryBase << uint(attempt)
+		if max > maxRetryDelay {
+			max = maxRetryDelay
+		}
+		d := backoff(attempt, nil)
+		require.True(t, d >= max/2 && d <= max, "%v for attempt %d", d, attempt)
+	}
+	resp := &http.Response{Header: http.Header{"Retry-After": {"1"}}}
+	require.Equal(t, maxRetryDelay, backoff(0, resp), "Retry-After is capped")
+	resp.Header.Set("Retry-After", "Wed, 21 Oct 2015 07:28:00 GMT")
+	require.True(t, backoff(0, resp) <= retryBase, "only seconds are supported")
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newServer(t)
+	host := strings.TrimPrefix(s.URL, "http://")
+	SetRateLimit(host, 100*time.Millisecond, 2)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		resp, err := Get(s.URL)
+		body(t, resp, err)
+	}
+	elapsed := time.Since(start)
+	require.True(t, elapsed >= 150*time.Millisecond,
+		"rate limited after burst, took %v", elapsed)
+
+	SetRateLimit(host, 0, 0)
+	start = time.Now()
+	for i := 0; i < 4; i++ {
+		resp, err := Get(s.URL)
+		body(t, resp, err)
+	}
+	require.True(t, time.Since(start) < 100*time.Millisecond, "limit removed")
+
+	other := newServer(t)
+	SetRateLimit("", time.Hour, 1)
+	defer SetRateLimit("", time.Second, 10)
+	for i := 0; i < 4; i++ {
+		resp, err := Get(other.URL)
+		body(t, resp, err)
+	}
+	require.Equal(t, 4, other.count(), "local hosts use no limit by default")
+
+	require.Equal(t, rate.Every(time.Hour), limiter("example.com").Limit())
+	require.Equal(t, rate.Every(time.Hour), limiter("example.com:8080").Limit())
+	for _, h := range []string{"localhost", "localhost:8384", "127.0.0.1:80", "[::1]:80"} {
+		require.Equal(t, rate.Inf, limiter(h).Limit(), h)
+	}
+
+	SetRateLimit(host, time.Hour, 1)
+	resp, err := Get(s.URL)
+	body(t, resp, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+	_, err = Do(req)
+	require.Error(t, err, "wait would exceed deadline")
+	SetRateLimit(host, 0, 0)
+}
+
+func TestProxy(t *testing.T) {
+	var proxied []string
+	var mu sync.Mutex
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		fmt.Fprint(w, "proxied")
+	}))
+	defer proxy.Close()
+
+	require.Error(t, SetProxy(":invalid"))
+	require.NoError(t, SetProxy(proxy.URL))
+	resp, err := Get("http://example.invalid/path")
+	require.Equal(t, "proxied", body(t, resp, err))
+	mu.Lock()
+	require.Equal(t, []string{"http://example.invalid/path"}, proxied)
+	mu.Unlock()
+
+	require.NoError(t, SetProxy(""))
+	s := newServer(t)
+	resp, err = Get(s.URL)
+	require.Equal(t, "status 200", body(t, resp, err), "default transport")
+}
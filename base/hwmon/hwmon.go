@@ -0,0 +1,310 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hwmon provides access to hardware monitoring sensors exposed by the
+// kernel under /sys/class/hwmon.
+//
+// Each hwmon device is represented as a Chip, identified by the driver name
+// (e.g. "coretemp", "k10temp", "nvme", "thinkpad", "amdgpu"). Each chip exposes
+// a number of sensors (e.g. temp1, fan2, in0), which may have a label
+// (e.g. "Package id 0", "Composite").
+//
+// Sensors are addressed by "chip/sensor", where sensor is either the label if
+// present, or the sensor ID (e.g. "temp1"). Both parts support shell-style
+// patterns, so "coretemp/Core *" matches all core temperatures, and "*/fan1"
+// matches the first fan of every chip.
+package hwmon // import "barista.run/base/hwmon"
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+)
+
+const hwmonDir = "/sys/class/hwmon"
+
+var fs = afero.NewOsFs()
+
+// SetFsForTest replaces the filesystem used to discover sensors, allowing
+// tests to simulate sysfs.
+func SetFsForTest(testFs afero.Fs) {
+	fs = testFs
+}
+
+// Kind represents the type of measurement provided by a sensor.
+type Kind string
+
+// Sensor kinds supported by hwmon, named after the sysfs file prefix.
+const (
+	Temperature Kind = "temp"
+	Fan         Kind = "fan"
+	Voltage     Kind = "in"
+	Current     Kind = "curr"
+	Power       Kind = "power"
+	Energy      Kind = "energy"
+	Humidity    Kind = "humidity"
+)
+
+// scale converts raw sysfs values into base SI units (or RPM / percent).
+var scale = map[Kind]float64{
+	Temperature: 1000.0,    // millidegree Celsius
+	Fan:         1.0,       // RPM
+	Voltage:     1000.0,    // millivolt
+	Current:     1000.0,    // milliampere
+	Power:       1000000.0, // microwatt
+	Energy:      1000000.0, // microjoule
+	Humidity:    1000.0,    // milli-percent
+}
+
+// Chip represents a single hwmon device.
+type Chip struct {
+	// Name of the chip, as reported by the driver.
+	Name string
+	// Dir is the directory containing the sensor files. On older kernels,
+	// this is the "device" subdirectory of the hwmon entry.
+	Dir string
+}
+
+// Chips returns all hwmon chips matching the given name pattern, in order of
+// hwmon index. An empty pattern matches all chips.
+func Chips(pattern string) []Chip {
+	entries, _ := afero.ReadDir(fs, hwmonDir)
+	sort.Slice(entries, func(i, j int) bool {
+		return hwmonIndex(entries[i].Name()) < hwmonIndex(entries[j].Name())
+	})
+	var chips []Chip
+	for _, e := range entries {
+		dir := filepath.Join(hwmonDir, e.Name())
+		name, err := readString(filepath.Join(dir, "name"))
+		if err != nil {
+			// Kernels before 3.15 expose attributes on the underlying device.
+			dir = filepath.Join(dir, "device")
+			if name, err = readString(filepath.Join(dir, "name")); err != nil {
+				continue
+			}
+		}
+		if pattern == "" || matches(pattern, name) {
+			chips = append(chips, Chip{Name: name, Dir: dir})
+		}
+	}
+	return chips
+}
+
+func hwmonIndex(name string) int {
+	idx, err := strconv.Atoi(strings.TrimPrefix(name, "hwmon"))
+	if err != nil {
+		return -1
+	}
+	return idx
+}
+
+var inputRx = regexp.MustCompile(`^(temp|fan|in|curr|power|energy|humidity)(\d+)_(input|average)$`)
+
+// Sensors returns all sensors exposed by the chip, sorted by kind and index.
+func (c Chip) Sensors() []Sensor {
+	files, _ := afero.ReadDir(fs, c.Dir)
+	byID := map[string]Sensor{}
+	for _, f := range files {
+		m := inputRx.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+		id := m[1] + m[2]
+		// Prefer _input over _average (used by some power meters).
+		if _, ok := byID[id]; ok && m[3] == "average" {
+			continue
+		}
+		idx, _ := strconv.Atoi(m[2])
+		s := Sensor{Chip: c, Kind: Kind(m[1]), Index: idx, file: f.Name()}
+		s.Label, _ = readString(filepath.Join(c.Dir, id+"_label"))
+		byID[id] = s
+	}
+	sensors := make([]Sensor, 0, len(byID))
+	for _, s := range byID {
+		sensors = append(sensors, s)
+	}
+	sort.Slice(sensors, func(i, j int) bool {
+		if sensors[i].Kind != sensors[j].Kind {
+			return sensors[i].Kind < sensors[j].Kind
+		}
+		return sensors[i].Index < sensors[j].Index
+	})
+	return sensors
+}
+
+// Sensor represents a single measurement exposed by a hwmon chip.
+type Sensor struct {
+	Chip  Chip
+	Kind  Kind
+	Index int
+	// Label is the optional label provided by the driver, e.g. "Core 0".
+	Label string
+
+	file string
+}
+
+// ID returns the sysfs identifier of the sensor, e.g. "temp1".
+func (s Sensor) ID() string {
+	return fmt.Sprintf("%s%d", s.Kind, s.Index)
+}
+
+// Name returns the human-readable name of the sensor, which is its label if
+// available, or its ID otherwise.
+func (s Sensor) Name() string {
+	if s.Label != "" {
+		return s.Label
+	}
+	return s.ID()
+}
+
+// String returns the path by which the sensor can be found, "chip/name".
+func (s Sensor) String() string {
+	return s.Chip.Name + "/" + s.Name()
+}
+
+// Value reads the current value of the sensor, in base units: degrees Celsius,
+// RPM, volts, amperes, watts, joules, or percent relative humidity.
+func (s Sensor) Value() (float64, error) {
+	if s.file == "" {
+		return 0, os.ErrNotExist
+	}
+	str, err := readString(filepath.Join(s.Chip.Dir, s.file))
+	if err != nil {
+		return 0, err
+	}
+	raw, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, err
+	}
+	return raw / scale[s.Kind], nil
+}
+
+// Temperature reads the value of a temperature sensor.
+func (s Sensor) Temperature() (unit.Temperature, error) {
+	if err := s.checkKind(Temperature); err != nil {
+		return 0, err
+	}
+	v, err := s.Value()
+	return unit.FromCelsius(v), err
+}
+
+// Voltage reads the value of a voltage sensor.
+func (s Sensor) Voltage() (unit.Voltage, error) {
+	if err := s.checkKind(Voltage); err != nil {
+		return 0, err
+	}
+	v, err := s.Value()
+	return unit.Voltage(v) * unit.Volt, err
+}
+
+// Current reads the value of a current sensor.
+func (s Sensor) Current() (unit.ElectricCurrent, error) {
+	if err := s.checkKind(Current); err != nil {
+		return 0, err
+	}
+	v, err := s.Value()
+	return unit.ElectricCurrent(v) * unit.Ampere, err
+}
+
+// Power reads the value of a power sensor.
+func (s Sensor) Power() (unit.Power, error) {
+	if err := s.checkKind(Power); err != nil {
+		return 0, err
+	}
+	v, err := s.Value()
+	return unit.Power(v) * unit.Watt, err
+}
+
+// Energy reads the value of an energy sensor.
+func (s Sensor) Energy() (unit.Energy, error) {
+	if err := s.checkKind(Energy); err != nil {
+		return 0, err
+	}
+	v, err := s.Value()
+	return unit.Energy(v) * unit.Joule, err
+}
+
+// RPM reads the value of a fan sensor.
+func (s Sensor) RPM() (float64, error) {
+	if err := s.checkKind(Fan); err != nil {
+		return 0, err
+	}
+	return s.Value()
+}
+
+func (s Sensor) checkKind(k Kind) error {
+	if s.Kind != k {
+		return fmt.Errorf("%s is not a %s sensor", s, k)
+	}
+	return nil
+}
+
+// Find returns all sensors matching the "chip/sensor" pattern. If the pattern
+// does not contain a "/", it is matched against the sensor name of all chips.
+func Find(pattern string) []Sensor {
+	chipPattern, sensorPattern := "*", pattern
+	if idx := strings.Index(pattern, "/"); idx >= 0 {
+		chipPattern, sensorPattern = pattern[:idx], pattern[idx+1:]
+	}
+	var sensors []Sensor
+	for _, c := range Chips(chipPattern) {
+		for _, s := range c.Sensors() {
+			if matches(sensorPattern, s.Name()) || matches(sensorPattern, s.ID()) {
+				sensors = append(sensors, s)
+			}
+		}
+	}
+	return sensors
+}
+
+// FindOfKind returns all sensors of the given kind matching the pattern.
+func FindOfKind(kind Kind, pattern string) []Sensor {
+	var sensors []Sensor
+	for _, s := range Find(pattern) {
+		if s.Kind == kind {
+			sensors = append(sensors, s)
+		}
+	}
+	return sensors
+}
+
+// First returns the first sensor matching any of the given patterns, trying
+// each pattern in order. This is useful when the same sensor has different
+// names depending on the hardware or kernel version.
+func First(kind Kind, patterns ...string) (Sensor, bool) {
+	for _, p := range patterns {
+		if s := FindOfKind(kind, p); len(s) > 0 {
+			return s[0], true
+		}
+	}
+	return Sensor{}, false
+}
+
+func matches(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+func readString(file string) (string, error) {
+	bytes, err := afero.ReadFile(fs, file)
+	return strings.TrimSpace(string(bytes)), err
+}
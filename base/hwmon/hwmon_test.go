@@ -0,0 +1,163 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hwmon
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(files map[string]string) {
+	fs = afero.NewMemMapFs()
+	for name, contents := range files {
+		afero.WriteFile(fs, hwmonDir+"/"+name, []byte(contents+"\n"), 0644)
+	}
+}
+
+func setupTestSensors() {
+	writeFiles(map[string]string{
+		"hwmon0/name":               "acpitz",
+		"hwmon0/temp1_input":        "27800",
+		"hwmon2/name":               "coretemp",
+		"hwmon2/temp1_input":        "48000",
+		"hwmon2/temp1_label":        "Package id 0",
+		"hwmon2/temp2_input":        "45000",
+		"hwmon2/temp2_label":        "Core 0",
+		"hwmon2/temp3_input":        "47000",
+		"hwmon2/temp3_label":        "Core 1",
+		"hwmon2/temp1_crit":         "100000",
+		"hwmon10/name":              "thinkpad",
+		"hwmon10/fan1_input":        "2900",
+		"hwmon10/fan2_input":        "0",
+		"hwmon1/name":               "nvme",
+		"hwmon1/temp1_input":        "38850",
+		"hwmon1/temp1_label":        "Composite",
+		"hwmon3/device/name":        "it8728",
+		"hwmon3/device/in0_input":   "1224",
+		"hwmon3/device/curr1_input": "1500",
+		"hwmon4/name":               "power_meter",
+		"hwmon4/power1_average":     "12500000",
+		"hwmon4/energy1_input":      "3600000000",
+		"hwmon5/name":               "bad",
+		"hwmon5/temp1_input":        "not a number",
+		"hwmon6/nothing":            "",
+	})
+}
+
+func ids(sensors []Sensor) []string {
+	r := []string{}
+	for _, s := range sensors {
+		r = append(r, s.String())
+	}
+	return r
+}
+
+func TestChips(t *testing.T) {
+	require := require.New(t)
+	setupTestSensors()
+
+	names := []string{}
+	for _, c := range Chips("") {
+		names = append(names, c.Name)
+	}
+	require.Equal([]string{"acpitz", "nvme", "coretemp", "it8728",
+		"power_meter", "bad", "thinkpad"}, names, "sorted by hwmon index")
+
+	chips := Chips("it*")
+	require.Equal([]Chip{{Name: "it8728", Dir: "/sys/class/hwmon/hwmon3/device"}},
+		chips, "older kernels with attributes under device/")
+
+	require.Empty(Chips("k10temp"))
+
+	require.Equal(
+		[]string{"coretemp/Package id 0", "coretemp/Core 0", "coretemp/Core 1"},
+		ids(Chips("coretemp")[0].Sensors()))
+}
+
+func TestFind(t *testing.T) {
+	require := require.New(t)
+	setupTestSensors()
+
+	require.Equal([]string{"coretemp/Core 0", "coretemp/Core 1"},
+		ids(Find("coretemp/Core *")))
+	require.Equal([]string{"coretemp/Package id 0"},
+		ids(Find("coretemp/temp1")), "by id when labelled")
+	require.Equal([]string{"nvme/Composite"}, ids(Find("Composite")))
+	require.Equal([]string{"thinkpad/fan1"}, ids(Find("*/fan1")))
+	require.Equal([]string{"thinkpad/fan1", "thinkpad/fan2"},
+		ids(FindOfKind(Fan, "*")))
+	require.Empty(Find("coretemp/Core 5"))
+	require.Empty(Find("[/x"), "invalid pattern")
+
+	s, ok := First(Temperature, "k10temp/Tctl", "coretemp/Package id 0")
+	require.True(ok)
+	require.Equal("coretemp/Package id 0", s.String())
+	_, ok = First(Fan, "coretemp/*")
+	require.False(ok)
+}
+
+func TestValues(t *testing.T) {
+	require := require.New(t)
+	setupTestSensors()
+
+	s, _ := First(Temperature, "coretemp/Package*")
+	temp, err := s.Temperature()
+	require.NoError(err)
+	require.InDelta(48.0, temp.Celsius(), 0.001)
+	_, err = s.RPM()
+	require.Error(err, "wrong kind")
+
+	s, _ = First(Fan, "thinkpad/fan1")
+	rpm, err := s.RPM()
+	require.NoError(err)
+	require.Equal(2900.0, rpm)
+
+	s, _ = First(Voltage, "it8728/in0")
+	volts, err := s.Voltage()
+	require.NoError(err)
+	require.InDelta(1.224, volts.Volts(), 0.0001)
+
+	s, _ = First(Current, "it8728/curr1")
+	amps, err := s.Current()
+	require.NoError(err)
+	require.InDelta(1.5, amps.Amperes(), 0.0001)
+
+	s, _ = First(Power, "power_meter/power1")
+	watts, err := s.Power()
+	require.NoError(err)
+	require.InDelta(12.5, watts.Watts(), 0.0001)
+
+	s, _ = First(Energy, "power_meter/energy1")
+	energy, err := s.Energy()
+	require.NoError(err)
+	require.InDelta(3600.0, energy.Joules(), 0.0001)
+
+	s, _ = First(Temperature, "bad/*")
+	_, err = s.Temperature()
+	require.Error(err, "invalid value")
+
+	_, err = Sensor{Kind: Temperature}.Temperature()
+	require.Error(err, "zero value")
+
+	s, _ = First(Temperature, "acpitz/temp1")
+	fs.Remove("/sys/class/hwmon/hwmon0/temp1_input")
+	_, err = s.Value()
+	require.Error(err, "file removed")
+
+	SetFsForTest(afero.NewMemMapFs())
+	require.Empty(Chips(""))
+}
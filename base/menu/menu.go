@@ -0,0 +1,75 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package menu shows popup menus that let users choose one of several options,
+// using an external dmenu-compatible program such as rofi or dmenu.
+package menu // import "barista.run/base/menu"
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	command   = []string{"rofi", "-dmenu", "-i", "-p"}
+	commandMu sync.RWMutex
+)
+
+// SetCommand sets the dmenu-compatible command used to show menus. The prompt
+// is appended to the given arguments, the items are written to its standard
+// input one per line, and it should print the chosen item to standard output.
+// The default is "rofi -dmenu -i -p", use e.g. SetCommand("dmenu", "-p") for
+// dmenu.
+func SetCommand(cmd string, args ...string) {
+	commandMu.Lock()
+	defer commandMu.Unlock()
+	command = append([]string{cmd}, args...)
+}
+
+// Show displays a menu with the given prompt and items, waits for the user to
+// choose one, and returns its index. If the menu is dismissed, or the user
+// enters something that isn't one of the items, Show returns -1.
+func Show(prompt string, items ...string) (int, error) {
+	commandMu.RLock()
+	args := append(command[1:len(command):len(command)], prompt)
+	cmd := exec.Command(command[0], args...)
+	commandMu.RUnlock()
+
+	var input bytes.Buffer
+	for _, item := range items {
+		input.WriteString(strings.Replace(item, "\n", " ", -1))
+		input.WriteString("\n")
+	}
+	cmd.Stdin = &input
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		// dmenu and rofi both exit with status 1 when dismissed.
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
+			return -1, nil
+		}
+	}
+	if err != nil {
+		return -1, err
+	}
+	choice := strings.TrimRight(string(out), "\n")
+	for i, item := range items {
+		if strings.Replace(item, "\n", " ", -1) == choice {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
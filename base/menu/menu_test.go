@@ -0,0 +1,54 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package menu
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShow(t *testing.T) {
+	require := require.New(t)
+
+	// The prompt is passed as $0 to the script.
+	SetCommand("sh", "-c", `[ "$0" = "Pick" ] && sed -n 2p`)
+	idx, err := Show("Pick", "foo", "bar", "baz")
+	require.NoError(err)
+	require.Equal(1, idx)
+
+	SetCommand("sh", "-c", "cat >/dev/null; echo not-an-item")
+	idx, err = Show("Pick", "foo", "bar")
+	require.NoError(err)
+	require.Equal(-1, idx, "unknown item")
+
+	SetCommand("sh", "-c", "exit 1")
+	idx, err = Show("Pick", "foo", "bar")
+	require.NoError(err)
+	require.Equal(-1, idx, "dismissed")
+
+	SetCommand("sh", "-c", "exit 2")
+	_, err = Show("Pick", "foo")
+	require.Error(err, "command failure")
+
+	SetCommand("/non/existent/menu")
+	_, err = Show("Pick", "foo")
+	require.Error(err, "missing command")
+
+	SetCommand("sh", "-c", "sed -n 1p")
+	idx, err = Show("Pick", "multi\nline", "other")
+	require.NoError(err)
+	require.Equal(0, idx, "newlines in items")
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DiskStat represents the IO counters for a block device. Sector counts are
+// always in units of 512 bytes, regardless of the device's actual sector size.
+// See https://www.kernel.org/doc/Documentation/iostats.txt
+type DiskStat struct {
+	Reads, ReadsMerged, SectorsRead, ReadTimeMs       uint64
+	Writes, WritesMerged, SectorsWritten, WriteTimeMs uint64
+	InFlight, IOTimeMs, WeightedIOTimeMs              uint64
+	// Err is set if the line for this device could not be parsed.
+	Err error
+}
+
+// Sub returns the difference between two readings of the same device.
+// InFlight is not a counter, so the current value is retained.
+func (d DiskStat) Sub(prev DiskStat) DiskStat {
+	return DiskStat{
+		Reads:            d.Reads - prev.Reads,
+		ReadsMerged:      d.ReadsMerged - prev.ReadsMerged,
+		SectorsRead:      d.SectorsRead - prev.SectorsRead,
+		ReadTimeMs:       d.ReadTimeMs - prev.ReadTimeMs,
+		Writes:           d.Writes - prev.Writes,
+		WritesMerged:     d.WritesMerged - prev.WritesMerged,
+		SectorsWritten:   d.SectorsWritten - prev.SectorsWritten,
+		WriteTimeMs:      d.WriteTimeMs - prev.WriteTimeMs,
+		InFlight:         d.InFlight,
+		IOTimeMs:         d.IOTimeMs - prev.IOTimeMs,
+		WeightedIOTimeMs: d.WeightedIOTimeMs - prev.WeightedIOTimeMs,
+		Err:              d.Err,
+	}
+}
+
+// ParseDiskStats parses the contents of /proc/diskstats, keyed by device name.
+// Lines with too few fields are ignored, while devices with invalid values are
+// included with Err set.
+func ParseDiskStats(r io.Reader) (map[string]DiskStat, error) {
+	disks := map[string]DiskStat{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		var vals [11]uint64
+		var err error
+		for i := range vals {
+			if vals[i], err = strconv.ParseUint(fields[i+3], 10, 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			disks[fields[2]] = DiskStat{Err: err}
+			continue
+		}
+		disks[fields[2]] = DiskStat{
+			Reads: vals[0], ReadsMerged: vals[1], SectorsRead: vals[2], ReadTimeMs: vals[3],
+			Writes: vals[4], WritesMerged: vals[5], SectorsWritten: vals[6], WriteTimeMs: vals[7],
+			InFlight: vals[8], IOTimeMs: vals[9], WeightedIOTimeMs: vals[10],
+		}
+	}
+	return disks, s.Err()
+}
+
+func parseDiskStats(r io.Reader) (interface{}, error) {
+	return ParseDiskStats(r)
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDiskStats = `   8       0 sda 1000 10 20000 300 2000 20 40000 600 1 900 1200
+   8       1 sda1 100 0 2000 30 200 0 4000 60 0 90 120 0 0 0 0 5 6
+ 259       0 nvme0n1 a 0 0 0 0 0 0 0 0 0 0
+   7       0 loop0
+`
+
+func TestParseDiskStats(t *testing.T) {
+	require := require.New(t)
+	disks, err := ParseDiskStats(strings.NewReader(testDiskStats))
+	require.NoError(err)
+	require.Len(disks, 3)
+	require.Equal(DiskStat{
+		Reads: 1000, ReadsMerged: 10, SectorsRead: 20000, ReadTimeMs: 300,
+		Writes: 2000, WritesMerged: 20, SectorsWritten: 40000, WriteTimeMs: 600,
+		InFlight: 1, IOTimeMs: 900, WeightedIOTimeMs: 1200,
+	}, disks["sda"])
+	require.Equal(uint64(4000), disks["sda1"].SectorsWritten, "newer kernels")
+	require.Error(disks["nvme0n1"].Err, "invalid value")
+
+	d := disks["sda"].Sub(disks["sda1"])
+	require.Equal(uint64(18000), d.SectorsRead)
+	require.Equal(uint64(1), d.InFlight, "not a counter")
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// NetDev represents the traffic counters for a network interface.
+type NetDev struct {
+	RxBytes, RxPackets, RxErrors, RxDropped uint64
+	TxBytes, TxPackets, TxErrors, TxDropped uint64
+}
+
+// Sub returns the difference between two readings of the same interface.
+func (n NetDev) Sub(prev NetDev) NetDev {
+	return NetDev{
+		RxBytes:   n.RxBytes - prev.RxBytes,
+		RxPackets: n.RxPackets - prev.RxPackets,
+		RxErrors:  n.RxErrors - prev.RxErrors,
+		RxDropped: n.RxDropped - prev.RxDropped,
+		TxBytes:   n.TxBytes - prev.TxBytes,
+		TxPackets: n.TxPackets - prev.TxPackets,
+		TxErrors:  n.TxErrors - prev.TxErrors,
+		TxDropped: n.TxDropped - prev.TxDropped,
+	}
+}
+
+// ParseNetDev parses the contents of /proc/net/dev, keyed by interface name.
+func ParseNetDev(r io.Reader) (map[string]NetDev, error) {
+	devs := map[string]NetDev{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		// The header lines use '|' instead of ':', so they are skipped here.
+		parts := strings.SplitN(s.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		fields := strings.Fields(parts[1])
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("%s: expected 16 fields, got %d", name, len(fields))
+		}
+		var vals [16]uint64
+		for i := range vals {
+			v, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = v
+		}
+		devs[name] = NetDev{
+			RxBytes: vals[0], RxPackets: vals[1], RxErrors: vals[2], RxDropped: vals[3],
+			TxBytes: vals[8], TxPackets: vals[9], TxErrors: vals[10], TxDropped: vals[11],
+		}
+	}
+	return devs, s.Err()
+}
+
+func parseNetDev(r io.Reader) (interface{}, error) {
+	return ParseNetDev(r)
+}
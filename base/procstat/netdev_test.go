@@ -0,0 +1,50 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:  714918    5343    0    0    0     0          0         0   714918    5343    0    0    0     0       0          0
+wlp2s0:1234567890 1000001    2    3    0     0          0         0 98765432  500000    4    5    0     0       0          0
+`
+
+func TestParseNetDev(t *testing.T) {
+	require := require.New(t)
+	devs, err := ParseNetDev(strings.NewReader(testNetDev))
+	require.NoError(err)
+	require.Equal(map[string]NetDev{
+		"lo": {RxBytes: 714918, RxPackets: 5343, TxBytes: 714918, TxPackets: 5343},
+		"wlp2s0": {
+			RxBytes: 1234567890, RxPackets: 1000001, RxErrors: 2, RxDropped: 3,
+			TxBytes: 98765432, TxPackets: 500000, TxErrors: 4, TxDropped: 5,
+		},
+	}, devs)
+
+	_, err = ParseNetDev(strings.NewReader("eth0: 1 2 3\n"))
+	require.Error(err, "too few fields")
+	_, err = ParseNetDev(strings.NewReader(
+		"eth0: 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 x\n"))
+	require.Error(err, "non-numeric field")
+
+	require.Equal(NetDev{RxBytes: 10, TxPackets: 2},
+		NetDev{RxBytes: 30, TxPackets: 7}.Sub(NetDev{RxBytes: 20, TxPackets: 5}))
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package procstat provides parsing and periodic sampling of /proc files that
+// contain cumulative counters (e.g. /proc/stat, /proc/net/dev), so that modules
+// can compute rates from consecutive samples.
+//
+// All samplers share a single scheduler, so modules that use different files
+// still cause just one wakeup per refresh interval, and each file is read
+// just once per interval regardless of how many modules use it.
+package procstat // import "barista.run/base/procstat"
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"barista.run/base/value"
+	l "barista.run/logging"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+)
+
+// Sample represents the parsed contents of a /proc file at a point in time.
+type Sample struct {
+	Time time.Time
+	data interface{}
+}
+
+// Stat returns the contents of a /proc/stat sample.
+func (s Sample) Stat() Stat {
+	st, _ := s.data.(Stat)
+	return st
+}
+
+// NetDev returns the contents of a /proc/net/dev sample, keyed by interface.
+func (s Sample) NetDev() map[string]NetDev {
+	n, _ := s.data.(map[string]NetDev)
+	return n
+}
+
+// DiskStats returns the contents of a /proc/diskstats sample, keyed by device.
+func (s Sample) DiskStats() map[string]DiskStat {
+	d, _ := s.data.(map[string]DiskStat)
+	return d
+}
+
+// VMStat returns the contents of a /proc/vmstat sample, keyed by counter name.
+func (s Sample) VMStat() map[string]uint64 {
+	v, _ := s.data.(map[string]uint64)
+	return v
+}
+
+// Sampler reads a /proc file, either on demand or periodically using the
+// shared scheduler.
+type Sampler struct {
+	file  string
+	parse func(io.Reader) (interface{}, error)
+
+	// Protected by mu.
+	active bool
+	value  *value.ErrorValue // of Sample
+}
+
+// Samplers for supported /proc files.
+var (
+	StatFile      = newSampler("/proc/stat", parseStat)
+	NetDevFile    = newSampler("/proc/net/dev", parseNetDev)
+	DiskStatsFile = newSampler("/proc/diskstats", parseDiskStats)
+	VMStatFile    = newSampler("/proc/vmstat", parseVMStat)
+)
+
+var samplers = []*Sampler{StatFile, NetDevFile, DiskStatsFile, VMStatFile}
+
+func newSampler(file string, parse func(io.Reader) (interface{}, error)) *Sampler {
+	return &Sampler{file: file, parse: parse, value: new(value.ErrorValue)}
+}
+
+var fs = afero.NewOsFs()
+
+var (
+	mu        sync.Mutex
+	interval  = 3 * time.Second
+	scheduler *timing.Scheduler
+	active    []*Sampler
+)
+
+// Read reads and parses the file immediately, without affecting the shared
+// sample used by Get and Next.
+func (s *Sampler) Read() (Sample, error) {
+	f, err := fs.Open(s.file)
+	if err != nil {
+		return Sample{}, err
+	}
+	defer f.Close()
+	now := timing.Now()
+	data, err := s.parse(f)
+	if err != nil {
+		return Sample{}, err
+	}
+	return Sample{Time: now, data: data}, nil
+}
+
+// Get returns the most recent sample from the shared schedule. The first call
+// to Get or Next adds the file to the shared schedule, and reads it.
+func (s *Sampler) Get() (Sample, error) {
+	v, err := s.activate().Get()
+	if err != nil {
+		return Sample{}, err
+	}
+	sample, _ := v.(Sample)
+	return sample, nil
+}
+
+// Next returns a channel that will be closed when the next sample is read.
+func (s *Sampler) Next() <-chan struct{} {
+	return s.activate().Next()
+}
+
+func (s *Sampler) activate() *value.ErrorValue {
+	mu.Lock()
+	defer mu.Unlock()
+	if !s.active {
+		s.active = true
+		active = append(active, s)
+		s.update()
+	}
+	if scheduler == nil {
+		scheduler = timing.NewScheduler().Every(interval)
+		l.Attach(nil, scheduler, "procstat.scheduler")
+		go run(scheduler)
+	}
+	return s.value
+}
+
+func (s *Sampler) update() {
+	s.value.SetOrError(s.Read())
+}
+
+func run(sch *timing.Scheduler) {
+	for range sch.C {
+		mu.Lock()
+		if sch != scheduler {
+			mu.Unlock()
+			return
+		}
+		for _, s := range active {
+			s.update()
+		}
+		mu.Unlock()
+	}
+}
+
+// RefreshInterval configures the polling frequency for all samplers. Modules
+// that use the shared samplers will be updated at this interval.
+func RefreshInterval(newInterval time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	interval = newInterval
+	if scheduler != nil {
+		scheduler.Every(interval)
+	}
+}
+
+// SetFsForTest replaces the filesystem used to read /proc files, and resets
+// all shared state (including the refresh interval) for testing.
+func SetFsForTest(testFs afero.Fs) {
+	mu.Lock()
+	defer mu.Unlock()
+	fs = testFs
+	if scheduler != nil {
+		scheduler.Stop()
+		scheduler = nil
+	}
+	interval = 3 * time.Second
+	active = nil
+	for _, s := range samplers {
+		s.active = false
+		s.value = new(value.ErrorValue)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/testing/notifier"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestFs() afero.Fs {
+	timing.TestMode()
+	testFs := afero.NewMemMapFs()
+	SetFsForTest(testFs)
+	return testFs
+}
+
+func TestRead(t *testing.T) {
+	require := require.New(t)
+	testFs := setupTestFs()
+
+	_, err := VMStatFile.Read()
+	require.Error(err, "missing file")
+
+	afero.WriteFile(testFs, "/proc/vmstat", []byte("pgfault 10\n"), 0644)
+	s, err := VMStatFile.Read()
+	require.NoError(err)
+	require.Equal(map[string]uint64{"pgfault": 10}, s.VMStat())
+	require.Equal(timing.Now(), s.Time)
+	require.Nil(s.Stat().CPUs, "wrong accessor")
+	require.Nil(s.NetDev(), "wrong accessor")
+	require.Nil(s.DiskStats(), "wrong accessor")
+
+	afero.WriteFile(testFs, "/proc/stat", []byte("cpu 1 x\n"), 0644)
+	_, err = StatFile.Read()
+	require.Error(err, "parse error")
+}
+
+func TestSharedSampling(t *testing.T) {
+	require := require.New(t)
+	testFs := setupTestFs()
+	write := func(file, contents string) {
+		afero.WriteFile(testFs, file, []byte(contents), 0644)
+	}
+	write("/proc/stat", "cpu 1 2 3 4\n")
+	write("/proc/net/dev", "lo: 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16\n")
+
+	start := timing.Now()
+	s, err := StatFile.Get()
+	require.NoError(err)
+	require.Equal(uint64(1), s.Stat().CPU.User)
+	require.Equal(start, s.Time)
+
+	nextStat := StatFile.Next()
+	n, err := NetDevFile.Get()
+	require.NoError(err)
+	require.Equal(uint64(9), n.NetDev()["lo"].TxBytes)
+	nextNet := NetDevFile.Next()
+
+	write("/proc/stat", "cpu 5 6 7 8\n")
+	_, err = DiskStatsFile.Get()
+	require.Error(err, "missing diskstats")
+	nextDisk := DiskStatsFile.Next()
+
+	notifier.AssertNoUpdate(t, nextStat, "before tick")
+	now := timing.NextTick()
+	require.Equal(3*time.Second, now.Sub(start), "default interval")
+	notifier.AssertClosed(t, nextStat, "on tick")
+	notifier.AssertClosed(t, nextNet, "on tick")
+	notifier.AssertClosed(t, nextDisk, "on tick")
+
+	s, _ = StatFile.Get()
+	require.Equal(uint64(5), s.Stat().CPU.User)
+	require.Equal(now, s.Time)
+	require.Equal(uint64(8), s.Stat().CPU.Sub(CPU{}).Idle)
+
+	RefreshInterval(time.Minute)
+	nextStat = StatFile.Next()
+	require.Equal(time.Minute, timing.NextTick().Sub(now))
+	notifier.AssertClosed(t, nextStat, "on tick after interval change")
+
+	nextStat = StatFile.Next()
+	setupTestFs()
+	write("/proc/stat", "cpu 9 9 9 9\n")
+	timing.NextTick()
+	notifier.AssertNoUpdate(t, nextStat, "after reset")
+}
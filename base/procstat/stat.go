@@ -0,0 +1,159 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CPU represents the time spent by a CPU (or all CPUs) in various states, in
+// units of USER_HZ (usually 1/100th of a second). See proc(5).
+type CPU struct {
+	User, Nice, System, Idle, IOWait, IRQ, SoftIRQ, Steal, Guest, GuestNice uint64
+}
+
+// Total returns the total time accounted for. Guest time is already included
+// in user time, so it is not counted again.
+func (c CPU) Total() uint64 {
+	return c.User + c.Nice + c.System + c.Idle + c.IOWait +
+		c.IRQ + c.SoftIRQ + c.Steal
+}
+
+// IdleTotal returns the time spent idle, including waiting for IO.
+func (c CPU) IdleTotal() uint64 {
+	return c.Idle + c.IOWait
+}
+
+// Busy returns the time spent doing work.
+func (c CPU) Busy() uint64 {
+	return c.Total() - c.IdleTotal()
+}
+
+// Sub returns the difference between two readings of the same CPU.
+func (c CPU) Sub(prev CPU) CPU {
+	return CPU{
+		User:      c.User - prev.User,
+		Nice:      c.Nice - prev.Nice,
+		System:    c.System - prev.System,
+		Idle:      c.Idle - prev.Idle,
+		IOWait:    c.IOWait - prev.IOWait,
+		IRQ:       c.IRQ - prev.IRQ,
+		SoftIRQ:   c.SoftIRQ - prev.SoftIRQ,
+		Steal:     c.Steal - prev.Steal,
+		Guest:     c.Guest - prev.Guest,
+		GuestNice: c.GuestNice - prev.GuestNice,
+	}
+}
+
+// Usage returns the fraction of time the CPU was busy since a previous
+// reading, from 0 to 1.
+func (c CPU) Usage(prev CPU) float64 {
+	d := c.Sub(prev)
+	if d.Total() == 0 {
+		return 0
+	}
+	return float64(d.Busy()) / float64(d.Total())
+}
+
+// Stat represents the contents of /proc/stat.
+type Stat struct {
+	// CPU is the aggregate of all CPUs.
+	CPU CPU
+	// CPUs contains statistics for each CPU, indexed by CPU number. Offline
+	// CPUs are not reported by the kernel, and have zero values.
+	CPUs []CPU
+	// ContextSwitches is the total number of context switches since boot.
+	ContextSwitches uint64
+	// BootTime is the time at which the system booted.
+	BootTime time.Time
+	// Processes is the number of processes and threads created since boot.
+	Processes uint64
+	// ProcsRunning is the number of processes in a runnable state.
+	ProcsRunning uint64
+	// ProcsBlocked is the number of processes blocked on IO.
+	ProcsBlocked uint64
+}
+
+// ParseStat parses the contents of /proc/stat.
+func ParseStat(r io.Reader) (Stat, error) {
+	var st Stat
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		key := fields[0]
+		switch {
+		case key == "cpu":
+			cpu, err := parseCPU(fields[1:])
+			if err != nil {
+				return st, err
+			}
+			st.CPU = cpu
+		case strings.HasPrefix(key, "cpu"):
+			idx, err := strconv.Atoi(key[3:])
+			if err != nil {
+				return st, err
+			}
+			cpu, err := parseCPU(fields[1:])
+			if err != nil {
+				return st, err
+			}
+			for len(st.CPUs) <= idx {
+				st.CPUs = append(st.CPUs, CPU{})
+			}
+			st.CPUs[idx] = cpu
+		case key == "ctxt":
+			st.ContextSwitches, _ = strconv.ParseUint(fields[1], 10, 64)
+		case key == "btime":
+			if btime, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				st.BootTime = time.Unix(btime, 0)
+			}
+		case key == "processes":
+			st.Processes, _ = strconv.ParseUint(fields[1], 10, 64)
+		case key == "procs_running":
+			st.ProcsRunning, _ = strconv.ParseUint(fields[1], 10, 64)
+		case key == "procs_blocked":
+			st.ProcsBlocked, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return st, s.Err()
+}
+
+func parseStat(r io.Reader) (interface{}, error) {
+	return ParseStat(r)
+}
+
+func parseCPU(fields []string) (CPU, error) {
+	// Older kernels report fewer fields, missing values are left as 0.
+	vals := make([]uint64, 10)
+	for i := 0; i < len(fields) && i < len(vals); i++ {
+		v, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return CPU{}, err
+		}
+		vals[i] = v
+	}
+	return CPU{
+		User: vals[0], Nice: vals[1], System: vals[2], Idle: vals[3],
+		IOWait: vals[4], IRQ: vals[5], SoftIRQ: vals[6], Steal: vals[7],
+		Guest: vals[8], GuestNice: vals[9],
+	}, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testStat = `cpu  10132153 290696 3084719 46828483 16683 0 25195 0 175628 0
+cpu0 1393280 32966 572056 13343292 6130 0 17875 0 23933 0
+cpu2 1335209 36587 478179 5251595 4736 0 2509 0 151695 0
+intr 1462898 0 0 0
+ctxt 115315
+btime 1539548367
+processes 86031
+procs_running 6
+procs_blocked 1
+softirq 12 0 0
+`
+
+func TestParseStat(t *testing.T) {
+	require := require.New(t)
+	st, err := ParseStat(strings.NewReader(testStat))
+	require.NoError(err)
+	require.Equal(CPU{
+		User: 10132153, Nice: 290696, System: 3084719, Idle: 46828483,
+		IOWait: 16683, SoftIRQ: 25195, Guest: 175628,
+	}, st.CPU)
+	require.Len(st.CPUs, 3)
+	require.Equal(uint64(1393280), st.CPUs[0].User)
+	require.Equal(CPU{}, st.CPUs[1], "offline cpu")
+	require.Equal(uint64(2509), st.CPUs[2].SoftIRQ)
+	require.Equal(uint64(115315), st.ContextSwitches)
+	require.Equal(time.Unix(1539548367, 0), st.BootTime)
+	require.Equal(uint64(86031), st.Processes)
+	require.Equal(uint64(6), st.ProcsRunning)
+	require.Equal(uint64(1), st.ProcsBlocked)
+
+	st, err = ParseStat(strings.NewReader("cpu 1 2 3 4\n"))
+	require.NoError(err, "older kernels")
+	require.Equal(CPU{User: 1, Nice: 2, System: 3, Idle: 4}, st.CPU)
+
+	_, err = ParseStat(strings.NewReader("cpu 1 2 x 4\n"))
+	require.Error(err)
+	_, err = ParseStat(strings.NewReader("cpu0 1 2 x 4\n"))
+	require.Error(err)
+	_, err = ParseStat(strings.NewReader("cpux 1 2 3 4\n"))
+	require.Error(err)
+}
+
+func TestCPU(t *testing.T) {
+	require := require.New(t)
+	prev := CPU{User: 100, System: 50, Idle: 800, IOWait: 50}
+	curr := CPU{User: 130, System: 60, Idle: 850, IOWait: 60}
+	require.Equal(uint64(1000), prev.Total())
+	require.Equal(uint64(850), prev.IdleTotal())
+	require.Equal(uint64(150), prev.Busy())
+	require.Equal(CPU{User: 30, System: 10, Idle: 50, IOWait: 10}, curr.Sub(prev))
+	require.InDelta(0.4, curr.Usage(prev), 0.0001)
+	require.Equal(0.0, curr.Usage(curr), "no time elapsed")
+}
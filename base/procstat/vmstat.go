@@ -0,0 +1,44 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseVMStat parses the contents of /proc/vmstat, keyed by counter name,
+// e.g. "pgfault", "pswpin", "pswpout".
+func ParseVMStat(r io.Reader) (map[string]uint64, error) {
+	vm := map[string]uint64{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// A few gauges can briefly go negative, but counters never do.
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			vm[fields[0]] = v
+		}
+	}
+	return vm, s.Err()
+}
+
+func parseVMStat(r io.Reader) (interface{}, error) {
+	return ParseVMStat(r)
+}
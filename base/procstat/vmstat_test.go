@@ -0,0 +1,37 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package procstat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVMStat(t *testing.T) {
+	vm, err := ParseVMStat(strings.NewReader(`nr_free_pages 305310
+pgfault 86354435
+pswpin 0
+nr_zone_write_pending -1
+malformed line here
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint64{
+		"nr_free_pages": 305310,
+		"pgfault":       86354435,
+		"pswpin":        0,
+	}, vm)
+}
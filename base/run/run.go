@@ -0,0 +1,40 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package run provides helpers for modules that run external programs.
+package run // import "barista.run/base/run"
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Runner creates commands to run. It is usually exec.Command, but can be
+// replaced in tests (e.g. with fakeexec.Command).
+type Runner func(name string, args ...string) *exec.Cmd
+
+// Output runs the named program and returns its output. If the program fails,
+// the error includes anything it wrote to stderr, or its exit status if it
+// wrote nothing.
+func (r Runner) Output(name string, args ...string) ([]byte, error) {
+	out, err := r(name, args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if msg := strings.TrimSpace(string(exitErr.Stderr)); msg != "" {
+			return nil, fmt.Errorf("%s: %s", name, msg)
+		}
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return out, err
+}
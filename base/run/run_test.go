@@ -0,0 +1,47 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"os/exec"
+	"testing"
+
+	"barista.run/testing/fakeexec"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutput(t *testing.T) {
+	f := fakeexec.New()
+	r := Runner(fakeexec.Command)
+
+	f.Set("foo", "some output\n", "", 0)
+	out, err := r.Output("foo", "--bar")
+	require.NoError(t, err)
+	require.Equal(t, "some output\n", string(out))
+	require.Equal(t, []string{"foo", "--bar"}, f.Last())
+
+	f.Set("foo", "partial", "  something failed\n", 2)
+	out, err = r.Output("foo")
+	require.EqualError(t, err, "foo: something failed", "includes stderr")
+	require.Nil(t, out)
+
+	f.Set("foo", "", "", 3)
+	_, err = r.Output("foo")
+	require.EqualError(t, err, "foo: exit status 3", "without stderr")
+
+	_, err = Runner(exec.Command).Output("/nonexistent/command")
+	require.Error(t, err, "when the program cannot be started")
+}
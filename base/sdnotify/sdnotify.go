@@ -0,0 +1,142 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sdnotify integrates the bar with systemd when it is run as a service.
+//
+// When started by a unit with Type=notify, the bar signals readiness once it
+// has started, and if the unit sets WatchdogSec=, the bar's main loop pets the
+// watchdog, so that systemd restarts the bar if it wedges.
+// Outside of systemd, all of these are no-ops.
+//
+// To generate a user unit for the bar, run the bar with the 'systemd-unit'
+// argument, e.g.
+//
+//	~/bin/mybar systemd-unit > ~/.config/systemd/user/barista.service
+package sdnotify // import "barista.run/base/sdnotify"
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	l "barista.run/logging"
+)
+
+// Notify sends the given state (e.g. "READY=1") to the service manager. It is
+// a no-op if the bar was not started by systemd with notify support.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Abstract sockets are indicated by a leading '@', but addressed by
+	// a leading null byte.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// Ready notifies the service manager that the bar has started.
+func Ready() {
+	if err := Notify("READY=1"); err != nil {
+		l.Log("Failed to notify readiness: %v", err)
+	}
+}
+
+// Pet notifies the service manager that the bar is still alive.
+func Pet() {
+	if err := Notify("WATCHDOG=1"); err != nil {
+		l.Log("Failed to pet watchdog: %v", err)
+	}
+}
+
+// WatchdogInterval returns the watchdog timeout configured for the bar's
+// service, or 0 if the watchdog is not enabled.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Watchdog returns a channel that receives a value whenever the watchdog
+// should be pet, which is twice per watchdog interval. The bar's main loop
+// should call Pet each time, so that if the loop stops, so do the pings. The
+// channel is nil if the watchdog is not enabled, so it can always be used in
+// a select. This does not use the timing package since the watchdog must
+// keep running while the bar is paused.
+func Watchdog() <-chan time.Time {
+	interval := WatchdogInterval()
+	if interval == 0 {
+		return nil
+	}
+	l.Log("Watchdog enabled, timeout %v", interval)
+	return time.NewTicker(interval / 2).C
+}
+
+// Unit returns the contents of a systemd user unit that runs the bar at the
+// given path, restarting it if it fails or stops responding to the watchdog.
+// The unit is bound to the graphical session, so it can be enabled with
+// `systemctl --user enable barista.service`.
+func Unit(execPath string) string {
+	return fmt.Sprintf(`[Unit]
+Description=barista status bar
+PartOf=graphical-session.target
+After=graphical-session.target
+
+[Service]
+Type=notify
+ExecStart=%s
+Restart=on-failure
+WatchdogSec=30
+
+[Install]
+WantedBy=graphical-session.target
+`, execPath)
+}
+
+// Overridden in tests.
+var stdout io.Writer = os.Stdout
+var osExit = os.Exit
+var executable = os.Executable
+
+// GenerateUnit prints a unit for the running executable and exits if the
+// 'systemd-unit' argument was given, and does nothing otherwise.
+func GenerateUnit() {
+	if len(os.Args) < 2 || os.Args[1] != "systemd-unit" {
+		return
+	}
+	path, err := executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		osExit(1)
+		return
+	}
+	fmt.Fprint(stdout, Unit(path))
+	osExit(0)
+}
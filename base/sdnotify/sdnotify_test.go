@@ -0,0 +1,141 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdnotify
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// listen creates a notify socket and points NOTIFY_SOCKET at it.
+func listen(t *testing.T) *net.UnixConn {
+	dir, err := ioutil.TempDir("", "sdnotify")
+	require.NoError(t, err)
+	addr := &net.UnixAddr{Name: filepath.Join(dir, "notify"), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	require.NoError(t, err)
+	os.Setenv("NOTIFY_SOCKET", addr.Name)
+	return conn
+}
+
+func cleanup(conn *net.UnixConn) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	conn.Close()
+	os.RemoveAll(filepath.Dir(conn.LocalAddr().String()))
+}
+
+func readState(t *testing.T, conn *net.UnixConn) string {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	require.NoError(t, Notify("READY=1"), "no-op without socket")
+
+	conn := listen(t)
+	defer cleanup(conn)
+	require.NoError(t, Notify("STATUS=testing"))
+	require.Equal(t, "STATUS=testing", readState(t, conn))
+	Ready()
+	require.Equal(t, "READY=1", readState(t, conn))
+	Pet()
+	require.Equal(t, "WATCHDOG=1", readState(t, conn))
+
+	os.Setenv("NOTIFY_SOCKET", "/non/existent/socket")
+	require.Error(t, Notify("READY=1"))
+	Ready() // Only logs the error.
+}
+
+func TestWatchdog(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Unsetenv("WATCHDOG_USEC")
+	require.Equal(t, time.Duration(0), WatchdogInterval())
+	require.Nil(t, Watchdog(), "disabled without WATCHDOG_USEC")
+
+	os.Setenv("WATCHDOG_USEC", "invalid")
+	require.Equal(t, time.Duration(0), WatchdogInterval())
+
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	require.Equal(t, 30*time.Second, WatchdogInterval())
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	require.Equal(t, 30*time.Second, WatchdogInterval(), "for this process")
+
+	os.Setenv("WATCHDOG_PID", "1")
+	require.Equal(t, time.Duration(0), WatchdogInterval(), "for another process")
+	require.Nil(t, Watchdog(), "disabled for another process")
+
+	os.Setenv("WATCHDOG_USEC", "20000")
+	os.Unsetenv("WATCHDOG_PID")
+	start := time.Now()
+	ch := Watchdog()
+	require.NotNil(t, ch)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			require.Fail(t, "watchdog did not tick")
+		}
+	}
+	require.True(t, time.Since(start) >= 30*time.Millisecond,
+		"ticks at half the watchdog interval")
+}
+
+func TestGenerateUnit(t *testing.T) {
+	args := os.Args
+	defer func() {
+		os.Args = args
+		stdout = os.Stdout
+		osExit = os.Exit
+		executable = os.Executable
+	}()
+	var out bytes.Buffer
+	stdout = &out
+	exitCode := -1
+	osExit = func(code int) { exitCode = code }
+	executable = func() (string, error) { return "/home/user/bin/mybar", nil }
+
+	os.Args = []string{"mybar"}
+	GenerateUnit()
+	require.Equal(t, -1, exitCode, "no exit without argument")
+	require.Empty(t, out.String())
+
+	os.Args = []string{"mybar", "systemd-unit"}
+	GenerateUnit()
+	require.Equal(t, 0, exitCode)
+	require.Equal(t, Unit("/home/user/bin/mybar"), out.String())
+	require.Contains(t, out.String(), "ExecStart=/home/user/bin/mybar\n")
+	require.Contains(t, out.String(), "Type=notify\n")
+	require.Contains(t, out.String(), "WatchdogSec=30\n")
+
+	exitCode = -1
+	executable = func() (string, error) { return "", os.ErrNotExist }
+	GenerateUnit()
+	require.Equal(t, 1, exitCode, "exits with error if executable is unknown")
+}
@@ -0,0 +1,229 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package sound plays short alert sounds, e.g. when the battery is critical, a
+build fails, or a meeting is about to start.
+
+Sounds are identified either by an event ID from the freedesktop sound theme
+(e.g. "battery-caution", "dialog-error"), or by the absolute path to a sound
+file. They are played using libcanberra's canberra-gtk-play if available,
+falling back to PipeWire's pw-play or PulseAudio's paplay, in which case event
+IDs are resolved to files from the installed freedesktop sound theme.
+
+All alerts can be muted globally using Mute, e.g. from a click handler, and
+are rate limited, so that a flapping condition does not turn into a cacophony.
+*/
+package sound // import "barista.run/base/sound"
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	l "barista.run/logging"
+
+	"github.com/spf13/afero"
+	"golang.org/x/time/rate"
+)
+
+// Sound identifies an alert sound, either by a freedesktop sound theme event
+// ID, or by the absolute path to a sound file.
+type Sound string
+
+// Some commonly used alert sounds from the freedesktop sound theme.
+const (
+	BatteryLow      Sound = "battery-low"
+	BatteryCritical Sound = "battery-caution"
+	Error           Sound = "dialog-error"
+	Warning         Sound = "dialog-warning"
+	Complete        Sound = "complete"
+	Message         Sound = "message-new-instant"
+	Alarm           Sound = "alarm-clock-elapsed"
+	Bell            Sound = "bell"
+)
+
+// player describes an external command that can play sounds. idArgs is nil if
+// the player cannot play sounds from the theme by event ID.
+type player struct {
+	name     string
+	idArgs   func(id string) []string
+	fileArgs func(path string) []string
+}
+
+var players = []player{
+	{
+		name:     "canberra-gtk-play",
+		idArgs:   func(id string) []string { return []string{"-i", id, "-d", "barista"} },
+		fileArgs: func(path string) []string { return []string{"-f", path, "-d", "barista"} },
+	},
+	{
+		name:     "pw-play",
+		fileArgs: func(path string) []string { return []string{path} },
+	},
+	{
+		name:     "paplay",
+		fileArgs: func(path string) []string { return []string{path} },
+	},
+}
+
+// Overridden in tests.
+var (
+	fs         = afero.NewOsFs()
+	lookPath   = exec.LookPath
+	runCommand = func(cmd []string) error {
+		return exec.Command(cmd[0], cmd[1:]...).Run()
+	}
+)
+
+var (
+	mu      sync.Mutex
+	muted   bool
+	limiter = rate.NewLimiter(rate.Every(time.Second), 3)
+	testCh  chan Sound
+)
+
+// Play plays the given sound in the background, unless alerts are muted or
+// too many sounds have been played recently. Any errors are logged.
+func Play(s Sound) {
+	mu.Lock()
+	defer mu.Unlock()
+	if muted {
+		l.Fine("sound: %s not played, muted", s)
+		return
+	}
+	if !limiter.Allow() {
+		l.Fine("sound: %s not played, rate limited", s)
+		return
+	}
+	if testCh != nil {
+		testCh <- s
+		return
+	}
+	cmd, err := command(s)
+	if err != nil {
+		l.Log("sound: cannot play %s: %v", s, err)
+		return
+	}
+	go func(run func([]string) error) {
+		if err := run(cmd); err != nil {
+			l.Log("sound: failed to play %s: %v", s, err)
+		}
+	}(runCommand)
+}
+
+// Mute suppresses all alert sounds until Unmute is called.
+func Mute() {
+	mu.Lock()
+	defer mu.Unlock()
+	muted = true
+}
+
+// Unmute re-enables alert sounds.
+func Unmute() {
+	mu.Lock()
+	defer mu.Unlock()
+	muted = false
+}
+
+// Muted returns true if alert sounds are currently muted.
+func Muted() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return muted
+}
+
+// RateLimit sets the maximum rate at which sounds are played. Up to burst
+// sounds can be played at once, replenished at one sound per interval.
+// Sounds beyond the limit are dropped rather than delayed, since a late alert
+// is more confusing than a missing one. The default is a burst of 3 sounds,
+// and one sound per second.
+func RateLimit(interval time.Duration, burst int) {
+	mu.Lock()
+	defer mu.Unlock()
+	limiter = rate.NewLimiter(rate.Every(interval), burst)
+}
+
+// TestMode records sounds instead of playing them. Sounds that would have
+// been played (i.e. not muted or rate limited) are sent on the returned
+// channel, which must be drained by the test. It also resets the mute and
+// rate limit settings.
+func TestMode() <-chan Sound {
+	mu.Lock()
+	defer mu.Unlock()
+	muted = false
+	limiter = rate.NewLimiter(rate.Inf, 0)
+	testCh = make(chan Sound, 10)
+	return testCh
+}
+
+// command returns the command line that plays the sound using the first
+// available player.
+func command(s Sound) ([]string, error) {
+	for _, p := range players {
+		cmd, err := lookPath(p.name)
+		if err != nil {
+			continue
+		}
+		if filepath.IsAbs(string(s)) {
+			return append([]string{cmd}, p.fileArgs(string(s))...), nil
+		}
+		if p.idArgs != nil {
+			return append([]string{cmd}, p.idArgs(string(s))...), nil
+		}
+		path, err := themeFile(string(s))
+		if err != nil {
+			return nil, err
+		}
+		return append([]string{cmd}, p.fileArgs(path)...), nil
+	}
+	return nil, errors.New("no sound player found")
+}
+
+// themeFile finds the file for an event ID from the freedesktop sound theme in
+// the XDG data dirs.
+func themeFile(id string) (string, error) {
+	for _, dir := range dataDirs() {
+		for _, ext := range []string{".oga", ".ogg", ".wav"} {
+			path := filepath.Join(dir, "sounds", "freedesktop", "stereo", id+ext)
+			if _, err := fs.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+	}
+	return "", errors.New("sound not found in theme: " + id)
+}
+
+func dataDirs() []string {
+	var dirs []string
+	if home := os.Getenv("XDG_DATA_HOME"); home != "" {
+		dirs = append(dirs, home)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".local", "share"))
+	}
+	sysDirs := os.Getenv("XDG_DATA_DIRS")
+	if sysDirs == "" {
+		sysDirs = "/usr/local/share:/usr/share"
+	}
+	for _, d := range strings.Split(sysDirs, ":") {
+		if d != "" {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
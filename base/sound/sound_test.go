@@ -0,0 +1,176 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sound
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func setupPlayers(t *testing.T, available ...string) <-chan []string {
+	fs = afero.NewMemMapFs()
+	t.Setenv("XDG_DATA_HOME", "/home/user/.local/share")
+	t.Setenv("XDG_DATA_DIRS", "/usr/local/share:/usr/share")
+	lookPath = func(name string) (string, error) {
+		for _, a := range available {
+			if a == name {
+				return "/usr/bin/" + name, nil
+			}
+		}
+		return "", exec.ErrNotFound
+	}
+	cmds := make(chan []string, 10)
+	runCommand = func(cmd []string) error {
+		cmds <- cmd
+		return nil
+	}
+	mu.Lock()
+	muted = false
+	testCh = nil
+	limiter = rate.NewLimiter(rate.Inf, 0)
+	mu.Unlock()
+	return cmds
+}
+
+func nextCommand(t *testing.T, cmds <-chan []string) []string {
+	select {
+	case cmd := <-cmds:
+		return cmd
+	case <-time.After(time.Second):
+		require.Fail(t, "sound was not played")
+	}
+	return nil
+}
+
+func assertNotPlayed(t *testing.T, cmds <-chan []string, msg string) {
+	select {
+	case cmd := <-cmds:
+		require.Fail(t, "unexpected sound played", "%s: %v", msg, cmd)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestCanberra(t *testing.T) {
+	cmds := setupPlayers(t, "paplay", "canberra-gtk-play")
+
+	Play(BatteryCritical)
+	require.Equal(t,
+		[]string{"/usr/bin/canberra-gtk-play", "-i", "battery-caution", "-d", "barista"},
+		nextCommand(t, cmds), "plays event id with canberra")
+
+	Play("/tmp/alert.wav")
+	require.Equal(t,
+		[]string{"/usr/bin/canberra-gtk-play", "-f", "/tmp/alert.wav", "-d", "barista"},
+		nextCommand(t, cmds), "plays file with canberra")
+}
+
+func TestFilePlayers(t *testing.T) {
+	cmds := setupPlayers(t, "paplay")
+	afero.WriteFile(fs, "/usr/share/sounds/freedesktop/stereo/dialog-error.oga", nil, 0644)
+	afero.WriteFile(fs, "/usr/share/sounds/freedesktop/stereo/bell.oga", nil, 0644)
+	afero.WriteFile(fs, "/home/user/.local/share/sounds/freedesktop/stereo/bell.wav", nil, 0644)
+
+	Play(Error)
+	require.Equal(t,
+		[]string{"/usr/bin/paplay", "/usr/share/sounds/freedesktop/stereo/dialog-error.oga"},
+		nextCommand(t, cmds), "resolves event id from theme")
+
+	Play(Bell)
+	require.Equal(t,
+		[]string{"/usr/bin/paplay", "/home/user/.local/share/sounds/freedesktop/stereo/bell.wav"},
+		nextCommand(t, cmds), "user data dir takes precedence")
+
+	Play(Complete)
+	assertNotPlayed(t, cmds, "event id not in theme")
+
+	cmds = setupPlayers(t, "paplay", "pw-play")
+	Play("/tmp/alert.wav")
+	require.Equal(t, []string{"/usr/bin/pw-play", "/tmp/alert.wav"},
+		nextCommand(t, cmds), "pipewire preferred over pulseaudio")
+
+	cmds = setupPlayers(t)
+	Play("/tmp/alert.wav")
+	assertNotPlayed(t, cmds, "no player available")
+}
+
+func TestCommandErrors(t *testing.T) {
+	setupPlayers(t)
+	_, err := command(Bell)
+	require.Error(t, err, "no player available")
+
+	setupPlayers(t, "pw-play")
+	_, err = command(Bell)
+	require.Error(t, err, "sound not in theme")
+
+	played := make(chan bool)
+	runCommand = func([]string) error {
+		played <- true
+		return errors.New("something went wrong")
+	}
+	Play("/tmp/alert.wav")
+	require.True(t, <-played, "error from player is logged")
+}
+
+func TestMuteAndRateLimit(t *testing.T) {
+	cmds := setupPlayers(t, "canberra-gtk-play")
+
+	require.False(t, Muted())
+	Mute()
+	require.True(t, Muted())
+	Play(Bell)
+	assertNotPlayed(t, cmds, "while muted")
+	Unmute()
+	require.False(t, Muted())
+	Play(Bell)
+	nextCommand(t, cmds)
+
+	RateLimit(time.Hour, 2)
+	Play(Bell)
+	Play(Alarm)
+	Play(Message)
+	played := map[string]bool{}
+	played[nextCommand(t, cmds)[2]] = true
+	played[nextCommand(t, cmds)[2]] = true
+	assertNotPlayed(t, cmds, "when rate limited")
+	require.Equal(t, map[string]bool{"bell": true, "alarm-clock-elapsed": true}, played)
+}
+
+func TestTestMode(t *testing.T) {
+	cmds := setupPlayers(t, "canberra-gtk-play")
+	RateLimit(time.Hour, 1)
+	Mute()
+
+	sounds := TestMode()
+	require.False(t, Muted(), "test mode unmutes")
+	Play(BatteryLow)
+	Play(BatteryCritical)
+	require.Equal(t, BatteryLow, <-sounds)
+	require.Equal(t, BatteryCritical, <-sounds, "not rate limited in test mode")
+	assertNotPlayed(t, cmds, "in test mode")
+
+	Mute()
+	Play(Bell)
+	select {
+	case s := <-sounds:
+		require.Fail(t, "unexpected sound", "%s played while muted", s)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package value
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"barista.run/base/notifier"
+	l "barista.run/logging"
+)
+
+// Sample is a value retained by a HistoryValue, with the time it was set.
+type Sample struct {
+	Value interface{}
+	Time  time.Time
+}
+
+// Stats are statistics derived from the numeric samples in a HistoryValue.
+// Samples that are not numbers are ignored.
+type Stats struct {
+	// Count is the number of numeric samples.
+	Count int
+	Min   float64
+	Max   float64
+	Avg   float64
+	// Rate is the change per second between the oldest and the latest
+	// numeric samples, or 0 if there are fewer than two. Its sign can be used
+	// to show a trend.
+	Rate float64
+}
+
+// HistoryValue is a Value that retains the last N values set, with their
+// timestamps, for example to show a sparkline or a trend.
+type HistoryValue struct {
+	mu      sync.RWMutex
+	samples []Sample // ring buffer, oldest at start.
+	start   int
+	count   int
+	source  notifier.Source
+}
+
+// History constructs a HistoryValue that retains the last n values.
+func History(n int) *HistoryValue {
+	if n < 1 {
+		n = 1
+	}
+	return &HistoryValue{samples: make([]Sample, n)}
+}
+
+// Next returns a channel that will be closed on the next update.
+func (h *HistoryValue) Next() <-chan struct{} {
+	return h.source.Next()
+}
+
+// Subscribe returns a channel that will receive an empty struct{} on each value
+// change until it's cleaned up using the done func.
+func (h *HistoryValue) Subscribe() (sub <-chan struct{}, done func()) {
+	return h.source.Subscribe()
+}
+
+// Get returns the latest value, or nil if no values have been set.
+func (h *HistoryValue) Get() interface{} {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.count == 0 {
+		return nil
+	}
+	return h.at(h.count - 1).Value
+}
+
+// Set adds a value at the current time, discarding the oldest value if the
+// history is full, and notifies any subscribers.
+func (h *HistoryValue) Set(value interface{}) {
+	h.SetAt(value, time.Now())
+}
+
+// SetAt adds a value with the given timestamp, e.g. from timing.Now(). Values
+// should be added in chronological order.
+func (h *HistoryValue) SetAt(value interface{}, at time.Time) {
+	h.mu.Lock()
+	if h.count < len(h.samples) {
+		h.samples[(h.start+h.count)%len(h.samples)] = Sample{value, at}
+		h.count++
+	} else {
+		h.samples[h.start] = Sample{value, at}
+		h.start = (h.start + 1) % len(h.samples)
+	}
+	h.mu.Unlock()
+	l.Fine("%s: Store %#v", l.ID(h), value)
+	h.source.Notify()
+}
+
+// Clear discards all values, and notifies any subscribers.
+func (h *HistoryValue) Clear() {
+	h.mu.Lock()
+	for i := range h.samples {
+		h.samples[i] = Sample{}
+	}
+	h.start, h.count = 0, 0
+	h.mu.Unlock()
+	h.source.Notify()
+}
+
+// Samples returns the retained samples, oldest first.
+func (h *HistoryValue) Samples() []Sample {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r := make([]Sample, h.count)
+	for i := range r {
+		r[i] = h.at(i)
+	}
+	return r
+}
+
+// Floats returns the retained numeric values, oldest first, for use in a
+// sparkline. Values that are not numbers are skipped.
+func (h *HistoryValue) Floats() []float64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r := make([]float64, 0, h.count)
+	for i := 0; i < h.count; i++ {
+		if f, ok := toFloat(h.at(i).Value); ok {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
+// Stats returns statistics for the retained numeric values.
+func (h *HistoryValue) Stats() Stats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var s Stats
+	var first, last Sample
+	var sum, firstVal, lastVal float64
+	for i := 0; i < h.count; i++ {
+		sample := h.at(i)
+		f, ok := toFloat(sample.Value)
+		if !ok {
+			continue
+		}
+		if s.Count == 0 {
+			s.Min, s.Max = f, f
+			first, firstVal = sample, f
+		}
+		if f < s.Min {
+			s.Min = f
+		}
+		if f > s.Max {
+			s.Max = f
+		}
+		sum += f
+		s.Count++
+		last, lastVal = sample, f
+	}
+	if s.Count == 0 {
+		return s
+	}
+	s.Avg = sum / float64(s.Count)
+	if elapsed := last.Time.Sub(first.Time).Seconds(); elapsed > 0 {
+		s.Rate = (lastVal - firstVal) / elapsed
+	}
+	return s
+}
+
+// at returns the i-th oldest sample. Must be called with the lock held.
+func (h *HistoryValue) at(i int) Sample {
+	return h.samples[(h.start+i)%len(h.samples)]
+}
+
+// toFloat converts any value with a numeric kind, including named types such
+// as time.Duration, to a float64.
+func toFloat(v interface{}) (float64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(r.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(r.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return r.Float(), true
+	}
+	return 0, false
+}
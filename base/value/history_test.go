@@ -0,0 +1,72 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package value
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/testing/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	require := require.New(t)
+	h := History(3)
+	require.Nil(h.Get(), "Empty history returns nil")
+	require.Empty(h.Samples())
+	require.Equal(Stats{}, h.Stats())
+
+	sub, done := h.Subscribe()
+	defer done()
+
+	start := time.Date(2018, 4, 1, 10, 0, 0, 0, time.UTC)
+	h.SetAt(4, start)
+	notifier.AssertNotified(t, sub, "on set")
+	require.Equal(4, h.Get())
+	require.Equal(Stats{Count: 1, Min: 4, Max: 4, Avg: 4}, h.Stats(),
+		"Rate requires two samples")
+
+	h.SetAt(uint8(1), start.Add(time.Second))
+	h.SetAt("not a number", start.Add(2*time.Second))
+	require.Equal("not a number", h.Get())
+	require.Equal([]float64{4, 1}, h.Floats())
+	require.Equal(Stats{Count: 2, Min: 1, Max: 4, Avg: 2.5, Rate: -3}, h.Stats())
+
+	h.SetAt(7.5, start.Add(3*time.Second))
+	h.SetAt(time.Duration(10), start.Add(5*time.Second))
+	require.Equal([]Sample{
+		{"not a number", start.Add(2 * time.Second)},
+		{7.5, start.Add(3 * time.Second)},
+		{time.Duration(10), start.Add(5 * time.Second)},
+	}, h.Samples(), "Oldest values are discarded")
+	require.Equal(Stats{Count: 2, Min: 7.5, Max: 10, Avg: 8.75, Rate: 1.25}, h.Stats())
+
+	h.Clear()
+	notifier.AssertNotified(t, sub, "on clear")
+	require.Nil(h.Get())
+	require.Empty(h.Floats())
+
+	nextCh := h.Next()
+	before := time.Now()
+	h.Set(true)
+	notifier.AssertClosed(t, nextCh, "on set")
+	samples := h.Samples()
+	require.Len(samples, 1)
+	require.False(samples[0].Time.Before(before), "Set uses the current time")
+	require.Equal(0, h.Stats().Count, "non-numeric values ignored")
+
+	require.NotPanics(func() { History(0).Set(1) })
+}
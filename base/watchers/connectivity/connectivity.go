@@ -0,0 +1,118 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connectivity watches for changes in network connectivity, allowing
+// network modules to pause polling while offline and refresh as soon as the
+// connection is restored.
+//
+// The machine is considered online when there is a default route over a link
+// that is up, as reported by netlink. If the link state cannot be determined
+// (e.g. netlink is unavailable), the machine is assumed to be online.
+package connectivity // import "barista.run/base/watchers/connectivity"
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/base/watchers/netlink"
+	l "barista.run/logging"
+)
+
+var (
+	current  value.Value // of bool
+	once     sync.Once
+	testMode uint32 // atomic bool
+)
+
+func init() {
+	current.Set(true)
+}
+
+// Online returns true if the machine currently has a network connection.
+func Online() bool {
+	once.Do(start)
+	return current.Get().(bool)
+}
+
+// Next returns a channel that signals when connectivity changes.
+func Next() <-chan struct{} {
+	once.Do(start)
+	return current.Next()
+}
+
+// SetForTest allows simulating connectivity changes in tests. Once called, the
+// real connectivity state is no longer tracked.
+func SetForTest(online bool) {
+	once.Do(func() {}) // Prevent the real watcher from starting.
+	atomic.StoreUint32(&testMode, 1)
+	current.Set(online)
+}
+
+// Mark returns the given output with a "no network" marker appended while the
+// machine is offline, to indicate that it may be out of date. Network modules
+// should also re-render their output when connectivity changes (see Next).
+func Mark(o bar.Output) bar.Output {
+	if Online() {
+		return o
+	}
+	var out bar.Segments
+	if o != nil {
+		for _, s := range o.Segments() {
+			out = append(out, s.Clone())
+		}
+	}
+	return append(out, bar.TextSegment("no network").ShortText("!"))
+}
+
+func start() {
+	if netlink.Links() == nil {
+		// No link information at all, so netlink is most likely unavailable.
+		l.Log("No network link information, assuming online")
+		return
+	}
+	sub := netlink.DefaultRoute()
+	update(sub.Get())
+	go watch(sub)
+}
+
+func watch(sub *netlink.Subscription) {
+	defer sub.Unsubscribe()
+	for range sub.C {
+		if atomic.LoadUint32(&testMode) > 0 {
+			return
+		}
+		update(sub.Get())
+	}
+}
+
+func update(link netlink.Link) {
+	online := isOnline(link)
+	if online == current.Get().(bool) {
+		return
+	}
+	l.Fine("Connectivity changed, online: %v (default route: %q)", online, link.Name)
+	current.Set(online)
+}
+
+func isOnline(link netlink.Link) bool {
+	switch link.State {
+	case netlink.Up, netlink.Unknown:
+		// Virtual links (e.g. VPN tunnels) usually report an unknown state.
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/netlink"
+
+	"github.com/stretchr/testify/require"
+)
+
+func assertChanged(t *testing.T, ch <-chan struct{}, online bool, msg string) {
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		require.Fail(t, "Connectivity did not change", msg)
+	}
+	require.Equal(t, online, Online(), msg)
+}
+
+func assertNotChanged(t *testing.T, ch <-chan struct{}, msg string) {
+	select {
+	case <-ch:
+		require.Fail(t, "Unexpected connectivity change", msg)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// resetForTest starts tracking netlink again, using the netlink test mode.
+func resetForTest() netlink.Tester {
+	nlt := netlink.TestMode()
+	once = sync.Once{}
+	atomic.StoreUint32(&testMode, 0)
+	current.Set(true)
+	return nlt
+}
+
+func TestNoLinkInformation(t *testing.T) {
+	resetForTest()
+	require.True(t, Online(), "online without any link information")
+}
+
+func TestConnectivity(t *testing.T) {
+	nlt := resetForTest()
+	eth := nlt.AddLink(netlink.Link{Name: "eth0", State: netlink.Up})
+	require.False(t, Online(), "offline without a default route")
+
+	ch := Next()
+	nlt.AddDefaultRoute(eth, 100)
+	assertChanged(t, ch, true, "online with a default route")
+
+	ch = Next()
+	wlan := nlt.AddLink(netlink.Link{Name: "wlan0", State: netlink.Dormant})
+	nlt.AddDefaultRoute(wlan, 600)
+	assertNotChanged(t, ch, "lower priority default route")
+
+	nlt.UpdateLink(eth, netlink.Link{State: netlink.Down})
+	assertChanged(t, ch, false, "default route link is down")
+
+	ch = Next()
+	nlt.RemoveDefaultRoute(eth, 100)
+	assertNotChanged(t, ch, "default route moved to another link that is down")
+
+	nlt.UpdateLink(wlan, netlink.Link{State: netlink.Up})
+	assertChanged(t, ch, true, "default route link is up")
+
+	ch = Next()
+	tun := nlt.AddLink(netlink.Link{Name: "tun0", State: netlink.Unknown})
+	nlt.AddDefaultRoute(tun, 50)
+	assertNotChanged(t, ch, "default route moved to link with unknown state")
+
+	nlt.RemoveLink(tun)
+	nlt.RemoveLink(wlan)
+	assertChanged(t, ch, false, "all links removed")
+}
+
+func TestSetForTest(t *testing.T) {
+	ch := Next()
+	SetForTest(true)
+	assertChanged(t, ch, true, "SetForTest(true)")
+
+	ch = Next()
+	SetForTest(false)
+	assertChanged(t, ch, false, "SetForTest(false)")
+
+	SetForTest(true)
+}
+
+func TestMark(t *testing.T) {
+	SetForTest(true)
+	out := bar.Segments{bar.TextSegment("foo")}
+	require.Equal(t, out, Mark(out), "online output is unchanged")
+
+	SetForTest(false)
+	marked := Mark(out).Segments()
+	require.Len(t, marked, 2, "marker added while offline")
+	txt, _ := marked[0].Content()
+	require.Equal(t, "foo", txt)
+	txt, _ = marked[1].Content()
+	require.Equal(t, "no network", txt)
+	require.Len(t, out, 1, "original output is not modified")
+
+	marked = Mark(nil).Segments()
+	require.Len(t, marked, 1, "marker shown without output")
+	txt, _ = marked[0].Content()
+	require.Equal(t, "no network", txt)
+}
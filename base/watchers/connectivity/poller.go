@@ -0,0 +1,50 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import "barista.run/bar"
+
+// Poller helps network modules that poll on a schedule to skip polls while
+// offline, and refresh as soon as the connection is restored instead.
+type Poller struct {
+	fetch   func()
+	fetched bool
+}
+
+// NewPoller creates a Poller that calls fetch to update the module's data.
+func NewPoller(fetch func()) *Poller {
+	return &Poller{fetch: fetch}
+}
+
+// Poll calls the fetch function if the machine is online, and returns true if
+// it did. Modules should call Poll on start, on each tick of their schedule,
+// and whenever connectivity changes (see Next).
+func (p *Poller) Poll() bool {
+	if !Online() {
+		return false
+	}
+	p.fetch()
+	p.fetched = true
+	return true
+}
+
+// Output returns the module's output, marked while the machine is offline
+// (see Mark). If nothing has been fetched yet, only the marker is returned.
+func (p *Poller) Output(output func() bar.Output) bar.Output {
+	if !p.fetched {
+		return Mark(nil)
+	}
+	return Mark(output())
+}
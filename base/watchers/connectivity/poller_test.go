@@ -0,0 +1,51 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectivity
+
+import (
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoller(t *testing.T) {
+	SetForTest(false)
+	defer SetForTest(true)
+
+	fetches := 0
+	p := NewPoller(func() { fetches++ })
+	output := func() bar.Output { return outputs.Text("data") }
+
+	require.False(t, p.Poll(), "no poll while offline")
+	require.Equal(t, 0, fetches)
+	require.Equal(t, Mark(nil), p.Output(output),
+		"only the marker before anything is fetched")
+
+	SetForTest(true)
+	require.True(t, p.Poll(), "polls while online")
+	require.Equal(t, 1, fetches)
+	require.Equal(t, outputs.Text("data"), p.Output(output))
+
+	SetForTest(false)
+	require.False(t, p.Poll())
+	require.Equal(t, 1, fetches)
+	require.Equal(t, bar.Segments{
+		outputs.Text("data").Segments()[0],
+		bar.TextSegment("no network").ShortText("!"),
+	}, p.Output(output), "last fetched output is marked while offline")
+}
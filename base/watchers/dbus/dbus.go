@@ -12,8 +12,9 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package dbus provides watchers that notify when dbus name owners or object
-// properties change, and infrastructure for testing code that uses them.
+// Package dbus provides watchers that notify when dbus name owners, object
+// properties, or managed objects change, and infrastructure for testing code
+// that uses them.
 package dbus // import "barista.run/base/watchers/dbus"
 
 import (
@@ -55,14 +56,17 @@ func SetupTestBus() *TestBus {
 type dbusConn interface {
 	BusObject() dbus.BusObject
 	Close() error
+	Eavesdrop(chan<- *dbus.Message)
 	Object(string, dbus.ObjectPath) dbus.BusObject
 	RemoveSignal(chan<- *dbus.Signal)
 	Signal(chan<- *dbus.Signal)
 }
 
 const (
-	bus   string = "org.freedesktop.DBus"
-	props string = "org.freedesktop.DBus.Properties"
+	bus            string = "org.freedesktop.DBus"
+	props          string = "org.freedesktop.DBus.Properties"
+	objectManager  string = "org.freedesktop.DBus.ObjectManager"
+	introspectable string = "org.freedesktop.DBus.Introspectable"
 
 	busPath dbus.ObjectPath = "/org/freedesktop/DBus"
 )
@@ -73,6 +77,13 @@ var (
 	nameOwnerChanged = dbusName{bus, "NameOwnerChanged"}
 
 	propsChanged = dbusName{props, "PropertiesChanged"}
+	setProperty  = dbusName{props, "Set"}
+
+	getManagedObjects = dbusName{objectManager, "GetManagedObjects"}
+	interfacesAdded   = dbusName{objectManager, "InterfacesAdded"}
+	interfacesRemoved = dbusName{objectManager, "InterfacesRemoved"}
+
+	introspectCall = dbusName{introspectable, "Introspect"}
 )
 
 // dbusName represents a DBus name, specifying an interface and member pair.
@@ -0,0 +1,106 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus"
+)
+
+// MethodCall is emitted on MonitorWatcher.Updates for each method call seen
+// on the bus that matches the watcher's rules.
+type MethodCall struct {
+	Sender      string
+	Destination string
+	Path        dbus.ObjectPath
+	// Method is the fully qualified method name, e.g.
+	// org.freedesktop.Notifications.Notify.
+	Method string
+	Args   []interface{}
+}
+
+// MonitorWatcher is a watcher for method calls made by other clients on the
+// bus, using the org.freedesktop.DBus.Monitoring interface. Since a monitoring
+// connection cannot be used for anything else, it uses its own connection.
+type MonitorWatcher struct {
+	Updates <-chan MethodCall
+	updates chan<- MethodCall
+
+	conn  dbusConn
+	msgCh chan *dbus.Message
+}
+
+var becomeMonitor = dbusName{"org.freedesktop.DBus.Monitoring", "BecomeMonitor"}
+
+// Unsubscribe closes the monitoring connection. The watcher cannot be used
+// after calling this method. Usually `defer`d when creating a watcher.
+func (m *MonitorWatcher) Unsubscribe() {
+	m.conn.Close()
+}
+
+func (m *MonitorWatcher) listen() {
+	for msg := range m.msgCh {
+		if msg.Type != dbus.TypeMethodCall {
+			continue
+		}
+		c := MethodCall{Args: msg.Body}
+		c.Sender, _ = msg.Headers[dbus.FieldSender].Value().(string)
+		c.Destination, _ = msg.Headers[dbus.FieldDestination].Value().(string)
+		c.Path, _ = msg.Headers[dbus.FieldPath].Value().(dbus.ObjectPath)
+		iface, _ := msg.Headers[dbus.FieldInterface].Value().(string)
+		member, _ := msg.Headers[dbus.FieldMember].Value().(string)
+		c.Method = dbusName{iface, member}.String()
+		select {
+		case m.updates <- c:
+		default:
+			// Monitoring must not block the bus connection, so calls are
+			// dropped if the consumer falls behind.
+		}
+	}
+}
+
+// WatchMethodCalls constructs a watcher for calls to the given methods of an
+// interface, or to any method of the interface if no methods are given. It
+// returns an error if the bus does not allow the connection to become a
+// monitor (e.g. dbus-daemon older than 1.9.10). Watchers must be cleaned up by
+// calling Unsubscribe.
+func WatchMethodCalls(busType BusType, iface string, methods ...string) (*MonitorWatcher, error) {
+	rules := []string{}
+	for _, m := range methods {
+		rules = append(rules, fmt.Sprintf(
+			"type='method_call',interface='%s',member='%s'", iface, m))
+	}
+	if len(rules) == 0 {
+		rules = append(rules, fmt.Sprintf("type='method_call',interface='%s'", iface))
+	}
+	conn := busType()
+	if err := becomeMonitor.call(conn, rules, uint32(0)).Err; err != nil {
+		conn.Close()
+		return nil, err
+	}
+	updates := make(chan MethodCall, 10)
+	m := &MonitorWatcher{
+		Updates: updates,
+		updates: updates,
+		conn:    conn,
+		msgCh:   make(chan *dbus.Message, 10),
+	}
+	// Must be set up after BecomeMonitor, since all messages received,
+	// including its reply, are sent to the eavesdrop channel.
+	conn.Eavesdrop(m.msgCh)
+	go m.listen()
+	return m, nil
+}
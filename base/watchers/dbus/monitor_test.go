@@ -0,0 +1,95 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+func nextCall(t *testing.T, ch <-chan MethodCall, formatAndArgs ...interface{}) MethodCall {
+	select {
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "Expected a method call", formatAndArgs...)
+	case c := <-ch:
+		return c
+	}
+	return MethodCall{}
+}
+
+func assertNoCall(t *testing.T, ch <-chan MethodCall, formatAndArgs ...interface{}) {
+	select {
+	case <-time.After(10 * time.Millisecond):
+		// test passed
+	case <-ch:
+		require.Fail(t, "Expected no method call", formatAndArgs...)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	bus := SetupTestBus()
+	srv := bus.RegisterService("org.i3barista.services.Monitored")
+	obj := srv.Object("/org/i3barista/Monitored", "org.i3barista.Monitored")
+	obj.On("Ping", func(args ...interface{}) ([]interface{}, error) {
+		return []interface{}{"pong"}, nil
+	})
+
+	w, err := WatchMethodCalls(Test, "org.i3barista.Monitored", "Ping")
+	require.NoError(t, err)
+	all, err := WatchMethodCalls(Test, "org.i3barista.Monitored")
+	require.NoError(t, err)
+
+	client := Test().Object("org.i3barista.services.Monitored", "/org/i3barista/Monitored")
+	c := client.Call("org.i3barista.Monitored.Ping", 0, "a", uint32(1))
+	require.NoError(t, c.Err)
+	require.Equal(t, []interface{}{"pong"}, c.Body,
+		"monitoring does not affect the call")
+
+	call := nextCall(t, w.Updates, "on matching call")
+	require.Equal(t, MethodCall{
+		Destination: "org.i3barista.services.Monitored",
+		Path:        dbus.ObjectPath("/org/i3barista/Monitored"),
+		Method:      "org.i3barista.Monitored.Ping",
+		Args:        []interface{}{"a", uint32(1)},
+	}, call)
+	require.Equal(t, call, nextCall(t, all.Updates, "on matching call"))
+
+	client.Call("org.i3barista.Monitored.Other", 0)
+	assertNoCall(t, w.Updates, "on call to different method")
+	call = nextCall(t, all.Updates, "on call to different method")
+	require.Equal(t, "org.i3barista.Monitored.Other", call.Method)
+
+	client.Call("org.i3barista.Unrelated.Ping", 0)
+	assertNoCall(t, w.Updates, "on call to different interface")
+	assertNoCall(t, all.Updates, "on call to different interface")
+
+	w.Unsubscribe()
+	all.Unsubscribe()
+	client.Call("org.i3barista.Monitored.Ping", 0)
+	assertNoCall(t, w.Updates, "after unsubscribe")
+}
+
+func TestMonitorError(t *testing.T) {
+	bus := SetupTestBus()
+	bus.BusObject().On("org.freedesktop.DBus.Monitoring.BecomeMonitor",
+		func(...interface{}) ([]interface{}, error) {
+			return nil, dbus.ErrMsgNoObject
+		})
+	_, err := WatchMethodCalls(Test, "org.i3barista.Monitored")
+	require.Error(t, err)
+}
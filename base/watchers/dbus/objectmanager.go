@@ -0,0 +1,274 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+// Interfaces maps the names of interfaces implemented by an object to a
+// snapshot of their properties, extracted from dbus.Variant values.
+type Interfaces map[string]map[string]interface{}
+
+// ObjectsChange is emitted on ObjectManagerWatcher.Updates whenever objects
+// are added to or removed from the managed tree. Added maps object paths to
+// the interfaces (and their initial properties) that were added, and Removed
+// maps object paths to the names of interfaces that were removed.
+type ObjectsChange struct {
+	Added   map[string]Interfaces
+	Removed map[string][]string
+}
+
+// ObjectManagerWatcher is a watcher for the objects exported by a service
+// that implements org.freedesktop.DBus.ObjectManager (e.g. BlueZ, UPower,
+// udisks). It tracks objects as they are added and removed, and provides the
+// initial properties of each interface.
+//
+// Property changes on individual objects are not tracked, since the
+// ObjectManager interface does not signal them. Use WatchProperties on the
+// object path to track those instead.
+type ObjectManagerWatcher struct {
+	Updates  <-chan ObjectsChange
+	onChange chan<- ObjectsChange
+
+	conn   dbusConn
+	dbusCh chan *Signal
+
+	service string
+	root    dbus.ObjectPath
+	ifaces  map[string]bool
+
+	mu sync.RWMutex
+
+	owner   string
+	objects map[string]Interfaces
+	closed  bool
+}
+
+// Get returns the latest snapshot of all managed objects, keyed by path.
+func (o *ObjectManagerWatcher) Get() map[string]Interfaces {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	r := map[string]Interfaces{}
+	for path, ifaces := range o.objects {
+		r[path] = ifaces.copy()
+	}
+	return r
+}
+
+// Unsubscribe clears all subscriptions and internal state. The watcher cannot
+// be used after calling this method. Usually `defer`d when creating a watcher.
+func (o *ObjectManagerWatcher) Unsubscribe() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.conn.RemoveSignal(o.dbusCh)
+	o.conn.Close()
+	o.objects = nil
+	o.owner = ""
+	o.closed = true
+}
+
+func (o *ObjectManagerWatcher) listen() {
+	for sig := range o.dbusCh {
+		switch sig.Name {
+		case nameOwnerChanged.String():
+			o.ownerChanged(sig.Body[2].(string))
+		case interfacesAdded.String():
+			o.handleAdded(sig)
+		case interfacesRemoved.String():
+			o.handleRemoved(sig)
+		}
+	}
+}
+
+func (o *ObjectManagerWatcher) handleAdded(sig *Signal) {
+	path, _ := sig.Body[0].(dbus.ObjectPath)
+	added, _ := sig.Body[1].(map[string]map[string]dbus.Variant)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Signals may still be queued when the watcher is unsubscribed.
+	if o.closed {
+		return
+	}
+	ifaces := o.filter(added)
+	if len(ifaces) == 0 {
+		return
+	}
+	obj, ok := o.objects[string(path)]
+	if !ok {
+		obj = Interfaces{}
+		o.objects[string(path)] = obj
+	}
+	for iface, props := range ifaces {
+		obj[iface] = props
+	}
+	o.onChange <- ObjectsChange{Added: map[string]Interfaces{string(path): ifaces.copy()}}
+}
+
+func (o *ObjectManagerWatcher) handleRemoved(sig *Signal) {
+	path, _ := sig.Body[0].(dbus.ObjectPath)
+	removed, _ := sig.Body[1].([]string)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	obj, ok := o.objects[string(path)]
+	if !ok {
+		return
+	}
+	ifaces := []string{}
+	for _, iface := range removed {
+		if _, ok := obj[iface]; ok {
+			delete(obj, iface)
+			ifaces = append(ifaces, iface)
+		}
+	}
+	if len(obj) == 0 {
+		delete(o.objects, string(path))
+	}
+	if len(ifaces) == 0 {
+		return
+	}
+	o.onChange <- ObjectsChange{Removed: map[string][]string{string(path): ifaces}}
+}
+
+// filter converts the interfaces and properties of an object to the internal
+// representation, retaining only interfaces of interest to the watcher.
+func (o *ObjectManagerWatcher) filter(ifaces map[string]map[string]dbus.Variant) Interfaces {
+	r := Interfaces{}
+	for iface, props := range ifaces {
+		if len(o.ifaces) > 0 && !o.ifaces[iface] {
+			continue
+		}
+		p := map[string]interface{}{}
+		for k, v := range props {
+			p[k] = v.Value()
+		}
+		r[iface] = p
+	}
+	return r
+}
+
+func (o *ObjectManagerWatcher) matchOptions() []dbus.MatchOption {
+	return []dbus.MatchOption{
+		dbus.WithMatchOption("sender", o.owner),
+		dbus.WithMatchOption("path", string(o.root)),
+	}
+}
+
+func (o *ObjectManagerWatcher) ownerChanged(owner string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return
+	}
+	ch := o.setOwnerLocked(owner)
+	if len(ch.Added) == 0 && len(ch.Removed) == 0 {
+		return
+	}
+	o.onChange <- ch
+}
+
+// setOwnerLocked updates the subscriptions and objects for a new owner, and
+// returns the change in objects between the previous owner and the new one.
+func (o *ObjectManagerWatcher) setOwnerLocked(owner string) ObjectsChange {
+	ch := ObjectsChange{Removed: map[string][]string{}}
+	if o.owner != "" {
+		m := o.matchOptions()
+		interfacesAdded.removeMatch(o.conn, m...)
+		interfacesRemoved.removeMatch(o.conn, m...)
+		for path, ifaces := range o.objects {
+			for iface := range ifaces {
+				ch.Removed[path] = append(ch.Removed[path], iface)
+			}
+		}
+		o.objects = map[string]Interfaces{}
+	}
+	o.owner = owner
+	if o.owner != "" {
+		m := o.matchOptions()
+		interfacesAdded.addMatch(o.conn, m...)
+		interfacesRemoved.addMatch(o.conn, m...)
+		ch.Added = o.fetch()
+	}
+	return ch
+}
+
+// fetch replaces the current set of objects with the result of calling
+// GetManagedObjects on the current owner, and returns a copy of the result.
+func (o *ObjectManagerWatcher) fetch() map[string]Interfaces {
+	var managed map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	c := o.conn.Object(o.service, o.root).Call(getManagedObjects.String(), 0)
+	if err := c.Store(&managed); err != nil {
+		return nil
+	}
+	r := map[string]Interfaces{}
+	for path, ifaces := range managed {
+		f := o.filter(ifaces)
+		if len(f) == 0 {
+			continue
+		}
+		o.objects[string(path)] = f
+		r[string(path)] = f.copy()
+	}
+	return r
+}
+
+func (i Interfaces) copy() Interfaces {
+	r := Interfaces{}
+	for iface, props := range i {
+		p := map[string]interface{}{}
+		for k, v := range props {
+			p[k] = v
+		}
+		r[iface] = p
+	}
+	return r
+}
+
+// WatchObjects constructs a DBus object manager watcher for the given service,
+// using the object at root as the org.freedesktop.DBus.ObjectManager. If any
+// interfaces are given, only those interfaces are tracked, and objects that
+// implement none of them are ignored. Watchers must be cleaned up by calling
+// Unsubscribe.
+func WatchObjects(busType BusType, service string, root string, ifaces ...string) *ObjectManagerWatcher {
+	conn := busType()
+	updates := make(chan ObjectsChange, 10)
+	w := &ObjectManagerWatcher{
+		Updates:  updates,
+		onChange: updates,
+		conn:     conn,
+		dbusCh:   make(chan *Signal, 10),
+		service:  service,
+		root:     dbus.ObjectPath(root),
+		ifaces:   map[string]bool{},
+		objects:  map[string]Interfaces{},
+	}
+	for _, i := range ifaces {
+		w.ifaces[i] = true
+	}
+	var owner string
+	if err := getNameOwner.call(conn, service).Store(&owner); err == nil {
+		// Initial objects are available using Get(), so don't notify.
+		w.setOwnerLocked(owner)
+	}
+	nameOwnerChanged.addMatch(conn, dbus.WithMatchOption("arg0", service))
+	w.conn.Signal(w.dbusCh)
+	go w.listen()
+	return w
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+func assertObjectsUpdated(t *testing.T, w *ObjectManagerWatcher, formatAndArgs ...interface{}) ObjectsChange {
+	select {
+	case c := <-w.Updates:
+		return c
+	case <-time.After(time.Second):
+		require.Fail(t, "ObjectManagerWatcher not updated", formatAndArgs...)
+	}
+	return ObjectsChange{}
+}
+
+func assertObjectsNotUpdated(t *testing.T, w *ObjectManagerWatcher, formatAndArgs ...interface{}) {
+	select {
+	case <-w.Updates:
+		require.Fail(t, "ObjectManagerWatcher unexpectedly updated", formatAndArgs...)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestWatchObjects(t *testing.T) {
+	bus := SetupTestBus()
+
+	srv := bus.RegisterService("org.i3barista.services.Manager")
+	om := srv.ObjectManager("/")
+	om.Add("/org/i3barista/hci0", "org.i3barista.Adapter", map[string]interface{}{
+		"Powered": true,
+	})
+	om.Add("/org/i3barista/hci0/dev_1", "org.i3barista.Device", map[string]interface{}{
+		"Name":      "Keyboard",
+		"Connected": false,
+	})
+
+	w := WatchObjects(Test, "org.i3barista.services.Manager", "/", "org.i3barista.Device")
+	defer w.Unsubscribe()
+
+	assertObjectsNotUpdated(t, w, "on start")
+	require.Equal(t, map[string]Interfaces{
+		"/org/i3barista/hci0/dev_1": {
+			"org.i3barista.Device": {"Name": "Keyboard", "Connected": false},
+		},
+	}, w.Get(), "Initial objects, filtered by interface")
+
+	om.Add("/org/i3barista/hci1", "org.i3barista.Adapter", nil)
+	assertObjectsNotUpdated(t, w, "On uninteresting interface added")
+
+	dev := om.Add("/org/i3barista/hci0/dev_2", "org.i3barista.Device", map[string]interface{}{
+		"Name": "Mouse",
+	})
+	u := assertObjectsUpdated(t, w, "On interface added")
+	require.Equal(t, ObjectsChange{Added: map[string]Interfaces{
+		"/org/i3barista/hci0/dev_2": {"org.i3barista.Device": {"Name": "Mouse"}},
+	}}, u)
+
+	dev.SetProperty("Battery", 50, SignalTypeChanged)
+	assertObjectsNotUpdated(t, w, "On property change")
+	p := WatchProperties(Test, "org.i3barista.services.Manager",
+		"/org/i3barista/hci0/dev_2", "org.i3barista.Device").Add("Battery")
+	defer p.Unsubscribe()
+	require.Equal(t, map[string]interface{}{"Battery": 50}, p.Get(),
+		"Properties of added object are available to properties watcher")
+
+	om.Remove("/org/i3barista/hci0/dev_1")
+	u = assertObjectsUpdated(t, w, "On object removed")
+	require.Equal(t, ObjectsChange{Removed: map[string][]string{
+		"/org/i3barista/hci0/dev_1": {"org.i3barista.Device"},
+	}}, u)
+	require.Equal(t, map[string]Interfaces{
+		"/org/i3barista/hci0/dev_2": {
+			"org.i3barista.Device": {"Name": "Mouse"},
+		},
+	}, w.Get(), "Objects after removal")
+
+	om.Remove("/org/i3barista/hci1", "org.i3barista.Adapter")
+	assertObjectsNotUpdated(t, w, "On uninteresting interface removed")
+
+	om.Remove("/org/i3barista/nonexistent")
+	assertObjectsNotUpdated(t, w, "On nonexistent object removed")
+
+	srv1 := bus.RegisterService()
+	om1 := srv1.ObjectManager("/")
+	om1.Add("/org/i3barista/hci0/dev_3", "org.i3barista.Device", map[string]interface{}{
+		"Name": "Headset",
+	})
+	srv1.AddName("org.i3barista.services.Manager")
+	u = assertObjectsUpdated(t, w, "On service move")
+	require.Equal(t, ObjectsChange{
+		Added: map[string]Interfaces{
+			"/org/i3barista/hci0/dev_3": {"org.i3barista.Device": {"Name": "Headset"}},
+		},
+		Removed: map[string][]string{
+			"/org/i3barista/hci0/dev_2": {"org.i3barista.Device"},
+		},
+	}, u)
+
+	om.Add("/org/i3barista/hci0/dev_4", "org.i3barista.Device", nil)
+	assertObjectsNotUpdated(t, w, "On signal from previous owner")
+
+	srv1.Unregister()
+	u = assertObjectsUpdated(t, w, "On service disconnect")
+	require.Equal(t, ObjectsChange{Removed: map[string][]string{
+		"/org/i3barista/hci0/dev_3": {"org.i3barista.Device"},
+	}}, u)
+	require.Empty(t, w.Get(), "No objects after disconnect")
+}
+
+func TestObjectsSignalAfterUnsubscribe(t *testing.T) {
+	bus := SetupTestBus()
+	srv := bus.RegisterService("org.i3barista.services.Manager")
+	om := srv.ObjectManager("/")
+	om.Add("/org/i3barista/hci0/dev_1", "org.i3barista.Device", nil)
+
+	w := WatchObjects(Test, "org.i3barista.services.Manager", "/", "org.i3barista.Device")
+	require.NotEmpty(t, w.Get())
+	w.Unsubscribe()
+
+	// Simulate signals that were already queued when unsubscribing. Nothing
+	// reads Updates any more, so these would block or panic if handled.
+	done := make(chan struct{})
+	go func() {
+		w.handleAdded(&Signal{Name: interfacesAdded.String(), Body: []interface{}{
+			dbus.ObjectPath("/org/i3barista/hci0/dev_2"),
+			map[string]map[string]dbus.Variant{
+				"org.i3barista.Device": {"Name": dbus.MakeVariant("Mouse")},
+			},
+		}})
+		w.handleRemoved(&Signal{Name: interfacesRemoved.String(), Body: []interface{}{
+			dbus.ObjectPath("/org/i3barista/hci0/dev_1"),
+			[]string{"org.i3barista.Device"},
+		}})
+		w.ownerChanged("")
+		w.ownerChanged(":1.99")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "Signal handlers blocked after Unsubscribe")
+	}
+	require.Empty(t, w.Get(), "No objects after Unsubscribe")
+}
+
+func TestTestObjectManager(t *testing.T) {
+	bus := SetupTestBus()
+	srv := bus.RegisterService("org.i3barista.services.Manager")
+	om := srv.ObjectManager("/org/i3barista")
+
+	conn := Test()
+	ch := make(chan *dbus.Signal, 10)
+	conn.Signal(ch)
+	interfacesAdded.addMatch(conn, dbus.WithMatchOption("path", "/org/i3barista"))
+	interfacesRemoved.addMatch(conn, dbus.WithMatchOption("path", "/org/i3barista"))
+
+	om.Add("/org/i3barista/a", "org.i3barista.Foo", map[string]interface{}{"x": 1})
+	s := assertSignalled(t, ch, "on interface added")
+	require.Equal(t, interfacesAdded.String(), s.Name)
+	require.Equal(t, []interface{}{
+		dbus.ObjectPath("/org/i3barista/a"),
+		map[string]map[string]dbus.Variant{
+			"org.i3barista.Foo": {"x": dbus.MakeVariant(1)},
+		},
+	}, s.Body)
+
+	om.Add("/org/i3barista/a", "org.i3barista.Bar", nil)
+	assertSignalled(t, ch, "on second interface added")
+
+	var managed map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	c := conn.Object("org.i3barista.services.Manager", "/org/i3barista").
+		Call(getManagedObjects.String(), 0)
+	require.NoError(t, c.Store(&managed))
+	require.Equal(t, map[dbus.ObjectPath]map[string]map[string]dbus.Variant{
+		"/org/i3barista/a": {
+			"org.i3barista.Foo": {"x": dbus.MakeVariant(1)},
+			"org.i3barista.Bar": {},
+		},
+	}, managed)
+
+	om.Remove("/org/i3barista/a")
+	s = assertSignalled(t, ch, "on object removed")
+	require.Equal(t, interfacesRemoved.String(), s.Name)
+	require.Equal(t, []interface{}{
+		dbus.ObjectPath("/org/i3barista/a"),
+		[]string{"org.i3barista.Bar", "org.i3barista.Foo"},
+	}, s.Body)
+
+	om.Remove("/org/i3barista/a")
+	assertNotSignalled(t, ch, "on removing already removed object")
+}
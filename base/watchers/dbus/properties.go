@@ -55,6 +55,7 @@ type PropertiesWatcher struct {
 	signals map[dbusName]func(*Signal, Fetcher) map[string]interface{}
 
 	lastProps map[string]interface{} // Extracted from dbus.Variant values.
+	closed    bool
 }
 
 // Get returns the latest snapshot of all registered properties.
@@ -132,6 +133,36 @@ func (p *PropertiesWatcher) Call(name string, args ...interface{}) ([]interface{
 	return c.Body, c.Err
 }
 
+// SetProperty sets the value of a property on the object being watched, using
+// org.freedesktop.DBus.Properties.Set. The value must have the type expected by
+// the object (e.g. bool for BlueZ "Powered"). Watched properties are updated
+// when the object emits PropertiesChanged in response, not immediately.
+// This method will deadlock if called from within a signal handler.
+func (p *PropertiesWatcher) SetProperty(name string, value interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.owner == "" {
+		return errors.New("Disconnected")
+	}
+	name = expand(p.iface, name)
+	nm := makeDbusName(name)
+	return p.obj.Call(setProperty.String(), 0,
+		nm.iface, nm.member, dbus.MakeVariant(value)).Err
+}
+
+// Forward calls notifyFn on each update until done is closed. This allows
+// updates from several watchers to share a single notifier.
+func (p *PropertiesWatcher) Forward(notifyFn func(), done <-chan struct{}) {
+	for {
+		select {
+		case <-p.Updates:
+			notifyFn()
+		case <-done:
+			return
+		}
+	}
+}
+
 // Unsubscribe clears all subscriptions and internal state. The watcher cannot
 // be used after calling this method. Usually `defer`d when creating a watcher.
 func (p *PropertiesWatcher) Unsubscribe() {
@@ -141,6 +172,7 @@ func (p *PropertiesWatcher) Unsubscribe() {
 	p.conn.Close()
 	p.lastProps = nil
 	p.owner = ""
+	p.closed = true
 }
 
 type propertyUpdateType int
@@ -191,6 +223,10 @@ func (p *PropertiesWatcher) listen() {
 func (p *PropertiesWatcher) handleSignal(sig *Signal) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	// Signals may still be queued when the watcher is unsubscribed.
+	if p.closed {
+		return
+	}
 	// This is fine, we should only get signals for which handlers have been
 	// added. This can only panic if the internal state is somehow inconsistent.
 	newProps := p.signals[makeDbusName(sig.Name)](sig, p.fetch)
@@ -222,6 +258,9 @@ func (p *PropertiesWatcher) matchOptions() []dbus.MatchOption {
 func (p *PropertiesWatcher) ownerChanged(owner string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
 	if p.owner != "" {
 		m := p.matchOptions()
 		for s := range p.signals {
@@ -15,6 +15,7 @@
 package dbus
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -238,3 +239,72 @@ func TestProperties(t *testing.T) {
 	obj.Emit("Signal", "foo")
 	assertNotUpdated(t, w, "after Unsubscribe")
 }
+
+func TestSetProperty(t *testing.T) {
+	bus := SetupTestBus()
+	srv := bus.RegisterService("org.i3barista.services.FooService")
+	obj := srv.Object("/org/i3barista/objects/Foo", "org.i3barista.Service")
+	obj.SetProperty("Powered", false, SignalTypeNone)
+
+	w := WatchProperties(Test,
+		"org.i3barista.services.FooService",
+		"/org/i3barista/objects/Foo",
+		"org.i3barista.Service").
+		Add("Powered")
+	defer w.Unsubscribe()
+
+	require.NoError(t, w.SetProperty("Powered", true))
+	u := assertUpdated(t, w, "On property set")
+	require.Equal(t, PropertiesChange{"Powered": {false, true}}, u)
+	require.Equal(t, map[string]interface{}{"Powered": true}, w.Get())
+
+	obj.On("org.freedesktop.DBus.Properties.Set",
+		func(args ...interface{}) ([]interface{}, error) {
+			return nil, errors.New("read-only property")
+		})
+	require.Error(t, w.SetProperty("Powered", false), "On error from object")
+	assertNotUpdated(t, w, "On error from object")
+
+	srv.Unregister()
+	assertUpdated(t, w, "On service disconnect")
+	require.Error(t, w.SetProperty("Powered", false), "While disconnected")
+}
+
+func TestForward(t *testing.T) {
+	bus := SetupTestBus()
+	srv := bus.RegisterService("org.i3barista.services.FooService")
+	obj := srv.Object("/org/i3barista/objects/Foo", "org.i3barista.Service")
+	obj.SetProperty("a", 1, SignalTypeNone)
+
+	w := WatchProperties(Test,
+		"org.i3barista.services.FooService",
+		"/org/i3barista/objects/Foo",
+		"org.i3barista.Service").
+		Add("a")
+	defer w.Unsubscribe()
+
+	updates := make(chan struct{}, 10)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		w.Forward(func() { updates <- struct{}{} }, done)
+		close(stopped)
+	}()
+
+	obj.SetProperty("a", 2, SignalTypeChanged)
+	select {
+	case <-updates:
+	case <-time.After(time.Second):
+		require.Fail(t, "Update not forwarded")
+	}
+
+	close(done)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		require.Fail(t, "Forward did not return when done")
+	}
+	obj.SetProperty("a", 3, SignalTypeChanged)
+	assertUpdated(t, w, "Updates no longer forwarded once done")
+	require.Empty(t, updates)
+}
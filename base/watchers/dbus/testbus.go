@@ -36,6 +36,7 @@ type TestBus struct {
 	nextID      int
 	services    map[string]*TestBusService
 	connections map[*testBusConnection]bool
+	recorders   map[*TestBusRecorder]bool
 }
 
 // newTestBus constructs a new test bus, priming it with the name owner methods.
@@ -43,6 +44,7 @@ func newTestBus() *TestBus {
 	t := &TestBus{
 		services:    map[string]*TestBusService{},
 		connections: map[*testBusConnection]bool{},
+		recorders:   map[*TestBusRecorder]bool{},
 	}
 	t.RegisterService(bus)
 	t.busObj = t.Object(bus, busPath)
@@ -95,6 +97,9 @@ func (t *TestBus) emit(name string, sender string, path dbus.ObjectPath, args ..
 	}
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	for r := range t.recorders {
+		r.recordSignal(signal)
+	}
 	for c := range t.connections {
 		c.mu.Lock()
 		if c.shouldSignal(name, sender, path, args) {
@@ -129,6 +134,9 @@ type testBusConnection struct {
 	busObj  *TestBusObject
 	signals map[chan<- *dbus.Signal]bool
 	matches map[string][]map[string]string
+	// monitor rules and channel, set by BecomeMonitor and Eavesdrop.
+	monitor   []map[string]string
+	eavesdrop chan<- *dbus.Message
 }
 
 // Close closes the connection, rendering it unusable.
@@ -142,6 +150,11 @@ func (t *testBusConnection) Close() error {
 	t.mu.Lock()
 	t.signals = nil
 	t.matches = nil
+	t.monitor = nil
+	if t.eavesdrop != nil {
+		close(t.eavesdrop)
+		t.eavesdrop = nil
+	}
 	t.mu.Unlock()
 	return nil
 }
@@ -176,6 +189,102 @@ func (t *testBusConnection) Signal(ch chan<- *dbus.Signal) {
 	t.signals[ch] = true
 }
 
+// Eavesdrop registers the given channel to be passed all messages received by
+// the connection. On the test bus, these are only method calls that match the
+// rules given to BecomeMonitor.
+func (t *testBusConnection) Eavesdrop(ch chan<- *dbus.Message) {
+	t.checkOpen()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.eavesdrop = ch
+}
+
+// becomeMonitor handles org.freedesktop.DBus.Monitoring.BecomeMonitor calls
+// on the bus object of the connection.
+func (t *testBusConnection) becomeMonitor(args ...interface{}) ([]interface{}, error) {
+	rules, ok := args[0].([]string)
+	if !ok {
+		return nil, errors.New("BecomeMonitor expects a list of match rules")
+	}
+	monitor := []map[string]string{}
+	for _, r := range rules {
+		monitor = append(monitor, parseMatchRule(r))
+	}
+	if len(monitor) == 0 {
+		monitor = append(monitor, map[string]string{})
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.monitor = monitor
+	return nil, nil
+}
+
+// shouldMonitor returns true if the given method call matches any of the
+// connection's monitor rules.
+func (t *testBusConnection) shouldMonitor(c *dbus.Call) bool {
+	nm := makeDbusName(c.Method)
+	for _, rule := range t.monitor {
+		matches := true
+		for k, v := range rule {
+			switch k {
+			case "type":
+				matches = v == "method_call"
+			case "interface":
+				matches = v == nm.iface
+			case "member":
+				matches = v == nm.member
+			case "destination":
+				matches = v == c.Destination
+			default:
+				matches = checkSignalCondition(k, v, "", c.Path, c.Args)
+			}
+			if !matches {
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// monitorCall sends a method call to all connections monitoring the bus.
+func (t *TestBus) monitorCall(c *dbus.Call) {
+	nm := makeDbusName(c.Method)
+	msg := &dbus.Message{
+		Type: dbus.TypeMethodCall,
+		Headers: map[dbus.HeaderField]dbus.Variant{
+			dbus.FieldDestination: dbus.MakeVariant(c.Destination),
+			dbus.FieldPath:        dbus.MakeVariant(c.Path),
+			dbus.FieldInterface:   dbus.MakeVariant(nm.iface),
+			dbus.FieldMember:      dbus.MakeVariant(nm.member),
+		},
+		Body: c.Args,
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for conn := range t.connections {
+		conn.mu.Lock()
+		if conn.eavesdrop != nil && conn.shouldMonitor(c) {
+			conn.eavesdrop <- msg
+		}
+		conn.mu.Unlock()
+	}
+}
+
+// parseMatchRule parses a match rule string (e.g. "type='signal',path='/'")
+// into a map of keys to values.
+func parseMatchRule(rule string) map[string]string {
+	m := map[string]string{}
+	for _, kv := range strings.Split(rule, ",") {
+		if idx := strings.IndexRune(kv, '='); idx > 0 {
+			m[strings.TrimSpace(kv[:idx])] = strings.Trim(kv[idx+1:], "'")
+		}
+	}
+	return m
+}
+
 // checkOpen panics if the connection has been closed.
 func (t *testBusConnection) checkOpen() {
 	if atomic.LoadInt64(&t.closed) == 1 {
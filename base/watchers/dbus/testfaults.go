@@ -0,0 +1,157 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"time"
+
+	"barista.run/logging"
+)
+
+// defaultAsyncLatency is the delay before asynchronous calls made using Go()
+// return their result, if no latency is set for the method. It is halfway
+// between the positive (10ms) and negative (1s) timeouts used in tests.
+const defaultAsyncLatency = 505 * time.Millisecond
+
+// methodFaults holds the simulated latency and errors for a method.
+type methodFaults struct {
+	latency    time.Duration
+	hasLatency bool
+
+	failNext int
+	nextErr  error
+
+	failEvery int
+	everyErr  error
+	calls     int
+}
+
+// SetLatency sets the simulated latency for calls to the given method, or all
+// methods without a more specific latency if method is empty. Synchronous calls
+// block for the latency before returning, and asynchronous calls deliver their
+// result after the latency instead of the default delay.
+func (t *TestBusObject) SetLatency(method string, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.faultsLocked(method)
+	f.latency = latency
+	f.hasLatency = true
+}
+
+// FailNext makes the next count calls to the given method (or any method if
+// method is empty) fail with err, without invoking the method handler.
+func (t *TestBusObject) FailNext(method string, count int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.faultsLocked(method)
+	f.failNext = count
+	f.nextErr = err
+}
+
+// FailEvery makes every nth call to the given method (or any method if method
+// is empty) fail with err, counting from the time FailEvery is called. Use n = 0
+// to stop failing calls.
+func (t *TestBusObject) FailEvery(method string, n int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f := t.faultsLocked(method)
+	f.failEvery = n
+	f.everyErr = err
+	f.calls = 0
+}
+
+// DropSignals drops the next count signals with the given name emitted from
+// the object, simulating signals lost, e.g. due to a full queue.
+func (t *TestBusObject) DropSignals(name string, count int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.drops[expand(t.dest, name)] = count
+}
+
+// ClearFaults removes all simulated latency, errors, and dropped signals.
+func (t *TestBusObject) ClearFaults() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.faults = map[string]*methodFaults{}
+	t.drops = map[string]int{}
+}
+
+// faultsLocked returns the (possibly new) faults for a method. The method name
+// is expanded using the object's destination, except for the empty wildcard.
+func (t *TestBusObject) faultsLocked(method string) *methodFaults {
+	if method != "" {
+		method = expand(t.dest, method)
+	}
+	f, ok := t.faults[method]
+	if !ok {
+		f = &methodFaults{}
+		t.faults[method] = f
+	}
+	return f
+}
+
+// latency returns the simulated latency for a fully qualified method name, and
+// whether any latency was set.
+func (t *TestBusObject) latency(method string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, m := range []string{method, ""} {
+		if f, ok := t.faults[m]; ok && f.hasLatency {
+			return f.latency, true
+		}
+	}
+	return 0, false
+}
+
+// injectedErrorLocked returns the simulated error for a call to the fully
+// qualified method, if any. Each call updates the counters for the method as
+// well as any wildcard faults.
+func (t *TestBusObject) injectedErrorLocked(method string) error {
+	var err error
+	for _, m := range []string{method, ""} {
+		f, ok := t.faults[m]
+		if !ok {
+			continue
+		}
+		if f.failNext > 0 {
+			f.failNext--
+			if err == nil {
+				err = f.nextErr
+			}
+		}
+		if f.failEvery > 0 {
+			f.calls++
+			if f.calls%f.failEvery == 0 && err == nil {
+				err = f.everyErr
+			}
+		}
+	}
+	if err != nil {
+		logging.Log("%s: injected error for %s: %v", t.path, method, err)
+	}
+	return err
+}
+
+// dropSignal returns true if the signal with the given name should be dropped.
+func (t *TestBusObject) dropSignal(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.drops[name] <= 0 {
+		return false
+	}
+	t.drops[name]--
+	logging.Log("%s: dropped signal %s", t.path, name)
+	return true
+}
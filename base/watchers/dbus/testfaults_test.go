@@ -0,0 +1,142 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatency(t *testing.T) {
+	b := SetupTestBus()
+	svc := b.RegisterService("org.i3barista.Misc.BarService")
+	o := svc.Object("/org/i3barista/Misc/Bar", "")
+	o.OnElse(func(method string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{method}, nil
+	})
+	connObj := Test().Object("org.i3barista.Misc.BarService", "/org/i3barista/Misc/Bar")
+
+	o.SetLatency("Slow", 50*time.Millisecond)
+	start := time.Now()
+	c := connObj.Call("Slow", noFlags)
+	require.NoError(t, c.Err)
+	require.InDelta(t, 50*time.Millisecond, time.Since(start), float64(40*time.Millisecond),
+		"synchronous call with latency")
+
+	start = time.Now()
+	connObj.Call("Fast", noFlags)
+	require.True(t, time.Since(start) < 10*time.Millisecond,
+		"synchronous call without latency")
+
+	o.SetLatency("Fast", 0)
+	ch := make(chan *dbus.Call, 10)
+	connObj.Go("Fast", noFlags, ch)
+	select {
+	case c = <-ch:
+		require.Equal(t, []interface{}{"org.i3barista.Misc.BarService.Fast"}, c.Body)
+	case <-time.After(100 * time.Millisecond):
+		require.Fail(t, "No value received on Go() channel", "with zero latency")
+	}
+
+	o.SetLatency("", 2*time.Second)
+	connObj.Go("Other", noFlags, ch)
+	select {
+	case <-ch:
+		require.Fail(t, "Unexpected value on Go() channel", "with wildcard latency")
+	case <-time.After(time.Second):
+	}
+
+	o.ClearFaults()
+	connObj.Go("Other", noFlags, ch)
+	select {
+	case <-ch:
+		require.Fail(t, "Unexpected value on Go() channel", "before default latency")
+	case <-time.After(10 * time.Millisecond):
+	}
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		require.Fail(t, "No value received on Go() channel", "after default latency")
+	}
+}
+
+func TestInjectedErrors(t *testing.T) {
+	b := SetupTestBus()
+	svc := b.RegisterService("org.i3barista.Misc.BarService")
+	o := svc.Object("/org/i3barista/Misc/Bar", "")
+	calls := 0
+	o.On("Method", func(args ...interface{}) ([]interface{}, error) {
+		calls++
+		return []interface{}{calls}, nil
+	})
+	connObj := Test().Object("org.i3barista.Misc.BarService", "/org/i3barista/Misc/Bar")
+
+	errTimeout := errors.New("timeout")
+	o.FailNext("Method", 2, errTimeout)
+	require.Equal(t, errTimeout, connObj.Call("Method", noFlags).Err)
+	require.Equal(t, errTimeout, connObj.Call("Method", noFlags).Err)
+	c := connObj.Call("Method", noFlags)
+	require.NoError(t, c.Err, "after FailNext exhausted")
+	require.Equal(t, []interface{}{1}, c.Body, "handler not called on failures")
+
+	errBusy := errors.New("busy")
+	o.FailEvery("", 3, errBusy)
+	errs := []error{}
+	for i := 0; i < 6; i++ {
+		errs = append(errs, connObj.Call("Method", noFlags).Err)
+	}
+	require.Equal(t, []error{nil, nil, errBusy, nil, nil, errBusy}, errs,
+		"every third call fails")
+
+	o.FailEvery("", 0, nil)
+	require.NoError(t, connObj.Call("Method", noFlags).Err, "after clearing FailEvery")
+
+	o.FailNext("From", 1, errTimeout)
+	_, err := connObj.GetProperty("org.i3barista.Misc.BarService.From")
+	require.Error(t, err, "properties unaffected by method faults")
+	require.Equal(t, errTimeout, connObj.Call("From", noFlags).Err)
+}
+
+func TestDroppedSignals(t *testing.T) {
+	b := SetupTestBus()
+	svc := b.RegisterService("org.i3barista.services.FooService")
+	obj := svc.Object("/org/i3barista/objects/Foo", "org.i3barista.Service")
+	obj.SetProperty("a", 1, SignalTypeNone)
+
+	w := WatchProperties(Test,
+		"org.i3barista.services.FooService",
+		"/org/i3barista/objects/Foo",
+		"org.i3barista.Service").
+		Add("a")
+	defer w.Unsubscribe()
+
+	obj.DropSignals(propsChanged.String(), 1)
+	obj.SetProperty("a", 2, SignalTypeChanged)
+	assertNotUpdated(t, w, "signal dropped")
+
+	obj.SetProperty("a", 3, SignalTypeChanged)
+	u := assertUpdated(t, w, "after dropped signals exhausted")
+	require.Equal(t, PropertiesChange{"a": {1, 3}}, u,
+		"old value from before dropped signal")
+
+	obj.DropSignals(propsChanged.String(), 5)
+	obj.ClearFaults()
+	obj.SetProperty("a", 4, SignalTypeChanged)
+	assertUpdated(t, w, "after ClearFaults")
+}
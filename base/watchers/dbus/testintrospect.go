@@ -0,0 +1,162 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+)
+
+// propertiesData is the introspection data for the
+// org.freedesktop.DBus.Properties interface.
+var propertiesData = introspect.Interface{
+	Name: props,
+	Methods: []introspect.Method{
+		{Name: "Get", Args: []introspect.Arg{
+			{Name: "interface_name", Type: "s", Direction: "in"},
+			{Name: "property_name", Type: "s", Direction: "in"},
+			{Name: "value", Type: "v", Direction: "out"},
+		}},
+		{Name: "GetAll", Args: []introspect.Arg{
+			{Name: "interface_name", Type: "s", Direction: "in"},
+			{Name: "props", Type: "a{sv}", Direction: "out"},
+		}},
+		{Name: "Set", Args: []introspect.Arg{
+			{Name: "interface_name", Type: "s", Direction: "in"},
+			{Name: "property_name", Type: "s", Direction: "in"},
+			{Name: "value", Type: "v", Direction: "in"},
+		}},
+	},
+	Signals: []introspect.Signal{
+		{Name: "PropertiesChanged", Args: []introspect.Arg{
+			{Name: "interface_name", Type: "s"},
+			{Name: "changed_properties", Type: "a{sv}"},
+			{Name: "invalidated_properties", Type: "as"},
+		}},
+	},
+}
+
+// Introspect returns the introspection data for the object, generated from
+// the properties and methods registered on it. Since methods on the test bus
+// are variadic, methods are listed without any arguments. Objects on the same
+// service that are nested under this object's path are listed as children.
+func (t *TestBusObject) Introspect() introspect.Node {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.introspectLocked()
+}
+
+// introspectFromCall handles org.freedesktop.DBus.Introspectable.Introspect
+// calls for objects that do not define a custom handler.
+// Called with t.mu held.
+func (t *TestBusObject) introspectFromCall(args ...interface{}) ([]interface{}, error) {
+	node := t.introspectLocked()
+	data, err := xml.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{introspect.IntrospectDeclarationString + string(data)}, nil
+}
+
+func (t *TestBusObject) introspectLocked() introspect.Node {
+	ifaces := map[string]*introspect.Interface{}
+	getIface := func(name string) *introspect.Interface {
+		i, ok := ifaces[name]
+		if !ok {
+			i = &introspect.Interface{Name: name}
+			ifaces[name] = i
+		}
+		return i
+	}
+	for name, val := range t.props {
+		n := makeDbusName(name)
+		i := getIface(n.iface)
+		i.Properties = append(i.Properties, introspect.Property{
+			Name:   n.member,
+			Type:   signatureOf(val),
+			Access: "readwrite",
+		})
+	}
+	for name := range t.calls {
+		n := makeDbusName(name)
+		if n.iface == props || n.iface == introspectable {
+			continue
+		}
+		i := getIface(n.iface)
+		i.Methods = append(i.Methods, introspect.Method{Name: n.member})
+	}
+	node := introspect.Node{
+		Name:       string(t.path),
+		Interfaces: []introspect.Interface{introspect.IntrospectData},
+	}
+	if len(t.props) > 0 {
+		node.Interfaces = append(node.Interfaces, propertiesData)
+	}
+	names := []string{}
+	for n := range ifaces {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		i := ifaces[n]
+		sort.Slice(i.Methods, func(a, b int) bool { return i.Methods[a].Name < i.Methods[b].Name })
+		sort.Slice(i.Properties, func(a, b int) bool { return i.Properties[a].Name < i.Properties[b].Name })
+		node.Interfaces = append(node.Interfaces, *i)
+	}
+	for _, c := range t.svc.children(t.path) {
+		node.Children = append(node.Children, introspect.Node{Name: c})
+	}
+	return node
+}
+
+// signatureOf returns the DBus signature of the value, or "v" (variant) if the
+// value cannot be represented on DBus.
+func signatureOf(val interface{}) (sig string) {
+	defer func() {
+		if recover() != nil {
+			sig = "v"
+		}
+	}()
+	if val == nil {
+		return "v"
+	}
+	return dbus.SignatureOf(val).String()
+}
+
+// children returns the names of the direct children of path, based on the
+// paths of all objects on the service.
+func (t *TestBusService) children(path dbus.ObjectPath) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	prefix := strings.TrimSuffix(string(path), "/") + "/"
+	seen := map[string]bool{}
+	for p := range t.objects {
+		rest := strings.TrimPrefix(string(p), prefix)
+		if rest == string(p) || rest == "" {
+			continue
+		}
+		seen[strings.SplitN(rest, "/", 2)[0]] = true
+	}
+	children := []string{}
+	for c := range seen {
+		children = append(children, c)
+	}
+	sort.Strings(children)
+	return children
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus"
+	"github.com/godbus/dbus/introspect"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntrospect(t *testing.T) {
+	b := SetupTestBus()
+	svc := b.RegisterService("org.i3barista.services.Foo")
+	obj := svc.Object("/org/i3barista/Foo", "org.i3barista.Foo")
+	obj.SetProperties(map[string]interface{}{
+		"Name":    "foo",
+		"Count":   int32(3),
+		"Enabled": true,
+		"Tags":    []string{"a", "b"},
+		"Unknown": struct{ ch chan int }{},
+	}, SignalTypeNone)
+	obj.On("Toggle", func(...interface{}) ([]interface{}, error) { return nil, nil })
+	obj.On("Activate", func(...interface{}) ([]interface{}, error) { return nil, nil })
+	obj.On("org.i3barista.Other.Reset", func(...interface{}) ([]interface{}, error) { return nil, nil })
+	svc.Object("/org/i3barista/Foo/child1", "")
+	svc.Object("/org/i3barista/Foo/child2/grandchild", "")
+	svc.Object("/org/i3barista/Food", "")
+
+	node, err := introspect.Call(Test().Object("org.i3barista.services.Foo", "/org/i3barista/Foo"))
+	require.NoError(t, err)
+	require.Equal(t, "/org/i3barista/Foo", node.Name)
+	children := []string{}
+	for _, c := range node.Children {
+		children = append(children, c.Name)
+	}
+	require.Equal(t, []string{"child1", "child2"}, children, "direct children only")
+
+	ifaces := map[string]introspect.Interface{}
+	for _, i := range node.Interfaces {
+		ifaces[i.Name] = i
+	}
+	require.Contains(t, ifaces, "org.freedesktop.DBus.Introspectable")
+	require.Contains(t, ifaces, "org.freedesktop.DBus.Properties")
+	require.Equal(t, []introspect.Method{{Name: "Reset"}},
+		ifaces["org.i3barista.Other"].Methods)
+
+	foo := ifaces["org.i3barista.Foo"]
+	require.Equal(t, []introspect.Method{{Name: "Activate"}, {Name: "Toggle"}},
+		foo.Methods, "Methods in sorted order")
+	require.Equal(t, []introspect.Property{
+		{Name: "Count", Type: "i", Access: "readwrite"},
+		{Name: "Enabled", Type: "b", Access: "readwrite"},
+		{Name: "Name", Type: "s", Access: "readwrite"},
+		{Name: "Tags", Type: "as", Access: "readwrite"},
+		{Name: "Unknown", Type: "v", Access: "readwrite"},
+	}, foo.Properties, "Properties with signatures")
+
+	obj.On("org.freedesktop.DBus.Introspectable.Introspect",
+		func(...interface{}) ([]interface{}, error) {
+			return []interface{}{`<node name="/custom"></node>`}, nil
+		})
+	node, err = introspect.Call(Test().Object("org.i3barista.services.Foo", "/org/i3barista/Foo"))
+	require.NoError(t, err)
+	require.Equal(t, "/custom", node.Name, "custom introspection handler")
+
+	empty := svc.Object("/org/i3barista/Food", "").Introspect()
+	require.Equal(t, introspect.Node{
+		Name:       "/org/i3barista/Food",
+		Interfaces: []introspect.Interface{introspect.IntrospectData},
+	}, empty, "object without properties or methods")
+
+	c := Test().Object("org.i3barista.services.Foo", "/org/i3barista/Foo").
+		Call("org.freedesktop.DBus.Introspectable.Introspect", 0)
+	require.NoError(t, c.Err)
+	require.IsType(t, "", c.Body[0])
+	require.Equal(t, dbus.ObjectPath("/org/i3barista/Foo"), c.Path)
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -35,6 +36,10 @@ type testBusObject struct {
 	calls map[string]func(...interface{}) ([]interface{}, error)
 	// elseCall: fallback when calls[method] is not defined.
 	eCall func(string, ...interface{}) ([]interface{}, error)
+	// faults: simulated latency and errors, keyed by method ("" for any).
+	faults map[string]*methodFaults
+	// drops: number of upcoming signals to drop, keyed by signal name.
+	drops map[string]int
 }
 
 // TestBusObject represents a connection to an object on the test bus.
@@ -46,6 +51,14 @@ type TestBusObject struct {
 
 // Call calls a method with and waits for its reply.
 func (t *TestBusObject) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	t.check()
+	latency, _ := t.latency(expand(t.dest, method))
+	time.Sleep(latency)
+	return t.call(method, args...)
+}
+
+// call calls a method and returns the result, without any simulated latency.
+func (t *TestBusObject) call(method string, args ...interface{}) *dbus.Call {
 	t.check()
 	method = expand(t.dest, method)
 	call := &dbus.Call{
@@ -56,20 +69,32 @@ func (t *TestBusObject) Call(method string, flags dbus.Flags, args ...interface{
 		Done:        make(chan *dbus.Call, 1),
 	}
 	call.Done <- call
+	call.Body, call.Err = t.handle(method, args...)
+	t.svc.bus.recordCall(call)
+	t.svc.bus.monitorCall(call)
+	return call
+}
+
+// handle invokes the handler for a fully qualified method name.
+func (t *TestBusObject) handle(method string, args ...interface{}) ([]interface{}, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	if err := t.injectedErrorLocked(method); err != nil {
+		return nil, err
+	}
 	h, ok := t.calls[method]
+	if !ok {
+		h, ok = t.builtinLocked(method)
+	}
 	if !ok && t.eCall != nil {
 		h = func(args ...interface{}) ([]interface{}, error) {
 			return t.eCall(method, args...)
 		}
 	}
 	if h == nil {
-		call.Err = errors.New("No such method: " + method)
-	} else {
-		call.Body, call.Err = h(args...)
+		return nil, errors.New("No such method: " + method)
 	}
-	return call
+	return h(args...)
 }
 
 // CallWithContext acts like Call but takes a context.
@@ -77,12 +102,17 @@ func (t *TestBusObject) CallWithContext(ctx context.Context, method string, flag
 	return t.Call(method, flags, args...)
 }
 
-// Go calls a method with the given arguments asynchronously.
+// Go calls a method with the given arguments asynchronously. The result is
+// delivered after the latency set for the method, or defaultAsyncLatency if
+// no latency was set.
 func (t *TestBusObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	latency, ok := t.latency(expand(t.dest, method))
+	if !ok {
+		latency = defaultAsyncLatency
+	}
 	go func() {
-		// Halfway between the positive (10ms) and negative (1s) timeouts.
-		time.Sleep(505 * time.Millisecond)
-		ch <- t.Call(method, flags, args...)
+		time.Sleep(latency)
+		ch <- t.call(method, args...)
 	}()
 	return nil
 }
@@ -216,6 +246,44 @@ func (t *TestBusObject) SetProperties(props map[string]interface{}, signalType S
 	go t.Emit(propsChanged.String(), t.dest, chg, inv)
 }
 
+// builtinLocked returns the default handler for standard DBus methods that
+// the test object implements, unless overridden using On(...).
+func (t *TestBusObject) builtinLocked(method string) (func(...interface{}) ([]interface{}, error), bool) {
+	switch method {
+	case setProperty.String():
+		return t.setPropertyFromCall, true
+	case introspectCall.String():
+		return t.introspectFromCall, true
+	case becomeMonitor.String():
+		if t.conn != nil && t.path == busPath {
+			return t.conn.becomeMonitor, true
+		}
+	}
+	return nil, false
+}
+
+// setPropertyFromCall handles org.freedesktop.DBus.Properties.Set calls for
+// objects that do not define a custom handler, by updating the property and
+// emitting a "PropertiesChanged" signal. Called with t.mu held.
+func (t *TestBusObject) setPropertyFromCall(args ...interface{}) ([]interface{}, error) {
+	if len(args) != 3 {
+		return nil, errors.New("Set expects 3 arguments, got " + strconv.Itoa(len(args)))
+	}
+	iface, _ := args[0].(string)
+	prop, _ := args[1].(string)
+	value := args[2]
+	if v, ok := value.(dbus.Variant); ok {
+		value = v.Value()
+	}
+	if iface == "" || prop == "" {
+		return nil, errors.New("Set expects an interface and property name")
+	}
+	t.props[expand(iface, prop)] = value
+	chg := map[string]dbus.Variant{expand(iface, prop): dbus.MakeVariant(value)}
+	go t.Emit(propsChanged.String(), iface, chg, []string{})
+	return nil, nil
+}
+
 // On sets up a function to be called when the given named method is invoked,
 // and returns the result of the function to the method caller.
 func (t *TestBusObject) On(method string, do func(...interface{}) ([]interface{}, error)) {
@@ -236,6 +304,9 @@ func (t *TestBusObject) OnElse(do func(string, ...interface{}) ([]interface{}, e
 // Emit emits a signal on the test bus, dispatching it to relevant listeners.
 func (t *TestBusObject) Emit(name string, args ...interface{}) {
 	name = expand(t.dest, name)
+	if t.dropSignal(name) {
+		return
+	}
 	t.svc.bus.emit(name, t.svc.id, t.path, args...)
 }
 
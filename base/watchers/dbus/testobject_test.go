@@ -126,3 +126,44 @@ func TestObjects(t *testing.T) {
 	require.NotPanics(t, func() { o0.Destination() },
 		"Object obtained from TestService, after connection closed")
 }
+
+func TestObjectSetPropertyCall(t *testing.T) {
+	b := SetupTestBus()
+	svc := b.RegisterService("org.i3barista.Misc.BarService")
+	o := svc.Object("/org/i3barista/Misc/Bar", "")
+
+	conn := Test()
+	ch := make(chan *dbus.Signal, 10)
+	conn.Signal(ch)
+	propsChanged.addMatch(conn, dbus.WithMatchOption("path", "/org/i3barista/Misc/Bar"))
+
+	connObj := conn.Object("org.i3barista.Misc.BarService", "/org/i3barista/Misc/Bar")
+	c := connObj.Call("org.freedesktop.DBus.Properties.Set", noFlags,
+		"org.i3barista.Misc.BarService", "color", dbus.MakeVariant("red"))
+	require.NoError(t, c.Err)
+
+	val, err := connObj.GetProperty("org.i3barista.Misc.BarService.color")
+	require.NoError(t, err)
+	require.Equal(t, dbus.MakeVariant("red"), val)
+
+	s := assertSignalled(t, ch, "on property set")
+	require.Equal(t, []interface{}{
+		"org.i3barista.Misc.BarService",
+		map[string]dbus.Variant{
+			"org.i3barista.Misc.BarService.color": dbus.MakeVariant("red"),
+		},
+		[]string{},
+	}, s.Body)
+
+	c = connObj.Call("org.freedesktop.DBus.Properties.Set", noFlags, "color")
+	require.Error(t, c.Err, "wrong number of arguments")
+
+	o.On("org.freedesktop.DBus.Properties.Set", func(args ...interface{}) ([]interface{}, error) {
+		return nil, errors.New("read-only")
+	})
+	c = connObj.Call("org.freedesktop.DBus.Properties.Set", noFlags,
+		"org.i3barista.Misc.BarService", "color", dbus.MakeVariant("blue"))
+	require.Error(t, c.Err, "custom handler")
+	val, _ = connObj.GetProperty("org.i3barista.Misc.BarService.color")
+	require.Equal(t, dbus.MakeVariant("red"), val, "unchanged by custom handler")
+}
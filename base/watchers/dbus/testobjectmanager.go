@@ -0,0 +1,125 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+// TestObjectManager simulates an org.freedesktop.DBus.ObjectManager on the
+// test bus. It responds to GetManagedObjects and emits the InterfacesAdded and
+// InterfacesRemoved signals as objects are added and removed.
+type TestObjectManager struct {
+	mu sync.Mutex
+
+	svc     *TestBusService
+	root    *TestBusObject
+	objects map[dbus.ObjectPath]map[string]bool
+}
+
+// ObjectManager returns a test object manager for the service, exported at the
+// given root path.
+func (t *TestBusService) ObjectManager(root dbus.ObjectPath) *TestObjectManager {
+	m := &TestObjectManager{
+		svc:     t,
+		root:    t.Object(root, objectManager),
+		objects: map[dbus.ObjectPath]map[string]bool{},
+	}
+	m.root.On("GetManagedObjects", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{m.managedObjects()}, nil
+	})
+	return m
+}
+
+// Add adds an interface with the given properties to the object at path,
+// emitting InterfacesAdded. It returns the object with the interface as its
+// destination, which can be used to update properties or handle methods.
+func (m *TestObjectManager) Add(path dbus.ObjectPath, iface string, props map[string]interface{}) *TestBusObject {
+	obj := m.svc.Object(path, iface)
+	obj.SetProperties(props, SignalTypeNone)
+	m.mu.Lock()
+	if m.objects[path] == nil {
+		m.objects[path] = map[string]bool{}
+	}
+	m.objects[path][iface] = true
+	m.mu.Unlock()
+	m.root.Emit(interfacesAdded.member, path,
+		map[string]map[string]dbus.Variant{iface: obj.propsFor(iface)})
+	return obj
+}
+
+// Remove removes the given interfaces from the object at path, emitting
+// InterfacesRemoved. If no interfaces are given, all interfaces are removed,
+// effectively removing the object from the tree.
+func (m *TestObjectManager) Remove(path dbus.ObjectPath, ifaces ...string) {
+	m.mu.Lock()
+	removed := []string{}
+	for iface := range m.objects[path] {
+		if len(ifaces) == 0 || contains(ifaces, iface) {
+			delete(m.objects[path], iface)
+			removed = append(removed, iface)
+		}
+	}
+	if len(m.objects[path]) == 0 {
+		delete(m.objects, path)
+	}
+	m.mu.Unlock()
+	if len(removed) == 0 {
+		return
+	}
+	sort.Strings(removed)
+	m.root.Emit(interfacesRemoved.member, path, removed)
+}
+
+// managedObjects returns the current objects, interfaces, and properties in the
+// form returned by GetManagedObjects.
+func (m *TestObjectManager) managedObjects() map[dbus.ObjectPath]map[string]map[string]dbus.Variant {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{}
+	for path, ifaces := range m.objects {
+		r[path] = map[string]map[string]dbus.Variant{}
+		for iface := range ifaces {
+			r[path][iface] = m.svc.Object(path, iface).propsFor(iface)
+		}
+	}
+	return r
+}
+
+// propsFor returns the properties of the object on the given interface.
+func (t *testBusObject) propsFor(iface string) map[string]dbus.Variant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := map[string]dbus.Variant{}
+	for k, v := range t.props {
+		if strings.HasPrefix(k, iface+".") {
+			r[strings.TrimPrefix(k, iface+".")] = dbus.MakeVariant(v)
+		}
+	}
+	return r
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, h := range haystack {
+		if h == needle {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/base/notifier"
+
+	"github.com/godbus/dbus"
+)
+
+// waitTimeout is how long WaitForCall and WaitForSignal wait before failing.
+var waitTimeout = time.Second
+
+// TestingT is the subset of testing.TB used by the recorder assertions. It is
+// satisfied by *testing.T, and matches require.TestingT.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	FailNow()
+}
+
+// RecordedCall is a method call made on an object on the test bus.
+type RecordedCall struct {
+	Time        time.Time
+	Destination string
+	Path        dbus.ObjectPath
+	Method      string
+	Args        []interface{}
+	Body        []interface{}
+	Err         error
+}
+
+// RecordedSignal is a signal emitted on the test bus.
+type RecordedSignal struct {
+	Time   time.Time
+	Sender string
+	Path   dbus.ObjectPath
+	Name   string
+	Body   []interface{}
+}
+
+// TestBusRecorder records all method calls and signals on the test bus, and
+// provides assertions against them.
+type TestBusRecorder struct {
+	bus *TestBus
+
+	mu      sync.Mutex
+	calls   []RecordedCall
+	signals []RecordedSignal
+	updated notifier.Source
+
+	// waited counts matches already returned by WaitFor*, keyed by name.
+	waitedCalls   map[string]int
+	waitedSignals map[string]int
+}
+
+// Record starts recording method calls and signals on the test bus. Multiple
+// recorders can be active at the same time. Call Stop to stop recording.
+func (t *TestBus) Record() *TestBusRecorder {
+	r := &TestBusRecorder{
+		bus:           t,
+		waitedCalls:   map[string]int{},
+		waitedSignals: map[string]int{},
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recorders[r] = true
+	return r
+}
+
+// recordCall records a completed method call with all active recorders.
+func (t *TestBus) recordCall(c *dbus.Call) {
+	rc := RecordedCall{
+		Time:        time.Now(),
+		Destination: c.Destination,
+		Path:        c.Path,
+		Method:      c.Method,
+		Args:        c.Args,
+		Body:        c.Body,
+		Err:         c.Err,
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for r := range t.recorders {
+		r.mu.Lock()
+		r.calls = append(r.calls, rc)
+		r.mu.Unlock()
+		r.updated.Notify()
+	}
+}
+
+func (r *TestBusRecorder) recordSignal(s *dbus.Signal) {
+	r.mu.Lock()
+	r.signals = append(r.signals, RecordedSignal{
+		Time:   time.Now(),
+		Sender: s.Sender,
+		Path:   s.Path,
+		Name:   s.Name,
+		Body:   s.Body,
+	})
+	r.mu.Unlock()
+	r.updated.Notify()
+}
+
+// Stop stops recording. Previously recorded calls and signals are retained.
+func (r *TestBusRecorder) Stop() {
+	r.bus.mu.Lock()
+	defer r.bus.mu.Unlock()
+	delete(r.bus.recorders, r)
+}
+
+// Reset clears all recorded calls and signals.
+func (r *TestBusRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+	r.signals = nil
+	r.waitedCalls = map[string]int{}
+	r.waitedSignals = map[string]int{}
+}
+
+// Calls returns all recorded method calls, in the order they were made.
+func (r *TestBusRecorder) Calls() []RecordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedCall(nil), r.calls...)
+}
+
+// Signals returns all recorded signals, in the order they were emitted.
+func (r *TestBusRecorder) Signals() []RecordedSignal {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedSignal(nil), r.signals...)
+}
+
+// AssertCalled asserts that the named method was called. The method name can
+// be fully qualified, or just the member (e.g. "PlayPause"). If any args are
+// given, at least one call must have exactly those arguments.
+func (r *TestBusRecorder) AssertCalled(t TestingT, method string, args ...interface{}) {
+	for _, c := range r.Calls() {
+		if nameMatches(method, c.Method) && argsMatch(args, c.Args) {
+			return
+		}
+	}
+	t.Errorf("Expected call to %s%s, got calls: %s",
+		method, formatArgs(args), r.describeCalls())
+	t.FailNow()
+}
+
+// AssertNotCalled asserts that the named method was not called.
+func (r *TestBusRecorder) AssertNotCalled(t TestingT, method string) {
+	for _, c := range r.Calls() {
+		if nameMatches(method, c.Method) {
+			t.Errorf("Unexpected call to %s%s", c.Method, formatArgs(c.Args))
+			t.FailNow()
+			return
+		}
+	}
+}
+
+// AssertSignalled asserts that the named signal was emitted. If any body values
+// are given, at least one signal must have exactly that body.
+func (r *TestBusRecorder) AssertSignalled(t TestingT, name string, body ...interface{}) {
+	for _, s := range r.Signals() {
+		if nameMatches(name, s.Name) && argsMatch(body, s.Body) {
+			return
+		}
+	}
+	t.Errorf("Expected signal %s%s, got signals: %s",
+		name, formatArgs(body), r.describeSignals())
+	t.FailNow()
+}
+
+// WaitForCall waits for a call to the named method, and returns it. Each call
+// is returned at most once, so repeated waits return successive calls. Fails
+// the test if no such call is made within a second.
+func (r *TestBusRecorder) WaitForCall(t TestingT, method string) RecordedCall {
+	timeout := time.After(waitTimeout)
+	for {
+		next := r.updated.Next()
+		if c, ok := r.nextCall(method); ok {
+			return c
+		}
+		select {
+		case <-next:
+		case <-timeout:
+			t.Errorf("Timed out waiting for call to %s, got calls: %s",
+				method, r.describeCalls())
+			t.FailNow()
+			return RecordedCall{}
+		}
+	}
+}
+
+// WaitForSignal waits for the named signal to be emitted, and returns it. Each
+// signal is returned at most once, so repeated waits return successive signals.
+// Fails the test if no such signal is emitted within a second.
+func (r *TestBusRecorder) WaitForSignal(t TestingT, name string) RecordedSignal {
+	timeout := time.After(waitTimeout)
+	for {
+		next := r.updated.Next()
+		if s, ok := r.nextSignal(name); ok {
+			return s
+		}
+		select {
+		case <-next:
+		case <-timeout:
+			t.Errorf("Timed out waiting for signal %s, got signals: %s",
+				name, r.describeSignals())
+			t.FailNow()
+			return RecordedSignal{}
+		}
+	}
+}
+
+func (r *TestBusRecorder) nextCall(method string) (RecordedCall, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	skip := r.waitedCalls[method]
+	for _, c := range r.calls {
+		if !nameMatches(method, c.Method) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		r.waitedCalls[method]++
+		return c, true
+	}
+	return RecordedCall{}, false
+}
+
+func (r *TestBusRecorder) nextSignal(name string) (RecordedSignal, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	skip := r.waitedSignals[name]
+	for _, s := range r.signals {
+		if !nameMatches(name, s.Name) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		r.waitedSignals[name]++
+		return s, true
+	}
+	return RecordedSignal{}, false
+}
+
+func (r *TestBusRecorder) describeCalls() string {
+	out := []string{}
+	for _, c := range r.Calls() {
+		out = append(out, c.Method+formatArgs(c.Args))
+	}
+	return "[" + strings.Join(out, ", ") + "]"
+}
+
+func (r *TestBusRecorder) describeSignals() string {
+	out := []string{}
+	for _, s := range r.Signals() {
+		out = append(out, s.Name+formatArgs(s.Body))
+	}
+	return "[" + strings.Join(out, ", ") + "]"
+}
+
+// nameMatches returns true if the expected name is either the fully qualified
+// name, or the member part of it.
+func nameMatches(expected, actual string) bool {
+	return expected == actual || strings.HasSuffix(actual, "."+expected)
+}
+
+func argsMatch(expected, actual []interface{}) bool {
+	if len(expected) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+func formatArgs(args []interface{}) string {
+	out := []string{}
+	for _, a := range args {
+		out = append(out, fmt.Sprintf("%#v", a))
+	}
+	return "(" + strings.Join(out, ", ") + ")"
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeT records failures instead of failing the test.
+type fakeT struct {
+	errors []string
+	failed bool
+}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeT) FailNow() { f.failed = true }
+
+func TestRecorder(t *testing.T) {
+	b := SetupTestBus()
+	rec := b.Record()
+	defer rec.Stop()
+
+	svc := b.RegisterService("org.i3barista.services.Player")
+	obj := svc.Object("/org/i3barista/Player", "org.i3barista.Player")
+	obj.On("Seek", func(args ...interface{}) ([]interface{}, error) {
+		return []interface{}{"ok"}, nil
+	})
+
+	rec.AssertSignalled(t, "NameOwnerChanged")
+	rec.AssertSignalled(t, "org.freedesktop.DBus.NameOwnerChanged",
+		"org.i3barista.services.Player", "", ":1")
+
+	start := time.Now()
+	connObj := Test().Object("org.i3barista.services.Player", "/org/i3barista/Player")
+	connObj.Call("org.i3barista.Player.Seek", noFlags, int64(10))
+	connObj.Call("org.i3barista.Player.Play", noFlags)
+
+	rec.AssertCalled(t, "Seek")
+	rec.AssertCalled(t, "org.i3barista.Player.Seek", int64(10))
+	rec.AssertNotCalled(t, "Pause")
+
+	calls := rec.Calls()
+	require.Len(t, calls, 2)
+	require.Equal(t, "org.i3barista.Player.Seek", calls[0].Method)
+	require.Equal(t, dbus.ObjectPath("/org/i3barista/Player"), calls[0].Path)
+	require.Equal(t, []interface{}{"ok"}, calls[0].Body)
+	require.NoError(t, calls[0].Err)
+	require.Error(t, calls[1].Err, "undefined method")
+	require.False(t, calls[0].Time.Before(start), "timestamp")
+
+	fake := &fakeT{}
+	rec.AssertCalled(fake, "Seek", int64(20))
+	require.True(t, fake.failed, "args mismatch")
+	require.Contains(t, fake.errors[0], "org.i3barista.Player.Seek(10)")
+
+	fake = &fakeT{}
+	rec.AssertNotCalled(fake, "Play")
+	require.True(t, fake.failed, "unexpected call")
+
+	fake = &fakeT{}
+	rec.AssertSignalled(fake, "Seeked")
+	require.True(t, fake.failed, "missing signal")
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		connObj.Call("org.i3barista.Player.Seek", noFlags, int64(1))
+		obj.Emit("Seeked", int64(100))
+	}()
+	require.Equal(t, []interface{}{int64(10)}, rec.WaitForCall(t, "Seek").Args,
+		"first call returned on first wait")
+	require.Equal(t, []interface{}{int64(1)}, rec.WaitForCall(t, "Seek").Args,
+		"waits for subsequent calls")
+	require.Equal(t, []interface{}{int64(100)}, rec.WaitForSignal(t, "Seeked").Body)
+
+	waitTimeout = 10 * time.Millisecond
+	defer func() { waitTimeout = time.Second }()
+	fake = &fakeT{}
+	rec.WaitForCall(fake, "Seek")
+	require.True(t, fake.failed, "no more calls")
+	fake = &fakeT{}
+	rec.WaitForSignal(fake, "Seeked")
+	require.True(t, fake.failed, "no more signals")
+
+	obj.DropSignals("Seeked", 1)
+	obj.Emit("Seeked", int64(0))
+	fake = &fakeT{}
+	rec.WaitForSignal(fake, "Seeked")
+	require.True(t, fake.failed, "dropped signals are not recorded")
+
+	rec.Reset()
+	require.Empty(t, rec.Calls())
+	require.Empty(t, rec.Signals())
+
+	rec.Stop()
+	connObj.Call("org.i3barista.Player.Seek", noFlags, int64(2))
+	require.Empty(t, rec.Calls(), "after Stop")
+}
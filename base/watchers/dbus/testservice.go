@@ -137,8 +137,10 @@ func (t *TestBusService) Object(path dbus.ObjectPath, dest string) *TestBusObjec
 	if !ok {
 		o = &testBusObject{
 			svc: t, path: path,
-			props: map[string]interface{}{},
-			calls: map[string]func(...interface{}) ([]interface{}, error){},
+			props:  map[string]interface{}{},
+			calls:  map[string]func(...interface{}) ([]interface{}, error){},
+			faults: map[string]*methodFaults{},
+			drops:  map[string]int{},
 		}
 		t.objects[path] = o
 	}
@@ -60,6 +60,22 @@ func (w *Watcher) Unsubscribe() {
 	}
 }
 
+// Forward calls notifyFn on each update until the watcher fails or stop is
+// closed, and returns the watcher's error if it failed. This allows updates
+// from several watchers to share a single notifier.
+func (w *Watcher) Forward(notifyFn func(), stop <-chan struct{}) error {
+	for {
+		select {
+		case <-w.Updates:
+			notifyFn()
+		case err := <-w.Errors:
+			return err
+		case <-stop:
+			return nil
+		}
+	}
+}
+
 func (w *Watcher) watchLoop() {
 	restarted := false
 	for {
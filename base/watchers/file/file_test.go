@@ -183,3 +183,40 @@ func TestErrors(t *testing.T) {
 		require.Fail(t, "Expected an error", "on start")
 	}
 }
+
+func TestForward(t *testing.T) {
+	tempDir := testDir(t)
+	defer os.RemoveAll(tempDir)
+	tmpFile := path.Join(tempDir, "somefile")
+	ioutil.WriteFile(tmpFile, []byte(`foo`), 0644)
+
+	w := Watch(tmpFile)
+	defer w.Unsubscribe()
+	notifier.AssertNoUpdate(t, w.Updates, "On start")
+
+	updates := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	errs := make(chan error)
+	go func() { errs <- w.Forward(func() { updates <- struct{}{} }, stop) }()
+
+	ioutil.WriteFile(tmpFile, []byte(`bar`), 0644)
+	assertNotified(t, updates, "On write")
+
+	close(stop)
+	select {
+	case err := <-errs:
+		require.NoError(t, err, "when stopped")
+	case <-time.After(time.Second):
+		require.Fail(t, "Forward did not return", "when stopped")
+	}
+
+	w = Watch(path.Join(tmpFile, "/dir/under/file"))
+	defer w.Unsubscribe()
+	go func() { errs <- w.Forward(func() {}, nil) }()
+	select {
+	case err := <-errs:
+		require.Error(t, err, "returns watcher error")
+	case <-time.After(time.Second):
+		require.Fail(t, "Forward did not return", "on error")
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package focus provides a watcher for the focused window in i3 or sway,
+// using the i3 IPC protocol that both window managers implement.
+package focus // import "barista.run/base/watchers/focus"
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// The i3 IPC protocol, which sway also implements. Messages are the magic
+// string, followed by the payload length and message type in native byte
+// order, followed by a JSON payload.
+// See https://i3wm.org/docs/ipc.html.
+const (
+	ipcMagic = "i3-ipc"
+
+	msgSubscribe = 2
+	msgGetTree   = 4
+
+	eventWorkspace = 0x80000000
+	eventWindow    = 0x80000003
+)
+
+var native binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		native = binary.BigEndian
+	}
+}
+
+// Overridden in tests.
+var (
+	getenv       = os.Getenv
+	i3SocketPath = func() ([]byte, error) { return exec.Command("i3", "--get-socketpath").Output() }
+	xpropPID     = func(window int64) ([]byte, error) {
+		return exec.Command("xprop", "-id", strconv.FormatInt(window, 10), "_NET_WM_PID").Output()
+	}
+)
+
+// socketPath returns the IPC socket of the running window manager, preferring
+// sway if both are set.
+func socketPath() (string, error) {
+	for _, env := range []string{"SWAYSOCK", "I3SOCK"} {
+		if p := getenv(env); p != "" {
+			return p, nil
+		}
+	}
+	out, err := i3SocketPath()
+	if err != nil {
+		return "", errors.New("no i3 or sway IPC socket found")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+type ipcConn struct {
+	net.Conn
+}
+
+func dialIPC() (*ipcConn, error) {
+	path, err := socketPath()
+	if err != nil {
+		return nil, err
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &ipcConn{c}, nil
+}
+
+func (c *ipcConn) send(typ uint32, payload []byte) error {
+	msg := make([]byte, len(ipcMagic)+8, len(ipcMagic)+8+len(payload))
+	copy(msg, ipcMagic)
+	native.PutUint32(msg[len(ipcMagic):], uint32(len(payload)))
+	native.PutUint32(msg[len(ipcMagic)+4:], typ)
+	_, err := c.Write(append(msg, payload...))
+	return err
+}
+
+func (c *ipcConn) recv() (typ uint32, payload []byte, err error) {
+	header := make([]byte, len(ipcMagic)+8)
+	if _, err = io.ReadFull(c, header); err != nil {
+		return 0, nil, err
+	}
+	if string(header[:len(ipcMagic)]) != ipcMagic {
+		return 0, nil, errors.New("invalid IPC message")
+	}
+	payload = make([]byte, native.Uint32(header[len(ipcMagic):]))
+	typ = native.Uint32(header[len(ipcMagic)+4:])
+	_, err = io.ReadFull(c, payload)
+	return typ, payload, err
+}
+
+// request sends a message and waits for its reply. It must not be used on
+// a subscribed connection, where events can arrive before the reply.
+func (c *ipcConn) request(typ uint32, payload []byte, reply interface{}) error {
+	if err := c.send(typ, payload); err != nil {
+		return err
+	}
+	replyType, body, err := c.recv()
+	if err != nil {
+		return err
+	}
+	if replyType != typ {
+		return fmt.Errorf("unexpected IPC reply %d", replyType)
+	}
+	return json.Unmarshal(body, reply)
+}
+
+// node represents a container in the layout tree.
+type node struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Focused bool   `json:"focused"`
+	// Sway only, set for both Wayland and Xwayland windows.
+	PID   int    `json:"pid"`
+	AppID string `json:"app_id"`
+	// X11 windows only.
+	Window           int64 `json:"window"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+
+	Nodes         []node `json:"nodes"`
+	FloatingNodes []node `json:"floating_nodes"`
+}
+
+// focused returns the focused window in the tree, or nil if the focus is
+// not on a window, e.g. on an empty workspace.
+func (n *node) focused() *node {
+	if n.Focused {
+		if n.Type == "con" || n.Type == "floating_con" {
+			return n
+		}
+		return nil
+	}
+	for _, children := range [][]node{n.Nodes, n.FloatingNodes} {
+		for i := range children {
+			if f := children[i].focused(); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// Window describes the focused window.
+type Window struct {
+	// App is the app_id (Wayland) or window class (X11) of the window.
+	App string
+	// Title is the title of the window.
+	Title string
+	// PID is the process that owns the window, or 0 if it is not known.
+	PID int
+}
+
+func (n *node) window() (Window, error) {
+	w := Window{App: n.AppID, Title: n.Name, PID: n.PID}
+	if w.App == "" {
+		w.App = n.WindowProperties.Class
+	}
+	if w.PID != 0 || n.Window == 0 {
+		return w, nil
+	}
+	// i3 does not know the PID of windows, but most X11 clients set it.
+	out, err := xpropPID(n.Window)
+	if err != nil {
+		return w, err
+	}
+	idx := strings.LastIndex(string(out), "=")
+	if idx < 0 {
+		// Window does not set _NET_WM_PID.
+		return w, nil
+	}
+	w.PID, _ = strconv.Atoi(strings.TrimSpace(string(out[idx+1:])))
+	return w, nil
+}
+
+// focusedWindow fetches the layout tree and returns the focused window.
+func (c *ipcConn) focusedWindow() (Window, error) {
+	var root node
+	if err := c.request(msgGetTree, nil, &root); err != nil {
+		return Window{}, err
+	}
+	n := root.focused()
+	if n == nil {
+		return Window{}, nil
+	}
+	return n.window()
+}
+
+// Watch calls update with the focused window whenever it might have changed,
+// starting with the currently focused window. The window is empty if nothing
+// is focused, e.g. on an empty workspace. Watch blocks until stop is closed
+// or an error occurs, e.g. the window manager exits, and returns the error.
+func Watch(update func(Window), stop <-chan struct{}) error {
+	if inTestMode() {
+		return watchTest(update, stop)
+	}
+	events, err := dialIPC()
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+	cmds, err := dialIPC()
+	if err != nil {
+		return err
+	}
+	defer cmds.Close()
+	go func() {
+		<-stop
+		events.Close()
+	}()
+
+	var res struct {
+		Success bool `json:"success"`
+	}
+	err = events.request(msgSubscribe, []byte(`["window","workspace"]`), &res)
+	if err != nil {
+		return err
+	}
+	if !res.Success {
+		return errors.New("failed to subscribe to IPC events")
+	}
+	for {
+		w, err := cmds.focusedWindow()
+		if err != nil {
+			return err
+		}
+		update(w)
+		if err := waitForEvent(events); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForEvent waits for the next window or workspace event.
+func waitForEvent(events *ipcConn) error {
+	for {
+		typ, _, err := events.recv()
+		if err != nil {
+			return err
+		}
+		if typ == eventWindow || typ == eventWorkspace {
+			return nil
+		}
+	}
+}
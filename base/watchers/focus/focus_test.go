@@ -0,0 +1,309 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package focus
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWM is a minimal i3/sway IPC server.
+type fakeWM struct {
+	dir      string
+	listener net.Listener
+
+	mu          sync.Mutex
+	tree        string
+	subscribers []*ipcConn
+	subscribed  chan struct{}
+}
+
+func startFakeWM(t *testing.T, tree string) *fakeWM {
+	dir, err := ioutil.TempDir("", "focus")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "ipc.sock")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	w := &fakeWM{dir: dir, listener: listener, tree: tree, subscribed: make(chan struct{}, 10)}
+	getenv = func(env string) string {
+		if env == "SWAYSOCK" {
+			return path
+		}
+		return ""
+	}
+	go w.serve()
+	return w
+}
+
+func (w *fakeWM) serve() {
+	for {
+		c, err := w.listener.Accept()
+		if err != nil {
+			return
+		}
+		go w.handle(&ipcConn{c})
+	}
+}
+
+func (w *fakeWM) handle(c *ipcConn) {
+	for {
+		typ, _, err := c.recv()
+		if err != nil {
+			return
+		}
+		switch typ {
+		case msgGetTree:
+			w.mu.Lock()
+			tree := w.tree
+			w.mu.Unlock()
+			c.send(msgGetTree, []byte(tree))
+		case msgSubscribe:
+			w.mu.Lock()
+			w.subscribers = append(w.subscribers, c)
+			w.mu.Unlock()
+			c.send(msgSubscribe, []byte(`{"success":true}`))
+			w.subscribed <- struct{}{}
+		default:
+			// Reply as if the message was a command, to simulate
+			// replies that do not match the request.
+			c.send(0, []byte(`[{"success":false}]`))
+		}
+	}
+}
+
+// focus updates the tree and sends an event to all subscribers.
+func (w *fakeWM) focus(tree string, event uint32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tree = tree
+	for _, c := range w.subscribers {
+		c.send(event, []byte(`{"change":"focus"}`))
+	}
+}
+
+func (w *fakeWM) close() {
+	w.listener.Close()
+	os.RemoveAll(w.dir)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, c := range w.subscribers {
+		c.Close()
+	}
+	w.subscribers = nil
+}
+
+// swayTree returns a layout tree with a focused Wayland window.
+func swayTree(appID string, pid int) string {
+	win := map[string]interface{}{
+		"type": "con", "name": appID + " window", "focused": true,
+		"pid": pid, "app_id": appID,
+	}
+	return layout(win)
+}
+
+func layout(windows ...map[string]interface{}) string {
+	tree := map[string]interface{}{
+		"type": "root", "name": "root",
+		"nodes": []interface{}{
+			map[string]interface{}{
+				"type": "output", "name": "eDP-1",
+				"nodes": []interface{}{
+					map[string]interface{}{
+						"type": "workspace", "name": "1",
+						"nodes": []interface{}{
+							map[string]interface{}{"type": "con", "name": "unfocused", "pid": 1},
+						},
+						"floating_nodes": windows,
+					},
+				},
+			},
+		},
+	}
+	out, _ := json.Marshal(tree)
+	return string(out)
+}
+
+func TestSocketPath(t *testing.T) {
+	env := map[string]string{}
+	getenv = func(e string) string { return env[e] }
+	i3SocketPath = func() ([]byte, error) { return nil, errors.New("not found") }
+
+	_, err := socketPath()
+	require.Error(t, err, "without a window manager")
+
+	i3SocketPath = func() ([]byte, error) { return []byte("/run/user/1000/i3/ipc\n"), nil }
+	p, _ := socketPath()
+	require.Equal(t, "/run/user/1000/i3/ipc", p)
+
+	env["I3SOCK"] = "/tmp/i3.sock"
+	p, _ = socketPath()
+	require.Equal(t, "/tmp/i3.sock", p)
+
+	env["SWAYSOCK"] = "/tmp/sway.sock"
+	p, _ = socketPath()
+	require.Equal(t, "/tmp/sway.sock", p, "prefers sway")
+
+	getenv = os.Getenv
+}
+
+func TestFocusedWindow(t *testing.T) {
+	var root node
+	require.NoError(t, json.Unmarshal([]byte(swayTree("firefox", 42)), &root))
+	w, err := root.focused().window()
+	require.NoError(t, err)
+	require.Equal(t, Window{App: "firefox", Title: "firefox window", PID: 42}, w)
+
+	require.NoError(t, json.Unmarshal([]byte(layout()), &root))
+	require.Nil(t, root.focused(), "no focused window")
+
+	xprops := map[int64]string{
+		0x1e00003: "_NET_WM_PID(CARDINAL) = 1234\n",
+		0x1e00004: "_NET_WM_PID:  not found.\n",
+	}
+	xpropPID = func(window int64) ([]byte, error) {
+		out, ok := xprops[window]
+		if !ok {
+			return nil, errors.New("BadWindow")
+		}
+		return []byte(out), nil
+	}
+	x11 := func(window int64) Window {
+		require.NoError(t, json.Unmarshal([]byte(layout(map[string]interface{}{
+			"type": "con", "name": "Terminal", "focused": true, "window": window,
+			"window_properties": map[string]string{"class": "XTerm"},
+		})), &root))
+		w, _ := root.focused().window()
+		return w
+	}
+	require.Equal(t, Window{App: "XTerm", Title: "Terminal", PID: 1234}, x11(0x1e00003))
+	require.Equal(t, Window{App: "XTerm", Title: "Terminal"}, x11(0x1e00004),
+		"window without _NET_WM_PID")
+
+	root.Nodes[0].Nodes[0].FloatingNodes[0].Window = 0x1e00005
+	_, err = root.focused().window()
+	require.Error(t, err, "xprop error")
+}
+
+func TestIPC(t *testing.T) {
+	wm := startFakeWM(t, swayTree("code", 100))
+	defer wm.close()
+	defer func() { getenv = os.Getenv }()
+
+	c, err := dialIPC()
+	require.NoError(t, err)
+	defer c.Close()
+	w, err := c.focusedWindow()
+	require.NoError(t, err)
+	require.Equal(t, 100, w.PID)
+
+	var res struct{ Success bool }
+	require.Error(t, c.request(msgSubscribe+10, nil, &res), "mismatched reply")
+
+	_, _, err = (&ipcConn{badConn(t)}).recv()
+	require.Error(t, err, "invalid magic")
+}
+
+// badConn returns a connection that receives a message with invalid magic.
+func badConn(t *testing.T) net.Conn {
+	a, b := net.Pipe()
+	go func() {
+		b.Write([]byte("x3-ipc\x00\x00\x00\x00\x00\x00\x00\x00"))
+		b.Close()
+	}()
+	return a
+}
+
+func TestWatch(t *testing.T) {
+	testMu.Lock()
+	testMode = false
+	testMu.Unlock()
+	wm := startFakeWM(t, swayTree("firefox", 100))
+	defer wm.close()
+	defer func() { getenv = os.Getenv }()
+
+	windows := make(chan Window, 10)
+	errs := make(chan error, 1)
+	stop := make(chan struct{})
+	go func() { errs <- Watch(func(w Window) { windows <- w }, stop) }()
+	<-wm.subscribed
+	require.Equal(t, Window{App: "firefox", Title: "firefox window", PID: 100}, <-windows)
+
+	wm.focus(swayTree("emacs", 200), eventWindow)
+	require.Equal(t, 200, (<-windows).PID, "on window event")
+
+	wm.focus(layout(), eventWorkspace)
+	require.Equal(t, Window{}, <-windows, "on empty workspace")
+
+	wm.focus(swayTree("code", 300), 0x80000001)
+	wm.focus(swayTree("code", 300), eventWindow)
+	require.Equal(t, 300, (<-windows).PID, "ignores other events")
+
+	wm.close()
+	require.Error(t, <-errs, "on window manager exit")
+
+	wm = startFakeWM(t, swayTree("firefox", 100))
+	defer wm.close()
+	stop = make(chan struct{})
+	go func() { errs <- Watch(func(w Window) { windows <- w }, stop) }()
+	<-wm.subscribed
+	<-windows
+	close(stop)
+	require.Error(t, <-errs, "connection closed when stopped")
+
+	getenv = func(string) string { return "" }
+	i3SocketPath = func() ([]byte, error) { return nil, os.ErrNotExist }
+	require.Error(t, Watch(func(Window) {}, nil), "without a window manager")
+}
+
+func TestTestMode(t *testing.T) {
+	TestMode()
+	windows := make(chan Window, 10)
+	errs := make(chan error, 1)
+	stop := make(chan struct{})
+	go func() { errs <- Watch(func(w Window) { windows <- w }, stop) }()
+	require.Equal(t, Window{}, <-windows, "initially empty")
+
+	Set(Window{App: "firefox", PID: 100})
+	require.Equal(t, Window{App: "firefox", PID: 100}, <-windows)
+
+	otherWindows := make(chan Window, 10)
+	go func() { errs <- Watch(func(w Window) { otherWindows <- w }, stop) }()
+	require.Equal(t, Window{App: "firefox", PID: 100}, <-otherWindows,
+		"starts with current window")
+
+	err := errors.New("exited")
+	Fail(err)
+	require.Equal(t, err, <-errs)
+	require.Equal(t, err, <-errs)
+
+	go func() { errs <- Watch(func(w Window) { windows <- w }, stop) }()
+	<-windows
+	close(stop)
+	require.NoError(t, <-errs, "stopped")
+
+	TestMode()
+	go func() { errs <- Watch(func(w Window) { windows <- w }, nil) }()
+	require.Equal(t, Window{}, <-windows, "cleared by TestMode")
+	Fail(err)
+	<-errs
+}
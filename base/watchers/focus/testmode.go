@@ -0,0 +1,82 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package focus
+
+import "sync"
+
+type testWatcher struct {
+	update func(Window)
+	errCh  chan error
+}
+
+var (
+	testMu       sync.Mutex
+	testMode     bool
+	testWindow   Window
+	testWatchers = map[*testWatcher]bool{}
+)
+
+// TestMode replaces the window manager with a fake focus that can be
+// controlled using Set and Fail. It clears any previously set window.
+func TestMode() {
+	testMu.Lock()
+	defer testMu.Unlock()
+	testMode = true
+	testWindow = Window{}
+}
+
+func inTestMode() bool {
+	testMu.Lock()
+	defer testMu.Unlock()
+	return testMode
+}
+
+// Set changes the focused window in test mode, and notifies all watchers.
+func Set(w Window) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	testWindow = w
+	for t := range testWatchers {
+		t.update(w)
+	}
+}
+
+// Fail stops all watchers in test mode with the given error, as if the
+// window manager had exited.
+func Fail(err error) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	for t := range testWatchers {
+		t.errCh <- err
+		delete(testWatchers, t)
+	}
+}
+
+func watchTest(update func(Window), stop <-chan struct{}) error {
+	t := &testWatcher{update, make(chan error, 1)}
+	testMu.Lock()
+	testWatchers[t] = true
+	update(testWindow)
+	testMu.Unlock()
+	select {
+	case err := <-t.errCh:
+		return err
+	case <-stop:
+		testMu.Lock()
+		delete(testWatchers, t)
+		testMu.Unlock()
+		return nil
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package location provides the machine's current geographical location,
+// using GeoClue2 over D-Bus where available, and falling back to IP-based
+// geolocation otherwise.
+package location // import "barista.run/base/watchers/location"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"barista.run/base/httpclient"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	l "barista.run/logging"
+	"barista.run/timing"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// Source represents the provider of a location.
+type Source int
+
+const (
+	// GeoClue indicates a location provided by the GeoClue2 service.
+	GeoClue Source = iota + 1
+	// IP indicates a location obtained via IP geolocation.
+	IP
+)
+
+// Location represents a geographical location.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	// Accuracy in metres, or 0 if unknown.
+	Accuracy float64
+	// Description is a human-readable description, e.g. the city name.
+	Description string
+	Source      Source
+}
+
+// ErrNotAvailable is returned by Get before any location has been obtained.
+var ErrNotAvailable = errors.New("Location not available")
+
+// DesktopID is the desktop file ID sent to GeoClue, which uses it to
+// authorise location access. It must be set before the first call to Get or
+// Next to have any effect.
+var DesktopID = "barista"
+
+// Overridden in tests.
+var (
+	busType       = dbus.System
+	ipLookupURL   = "https://ipapi.co/json/"
+	retryInterval = 30 * time.Minute
+)
+
+const (
+	geoclueService = "org.freedesktop.GeoClue2"
+	managerPath    = "/org/freedesktop/GeoClue2/Manager"
+	managerIface   = "org.freedesktop.GeoClue2.Manager"
+	clientIface    = "org.freedesktop.GeoClue2.Client"
+	locationIface  = "org.freedesktop.GeoClue2.Location"
+
+	// GClueAccuracyLevel for city-level accuracy, which is sufficient for
+	// weather and sunrise/sunset calculations.
+	accuracyCity = uint32(4)
+)
+
+var current value.ErrorValue // of Location
+var testMode uint32          // atomic bool
+var once sync.Once
+
+// Get returns the most recently obtained location, or an error if the location
+// is not (yet) known.
+func Get() (Location, error) {
+	start()
+	v, err := current.Get()
+	if err != nil {
+		return Location{}, err
+	}
+	if loc, ok := v.(Location); ok {
+		return loc, nil
+	}
+	return Location{}, ErrNotAvailable
+}
+
+// Next returns a channel that signals when the location changes.
+func Next() <-chan struct{} {
+	start()
+	return current.Next()
+}
+
+// SetForTest allows simulating a location change in tests. Once called, the
+// location will no longer be updated from GeoClue or IP geolocation.
+func SetForTest(loc Location) {
+	atomic.StoreUint32(&testMode, 1)
+	once.Do(func() {})
+	current.Set(loc)
+}
+
+func start() {
+	once.Do(func() { go watch() })
+}
+
+func inTestMode() bool {
+	return atomic.LoadUint32(&testMode) > 0
+}
+
+func watch() {
+	sch := timing.NewScheduler()
+	for !inTestMode() {
+		err := watchGeoClue()
+		if inTestMode() {
+			return
+		}
+		l.Log("GeoClue unavailable: %v, falling back to IP geolocation", err)
+		updateFromIP()
+		sch.After(retryInterval)
+		<-sch.C
+	}
+}
+
+func updateFromIP() {
+	loc, err := lookupIP()
+	if inTestMode() {
+		return
+	}
+	if err != nil {
+		current.Error(err)
+		return
+	}
+	current.Set(loc)
+}
+
+// watchGeoClue updates the current location from GeoClue until the service
+// becomes unavailable or an error occurs.
+func watchGeoClue() error {
+	mgr := dbus.WatchProperties(busType, geoclueService, managerPath, managerIface)
+	defer mgr.Unsubscribe()
+	r, err := mgr.Call("GetClient")
+	if err != nil {
+		return err
+	}
+	var clientPath godbus.ObjectPath
+	if len(r) > 0 {
+		clientPath, _ = r[0].(godbus.ObjectPath)
+	}
+	if !clientPath.IsValid() {
+		return fmt.Errorf("Invalid GeoClue client: %v", r)
+	}
+
+	client := dbus.WatchProperties(busType, geoclueService, string(clientPath), clientIface).
+		Add("Location", "Active").
+		AddSignalHandler("LocationUpdated", func(s *dbus.Signal, _ dbus.Fetcher) map[string]interface{} {
+			if len(s.Body) < 2 {
+				return nil
+			}
+			return map[string]interface{}{"Location": s.Body[1]}
+		})
+	defer client.Unsubscribe()
+
+	if err := client.SetProperty("DesktopId", DesktopID); err != nil {
+		return err
+	}
+	if err := client.SetProperty("RequestedAccuracyLevel", accuracyCity); err != nil {
+		return err
+	}
+	if _, err := client.Call("Start"); err != nil {
+		return err
+	}
+	defer client.Call("Stop")
+
+	if path, ok := client.Get()["Location"].(godbus.ObjectPath); ok {
+		updateFromGeoClue(path)
+	}
+	for u := range client.Updates {
+		if inTestMode() {
+			return errTestMode
+		}
+		if a, ok := u["Active"]; ok && a[1] == nil {
+			return errors.New("GeoClue disconnected")
+		}
+		loc, ok := u["Location"]
+		if !ok {
+			continue
+		}
+		if loc[1] == nil {
+			return errors.New("GeoClue disconnected")
+		}
+		if path, ok := loc[1].(godbus.ObjectPath); ok {
+			updateFromGeoClue(path)
+		}
+	}
+	return nil
+}
+
+var errTestMode = errors.New("TestMode")
+
+// updateFromGeoClue reads the location object at the given path, and
+// updates the current location. GeoClue uses "/" to indicate that no
+// location is available yet.
+func updateFromGeoClue(path godbus.ObjectPath) {
+	if path == "/" || !path.IsValid() || inTestMode() {
+		return
+	}
+	w := dbus.WatchProperties(busType, geoclueService, string(path), locationIface).
+		Fetch("Latitude", "Longitude", "Accuracy", "Description")
+	defer w.Unsubscribe()
+	props := w.Get()
+	lat, latOk := props["Latitude"].(float64)
+	lng, lngOk := props["Longitude"].(float64)
+	if !latOk || !lngOk {
+		l.Log("Incomplete GeoClue location at %s: %v", path, props)
+		return
+	}
+	loc := Location{Latitude: lat, Longitude: lng, Source: GeoClue}
+	loc.Accuracy, _ = props["Accuracy"].(float64)
+	loc.Description, _ = props["Description"].(string)
+	l.Fine("GeoClue location: %+v", loc)
+	current.Set(loc)
+}
+
+type ipLocation struct {
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	City      string   `json:"city"`
+	Country   string   `json:"country_name"`
+}
+
+// lookupIP obtains the approximate location of the machine's public IP.
+func lookupIP() (Location, error) {
+	response, err := httpclient.Get(ipLookupURL)
+	if err != nil {
+		return Location{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Location{}, fmt.Errorf("IP geolocation: HTTP %s", response.Status)
+	}
+	var r ipLocation
+	if err := json.NewDecoder(response.Body).Decode(&r); err != nil {
+		return Location{}, err
+	}
+	if r.Latitude == nil || r.Longitude == nil {
+		return Location{}, errors.New("IP geolocation: missing coordinates")
+	}
+	loc := Location{Latitude: *r.Latitude, Longitude: *r.Longitude, Source: IP}
+	switch {
+	case r.City != "" && r.Country != "":
+		loc.Description = r.City + ", " + r.Country
+	case r.City != "":
+		loc.Description = r.City
+	default:
+		loc.Description = r.Country
+	}
+	l.Fine("IP location: %+v", loc)
+	return loc, nil
+}
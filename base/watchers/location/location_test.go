@@ -0,0 +1,245 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package location
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/base/watchers/dbus"
+	"barista.run/testing/notifier"
+	"barista.run/timing"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+const clientPath = "/org/freedesktop/GeoClue2/Client/1"
+
+type geoclue struct {
+	svc    *dbus.TestBusService
+	client *dbus.TestBusObject
+	count  int
+}
+
+func setupGeoClue(bus *dbus.TestBus) *geoclue {
+	g := &geoclue{svc: bus.RegisterService(geoclueService)}
+	mgr := g.svc.Object(managerPath, managerIface)
+	mgr.On("GetClient", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{godbus.ObjectPath(clientPath)}, nil
+	})
+	g.client = g.svc.Object(clientPath, clientIface)
+	g.client.SetProperties(map[string]interface{}{
+		"Location":               godbus.ObjectPath("/"),
+		"Active":                 false,
+		"DesktopId":              "",
+		"RequestedAccuracyLevel": uint32(0),
+	}, dbus.SignalTypeNone)
+	for _, m := range []string{"Start", "Stop"} {
+		g.client.On(m, func(...interface{}) ([]interface{}, error) {
+			return nil, nil
+		})
+	}
+	return g
+}
+
+func (g *geoclue) addLocation(lat, lng, acc float64, desc string) godbus.ObjectPath {
+	g.count++
+	path := godbus.ObjectPath(fmt.Sprintf("%s/Location/%d", clientPath, g.count))
+	g.svc.Object(path, locationIface).SetProperties(map[string]interface{}{
+		"Latitude":    lat,
+		"Longitude":   lng,
+		"Accuracy":    acc,
+		"Description": desc,
+	}, dbus.SignalTypeNone)
+	return path
+}
+
+func resetForTest() {
+	atomic.StoreUint32(&testMode, 0)
+	current.Set(nil)
+}
+
+func TestGeoClue(t *testing.T) {
+	require := require.New(t)
+	resetForTest()
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	g := setupGeoClue(bus)
+	g.client.SetProperty("Location",
+		g.addLocation(52.52, 13.40, 1000, "Berlin"), dbus.SignalTypeNone)
+
+	rec := bus.Record()
+	defer rec.Stop()
+
+	errCh := make(chan error)
+	next := current.Next()
+	go func() { errCh <- watchGeoClue() }()
+	notifier.AssertClosed(t, next, "initial location")
+
+	v, _ := current.Get()
+	require.Equal(Location{
+		Latitude: 52.52, Longitude: 13.40, Accuracy: 1000,
+		Description: "Berlin", Source: GeoClue,
+	}, v)
+	rec.AssertCalled(t, "org.freedesktop.DBus.Properties.Set",
+		clientIface, "DesktopId", godbus.MakeVariant("barista"))
+	rec.AssertCalled(t, "org.freedesktop.DBus.Properties.Set",
+		clientIface, "RequestedAccuracyLevel", godbus.MakeVariant(uint32(4)))
+	rec.AssertCalled(t, clientIface+".Start")
+
+	next = current.Next()
+	g.client.SetProperty("Location",
+		g.addLocation(48.86, 2.35, 500, "Paris"), dbus.SignalTypeChanged)
+	notifier.AssertClosed(t, next, "on Location property change")
+	v, _ = current.Get()
+	require.Equal("Paris", v.(Location).Description)
+
+	next = current.Next()
+	paris := godbus.ObjectPath(fmt.Sprintf("%s/Location/%d", clientPath, g.count))
+	g.client.Emit("LocationUpdated", paris, g.addLocation(51.51, -0.13, 0, ""))
+	notifier.AssertClosed(t, next, "on LocationUpdated signal")
+	v, _ = current.Get()
+	require.Equal(Location{Latitude: 51.51, Longitude: -0.13, Source: GeoClue}, v)
+
+	g.svc.Unregister()
+	select {
+	case err := <-errCh:
+		require.Error(err, "on GeoClue disconnect")
+	case <-time.After(time.Second):
+		require.Fail("watcher did not exit on disconnect")
+	}
+	v, _ = current.Get()
+	require.Equal(Location{Latitude: 51.51, Longitude: -0.13, Source: GeoClue}, v,
+		"last location retained on disconnect")
+}
+
+func TestGeoClueErrors(t *testing.T) {
+	require := require.New(t)
+	resetForTest()
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+
+	require.Error(watchGeoClue(), "without GeoClue service")
+
+	g := setupGeoClue(bus)
+	g.client.On("Start", func(...interface{}) ([]interface{}, error) {
+		return nil, fmt.Errorf("org.freedesktop.DBus.Error.AccessDenied")
+	})
+	require.Error(watchGeoClue(), "when access is denied")
+
+	g.svc.Object(managerPath, managerIface).On("GetClient",
+		func(...interface{}) ([]interface{}, error) {
+			return []interface{}{"not-a-path"}, nil
+		})
+	require.Error(watchGeoClue(), "with invalid client path")
+
+	v, err := current.Get()
+	require.Nil(v, "no location without GeoClue")
+	require.NoError(err)
+}
+
+func ipServer(body string, code int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestIPLookup(t *testing.T) {
+	require := require.New(t)
+	for _, tc := range []struct {
+		desc     string
+		body     string
+		code     int
+		expected Location
+		err      bool
+	}{
+		{"full", `{"latitude": 40.71, "longitude": -74.01, "city": "New York",
+			"country_name": "United States"}`, 200,
+			Location{Latitude: 40.71, Longitude: -74.01,
+				Description: "New York, United States", Source: IP}, false},
+		{"no city", `{"latitude": 0, "longitude": 0, "country_name": "Null Island"}`,
+			200, Location{Description: "Null Island", Source: IP}, false},
+		{"missing coordinates", `{"city": "Nowhere"}`, 200, Location{}, true},
+		{"bad json", `{"latitude": `, 200, Location{}, true},
+		{"http error", `{"latitude": 1, "longitude": 1}`, 429, Location{}, true},
+	} {
+		srv := ipServer(tc.body, tc.code)
+		ipLookupURL = srv.URL
+		loc, err := lookupIP()
+		srv.Close()
+		if tc.err {
+			require.Error(err, tc.desc)
+		} else {
+			require.NoError(err, tc.desc)
+			require.Equal(tc.expected, loc, tc.desc)
+		}
+	}
+	ipLookupURL = "http://localhost:0/"
+	_, err := lookupIP()
+	require.Error(err, "on connection error")
+}
+
+func TestFallbackAndRetry(t *testing.T) {
+	require := require.New(t)
+	resetForTest()
+	timing.TestMode()
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	srv := ipServer(`{"latitude": 35.68, "longitude": 139.69, "city": "Tokyo"}`, 200)
+	defer srv.Close()
+	ipLookupURL = srv.URL
+
+	next := current.Next()
+	go watch()
+	notifier.AssertClosed(t, next, "IP fallback without GeoClue")
+	v, _ := current.Get()
+	require.Equal(Location{Latitude: 35.68, Longitude: 139.69,
+		Description: "Tokyo", Source: IP}, v)
+
+	g := setupGeoClue(bus)
+	g.client.SetProperty("Location",
+		g.addLocation(52.52, 13.40, 1000, "Berlin"), dbus.SignalTypeNone)
+	next = current.Next()
+	retried := false
+	for i := 0; i < 100 && !retried; i++ {
+		select {
+		case <-next:
+			retried = true
+		case <-time.After(10 * time.Millisecond):
+			timing.NextTick()
+		}
+	}
+	require.True(retried, "GeoClue retried after interval")
+	v, _ = current.Get()
+	require.Equal(GeoClue, v.(Location).Source)
+
+	SetForTest(Location{Latitude: 1, Longitude: 2})
+	loc, err := Get()
+	require.NoError(err)
+	require.Equal(Location{Latitude: 1, Longitude: 2}, loc)
+	next = Next()
+	g.client.SetProperty("Location",
+		g.addLocation(48.86, 2.35, 500, "Paris"), dbus.SignalTypeChanged)
+	notifier.AssertNoUpdate(t, next, "watcher update in test mode")
+	loc, _ = Get()
+	require.Equal(Location{Latitude: 1, Longitude: 2}, loc,
+		"test mode ignores GeoClue updates")
+}
@@ -0,0 +1,197 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metered tracks whether the current network connection is metered
+// (e.g. a mobile hotspot), allowing bandwidth-heavy modules to poll less often
+// and skip optional downloads.
+//
+// The connection is considered metered if NetworkManager reports it as metered
+// (including when NetworkManager guesses so), or if the link carrying the
+// default route matches one of the patterns given to Interfaces.
+package metered // import "barista.run/base/watchers/metered"
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/netlink"
+	l "barista.run/logging"
+)
+
+var (
+	current  value.Value // of bool
+	patterns value.Value // of []string
+	factor   int64       // atomic
+	once     sync.Once
+	testMode uint32 // atomic bool
+	// Incremented each time a watcher is started, so that any previous
+	// watcher stops (e.g. if tests reset the watcher).
+	generation uint32 // atomic
+)
+
+// Overridden in tests.
+var busType = dbus.System
+
+func init() {
+	current.Set(false)
+	patterns.Set([]string(nil))
+	factor = 4
+}
+
+// Values of NetworkManager's NMMetered enum that indicate a metered connection.
+const (
+	nmMeteredYes      uint32 = 1
+	nmMeteredGuessYes uint32 = 3
+)
+
+// Metered returns true if the current network connection is metered.
+func Metered() bool {
+	once.Do(start)
+	return current.Get().(bool)
+}
+
+// Next returns a channel that signals when the metered state changes.
+func Next() <-chan struct{} {
+	once.Do(start)
+	return current.Next()
+}
+
+// Interfaces treats the connection as metered whenever the default route is
+// over a link whose name matches any of the given glob patterns (e.g. "wwan*"
+// or "usb0"), regardless of what NetworkManager reports.
+func Interfaces(ifacePatterns ...string) {
+	patterns.Set(ifacePatterns)
+}
+
+// Slowdown sets the factor by which Interval stretches polling intervals while
+// the connection is metered. The default is 4.
+func Slowdown(f int) {
+	if f < 1 {
+		f = 1
+	}
+	atomic.StoreInt64(&factor, int64(f))
+}
+
+// Interval returns the polling interval to use given the normal interval,
+// which is stretched by the slowdown factor while the connection is metered.
+func Interval(normal time.Duration) time.Duration {
+	if !Metered() {
+		return normal
+	}
+	return normal * time.Duration(atomic.LoadInt64(&factor))
+}
+
+// SetForTest allows simulating metered connections in tests. Once called, the
+// real connection state is no longer tracked.
+func SetForTest(metered bool) {
+	once.Do(func() {}) // Prevent the real watcher from starting.
+	atomic.StoreUint32(&testMode, 1)
+	current.Set(metered)
+}
+
+type watcher struct {
+	gen uint32
+	nm  *dbus.PropertiesWatcher
+	sub *netlink.Subscription
+}
+
+func start() {
+	w := &watcher{
+		gen: atomic.AddUint32(&generation, 1),
+		nm:  watchNetworkManager(),
+	}
+	if netlink.Links() != nil {
+		w.sub = netlink.DefaultRoute()
+	}
+	nextPatterns := patterns.Next()
+	w.update()
+	go w.watch(nextPatterns)
+}
+
+// watchNetworkManager returns a watcher for NetworkManager's global metered
+// flag, or nil if the system bus is not available.
+func watchNetworkManager() (w *dbus.PropertiesWatcher) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.Log("Not tracking NetworkManager metered flag: %v", r)
+			w = nil
+		}
+	}()
+	return dbus.WatchProperties(busType,
+		"org.freedesktop.NetworkManager",
+		"/org/freedesktop/NetworkManager",
+		"org.freedesktop.NetworkManager",
+	).Add("Metered")
+}
+
+func (w *watcher) watch(nextPatterns <-chan struct{}) {
+	var nmCh <-chan dbus.PropertiesChange
+	if w.nm != nil {
+		defer w.nm.Unsubscribe()
+		nmCh = w.nm.Updates
+	}
+	var linkCh <-chan struct{}
+	if w.sub != nil {
+		defer w.sub.Unsubscribe()
+		linkCh = w.sub.C
+	}
+	for {
+		select {
+		case <-nmCh:
+		case <-linkCh:
+		case <-nextPatterns:
+			nextPatterns = patterns.Next()
+		}
+		if atomic.LoadUint32(&testMode) > 0 ||
+			atomic.LoadUint32(&generation) != w.gen {
+			return
+		}
+		w.update()
+	}
+}
+
+func (w *watcher) update() {
+	metered := w.isMetered()
+	if metered == current.Get().(bool) {
+		return
+	}
+	l.Fine("Metered connection: %v", metered)
+	current.Set(metered)
+}
+
+func (w *watcher) isMetered() bool {
+	if w.nm != nil {
+		switch w.nm.Get()["Metered"] {
+		case nmMeteredYes, nmMeteredGuessYes:
+			return true
+		}
+	}
+	if w.sub == nil {
+		return false
+	}
+	name := w.sub.Get().Name
+	if name == "" {
+		return false
+	}
+	for _, p := range patterns.Get().([]string) {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metered
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/netlink"
+
+	"github.com/stretchr/testify/require"
+)
+
+func assertChanged(t *testing.T, ch <-chan struct{}, metered bool, msg string) {
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		require.Fail(t, "Metered state did not change", msg)
+	}
+	require.Equal(t, metered, Metered(), msg)
+}
+
+func assertNotChanged(t *testing.T, ch <-chan struct{}, msg string) {
+	select {
+	case <-ch:
+		require.Fail(t, "Unexpected metered state change", msg)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+const (
+	nmService = "org.freedesktop.NetworkManager"
+	nmPath    = "/org/freedesktop/NetworkManager"
+)
+
+// resetForTest starts tracking the metered state again, using the netlink
+// test mode and a test bus.
+func resetForTest() (netlink.Tester, *dbus.TestBus) {
+	nlt := netlink.TestMode()
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	once = sync.Once{}
+	atomic.StoreUint32(&testMode, 0)
+	current.Set(false)
+	patterns.Set([]string(nil))
+	return nlt, bus
+}
+
+func TestMetered(t *testing.T) {
+	nlt, bus := resetForTest()
+
+	wwan := nlt.AddLink(netlink.Link{Name: "wwan0", State: netlink.Up})
+	nlt.AddDefaultRoute(wwan, 600)
+	require.False(t, Metered(), "not metered by default")
+
+	ch := Next()
+	Interfaces("usb*", "tether[0-9]")
+	assertNotChanged(t, ch, "default route link does not match")
+
+	Interfaces("usb*", "wwan*")
+	assertChanged(t, ch, true, "default route link matches")
+
+	ch = Next()
+	eth := nlt.AddLink(netlink.Link{Name: "eth0", State: netlink.Up})
+	nlt.AddDefaultRoute(eth, 100)
+	assertChanged(t, ch, false, "default route moved to unmetered link")
+
+	ch = Next()
+	svc := bus.RegisterService(nmService)
+	nm := svc.Object(nmPath, nmService)
+	nm.SetProperty("Metered", uint32(4), dbus.SignalTypeChanged)
+	assertNotChanged(t, ch, "NetworkManager guesses not metered")
+
+	nm.SetProperty("Metered", uint32(3), dbus.SignalTypeChanged)
+	assertChanged(t, ch, true, "NetworkManager guesses metered")
+
+	ch = Next()
+	nm.SetProperty("Metered", uint32(1), dbus.SignalTypeChanged)
+	assertNotChanged(t, ch, "NetworkManager reports metered")
+
+	nlt.RemoveDefaultRoute(eth, 100)
+	assertNotChanged(t, ch, "metered by both NetworkManager and link")
+
+	nm.SetProperty("Metered", uint32(2), dbus.SignalTypeChanged)
+	assertNotChanged(t, ch, "metered by link only")
+
+	Interfaces()
+	assertChanged(t, ch, false, "link patterns cleared")
+
+	ch = Next()
+	nm.SetProperty("Metered", uint32(1), dbus.SignalTypeChanged)
+	assertChanged(t, ch, true, "metered by NetworkManager")
+
+	ch = Next()
+	svc.Unregister()
+	assertChanged(t, ch, false, "NetworkManager stopped")
+}
+
+func TestSetForTest(t *testing.T) {
+	ch := Next()
+	SetForTest(true)
+	assertChanged(t, ch, true, "SetForTest(true)")
+
+	ch = Next()
+	SetForTest(false)
+	assertChanged(t, ch, false, "SetForTest(false)")
+}
+
+func TestInterval(t *testing.T) {
+	SetForTest(false)
+	require.Equal(t, time.Minute, Interval(time.Minute), "unmetered")
+
+	SetForTest(true)
+	require.Equal(t, 4*time.Minute, Interval(time.Minute), "default slowdown")
+
+	Slowdown(10)
+	require.Equal(t, 10*time.Minute, Interval(time.Minute), "custom slowdown")
+
+	Slowdown(0)
+	require.Equal(t, time.Minute, Interval(time.Minute), "slowdown clamped")
+
+	Slowdown(4)
+	SetForTest(false)
+}
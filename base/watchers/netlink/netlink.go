@@ -49,12 +49,79 @@ type Link struct {
 	State        OperState
 	HardwareAddr net.HardwareAddr
 	IPs          []net.IP
+	// Addrs contains the same addresses as IPs, in the same order,
+	// along with their prefix lengths and flags.
+	Addrs []Addr
+}
+
+// Addr represents an IP address assigned to a link.
+type Addr struct {
+	net.IPNet
+	// Temporary is true for IPv6 privacy extension addresses.
+	Temporary bool
+	// Deprecated is true if the preferred lifetime of the address has
+	// expired, so it should not be used for new connections.
+	Deprecated bool
+}
+
+// String returns the address in CIDR notation, e.g. "192.168.1.10/24".
+func (a Addr) String() string {
+	return a.IPNet.String()
+}
+
+// PrefixLen returns the length of the network prefix of the address.
+func (a Addr) PrefixLen() int {
+	ones, _ := a.Mask.Size()
+	return ones
+}
+
+// hostAddr returns an Addr for a single IP, with a full-length mask.
+func hostAddr(ip net.IP) Addr {
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		bits = 8 * net.IPv4len
+	}
+	return Addr{IPNet: net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}
+}
+
+// route represents a route that covers the default destination, either
+// directly (0.0.0.0/0) or as one of a pair of routes overriding it (e.g.
+// 0.0.0.0/1 and 128.0.0.0/1, as used by some VPNs).
+type route struct {
+	index  LinkIndex
+	family int
+	table  uint32
+	dst    string
+	dstLen int
+	metric uint32
+}
+
+// better returns true if packets to most destinations would be routed via r
+// rather than o. Routes in policy routing tables (e.g. from wg-quick) are
+// preferred to the main table, followed by more specific routes, and routes
+// with a lower metric.
+func (r route) better(o route) bool {
+	if rMain, oMain := r.table == mainTable, o.table == mainTable; rMain != oMain {
+		return oMain
+	}
+	if r.dstLen != o.dstLen {
+		return r.dstLen > o.dstLen
+	}
+	if r.metric != o.metric {
+		return r.metric < o.metric
+	}
+	if r.family != o.family {
+		return r.family < o.family
+	}
+	return r.index < o.index
 }
 
 var (
-	once    sync.Once
-	links   = map[LinkIndex]Link{}
-	linksMu sync.RWMutex
+	once        sync.Once
+	links       = map[LinkIndex]Link{}
+	routes      = map[route]bool{}
+	defaultLink string // name of the link with the best default route.
+	linksMu     sync.RWMutex
 )
 
 func addLink(index LinkIndex, link Link) {
@@ -82,14 +149,16 @@ func addLink(index LinkIndex, link Link) {
 		l.Fine("Updating link %s@%d", link.Name, index)
 		// addLink does not have address information
 		link.IPs = oldLink.IPs
+		link.Addrs = oldLink.Addrs
 	} else {
 		l.Fine("Adding link %s@%d", link.Name, index)
 	}
 	links[index] = link
+	updateDefaultLink()
 	notifyChanged(names...)
 }
 
-func addIP(index LinkIndex, addr net.IP) {
+func addIP(index LinkIndex, addr Addr) {
 	linksMu.Lock()
 	defer linksMu.Unlock()
 	link, ok := links[index]
@@ -97,15 +166,30 @@ func addIP(index LinkIndex, addr net.IP) {
 		l.Log("Skipping add IP for unknown link %d", index)
 		return
 	}
-	for _, oldAddr := range link.IPs {
-		if oldAddr.Equal(addr) {
+	// Copy the addresses, since earlier values of the link (which share
+	// the slice) may still be in use by subscribers.
+	addrs := append([]Addr(nil), link.Addrs...)
+	exists := false
+	for idx, oldAddr := range addrs {
+		if !oldAddr.IP.Equal(addr.IP) {
+			continue
+		}
+		if oldAddr.String() == addr.String() &&
+			oldAddr.Temporary == addr.Temporary &&
+			oldAddr.Deprecated == addr.Deprecated {
 			l.Fine("IP %s for %s@%d already present, skipping add",
-				addr, link.Name, index)
+				addr.IP, link.Name, index)
 			return
 		}
+		exists = true
+		addrs[idx] = addr
+	}
+	if exists {
+		l.Fine("Updating IP %s for %s@%d", addr.IP, link.Name, index)
+	} else {
+		l.Fine("Adding IP %s for %s@%d", addr.IP, link.Name, index)
+		addrs = append(addrs, addr)
 	}
-	l.Fine("Adding IP %s for %s@%d", addr, link.Name, index)
-	link.IPs = append(link.IPs, addr)
 	// Sort the IPs in a deterministic fashion, prioritising global unicast
 	// IPs over link-local, all the way down to loopback and unspecified.
 	// (see ipPriority for the complete ordering)
@@ -118,8 +202,8 @@ func addIP(index LinkIndex, addr net.IP) {
 	// - We cannot consistently order this list by when IPs were added
 	//   because the initial data returns the IPs in an unspecified order
 	//   (likely family, v4 before v6).
-	sort.Slice(link.IPs, func(ai, bi int) bool {
-		a, b := link.IPs[ai], link.IPs[bi]
+	sort.Slice(addrs, func(ai, bi int) bool {
+		a, b := addrs[ai].IP, addrs[bi].IP
 		priA, priB := ipPriority(a), ipPriority(b)
 		switch {
 		case priA < priB:
@@ -130,10 +214,23 @@ func addIP(index LinkIndex, addr net.IP) {
 			return a.String() < b.String()
 		}
 	})
+	link.Addrs = addrs
+	link.IPs = ipsOf(addrs)
 	links[index] = link
 	notifyChanged(link.Name)
 }
 
+func ipsOf(addrs []Addr) []net.IP {
+	if len(addrs) == 0 {
+		return nil
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips
+}
+
 func ipPriority(ip net.IP) int {
 	priorities := []func(net.IP) bool{
 		net.IP.IsGlobalUnicast,
@@ -161,6 +258,12 @@ func delLink(index LinkIndex) {
 	}
 	l.Fine("Deleting link %s@%d", link.Name, index)
 	delete(links, index)
+	for r := range routes {
+		if r.index == index {
+			delete(routes, r)
+		}
+	}
+	updateDefaultLink()
 	notifyChanged(link.Name)
 }
 
@@ -172,32 +275,87 @@ func delIP(index LinkIndex, addr net.IP) {
 		l.Log("Skipping delete IP for unknown link %d", index)
 		return
 	}
-	exists := false
-	for idx, oldAddr := range link.IPs {
-		if oldAddr.Equal(addr) {
-			exists = true
-			link.IPs = append(link.IPs[:idx], link.IPs[idx+1:]...)
-			break
+	var addrs []Addr
+	for _, oldAddr := range link.Addrs {
+		if !oldAddr.IP.Equal(addr) {
+			addrs = append(addrs, oldAddr)
 		}
 	}
-	if !exists {
+	if len(addrs) == len(link.Addrs) {
 		l.Fine("IP %s for %s@%d not present, skipping delete",
 			addr, link.Name, index)
 		return
 	}
 	l.Fine("Deleting IP %s for %s@%d", addr, link.Name, index)
+	link.Addrs = addrs
+	link.IPs = ipsOf(addrs)
 	links[index] = link
 	notifyChanged(link.Name)
 }
 
+func addRoute(r route) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	if routes[r] {
+		l.Fine("Route %+v already present, skipping add", r)
+		return
+	}
+	l.Fine("Adding route %+v", r)
+	routes[r] = true
+	if updateDefaultLink() {
+		notifySubs(sortedLinks())
+	}
+}
+
+func delRoute(r route) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	if !routes[r] {
+		l.Fine("Route %+v not present, skipping delete", r)
+		return
+	}
+	l.Fine("Deleting route %+v", r)
+	delete(routes, r)
+	if updateDefaultLink() {
+		notifySubs(sortedLinks())
+	}
+}
+
+// updateDefaultLink updates the name of the link carrying the default route,
+// and returns true if it changed. Must be called with linksMu held.
+func updateDefaultLink() bool {
+	var best route
+	found := false
+	for r := range routes {
+		if _, ok := links[r.index]; !ok {
+			continue
+		}
+		if !found || r.better(best) {
+			best, found = r, true
+		}
+	}
+	newDefault := ""
+	if found {
+		newDefault = links[best.index].Name
+	}
+	if newDefault == defaultLink {
+		return false
+	}
+	l.Fine("Default route moved from %q to %q", defaultLink, newDefault)
+	defaultLink = newDefault
+	return true
+}
+
 func nlInit() {
-	initialData, err := getInitialData()
+	initialData, initialRoutes, err := getInitialData()
 	if err != nil {
 		l.Log("Failed to populate initial data: %s", err)
 		return
 	}
 	linksMu.Lock()
 	links = initialData
+	routes = initialRoutes
+	updateDefaultLink()
 	sorted := sortedLinks()
 	linksMu.Unlock()
 	msub.Set(sorted)
@@ -213,15 +371,19 @@ var (
 // Subscription represents a potentially filtered subscription to netlink, which
 // returns the best link that matches the filter conditions specified.
 type Subscription struct {
-	C       <-chan struct{}
-	name    string
-	prefix  string
-	value   value.Value // of Link
-	doneSub func()
+	C            <-chan struct{}
+	name         string
+	prefix       string
+	defaultRoute bool
+	lastName     string
+	value        value.Value // of Link
+	doneSub      func()
 }
 
 func (s *Subscription) matches(name string) bool {
 	switch {
+	case s.defaultRoute:
+		return defaultLink != "" && name == defaultLink
 	case s.name != "":
 		return s.name == name
 	case s.prefix != "":
@@ -234,10 +396,12 @@ func (s *Subscription) matches(name string) bool {
 func (s *Subscription) notify(links []Link) {
 	for _, link := range links {
 		if s.matches(link.Name) {
+			s.lastName = link.Name
 			s.value.Set(link)
 			return
 		}
 	}
+	s.lastName = ""
 	s.value.Set(Link{State: Gone})
 }
 
@@ -262,9 +426,20 @@ func sortedLinks() []Link {
 
 func notifyChanged(names ...string) {
 	allLinks := sortedLinks()
+	notifySubs(allLinks, names...)
+	msub.Set(allLinks)
+}
+
+// notifySubs notifies subscriptions that match any of the given link names,
+// and subscriptions following the default route if it has moved.
+func notifySubs(allLinks []Link, names ...string) {
 	subsMu.RLock()
 	defer subsMu.RUnlock()
 	for _, s := range subs {
+		if s.defaultRoute && s.lastName != defaultLink {
+			s.notify(allLinks)
+			continue
+		}
 		for _, n := range names {
 			if s.matches(n) {
 				s.notify(allLinks)
@@ -272,18 +447,16 @@ func notifyChanged(names ...string) {
 			}
 		}
 	}
-	msub.Set(allLinks)
 }
 
 func subscribe(s *Subscription) *Subscription {
 	once.Do(nlInit)
-	linksMu.RLock()
-	sorted := sortedLinks()
-	linksMu.RUnlock()
 	subsMu.Lock()
 	subs = append(subs, s)
 	subsMu.Unlock()
-	s.notify(sorted)
+	linksMu.RLock()
+	s.notify(sortedLinks())
+	linksMu.RUnlock()
 	s.C, s.doneSub = s.value.Subscribe()
 	return s
 }
@@ -326,6 +499,16 @@ func Any() *Subscription {
 	return subscribe(new(Subscription))
 }
 
+// DefaultRoute creates a netlink watcher that returns the link carrying
+// the default route, following it as it moves between links (e.g. from
+// ethernet to wireless, or to a VPN when it connects). Policy routes and
+// more specific routes (such as the 0.0.0.0/1 + 128.0.0.0/1 pair used by
+// VPNs) take precedence, followed by the route metric. A 'virtual' link
+// with status Gone is returned if there is no default route.
+func DefaultRoute() *Subscription {
+	return subscribe(&Subscription{defaultRoute: true})
+}
+
 // Get returns the most recent Link that matches the subscription conditions.
 func (s *Subscription) Get() Link {
 	return s.value.Get().(Link)
@@ -358,6 +541,12 @@ func (s MultiSubscription) Next() <-chan struct{} {
 	return msub.Next()
 }
 
+// Links returns the current state of all links, without subscribing to any
+// updates. It returns nil if no link information is available.
+func Links() []Link {
+	return All().Get()
+}
+
 // Tester provides methods to simulate netlink messages
 // for testing.
 type Tester interface {
@@ -365,7 +554,10 @@ type Tester interface {
 	UpdateLink(LinkIndex, Link)
 	RemoveLink(LinkIndex)
 	AddIP(LinkIndex, net.IP)
+	AddAddr(LinkIndex, Addr)
 	RemoveIP(LinkIndex, net.IP)
+	AddDefaultRoute(LinkIndex, uint32)
+	RemoveDefaultRoute(LinkIndex, uint32)
 }
 
 type tester struct{ lastIdx LinkIndex }
@@ -395,6 +587,10 @@ func (t *tester) RemoveLink(index LinkIndex) {
 }
 
 func (t *tester) AddIP(index LinkIndex, addr net.IP) {
+	addIP(index, hostAddr(addr))
+}
+
+func (t *tester) AddAddr(index LinkIndex, addr Addr) {
 	addIP(index, addr)
 }
 
@@ -402,12 +598,22 @@ func (t *tester) RemoveIP(index LinkIndex, addr net.IP) {
 	delIP(index, addr)
 }
 
+func (t *tester) AddDefaultRoute(index LinkIndex, metric uint32) {
+	addRoute(route{index: index, family: afInet, table: mainTable, metric: metric})
+}
+
+func (t *tester) RemoveDefaultRoute(index LinkIndex, metric uint32) {
+	delRoute(route{index: index, family: afInet, table: mainTable, metric: metric})
+}
+
 // TestMode puts the netlink watcher in test mode, and resets the
 // link and subscriber states.
 func TestMode() Tester {
 	once.Do(func() {}) // Prevent real subscription.
 	linksMu.Lock()
 	links = map[LinkIndex]Link{}
+	routes = map[route]bool{}
+	defaultLink = ""
 	linksMu.Unlock()
 	subsMu.Lock()
 	subs = nil
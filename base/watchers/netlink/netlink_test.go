@@ -23,6 +23,7 @@ import (
 
 	"barista.run/testing/notifier"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 var errFoo = errors.New("foo")
@@ -53,6 +54,19 @@ func assertUpdated(t *testing.T, next <-chan struct{}, sub nexter, msgAndArgs ..
 	return sub.Next()
 }
 
+// withAddrs populates the addresses of a link from its IPs, as they would be
+// received from msgNewAddrs (i.e. with a zero-length prefix).
+func withAddrs(link Link) Link {
+	link.Addrs = nil
+	for _, ip := range link.IPs {
+		addr := hostAddr(ip)
+		_, bits := addr.Mask.Size()
+		addr.Mask = net.CIDRMask(0, bits)
+		link.Addrs = append(link.Addrs, addr)
+	}
+	return link
+}
+
 func TestErrors(t *testing.T) {
 	reset()
 	setInitialData(testNlRequest{err: errFoo}, testNlRequest{err: errFoo})
@@ -100,23 +114,23 @@ func TestInitialData(t *testing.T) {
 	notifier.AssertNoUpdate(t, next, "initial data populated on call to All()")
 
 	require.Equal(t, []Link{
-		{
+		withAddrs(Link{
 			Name:         "wlan0",
 			State:        Up,
 			HardwareAddr: hwA[2],
 			IPs:          []net.IP{net.IPv4(192, 168, 0, 1), net.IPv4(192, 168, 45, 1)},
-		},
+		}),
 		{
 			Name:         "eno1",
 			State:        Dormant,
 			HardwareAddr: hwA[3],
 		},
-		{
+		withAddrs(Link{
 			Name:         "lo1",
 			State:        Unknown,
 			HardwareAddr: hwA[1],
 			IPs:          []net.IP{net.IPv4(127, 0, 0, 1)},
-		},
+		}),
 	}, sub.Get())
 }
 
@@ -132,7 +146,7 @@ func TestUpdates(t *testing.T) {
 	msgCh <- msgNewLink(1, Link{Name: "eno1", State: Unknown, HardwareAddr: hwA[4]})
 
 	next = assertUpdated(t, next, sub, "Receives update of new link")
-	require.Equal(t, []Link{eno1}, sub.Get())
+	require.Equal(t, []Link{withAddrs(eno1)}, sub.Get())
 
 	errCh <- errFoo
 	notifier.AssertNoUpdate(t, next, "on error in Receive")
@@ -140,12 +154,12 @@ func TestUpdates(t *testing.T) {
 	msgCh <- msgNewAddrs(1, net.IPv4(192, 168, 0, 1), nil)
 	next = assertUpdated(t, next, sub, "receives update after error")
 	eno1.IPs = []net.IP{net.IPv4(192, 168, 0, 1)}
-	require.Equal(t, []Link{eno1}, sub.Get(), "IP is added and entire link is sent")
+	require.Equal(t, []Link{withAddrs(eno1)}, sub.Get(), "IP is added and entire link is sent")
 
 	msgCh <- msgNewLink(1, Link{Name: "eno1", State: Dormant, HardwareAddr: hwA[4]})
 	next = assertUpdated(t, next, sub)
 	eno1.State = Dormant
-	require.Equal(t, []Link{eno1}, sub.Get(), "IP is not lost on link update")
+	require.Equal(t, []Link{withAddrs(eno1)}, sub.Get(), "IP is not lost on link update")
 
 	msgCh <- msgNewLink(1, Link{Name: "eno1", State: Dormant, HardwareAddr: hwA[4]})
 	notifier.AssertNoUpdate(t, next, "when nothing of interest changes")
@@ -153,15 +167,16 @@ func TestUpdates(t *testing.T) {
 	msgCh <- msgNewLink(1, Link{Name: "eno1", State: Dormant, HardwareAddr: hwA[0]})
 	next = assertUpdated(t, next, sub, "on gaining a hardware address")
 	eno1.HardwareAddr = hwA[0]
-	require.Equal(t, []Link{eno1}, sub.Get(), "hardware address")
+	require.Equal(t, []Link{withAddrs(eno1)}, sub.Get(), "hardware address")
 
 	msgCh <- msgNewLink(1, Link{Name: "eth0", State: Dormant, HardwareAddr: hwA[0]})
 	eno1.Name = "eth0"
 	next = assertUpdated(t, next, sub, "on rename")
-	require.Equal(t, []Link{eno1}, sub.Get(), "link is renamed")
+	require.Equal(t, []Link{withAddrs(eno1)}, sub.Get(), "link is renamed")
 
 	sub2 := All()
-	require.Equal(t, []Link{eno1}, sub2.Get(), "update has current information")
+	require.Equal(t, []Link{withAddrs(eno1)}, sub2.Get(), "update has current information")
+	require.Equal(t, []Link{withAddrs(eno1)}, Links(), "without subscribing")
 
 	msgCh <- msgNewAddrs(1, net.IPv4(192, 168, 0, 1), nil)
 	notifier.AssertNoUpdate(t, next, "on adding same IP")
@@ -169,7 +184,7 @@ func TestUpdates(t *testing.T) {
 	msgCh <- msgNewAddrs(1, net.IPv4(10, 0, 0, 1), nil)
 	next = assertUpdated(t, next, sub, "on adding different IP")
 	eno1.IPs = []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(192, 168, 0, 1)}
-	require.Equal(t, []Link{eno1}, sub.Get(), "IP is added and entire link is sent")
+	require.Equal(t, []Link{withAddrs(eno1)}, sub.Get(), "IP is added and entire link is sent")
 
 	msgCh <- msgDelAddrs(1, net.IPv4(192, 168, 10, 1), nil)
 	notifier.AssertNoUpdate(t, next, "on removing a non-existent IP")
@@ -189,7 +204,7 @@ func TestUpdates(t *testing.T) {
 	msgCh <- msgDelAddrs(1, net.IPv4(192, 168, 1, 1), net.IPv4(192, 168, 0, 1))
 	next = assertUpdated(t, next, sub, "on removing an IP")
 	eno1.IPs = []net.IP{net.IPv4(10, 0, 0, 1), net.IPv6loopback, net.IPv4(0, 0, 0, 0)}
-	require.Equal(t, []Link{eno1}, sub.Get(), "All other link information is preserved")
+	require.Equal(t, []Link{withAddrs(eno1)}, sub.Get(), "All other link information is preserved")
 
 	msgCh <- msgDelLink(3, Link{Name: "wlan0"})
 	notifier.AssertNoUpdate(t, next, "on removing non-existent link")
@@ -199,6 +214,81 @@ func TestUpdates(t *testing.T) {
 	require.Empty(t, sub.Get(), "all links are gone")
 
 	require.Empty(t, All().Get(), "when no links are present")
+	require.Empty(t, Links(), "when no links are present")
+}
+
+func TestAddrs(t *testing.T) {
+	reset()
+	setInitialData(testNlRequest{
+		msgs: []syscall.NetlinkMessage{
+			msgNewLink(1, Link{Name: "eth0", State: Up, HardwareAddr: hwA[0]}),
+		},
+	}, testNlRequest{
+		msgs: []syscall.NetlinkMessage{
+			msgNewAddr(1, mustParseAddr("192.168.1.10/24"), 0),
+		},
+	})
+	msgCh, _ := returnTestSubscriber()
+
+	sub := ByName("eth0")
+	next := sub.Next()
+	addrs := sub.Get().Addrs
+	require.Len(t, addrs, 1)
+	require.Equal(t, 24, addrs[0].PrefixLen())
+	require.Equal(t, "192.168.1.10/24", addrs[0].String())
+
+	msgCh <- msgNewAddr(1, mustParseAddr("2001:db8::1/64"), 0)
+	next = assertUpdated(t, next, sub, "on new ipv6 address")
+	msgCh <- msgNewAddr(1, mustParseAddr("2001:db8::abcd/64"), unix.IFA_F_TEMPORARY)
+	next = assertUpdated(t, next, sub, "on new temporary address")
+
+	link := sub.Get()
+	require.Equal(t, []string{"192.168.1.10/24", "2001:db8::1/64", "2001:db8::abcd/64"},
+		addrStrings(link.Addrs), "sorted in the same order as IPs")
+	require.Equal(t, link.IPs, ipsOf(link.Addrs))
+	require.Equal(t, []bool{false, false, true},
+		[]bool{link.Addrs[0].Temporary, link.Addrs[1].Temporary, link.Addrs[2].Temporary})
+
+	msgCh <- msgNewAddr(1, mustParseAddr("2001:db8::abcd/64"), unix.IFA_F_TEMPORARY)
+	notifier.AssertNoUpdate(t, next, "when nothing changes")
+
+	msgCh <- msgNewAddr(1, mustParseAddr("2001:db8::abcd/64"),
+		unix.IFA_F_TEMPORARY|unix.IFA_F_DEPRECATED)
+	next = assertUpdated(t, next, sub, "on address flags change")
+	link = sub.Get()
+	require.Len(t, link.Addrs, 3, "address is updated in place")
+	require.True(t, link.Addrs[2].Deprecated)
+	require.False(t, link.Addrs[1].Deprecated)
+
+	msgCh <- msgNewAddr(1, mustParseAddr("192.168.1.10/16"), 0)
+	next = assertUpdated(t, next, sub, "on prefix length change")
+	require.Equal(t, 16, sub.Get().Addrs[0].PrefixLen())
+
+	msgCh <- msgDelAddrs(1, net.ParseIP("2001:db8::1"), nil)
+	assertUpdated(t, next, sub, "on address removal")
+	require.Equal(t, []string{"192.168.1.10/16", "2001:db8::abcd/64"},
+		addrStrings(sub.Get().Addrs))
+	require.Equal(t, "2001:db8::1/64", link.Addrs[1].String(),
+		"previous values are not modified")
+}
+
+func mustParseAddr(cidr string) Addr {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return Addr{IPNet: net.IPNet{IP: ip, Mask: ipNet.Mask}}
+}
+
+func addrStrings(addrs []Addr) []string {
+	var strs []string
+	for _, a := range addrs {
+		strs = append(strs, a.String())
+	}
+	return strs
 }
 
 func TestFiltering(t *testing.T) {
@@ -219,17 +309,17 @@ func TestFiltering(t *testing.T) {
 	})
 	msgCh, _ := returnTestSubscriber()
 
-	lo1 := Link{
+	lo1 := withAddrs(Link{
 		Name:         "lo1",
 		IPs:          []net.IP{net.IPv4(127, 0, 0, 1)},
 		HardwareAddr: hwA[4],
-	}
-	wlan0 := Link{
+	})
+	wlan0 := withAddrs(Link{
 		Name:         "wlan0",
 		State:        Up,
 		IPs:          []net.IP{net.IPv4(192, 168, 0, 1), net.IPv4(192, 168, 0, 2)},
 		HardwareAddr: hwA[5],
-	}
+	})
 	wwan0 := Link{Name: "wwan0", State: Down, HardwareAddr: hwA[7]}
 
 	subW := WithPrefix("w")
@@ -289,6 +379,81 @@ func TestFiltering(t *testing.T) {
 	require.Equal(t, wwan0, subAny.Get(), "Re-order on state change")
 }
 
+func TestDefaultRoute(t *testing.T) {
+	reset()
+	setInitialData(testNlRequest{
+		msgs: []syscall.NetlinkMessage{
+			msgNewLink(1, Link{Name: "lo", State: Unknown, HardwareAddr: hwA[0]}),
+			msgNewLink(2, Link{Name: "wlan0", State: Up, HardwareAddr: hwA[1]}),
+			msgNewLink(3, Link{Name: "eth0", State: Up, HardwareAddr: hwA[2]}),
+		},
+	}, testNlRequest{}, testNlRequest{
+		msgs: []syscall.NetlinkMessage{
+			msgNewRoute(2, unix.RT_TABLE_MAIN, nil, 600),
+			msgNewRoute(3, unix.RT_TABLE_MAIN, mustParseCIDR("10.0.0.0/8"), 100),
+			msgNewRoute(1, unix.RT_TABLE_LOCAL, nil, 0),
+		},
+	})
+	msgCh, _ := returnTestSubscriber()
+
+	sub := DefaultRoute()
+	require.Equal(t, "wlan0", sub.Get().Name, "initial default route")
+	subEth := ByName("eth0")
+	nextEth := subEth.Next()
+
+	next := sub.Next()
+	msgCh <- msgNewRoute(3, unix.RT_TABLE_MAIN, nil, 100)
+	next = assertUpdated(t, next, sub, "on new default route")
+	require.Equal(t, "eth0", sub.Get().Name, "lower metric preferred")
+
+	msgCh <- msgNewLink(2, Link{Name: "wlan0", State: Dormant, HardwareAddr: hwA[1]})
+	notifier.AssertNoUpdate(t, next, "on change to non-default link")
+
+	msgCh <- msgNewLink(3, Link{Name: "eth0", State: Dormant, HardwareAddr: hwA[2]})
+	next = assertUpdated(t, next, sub, "on change to default link")
+	require.Equal(t, Dormant, sub.Get().State)
+	nextEth = assertUpdated(t, nextEth, subEth)
+
+	msgCh <- msgNewLink(4, Link{Name: "wg0", State: Unknown, HardwareAddr: hwA[3]})
+	notifier.AssertNoUpdate(t, next, "on new link without routes")
+	msgCh <- msgNewRoute(4, unix.RT_TABLE_MAIN, mustParseCIDR("0.0.0.0/1"), 0)
+	msgCh <- msgNewRoute(4, unix.RT_TABLE_MAIN, mustParseCIDR("128.0.0.0/1"), 0)
+	next = assertUpdated(t, next, sub, "on vpn connection")
+	require.Equal(t, "wg0", sub.Get().Name, "more specific routes preferred")
+
+	msgCh <- msgDelRoute(4, unix.RT_TABLE_MAIN, mustParseCIDR("0.0.0.0/1"), 0)
+	notifier.AssertNoUpdate(t, next, "while one override route remains")
+	msgCh <- msgDelRoute(4, unix.RT_TABLE_MAIN, mustParseCIDR("128.0.0.0/1"), 0)
+	next = assertUpdated(t, next, sub, "on vpn disconnection")
+	require.Equal(t, "eth0", sub.Get().Name)
+
+	msgCh <- msgNewRoute(4, 51820, nil, 0)
+	next = assertUpdated(t, next, sub, "on policy route")
+	require.Equal(t, "wg0", sub.Get().Name, "policy routes preferred")
+
+	msgCh <- msgDelLink(4, Link{})
+	next = assertUpdated(t, next, sub, "on removing default link")
+	require.Equal(t, "eth0", sub.Get().Name, "routes via removed link are ignored")
+
+	msgCh <- msgDelRoute(3, unix.RT_TABLE_MAIN, nil, 100)
+	next = assertUpdated(t, next, sub)
+	require.Equal(t, "wlan0", sub.Get().Name)
+	notifier.AssertNoUpdate(t, nextEth, "no update to eth0 on route changes")
+
+	msgCh <- msgDelRoute(2, unix.RT_TABLE_MAIN, nil, 600)
+	assertUpdated(t, next, sub, "on removing last default route")
+	require.Equal(t, Gone, sub.Get().State)
+	require.Equal(t, Gone, DefaultRoute().Get().State)
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
 func TestTestMode(t *testing.T) {
 	nlt := TestMode()
 
@@ -330,6 +495,7 @@ func TestTestMode(t *testing.T) {
 	expected := Link{
 		Name:         "eth0",
 		IPs:          []net.IP{net.IPv4(10, 0, 0, 1), net.IPv6loopback},
+		Addrs:        []Addr{hostAddr(net.IPv4(10, 0, 0, 1)), hostAddr(net.IPv6loopback)},
 		HardwareAddr: hwA[8],
 	}
 	nextEth = assertUpdated(t, nextEth, subEth)
@@ -351,4 +517,14 @@ func TestTestMode(t *testing.T) {
 	expected.State = Dormant
 	expected.HardwareAddr = hwA[9]
 	require.Equal(t, expected, Any().Get(), "unset properties are retained")
+
+	subDefault := DefaultRoute()
+	nextDefault := subDefault.Next()
+	require.Equal(t, Gone, subDefault.Get().State, "no default route")
+	nlt.AddDefaultRoute(id, 100)
+	nextDefault = assertUpdated(t, nextDefault, subDefault)
+	require.Equal(t, "eth0", subDefault.Get().Name)
+	nlt.RemoveDefaultRoute(id, 100)
+	assertUpdated(t, nextDefault, subDefault)
+	require.Equal(t, Gone, subDefault.Get().State)
 }
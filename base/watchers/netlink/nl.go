@@ -27,6 +27,11 @@ import (
 
 var native = nl.NativeEndian()
 
+const (
+	mainTable = unix.RT_TABLE_MAIN
+	afInet    = unix.AF_INET
+)
+
 func linkFromMsg(msg []byte) (LinkIndex, Link) {
 	ifmsg := nl.DeserializeIfInfomsg(msg)
 	linkIndex := LinkIndex(ifmsg.Index)
@@ -47,21 +52,66 @@ func linkFromMsg(msg []byte) (LinkIndex, Link) {
 	return linkIndex, link
 }
 
-func addrFromMsg(msg []byte) (LinkIndex, net.IP) {
+func addrFromMsg(msg []byte) (LinkIndex, Addr) {
 	ifmsg := nl.DeserializeIfAddrmsg(msg)
 	linkIndex := LinkIndex(ifmsg.Index)
 	attrs, _ := nl.ParseRouteAttr(msg[ifmsg.Len():])
-	var addr net.IP
+	var local, addr net.IP
+	flags := uint32(ifmsg.Flags)
 	for _, attr := range attrs {
 		switch attr.Attr.Type {
 		case unix.IFA_LOCAL:
-			// Prefer IFA_LOCAL, but fall back to IFA_ADDRESS.
-			return linkIndex, net.IP(attr.Value)
+			local = net.IP(attr.Value)
 		case unix.IFA_ADDRESS:
 			addr = net.IP(attr.Value)
+		case unix.IFA_FLAGS:
+			// Supersedes the flags in the header, which only has 8 bits.
+			flags = native.Uint32(attr.Value[0:4])
+		}
+	}
+	// Prefer IFA_LOCAL, but fall back to IFA_ADDRESS.
+	if local != nil {
+		addr = local
+	}
+	bits := 8 * net.IPv6len
+	if ifmsg.Family == unix.AF_INET {
+		bits = 8 * net.IPv4len
+	}
+	return linkIndex, Addr{
+		IPNet:      net.IPNet{IP: addr, Mask: net.CIDRMask(int(ifmsg.Prefixlen), bits)},
+		Temporary:  flags&unix.IFA_F_TEMPORARY != 0,
+		Deprecated: flags&unix.IFA_F_DEPRECATED != 0,
+	}
+}
+
+// routeFromMsg parses a route message, returning false if the route
+// is not relevant for the default route.
+func routeFromMsg(msg []byte) (route, bool) {
+	rtmsg := nl.DeserializeRtMsg(msg)
+	if rtmsg.Dst_len > 1 || rtmsg.Type != unix.RTN_UNICAST {
+		return route{}, false
+	}
+	r := route{
+		family: int(rtmsg.Family),
+		table:  uint32(rtmsg.Table),
+		dstLen: int(rtmsg.Dst_len),
+	}
+	attrs, _ := nl.ParseRouteAttr(msg[rtmsg.Len():])
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.RTA_OIF:
+			r.index = LinkIndex(native.Uint32(attr.Value[0:4]))
+		case unix.RTA_PRIORITY:
+			r.metric = native.Uint32(attr.Value[0:4])
+		case unix.RTA_TABLE:
+			r.table = native.Uint32(attr.Value[0:4])
+		case unix.RTA_DST:
+			r.dst = net.IP(attr.Value).String()
 		}
 	}
-	return linkIndex, addr
+	// Routes in the local table are never default routes, and routes without
+	// an output interface (e.g. multipath) are not supported.
+	return r, r.index != 0 && r.table != unix.RT_TABLE_LOCAL
 }
 
 // for tests.
@@ -84,8 +134,9 @@ var nlSubscribe = func(protocol int, groups ...uint) (nlReceiver, error) {
 
 var nlMu sync.RWMutex
 
-func getInitialData() (map[LinkIndex]Link, error) {
+func getInitialData() (map[LinkIndex]Link, map[route]bool, error) {
 	links := map[LinkIndex]Link{}
+	routes := map[route]bool{}
 	nlMu.RLock()
 	defer nlMu.RUnlock()
 
@@ -93,7 +144,7 @@ func getInitialData() (map[LinkIndex]Link, error) {
 	req.AddData(nl.NewIfInfomsg(unix.AF_UNSPEC))
 	msgs, err := req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWLINK)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, msg := range msgs {
 		idx, link := linkFromMsg(msg)
@@ -105,7 +156,7 @@ func getInitialData() (map[LinkIndex]Link, error) {
 	req.AddData(nl.NewIfInfomsg(unix.AF_UNSPEC))
 	msgs, err = req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWADDR)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, msg := range msgs {
 		idx, addr := addrFromMsg(msg)
@@ -115,11 +166,27 @@ func getInitialData() (map[LinkIndex]Link, error) {
 			continue
 		}
 		l.Fine("Got address %s for %s@%d", addr, link.Name, idx)
-		link.IPs = append(link.IPs, addr)
+		link.IPs = append(link.IPs, addr.IP)
+		link.Addrs = append(link.Addrs, addr)
 		links[idx] = link
 	}
 
-	return links, nil
+	// Routes are only needed to follow the default route, so failures
+	// here are not fatal.
+	req = newNlRequest(unix.RTM_GETROUTE, unix.NLM_F_DUMP)
+	req.AddData(nl.NewIfInfomsg(unix.AF_UNSPEC))
+	msgs, err = req.Execute(unix.NETLINK_ROUTE, unix.RTM_NEWROUTE)
+	if err != nil {
+		l.Log("Failed to get routes: %s", err)
+	}
+	for _, msg := range msgs {
+		if r, ok := routeFromMsg(msg); ok {
+			l.Fine("Found default route %+v", r)
+			routes[r] = true
+		}
+	}
+
+	return links, routes, nil
 }
 
 func nlListen() {
@@ -129,6 +196,8 @@ func nlListen() {
 		unix.RTNLGRP_LINK,
 		unix.RTNLGRP_IPV4_IFADDR,
 		unix.RTNLGRP_IPV6_IFADDR,
+		unix.RTNLGRP_IPV4_ROUTE,
+		unix.RTNLGRP_IPV6_ROUTE,
 	)
 	nlMu.RUnlock()
 	if err != nil {
@@ -151,7 +220,16 @@ func nlListen() {
 			case unix.RTM_NEWADDR:
 				addIP(addrFromMsg(msg.Data))
 			case unix.RTM_DELADDR:
-				delIP(addrFromMsg(msg.Data))
+				idx, addr := addrFromMsg(msg.Data)
+				delIP(idx, addr.IP)
+			case unix.RTM_NEWROUTE:
+				if r, ok := routeFromMsg(msg.Data); ok {
+					addRoute(r)
+				}
+			case unix.RTM_DELROUTE:
+				if r, ok := routeFromMsg(msg.Data); ok {
+					delRoute(r)
+				}
 			}
 		}
 	}
@@ -69,7 +69,7 @@ func (t testNlRequest) Execute(int, uint16) ([][]byte, error) {
 	return data, t.err
 }
 
-func setInitialData(getLinks, getAddrs testNlRequest) {
+func setInitialData(getLinks, getAddrs testNlRequest, getRoutes ...testNlRequest) {
 	nlMu.Lock()
 	defer nlMu.Unlock()
 	newNlRequest = func(proto, flags int) nlRequest {
@@ -78,6 +78,11 @@ func setInitialData(getLinks, getAddrs testNlRequest) {
 			return getLinks
 		case unix.RTM_GETADDR:
 			return getAddrs
+		case unix.RTM_GETROUTE:
+			if len(getRoutes) > 0 {
+				return getRoutes[0]
+			}
+			return testNlRequest{}
 		default:
 			return testNlRequest{nil, errors.New("unexpected request")}
 		}
@@ -135,3 +140,43 @@ func msgDelAddrs(linkIdx int, addr, localAddr net.IP) syscall.NetlinkMessage {
 	m.Header.Type = unix.RTM_DELADDR
 	return m
 }
+
+func uint32Attr(attrType int, value uint32) *nl.RtAttr {
+	b := make([]byte, 4)
+	native.PutUint32(b, value)
+	return nl.NewRtAttr(attrType, b)
+}
+
+func msgNewRoute(linkIdx int, table uint32, dst *net.IPNet, metric uint32) syscall.NetlinkMessage {
+	data := nl.NewRtMsg()
+	data.Family = unix.AF_INET
+	attrs := []*nl.RtAttr{
+		uint32Attr(unix.RTA_OIF, uint32(linkIdx)),
+		uint32Attr(unix.RTA_PRIORITY, metric),
+		uint32Attr(unix.RTA_TABLE, table),
+	}
+	if dst != nil {
+		ones, _ := dst.Mask.Size()
+		data.Dst_len = uint8(ones)
+		attrs = append(attrs, nl.NewRtAttr(unix.RTA_DST, dst.IP.To4()))
+	}
+	return makeNetlinkMessage(unix.RTM_NEWROUTE, data, attrs...)
+}
+
+func msgDelRoute(linkIdx int, table uint32, dst *net.IPNet, metric uint32) syscall.NetlinkMessage {
+	m := msgNewRoute(linkIdx, table, dst, metric)
+	m.Header.Type = unix.RTM_DELROUTE
+	return m
+}
+
+func msgNewAddr(linkIdx int, addr Addr, flags uint32) syscall.NetlinkMessage {
+	data := nl.NewIfAddrmsg(nl.GetIPFamily(addr.IP))
+	data.Index = uint32(linkIdx)
+	data.Prefixlen = uint8(addr.PrefixLen())
+	return makeNetlinkMessage(
+		unix.RTM_NEWADDR,
+		data,
+		nl.NewRtAttr(unix.IFA_ADDRESS, addr.IP),
+		uint32Attr(unix.IFA_FLAGS, flags),
+	)
+}
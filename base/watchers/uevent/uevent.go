@@ -0,0 +1,166 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package uevent watches for kernel device events (uevents), which are sent
+// when devices are added, removed, or changed, e.g. when the brightness of a
+// backlight is changed using hardware keys.
+package uevent // import "barista.run/base/watchers/uevent"
+
+import (
+	"strings"
+	"sync"
+
+	l "barista.run/logging"
+
+	"golang.org/x/sys/unix"
+)
+
+// Event represents a single kernel device event.
+type Event struct {
+	// Action is the type of event, e.g. "add", "remove", or "change".
+	Action string
+	// DevPath is the path of the device in sysfs, relative to /sys.
+	DevPath string
+	// Subsystem is the kernel subsystem of the device, e.g. "backlight".
+	Subsystem string
+	// Env contains all properties of the event, including the ones above.
+	Env map[string]string
+}
+
+// Subscription represents a subscription to events from a subsystem.
+type Subscription struct {
+	C         <-chan Event
+	ch        chan Event
+	subsystem string
+}
+
+var (
+	subs   []*Subscription
+	subsMu sync.RWMutex
+	once   sync.Once
+)
+
+// Subscribe creates a subscription to events from the given subsystem, or to
+// all events if the subsystem is empty. Events are dropped if the subscriber
+// does not keep up. Subscriptions must be cleaned up by calling Unsubscribe.
+func Subscribe(subsystem string) *Subscription {
+	once.Do(func() { go listen() })
+	ch := make(chan Event, 10)
+	s := &Subscription{C: ch, ch: ch, subsystem: subsystem}
+	subsMu.Lock()
+	subs = append(subs, s)
+	subsMu.Unlock()
+	return s
+}
+
+// Unsubscribe stops further events and closes the channel.
+func (s *Subscription) Unsubscribe() {
+	subsMu.Lock()
+	defer subsMu.Unlock()
+	for i, sub := range subs {
+		if s == sub {
+			subs = append(subs[:i], subs[i+1:]...)
+			close(s.ch)
+			return
+		}
+	}
+}
+
+func notify(e Event) {
+	subsMu.RLock()
+	defer subsMu.RUnlock()
+	for _, s := range subs {
+		if s.subsystem != "" && s.subsystem != e.Subsystem {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
+
+// parse parses a uevent message, which consists of a "action@devpath" header
+// followed by NUL-separated KEY=value properties.
+func parse(msg []byte) (Event, bool) {
+	fields := strings.Split(strings.TrimRight(string(msg), "\x00"), "\x00")
+	if !strings.Contains(fields[0], "@") {
+		// Messages re-broadcast by udev have a binary header, but they
+		// are only sent to a different multicast group.
+		return Event{}, false
+	}
+	e := Event{Env: map[string]string{}}
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) == 2 {
+			e.Env[kv[0]] = kv[1]
+		}
+	}
+	e.Action = e.Env["ACTION"]
+	e.DevPath = e.Env["DEVPATH"]
+	e.Subsystem = e.Env["SUBSYSTEM"]
+	return e, e.Action != ""
+}
+
+// kernelGroup is the multicast group for events sent by the kernel.
+const kernelGroup = 1
+
+func listenKernel() {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC,
+		unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		l.Log("Failed to open uevent socket: %v", err)
+		return
+	}
+	defer unix.Close(fd)
+	err = unix.Bind(fd, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: kernelGroup,
+	})
+	if err != nil {
+		l.Log("Failed to bind uevent socket: %v", err)
+		return
+	}
+	buf := make([]byte, 16*1024)
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		switch err {
+		case nil:
+		case unix.EINTR, unix.ENOBUFS:
+			// Some events were lost, but the socket is still usable.
+			continue
+		default:
+			l.Log("Failed to receive uevents: %v", err)
+			return
+		}
+		if e, ok := parse(buf[:n]); ok {
+			l.Fine("uevent %s %s", e.Action, e.DevPath)
+			notify(e)
+		}
+	}
+}
+
+// Overridden in tests.
+var listen = listenKernel
+
+// TestMode stops listening for kernel events, so that tests can simulate
+// events using Emit. It must be called before any subscriptions are created.
+func TestMode() {
+	once.Do(func() {})
+}
+
+// Emit sends an event to all matching subscriptions, for use in tests.
+func Emit(e Event) {
+	notify(e)
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uevent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	e, ok := parse([]byte("change@/devices/pci0000:00/0000:00:02.0/drm/card0/" +
+		"card0-eDP-1/intel_backlight\x00ACTION=change\x00" +
+		"DEVPATH=/devices/pci0000:00/0000:00:02.0/drm/card0/card0-eDP-1/intel_backlight\x00" +
+		"SUBSYSTEM=backlight\x00SOURCE=sysfs\x00SEQNUM=4242\x00"))
+	require.True(t, ok)
+	require.Equal(t, "change", e.Action)
+	require.Equal(t, "backlight", e.Subsystem)
+	require.Equal(t,
+		"/devices/pci0000:00/0000:00:02.0/drm/card0/card0-eDP-1/intel_backlight",
+		e.DevPath)
+	require.Equal(t, "sysfs", e.Env["SOURCE"])
+	require.Equal(t, "4242", e.Env["SEQNUM"])
+
+	_, ok = parse([]byte("libudev\x00\xfe\xed\xca\xfe"))
+	require.False(t, ok, "udev messages")
+	_, ok = parse([]byte("add@/devices/foo\x00SEQNUM=1\x00"))
+	require.False(t, ok, "missing action")
+	_, ok = parse(nil)
+	require.False(t, ok, "empty message")
+}
+
+func TestSubscriptions(t *testing.T) {
+	TestMode()
+	backlight := Subscribe("backlight")
+	all := Subscribe("")
+
+	Emit(Event{Action: "change", Subsystem: "backlight"})
+	require.Equal(t, "backlight", (<-backlight.C).Subsystem)
+	require.Equal(t, "backlight", (<-all.C).Subsystem)
+
+	Emit(Event{Action: "add", Subsystem: "usb"})
+	require.Equal(t, "usb", (<-all.C).Subsystem)
+	select {
+	case e := <-backlight.C:
+		require.Fail(t, "unexpected event", "%+v", e)
+	default:
+	}
+
+	for i := 0; i < 20; i++ {
+		Emit(Event{Action: "change", Subsystem: "backlight"})
+	}
+	require.Len(t, backlight.C, 10, "drops events when full")
+	require.Len(t, all.C, 10, "drops events when full")
+	for i := 0; i < 10; i++ {
+		<-all.C
+	}
+
+	backlight.Unsubscribe()
+	all.Unsubscribe()
+	all.Unsubscribe()
+	Emit(Event{Action: "change", Subsystem: "backlight"})
+	_, ok := <-all.C
+	require.False(t, ok, "channel closed on unsubscribe")
+}
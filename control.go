@@ -0,0 +1,109 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"barista.run/bar"
+	l "barista.run/logging"
+)
+
+// ControlSocket listens for commands on a unix socket at the given path when
+// the bar is run. Each line written to the socket is a command, and the bar
+// responds with "ok" or "error: " followed by the reason. The only command is
+// 'reload', which reloads the bar using the modules returned by the function
+// set with OnReload, e.g.
+//
+//	echo reload | socat - UNIX-CONNECT:$XDG_RUNTIME_DIR/barista.sock
+//
+// Any existing file at the path is replaced. Must be called before Run.
+func ControlSocket(path string) {
+	construct()
+	instance.Lock()
+	defer instance.Unlock()
+	if instance.started {
+		panic("Cannot start control socket after .Run()")
+	}
+	instance.controlPath = path
+}
+
+// OnReload sets the function used to build the bar's new modules when a
+// 'reload' command is received on the control socket. See Reload.
+func OnReload(reload func() []bar.Module) {
+	construct()
+	instance.Lock()
+	defer instance.Unlock()
+	instance.reloadFn = reload
+}
+
+func (b *i3Bar) serveControl() error {
+	os.Remove(b.controlPath)
+	listener, err := net.Listen("unix", b.controlPath)
+	if err != nil {
+		return err
+	}
+	l.Log("Control socket listening on %s", b.controlPath)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				l.Log("Control socket stopped: %v", err)
+				return
+			}
+			go b.handleControl(conn)
+		}
+	}()
+	return nil
+}
+
+// handleControl runs each command received on a connection to the control
+// socket until the connection is closed.
+func (b *i3Bar) handleControl(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd := strings.TrimSpace(scanner.Text())
+		if cmd == "" {
+			continue
+		}
+		if err := b.runCommand(cmd); err != nil {
+			fmt.Fprintf(conn, "error: %v\n", err)
+		} else {
+			fmt.Fprintln(conn, "ok")
+		}
+	}
+}
+
+func (b *i3Bar) runCommand(cmd string) error {
+	switch cmd {
+	case "reload":
+		b.Lock()
+		reload := b.reloadFn
+		b.Unlock()
+		if reload == nil {
+			return errors.New("no reload function set")
+		}
+		b.reload(reload())
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/testing/mockio"
+	testModule "barista.run/testing/module"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestControlSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "barista")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "control.sock")
+	// A stale socket from a previous run is replaced.
+	require.NoError(t, ioutil.WriteFile(path, nil, 0600))
+
+	mockStdin := mockio.Stdin()
+	mockStdout := mockio.Stdout()
+	TestMode(mockStdin, mockStdout)
+	ControlSocket(path)
+
+	module1 := testModule.New(t)
+	module2 := testModule.New(t)
+	go Run(module1)
+	_, err = mockStdout.ReadUntil('[', time.Second)
+	require.Nil(t, err, "output array started without any errors")
+	module1.AssertStarted()
+	module1.OutputText("one")
+	require.Equal(t, []string{"one"}, readOutputTexts(t, mockStdout))
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+	responses := bufio.NewScanner(conn)
+	command := func(cmd string) string {
+		conn.SetDeadline(time.Now().Add(time.Second))
+		_, err := conn.Write([]byte(cmd + "\n"))
+		require.NoError(t, err)
+		require.True(t, responses.Scan(), "response to %s", cmd)
+		return responses.Text()
+	}
+
+	require.Equal(t, "error: no reload function set", command("reload"))
+	require.Equal(t, `error: unknown command "restart"`, command("restart"))
+
+	OnReload(func() []bar.Module { return []bar.Module{module2, module1} })
+	require.Equal(t, "ok", command("reload"))
+	require.Equal(t, []string{"one"}, readOutputTexts(t, mockStdout))
+	module2.AssertStarted("on reload")
+	module2.OutputText("two")
+	require.Equal(t, []string{"two", "one"}, readOutputTexts(t, mockStdout))
+}
@@ -38,12 +38,16 @@ type Module struct {
 	replayFn  func()
 	restartCh <-chan struct{}
 	restartFn func()
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+
+	placeholder bar.Output
 }
 
 // NewModule wraps an existing bar.Module with core barista functionality,
 // such as restarts and the ability to replay the last output.
 func NewModule(original bar.Module) *Module {
-	m := &Module{original: original}
+	m := &Module{original: original, stopCh: make(chan struct{})}
 	m.replayFn, m.replayCh = notifier.New()
 	m.restartFn, m.restartCh = notifier.New()
 	l.Attach(original, m, "~core")
@@ -52,19 +56,35 @@ func NewModule(original bar.Module) *Module {
 	return m
 }
 
+// SetPlaceholder sets an output to be shown until the wrapped module produces
+// its first output. Timed outputs are supported, e.g. for an animated spinner.
+// It must be called before Stream.
+func (m *Module) SetPlaceholder(placeholder bar.Output) {
+	m.placeholder = placeholder
+}
+
 // Stream runs the module with the given sink, automatically handling
-// terminations/restarts of the wrapped module.
+// terminations/restarts of the wrapped module. It returns only when the
+// module is stopped.
 func (m *Module) Stream(sink bar.Sink) {
-	for {
-		m.runLoop(sink)
+	for m.runLoop(sink) {
 	}
 }
 
+// Stop stops sending the wrapped module's output to the sink, and causes
+// Stream to return. Since modules cannot be interrupted, the wrapped module
+// is blocked the next time it produces output, and it must not be streamed
+// again.
+func (m *Module) Stop() {
+	m.stopOnce.Do(func() { close(m.stopCh) })
+}
+
 // runLoop is one iteration of the wrapped module. It starts the wrapped
 // module, and multiplexes events, replay notifications, and module output.
-// It returns when the underlying module is ready to be restarted (i.e. it
-// was stopped and an eligible click event was received).
-func (m *Module) runLoop(realSink bar.Sink) {
+// It returns true when the underlying module is ready to be restarted (i.e. it
+// was stopped and an eligible click event was received), or false if the
+// module was stopped using Stop.
+func (m *Module) runLoop(realSink bar.Sink) bool {
 	started := false
 	finished := false
 	var refreshFn func()
@@ -75,7 +95,8 @@ func (m *Module) runLoop(realSink bar.Sink) {
 	l.Attach(m.original, timedSink, "~internal-sink")
 	outputCh := make(chan bar.Output)
 	innerSink := func(o bar.Output) { outputCh <- o }
-	doneCh := make(chan struct{})
+	// Buffered so that a module that finishes after Stop does not leak.
+	doneCh := make(chan struct{}, 1)
 
 	go func(m bar.Module, innerSink bar.Sink, doneCh chan<- struct{}) {
 		l.Fine("%s started", l.ID(m))
@@ -84,20 +105,52 @@ func (m *Module) runLoop(realSink bar.Sink) {
 		doneCh <- struct{}{}
 	}(m.original, innerSink, doneCh)
 
+	if m.placeholder != nil {
+		// Only shown until the first output, restarts keep the last output.
+		timedSink.Output(m.placeholder, false)
+		m.placeholder = nil
+	}
+
+	// Transient outputs are shown until the expiry scheduler fires, deferring
+	// any other output from the module until then.
+	expiry := timing.NewScheduler()
+	l.Attach(m.original, expiry, "~transient")
+	var transient bar.Output
 	var out bar.Output
 	for {
 		select {
-		case out = <-outputCh:
+		case o := <-outputCh:
 			started = true
-			timedSink.Output(out, true)
+			if t, ok := o.(bar.TransientOutput); ok {
+				l.Fine("%s: transient output for %v", l.ID(m), t.TransientDuration())
+				transient = t
+				expiry.After(t.TransientDuration())
+				timedSink.Output(transient, true)
+				continue
+			}
+			out = o
+			if transient == nil {
+				timedSink.Output(out, true)
+			}
+		case <-expiry.C:
+			if transient != nil {
+				l.Fine("%s: transient output expired", l.ID(m))
+				transient = nil
+				timedSink.Output(out, true)
+			}
 		case <-doneCh:
 			finished = true
+			transient = nil
+			expiry.Stop()
 			timedSink.Stop()
 			out = toSegments(out)
 			l.Fine("%s: set restart handlers", l.ID(m))
 			timedSink.Output(addRestartHandlers(out, m.restartFn), false)
 		case <-m.replayCh:
-			if started {
+			if started && transient != nil {
+				l.Fine("%s: replay transient output", l.ID(m))
+				timedSink.Output(transient, true)
+			} else if started {
 				l.Fine("%s: replay last output", l.ID(m))
 				timedSink.Output(out, true)
 			}
@@ -105,8 +158,13 @@ func (m *Module) runLoop(realSink bar.Sink) {
 			if finished {
 				l.Fine("%s restarted", l.ID(m.original))
 				timedSink.Output(stripErrors(out, l.ID(m)), false)
-				return // Stream will restart the run loop.
+				return true // Stream will restart the run loop.
 			}
+		case <-m.stopCh:
+			l.Fine("%s stopped", l.ID(m.original))
+			expiry.Stop()
+			timedSink.Stop()
+			return false
 		}
 	}
 }
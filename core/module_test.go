@@ -127,6 +127,31 @@ func TestRestart(t *testing.T) {
 	tm.AssertStarted("on middle click")
 }
 
+func TestStop(t *testing.T) {
+	tm := testModule.New(t)
+	m := NewModule(tm)
+	ch, sink := sink.New()
+	stopped := make(chan struct{})
+
+	go func() {
+		m.Stream(sink)
+		close(stopped)
+	}()
+	tm.AssertStarted()
+	tm.OutputText("foo")
+	nextOutput(t, ch, "before stop")
+
+	m.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		require.Fail(t, "Stream did not return after Stop")
+	}
+	tm.OutputText("bar")
+	assertNoOutput(t, ch, "after stop")
+	require.NotPanics(t, func() { m.Stop() }, "stopping again")
+}
+
 func TestTimedOutput(t *testing.T) {
 	timing.TestMode()
 	tm := testModule.New(t).SkipClickHandlers()
@@ -201,7 +226,56 @@ func TestTimedOutput(t *testing.T) {
 	assertNoOutput(t, ch, "TimedOutput remains stopped after replay")
 }
 
+func TestTransientOutput(t *testing.T) {
+	timing.TestMode()
+	tm := testModule.New(t).SkipClickHandlers()
+	m := NewModule(tm)
+	ch, sink := sink.New()
+	go m.Stream(sink)
+	tm.AssertStarted()
+
+	tm.OutputText("foo")
+	txt, _ := nextOutput(t, ch, "regular output")[0].Content()
+	require.Equal(t, "foo", txt)
+
+	start := timing.Now()
+	tm.Output(outputs.Transient(outputs.Text("Copied!"), 5*time.Second))
+	txt, _ = nextOutput(t, ch, "transient output")[0].Content()
+	require.Equal(t, "Copied!", txt)
+
+	tm.OutputText("bar")
+	assertNoOutput(t, ch, "regular output deferred during transient")
+	m.Replay()
+	txt, _ = nextOutput(t, ch, "replay during transient")[0].Content()
+	require.Equal(t, "Copied!", txt)
+
+	require.Equal(t, start.Add(5*time.Second), timing.NextTick())
+	txt, _ = nextOutput(t, ch, "transient expired")[0].Content()
+	require.Equal(t, "bar", txt, "latest regular output shown")
+
+	tm.Output(outputs.Transient(outputs.Repeat(func(now time.Time) bar.Output {
+		return outputs.Textf("%v", now.Sub(start))
+	}).Every(time.Second), 3*time.Second))
+	txt, _ = nextOutput(t, ch, "timed transient output")[0].Content()
+	require.Equal(t, "5s", txt)
+	timing.NextTick()
+	txt, _ = nextOutput(t, ch, "timed transient output refreshed")[0].Content()
+	require.Equal(t, "6s", txt)
+
+	tm.Output(outputs.Transient(outputs.Text("Pasted!"), 5*time.Second))
+	txt, _ = nextOutput(t, ch, "transient replaced")[0].Content()
+	require.Equal(t, "Pasted!", txt)
+	timing.AdvanceBy(4 * time.Second)
+	assertNoOutput(t, ch, "replaced transient does not expire early")
+	timing.AdvanceBy(time.Second)
+	txt, _ = nextOutput(t, ch, "replaced transient expired")[0].Content()
+	require.Equal(t, "bar", txt)
+}
+
 func TestTimedOutputRealTime(t *testing.T) {
+	if testing.Short() {
+		t.Skip("uses real time")
+	}
 	timing.ExitTestMode()
 
 	tm := testModule.New(t).SkipClickHandlers()
@@ -244,6 +318,61 @@ func TestTimedOutputRealTime(t *testing.T) {
 	nextOutput(t, ch)
 	nextOutput(t, ch)
 
+	tm.Output(bar.TextSegment("foo"))
+	// With a 1ns interval, frames keep arriving until the new output reaches
+	// the sink, so only the order can be checked in real time. The AutoAdvance
+	// variant of this test checks that "foo" is the very next output.
+	for txt = ""; txt != "foo"; {
+		txt, _ = nextOutput(t, ch)[0].Content()
+	}
+
+	assertNoOutput(t, ch, "When no longer using timed output")
+}
+
+func TestTimedOutputAutoAdvance(t *testing.T) {
+	timing.TestMode()
+	defer timing.AutoAdvance(20 * time.Millisecond)()
+
+	tm := testModule.New(t).SkipClickHandlers()
+	m := NewModule(tm)
+	ch, sink := sink.New()
+
+	tm.AssertNotStarted("before stream")
+	go m.Stream(sink)
+	tm.AssertStarted("after stream")
+	assertNoOutput(t, ch, "on start")
+
+	start := timing.Now()
+	tm.Output(outputs.Repeat(func(now time.Time) bar.Output {
+		ms := timing.Now().Sub(start).Seconds() * 1000.0
+		return outputs.Textf("%.0f", ms/100)
+	}).Every(100 * time.Millisecond))
+
+	txt, _ := nextOutput(t, ch)[0].Content()
+	require.Equal(t, "0", txt)
+
+	txt, _ = nextOutput(t, ch)[0].Content()
+	require.Equal(t, "1", txt)
+
+	txt, _ = nextOutput(t, ch)[0].Content()
+	require.Equal(t, "2", txt)
+
+	tm.Output(bar.TextSegment("foo"))
+	txt, _ = nextOutput(t, ch)[0].Content()
+	require.Equal(t, "foo", txt)
+
+	assertNoOutput(t, ch, "When no longer using timed output")
+
+	// Test rapid updates for data races.
+	tm.Output(outputs.Repeat(func(now time.Time) bar.Output {
+		return outputs.Text(now.Format("15:04:05.000000"))
+	}).Every(time.Nanosecond))
+
+	nextOutput(t, ch)
+	nextOutput(t, ch)
+	nextOutput(t, ch)
+	nextOutput(t, ch)
+
 	tm.Output(bar.TextSegment("foo"))
 	txt, _ = nextOutput(t, ch)[0].Content()
 	require.Equal(t, "foo", txt)
@@ -329,3 +458,39 @@ func TestRefresh(t *testing.T) {
 	out[0].Click(bar.Event{Button: bar.ButtonLeft})
 	notifier.AssertNoUpdate(t, refreshCh, "left-click on finished module error")
 }
+
+func TestPlaceholder(t *testing.T) {
+	timing.TestMode()
+	tm := testModule.New(t)
+	m := NewModule(tm)
+	frame := 0
+	m.SetPlaceholder(outputs.Repeat(func(time.Time) bar.Output {
+		frame++
+		return outputs.Textf("loading %d", frame)
+	}).Every(time.Second))
+	ch, sink := sink.New()
+
+	go m.Stream(sink)
+	tm.AssertStarted("after stream")
+	txt, _ := nextOutput(t, ch, "placeholder on start")[0].Content()
+	require.Equal(t, "loading 1", txt)
+
+	timing.NextTick()
+	txt, _ = nextOutput(t, ch, "timed placeholder")[0].Content()
+	require.Equal(t, "loading 2", txt)
+
+	tm.OutputText("foo")
+	txt, _ = nextOutput(t, ch, "on first output")[0].Content()
+	require.Equal(t, "foo", txt)
+
+	timing.NextTick()
+	assertNoOutput(t, ch, "placeholder stops after first output")
+
+	tm.Close()
+	out := nextOutput(t, ch, "on close")
+	out[0].Click(bar.Event{Button: bar.ButtonLeft})
+	txt, _ = nextOutput(t, ch, "on restart")[0].Content()
+	require.Equal(t, "foo", txt, "placeholder not shown on restart")
+	tm.AssertStarted("on restart")
+	assertNoOutput(t, ch, "placeholder not shown on restart")
+}
@@ -15,59 +15,174 @@
 package core // import "barista.run/core"
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime/pprof"
 	"sync"
+	"time"
 
 	"barista.run/bar"
 	l "barista.run/logging"
 	"barista.run/sink"
+	"barista.run/timing"
 )
 
 // ModuleSet is a group of modules. It provides a channel for identifying module
 // updates, and methods to get the last output of the set or a specific module.
 type ModuleSet struct {
-	modules   []*Module
-	updateCh  chan int
-	outputs   []bar.Segments
-	outputsMu sync.RWMutex
+	entries     []*moduleEntry
+	updateCh    chan int
+	placeholder bar.Output
+	streaming   bool
+	nextID      int
+	outputsMu   sync.RWMutex
+}
+
+// moduleEntry holds a module in the set along with its last output, so that
+// outputs can be tracked even as the modules in the set are replaced.
+type moduleEntry struct {
+	original bar.Module
+	module   *Module
+	output   bar.Segments
+	stats    ModuleStats
+}
+
+// ModuleStats contains information about a module's updates, for debugging.
+type ModuleStats struct {
+	// Name identifies the module, and is used as the value of the "module"
+	// label on the goroutines started for the module, for use with pprof.
+	Name string
+	// Updates is the number of times the module has updated its output.
+	Updates int
+	// LastUpdate is the time of the module's most recent update.
+	LastUpdate time.Time
 }
 
 // NewModuleSet creates a ModuleSet with the given modules.
 func NewModuleSet(modules []bar.Module) *ModuleSet {
-	set := &ModuleSet{
-		modules:  make([]*Module, len(modules)),
-		outputs:  make([]bar.Segments, len(modules)),
-		updateCh: make(chan int),
-	}
+	set := &ModuleSet{updateCh: make(chan int)}
 	for i, m := range modules {
 		l.Fine("%s added as %s[%d]", l.ID(m), l.ID(set), i)
-		set.modules[i] = NewModule(m)
+		set.entries = append(set.entries, set.newEntry(m))
 	}
 	return set
 }
 
-// Stream starts streaming all modules and returns a channel that receives the
-// index of the module any time one updates with new output.
+func (m *ModuleSet) newEntry(original bar.Module) *moduleEntry {
+	e := &moduleEntry{original: original, module: NewModule(original)}
+	e.stats.Name = fmt.Sprintf("%d:%T", m.nextID, original)
+	m.nextID++
+	if m.placeholder != nil {
+		e.module.SetPlaceholder(m.placeholder)
+	}
+	return e
+}
+
+// SetPlaceholder sets the output shown in place of each module until it
+// produces its first output. It must be called before Stream.
+func (m *ModuleSet) SetPlaceholder(placeholder bar.Output) {
+	m.placeholder = placeholder
+	for _, e := range m.entries {
+		e.module.SetPlaceholder(placeholder)
+	}
+}
+
+// Stream starts streaming all modules concurrently and returns a channel that
+// receives the index of the module any time one updates with new output.
 func (m *ModuleSet) Stream() <-chan int {
-	for i, mod := range m.modules {
-		go mod.Stream(m.sinkFn(i))
+	m.outputsMu.Lock()
+	defer m.outputsMu.Unlock()
+	m.streaming = true
+	for _, e := range m.entries {
+		go m.stream(e)
 	}
 	return m.updateCh
 }
 
-func (m *ModuleSet) sinkFn(idx int) bar.Sink {
+// Replace replaces the modules in the set with the given list. Modules in
+// both the current set and the new list keep running, retaining their state
+// and last output. Modules that are no longer in the list are stopped, and
+// new modules are started if the set is streaming. Since modules cannot be
+// interrupted, a module that has been removed must not be added again.
+func (m *ModuleSet) Replace(modules []bar.Module) {
+	m.outputsMu.Lock()
+	defer m.outputsMu.Unlock()
+	existing := m.entries
+	m.entries = make([]*moduleEntry, len(modules))
+	for i, mod := range modules {
+		for j, e := range existing {
+			if e != nil && sameModule(e.original, mod) {
+				m.entries[i] = e
+				existing[j] = nil
+				break
+			}
+		}
+		if m.entries[i] != nil {
+			continue
+		}
+		l.Fine("%s added as %s[%d]", l.ID(mod), l.ID(m), i)
+		m.entries[i] = m.newEntry(mod)
+		if m.streaming {
+			go m.stream(m.entries[i])
+		}
+	}
+	for _, e := range existing {
+		if e != nil {
+			l.Fine("%s removed from %s", l.ID(e.original), l.ID(m))
+			e.module.Stop()
+		}
+	}
+}
+
+// sameModule returns true if both modules are the same instance. Modules of
+// types that cannot be compared are never the same.
+func sameModule(a, b bar.Module) bool {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	return ta == tb && ta.Comparable() && a == b
+}
+
+// stream streams the given module, labelling the goroutine (and any goroutines
+// it starts) with the module's name.
+func (m *ModuleSet) stream(e *moduleEntry) {
+	labels := pprof.Labels("module", e.stats.Name)
+	pprof.Do(context.Background(), labels, func(context.Context) {
+		e.module.Stream(m.sinkFn(e))
+	})
+}
+
+func (m *ModuleSet) sinkFn(e *moduleEntry) bar.Sink {
 	return sink.Func(func(out bar.Segments) {
-		l.Fine("%s new output from %s",
-			l.ID(m), l.ID(m.modules[idx].original))
+		l.Fine("%s new output from %s", l.ID(m), l.ID(e.original))
 		m.outputsMu.Lock()
-		m.outputs[idx] = out
+		idx := m.indexLocked(e)
+		if idx < 0 {
+			// The module was removed, but had output in flight.
+			m.outputsMu.Unlock()
+			return
+		}
+		e.output = out
+		e.stats.Updates++
+		e.stats.LastUpdate = timing.Now()
 		m.outputsMu.Unlock()
 		m.updateCh <- idx
 	})
 }
 
+func (m *ModuleSet) indexLocked(e *moduleEntry) int {
+	for i, entry := range m.entries {
+		if entry == e {
+			return i
+		}
+	}
+	return -1
+}
+
 // Len returns the number of modules in this ModuleSet.
 func (m *ModuleSet) Len() int {
-	return len(m.modules)
+	m.outputsMu.RLock()
+	defer m.outputsMu.RUnlock()
+	return len(m.entries)
 }
 
 // LastOutput returns the last output from the module at a specific position.
@@ -75,7 +190,7 @@ func (m *ModuleSet) Len() int {
 func (m *ModuleSet) LastOutput(idx int) bar.Segments {
 	m.outputsMu.RLock()
 	defer m.outputsMu.RUnlock()
-	return m.outputs[idx]
+	return m.entries[idx].output
 }
 
 // LastOutputs returns the last output from all modules in order. The returned
@@ -84,7 +199,16 @@ func (m *ModuleSet) LastOutput(idx int) bar.Segments {
 func (m *ModuleSet) LastOutputs() []bar.Segments {
 	m.outputsMu.RLock()
 	defer m.outputsMu.RUnlock()
-	cp := make([]bar.Segments, len(m.outputs))
-	copy(cp, m.outputs)
+	cp := make([]bar.Segments, len(m.entries))
+	for i, e := range m.entries {
+		cp[i] = e.output
+	}
 	return cp
 }
+
+// Stats returns update statistics for the module at a specific position.
+func (m *ModuleSet) Stats(idx int) ModuleStats {
+	m.outputsMu.RLock()
+	defer m.outputsMu.RUnlock()
+	return m.entries[idx].stats
+}
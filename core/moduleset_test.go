@@ -19,7 +19,9 @@ import (
 	"time"
 
 	"barista.run/bar"
+	"barista.run/outputs"
 	testModule "barista.run/testing/module"
+	"barista.run/timing"
 
 	"github.com/stretchr/testify/require"
 )
@@ -78,3 +80,112 @@ func TestModuleSet(t *testing.T) {
 	require.Equal(t, "foo", txt)
 	require.Empty(t, out[2])
 }
+
+// funcModule is a module type that cannot be compared.
+type funcModule func(bar.Sink)
+
+func (f funcModule) Stream(s bar.Sink) { f(s) }
+
+func TestModuleSetReplace(t *testing.T) {
+	static := funcModule(func(s bar.Sink) { s.Output(outputs.Text("static")) })
+	tms := []*testModule.TestModule{
+		testModule.New(t),
+		testModule.New(t),
+		testModule.New(t),
+		testModule.New(t),
+	}
+	ms := NewModuleSet([]bar.Module{tms[0], tms[1], tms[2]})
+	ms.Replace([]bar.Module{tms[1], tms[0]})
+	tms[0].AssertNotStarted("before stream")
+	require.Equal(t, 2, ms.Len())
+
+	updateCh := ms.Stream()
+	tms[0].AssertStarted("on stream")
+	tms[1].AssertStarted("on stream")
+	tms[2].AssertNotStarted("removed before stream")
+	tms[0].OutputText("foo")
+	require.Equal(t, 1, nextUpdate(t, updateCh, "on output"))
+	tms[1].OutputText("bar")
+	require.Equal(t, 0, nextUpdate(t, updateCh, "on output"))
+
+	ms.Replace([]bar.Module{tms[3], tms[0], static})
+	tms[3].AssertStarted("added while streaming")
+	require.Equal(t, 2, nextUpdate(t, updateCh, "uncomparable module added"))
+	require.Equal(t, 2, nextUpdate(t, updateCh, "uncomparable module finished"))
+	require.Equal(t, 3, ms.Len())
+	out := ms.LastOutputs()
+	require.Empty(t, out[0], "new module without output")
+	txt, _ := out[1][0].Content()
+	require.Equal(t, "foo", txt, "existing module keeps last output")
+	require.Equal(t, 1, ms.Stats(1).Updates, "existing module keeps stats")
+	require.Equal(t, "3:*module.TestModule", ms.Stats(0).Name)
+
+	tms[1].OutputText("baz")
+	assertNoUpdate(t, updateCh, "from removed module")
+	tms[0].OutputText("foo2")
+	require.Equal(t, 1, nextUpdate(t, updateCh, "on output at new index"))
+	tms[3].OutputText("new")
+	require.Equal(t, 0, nextUpdate(t, updateCh, "on output from new module"))
+	txt, _ = ms.LastOutput(0)[0].Content()
+	require.Equal(t, "new", txt)
+}
+
+func TestModuleSetPlaceholder(t *testing.T) {
+	tms := []*testModule.TestModule{
+		testModule.New(t),
+		testModule.New(t),
+	}
+	ms := NewModuleSet([]bar.Module{tms[0], tms[1]})
+	ms.SetPlaceholder(outputs.Text("..."))
+	updateCh := ms.Stream()
+	for _, tm := range tms {
+		tm.AssertStarted("on moduleset stream")
+	}
+
+	updated := map[int]bool{}
+	updated[nextUpdate(t, updateCh, "placeholder")] = true
+	updated[nextUpdate(t, updateCh, "placeholder")] = true
+	require.Equal(t, map[int]bool{0: true, 1: true}, updated,
+		"placeholder output for all modules on start")
+	for i := range tms {
+		txt, _ := ms.LastOutput(i)[0].Content()
+		require.Equal(t, "...", txt)
+	}
+
+	tms[1].OutputText("foo")
+	require.Equal(t, 1, nextUpdate(t, updateCh, "on output"))
+	txt, _ := ms.LastOutput(1)[0].Content()
+	require.Equal(t, "foo", txt)
+	txt, _ = ms.LastOutput(0)[0].Content()
+	require.Equal(t, "...", txt, "placeholder until module outputs")
+}
+
+func TestModuleSetStats(t *testing.T) {
+	timing.TestMode()
+	tms := []*testModule.TestModule{
+		testModule.New(t),
+		testModule.New(t),
+	}
+	ms := NewModuleSet([]bar.Module{tms[0], tms[1]})
+	require.Equal(t, "0:*module.TestModule", ms.Stats(0).Name)
+	require.Equal(t, "1:*module.TestModule", ms.Stats(1).Name)
+
+	updateCh := ms.Stream()
+	for _, tm := range tms {
+		tm.AssertStarted("on moduleset stream")
+	}
+	require.Equal(t, 0, ms.Stats(0).Updates)
+	require.True(t, ms.Stats(0).LastUpdate.IsZero())
+
+	start := timing.Now()
+	tms[0].OutputText("foo")
+	nextUpdate(t, updateCh, "on output")
+	timing.AdvanceBy(time.Minute)
+	tms[0].OutputText("bar")
+	nextUpdate(t, updateCh, "on output")
+
+	stats := ms.Stats(0)
+	require.Equal(t, 2, stats.Updates)
+	require.Equal(t, start.Add(time.Minute), stats.LastUpdate)
+	require.Equal(t, 0, ms.Stats(1).Updates)
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	l "barista.run/logging"
+)
+
+var outputType = reflect.TypeOf((*bar.Output)(nil)).Elem()
+
+// OutputFunc stores the output function of a module, protecting the module
+// from user-supplied functions. It can be used in place of a value.Value of
+// func(...) bar.Output, since Get returns a function of the same type.
+//
+// The first function set is treated as the module's default output. If a
+// later function panics or returns an error segment, a warning is logged and
+// the default output is shown instead, followed by a small error marker that
+// shows the error when right-clicked. If the default output panics, an error
+// is shown instead.
+type OutputFunc struct {
+	value.Value
+	mu          sync.Mutex
+	defaultFunc reflect.Value
+}
+
+// Set stores an output function, which must be a function that returns a
+// bar.Output. Subscribers are notified as with value.Value.
+func (o *OutputFunc) Set(outputFunc interface{}) {
+	fn := reflect.ValueOf(outputFunc)
+	if fn.Kind() != reflect.Func || fn.Type().NumOut() != 1 || fn.Type().Out(0) != outputType {
+		panic(fmt.Sprintf("%T is not an output function", outputFunc))
+	}
+	o.mu.Lock()
+	var defaultFunc reflect.Value
+	if o.defaultFunc.IsValid() {
+		defaultFunc = o.defaultFunc
+	} else {
+		o.defaultFunc = fn
+	}
+	o.mu.Unlock()
+	o.Value.Set(safeOutputFunc(o, fn, defaultFunc).Interface())
+}
+
+// safeOutputFunc wraps an output function, falling back to the default
+// function if it fails. defaultFunc is not valid when wrapping the default
+// function itself.
+func safeOutputFunc(logCtx interface{}, fn, defaultFunc reflect.Value) reflect.Value {
+	var mu sync.Mutex
+	var lastErr string
+	return reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		out, err := callOutputFunc(fn, args, defaultFunc.IsValid())
+		if err != nil {
+			// Output functions are called on every update, only log changes.
+			mu.Lock()
+			if msg := err.Error(); msg != lastErr {
+				l.Log("%s: output function failed: %s", l.ID(logCtx), msg)
+				lastErr = msg
+			}
+			mu.Unlock()
+			out = fallbackOutput(defaultFunc, args, err)
+		}
+		return []reflect.Value{reflect.ValueOf(&out).Elem()}
+	})
+}
+
+// callOutputFunc calls an output function, converting panics to errors. If
+// checkErrors is true, error segments in the output are also returned as
+// errors.
+func callOutputFunc(fn reflect.Value, args []reflect.Value, checkErrors bool) (out bar.Output, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			out, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	out, _ = fn.Call(args)[0].Interface().(bar.Output)
+	if !checkErrors {
+		return out, nil
+	}
+	for _, s := range toSegments(out) {
+		if err := s.GetError(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// fallbackOutput returns the output of the default function with an error
+// marker, or just an error if there is no default function or it panics.
+func fallbackOutput(defaultFunc reflect.Value, args []reflect.Value, err error) bar.Output {
+	if !defaultFunc.IsValid() {
+		return bar.ErrorSegment(err)
+	}
+	out, defaultErr := callOutputFunc(defaultFunc, args, false)
+	if defaultErr != nil {
+		return bar.ErrorSegment(err)
+	}
+	marker := bar.TextSegment("!").Error(err)
+	return append(append(bar.Segments{}, toSegments(out)...), marker)
+}
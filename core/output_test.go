@@ -0,0 +1,94 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	"barista.run/testing/notifier"
+
+	"github.com/stretchr/testify/require"
+)
+
+func text(s *bar.Segment) string {
+	text, _ := s.Content()
+	return text
+}
+
+func TestOutputFunc(t *testing.T) {
+	var o OutputFunc
+	sub, done := o.Subscribe()
+	defer done()
+
+	o.Set(func(s string) bar.Output {
+		if s == "" {
+			panic("empty")
+		}
+		return outputs.Textf("default: %s", s)
+	})
+	notifier.AssertNotified(t, sub, "on set")
+	format := o.Get().(func(string) bar.Output)
+	require.Equal(t, "default: a", text(format("a").Segments()[0]))
+	errOut := format("").Segments()
+	require.Len(t, errOut, 1)
+	require.EqualError(t, errOut[0].GetError(), "panic: empty",
+		"panic in default output shows error")
+
+	o.Set(func(s string) bar.Output {
+		switch s {
+		case "panic":
+			var segments bar.Segments
+			return segments[1]
+		case "error":
+			return outputs.Group(outputs.Text("ok"), outputs.Errorf("bad input"))
+		case "nil":
+			return nil
+		}
+		return outputs.Textf("custom: %s", s)
+	})
+	notifier.AssertNotified(t, sub, "on set")
+	format = o.Get().(func(string) bar.Output)
+	require.Equal(t, "custom: a", text(format("a").Segments()[0]))
+	require.Nil(t, format("nil"))
+
+	out := format("panic").Segments()
+	require.Len(t, out, 2, "default output and error marker")
+	require.Equal(t, "default: panic", text(out[0]))
+	require.Nil(t, out[0].GetError())
+	require.Contains(t, out[1].GetError().Error(), "index out of range")
+	urgent, _ := out[1].IsUrgent()
+	require.False(t, urgent, "error marker is not urgent")
+
+	out = format("error").Segments()
+	require.Len(t, out, 2)
+	require.Equal(t, "default: error", text(out[0]))
+	require.EqualError(t, out[1].GetError(), "bad input")
+
+	out = format("").Segments()
+	require.Len(t, out, 1, "custom output is used for empty input")
+	require.Equal(t, "custom: ", text(out[0]))
+
+	o.Set(func(string) bar.Output { panic(errors.New("always")) })
+	out = o.Get().(func(string) bar.Output)("").Segments()
+	require.Len(t, out, 1)
+	require.EqualError(t, out[0].GetError(), "panic: always",
+		"error shown if default output also fails")
+
+	require.Panics(t, func() { o.Set(func(string) string { return "" }) })
+	require.Panics(t, func() { o.Set(nil) })
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+
+	"barista.run/bar"
+)
+
+// PerOutput holds the modules to show on each monitor output, for bars that
+// can show different modules on each output from the same process. Each set of
+// modules is streamed when it is first used, and is shared by all outputs that
+// show it (e.g. all outputs without their own modules).
+//
+// Only renderers that know which output they draw on can use PerOutput, such
+// as render/wayland. The i3bar protocol does not provide the output, so
+// barista.Run always shows the same modules.
+type PerOutput struct {
+	defaults *ModuleSet
+	outputs  map[string]*ModuleSet
+	updates  chan *ModuleSet
+
+	mu      sync.Mutex
+	started map[*ModuleSet]bool
+}
+
+// NewPerOutput creates a PerOutput with the default modules, used for any
+// output without its own modules, and the modules for specific outputs, keyed
+// by output name. A module instance must not appear in more than one list; use
+// multicast.New to show the same module on more than one output.
+func NewPerOutput(defaults []bar.Module, outputs map[string][]bar.Module) *PerOutput {
+	p := &PerOutput{
+		outputs: map[string]*ModuleSet{},
+		updates: make(chan *ModuleSet),
+		started: map[*ModuleSet]bool{},
+	}
+	if len(defaults) > 0 {
+		p.defaults = NewModuleSet(defaults)
+	}
+	for name, modules := range outputs {
+		var set *ModuleSet
+		if len(modules) > 0 {
+			set = NewModuleSet(modules)
+		}
+		p.outputs[name] = set
+	}
+	return p
+}
+
+// For returns the modules for the named output, starting them if they are not
+// already running. It returns nil if the output should not show any modules,
+// which is the case for outputs given an empty list of modules, or any output
+// without its own modules if there are no default modules.
+func (p *PerOutput) For(output string) *ModuleSet {
+	set, ok := p.outputs[output]
+	if !ok {
+		set = p.defaults
+	}
+	if set == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.started[set] {
+		p.started[set] = true
+		go p.stream(set)
+	}
+	return set
+}
+
+func (p *PerOutput) stream(set *ModuleSet) {
+	for range set.Stream() {
+		p.updates <- set
+	}
+}
+
+// Updates returns a channel that receives a set of modules any time one of its
+// modules updates with new output.
+func (p *PerOutput) Updates() <-chan *ModuleSet {
+	return p.updates
+}
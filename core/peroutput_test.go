@@ -0,0 +1,77 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	testModule "barista.run/testing/module"
+
+	"github.com/stretchr/testify/require"
+)
+
+func nextSetUpdate(t *testing.T, p *PerOutput, formatAndArgs ...interface{}) *ModuleSet {
+	select {
+	case set := <-p.Updates():
+		return set
+	case <-time.After(time.Second):
+		require.Fail(t, "No update from per-output modules", formatAndArgs...)
+	}
+	return nil
+}
+
+func TestPerOutput(t *testing.T) {
+	defaultMod := testModule.New(t)
+	laptopMod := testModule.New(t)
+	externalMod := testModule.New(t)
+	p := NewPerOutput([]bar.Module{defaultMod}, map[string][]bar.Module{
+		"eDP-1":  {laptopMod},
+		"HDMI-1": {externalMod},
+		"DP-1":   nil,
+	})
+	defaultMod.AssertNotStarted("before use")
+	laptopMod.AssertNotStarted("before use")
+
+	laptop := p.For("eDP-1")
+	require.NotNil(t, laptop)
+	laptopMod.AssertStarted("on first use")
+	require.Equal(t, laptop, p.For("eDP-1"), "same set on repeated use")
+	defaultMod.AssertNotStarted("when only specific outputs are used")
+	externalMod.AssertNotStarted("when only other outputs are used")
+
+	other := p.For("DP-2")
+	require.NotNil(t, other)
+	defaultMod.AssertStarted("on output without its own modules")
+	require.Equal(t, other, p.For("VGA-1"), "default modules are shared")
+	require.Nil(t, p.For("DP-1"), "output without modules")
+
+	laptopMod.OutputText("laptop")
+	require.Equal(t, laptop, nextSetUpdate(t, p, "on output"))
+	txt, _ := laptop.LastOutput(0)[0].Content()
+	require.Equal(t, "laptop", txt)
+
+	defaultMod.OutputText("default")
+	require.Equal(t, other, nextSetUpdate(t, p, "on output"))
+}
+
+func TestPerOutputWithoutDefaults(t *testing.T) {
+	mod := testModule.New(t)
+	p := NewPerOutput(nil, map[string][]bar.Module{"eDP-1": {mod}})
+	require.Nil(t, p.For("HDMI-1"))
+	require.NotNil(t, p.For("eDP-1"))
+	mod.AssertStarted()
+}
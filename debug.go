@@ -0,0 +1,118 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	l "barista.run/logging"
+	"barista.run/timing"
+)
+
+// DebugServer starts an HTTP server for diagnostics on the given address
+// (e.g. "localhost:6060") when the bar is run. In addition to the standard
+// pprof handlers under /debug/pprof/, it serves each module's update count,
+// frequency, and last output at /debug/modules, and a dump of the goroutines
+// started by module N at /debug/modules/goroutines?module=N. The server has no authentication, so it should only listen on localhost.
+// Must be called before Run.
+func DebugServer(addr string) {
+	construct()
+	instance.Lock()
+	defer instance.Unlock()
+	if instance.started {
+		panic("Cannot start debug server after .Run()")
+	}
+	instance.debugAddr = addr
+}
+
+func (b *i3Bar) serveDebug() {
+	l.Log("Debug server listening on %s", b.debugAddr)
+	err := http.ListenAndServe(b.debugAddr, b.debugHandler())
+	l.Log("Debug server stopped: %v", err)
+}
+
+func (b *i3Bar) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/modules", b.serveModules)
+	mux.HandleFunc("/debug/modules/goroutines", b.serveModuleGoroutines)
+	return mux
+}
+
+// serveModules writes a table of all modules, with update statistics and the
+// text of their last output.
+func (b *i3Bar) serveModules(w http.ResponseWriter, r *http.Request) {
+	now := timing.Now()
+	uptime := now.Sub(b.startTime)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tModule\tUpdates\tPer minute\tLast update\tOutput")
+	for i := 0; i < b.moduleSet.Len(); i++ {
+		stats := b.moduleSet.Stats(i)
+		perMinute := 0.0
+		if uptime > 0 {
+			perMinute = float64(stats.Updates) / uptime.Minutes()
+		}
+		lastUpdate := "never"
+		if !stats.LastUpdate.IsZero() {
+			lastUpdate = now.Sub(stats.LastUpdate).Truncate(time.Millisecond).String() + " ago"
+		}
+		var texts []string
+		for _, s := range b.moduleSet.LastOutput(i) {
+			txt, _ := s.Content()
+			texts = append(texts, strconv.Quote(txt))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%.2f\t%s\t%s\n",
+			i, stats.Name, stats.Updates, perMinute, lastUpdate,
+			strings.Join(texts, " "))
+	}
+	tw.Flush()
+}
+
+// serveModuleGoroutines writes the goroutine profile, filtered to goroutines
+// labelled with the requested module.
+func (b *i3Bar) serveModuleGoroutines(w http.ResponseWriter, r *http.Request) {
+	idx, err := strconv.Atoi(r.URL.Query().Get("module"))
+	if err != nil || idx < 0 || idx >= b.moduleSet.Len() {
+		http.Error(w, "module must be a valid module index", http.StatusBadRequest)
+		return
+	}
+	label := fmt.Sprintf(`"module":%q`, b.moduleSet.Stats(idx).Name)
+	var buf bytes.Buffer
+	if err := runtimepprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// With debug=1, each group of identical goroutines is printed as a block
+	// separated by blank lines, including a "# labels: {...}" line if any.
+	for _, block := range strings.Split(buf.String(), "\n\n") {
+		if strings.Contains(block, label) {
+			fmt.Fprintf(w, "%s\n\n", block)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"barista.run/testing/mockio"
+	testModule "barista.run/testing/module"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func getDebug(t *testing.T, path string) (int, string) {
+	srv := httptest.NewServer(instance.debugHandler())
+	defer srv.Close()
+	r, err := http.Get(srv.URL + path)
+	require.NoError(t, err)
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	require.NoError(t, err)
+	return r.StatusCode, string(body)
+}
+
+func TestDebugServer(t *testing.T) {
+	mockStdin := mockio.Stdin()
+	mockStdout := mockio.Stdout()
+	TestMode(mockStdin, mockStdout)
+	timing.TestMode()
+	defer timing.ExitTestMode()
+
+	active := testModule.New(t)
+	idle := testModule.New(t)
+	DebugServer("localhost:0")
+	Add(active)
+	Add(idle)
+	go Run()
+
+	_, err := mockStdout.ReadUntil('[', time.Second)
+	require.Nil(t, err, "output array started without any errors")
+	active.AssertStarted()
+	idle.AssertStarted()
+
+	active.OutputText("foo")
+	readOutputTexts(t, mockStdout)
+	timing.AdvanceBy(2 * time.Minute)
+	active.OutputText("bar")
+	readOutputTexts(t, mockStdout)
+	timing.AdvanceBy(3 * time.Second)
+
+	code, body := getDebug(t, "/debug/modules")
+	require.Equal(t, http.StatusOK, code)
+	require.Regexp(t,
+		`0\s+0:\*module.TestModule\s+2\s+0.98\s+3s ago\s+"bar"`, body,
+		"stats for updated module")
+	require.Regexp(t,
+		`1\s+1:\*module.TestModule\s+0\s+0.00\s+never\s*\n`, body,
+		"stats for module without output")
+
+	code, body = getDebug(t, "/debug/modules/goroutines?module=1")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, `"module":"1:*module.TestModule"`)
+	require.NotContains(t, body, `"module":"0:*module.TestModule"`)
+	require.Contains(t, body, "barista.run/testing/module.(*TestModule).Stream",
+		"module goroutines included in dump")
+
+	code, _ = getDebug(t, "/debug/modules/goroutines?module=2")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = getDebug(t, "/debug/modules/goroutines")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, body = getDebug(t, "/debug/pprof/")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "goroutine")
+
+	require.Panics(t,
+		func() { DebugServer("localhost:0") },
+		"starting debug server on a running bar")
+}
@@ -0,0 +1,210 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"encoding/json"
+	"image/color"
+	"strconv"
+	"unicode/utf8"
+
+	"barista.run/bar"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// i3Encoder writes segments in the JSON format used by i3bar. It reuses its
+// buffer across updates and writes each attribute directly, rather than
+// building a map per segment and encoding it with reflection, since the full
+// bar is written on every update of any module.
+type i3Encoder struct {
+	buf   []byte
+	first bool
+}
+
+// begin starts a new line of output (i.e. a new array of segments).
+func (e *i3Encoder) begin() {
+	e.buf = append(e.buf[:0], '[')
+	e.first = true
+}
+
+// end finishes the array of segments and returns the encoded line, which is
+// only valid until the next call to begin.
+func (e *i3Encoder) end() []byte {
+	e.buf = append(e.buf, "]\n,\n"...)
+	return e.buf
+}
+
+// segment encodes a single segment, with attributes in the same (sorted) order
+// that encoding/json uses for maps. If name is not empty, it is used to
+// identify the segment in click events.
+func (e *i3Encoder) segment(s *bar.Segment, name string) {
+	if !e.first {
+		e.buf = append(e.buf, ',')
+	}
+	e.first = false
+	e.buf = append(e.buf, '{')
+	comma := false
+	key := func(k string) {
+		if comma {
+			e.buf = append(e.buf, ',')
+		}
+		comma = true
+		e.buf = append(e.buf, '"')
+		e.buf = append(e.buf, k...)
+		e.buf = append(e.buf, '"', ':')
+	}
+	if align, ok := s.GetAlignment(); ok {
+		key("align")
+		e.string(string(align))
+	}
+	if background, ok := s.GetBackground(); ok {
+		key("background")
+		e.color(background)
+	}
+	if border, ok := s.GetBorder(); ok {
+		key("border")
+		e.color(border)
+	}
+	if width, ok := s.GetBorderBottom(); ok {
+		key("border_bottom")
+		e.buf = strconv.AppendInt(e.buf, int64(width), 10)
+	}
+	if width, ok := s.GetBorderLeft(); ok {
+		key("border_left")
+		e.buf = strconv.AppendInt(e.buf, int64(width), 10)
+	}
+	if width, ok := s.GetBorderRight(); ok {
+		key("border_right")
+		e.buf = strconv.AppendInt(e.buf, int64(width), 10)
+	}
+	if width, ok := s.GetBorderTop(); ok {
+		key("border_top")
+		e.buf = strconv.AppendInt(e.buf, int64(width), 10)
+	}
+	if color, ok := s.GetColor(); ok {
+		key("color")
+		e.color(color)
+	}
+	txt, pango := s.Content()
+	key("full_text")
+	e.string(txt)
+	key("markup")
+	if pango {
+		e.string("pango")
+	} else {
+		e.string("none")
+	}
+	if minWidth, ok := s.GetMinWidth(); ok {
+		key("min_width")
+		e.value(minWidth)
+	}
+	if name != "" {
+		key("name")
+		e.string(name)
+	}
+	if separator, ok := s.HasSeparator(); ok {
+		key("separator")
+		e.buf = strconv.AppendBool(e.buf, separator)
+	}
+	if padding, ok := s.GetPadding(); ok {
+		key("separator_block_width")
+		e.buf = strconv.AppendInt(e.buf, int64(padding), 10)
+	}
+	if shortText, ok := s.GetShortText(); ok {
+		key("short_text")
+		e.string(shortText)
+	}
+	if urgent, ok := s.IsUrgent(); ok {
+		key("urgent")
+		e.buf = strconv.AppendBool(e.buf, urgent)
+	}
+	e.buf = append(e.buf, '}')
+}
+
+const hexDigits = "0123456789abcdef"
+
+// color appends the colour as a quoted "#rrggbb" string, writing the hex
+// digits directly into the buffer to avoid allocating.
+func (e *i3Encoder) color(c color.Color) {
+	cful, _ := colorful.MakeColor(c)
+	e.buf = append(e.buf, '"', '#')
+	for _, v := range []float64{cful.R, cful.G, cful.B} {
+		b := uint8(v*255.0 + 0.5)
+		e.buf = append(e.buf, hexDigits[b>>4], hexDigits[b&0xf])
+	}
+	e.buf = append(e.buf, '"')
+}
+
+func (e *i3Encoder) value(v interface{}) {
+	switch v := v.(type) {
+	case int:
+		e.buf = strconv.AppendInt(e.buf, int64(v), 10)
+	case string:
+		e.string(v)
+	default:
+		// Not used by bar.Segment, but handle any other values correctly.
+		out, err := json.Marshal(v)
+		if err != nil {
+			out = []byte("null")
+		}
+		e.buf = append(e.buf, out...)
+	}
+}
+
+// string appends a quoted JSON string. Unlike encoding/json, it does not escape
+// HTML characters, since i3bar does not need them escaped and pango markup
+// would otherwise be much longer.
+func (e *i3Encoder) string(s string) {
+	e.buf = append(e.buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' && c < utf8.RuneSelf {
+			i++
+			continue
+		}
+		if c < utf8.RuneSelf {
+			e.buf = append(e.buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				e.buf = append(e.buf, '\\', c)
+			case '\n':
+				e.buf = append(e.buf, '\\', 'n')
+			case '\r':
+				e.buf = append(e.buf, '\\', 'r')
+			case '\t':
+				e.buf = append(e.buf, '\\', 't')
+			default:
+				e.buf = append(e.buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			// Invalid UTF-8 would make the whole line invalid.
+			e.buf = append(e.buf, s[start:i]...)
+			e.buf = append(e.buf, `�`...)
+			i++
+			start = i
+			continue
+		}
+		i += size
+	}
+	e.buf = append(e.buf, s[start:]...)
+	e.buf = append(e.buf, '"')
+}
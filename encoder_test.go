@@ -0,0 +1,133 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"encoding/json"
+	"image/color"
+	"strings"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+
+	"github.com/stretchr/testify/require"
+)
+
+// encodeSegment encodes a single segment and decodes it into a map.
+func encodeSegment(t *testing.T, s *bar.Segment) map[string]interface{} {
+	var e i3Encoder
+	e.begin()
+	e.segment(s, "")
+	out := e.end()
+	require.True(t, strings.HasSuffix(string(out), "]\n,\n"))
+	var segments []map[string]interface{}
+	require.NoError(t, json.Unmarshal(out[:len(out)-len("\n,\n")], &segments),
+		"invalid json: %s", out)
+	require.Len(t, segments, 1)
+	return segments[0]
+}
+
+func TestEncoderStrings(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"simple",
+		`"quoted" and \back\slashed`,
+		"<b>pango</b> & more",
+		"new\nline\ttab\rreturn",
+		"\x00\x01\x1f control",
+		"unicode: héllo ⚡ 🎵",
+		"  ",
+	} {
+		var e i3Encoder
+		e.string(s)
+		var decoded string
+		require.NoError(t, json.Unmarshal(e.buf, &decoded), "%q encoded as %s", s, e.buf)
+		require.Equal(t, s, decoded)
+	}
+
+	var e i3Encoder
+	e.string("bad \xff utf8")
+	require.Equal(t, `"bad � utf8"`, string(e.buf), "invalid utf8 is replaced")
+
+	e = i3Encoder{}
+	e.string("<b>")
+	require.Equal(t, `"<b>"`, string(e.buf), "html is not escaped")
+}
+
+func TestEncoderSegments(t *testing.T) {
+	require := require.New(t)
+	var e i3Encoder
+	e.begin()
+	require.Equal("[]\n,\n", string(e.end()), "empty bar")
+
+	e.begin()
+	e.segment(bar.TextSegment("a").Color(color.RGBA{0x10, 0x20, 0x30, 0xff}), "")
+	e.segment(bar.PangoSegment("<i>b</i>").MinWidthPlaceholder("00:00").Urgent(true), "0")
+	e.segment(bar.TextSegment("c").MinWidth(42).Separator(false).Padding(3), "1")
+	require.Equal(`[`+
+		`{"color":"#102030","full_text":"a","markup":"none"},`+
+		`{"full_text":"<i>b</i>","markup":"pango","min_width":"00:00","name":"0","urgent":true},`+
+		`{"full_text":"c","markup":"none","min_width":42,"name":"1","separator":false,"separator_block_width":3}`+
+		"]\n,\n", string(e.end()))
+
+	e.begin()
+	e.segment(bar.TextSegment("reused"), "")
+	require.Equal(`[{"full_text":"reused","markup":"none"}]`+"\n,\n", string(e.end()),
+		"buffer is reset on begin")
+
+	e.begin()
+	e.segment(bar.TextSegment("d").Border(color.White).BorderWidths(0, 1, 2, 3), "")
+	require.Equal(`[{"border":"#ffffff","border_bottom":2,"border_left":3,`+
+		`"border_right":1,"border_top":0,"full_text":"d","markup":"none"}]`+"\n,\n",
+		string(e.end()), "border widths")
+}
+
+func TestEncoderAllocations(t *testing.T) {
+	segments := outputs.Group(
+		outputs.Text("some text").Color(color.RGBA{0xff, 0, 0, 0xff}),
+		outputs.Pango("<b>bold</b> text").MinWidth(100),
+		outputs.Text("short").ShortText("s").Urgent(true),
+	).Segments()
+	var e i3Encoder
+	encode := func() {
+		e.begin()
+		for _, s := range segments {
+			e.segment(s, "1")
+		}
+		e.end()
+	}
+	encode()
+	require.Zero(t, testing.AllocsPerRun(100, encode), "steady state allocations")
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	var segments bar.Segments
+	for i := 0; i < 30; i++ {
+		segments = append(segments, outputs.Text("12.3 MiB/s up | 45.6 KiB/s down").
+			Color(color.RGBA{0x00, 0xff, 0x00, 0xff}).
+			Padding(5))
+	}
+	var e i3Encoder
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.begin()
+		for _, s := range segments {
+			e.segment(s, "")
+		}
+		e.end()
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build debuglog
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Syslog priorities used for the journal's PRIORITY field.
+const (
+	priorityInfo  = 6
+	priorityDebug = 7
+)
+
+var journalSocket = "/run/systemd/journal/socket" // Overridden in tests.
+
+// journal sends log statements to journald using its native protocol.
+type journal struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+var currentJournal atomic.Value // of *journal
+
+func getJournal() *journal {
+	j, _ := currentJournal.Load().(*journal)
+	return j
+}
+
+// Journald sends all subsequent log statements to the systemd journal instead
+// of the output stream, with the calling module (e.g. mod:cpuinfo) in the
+// MODULE field, so that the logs can be filtered using
+// `journalctl --user -u barista MODULE=mod:cpuinfo`. Log is recorded at
+// info priority and Fine at debug priority. If the journal cannot be reached,
+// the error is returned and logging is unchanged.
+func Journald() error {
+	conn, err := net.DialUnix("unixgram", nil,
+		&net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	currentJournal.Store(&journal{
+		conn:       conn,
+		identifier: filepath.Base(os.Args[0]),
+	})
+	return nil
+}
+
+// send writes a single log entry to the journal. Any error (e.g. an entry too
+// large for a datagram) leaves the entry to be logged to the output stream.
+func (j *journal) send(priority int, mod, loc, msg string) error {
+	var buf bytes.Buffer
+	writeField(&buf, "MESSAGE", msg)
+	writeField(&buf, "PRIORITY", strconv.Itoa(priority))
+	writeField(&buf, "MODULE", mod)
+	writeField(&buf, "SYSLOG_IDENTIFIER", j.identifier)
+	if idx := strings.LastIndex(loc, ":"); idx > 0 {
+		writeField(&buf, "CODE_FILE", loc[:idx])
+		writeField(&buf, "CODE_LINE", loc[idx+1:])
+	}
+	_, err := j.conn.Write(buf.Bytes())
+	return err
+}
+
+// writeField writes a field in the journal's native format. Values containing
+// newlines are written as the field name, a newline, the length of the value
+// as a little-endian uint64, and the raw value.
+func writeField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if strings.Contains(value, "\n") {
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	} else {
+		buf.WriteByte('=')
+	}
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
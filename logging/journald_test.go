@@ -0,0 +1,97 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build debuglog
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readEntry reads a single journal entry in the native format.
+func readEntry(t *testing.T, conn *net.UnixConn) map[string]string {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	b := make([]byte, 4096)
+	n, err := conn.Read(b)
+	require.NoError(t, err)
+	buf := bytes.NewBuffer(b[:n])
+	entry := map[string]string{}
+	for buf.Len() > 0 {
+		line, err := buf.ReadBytes('\n')
+		require.NoError(t, err)
+		line = line[:len(line)-1]
+		if idx := bytes.IndexByte(line, '='); idx >= 0 {
+			entry[string(line[:idx])] = string(line[idx+1:])
+			continue
+		}
+		var size uint64
+		require.NoError(t, binary.Read(buf, binary.LittleEndian, &size))
+		entry[string(line)] = string(buf.Next(int(size)))
+		require.Equal(t, byte('\n'), buf.Next(1)[0])
+	}
+	return entry
+}
+
+func TestJournald(t *testing.T) {
+	resetLoggingState()
+	dir, err := ioutil.TempDir("", "journald")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(s string) { journalSocket = s }(journalSocket)
+
+	journalSocket = filepath.Join(dir, "socket")
+	require.Error(t, Journald(), "without journal")
+	Log("not in journal")
+	assertLogged(t, "not in journal")
+
+	addr := &net.UnixAddr{Name: journalSocket, Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, Journald())
+
+	Log("foo: %d", 42)
+	entry := readEntry(t, conn)
+	require.Equal(t, "foo: 42", entry["MESSAGE"])
+	require.Equal(t, "6", entry["PRIORITY"])
+	require.Equal(t, "bar:logging.TestJournald", entry["MODULE"])
+	require.Equal(t, filepath.Base(os.Args[0]), entry["SYSLOG_IDENTIFIER"])
+	require.NotContains(t, entry, "CODE_FILE", "without file flags")
+	require.Empty(t, mockStderr.ReadNow(), "not logged to output")
+
+	SetFlags(log.Lshortfile)
+	fineLogModules = []string{"bar:logging"}
+	Fine("multi\nline")
+	entry = readEntry(t, conn)
+	require.Equal(t, "multi\nline", entry["MESSAGE"])
+	require.Equal(t, "7", entry["PRIORITY"])
+	require.Equal(t, "journald_test.go", entry["CODE_FILE"])
+	require.NotEmpty(t, entry["CODE_LINE"])
+
+	conn.Close()
+	SetFlags(0)
+	Log("journal closed")
+	assertLogged(t, "journal closed")
+}
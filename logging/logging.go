@@ -140,8 +140,11 @@ var logger *log.Logger
 
 // doLog actually logs the given statement, with appropriate file information
 // depending on the currently set flags.
-func doLog(mod, loc string, format string, args ...interface{}) {
+func doLog(priority int, mod, loc string, format string, args ...interface{}) {
 	out := fmt.Sprintf(format, args...)
+	if j := getJournal(); j != nil && j.send(priority, mod, loc, out) == nil {
+		return
+	}
 	fFlags := int(atomic.LoadInt64(&fileFlags))
 	if fFlags != 0 {
 		out = fmt.Sprintf("%s (%s) %s", loc, mod, out)
@@ -164,7 +167,7 @@ func SetFlags(flags int) {
 // Log logs a formatted message.
 func Log(format string, args ...interface{}) {
 	mod, loc := callingModule()
-	doLog(mod, loc, format, args...)
+	doLog(priorityInfo, mod, loc, format, args...)
 }
 
 // Fine logs a formatted message if fine logging is enabled for the
@@ -173,6 +176,6 @@ func Log(format string, args ...interface{}) {
 func Fine(format string, args ...interface{}) {
 	mod, loc := callingModule()
 	if fineLogEnabled(mod) {
-		doLog(mod, loc, format, args...)
+		doLog(priorityDebug, mod, loc, format, args...)
 	}
 }
@@ -39,6 +39,7 @@ func resetLoggingState() {
 	fineLogModules = []string{}
 	objectIDs = map[ident]string{}
 	labels = map[ident]string{}
+	currentJournal.Store((*journal)(nil))
 
 	fineLogModulesCache.Range(func(k, v interface{}) bool {
 		fineLogModulesCache.Delete(k)
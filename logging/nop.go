@@ -35,6 +35,14 @@ func Log(format string, args ...interface{}) {}
 // `--finelog=$module1,$module2`. [Requires debug logging].
 func Fine(format string, args ...interface{}) {}
 
+// Journald sends all subsequent log statements to the systemd journal instead
+// of the output stream, with the calling module (e.g. mod:cpuinfo) in the
+// MODULE field, so that the logs can be filtered using
+// `journalctl --user -u barista MODULE=mod:cpuinfo`. Log is recorded at
+// info priority and Fine at debug priority. If the journal cannot be reached,
+// the error is returned and logging is unchanged. [Requires debug logging].
+func Journald() error { return nil }
+
 // ID returns a unique name for the given value of the form 'type'#'index'
 // for addressable types. This provides log statements with additional
 // context and separates logs from multiple instances of the same type.
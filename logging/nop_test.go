@@ -36,4 +36,5 @@ func TestNopMethods(t *testing.T) {
 	Attach(t, 4, "->int")
 	Attachf(t, 1.0, "->float:%g", 1.0)
 	Register(t, "Fail", "FailNow")
+	require.NoError(t, Journald())
 }
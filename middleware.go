@@ -0,0 +1,124 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"time"
+
+	"barista.run/bar"
+	l "barista.run/logging"
+	"barista.run/outputs"
+)
+
+// Middleware post-processes the output of a module before it is shown on the
+// bar, e.g. to strip colours, add separators, or enforce a maximum width.
+type Middleware func(bar.Output) bar.Output
+
+// Wrap returns a module that applies the given middleware, in order, to each
+// output of the given module. Timed outputs remain timed, with the middleware
+// applied to each frame, and transient outputs remain transient. If the module
+// can be refreshed, so can the returned module.
+func Wrap(module bar.Module, middleware ...Middleware) bar.Module {
+	w := &wrappedModule{module, middleware}
+	l.Label(w, l.ID(module))
+	if _, ok := module.(bar.RefresherModule); ok {
+		return &wrappedRefresher{w}
+	}
+	return w
+}
+
+// Use adds middleware that is applied to the output of every module on the
+// bar, after any middleware the module was wrapped with. The middleware is
+// applied each time the bar is printed, skipping modules without any output,
+// and it receives a copy of the module's output, so it is free to modify the
+// segments.
+func Use(middleware ...Middleware) {
+	construct()
+	instance.Lock()
+	defer instance.Unlock()
+	instance.middleware = append(instance.middleware, middleware...)
+}
+
+type wrappedModule struct {
+	bar.Module
+	middleware []Middleware
+}
+
+func (w *wrappedModule) Stream(sink bar.Sink) {
+	w.Module.Stream(func(o bar.Output) { sink(w.process(o)) })
+}
+
+// process applies the middleware to an output, keeping timed and transient
+// outputs timed and transient.
+func (w *wrappedModule) process(o bar.Output) bar.Output {
+	var out bar.Output
+	if t, ok := o.(bar.TimedOutput); ok {
+		out = timedMiddlewareOutput{t, w.middleware}
+	} else {
+		out = applyMiddleware(o, w.middleware)
+	}
+	if t, ok := o.(bar.TransientOutput); ok {
+		out = outputs.Transient(out, t.TransientDuration())
+	}
+	return out
+}
+
+type wrappedRefresher struct {
+	*wrappedModule
+}
+
+func (w *wrappedRefresher) Refresh() {
+	w.Module.(bar.RefresherModule).Refresh()
+}
+
+// timedMiddlewareOutput applies middleware to each frame of a timed output.
+type timedMiddlewareOutput struct {
+	bar.TimedOutput
+	middleware []Middleware
+}
+
+func (t timedMiddlewareOutput) Segments() []*bar.Segment {
+	return toSegments(applyMiddleware(bar.Segments(t.TimedOutput.Segments()), t.middleware))
+}
+
+func (t timedMiddlewareOutput) NextRefresh() time.Time {
+	return t.TimedOutput.NextRefresh()
+}
+
+func applyMiddleware(o bar.Output, middleware []Middleware) bar.Output {
+	for _, m := range middleware {
+		o = m(o)
+	}
+	return o
+}
+
+func toSegments(o bar.Output) bar.Segments {
+	if o == nil {
+		return nil
+	}
+	return o.Segments()
+}
+
+// transform applies the bar's middleware to a copy of a module's output.
+func (b *i3Bar) transform(segments bar.Segments) bar.Segments {
+	if len(b.middleware) == 0 || len(segments) == 0 {
+		return segments
+	}
+	cp := make(bar.Segments, len(segments))
+	for i, s := range segments {
+		cp[i] = s.Clone()
+	}
+	return toSegments(applyMiddleware(cp, b.middleware))
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	"barista.run/testing/mockio"
+	testModule "barista.run/testing/module"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func upper(o bar.Output) bar.Output {
+	var out bar.Segments
+	for _, s := range o.Segments() {
+		txt, _ := s.Content()
+		out = append(out, s.Clone().Text(strings.ToUpper(txt)))
+	}
+	return out
+}
+
+func suffix(sfx string) Middleware {
+	return func(o bar.Output) bar.Output {
+		return outputs.Group(o, outputs.Text(sfx))
+	}
+}
+
+func texts(o bar.Output) []string {
+	var txts []string
+	for _, s := range o.Segments() {
+		txt, _ := s.Content()
+		txts = append(txts, txt)
+	}
+	return txts
+}
+
+type refreshModule struct {
+	*testModule.TestModule
+	refreshed chan bool
+}
+
+func (r refreshModule) Refresh() { r.refreshed <- true }
+
+func TestWrap(t *testing.T) {
+	timing.TestMode()
+	defer timing.ExitTestMode()
+	tm := testModule.New(t).SkipClickHandlers()
+	w := Wrap(tm, upper, suffix("!"))
+	_, isRefresher := w.(bar.RefresherModule)
+	require.False(t, isRefresher, "only refreshable if wrapped module is")
+
+	outs := make(chan bar.Output, 10)
+	go w.Stream(func(o bar.Output) { outs <- o })
+	tm.AssertStarted()
+
+	tm.OutputText("foo")
+	require.Equal(t, []string{"FOO", "!"}, texts(<-outs), "middleware applied in order")
+
+	start := timing.Now()
+	tm.Output(outputs.Repeat(func(now time.Time) bar.Output {
+		return outputs.Textf("t+%v", now.Sub(start))
+	}).Every(time.Second))
+	out := <-outs
+	timed, ok := out.(bar.TimedOutput)
+	require.True(t, ok, "timed output remains timed")
+	require.Equal(t, []string{"T+0S", "!"}, texts(timed))
+	require.Equal(t, start.Add(time.Second), timed.NextRefresh())
+	timing.AdvanceBy(time.Second)
+	require.Equal(t, []string{"T+1S", "!"}, texts(timed), "applied to each frame")
+
+	tm.Output(outputs.Transient(outputs.Text("bar"), time.Second))
+	transient, ok := (<-outs).(bar.TransientOutput)
+	require.True(t, ok, "transient output remains transient")
+	require.Equal(t, time.Second, transient.TransientDuration())
+	require.Equal(t, []string{"BAR", "!"}, texts(transient))
+
+	r := refreshModule{testModule.New(t), make(chan bool, 1)}
+	wr, isRefresher := Wrap(r, upper).(bar.RefresherModule)
+	require.True(t, isRefresher)
+	wr.Refresh()
+	require.True(t, <-r.refreshed, "refresh passed to wrapped module")
+}
+
+func TestUse(t *testing.T) {
+	mockStdin := mockio.Stdin()
+	mockStdout := mockio.Stdout()
+	TestMode(mockStdin, mockStdout)
+	inPlace := func(o bar.Output) bar.Output {
+		for _, s := range o.Segments() {
+			txt, _ := s.Content()
+			s.Text(txt + "?")
+		}
+		return o
+	}
+	Use(inPlace, suffix("|"))
+
+	module1 := testModule.New(t)
+	module2 := testModule.New(t)
+	go Run(Wrap(module1, upper), module2)
+	_, err := mockStdout.ReadUntil('[', time.Second)
+	require.Nil(t, err, "output array started without any errors")
+	module1.AssertStarted()
+	module2.AssertStarted()
+
+	module1.OutputText("foo")
+	require.Equal(t, []string{"FOO?", "|"}, readOutputTexts(t, mockStdout))
+	module2.OutputText("bar")
+	require.Equal(t, []string{"FOO?", "|", "bar?", "|"}, readOutputTexts(t, mockStdout),
+		"middleware does not modify cached output")
+}
@@ -0,0 +1,356 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package authwatch provides a bar module that follows the system journal or
+// an auth log for authentication failures and fail2ban bans, and shows how
+// many occurred recently.
+package authwatch // import "barista.run/modules/authwatch"
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/colors"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Kind represents the type of an event.
+type Kind int
+
+// Types of events.
+const (
+	// Failure is a failed authentication attempt, e.g. a wrong SSH or sudo
+	// password.
+	Failure Kind = iota
+	// Ban is an address banned by fail2ban.
+	Ban
+)
+
+// Event represents a single authentication failure or ban.
+type Event struct {
+	Time time.Time
+	Kind Kind
+	// Service is the program that logged the failure, e.g. "sshd" or "sudo",
+	// or the fail2ban jail for bans.
+	Service string
+	// User is the user that failed to authenticate, if known.
+	User string
+	// Source is the remote address, if known.
+	Source string
+}
+
+// Info represents the events within the module's window.
+type Info struct {
+	Failures []Event
+	Bans     []Event
+	// Threshold is the number of failures above which the count is
+	// considered too high.
+	Threshold int
+}
+
+// Exceeded returns true if the number of failures exceeds the threshold.
+func (i Info) Exceeded() bool {
+	return len(i.Failures) > i.Threshold
+}
+
+// Sources returns the distinct remote addresses of all failures, in the order
+// they first appeared.
+func (i Info) Sources() []string {
+	seen := map[string]bool{}
+	var r []string
+	for _, e := range i.Failures {
+		if e.Source != "" && !seen[e.Source] {
+			seen[e.Source] = true
+			r = append(r, e.Source)
+		}
+	}
+	return r
+}
+
+// Module represents a bar module that shows recent authentication failures.
+type Module struct {
+	cmd        []string
+	parseTime  func(string) (time.Time, string, bool)
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	threshold  value.Value     // of int
+	window     value.Value     // of time.Duration
+	scheduler  *timing.Scheduler
+}
+
+// Journal constructs a module that follows the systemd journal. Reading
+// authentication messages usually requires membership of the
+// systemd-journal or adm groups.
+func Journal() *Module {
+	return newModule(parseUnixTime, "journalctl", "--follow", "--output=short-unix",
+		"--since=-1d", "--no-tail", "--quiet")
+}
+
+// File constructs a module that follows a syslog file, e.g. /var/log/auth.log
+// or /var/log/secure.
+func File(path string) *Module {
+	m := newModule(parseSyslogTime, "tail", "--follow=name", "--retry",
+		"--lines=5000", path)
+	l.Label(m, path)
+	return m
+}
+
+func newModule(parseTime func(string) (time.Time, string, bool), cmd ...string) *Module {
+	m := &Module{
+		cmd:       cmd,
+		parseTime: parseTime,
+		scheduler: timing.NewScheduler(),
+	}
+	l.Register(m, "outputFunc", "threshold", "window", "scheduler")
+	m.Threshold(10)
+	m.Window(time.Hour)
+	m.Output(func(i Info) bar.Output {
+		if len(i.Failures) == 0 && len(i.Bans) == 0 {
+			return nil
+		}
+		out := outputs.Textf("AUTH %d", len(i.Failures))
+		if len(i.Bans) > 0 {
+			out = outputs.Textf("AUTH %d, %d banned", len(i.Failures), len(i.Bans))
+		}
+		if i.Exceeded() {
+			out.Color(colors.Scheme("bad")).Urgent(true)
+		}
+		return out
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Threshold sets the number of failures within the window above which the
+// default output is marked urgent.
+func (m *Module) Threshold(failures int) *Module {
+	m.threshold.Set(failures)
+	return m
+}
+
+// Window sets how long events are counted for. Windows longer than a day
+// are only fully counted for the journal if the module runs for that long.
+func (m *Module) Window(window time.Duration) *Module {
+	m.window.Set(window)
+	return m
+}
+
+// Overridden in tests.
+var execCommand = exec.Command
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	cmd := execCommand(m.cmd[0], m.cmd[1:]...)
+	// Prevent SIGUSR for bar pause/resume from propagating to the
+	// child process, as in shell.Tail.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, err := cmd.StdoutPipe()
+	if sink.Error(err) {
+		return
+	}
+	if sink.Error(cmd.Start()) {
+		return
+	}
+	defer cmd.Process.Kill()
+	lines := make(chan string, 100)
+	errCh := make(chan error, 1)
+	go func() {
+		s := bufio.NewScanner(stdout)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		err := cmd.Wait()
+		if err == nil {
+			err = fmt.Errorf("%s exited", m.cmd[0])
+		}
+		errCh <- err
+	}()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextThreshold, done := m.threshold.Subscribe()
+	defer done()
+	nextWindow, done := m.window.Subscribe()
+	defer done()
+
+	var events []Event
+	for {
+		window := m.window.Get().(time.Duration)
+		events = prune(events, timing.Now().Add(-window))
+		if len(events) > 0 {
+			m.scheduler.At(events[0].Time.Add(window))
+		} else {
+			m.scheduler.Stop()
+		}
+		i := Info{Threshold: m.threshold.Get().(int)}
+		for _, e := range events {
+			if e.Kind == Ban {
+				i.Bans = append(i.Bans, e)
+			} else {
+				i.Failures = append(i.Failures, e)
+			}
+		}
+		sink.Output(outputFunc(i))
+
+		added := false
+		for !added {
+			select {
+			case line := <-lines:
+				if e, ok := m.parse(line); ok && e.Time.After(timing.Now().Add(-window)) {
+					events = insert(events, e)
+					added = true
+				}
+			case err := <-errCh:
+				sink.Error(err)
+				return
+			case <-m.scheduler.C:
+				added = true
+			case <-nextThreshold:
+				added = true
+			case <-nextWindow:
+				added = true
+			case <-nextOutputFunc:
+				outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+				added = true
+			}
+		}
+	}
+}
+
+// prune removes events from before the given time.
+func prune(events []Event, since time.Time) []Event {
+	for len(events) > 0 && !events[0].Time.After(since) {
+		events = events[1:]
+	}
+	return events
+}
+
+// insert adds an event, keeping events ordered by time. Events are usually
+// read in order, so this is searched from the end.
+func insert(events []Event, e Event) []Event {
+	i := len(events)
+	for i > 0 && events[i-1].Time.After(e.Time) {
+		i--
+	}
+	events = append(events, Event{})
+	copy(events[i+1:], events[i:])
+	events[i] = e
+	return events
+}
+
+var (
+	// Logged by sshd for each failed attempt by a valid user.
+	sshFailed = regexp.MustCompile(`sshd(?:-session)?\[\d+\]: Failed \S+ for (\S+) from (\S+)`)
+	// Logged by sshd once per connection by an invalid user. Attempts for
+	// invalid users ("Failed password for invalid user") are not counted
+	// separately.
+	sshInvalid = regexp.MustCompile(`sshd(?:-session)?\[\d+\]: Invalid user (\S*) from (\S+)`)
+	// Logged by PAM for sudo, su, login, screen lockers, etc. Failures for
+	// sshd are already counted above.
+	pamFailure = regexp.MustCompile(`pam_unix\(([^:)]+):auth\): authentication failure;(.*)`)
+	pamRhost   = regexp.MustCompile(` rhost=(\S+)`)
+	pamUser    = regexp.MustCompile(` user=(\S+)`)
+	f2bBan     = regexp.MustCompile(`fail2ban\.actions.*\[(\S+)\] Ban (\S+)`)
+)
+
+// parse parses a log line, returning false if it is not a failure or ban.
+func (m *Module) parse(line string) (Event, bool) {
+	t, msg, ok := m.parseTime(line)
+	if !ok {
+		return Event{}, false
+	}
+	if match := sshFailed.FindStringSubmatch(msg); match != nil {
+		if match[1] == "invalid" {
+			return Event{}, false
+		}
+		return Event{Time: t, Kind: Failure, Service: "sshd", User: match[1], Source: match[2]}, true
+	}
+	if match := sshInvalid.FindStringSubmatch(msg); match != nil {
+		return Event{Time: t, Kind: Failure, Service: "sshd", User: match[1], Source: match[2]}, true
+	}
+	if match := pamFailure.FindStringSubmatch(msg); match != nil {
+		if match[1] == "sshd" {
+			return Event{}, false
+		}
+		e := Event{Time: t, Kind: Failure, Service: match[1]}
+		if sub := pamRhost.FindStringSubmatch(match[2]); sub != nil {
+			e.Source = sub[1]
+		}
+		if sub := pamUser.FindStringSubmatch(match[2]); sub != nil {
+			e.User = sub[1]
+		}
+		return e, true
+	}
+	if match := f2bBan.FindStringSubmatch(msg); match != nil {
+		return Event{Time: t, Kind: Ban, Service: match[1], Source: match[2]}, true
+	}
+	return Event{}, false
+}
+
+// parseUnixTime parses journalctl's short-unix output, which starts with
+// the fractional unix time of the entry.
+func parseUnixTime(line string) (time.Time, string, bool) {
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) < 2 {
+		return time.Time{}, "", false
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))), fields[1], true
+}
+
+// parseSyslogTime parses the timestamp of a syslog line, either RFC 3339
+// (as used by recent rsyslog defaults) or the traditional format, which
+// omits the year and is in local time.
+func parseSyslogTime(line string) (time.Time, string, bool) {
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) == 2 {
+		if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+			return t, fields[1], true
+		}
+	}
+	const stamp = "Jan _2 15:04:05"
+	if len(line) <= len(stamp) {
+		return time.Time{}, "", false
+	}
+	now := timing.Now()
+	t, err := time.ParseInLocation(stamp, line[:len(stamp)], now.Location())
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		// Logged last year, e.g. a December entry read in January.
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, strings.TrimSpace(line[len(stamp):]), true
+}
@@ -0,0 +1,179 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authwatch
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2018, 10, 1, 9, 0, 0, 0, time.UTC)
+
+// fakeLog replaces the log command with cat, reading from a pipe that the
+// test writes log lines to.
+func fakeLog(t *testing.T) (w io.WriteCloser, args chan []string) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	args = make(chan []string, 1)
+	execCommand = func(name string, arg ...string) *exec.Cmd {
+		args <- append([]string{name}, arg...)
+		cmd := exec.Command("cat")
+		cmd.Stdin = r
+		return cmd
+	}
+	return w, args
+}
+
+func journal(w io.Writer, t time.Time, msg string) {
+	fmt.Fprintf(w, "%d.%06d myhost %s\n", t.Unix(), t.Nanosecond()/1000, msg)
+}
+
+func TestJournal(t *testing.T) {
+	testBar.New(t)
+	timing.AdvanceTo(start)
+	w, args := fakeLog(t)
+	defer w.Close()
+
+	testBar.Run(Journal().Threshold(2))
+	require.Equal(t, "journalctl", (<-args)[0])
+	testBar.NextOutput("on start").AssertEmpty()
+
+	journal(w, start.Add(-2*time.Hour), "sshd[100]: Failed password for root from 198.51.100.1 port 22 ssh2")
+	journal(w, start.Add(-30*time.Minute), "sshd[100]: Failed password for root from 198.51.100.1 port 22 ssh2")
+	out := testBar.NextOutput("on failure")
+	out.AssertText([]string{"AUTH 1"}, "ignores entries outside window")
+
+	journal(w, start.Add(-20*time.Minute), "systemd[1]: Started Session 2 of user alice.")
+	journal(w, start.Add(-10*time.Minute), "sshd[101]: Invalid user admin from 203.0.113.9 port 4242")
+	journal(w, start.Add(-10*time.Minute), "sshd[101]: Failed password for invalid user admin from 203.0.113.9 port 4242 ssh2")
+	testBar.NextOutput("on invalid user").AssertText([]string{"AUTH 2"},
+		"counts invalid users once")
+
+	journal(w, start.Add(-5*time.Minute), "fail2ban.actions[50]: NOTICE [sshd] Ban 203.0.113.9")
+	out = testBar.NextOutput("on ban")
+	out.AssertText([]string{"AUTH 2, 1 banned"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent, "at threshold")
+
+	journal(w, start.Add(-time.Minute), "sudo[200]: pam_unix(sudo:auth): authentication failure; "+
+		"logname=alice uid=1000 euid=0 tty=/dev/pts/0 ruser=alice rhost=  user=alice")
+	journal(w, start.Add(-time.Minute), "sshd[102]: pam_unix(sshd:auth): authentication failure; "+
+		"logname= uid=0 euid=0 tty=ssh ruser= rhost=198.51.100.1  user=root")
+	out = testBar.NextOutput("on sudo failure")
+	out.AssertText([]string{"AUTH 3, 1 banned"}, "sshd PAM failures not counted twice")
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "above threshold")
+	col, _ := out.At(0).Segment().GetColor()
+	require.Equal(t, colors.Scheme("bad"), col)
+
+	require.WithinDuration(t, start.Add(30*time.Minute), testBar.Tick(), 0)
+	testBar.NextOutput("first failure expires").AssertText([]string{"AUTH 2, 1 banned"})
+	require.WithinDuration(t, start.Add(50*time.Minute), testBar.Tick(), 0)
+	testBar.NextOutput("invalid user expires").AssertText([]string{"AUTH 1, 1 banned"})
+	require.WithinDuration(t, start.Add(55*time.Minute), testBar.Tick(), 0)
+	testBar.NextOutput("ban expires").AssertText([]string{"AUTH 1"})
+	require.WithinDuration(t, start.Add(59*time.Minute), testBar.Tick(), 0)
+	testBar.NextOutput("all expired").AssertEmpty()
+
+	w.Close()
+	testBar.NextOutput("on exit").AssertError()
+}
+
+func TestFile(t *testing.T) {
+	testBar.New(t)
+	timing.AdvanceTo(start)
+	w, args := fakeLog(t)
+	defer w.Close()
+
+	m := File("/var/log/auth.log").Window(24 * time.Hour).Output(func(i Info) bar.Output {
+		out := outputs.Group()
+		for _, e := range i.Failures {
+			out.Append(outputs.Textf("%s %s %s@%s", e.Time.Format("Jan 2 15:04"), e.Service, e.User, e.Source))
+		}
+		return out.Append(outputs.Textf("%v %v", i.Sources(), i.Exceeded()))
+	})
+	testBar.Run(m)
+	a := <-args
+	require.Equal(t, "tail", a[0])
+	require.Equal(t, "/var/log/auth.log", a[len(a)-1])
+	testBar.NextOutput("on start").AssertText([]string{"[] false"})
+
+	fmt.Fprintln(w, "Sep 30 23:00:00 myhost sshd[100]: Failed publickey for git from 198.51.100.1 port 22 ssh2")
+	testBar.NextOutput("on failure").AssertText([]string{
+		"Sep 30 23:00 sshd git@198.51.100.1",
+		"[198.51.100.1] false",
+	})
+
+	fmt.Fprintln(w, "Dec 31 23:00:00 myhost sshd[99]: Failed password for root from 192.0.2.1 port 22 ssh2")
+	fmt.Fprintln(w, "2018-10-01T08:30:00.123456+00:00 myhost su[300]: pam_unix(su:auth): authentication failure; "+
+		"logname=alice uid=1000 euid=0 tty=pts/1 ruser=alice rhost=  user=root")
+	testBar.NextOutput("on rfc3339 line").AssertText([]string{
+		"Sep 30 23:00 sshd git@198.51.100.1",
+		"Oct 1 08:30 su root@",
+		"[198.51.100.1] false",
+	}, "entries from last year are outside the window")
+
+	fmt.Fprintln(w, "Oct  1 08:00:00 myhost sshd-session[101]: Failed password for alice from 2001:db8::1 port 22 ssh2")
+	testBar.NextOutput("on out of order line").AssertText([]string{
+		"Sep 30 23:00 sshd git@198.51.100.1",
+		"Oct 1 08:00 sshd alice@2001:db8::1",
+		"Oct 1 08:30 su root@",
+		"[198.51.100.1 2001:db8::1] false",
+	})
+
+	m.Threshold(2)
+	testBar.NextOutput("on threshold change").AssertText([]string{
+		"Sep 30 23:00 sshd git@198.51.100.1",
+		"Oct 1 08:00 sshd alice@2001:db8::1",
+		"Oct 1 08:30 su root@",
+		"[198.51.100.1 2001:db8::1] true",
+	})
+
+	m.Window(time.Hour)
+	testBar.NextOutput("on window change").AssertText([]string{
+		"Oct 1 08:30 su root@",
+		"[] false",
+	})
+}
+
+func TestParse(t *testing.T) {
+	m := Journal()
+	for _, line := range []string{
+		"",
+		"garbage",
+		"notatime host sshd[1]: Failed password for root from 192.0.2.1 port 22 ssh2",
+		"1538384400.000000 host sshd[1]: Accepted publickey for alice from 192.0.2.1 port 22 ssh2",
+		"1538384400.000000 host fail2ban.actions[1]: NOTICE [sshd] Unban 192.0.2.1",
+	} {
+		_, ok := m.parse(line)
+		require.False(t, ok, "parse(%q)", line)
+	}
+	_, _, ok := parseSyslogTime("Oct  1")
+	require.False(t, ok, "short line")
+	_, _, ok = parseSyslogTime("Foo  1 08:00:00 host sshd[1]: message")
+	require.False(t, ok, "invalid time")
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backup provides a bar module that shows the age of the last
+// successful backup, from a restic or borg repository or a systemd timer that
+// runs backups, and marks the output urgent when a backup is overdue.
+package backup // import "barista.run/modules/backup"
+
+import (
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/core"
+	"barista.run/format"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents the state of backups from a single source.
+type Info struct {
+	// Source is the name of the backup source, e.g. "restic", "borg", or the
+	// name of the systemd timer.
+	Source string
+	// Last is the time of the last successful backup, or zero if there has
+	// never been one. For systemd timers, this is the last time the timer was
+	// triggered.
+	Last time.Time
+	// Running is true if a backup is currently in progress.
+	Running bool
+	// Failed is true if the most recent backup failed. Only systemd timers
+	// report failures, since repositories only record successful backups.
+	Failed bool
+
+	overdue time.Duration
+}
+
+// Age returns the time elapsed since the last successful backup.
+func (i Info) Age() time.Duration {
+	if i.Last.IsZero() {
+		return 0
+	}
+	return timing.Now().Sub(i.Last)
+}
+
+// Overdue returns true if there has never been a backup, or the last backup is
+// older than the threshold configured on the module.
+func (i Info) Overdue() bool {
+	return i.Last.IsZero() || i.Age() > i.overdue
+}
+
+// source is a place where backups are recorded.
+type source interface {
+	name() string
+	// watch starts watching the source for changes, which are signalled on
+	// the returned channel, and returns a function to stop watching. Sources
+	// that can only be polled return a nil channel.
+	watch() (<-chan struct{}, func())
+	// info returns the current state of backups. Only Last, Running, and
+	// Failed need to be filled in.
+	info() (Info, error)
+}
+
+// Module represents a bar module that shows the age of the last backup.
+type Module struct {
+	source     source
+	overdue    value.Value     // of time.Duration
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+func newModule(src source, interval time.Duration) *Module {
+	m := &Module{
+		source:    src,
+		scheduler: timing.NewScheduler().Every(interval),
+	}
+	l.Label(m, src.name())
+	l.Register(m, "outputFunc", "scheduler")
+	m.Overdue(24 * time.Hour)
+	m.Output(func(i Info) bar.Output {
+		switch {
+		case i.Running:
+			return outputs.Text("BAK running")
+		case i.Last.IsZero():
+			return outputs.Text("BAK never").Urgent(true)
+		}
+		return outputs.Textf("BAK %s", format.Duration(i.Age())).
+			Urgent(i.Failed || i.Overdue())
+	})
+	return m
+}
+
+// Overdue sets the age after which the last backup is considered overdue.
+// The default is 24 hours.
+func (m *Module) Overdue(after time.Duration) *Module {
+	m.overdue.Set(after)
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency for the backup source.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextOverdue, doneOverdue := m.overdue.Subscribe()
+	defer doneOverdue()
+	updates, stop := m.source.watch()
+	defer stop()
+
+	info, err := m.getInfo()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info, err = m.getInfo()
+		case <-updates:
+			info, err = m.getInfo()
+		case <-nextOverdue:
+			info.overdue = m.overdue.Get().(time.Duration)
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func (m *Module) getInfo() (Info, error) {
+	i, err := m.source.info()
+	i.Source = m.source.name()
+	i.overdue = m.overdue.Get().(time.Duration)
+	return i, err
+}
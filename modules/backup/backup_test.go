@@ -0,0 +1,111 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/testing/fakeexec"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	execCommand = fakeexec.Command
+}
+
+func resticSnapshots(times ...time.Time) string {
+	var snapshots []string
+	for _, t := range times {
+		snapshots = append(snapshots,
+			fmt.Sprintf(`{"time":%q,"hostname":"host"}`, t.Format(time.RFC3339Nano)))
+	}
+	return "[" + strings.Join(snapshots, ",") + "]"
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	f := fakeexec.New()
+	f.Set("restic", resticSnapshots(now.Add(-3*time.Hour)), "", 0)
+
+	m := Restic()
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"BAK 3h0m"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	m.Overdue(2 * time.Hour)
+	out = testBar.NextOutput("on overdue change")
+	out.AssertText([]string{"BAK 3h0m"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "when overdue")
+
+	f.Set("restic", resticSnapshots(now.Add(10*time.Minute)), "", 0)
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"BAK 20m0s"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.False(t, urgent, "after new backup")
+
+	m.Output(func(i Info) bar.Output {
+		if i.Last.IsZero() {
+			return outputs.Textf("%s: none", i.Source)
+		}
+		return outputs.Textf("%s: %v, overdue:%v", i.Source,
+			i.Last.Sub(now), i.Overdue())
+	})
+	testBar.NextOutput("on output func change").AssertText(
+		[]string{"restic: 10m0s, overdue:false"})
+
+	f.Set("restic", "[]", "", 0)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"restic: none"})
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	f := fakeexec.New()
+	f.Set("restic", "[]", "", 0)
+
+	testBar.Run(Restic())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"BAK never"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent)
+}
+
+func TestInfo(t *testing.T) {
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	i := Info{overdue: time.Hour}
+	require.Equal(t, time.Duration(0), i.Age())
+	require.True(t, i.Overdue(), "without any backups")
+
+	i.Last = now.Add(-30 * time.Minute)
+	require.Equal(t, 30*time.Minute, i.Age())
+	require.False(t, i.Overdue())
+
+	i.Last = now.Add(-90 * time.Minute)
+	require.True(t, i.Overdue())
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"time"
+
+	"barista.run/base/run"
+	"barista.run/base/watchers/localtz"
+)
+
+// Overridden in tests.
+var execCommand run.Runner = exec.Command
+
+// Restic constructs a backup module for a restic repository. The arguments
+// are passed to restic, e.g. "-r", "sftp:host:/backups", and the repository
+// password and any other settings are read from the usual RESTIC_*
+// environment variables. Since listing snapshots can be slow for remote
+// repositories, it is only done every 30 minutes by default.
+func Restic(args ...string) *Module {
+	return newModule(&restic{args: args}, 30*time.Minute)
+}
+
+type restic struct {
+	args []string
+}
+
+func (r *restic) name() string { return "restic" }
+
+func (r *restic) watch() (<-chan struct{}, func()) { return nil, func() {} }
+
+func (r *restic) info() (Info, error) {
+	// --no-lock allows listing snapshots while a backup is in progress.
+	args := append([]string{"--no-lock", "snapshots", "--json", "--latest", "1"}, r.args...)
+	out, err := execCommand.Output("restic", args...)
+	if err != nil {
+		return Info{}, err
+	}
+	var snapshots []struct {
+		Time time.Time `json:"time"`
+	}
+	if err := json.Unmarshal(out, &snapshots); err != nil {
+		return Info{}, err
+	}
+	i := Info{}
+	// --latest returns the latest snapshot for each host and set of paths.
+	for _, s := range snapshots {
+		if s.Time.After(i.Last) {
+			i.Last = s.Time
+		}
+	}
+	return i, nil
+}
+
+// Borg constructs a backup module for a borg repository. Any additional
+// arguments are passed to borg, and the passphrase is read from the usual
+// BORG_* environment variables. Like restic, the repository is only checked
+// every 30 minutes by default.
+func Borg(repo string, args ...string) *Module {
+	return newModule(&borg{repo: repo, args: args}, 30*time.Minute)
+}
+
+type borg struct {
+	repo string
+	args []string
+	last time.Time
+}
+
+func (b *borg) name() string { return "borg" }
+
+func (b *borg) watch() (<-chan struct{}, func()) { return nil, func() {} }
+
+// borgTimeFormat is the format of archive times in borg's JSON output, which
+// are in local time.
+const borgTimeFormat = "2006-01-02T15:04:05.999999"
+
+func (b *borg) info() (Info, error) {
+	args := append([]string{"list", "--json", "--last", "1"}, b.args...)
+	out, err := execCommand.Output("borg", append(args, b.repo)...)
+	if err != nil {
+		// The repository is locked while borg create is running.
+		if strings.Contains(err.Error(), "Failed to create/acquire the lock") {
+			return Info{Last: b.last, Running: true}, nil
+		}
+		return Info{}, err
+	}
+	var list struct {
+		Archives []struct {
+			Time string `json:"time"`
+		} `json:"archives"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return Info{}, err
+	}
+	i := Info{}
+	for _, a := range list.Archives {
+		t, err := time.ParseInLocation(borgTimeFormat, a.Time, localtz.Get())
+		if err != nil {
+			return Info{}, err
+		}
+		if t.After(i.Last) {
+			i.Last = t
+		}
+	}
+	b.last = i.Last
+	return i, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/localtz"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/testing/fakeexec"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestic(t *testing.T) {
+	testBar.New(t)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	f := fakeexec.New()
+	f.Set("restic", resticSnapshots(
+		now.Add(-5*time.Hour),
+		now.Add(-90*time.Minute),
+		now.Add(-48*time.Hour),
+	), "", 0)
+
+	testBar.Run(Restic("-r", "/backups"))
+	testBar.NextOutput("on start").AssertText([]string{"BAK 1h30m"},
+		"uses the latest snapshot across hosts and paths")
+	require.Equal(t, []string{"restic", "--no-lock", "snapshots",
+		"--json", "--latest", "1", "-r", "/backups"}, f.Last())
+
+	f.Set("restic", "", "Fatal: wrong password or no key found", 1)
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+
+	testBar.New(t)
+	f.Set("restic", "not json", "", 0)
+	testBar.Run(Restic())
+	testBar.NextOutput("on invalid output").AssertError()
+}
+
+func TestBorg(t *testing.T) {
+	testBar.New(t)
+	localtz.SetForTest(time.FixedZone("UTC+2", 2*60*60))
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	f := fakeexec.New()
+	last := now.Add(-26 * time.Hour).In(localtz.Get()).Format(borgTimeFormat)
+	f.Set("borg", `{"archives":[{"name":"host-2018-05-31","time":"`+last+`"}]}`, "", 0)
+
+	m := Borg("ssh://host/./backups", "--remote-path", "borg1")
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"BAK 1d2h"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "when overdue")
+	require.Equal(t, []string{"borg", "list", "--json", "--last", "1",
+		"--remote-path", "borg1", "ssh://host/./backups"}, f.Last())
+
+	f.Set("borg", "", "Failed to create/acquire the lock /backups/lock.exclusive (timeout).", 2)
+	testBar.Tick()
+	out = testBar.NextOutput("while locked")
+	out.AssertText([]string{"BAK running"})
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%v %v", i.Last.Equal(now.Add(-26*time.Hour)), i.Running)
+	})
+	testBar.NextOutput("on output change").AssertText([]string{"true true"},
+		"keeps the last backup time while locked")
+
+	f.Set("borg", `{"archives":[{"time":"yesterday"}]}`, "", 0)
+	testBar.Tick()
+	testBar.NextOutput("on invalid time").AssertError()
+
+	testBar.New(t)
+	f.Set("borg", "", "", 2)
+	testBar.Run(Borg("/backups"))
+	out = testBar.NextOutput("on failure without message")
+	errs := out.AssertError()
+	require.Equal(t, "borg: exit status 2", errs[0])
+}
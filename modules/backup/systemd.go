@@ -0,0 +1,117 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"time"
+
+	"barista.run/base/watchers/dbus"
+
+	systemdbus "github.com/coreos/go-systemd/dbus"
+)
+
+// SystemdTimer constructs a backup module for a systemd timer that runs
+// backups, e.g. "restic-backups-home" for a timer created by the NixOS restic
+// module. The last backup is the last time the timer was triggered, and the
+// backup is marked failed if the service it triggers has failed.
+func SystemdTimer(name string) *Module {
+	return newModule(&systemdTimer{unit: name}, time.Minute)
+}
+
+// busType is replaced in tests.
+var busType = dbus.System
+
+const (
+	systemdService = "org.freedesktop.systemd1"
+	timerIface     = "org.freedesktop.systemd1.Timer"
+	unitIface      = "org.freedesktop.systemd1.Unit"
+)
+
+type systemdTimer struct {
+	unit    string
+	timer   *dbus.PropertiesWatcher
+	service *dbus.PropertiesWatcher
+}
+
+func (s *systemdTimer) name() string { return s.unit }
+
+func unitPath(unitName string) string {
+	return "/org/freedesktop/systemd1/unit/" + systemdbus.PathBusEscape(unitName)
+}
+
+func (s *systemdTimer) watch() (<-chan struct{}, func()) {
+	s.timer = dbus.WatchProperties(busType,
+		systemdService, unitPath(s.unit+".timer"), timerIface).
+		Add("LastTriggerUSec", "Unit")
+	service, _ := s.timer.Get()["Unit"].(string)
+	if service == "" {
+		service = s.unit + ".service"
+	}
+	s.service = dbus.WatchProperties(busType,
+		systemdService, unitPath(service), unitIface).
+		Add("ActiveState")
+
+	// Skip the initial values, since the module fetches them when it starts.
+	for _, w := range []*dbus.PropertiesWatcher{s.timer, s.service} {
+		select {
+		case <-w.Updates:
+		default:
+		}
+	}
+
+	updates := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case updates <- struct{}{}:
+		default:
+		}
+	}
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-s.timer.Updates:
+				notify()
+			case <-s.service.Updates:
+				notify()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return updates, func() {
+		close(stop)
+		s.timer.Unsubscribe()
+		s.service.Unsubscribe()
+	}
+}
+
+func (s *systemdTimer) info() (Info, error) {
+	i := Info{}
+	usec, _ := s.timer.Get()["LastTriggerUSec"].(uint64)
+	if usec > 0 {
+		i.Last = time.Unix(0, int64(usec)*int64(time.Microsecond))
+	}
+	// Backup services are usually oneshot, so they are only activating while
+	// the backup is running.
+	state, _ := s.service.Get()["ActiveState"].(string)
+	switch state {
+	case "activating", "deactivating":
+		i.Running = true
+	case "failed":
+		i.Failed = true
+	}
+	return i, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/base/watchers/dbus"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	busType = dbus.Test
+}
+
+func usec(t time.Time) uint64 {
+	return uint64(t.UnixNano() / 1000)
+}
+
+func TestSystemdTimer(t *testing.T) {
+	testBar.New(t)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	bus := dbus.SetupTestBus()
+	sysd := bus.RegisterService("org.freedesktop.systemd1")
+
+	timer := sysd.Object("/org/freedesktop/systemd1/unit/backup_2dhome_2etimer",
+		"org.freedesktop.systemd1.Timer")
+	timer.SetProperties(map[string]interface{}{
+		"Unit":            "backup-home.service",
+		"LastTriggerUSec": usec(now.Add(-6 * time.Hour)),
+	}, dbus.SignalTypeNone)
+	service := sysd.Object("/org/freedesktop/systemd1/unit/backup_2dhome_2eservice",
+		"org.freedesktop.systemd1.Unit")
+	service.SetProperty("ActiveState", "inactive", dbus.SignalTypeNone)
+
+	m := SystemdTimer("backup-home")
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"BAK 6h0m"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	service.SetProperty("ActiveState", "activating", dbus.SignalTypeChanged)
+	testBar.NextOutput("on service start").AssertText([]string{"BAK running"})
+
+	timer.SetProperty("LastTriggerUSec", usec(now.Add(-2*time.Minute)), dbus.SignalTypeChanged)
+	service.SetProperty("ActiveState", "failed", dbus.SignalTypeChanged)
+	out = testBar.Drain(time.Second, "on service failure")
+	out.AssertText([]string{"BAK 2m0s"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "when failed")
+
+	service.SetProperty("ActiveState", "inactive", dbus.SignalTypeChanged)
+	out = testBar.NextOutput("on service reset")
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	// Advancing may also trigger a refresh part of the way there, so only
+	// the output from the last tick is checked.
+	timing.AdvanceBy(25*time.Hour - time.Minute)
+	testBar.Tick()
+	out = testBar.Drain(time.Second, "on refresh")
+	out.AssertText([]string{"BAK 1d1h"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "when overdue")
+}
+
+func TestSystemdTimerDefaultService(t *testing.T) {
+	testBar.New(t)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	bus := dbus.SetupTestBus()
+	sysd := bus.RegisterService("org.freedesktop.systemd1")
+	service := sysd.Object("/org/freedesktop/systemd1/unit/borgmatic_2eservice",
+		"org.freedesktop.systemd1.Unit")
+	service.SetProperty("ActiveState", "activating", dbus.SignalTypeNone)
+
+	testBar.Run(SystemdTimer("borgmatic"))
+	testBar.NextOutput("on start").AssertText([]string{"BAK running"},
+		"uses the service with the same name as the timer")
+}
@@ -0,0 +1,247 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package battery
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"barista.run/base/sound"
+	"barista.run/base/watchers/dbus"
+	l "barista.run/logging"
+	"barista.run/timing"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// alertConfig holds the thresholds for notifications and actions.
+// A negative threshold disables the corresponding alert.
+type alertConfig struct {
+	notifyPct    int
+	runPct       int
+	cmd          []string
+	hysteresis   int
+	cancelWindow time.Duration
+}
+
+func (c alertConfig) enabled() bool {
+	return c.notifyPct >= 0 || c.runPct >= 0
+}
+
+// NotifyAt configures the module to show a desktop notification (and play the
+// low battery sound) when the battery is discharging and drops to the given
+// percentage or below. The notification is shown again only after the
+// battery has been charged past the threshold plus the hysteresis, or plugged
+// in. A negative percentage disables the notification.
+func (m *Module) NotifyAt(pct int) *Module {
+	c := m.alerts.Get().(alertConfig)
+	c.notifyPct = pct
+	m.setAlerts(c)
+	return m
+}
+
+// RunAt configures the module to run a command, e.g. RunAt(5, "systemctl",
+// "suspend"), when the battery is discharging and drops to the given
+// percentage or below. A critical notification is shown when the threshold is
+// reached, and the command runs only if the battery is still discharging once
+// the cancel window has passed, unless cancelled using CancelAction.
+// A negative percentage disables the action.
+func (m *Module) RunAt(pct int, cmd string, args ...string) *Module {
+	c := m.alerts.Get().(alertConfig)
+	c.runPct = pct
+	c.cmd = append([]string{cmd}, args...)
+	m.setAlerts(c)
+	return m
+}
+
+// Hysteresis sets how many percent above a threshold the battery must be
+// charged, or be plugged in, before the notification or action for that
+// threshold can trigger again. This prevents repeated alerts when the
+// reported capacity fluctuates around a threshold. Defaults to 2%.
+func (m *Module) Hysteresis(pct int) *Module {
+	c := m.alerts.Get().(alertConfig)
+	c.hysteresis = pct
+	m.setAlerts(c)
+	return m
+}
+
+// CancelWindow sets how long to wait after reaching the RunAt threshold before
+// running the command, giving the user time to plug in or cancel the action.
+// Defaults to one minute.
+func (m *Module) CancelWindow(window time.Duration) *Module {
+	c := m.alerts.Get().(alertConfig)
+	c.cancelWindow = window
+	m.setAlerts(c)
+	return m
+}
+
+// CancelAction cancels the pending RunAt command, if any. The action will not
+// trigger again until the battery is charged past the threshold plus the
+// hysteresis. This is intended for use in click handlers, e.g.
+//
+//	if !i.ActionAt.IsZero() {
+//		out.OnClick(click.Left(m.CancelAction))
+//	}
+func (m *Module) CancelAction() {
+	m.cancelFn()
+}
+
+func (m *Module) setAlerts(c alertConfig) {
+	if c.enabled() {
+		// Alerts must fire even while the bar is hidden, e.g. by a
+		// fullscreen window.
+		m.scheduler.RunWhilePaused()
+	}
+	m.alerts.Set(c)
+}
+
+// Overridden in tests.
+var (
+	sessionBus = dbus.Session
+	runCommand = func(cmd []string) error {
+		return exec.Command(cmd[0], cmd[1:]...).Run()
+	}
+)
+
+const (
+	notifyService = "org.freedesktop.Notifications"
+	notifyPath    = "/org/freedesktop/Notifications"
+	notifyIface   = "org.freedesktop.Notifications"
+)
+
+// notification shows, replaces, and closes a single desktop notification.
+type notification struct {
+	w  *dbus.PropertiesWatcher
+	id uint32
+}
+
+func (n *notification) show(summary, body string, urgency byte) {
+	if n.w == nil {
+		n.w = dbus.WatchProperties(sessionBus, notifyService, notifyPath, notifyIface)
+	}
+	hints := map[string]godbus.Variant{"urgency": godbus.MakeVariant(urgency)}
+	res, err := n.w.Call("Notify", "barista", n.id, "battery-caution",
+		summary, body, []string{}, hints, int32(0))
+	if err != nil {
+		l.Log("Failed to show battery notification: %v", err)
+		return
+	}
+	if len(res) > 0 {
+		n.id, _ = res[0].(uint32)
+	}
+}
+
+func (n *notification) close() {
+	if n.w == nil || n.id == 0 {
+		return
+	}
+	if _, err := n.w.Call("CloseNotification", n.id); err != nil {
+		l.Log("Failed to close battery notification: %v", err)
+	}
+	n.id = 0
+}
+
+func (n *notification) unsubscribe() {
+	n.close()
+	if n.w != nil {
+		n.w.Unsubscribe()
+	}
+}
+
+// alertState tracks the notifications and actions triggered by the battery
+// level across updates.
+type alertState struct {
+	scheduler *timing.Scheduler
+
+	notification notification
+	notified     bool
+
+	action    notification
+	pendingAt time.Time
+	// done is set once the action has run or been cancelled, and cleared
+	// when the battery recovers.
+	done bool
+}
+
+// update triggers or resets notifications and actions based on the latest
+// battery info, and returns info with ActionAt set.
+func (a *alertState) update(info Info, c alertConfig) Info {
+	discharging := info.Status == Discharging
+	pct := info.RemainingPct()
+	recovered := func(threshold int) bool {
+		return !discharging || pct > threshold+c.hysteresis
+	}
+
+	if c.notifyPct < 0 || (a.notified && recovered(c.notifyPct)) {
+		a.notified = false
+		a.notification.close()
+	}
+	if c.notifyPct >= 0 && !a.notified && discharging && pct <= c.notifyPct {
+		a.notified = true
+		sound.Play(sound.BatteryLow)
+		a.notification.show("Battery low", remainingText(info), 1)
+	}
+
+	if c.runPct < 0 || recovered(c.runPct) {
+		a.cancel()
+		a.done = false
+	}
+	if c.runPct >= 0 && !a.done && a.pendingAt.IsZero() && discharging && pct <= c.runPct {
+		a.pendingAt = timing.Now().Add(c.cancelWindow)
+		a.scheduler.At(a.pendingAt)
+		sound.Play(sound.BatteryCritical)
+		a.action.show("Battery critical", fmt.Sprintf("%s\nRunning '%s' in %v",
+			remainingText(info), strings.Join(c.cmd, " "), c.cancelWindow), 2)
+	}
+	if !a.pendingAt.IsZero() && !timing.Now().Before(a.pendingAt) {
+		l.Log("Battery at %d%%, running %v", pct, c.cmd)
+		go func(run func([]string) error, cmd []string) {
+			if err := run(cmd); err != nil {
+				l.Log("Battery action %v failed: %v", cmd, err)
+			}
+		}(runCommand, c.cmd)
+		a.pendingAt = time.Time{}
+		a.done = true
+		a.action.close()
+	}
+	info.ActionAt = a.pendingAt
+	return info
+}
+
+// cancel cancels any pending action, without resetting it.
+func (a *alertState) cancel() {
+	if a.pendingAt.IsZero() {
+		return
+	}
+	a.pendingAt = time.Time{}
+	a.done = true
+	a.scheduler.Stop()
+	a.action.close()
+}
+
+func (a *alertState) close() {
+	a.scheduler.Stop()
+	a.notification.unsubscribe()
+	a.action.unsubscribe()
+}
+
+func remainingText(i Info) string {
+	if t := i.RemainingTime(); t > 0 {
+		return fmt.Sprintf("%d%% remaining (%v)", i.RemainingPct(), t)
+	}
+	return fmt.Sprintf("%d%% remaining", i.RemainingPct())
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package battery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/sound"
+	"barista.run/base/watchers/dbus"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+type alertsTest struct {
+	*testing.T
+	notify   chan string
+	closed   chan uint32
+	commands chan []string
+	sounds   <-chan sound.Sound
+}
+
+func setupAlerts(t *testing.T) *alertsTest {
+	a := &alertsTest{
+		T:        t,
+		notify:   make(chan string, 10),
+		closed:   make(chan uint32, 10),
+		commands: make(chan []string, 10),
+		sounds:   sound.TestMode(),
+	}
+	bus := dbus.SetupTestBus()
+	sessionBus = dbus.Test
+	nextID := uint32(0)
+	obj := bus.RegisterService(notifyService).Object(notifyPath, notifyIface)
+	obj.On("Notify", func(args ...interface{}) ([]interface{}, error) {
+		a.notify <- args[3].(string) + ": " + args[4].(string)
+		id := args[1].(uint32)
+		if id == 0 {
+			nextID++
+			id = nextID
+		}
+		return []interface{}{id}, nil
+	})
+	obj.On("CloseNotification", func(args ...interface{}) ([]interface{}, error) {
+		a.closed <- args[0].(uint32)
+		return nil, nil
+	})
+	runCommand = func(cmd []string) error {
+		a.commands <- cmd
+		return errors.New("something went wrong")
+	}
+	fs = afero.NewMemMapFs()
+	return a
+}
+
+func (a *alertsTest) setBattery(status string, pct int) {
+	write(battery{
+		"NAME":        "BAT0",
+		"STATUS":      status,
+		"ENERGY_FULL": 100 * micros,
+		"ENERGY_NOW":  pct * micros,
+	})
+}
+
+func (a *alertsTest) update(status string, pct int, expected string) {
+	a.setBattery(status, pct)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{expected})
+}
+
+func (a *alertsTest) assertNotified(expected string, sound sound.Sound) {
+	select {
+	case n := <-a.notify:
+		require.Equal(a, expected, n)
+	case <-time.After(time.Second):
+		require.Fail(a, "No notification", expected)
+	}
+	select {
+	case s := <-a.sounds:
+		require.Equal(a, sound, s)
+	case <-time.After(time.Second):
+		require.Fail(a, "No sound", "%s", sound)
+	}
+}
+
+func (a *alertsTest) assertClosed(expectedID uint32, msg string) {
+	select {
+	case id := <-a.closed:
+		require.Equal(a, expectedID, id, msg)
+	case <-time.After(time.Second):
+		require.Fail(a, "Notification not closed", msg)
+	}
+}
+
+func (a *alertsTest) assertNothing(msg string) {
+	select {
+	case n := <-a.notify:
+		require.Fail(a, "Unexpected notification", "%s: %s", msg, n)
+	case id := <-a.closed:
+		require.Fail(a, "Unexpected close", "%s: %d", msg, id)
+	case cmd := <-a.commands:
+		require.Fail(a, "Unexpected command", "%s: %v", msg, cmd)
+	case s := <-a.sounds:
+		require.Fail(a, "Unexpected sound", "%s: %s", msg, s)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestNotifyAt(t *testing.T) {
+	a := setupAlerts(t)
+	a.setBattery("Discharging", 20)
+	testBar.New(t)
+	m := Named("BAT0").NotifyAt(15)
+	testBar.Run(m)
+	testBar.NextOutput().AssertText([]string{"BATT 20%"}, "on start")
+	a.assertNothing("above threshold")
+
+	a.update("Discharging", 15, "BATT 15%")
+	a.assertNotified("Battery low: 15% remaining", sound.BatteryLow)
+
+	a.update("Discharging", 14, "BATT 14%")
+	a.assertNothing("already notified")
+
+	a.update("Discharging", 17, "BATT 17%")
+	a.assertNothing("within hysteresis")
+
+	a.update("Discharging", 18, "BATT 18%")
+	a.assertClosed(1, "above threshold + hysteresis")
+
+	a.update("Discharging", 12, "BATT 12%")
+	a.assertNotified("Battery low: 12% remaining", sound.BatteryLow)
+
+	a.update("Charging", 12, "BATT 12%")
+	a.assertClosed(2, "when plugged in")
+	a.update("Discharging", 12, "BATT 12%")
+	a.assertNotified("Battery low: 12% remaining", sound.BatteryLow)
+
+	m.NotifyAt(9)
+	testBar.NextOutput().AssertText([]string{"BATT 12%"}, "on config change")
+	a.assertClosed(3, "above new threshold + hysteresis")
+	a.update("Discharging", 10, "BATT 10%")
+	a.assertNothing("above new threshold")
+	a.update("Discharging", 9, "BATT 9%")
+	a.assertNotified("Battery low: 9% remaining", sound.BatteryLow)
+
+	m.Hysteresis(0)
+	testBar.NextOutput().AssertText([]string{"BATT 9%"}, "on config change")
+	a.update("Discharging", 10, "BATT 10%")
+	a.assertClosed(4, "above threshold without hysteresis")
+	a.update("Discharging", 9, "BATT 9%")
+	a.assertNotified("Battery low: 9% remaining", sound.BatteryLow)
+
+	m.NotifyAt(-1)
+	testBar.NextOutput().AssertText([]string{"BATT 9%"}, "on config change")
+	a.assertClosed(5, "when disabled")
+	a.update("Discharging", 5, "BATT 5%")
+	a.assertNothing("when disabled")
+}
+
+func TestRunAt(t *testing.T) {
+	a := setupAlerts(t)
+	a.setBattery("Discharging", 10)
+	testBar.New(t)
+	m := Named("BAT0").RefreshInterval(time.Hour).
+		RunAt(5, "systemctl", "suspend").CancelWindow(30 * time.Second)
+	m.Output(func(i Info) bar.Output {
+		if i.ActionAt.IsZero() {
+			return outputs.Textf("%d%%", i.RemainingPct())
+		}
+		return outputs.Textf("%d%% %v", i.RemainingPct(), i.ActionAt.Sub(timing.Now()))
+	})
+	testBar.Run(m)
+	testBar.NextOutput().AssertText([]string{"10%"}, "on start")
+
+	a.update("Discharging", 5, "5% 30s")
+	a.assertNotified("Battery critical: 5% remaining\nRunning 'systemctl suspend' in 30s",
+		sound.BatteryCritical)
+	a.assertNothing("during cancel window")
+
+	timing.AdvanceBy(30 * time.Second)
+	testBar.NextOutput().AssertText([]string{"5%"}, "after cancel window")
+	select {
+	case cmd := <-a.commands:
+		require.Equal(t, []string{"systemctl", "suspend"}, cmd)
+	case <-time.After(time.Second):
+		require.Fail(t, "Command not run after cancel window")
+	}
+	a.assertClosed(1, "after running command")
+
+	a.update("Discharging", 4, "4%")
+	a.assertNothing("command already run")
+
+	a.update("Charging", 4, "4%")
+	a.assertNothing("on plug in")
+	a.update("Discharging", 4, "4% 30s")
+	a.assertNotified("Battery critical: 4% remaining\nRunning 'systemctl suspend' in 30s",
+		sound.BatteryCritical)
+
+	m.CancelAction()
+	testBar.NextOutput().AssertText([]string{"4%"}, "on cancel")
+	a.assertClosed(2, "on cancel")
+	timing.AdvanceBy(time.Minute)
+	a.assertNothing("after cancelling")
+
+	a.update("Charging", 6, "6%")
+	a.update("Discharging", 5, "5% 30s")
+	a.assertNotified("Battery critical: 5% remaining\nRunning 'systemctl suspend' in 30s",
+		sound.BatteryCritical)
+	a.update("Charging", 5, "5%")
+	a.assertClosed(3, "plugged in during cancel window")
+	timing.AdvanceBy(time.Minute)
+	a.assertNothing("plugged in during cancel window")
+}
+
+func TestAlertsWhilePaused(t *testing.T) {
+	a := setupAlerts(t)
+	a.setBattery("Discharging", 10)
+	testBar.New(t)
+	m := Named("BAT0").RefreshInterval(time.Minute).NotifyAt(5)
+	testBar.Run(m)
+	testBar.NextOutput().AssertText([]string{"BATT 10%"}, "on start")
+
+	timing.Pause()
+	a.setBattery("Discharging", 5)
+	timing.AdvanceBy(time.Minute)
+	a.assertNotified("Battery low: 5% remaining", sound.BatteryLow)
+	timing.Resume()
+}
@@ -17,14 +17,19 @@ package battery // import "barista.run/modules/battery"
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"math"
+	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"barista.run/bar"
+	"barista.run/base/notifier"
 	"barista.run/base/value"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -53,6 +58,8 @@ const (
 
 // Info represents the current battery information.
 type Info struct {
+	// Name of the battery, e.g. "BAT0". Empty for aggregated batteries.
+	Name string
 	// Capacity in *percents*, from 0 to 100.
 	Capacity int
 	// Energy when the battery is full, in Wh.
@@ -69,6 +76,73 @@ type Info struct {
 	Status Status
 	// Technology of the battery, e.g. "Li-Ion", "Li-Poly", "Ni-MH".
 	Technology string
+	// CycleCount is the number of charge cycles, or 0 if not reported.
+	CycleCount int
+	// ChargeStartThreshold is the capacity in percent below which the battery
+	// will start charging, if supported by the vendor driver.
+	ChargeStartThreshold int
+	// ChargeEndThreshold is the capacity in percent at which the battery will
+	// stop charging, or 0 if charge thresholds are not supported.
+	ChargeEndThreshold int
+
+	// PowerHistory contains recent readings of SignedPower() in W, oldest
+	// first, covering the window configured using Smoothing.
+	PowerHistory []float64
+	// AveragePower is the mean power draw over the smoothing window in W, or 0
+	// if smoothing is disabled.
+	AveragePower float64
+
+	// ActionAt is when the command configured using RunAt will run, or zero if
+	// no command is pending.
+	ActionAt time.Time
+
+	// Batteries contains the individual batteries that make up this one, for
+	// modules constructed using Combined.
+	Batteries []Info
+
+	// Names of the batteries and the threshold helper, used to set thresholds.
+	names      []string
+	helper     []string
+	supplyType string
+}
+
+// Health returns the fraction of the design capacity that the battery can
+// currently hold when full.
+func (i Info) Health() float64 {
+	if math.Nextafter(i.EnergyMax, 0) == 0 {
+		return 0
+	}
+	return i.EnergyFull / i.EnergyMax
+}
+
+// HealthPct returns the battery health as a percentage of design capacity.
+func (i Info) HealthPct() int {
+	return int(i.Health() * 100)
+}
+
+// HasThresholds returns true if the battery supports charge thresholds.
+func (i Info) HasThresholds() bool {
+	return i.ChargeEndThreshold > 0
+}
+
+// SetChargeThresholds sets the charge start and end thresholds (in percent)
+// by invoking the helper configured using ThresholdHelper. This is intended
+// for use in click handlers constructed by the output function.
+func (i Info) SetChargeThresholds(start, end int) error {
+	if len(i.helper) == 0 {
+		return errors.New("No charge threshold helper configured")
+	}
+	if start < 0 || end > 100 || start >= end {
+		return fmt.Errorf("Invalid charge thresholds: %d-%d", start, end)
+	}
+	for _, name := range i.names {
+		args := append(i.helper[1:len(i.helper):len(i.helper)],
+			name, strconv.Itoa(start), strconv.Itoa(end))
+		if err := exec.Command(i.helper[0], args...).Run(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Remaining returns the fraction of battery capacity remaining.
@@ -85,20 +159,25 @@ func (i Info) RemainingPct() int {
 }
 
 // RemainingTime returns the best guess for remaining time.
-// This is based on the current power draw and remaining capacity.
+// This is based on the power draw (averaged over the smoothing window if
+// smoothing is enabled) and remaining capacity.
 func (i Info) RemainingTime() time.Duration {
+	power := i.Power
+	if i.AveragePower > 0 {
+		power = i.AveragePower
+	}
 	// Battery does not report current draw,
 	// cannot estimate remaining time.
-	if math.Nextafter(i.Power, 0) == 0 {
+	if math.Nextafter(power, 0) == 0 {
 		return 0
 	}
 	// According to ACPI spec, these calculations will return hours.
 	hours := 0.0
 	switch i.Status {
 	case Charging:
-		hours = (i.EnergyFull - i.EnergyNow) / i.Power
+		hours = (i.EnergyFull - i.EnergyNow) / power
 	case Discharging:
-		hours = i.EnergyNow / i.Power
+		hours = i.EnergyNow / power
 	}
 	return time.Duration(int(hours*3600)) * time.Second
 }
@@ -127,16 +206,33 @@ func (i Info) SignedPower() float64 {
 type Module struct {
 	updateFunc func() Info
 	scheduler  *timing.Scheduler
-	outputFunc value.Value // of func(Info) bar.Output
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	helper     value.Value     // of []string
+	window     value.Value     // of time.Duration
+	alerts     value.Value     // of alertConfig
+
+	cancelFn        func()
+	cancelCh        <-chan struct{}
+	actionScheduler *timing.Scheduler
 }
 
 func newModule(updateFunc func() Info) *Module {
 	m := &Module{
-		updateFunc: updateFunc,
-		scheduler:  timing.NewScheduler(),
+		updateFunc:      updateFunc,
+		scheduler:       timing.NewScheduler(),
+		actionScheduler: timing.NewScheduler().RunWhilePaused(),
 	}
-	l.Register(m, "scheduler", "format")
+	m.cancelFn, m.cancelCh = notifier.New()
+	l.Register(m, "scheduler", "format", "actionScheduler")
 	m.RefreshInterval(3 * time.Second)
+	m.helper.Set([]string(nil))
+	m.window.Set(time.Duration(0))
+	m.alerts.Set(alertConfig{
+		notifyPct:    -1,
+		runPct:       -1,
+		hysteresis:   2,
+		cancelWindow: time.Minute,
+	})
 	// Construct a simple template that's just the available battery percent.
 	m.Output(func(i Info) bar.Output {
 		return outputs.Textf("BATT %d%%", i.RemainingPct())
@@ -156,12 +252,37 @@ func All() *Module {
 	return newModule(allBatteriesInfo)
 }
 
+// Combined constructs a battery module that treats all detected batteries,
+// including hot-swappable ones and those in connected peripherals, as a single
+// logical battery. The details for each battery are available in Batteries.
+func Combined() *Module {
+	return newModule(combinedInfo)
+}
+
 // Output configures a module to display the output of a user-defined function.
 func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
 	m.outputFunc.Set(outputFunc)
 	return m
 }
 
+// ThresholdHelper sets a privileged command used to change charge thresholds
+// via Info.SetChargeThresholds. It is invoked once per battery, with the battery
+// name and the start and end thresholds appended to the given arguments, so
+// ThresholdHelper("pkexec", "set-thresholds") runs "pkexec set-thresholds BAT0 75 80".
+func (m *Module) ThresholdHelper(cmd string, args ...string) *Module {
+	m.helper.Set(append([]string{cmd}, args...))
+	return m
+}
+
+// Smoothing configures the module to keep a history of power readings over
+// the given window, and use their average for time estimates instead of the
+// instantaneous power draw reported by the kernel. The history is cleared
+// whenever the battery switches between charging and discharging.
+func (m *Module) Smoothing(window time.Duration) *Module {
+	m.window.Set(window)
+	return m
+}
+
 // RefreshInterval configures the polling frequency for battery info.
 func (m *Module) RefreshInterval(interval time.Duration) *Module {
 	m.scheduler.Every(interval)
@@ -170,21 +291,70 @@ func (m *Module) RefreshInterval(interval time.Duration) *Module {
 
 // Stream starts the module.
 func (m *Module) Stream(s bar.Sink) {
-	info := m.updateFunc()
+	var h history
+	info := h.add(m.updateFunc(), m.window.Get().(time.Duration))
 	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
 	nextOutputFunc, done := m.outputFunc.Subscribe()
 	defer done()
+	nextAlerts, done := m.alerts.Subscribe()
+	defer done()
+	alerts := &alertState{scheduler: m.actionScheduler}
+	defer alerts.close()
 	for {
+		info.helper = m.helper.Get().([]string)
+		info = alerts.update(info, m.alerts.Get().(alertConfig))
 		s.Output(outputFunc(info))
 		select {
 		case <-m.scheduler.C:
-			info = m.updateFunc()
+			info = h.add(m.updateFunc(), m.window.Get().(time.Duration))
+		case <-m.actionScheduler.C:
+			info = h.add(m.updateFunc(), m.window.Get().(time.Duration))
+		case <-m.cancelCh:
+			alerts.cancel()
+		case <-nextAlerts:
 		case <-nextOutputFunc:
 			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
 		}
 	}
 }
 
+type powerSample struct {
+	when  time.Time
+	power float64
+}
+
+// history tracks power readings over a rolling window.
+type history struct {
+	samples     []powerSample
+	discharging bool
+}
+
+// add records the power reading from info, and returns info with the power
+// history and average populated.
+func (h *history) add(info Info, window time.Duration) Info {
+	if window <= 0 {
+		h.samples = nil
+		return info
+	}
+	if info.Discharging() != h.discharging {
+		h.samples = nil
+		h.discharging = info.Discharging()
+	}
+	now := timing.Now()
+	h.samples = append(h.samples, powerSample{now, info.SignedPower()})
+	for len(h.samples) > 1 && now.Sub(h.samples[0].when) >= window {
+		h.samples = h.samples[1:]
+	}
+	info.PowerHistory = make([]float64, len(h.samples))
+	total := 0.0
+	for i, s := range h.samples {
+		info.PowerHistory[i] = s.power
+		total += math.Abs(s.power)
+	}
+	info.AveragePower = total / float64(len(h.samples))
+	return info
+}
+
 // electricValue represents a value that is either watts or amperes.
 // ACPI permits several of the properties to be in either unit, so to
 // simplify reading such values, this type can represent either unit
@@ -285,8 +455,15 @@ func batteryInfo(name string) Info {
 			info.Technology = value
 		case "CAPACITY":
 			info.Capacity, _ = strconv.Atoi(value)
+		case "CYCLE_COUNT":
+			info.CycleCount, _ = strconv.Atoi(value)
+		case "TYPE":
+			info.supplyType = value
 		}
 	}
+	info.Name = name
+	info.names = []string{name}
+	info.ChargeStartThreshold, info.ChargeEndThreshold = readThresholds(name)
 	info.EnergyNow = energyNow.toWatts(info.Voltage)
 	info.EnergyMax = energyMax.toWatts(info.Voltage)
 	info.EnergyFull = energyFull.toWatts(info.Voltage)
@@ -294,6 +471,27 @@ func batteryInfo(name string) Info {
 	return info
 }
 
+// readThresholds reads the charge thresholds for the given battery, using the
+// generic sysfs attributes where available, otherwise the older names used by
+// some vendor drivers (e.g. thinkpad_acpi).
+func readThresholds(name string) (start, end int) {
+	dir := fmt.Sprintf("/sys/class/power_supply/%s", name)
+	for _, attrs := range [][2]string{
+		{"charge_control_start_threshold", "charge_control_end_threshold"},
+		{"charge_start_threshold", "charge_stop_threshold"},
+	} {
+		endBytes, err := afero.ReadFile(fs, dir+"/"+attrs[1])
+		if err != nil {
+			continue
+		}
+		end, _ = strconv.Atoi(strings.TrimSpace(string(endBytes)))
+		startBytes, _ := afero.ReadFile(fs, dir+"/"+attrs[0])
+		start, _ = strconv.Atoi(strings.TrimSpace(string(startBytes)))
+		return start, end
+	}
+	return 0, 0
+}
+
 func allBatteriesInfo() Info {
 	dir, err := fs.Open("/sys/class/power_supply")
 	if err != nil {
@@ -322,6 +520,14 @@ func allBatteriesInfo() Info {
 		allInfo.EnergyFull += info.EnergyFull
 		allInfo.EnergyMax += info.EnergyMax
 		allInfo.EnergyNow += info.EnergyNow
+		allInfo.names = append(allInfo.names, info.names...)
+		if info.CycleCount > allInfo.CycleCount {
+			allInfo.CycleCount = info.CycleCount
+		}
+		if !allInfo.HasThresholds() {
+			allInfo.ChargeStartThreshold = info.ChargeStartThreshold
+			allInfo.ChargeEndThreshold = info.ChargeEndThreshold
+		}
 		if info.Technology != "" {
 			techs = append(techs, info.Technology)
 		}
@@ -351,3 +557,99 @@ func allBatteriesInfo() Info {
 	allInfo.Technology = strings.Join(techs, ",")
 	return allInfo
 }
+
+func combinedInfo() Info {
+	dir, err := fs.Open("/sys/class/power_supply")
+	if err != nil {
+		l.Log("No batteries: %s", err)
+		return Info{Status: Disconnected}
+	}
+	supplies, err := dir.Readdirnames(-1)
+	if err != nil {
+		l.Log("Failed to list batteries: %s", err)
+		return Info{Status: Unknown}
+	}
+	sort.Strings(supplies)
+	var infos []Info
+	for _, supply := range supplies {
+		info := batteryInfo(supply)
+		if info.Status == Disconnected {
+			continue
+		}
+		if strings.HasPrefix(supply, "BAT") || info.supplyType == "Battery" {
+			infos = append(infos, info)
+		}
+	}
+	if len(infos) == 0 {
+		return Info{Status: Disconnected}
+	}
+	return combine(infos)
+}
+
+// combine merges the given batteries into a single Info. Batteries that
+// do not report energy (common for peripherals) are excluded from the energy
+// totals, but still count towards the status and, if no battery reports
+// energy, the capacity.
+func combine(infos []Info) Info {
+	all := Info{Batteries: infos}
+	var techs []string
+	var voltEnergySum, netPower float64
+	var capacitySum int
+	var charging, discharging, notCharging, full int
+	for _, info := range infos {
+		all.names = append(all.names, info.names...)
+		capacitySum += info.Capacity
+		if info.CycleCount > all.CycleCount {
+			all.CycleCount = info.CycleCount
+		}
+		if !all.HasThresholds() {
+			all.ChargeStartThreshold = info.ChargeStartThreshold
+			all.ChargeEndThreshold = info.ChargeEndThreshold
+		}
+		if info.Technology != "" {
+			techs = append(techs, info.Technology)
+		}
+		switch info.Status {
+		case Charging:
+			charging++
+			netPower += info.Power
+		case Discharging:
+			discharging++
+			netPower -= info.Power
+		case NotCharging:
+			notCharging++
+		case Full:
+			full++
+		}
+		if math.Nextafter(info.EnergyFull, 0) == 0 {
+			continue
+		}
+		all.EnergyFull += info.EnergyFull
+		all.EnergyMax += info.EnergyMax
+		all.EnergyNow += info.EnergyNow
+		voltEnergySum += info.Voltage * info.EnergyNow
+	}
+	all.Power = math.Abs(netPower)
+	switch {
+	case netPower > 0:
+		all.Status = Charging
+	case netPower < 0, discharging > 0:
+		all.Status = Discharging
+	case charging > 0:
+		all.Status = Charging
+	case full == len(infos):
+		all.Status = Full
+	case notCharging+full > 0:
+		all.Status = NotCharging
+	}
+	if math.Nextafter(all.EnergyNow, 0) != 0 {
+		all.Voltage = voltEnergySum / all.EnergyNow
+	}
+	if math.Nextafter(all.EnergyFull, 0) != 0 {
+		all.Capacity = int(all.EnergyNow * 100.0 / all.EnergyFull)
+	} else {
+		all.Capacity = capacitySum / len(infos)
+	}
+	all.Technology = strings.Join(techs, ",")
+	return all
+}
@@ -17,6 +17,10 @@ package battery
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -336,3 +340,227 @@ func TestCombined(t *testing.T) {
 	testBar.NextOutput().AssertText([]string{
 		"Discharging - 50/5h0m0s"})
 }
+
+func TestHealthAndThresholds(t *testing.T) {
+	require := require.New(t)
+	fs = afero.NewMemMapFs()
+	write(battery{
+		"NAME":               "BAT0",
+		"STATUS":             "Discharging",
+		"VOLTAGE_NOW":        12 * micros,
+		"ENERGY_FULL_DESIGN": 50 * micros,
+		"ENERGY_FULL":        40 * micros,
+		"ENERGY_NOW":         20 * micros,
+		"CYCLE_COUNT":        312,
+	})
+	write(battery{
+		"NAME":               "BAT1",
+		"STATUS":             "Discharging",
+		"VOLTAGE_NOW":        12 * micros,
+		"ENERGY_FULL_DESIGN": 20 * micros,
+		"ENERGY_FULL":        19 * micros,
+		"ENERGY_NOW":         10 * micros,
+		"CYCLE_COUNT":        45,
+	})
+
+	info := batteryInfo("BAT0")
+	require.Equal(312, info.CycleCount)
+	require.InDelta(0.8, info.Health(), 0.0001)
+	require.Equal(80, info.HealthPct())
+	require.False(info.HasThresholds())
+	require.Equal(0, Info{}.HealthPct(), "no design capacity")
+
+	afero.WriteFile(fs, "/sys/class/power_supply/BAT0/charge_control_start_threshold", []byte("75\n"), 0644)
+	afero.WriteFile(fs, "/sys/class/power_supply/BAT0/charge_control_end_threshold", []byte("80\n"), 0644)
+	afero.WriteFile(fs, "/sys/class/power_supply/BAT1/charge_start_threshold", []byte("40\n"), 0644)
+	afero.WriteFile(fs, "/sys/class/power_supply/BAT1/charge_stop_threshold", []byte("60\n"), 0644)
+
+	info = batteryInfo("BAT0")
+	require.True(info.HasThresholds())
+	require.Equal(75, info.ChargeStartThreshold)
+	require.Equal(80, info.ChargeEndThreshold)
+
+	info = batteryInfo("BAT1")
+	require.Equal(40, info.ChargeStartThreshold, "legacy attributes")
+	require.Equal(60, info.ChargeEndThreshold, "legacy attributes")
+
+	info = allBatteriesInfo()
+	require.Equal(312, info.CycleCount, "max cycle count")
+	require.Equal(75, info.ChargeStartThreshold, "first battery's thresholds")
+	require.InDelta(59.0/70.0, info.Health(), 0.0001)
+	require.Error(info.SetChargeThresholds(75, 80), "without helper")
+}
+
+func TestSetChargeThresholds(t *testing.T) {
+	require := require.New(t)
+	fs = afero.NewMemMapFs()
+	write(battery{"NAME": "BAT0", "STATUS": "Full"})
+	write(battery{"NAME": "BAT1", "STATUS": "Full"})
+
+	tmpDir, err := ioutil.TempDir("", "battery")
+	require.NoError(err)
+	defer os.RemoveAll(tmpDir)
+	logFile := filepath.Join(tmpDir, "helper.log")
+
+	infos := make(chan Info, 10)
+	testBar.New(t)
+	m := All().Output(func(i Info) bar.Output {
+		infos <- i
+		return outputs.Text("batt")
+	})
+	testBar.Run(m)
+	testBar.NextOutput("on start")
+	require.Error((<-infos).SetChargeThresholds(60, 80), "no helper")
+
+	m.ThresholdHelper("sh", "-c", `echo "$@" >> `+logFile, "helper")
+	testBar.Tick()
+	testBar.NextOutput("on tick")
+	info := <-infos
+	require.Error(info.SetChargeThresholds(80, 60), "start > end")
+	require.Error(info.SetChargeThresholds(50, 101), "end > 100")
+	require.NoError(info.SetChargeThresholds(60, 80))
+
+	log, err := ioutil.ReadFile(logFile)
+	require.NoError(err)
+	require.Equal("BAT0 60 80\nBAT1 60 80\n", string(log))
+
+	m.ThresholdHelper("false")
+	testBar.Tick()
+	testBar.NextOutput("on tick")
+	require.Error((<-infos).SetChargeThresholds(60, 80), "helper fails")
+}
+
+func TestSmoothing(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	bat := battery{
+		"NAME":        "BAT0",
+		"STATUS":      "Discharging",
+		"VOLTAGE_NOW": 10 * micros,
+		"POWER_NOW":   10 * micros,
+		"ENERGY_FULL": 60 * micros,
+		"ENERGY_NOW":  30 * micros,
+	}
+	write(bat)
+	testBar.New(t)
+
+	m := Named("BAT0").RefreshInterval(time.Minute).Smoothing(3 * time.Minute)
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%v %.1f %v", i.PowerHistory, i.AveragePower, i.RemainingTime())
+	})
+	testBar.Run(m)
+	testBar.NextOutput().AssertText([]string{"[-10] 10.0 3h0m0s"}, "on start")
+
+	bat["POWER_NOW"] = 20 * micros
+	write(bat)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"[-10 -20] 15.0 2h0m0s"})
+
+	bat["POWER_NOW"] = 30 * micros
+	write(bat)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"[-10 -20 -30] 20.0 1h30m0s"})
+
+	bat["POWER_NOW"] = 40 * micros
+	write(bat)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"[-20 -30 -40] 30.0 1h0m0s"},
+		"old samples dropped")
+
+	bat["STATUS"] = "Charging"
+	bat["POWER_NOW"] = 15 * micros
+	write(bat)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"[15] 15.0 2h0m0s"},
+		"history reset on status change")
+
+	m.Smoothing(0)
+	bat["POWER_NOW"] = 30 * micros
+	write(bat)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"[] 0.0 1h0m0s"},
+		"instantaneous power without smoothing")
+}
+
+func TestCombinedModule(t *testing.T) {
+	require := require.New(t)
+	fs = afero.NewMemMapFs()
+	write(battery{
+		"NAME": "AC",
+		"TYPE": "Mains",
+	})
+	bat0 := battery{
+		"NAME":        "BAT0",
+		"TYPE":        "Battery",
+		"STATUS":      "Discharging",
+		"VOLTAGE_NOW": 12 * micros,
+		"POWER_NOW":   10 * micros,
+		"ENERGY_FULL": 50 * micros,
+		"ENERGY_NOW":  20 * micros,
+	}
+	bat1 := battery{
+		"NAME":        "BAT1",
+		"TYPE":        "Battery",
+		"STATUS":      "Full",
+		"VOLTAGE_NOW": 12 * micros,
+		"ENERGY_FULL": 30 * micros,
+		"ENERGY_NOW":  30 * micros,
+	}
+	mouse := battery{
+		"NAME":     "hidpp_battery_0",
+		"TYPE":     "Battery",
+		"STATUS":   "Discharging",
+		"CAPACITY": 40,
+	}
+	writeAll := func() {
+		write(bat0)
+		write(bat1)
+		write(mouse)
+	}
+	writeAll()
+
+	info := combinedInfo()
+	require.Len(info.Batteries, 3)
+	require.Equal([]string{"BAT0", "BAT1", "hidpp_battery_0"},
+		[]string{info.Batteries[0].Name, info.Batteries[1].Name, info.Batteries[2].Name})
+	require.Equal(Discharging, info.Status)
+	require.Equal(80.0, info.EnergyFull, "peripheral excluded from energy")
+	require.Equal(62, info.RemainingPct())
+	require.Equal(5*time.Hour, info.RemainingTime())
+	require.Equal(12.0, info.Voltage)
+
+	testBar.New(t)
+	testBar.Run(Combined().Output(func(i Info) bar.Output {
+		var parts []string
+		for _, b := range i.Batteries {
+			parts = append(parts, fmt.Sprintf("%s:%d", b.Name, b.Capacity))
+		}
+		return outputs.Textf("%s %d%% (%s)", i.Status, i.Capacity, strings.Join(parts, ","))
+	}))
+	testBar.NextOutput().AssertText([]string{
+		"Discharging 62% (BAT0:0,BAT1:0,hidpp_battery_0:40)"}, "on start")
+
+	bat0["STATUS"] = "Charging"
+	bat0["ENERGY_NOW"] = 30 * micros
+	bat0["CAPACITY"] = 60
+	mouse["STATUS"] = "Full"
+	writeAll()
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{
+		"Charging 75% (BAT0:60,BAT1:0,hidpp_battery_0:40)"})
+
+	bat0["STATUS"] = "Full"
+	bat0["ENERGY_NOW"] = 50 * micros
+	writeAll()
+	info = combinedInfo()
+	require.Equal(Full, info.Status)
+	require.Equal(time.Duration(0), info.RemainingTime())
+
+	fs.Remove("/sys/class/power_supply/BAT0/uevent")
+	fs.Remove("/sys/class/power_supply/BAT1/uevent")
+	info = combinedInfo()
+	require.Equal(Full, info.Status)
+	require.Equal(40, info.Capacity, "capacity from peripherals without energy")
+
+	fs = afero.NewMemMapFs()
+	require.Equal(Disconnected, combinedInfo().Status)
+}
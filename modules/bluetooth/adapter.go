@@ -17,14 +17,14 @@ package bluetooth // import "barista.run/modules/bluetooth"
 
 import (
 	"barista.run/bar"
-	"barista.run/base/value"
 	"barista.run/base/watchers/dbus"
+	"barista.run/core"
 )
 
 // AdapterModule represents a Bluetooth bar module.
 type AdapterModule struct {
 	adapter    string
-	outputFunc value.Value
+	outputFunc core.OutputFunc
 }
 
 // AdapterInfo represents a Bluetooth adapters information.
@@ -21,14 +21,14 @@ import (
 	godbus "github.com/godbus/dbus"
 
 	"barista.run/bar"
-	"barista.run/base/value"
 	"barista.run/base/watchers/dbus"
+	"barista.run/core"
 )
 
 // DeviceModule represents a Bluetooth devices bar module.
 type DeviceModule struct {
 	path       string
-	outputFunc value.Value
+	outputFunc core.OutputFunc
 }
 
 // DeviceInfo represents Bluetooth device information.
@@ -0,0 +1,393 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package breaks provides a bar module that reminds the user to take regular
+// breaks, e.g. following the 20-20-20 rule (every 20 minutes, look at
+// something 20 feet away for 20 seconds).
+//
+// The work timer is reset by breaks taken from the bar, and by idle periods
+// at least as long as a break, using the idle hint of the logind session.
+// When a break is due, the default output is coloured, and when it is
+// overdue, the output becomes urgent and a desktop notification is shown.
+package breaks // import "barista.run/modules/breaks"
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/colors"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// Phase represents the state of the work/break cycle.
+type Phase int
+
+// Possible phases of the cycle.
+const (
+	// Working indicates that the next break is not yet due.
+	Working Phase = iota
+	// Due indicates that a break is due.
+	Due
+	// Overdue indicates that a break has been due for longer than the grace
+	// period.
+	Overdue
+	// OnBreak indicates that the user is taking a break, either started from
+	// the bar or by being idle.
+	OnBreak
+)
+
+// Info represents the current state of the work/break cycle.
+type Info struct {
+	Phase Phase
+	// Worked is the time since the end of the last break.
+	Worked time.Duration
+	// Work is the configured time between breaks, and Break the length of a
+	// break.
+	Work, Break time.Duration
+	// Idle is true if the current break is the user being idle.
+	Idle bool
+	// BreakLeft is the time remaining in the current break. It is zero once
+	// the user has been idle for long enough.
+	BreakLeft time.Duration
+
+	s *state
+}
+
+// UntilDue returns the time remaining until the next break is due, or zero
+// if a break is already due.
+func (i Info) UntilDue() time.Duration {
+	if i.Worked >= i.Work {
+		return 0
+	}
+	return i.Work - i.Worked
+}
+
+// TakeBreak starts a break, which resets the work timer once it ends.
+func (i Info) TakeBreak() {
+	if i.s != nil {
+		i.s.takeBreak()
+	}
+}
+
+// Skip resets the work timer immediately, ending any break in progress.
+func (i Info) Skip() {
+	if i.s != nil {
+		i.s.skip()
+	}
+}
+
+// Module represents a bar module that reminds the user to take breaks.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	work       value.Value     // of time.Duration
+	breakLen   value.Value     // of time.Duration
+	grace      value.Value     // of time.Duration
+	notify     value.Value     // of bool
+	scheduler  *timing.Scheduler
+	state      *state
+	refreshCh  <-chan struct{}
+}
+
+// New constructs a break reminder module, with the 20-20-20 rule by default:
+// a 20 second break every 20 minutes.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler(), state: &state{}}
+	m.state.notifyFn, m.refreshCh = notifier.New()
+	l.Register(m, "outputFunc", "work", "breakLen", "grace", "notify", "scheduler")
+	m.Work(20 * time.Minute)
+	m.Break(20 * time.Second)
+	m.Overdue(5 * time.Minute)
+	m.Notify(true)
+	m.Output(func(i Info) bar.Output {
+		var out *bar.Segment
+		switch i.Phase {
+		case OnBreak:
+			if i.BreakLeft == 0 {
+				return outputs.Text("Break").OnClick(click.Right(i.Skip))
+			}
+			return outputs.Textf("Break %s", formatDuration(i.BreakLeft)).
+				OnClick(click.Right(i.Skip))
+		case Working:
+			out = outputs.Textf("Break in %s", formatDuration(i.UntilDue()))
+		case Due:
+			out = outputs.Text("Break due").Color(colors.Scheme("degraded"))
+		case Overdue:
+			out = outputs.Textf("Break overdue %s", formatDuration(i.Worked-i.Work)).
+				Color(colors.Scheme("bad")).Urgent(true)
+		}
+		return out.OnClick(click.Map{}.
+			Left(i.TakeBreak).
+			Right(i.Skip).
+			Handle)
+	})
+	return m
+}
+
+// formatDuration formats a duration as minutes, rounded up, or as seconds
+// if it is less than a minute, e.g. "5m" or "20s".
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int((d+time.Second-1)/time.Second))
+	}
+	return fmt.Sprintf("%dm", int((d+time.Minute-1)/time.Minute))
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Work sets the time between breaks.
+func (m *Module) Work(interval time.Duration) *Module {
+	m.work.Set(interval)
+	return m
+}
+
+// Break sets the length of a break. Being idle for at least this long also
+// counts as a break.
+func (m *Module) Break(length time.Duration) *Module {
+	m.breakLen.Set(length)
+	return m
+}
+
+// Overdue sets how long after a break is due it is considered overdue,
+// which makes the default output urgent and shows a notification.
+func (m *Module) Overdue(grace time.Duration) *Module {
+	m.grace.Set(grace)
+	return m
+}
+
+// Notify configures whether a desktop notification is shown when a break is
+// overdue. Defaults to true.
+func (m *Module) Notify(notify bool) *Module {
+	m.notify.Set(notify)
+	return m
+}
+
+// state tracks breaks. It is shared between the module and click handlers.
+type state struct {
+	sync.Mutex
+	started    bool
+	lastBreak  time.Time // when the last break ended.
+	breakStart time.Time // when the current break started, if taken from the bar.
+	idleSince  time.Time // when the user became idle, if currently idle.
+	notifyFn   func()
+}
+
+func (s *state) takeBreak() {
+	s.Lock()
+	if s.breakStart.IsZero() {
+		s.breakStart = timing.Now()
+	}
+	s.Unlock()
+	s.notifyFn()
+}
+
+func (s *state) skip() {
+	s.Lock()
+	s.lastBreak = timing.Now()
+	s.breakStart = time.Time{}
+	s.Unlock()
+	s.notifyFn()
+}
+
+// update updates the state for the current idle status, and returns the
+// current info. idleSince is the start of the idle period as reported by
+// logind, and may be zero if not known.
+func (s *state) update(now time.Time, idle bool, idleSince time.Time, work, brk, grace time.Duration) Info {
+	s.Lock()
+	defer s.Unlock()
+	if !s.started {
+		s.started = true
+		s.lastBreak = now
+	}
+	switch {
+	case idle && s.idleSince.IsZero():
+		if idleSince.IsZero() || idleSince.After(now) {
+			idleSince = now
+		}
+		s.idleSince = idleSince
+	case !idle && !s.idleSince.IsZero():
+		if now.Sub(s.idleSince) >= brk {
+			s.lastBreak = now
+		}
+		s.idleSince = time.Time{}
+	}
+	if !s.breakStart.IsZero() && now.Sub(s.breakStart) >= brk {
+		s.lastBreak = s.breakStart.Add(brk)
+		s.breakStart = time.Time{}
+	}
+	i := Info{Work: work, Break: brk, s: s}
+	switch {
+	case !s.idleSince.IsZero():
+		i.Phase = OnBreak
+		i.Idle = true
+		if idleFor := now.Sub(s.idleSince); idleFor < brk {
+			i.BreakLeft = brk - idleFor
+		} else {
+			// Keep resetting the work timer while the user stays idle.
+			s.lastBreak = now
+		}
+	case !s.breakStart.IsZero():
+		i.Phase = OnBreak
+		i.BreakLeft = brk - now.Sub(s.breakStart)
+	}
+	i.Worked = now.Sub(s.lastBreak)
+	if i.Phase == OnBreak {
+		return i
+	}
+	switch {
+	case i.Worked >= work+grace:
+		i.Phase = Overdue
+	case i.Worked >= work:
+		i.Phase = Due
+	}
+	return i
+}
+
+// nextUpdate returns when the output should next be updated: every second
+// while a break is counting down, otherwise every minute or at the next
+// phase change, whichever comes first.
+func nextUpdate(now time.Time, i Info, grace time.Duration) time.Time {
+	if i.BreakLeft > 0 {
+		return now.Add(time.Second)
+	}
+	next := now.Add(time.Minute - i.Worked%time.Minute)
+	for _, d := range []time.Duration{i.Work, i.Work + grace} {
+		if t := now.Add(d - i.Worked); t.After(now) && t.Before(next) {
+			next = t
+		}
+	}
+	return next
+}
+
+const (
+	logindService = "org.freedesktop.login1"
+	logindSession = "/org/freedesktop/login1/session/auto"
+	logindIface   = "org.freedesktop.login1.Session"
+
+	notifyService = "org.freedesktop.Notifications"
+	notifyPath    = "/org/freedesktop/Notifications"
+	notifyIface   = "org.freedesktop.Notifications"
+)
+
+// Overridden in tests.
+var (
+	systemBus  = dbus.System
+	sessionBus = dbus.Session
+)
+
+// notification shows and closes the overdue break notification.
+type notification struct {
+	w  *dbus.PropertiesWatcher
+	id uint32
+}
+
+func (n *notification) show(i Info) {
+	if n.w == nil {
+		n.w = dbus.WatchProperties(sessionBus, notifyService, notifyPath, notifyIface)
+	}
+	body := fmt.Sprintf("You have been working for %s. Take a %s break.",
+		formatDuration(i.Worked), formatDuration(i.Break))
+	res, err := n.w.Call("Notify", "barista", n.id, "", "Time for a break",
+		body, []string{}, map[string]godbus.Variant{}, int32(0))
+	if err != nil {
+		l.Log("Failed to show break notification: %v", err)
+		return
+	}
+	if len(res) > 0 {
+		n.id, _ = res[0].(uint32)
+	}
+}
+
+func (n *notification) close() {
+	if n.w == nil || n.id == 0 {
+		return
+	}
+	if _, err := n.w.Call("CloseNotification", n.id); err != nil {
+		l.Log("Failed to close break notification: %v", err)
+	}
+	n.id = 0
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	w := dbus.WatchProperties(systemBus, logindService, logindSession, logindIface).
+		Add("IdleHint", "IdleSinceHint")
+	defer w.Unsubscribe()
+	var n notification
+	defer func() {
+		n.close()
+		if n.w != nil {
+			n.w.Unsubscribe()
+		}
+	}()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextWork, done := m.work.Subscribe()
+	defer done()
+	nextBreak, done := m.breakLen.Subscribe()
+	defer done()
+	nextGrace, done := m.grace.Subscribe()
+	defer done()
+	nextNotify, done := m.notify.Subscribe()
+	defer done()
+
+	for {
+		props := w.Get()
+		idle, _ := props["IdleHint"].(bool)
+		var idleSince time.Time
+		if us, ok := props["IdleSinceHint"].(uint64); ok && us > 0 {
+			idleSince = time.Unix(0, int64(us)*int64(time.Microsecond))
+		}
+		now := timing.Now()
+		grace := m.grace.Get().(time.Duration)
+		i := m.state.update(now, idle, idleSince,
+			m.work.Get().(time.Duration), m.breakLen.Get().(time.Duration), grace)
+		sink.Output(outputFunc(i))
+		if i.Phase == Overdue && m.notify.Get().(bool) {
+			if n.id == 0 {
+				n.show(i)
+			}
+		} else {
+			n.close()
+		}
+		m.scheduler.At(nextUpdate(now, i, grace))
+		select {
+		case <-w.Updates:
+		case <-m.scheduler.C:
+		case <-m.refreshCh:
+		case <-nextWork:
+		case <-nextBreak:
+		case <-nextGrace:
+		case <-nextNotify:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
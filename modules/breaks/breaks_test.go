@@ -0,0 +1,264 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breaks
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testBus struct {
+	session *dbus.TestBusObject
+	notify  chan string
+	closed  chan uint32
+}
+
+func setupBus() *testBus {
+	bus := dbus.SetupTestBus()
+	systemBus = dbus.Test
+	sessionBus = dbus.Test
+	b := &testBus{
+		session: bus.RegisterService(logindService).Object(logindSession, logindIface),
+		notify:  make(chan string, 10),
+		closed:  make(chan uint32, 10),
+	}
+	b.session.SetProperties(map[string]interface{}{
+		"IdleHint":      false,
+		"IdleSinceHint": uint64(0),
+	}, dbus.SignalTypeNone)
+	obj := bus.RegisterService(notifyService).Object(notifyPath, notifyIface)
+	obj.On("Notify", func(args ...interface{}) ([]interface{}, error) {
+		b.notify <- args[3].(string) + ": " + args[4].(string)
+		return []interface{}{uint32(42)}, nil
+	})
+	obj.On("CloseNotification", func(args ...interface{}) ([]interface{}, error) {
+		b.closed <- args[0].(uint32)
+		return nil, nil
+	})
+	return b
+}
+
+func (b *testBus) setIdle(idle bool, since time.Time) {
+	var us uint64
+	if !since.IsZero() {
+		us = uint64(since.UnixNano() / int64(time.Microsecond))
+	}
+	b.session.SetProperties(map[string]interface{}{
+		"IdleHint":      idle,
+		"IdleSinceHint": us,
+	}, dbus.SignalTypeChanged)
+}
+
+func TestFormatDuration(t *testing.T) {
+	for _, tc := range []struct {
+		d   time.Duration
+		exp string
+	}{
+		{0, "0s"},
+		{20 * time.Second, "20s"},
+		{19500 * time.Millisecond, "20s"},
+		{time.Minute, "1m"},
+		{61 * time.Second, "2m"},
+		{20 * time.Minute, "20m"},
+	} {
+		require.Equal(t, tc.exp, formatDuration(tc.d), "%v", tc.d)
+	}
+}
+
+func TestState(t *testing.T) {
+	start := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	work, brk, grace := 20*time.Minute, time.Minute, 5*time.Minute
+	s := &state{notifyFn: func() {}}
+	update := func(offset time.Duration, idle bool, since time.Duration) Info {
+		var idleSince time.Time
+		if since != 0 {
+			idleSince = start.Add(since)
+		}
+		return s.update(start.Add(offset), idle, idleSince, work, brk, grace)
+	}
+
+	i := update(0, false, 0)
+	require.Equal(t, Working, i.Phase)
+	require.Equal(t, 20*time.Minute, i.UntilDue())
+
+	i = update(19*time.Minute, false, 0)
+	require.Equal(t, Working, i.Phase)
+	require.Equal(t, time.Minute, i.UntilDue())
+
+	i = update(20*time.Minute, false, 0)
+	require.Equal(t, Due, i.Phase)
+	require.Equal(t, time.Duration(0), i.UntilDue())
+
+	i = update(25*time.Minute, false, 0)
+	require.Equal(t, Overdue, i.Phase)
+
+	i = update(26*time.Minute, true, 25*time.Minute+30*time.Second)
+	require.Equal(t, OnBreak, i.Phase)
+	require.True(t, i.Idle)
+	require.Equal(t, 30*time.Second, i.BreakLeft)
+
+	i = update(26*time.Minute+10*time.Second, false, 0)
+	require.Equal(t, Overdue, i.Phase, "idle shorter than a break")
+
+	i = update(27*time.Minute, true, 0)
+	require.Equal(t, OnBreak, i.Phase)
+	require.Equal(t, time.Minute, i.BreakLeft, "idle since now without hint")
+
+	i = update(30*time.Minute, true, 0)
+	require.Equal(t, OnBreak, i.Phase)
+	require.Equal(t, time.Duration(0), i.BreakLeft)
+	require.Equal(t, time.Duration(0), i.Worked, "reset while idle")
+
+	i = update(45*time.Minute, false, 0)
+	require.Equal(t, Working, i.Phase)
+	require.Equal(t, time.Duration(0), i.Worked, "reset when idle ends")
+
+	i = update(50*time.Minute, false, 0)
+	require.Equal(t, 5*time.Minute, i.Worked)
+}
+
+func TestNextUpdate(t *testing.T) {
+	now := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	work := 20 * time.Minute
+
+	require.Equal(t, now.Add(time.Second),
+		nextUpdate(now, Info{Work: work, BreakLeft: 10 * time.Second}, time.Minute),
+		"during break")
+	require.Equal(t, now.Add(30*time.Second),
+		nextUpdate(now, Info{Work: work, Worked: 90 * time.Second}, time.Minute),
+		"next minute")
+	require.Equal(t, now.Add(10*time.Second),
+		nextUpdate(now, Info{Work: 20 * time.Second, Worked: 10 * time.Second}, time.Hour),
+		"when due")
+	require.Equal(t, now.Add(5*time.Second),
+		nextUpdate(now, Info{Work: 20 * time.Second, Worked: 25 * time.Second}, 10*time.Second),
+		"when overdue")
+}
+
+func TestBreaks(t *testing.T) {
+	testBar.New(t)
+	bus := setupBus()
+	testBar.Run(New().Work(2 * time.Minute).Overdue(time.Minute))
+
+	testBar.NextOutput("on start").AssertText([]string{"Break in 2m"})
+	testBar.Tick()
+	testBar.NextOutput("after a minute").AssertText([]string{"Break in 1m"})
+
+	testBar.Tick()
+	out := testBar.NextOutput("when due")
+	out.AssertText([]string{"Break due"})
+	col, _ := out.At(0).Segment().GetColor()
+	require.Equal(t, colors.Scheme("degraded"), col)
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	testBar.Tick()
+	out = testBar.NextOutput("when overdue")
+	out.AssertText([]string{"Break overdue 1m"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent)
+	require.Equal(t, "Time for a break: You have been working for 3m. Take a 20s break.",
+		<-bus.notify)
+
+	testBar.Tick()
+	testBar.NextOutput("still overdue").AssertText([]string{"Break overdue 2m"})
+	select {
+	case n := <-bus.notify:
+		require.Fail(t, "unexpected notification", n)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("on break")
+	out.AssertText([]string{"Break 20s"})
+	require.Equal(t, uint32(42), <-bus.closed, "closes notification")
+
+	testBar.Tick()
+	testBar.NextOutput("during break").AssertText([]string{"Break 19s"})
+	timing.AdvanceBy(19 * time.Second)
+	testBar.Drain(50*time.Millisecond, "after break").
+		AssertText([]string{"Break in 2m"})
+
+	bus.setIdle(true, timing.Now().Add(-5*time.Second))
+	testBar.NextOutput("when idle").AssertText([]string{"Break 15s"})
+	bus.setIdle(true, timing.Now().Add(-30*time.Second))
+	testBar.NextOutput("on idle hint change").
+		AssertText([]string{"Break 15s"}, "idle start is not updated")
+
+	timing.AdvanceBy(time.Minute)
+	testBar.Drain(50*time.Millisecond, "idle for a break").
+		AssertText([]string{"Break"})
+	timing.AdvanceBy(10 * time.Minute)
+	bus.setIdle(false, time.Time{})
+	testBar.Drain(50*time.Millisecond, "after idle").
+		AssertText([]string{"Break in 2m"})
+}
+
+func TestSkip(t *testing.T) {
+	testBar.New(t)
+	bus := setupBus()
+	m := New().Work(time.Minute).Overdue(0).Notify(false)
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"Break in 1m"})
+
+	testBar.Tick()
+	out := testBar.NextOutput("when overdue")
+	out.AssertText([]string{"Break overdue 0s"})
+	select {
+	case n := <-bus.notify:
+		require.Fail(t, "unexpected notification", n)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	testBar.NextOutput("on skip").AssertText([]string{"Break in 1m"})
+
+	var info Info
+	m.Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Text("breaks")
+	})
+	testBar.NextOutput("on output func change")
+	info.TakeBreak()
+	testBar.NextOutput("on break")
+	require.Equal(t, OnBreak, info.Phase)
+	require.False(t, info.Idle)
+	require.Equal(t, 20*time.Second, info.BreakLeft)
+
+	info.Skip()
+	testBar.NextOutput("on skip")
+	require.Equal(t, Working, info.Phase)
+
+	Info{}.TakeBreak()
+	Info{}.Skip()
+}
+
+func TestNoLogind(t *testing.T) {
+	testBar.New(t)
+	dbus.SetupTestBus()
+	systemBus = dbus.Test
+	sessionBus = dbus.Test
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertText([]string{"Break in 20m"})
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package brightness provides a bar module that shows and controls the
+// brightness of a backlight, such as a laptop display. The module updates on
+// kernel backlight events, so it follows changes made using hardware keys,
+// and it can optionally show an on-screen display when the brightness changes.
+package brightness // import "barista.run/modules/brightness"
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/uevent"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/osd"
+	"barista.run/outputs"
+
+	"github.com/spf13/afero"
+)
+
+// Info represents the brightness of a backlight.
+type Info struct {
+	// Device is the name of the backlight, e.g. "intel_backlight".
+	Device string
+	// Brightness is the current brightness, from 0 to Max.
+	Brightness, Max int
+
+	ctrl controller
+}
+
+// Frac returns the current brightness as a fraction of the maximum.
+func (i Info) Frac() float64 {
+	if i.Max == 0 {
+		return 0
+	}
+	return float64(i.Brightness) / float64(i.Max)
+}
+
+// Pct returns the current brightness in the range 0-100.
+func (i Info) Pct() int {
+	return int((i.Frac() * 100) + 0.5)
+}
+
+// Set sets the brightness of the backlight. It is limited to at least 1,
+// since a brightness of 0 turns off some displays entirely.
+func (i Info) Set(brightness int) {
+	if brightness > i.Max {
+		brightness = i.Max
+	}
+	if brightness < 1 {
+		brightness = 1
+	}
+	if i.ctrl == nil || brightness == i.Brightness {
+		return
+	}
+	if err := i.ctrl.setBrightness(i.Device, brightness); err != nil {
+		l.Log("Failed to set brightness of %s: %v", i.Device, err)
+	}
+}
+
+// Adjust changes the brightness by the given percentage of the maximum.
+func (i Info) Adjust(pct int) {
+	step := i.Max * pct / 100
+	if step == 0 && pct != 0 {
+		step = pct / abs(pct)
+	}
+	i.Set(i.Brightness + step)
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+type controller interface {
+	setBrightness(device string, brightness int) error
+}
+
+// Module represents a bar module that shows the brightness of a backlight.
+type Module struct {
+	device     string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	osd        value.Value     // of osd.Indicator
+}
+
+// New constructs a brightness module for the first backlight found.
+func New() *Module {
+	return Device("")
+}
+
+// Device constructs a brightness module for the named backlight, as listed
+// in /sys/class/backlight.
+func Device(name string) *Module {
+	m := &Module{device: name}
+	l.Label(m, name)
+	l.Register(m, "outputFunc", "osd")
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%d%%", i.Pct()).
+			OnClick(click.Map{}.
+				ScrollUp(func() { i.Adjust(5) }).
+				ScrollDown(func() { i.Adjust(-5) }).
+				Handle)
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// OSD configures an on-screen display indicator that is shown whenever the
+// brightness changes after the module has started.
+func (m *Module) OSD(indicator osd.Indicator) *Module {
+	m.osd.Set(indicator)
+	return m
+}
+
+const sysfsRoot = "/sys/class/backlight"
+
+// Overridden in tests.
+var (
+	fs      = afero.NewOsFs()
+	busType = dbus.System
+)
+
+func readInt(path string) (int, error) {
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// findDevice returns the named backlight, or the first backlight if the name
+// is empty.
+func findDevice(name string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+	dirs, err := afero.ReadDir(fs, sysfsRoot)
+	if err != nil {
+		return "", err
+	}
+	names := []string{}
+	for _, d := range dirs {
+		names = append(names, d.Name())
+	}
+	if len(names) == 0 {
+		return "", errors.New("no backlight found")
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+func read(name string) (Info, error) {
+	dev, err := findDevice(name)
+	if err != nil {
+		return Info{}, err
+	}
+	i := Info{Device: dev}
+	if i.Brightness, err = readInt(filepath.Join(sysfsRoot, dev, "brightness")); err != nil {
+		return i, err
+	}
+	i.Max, err = readInt(filepath.Join(sysfsRoot, dev, "max_brightness"))
+	return i, err
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	sub := uevent.Subscribe("backlight")
+	defer sub.Unsubscribe()
+	// Writing to sysfs requires root, but logind allows the user of an
+	// active session to change the brightness.
+	w := dbus.WatchProperties(busType, logindService, logindSession, logindIface)
+	defer w.Unsubscribe()
+	ctrl := &logind{w}
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	var last Info
+	for {
+		i, err := read(m.device)
+		if sink.Error(err) {
+			return
+		}
+		i.ctrl = ctrl
+		sink.Output(outputFunc(i))
+		if ind, ok := m.osd.Get().(osd.Indicator); ok && changed(last, i) {
+			if out := ind.Show(osd.Event{
+				Kind:     osd.Brightness,
+				Fraction: i.Frac(),
+				Text:     strconv.Itoa(i.Pct()) + "%",
+			}); out != nil {
+				sink.Output(out)
+			}
+		}
+		last = i
+		select {
+		case <-sub.C:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// changed returns true if the brightness of the same backlight has changed.
+// The first value read after starting is never a change.
+func changed(last, i Info) bool {
+	return last.Device == i.Device && last.Brightness != i.Brightness
+}
+
+const (
+	logindService = "org.freedesktop.login1"
+	logindSession = "/org/freedesktop/login1/session/auto"
+	logindIface   = "org.freedesktop.login1.Session"
+)
+
+type logind struct {
+	w *dbus.PropertiesWatcher
+}
+
+func (c *logind) setBrightness(device string, brightness int) error {
+	_, err := c.w.Call("SetBrightness", "backlight", device, uint32(brightness))
+	return err
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package brightness
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/uevent"
+	"barista.run/osd"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func setBacklight(dev string, brightness, max int) {
+	afero.WriteFile(fs, sysfsRoot+"/"+dev+"/brightness",
+		[]byte(fmt.Sprintf("%d\n", brightness)), 0644)
+	afero.WriteFile(fs, sysfsRoot+"/"+dev+"/max_brightness",
+		[]byte(fmt.Sprintf("%d\n", max)), 0644)
+}
+
+func backlightChanged() {
+	uevent.Emit(uevent.Event{Action: "change", Subsystem: "backlight"})
+}
+
+type setCall struct {
+	device     string
+	brightness uint32
+}
+
+func setupLogind() chan setCall {
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	calls := make(chan setCall, 10)
+	bus.RegisterService(logindService).
+		Object(logindSession, logindIface).
+		On("SetBrightness", func(args ...interface{}) ([]interface{}, error) {
+			calls <- setCall{args[1].(string), args[2].(uint32)}
+			return nil, nil
+		})
+	return calls
+}
+
+func init() {
+	// Backlight modules from earlier tests re-read sysfs on every backlight
+	// uevent, so tests reset sysfsRoot in this filesystem rather than
+	// replacing fs under them.
+	fs = afero.NewMemMapFs()
+	uevent.TestMode()
+}
+
+func TestBrightness(t *testing.T) {
+	testBar.New(t)
+	fs.RemoveAll(sysfsRoot)
+	setBacklight("intel_backlight", 600, 1200)
+	setBacklight("acpi_video0", 5, 10)
+	calls := setupLogind()
+
+	testBar.Run(New())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"50%"}, "uses first backlight")
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	require.Equal(t, setCall{"acpi_video0", 6}, <-calls,
+		"adjusts by at least one step")
+	setBacklight("acpi_video0", 6, 10)
+	backlightChanged()
+	out = testBar.NextOutput("on backlight event")
+	out.AssertText([]string{"60%"})
+
+	setBacklight("acpi_video0", 1, 10)
+	backlightChanged()
+	out = testBar.NextOutput("on backlight event")
+	out.AssertText([]string{"10%"})
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	select {
+	case c := <-calls:
+		require.Fail(t, "unexpected brightness change", "%+v", c)
+	case <-time.After(10 * time.Millisecond):
+		// Brightness is already at the minimum.
+	}
+
+	fs.RemoveAll(sysfsRoot + "/acpi_video0")
+	backlightChanged()
+	out = testBar.NextOutput("on device removal")
+	out.AssertText([]string{"50%"})
+}
+
+func TestNamedDevice(t *testing.T) {
+	testBar.New(t)
+	fs.RemoveAll(sysfsRoot)
+	setBacklight("intel_backlight", 19200, 19200)
+	calls := setupLogind()
+
+	testBar.Run(Device("intel_backlight").Output(func(i Info) bar.Output {
+		return outputs.Textf("%s: %d/%d", i.Device, i.Brightness, i.Max).
+			OnClick(func(bar.Event) { i.Set(20000) })
+	}))
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"intel_backlight: 19200/19200"})
+	out.At(0).LeftClick()
+	select {
+	case c := <-calls:
+		require.Fail(t, "unexpected brightness change", "%+v", c)
+	case <-time.After(10 * time.Millisecond):
+		// Brightness is already at the maximum.
+	}
+	out.At(0).Segment().OnClick(nil)
+
+	fs.RemoveAll(sysfsRoot + "/intel_backlight")
+	backlightChanged()
+	testBar.NextOutput("on device removal").AssertError()
+}
+
+func TestNoBacklight(t *testing.T) {
+	testBar.New(t)
+	fs.RemoveAll(sysfsRoot)
+	setupLogind()
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertError()
+}
+
+func TestOSD(t *testing.T) {
+	testBar.New(t)
+	fs.RemoveAll(sysfsRoot)
+	setBacklight("intel_backlight", 300, 1000)
+	setupLogind()
+
+	testBar.Run(New().OSD(osd.OnBar().Duration(time.Second)))
+	testBar.NextOutput("on start").AssertText([]string{"30%"},
+		"no indicator on start")
+
+	setBacklight("intel_backlight", 400, 1000)
+	backlightChanged()
+	testBar.Drain(50*time.Millisecond, "on change").
+		AssertText([]string{"████░░░░░░ 40%"}, "indicator shown on change")
+	testBar.AssertNoOutput("while indicator is shown")
+
+	backlightChanged()
+	testBar.AssertNoOutput("without change")
+
+	testBar.Tick()
+	testBar.NextOutput("indicator expired").AssertText([]string{"40%"})
+}
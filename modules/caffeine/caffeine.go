@@ -0,0 +1,294 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package caffeine provides a bar module that toggles an idle inhibitor, and
+// shows the idle inhibitors held by other programs, such as video players.
+// Inhibitors are listed using logind, and this module's inhibitor is taken
+// using either logind or the org.freedesktop.ScreenSaver interface.
+package caffeine // import "barista.run/modules/caffeine"
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/watchers/dbus"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// Inhibitor represents an inhibitor lock held with logind.
+type Inhibitor struct {
+	// What is a colon-separated list of what is inhibited, e.g. "idle:sleep".
+	What string
+	// Who is a human-readable name of the program holding the lock.
+	Who string
+	// Why is a human-readable reason for holding the lock.
+	Why  string
+	Mode string
+	UID  uint32
+	PID  uint32
+}
+
+// Info represents the idle inhibitors currently active.
+type Info struct {
+	// Active is true if this module is inhibiting idle.
+	Active bool
+	// Others are the idle inhibitors held by other programs.
+	Others []Inhibitor
+
+	ctrl *control
+}
+
+// Count returns the number of active idle inhibitors, including this
+// module's own inhibitor.
+func (i Info) Count() int {
+	if i.Active {
+		return len(i.Others) + 1
+	}
+	return len(i.Others)
+}
+
+// Toggle enables or disables this module's idle inhibitor.
+func (i Info) Toggle() { i.ctrl.set(!i.Active) }
+
+// Enable starts inhibiting idle.
+func (i Info) Enable() { i.ctrl.set(true) }
+
+// Disable stops inhibiting idle. Inhibitors held by other programs are not
+// affected.
+func (i Info) Disable() { i.ctrl.set(false) }
+
+// Module represents a bar module that controls an idle inhibitor.
+type Module struct {
+	screenSaver bool
+	outputFunc  core.OutputFunc // of func(Info) bar.Output
+	scheduler   *timing.Scheduler
+}
+
+func newModule(screenSaver bool) *Module {
+	m := &Module{
+		screenSaver: screenSaver,
+		scheduler:   timing.NewScheduler().Every(5 * time.Second),
+	}
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		state := "off"
+		if i.Active {
+			state = "on"
+		}
+		out := outputs.Text(state)
+		if len(i.Others) > 0 {
+			out = outputs.Textf("%s (+%d)", state, len(i.Others))
+		}
+		return out.OnClick(click.Left(i.Toggle))
+	})
+	return m
+}
+
+// New constructs a caffeine module that takes an idle inhibitor lock from
+// logind. Logind does not signal changes to inhibitors, so the list of
+// inhibitors is refreshed every 5 seconds by default.
+func New() *Module {
+	return newModule(false)
+}
+
+// ScreenSaver constructs a caffeine module that inhibits idle using the
+// org.freedesktop.ScreenSaver interface, for desktops and screen lockers that
+// do not respect logind inhibitors.
+func ScreenSaver() *Module {
+	return newModule(true)
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency for the list of
+// inhibitors.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	login := dbus.WatchProperties(systemBus,
+		"org.freedesktop.login1", "/org/freedesktop/login1",
+		"org.freedesktop.login1.Manager")
+	defer login.Unsubscribe()
+
+	c := &control{refresh: make(chan struct{}, 1)}
+	if m.screenSaver {
+		ss := dbus.WatchProperties(sessionBus,
+			"org.freedesktop.ScreenSaver", "/org/freedesktop/ScreenSaver",
+			"org.freedesktop.ScreenSaver")
+		defer ss.Unsubscribe()
+		c.backend = screenSaver{ss}
+	} else {
+		c.backend = logind{login}
+	}
+	defer c.set(false)
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	for {
+		i := Info{ctrl: c}
+		i.Active = c.active()
+		inhibitors, err := listInhibitors(login)
+		if err != nil {
+			l.Log("Failed to list inhibitors: %v", err)
+		}
+		for _, inh := range inhibitors {
+			if !isIdle(inh) || (i.Active && c.isOwn(inh)) {
+				continue
+			}
+			i.Others = append(i.Others, inh)
+		}
+		sink.Output(outputFunc(i))
+		select {
+		case <-m.scheduler.C:
+		case <-c.refresh:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// Overridden in tests.
+var (
+	systemBus  = dbus.System
+	sessionBus = dbus.Session
+	getpid     = os.Getpid
+	closeFd    = syscall.Close
+)
+
+const (
+	who = "barista"
+	why = "Caffeine mode enabled from the bar"
+)
+
+func listInhibitors(w *dbus.PropertiesWatcher) ([]Inhibitor, error) {
+	r, err := w.Call("ListInhibitors")
+	if err != nil {
+		return nil, err
+	}
+	var inhibitors []Inhibitor
+	err = godbus.Store(r, &inhibitors)
+	return inhibitors, err
+}
+
+func isIdle(i Inhibitor) bool {
+	for _, what := range strings.Split(i.What, ":") {
+		if what == "idle" {
+			return true
+		}
+	}
+	return false
+}
+
+// backend takes an idle inhibitor, returning a function to release it.
+type backend interface {
+	inhibit() (release func() error, err error)
+}
+
+// control tracks the state of the module's inhibitor, which can be changed
+// from click handlers while the module is streaming.
+type control struct {
+	backend backend
+	refresh chan struct{}
+
+	mu      sync.Mutex
+	release func() error
+}
+
+func (c *control) active() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.release != nil
+}
+
+// isOwn returns true if the inhibitor was taken by this module. The
+// ScreenSaver interface does not always translate into a logind inhibitor,
+// so this is a best guess based on the name and process.
+func (c *control) isOwn(i Inhibitor) bool {
+	return i.Who == who && i.PID == uint32(getpid())
+}
+
+func (c *control) set(active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	switch {
+	case active && c.release == nil:
+		c.release, err = c.backend.inhibit()
+	case !active && c.release != nil:
+		err = c.release()
+		c.release = nil
+	}
+	if err != nil {
+		l.Log("Failed to set idle inhibitor to %v: %v", active, err)
+	}
+	select {
+	case c.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// logind holds a "block" inhibitor lock, which lasts until the returned file
+// descriptor is closed.
+type logind struct{ w *dbus.PropertiesWatcher }
+
+func (b logind) inhibit() (func() error, error) {
+	r, err := b.w.Call("Inhibit", "idle", who, why, "block")
+	if err != nil {
+		return nil, err
+	}
+	var fd godbus.UnixFD
+	if err := godbus.Store(r, &fd); err != nil {
+		return nil, err
+	}
+	return func() error { return closeFd(int(fd)) }, nil
+}
+
+// screenSaver holds an inhibitor identified by a cookie, which lasts until
+// UnInhibit is called or the connection is closed.
+type screenSaver struct{ w *dbus.PropertiesWatcher }
+
+func (b screenSaver) inhibit() (func() error, error) {
+	r, err := b.w.Call("Inhibit", who, why)
+	if err != nil {
+		return nil, err
+	}
+	var cookie uint32
+	if err := godbus.Store(r, &cookie); err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := b.w.Call("UnInhibit", cookie)
+		return err
+	}, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caffeine
+
+import (
+	"sync"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLogind struct {
+	sync.Mutex
+	inhibitors [][]interface{}
+}
+
+func (f *fakeLogind) add(what, who, why string, pid uint32) {
+	f.Lock()
+	defer f.Unlock()
+	f.inhibitors = append(f.inhibitors,
+		[]interface{}{what, who, why, "block", uint32(1000), pid})
+}
+
+func (f *fakeLogind) remove(who string) {
+	f.Lock()
+	defer f.Unlock()
+	for i, inh := range f.inhibitors {
+		if inh[1] == who {
+			f.inhibitors = append(f.inhibitors[:i], f.inhibitors[i+1:]...)
+			return
+		}
+	}
+}
+
+func setupLogind(t *testing.T) (*fakeLogind, *dbus.TestBus, *dbus.TestBusObject) {
+	testBar.New(t)
+	bus := dbus.SetupTestBus()
+	systemBus = dbus.Test
+	sessionBus = dbus.Test
+	getpid = func() int { return 1234 }
+	f := &fakeLogind{}
+	obj := bus.RegisterService("org.freedesktop.login1").
+		Object("/org/freedesktop/login1", "org.freedesktop.login1.Manager")
+	obj.On("ListInhibitors", func(...interface{}) ([]interface{}, error) {
+		f.Lock()
+		defer f.Unlock()
+		return []interface{}{append([][]interface{}{}, f.inhibitors...)}, nil
+	})
+	return f, bus, obj
+}
+
+func TestLogind(t *testing.T) {
+	logind, _, obj := setupLogind(t)
+	obj.On("Inhibit", func(args ...interface{}) ([]interface{}, error) {
+		require.Equal(t, []interface{}{"idle", who, why, "block"}, args)
+		logind.add("idle", who, why, 1234)
+		return []interface{}{godbus.UnixFD(42)}, nil
+	})
+	closed := make(chan int, 1)
+	closeFd = func(fd int) error {
+		logind.remove(who)
+		closed <- fd
+		return nil
+	}
+	logind.add("sleep", "NetworkManager", "suspend hooks", 10)
+
+	testBar.Run(New())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"off"}, "ignores non-idle inhibitors")
+
+	logind.add("idle:sleep", "firefox", "Playing video", 20)
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"off (+1)"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on enable")
+	out.AssertText([]string{"on (+1)"}, "excludes own inhibitor")
+
+	out.At(0).LeftClick()
+	require.Equal(t, 42, <-closed, "releases inhibitor")
+	testBar.NextOutput("on disable").AssertText([]string{"off (+1)"})
+}
+
+func TestScreenSaver(t *testing.T) {
+	logind, bus, _ := setupLogind(t)
+	obj := bus.RegisterService("org.freedesktop.ScreenSaver").
+		Object("/org/freedesktop/ScreenSaver", "org.freedesktop.ScreenSaver")
+	obj.On("Inhibit", func(args ...interface{}) ([]interface{}, error) {
+		require.Equal(t, []interface{}{who, why}, args)
+		return []interface{}{uint32(7)}, nil
+	})
+	uninhibited := make(chan uint32, 1)
+	obj.On("UnInhibit", func(args ...interface{}) ([]interface{}, error) {
+		uninhibited <- args[0].(uint32)
+		return nil, nil
+	})
+	logind.add("idle", "mpv", "Playing", 30)
+
+	var info Info
+	infos := make(chan Info, 10)
+	testBar.Run(ScreenSaver().Output(func(i Info) bar.Output {
+		infos <- i
+		return outputs.Textf("%d", i.Count())
+	}))
+	testBar.NextOutput("on start").AssertText([]string{"1"})
+	info = <-infos
+	require.False(t, info.Active)
+	require.Equal(t, []Inhibitor{{"idle", "mpv", "Playing", "block", 1000, 30}},
+		info.Others)
+
+	info.Enable()
+	testBar.NextOutput("on enable").AssertText([]string{"2"})
+	info = <-infos
+	require.True(t, info.Active)
+
+	info.Enable()
+	testBar.NextOutput("on enable again").AssertText([]string{"2"})
+	<-infos
+	require.Empty(t, uninhibited, "no change when already enabled")
+
+	info.Disable()
+	require.Equal(t, uint32(7), <-uninhibited)
+	testBar.NextOutput("on disable").AssertText([]string{"1"})
+}
+
+func TestErrors(t *testing.T) {
+	_, _, obj := setupLogind(t)
+	obj.On("ListInhibitors", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{"not a list"}, nil
+	})
+
+	testBar.Run(New())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"off"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on failed enable").AssertText([]string{"off"},
+		"Inhibit is not defined")
+}
@@ -0,0 +1,240 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package captive provides a bar module that detects captive portals (e.g. the
+// login pages of hotel or airport Wi-Fi), by checking whether a known URL
+// returns "204 No Content" as expected. Checks are performed whenever
+// connectivity changes, and periodically.
+package captive // import "barista.run/modules/captive"
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/httpclient"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// State represents the result of a connectivity check.
+type State int
+
+// Possible connectivity states.
+const (
+	// Unknown means that connectivity has not been checked yet.
+	Unknown State = iota
+	// Offline means that there is no network connection, or the check failed.
+	Offline
+	// Online means that the check URL returned 204 No Content.
+	Online
+	// Captive means that the check was intercepted by a captive portal.
+	Captive
+)
+
+func (s State) String() string {
+	switch s {
+	case Offline:
+		return "offline"
+	case Online:
+		return "online"
+	case Captive:
+		return "captive"
+	default:
+		return "unknown"
+	}
+}
+
+// Info represents the result of the last connectivity check.
+type Info struct {
+	State State
+	// PortalURL is the login page of the captive portal. If the portal did
+	// not redirect to its login page, this is the check URL, since opening it
+	// in a browser will also show the portal.
+	PortalURL string
+	// Checked is the time of the last connectivity check.
+	Checked time.Time
+}
+
+// Captive returns true if a captive portal was detected.
+func (i Info) Captive() bool {
+	return i.State == Captive
+}
+
+// Online returns true if the connectivity check succeeded.
+func (i Info) Online() bool {
+	return i.State == Online
+}
+
+// OpenPortal opens the login page of the captive portal in the browser, using
+// xdg-open. It does nothing if no captive portal was detected.
+func (i Info) OpenPortal() error {
+	if !i.Captive() || i.PortalURL == "" {
+		return nil
+	}
+	return openURL(i.PortalURL)
+}
+
+// Overridden in tests.
+var openURL = func(url string) error {
+	return exec.Command("xdg-open", url).Run()
+}
+
+// DefaultCheckURL is an HTTP endpoint that returns 204 No Content. Plain HTTP
+// is used deliberately, since portals cannot intercept HTTPS without errors.
+const DefaultCheckURL = "http://connectivitycheck.gstatic.com/generate_204"
+
+// While a captive portal is detected, checks are repeated more often, so that
+// the output is updated soon after logging in.
+const captiveInterval = 15 * time.Second
+
+// Module represents a captive portal detection bar module.
+type Module struct {
+	checkURL   value.Value // of string
+	interval   value.Value // of time.Duration
+	scheduler  *timing.Scheduler
+	refreshFn  func()
+	refreshCh  <-chan struct{}
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// New constructs an instance of the captive portal module.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	m.refreshFn, m.refreshCh = notifier.New()
+	l.Register(m, "outputFunc", "scheduler")
+	m.CheckURL(DefaultCheckURL)
+	m.RefreshInterval(5 * time.Minute)
+	// Default output is a warning while a captive portal is detected, which
+	// opens the login page when clicked.
+	m.Output(func(i Info) bar.Output {
+		if !i.Captive() {
+			return nil
+		}
+		return outputs.Text("Captive portal").Urgent(true).
+			OnClick(click.Left(func() {
+				if err := i.OpenPortal(); err != nil {
+					l.Log("Failed to open captive portal: %v", err)
+				}
+			}))
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// CheckURL configures the URL used for connectivity checks, which must return
+// 204 No Content when there is no captive portal.
+func (m *Module) CheckURL(url string) *Module {
+	m.checkURL.Set(url)
+	return m
+}
+
+// RefreshInterval configures how often connectivity is checked, in addition to
+// checks whenever the network changes.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.interval.Set(interval)
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Refresh checks connectivity again.
+func (m *Module) Refresh() {
+	m.refreshFn()
+}
+
+// Stream starts the module.
+func (m *Module) Stream(s bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	info := m.check()
+	for {
+		s.Output(outputFunc(info))
+		select {
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+			continue
+		case <-connectivity.Next():
+		case <-m.scheduler.C:
+		case <-m.refreshCh:
+		}
+		wasCaptive := info.Captive()
+		info = m.check()
+		if info.Captive() != wasCaptive {
+			interval := m.interval.Get().(time.Duration)
+			if info.Captive() {
+				interval = captiveInterval
+			}
+			m.scheduler.Every(interval)
+		}
+	}
+}
+
+// Portals redirect the check, so redirects must not be followed.
+var client = &http.Client{
+	Transport: httpclient.Client().Transport,
+	Timeout:   10 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// check checks for a captive portal, unless the machine is known to be offline.
+func (m *Module) check() Info {
+	i := Info{State: Offline, Checked: timing.Now()}
+	if !connectivity.Online() {
+		return i
+	}
+	checkURL := m.checkURL.Get().(string)
+	resp, err := client.Get(checkURL)
+	if err != nil {
+		l.Fine("%s: Connectivity check failed: %v", l.ID(m), err)
+		return i
+	}
+	defer resp.Body.Close()
+	// Drain the body so that the connection can be reused.
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		i.State = Online
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		i.State = Captive
+		i.PortalURL = checkURL
+		if loc, err := resp.Location(); err == nil {
+			i.PortalURL = loc.String()
+		}
+	case resp.StatusCode == http.StatusOK:
+		// Some portals serve the login page in place of the response.
+		i.State = Captive
+		i.PortalURL = checkURL
+	default:
+		l.Fine("%s: Unexpected response from %s: %s", l.ID(m), checkURL, resp.Status)
+	}
+	return i
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captive
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/httpclient"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	mu     sync.Mutex
+	opened []string
+)
+
+func init() {
+	connectivity.SetForTest(true)
+	// Failed checks should not be retried in tests.
+	httpclient.SetRetries(0)
+	openURL = func(url string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		opened = append(opened, url)
+		return nil
+	}
+}
+
+func openedURLs() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]string(nil), opened...)
+}
+
+// testPortal is a server that either responds to connectivity checks as
+// expected, or behaves like a captive portal.
+type testPortal struct {
+	*httptest.Server
+	sync.Mutex
+	status int
+}
+
+func (p *testPortal) set(status int) {
+	p.Lock()
+	defer p.Unlock()
+	p.status = status
+}
+
+func newTestPortal() *testPortal {
+	p := &testPortal{status: http.StatusNoContent}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.Lock()
+		status := p.status
+		p.Unlock()
+		switch status {
+		case http.StatusFound:
+			http.Redirect(w, r, "/login?from=check", status)
+		case http.StatusOK:
+			w.Write([]byte("<html>Please log in</html>"))
+		default:
+			w.WriteHeader(status)
+		}
+	}))
+	return p
+}
+
+func stateOutput(i Info) bar.Output {
+	return outputs.Textf("%s %s", i.State, i.PortalURL)
+}
+
+func TestCaptive(t *testing.T) {
+	p := newTestPortal()
+	defer p.Close()
+	testBar.New(t)
+
+	m := New().CheckURL(p.URL + "/generate_204").Output(stateOutput)
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"online "})
+
+	p.set(http.StatusFound)
+	now := timing.Now()
+	require.Equal(t, 5*time.Minute, testBar.Tick().Sub(now), "default interval")
+	testBar.NextOutput("on tick").AssertText(
+		[]string{"captive " + p.URL + "/login?from=check"}, "portal redirect")
+
+	p.set(http.StatusOK)
+	now = timing.Now()
+	require.Equal(t, captiveInterval, testBar.Tick().Sub(now),
+		"checks more often while captive")
+	testBar.NextOutput("on tick").AssertText(
+		[]string{"captive " + p.URL + "/generate_204"}, "portal page served in place")
+
+	p.set(http.StatusNoContent)
+	testBar.Tick()
+	testBar.NextOutput("after logging in").AssertText([]string{"online "})
+	now = timing.Now()
+	require.Equal(t, 5*time.Minute, testBar.Tick().Sub(now),
+		"normal interval restored")
+	testBar.NextOutput("on tick").AssertText([]string{"online "})
+
+	p.set(http.StatusInternalServerError)
+	m.Refresh()
+	testBar.NextOutput("on refresh").AssertText([]string{"offline "},
+		"unexpected response")
+
+	p.set(http.StatusFound)
+	connectivity.SetForTest(false)
+	defer connectivity.SetForTest(true)
+	testBar.NextOutput("on disconnect").AssertText([]string{"offline "},
+		"without network connection")
+
+	connectivity.SetForTest(true)
+	testBar.NextOutput("on reconnect").AssertText(
+		[]string{"captive " + p.URL + "/login?from=check"})
+
+	m.CheckURL("http://127.0.0.1:0/generate_204")
+	m.Refresh()
+	testBar.NextOutput("on refresh").AssertText([]string{"offline "},
+		"connection failure")
+}
+
+func TestDefaultOutput(t *testing.T) {
+	p := newTestPortal()
+	defer p.Close()
+	testBar.New(t)
+
+	mu.Lock()
+	opened = nil
+	mu.Unlock()
+
+	m := New().CheckURL(p.URL + "/generate_204")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertEmpty("while online")
+
+	p.set(http.StatusFound)
+	m.Refresh()
+	out := testBar.NextOutput("on refresh")
+	out.AssertText([]string{"Captive portal"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "captive portal is urgent")
+
+	out.At(0).LeftClick()
+	for i := 0; i < 100 && len(openedURLs()) == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Equal(t, []string{p.URL + "/login?from=check"}, openedURLs(),
+		"opens portal on click")
+}
+
+func TestInfo(t *testing.T) {
+	require.False(t, Info{}.Online())
+	require.False(t, Info{}.Captive())
+	require.Equal(t, "unknown", Info{}.State.String())
+	require.Equal(t, "offline", Offline.String())
+	require.True(t, Info{State: Online}.Online())
+	require.NoError(t, Info{State: Online, PortalURL: "http://x"}.OpenPortal())
+	require.NotContains(t, openedURLs(), "http://x", "not opened unless captive")
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capture provides a bar module that starts and stops screen
+// recordings using wf-recorder or OBS, and shows when a recording is active
+// along with its duration and size.
+package capture // import "barista.run/modules/capture"
+
+import (
+	"fmt"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/core"
+	"barista.run/format"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+)
+
+// Info represents the state of the screen recorder.
+type Info struct {
+	// Recorder is the name of the recorder, "wf-recorder" or "obs".
+	Recorder string
+	// Recording is true while a recording is in progress.
+	Recording bool
+	// External is true if the recording was not started by this module, e.g.
+	// a wf-recorder process started from a terminal.
+	External bool
+	// Elapsed is the duration of the current recording.
+	Elapsed time.Duration
+	// Size is the size of the current recording, if known.
+	Size unit.Datasize
+	// File is the path of the current recording, if known.
+	File string
+
+	connected bool
+	ctrl      recorder
+	refresh   func()
+}
+
+// Connected returns false if the recorder cannot be controlled, e.g. because
+// OBS is not running.
+func (i Info) Connected() bool { return i.connected }
+
+// Start starts a new recording.
+func (i Info) Start() { i.do("start", i.ctrl.start) }
+
+// Stop stops the current recording.
+func (i Info) Stop() { i.do("stop", i.ctrl.stop) }
+
+// Toggle starts a recording if none is in progress, or stops the current one.
+func (i Info) Toggle() {
+	if i.Recording {
+		i.Stop()
+	} else {
+		i.Start()
+	}
+}
+
+func (i Info) do(action string, fn func() error) {
+	if err := fn(); err != nil {
+		l.Log("Failed to %s %s recording: %v", action, i.Recorder, err)
+	}
+	i.refresh()
+}
+
+// recorder abstracts the control interface of a screen recorder.
+type recorder interface {
+	name() string
+	// status fills in the state of the recorder, returning an error if it
+	// cannot be reached.
+	status(*Info) error
+	start() error
+	stop() error
+}
+
+// Module represents a bar module that controls a screen recorder.
+type Module struct {
+	recorder   recorder
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+func newModule(r recorder) *Module {
+	m := &Module{recorder: r, scheduler: timing.NewScheduler().Every(time.Second)}
+	l.Label(m, r.name())
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		if !i.Connected() {
+			return nil
+		}
+		if !i.Recording {
+			return outputs.Text("rec").OnClick(click.Left(i.Start))
+		}
+		out := outputs.Textf("REC %s", formatElapsed(i.Elapsed))
+		if i.Size > 0 {
+			out = outputs.Textf("REC %s %s", formatElapsed(i.Elapsed), format.Bytesize(i.Size))
+		}
+		return out.Urgent(true).OnClick(click.Left(i.Stop))
+	})
+	return m
+}
+
+// formatElapsed formats a duration as minutes and seconds, with hours if
+// needed, e.g. "4:05" or "1:02:03".
+func formatElapsed(d time.Duration) string {
+	s := int(d.Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency. Since the duration of an
+// active recording is shown, the default is every second.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	refreshCh := make(chan struct{}, 1)
+	refresh := func() {
+		select {
+		case refreshCh <- struct{}{}:
+		default:
+		}
+	}
+
+	for {
+		i := Info{Recorder: m.recorder.name(), ctrl: m.recorder, refresh: refresh}
+		if err := m.recorder.status(&i); err != nil {
+			l.Fine("%s: %v", l.ID(m), err)
+		} else {
+			i.connected = true
+		}
+		sink.Output(outputFunc(i))
+		select {
+		case <-m.scheduler.C:
+		case <-refreshCh:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
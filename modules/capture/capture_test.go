@@ -0,0 +1,145 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRecorder struct {
+	sync.Mutex
+	err       error
+	recording bool
+	elapsed   time.Duration
+	size      unit.Datasize
+	actions   chan string
+}
+
+func (f *fakeRecorder) name() string { return "fake" }
+
+func (f *fakeRecorder) status(i *Info) error {
+	f.Lock()
+	defer f.Unlock()
+	i.Recording, i.Elapsed, i.Size = f.recording, f.elapsed, f.size
+	return f.err
+}
+
+func (f *fakeRecorder) set(recording bool) error {
+	f.Lock()
+	defer f.Unlock()
+	f.recording = recording
+	return f.err
+}
+
+func (f *fakeRecorder) start() error {
+	f.actions <- "start"
+	return f.set(true)
+}
+
+func (f *fakeRecorder) stop() error {
+	f.actions <- "stop"
+	return f.set(false)
+}
+
+func TestFormatElapsed(t *testing.T) {
+	for _, tc := range []struct {
+		d        time.Duration
+		expected string
+	}{
+		{0, "0:00"},
+		{5 * time.Second, "0:05"},
+		{4*time.Minute + 5*time.Second + 900*time.Millisecond, "4:05"},
+		{59*time.Minute + 59*time.Second, "59:59"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+	} {
+		require.Equal(t, tc.expected, formatElapsed(tc.d), "%v", tc.d)
+	}
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	f := &fakeRecorder{actions: make(chan string, 10)}
+	testBar.Run(newModule(f))
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"rec"})
+
+	out.At(0).LeftClick()
+	require.Equal(t, "start", <-f.actions)
+	out = testBar.NextOutput("on start recording")
+	out.AssertText([]string{"REC 0:00"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "recording is urgent")
+
+	f.Lock()
+	f.elapsed = 83 * time.Second
+	f.size = 4500 * unit.Kilobyte
+	f.Unlock()
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"REC 1:23 4.5 MB"})
+
+	out.At(0).LeftClick()
+	require.Equal(t, "stop", <-f.actions)
+	testBar.NextOutput("on stop recording").AssertText([]string{"rec"})
+
+	f.Lock()
+	f.err = errors.New("not running")
+	f.Unlock()
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertEmpty()
+}
+
+func TestCustomOutput(t *testing.T) {
+	testBar.New(t)
+	f := &fakeRecorder{actions: make(chan string, 10)}
+	m := newModule(f).RefreshInterval(time.Minute)
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %v", i.Recorder, i.Recording).
+			OnClick(func(bar.Event) { i.Toggle() })
+	})
+	testBar.Run(m)
+
+	start := timing.Now()
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"fake false"})
+
+	out.At(0).LeftClick()
+	require.Equal(t, "start", <-f.actions)
+	out = testBar.NextOutput("on toggle")
+	out.AssertText([]string{"fake true"})
+
+	f.Lock()
+	f.err = errors.New("failed")
+	f.Unlock()
+	out.At(0).LeftClick()
+	require.Equal(t, "stop", <-f.actions)
+	testBar.NextOutput("on failed toggle").AssertText([]string{"fake false"})
+
+	now := testBar.Tick()
+	require.Equal(t, time.Minute, now.Sub(start))
+	testBar.NextOutput("on refresh").AssertText([]string{"fake false"})
+}
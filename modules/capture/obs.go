@@ -0,0 +1,222 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/martinlindhe/unit"
+	"golang.org/x/net/websocket"
+)
+
+// OBS constructs a module that records using OBS Studio, controlled through
+// obs-websocket (version 5, included with OBS 28 and newer) at the given URL,
+// e.g. "ws://localhost:4455". The password can be empty if authentication is
+// disabled. Recordings are saved using the settings in OBS.
+func OBS(url, password string) *Module {
+	return newModule(&obs{url: url, password: password})
+}
+
+// Overridden in tests.
+var obsTimeout = 5 * time.Second
+
+// obs is a minimal obs-websocket client. It does not subscribe to any events,
+// and makes requests one at a time, reconnecting as needed.
+type obs struct {
+	url      string
+	password string
+
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	nextID int
+}
+
+// obs-websocket opcodes.
+const (
+	opHello           = 0
+	opIdentify        = 1
+	opIdentified      = 2
+	opRequest         = 6
+	opRequestResponse = 7
+)
+
+type obsMessage struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+}
+
+type obsHello struct {
+	Authentication *struct {
+		Challenge string `json:"challenge"`
+		Salt      string `json:"salt"`
+	} `json:"authentication"`
+}
+
+type obsIdentify struct {
+	RPCVersion         int    `json:"rpcVersion"`
+	Authentication     string `json:"authentication,omitempty"`
+	EventSubscriptions int    `json:"eventSubscriptions"`
+}
+
+type obsRequest struct {
+	RequestType string `json:"requestType"`
+	RequestID   string `json:"requestId"`
+}
+
+type obsResponse struct {
+	RequestID     string `json:"requestId"`
+	RequestStatus struct {
+		Result  bool   `json:"result"`
+		Code    int    `json:"code"`
+		Comment string `json:"comment"`
+	} `json:"requestStatus"`
+	ResponseData json.RawMessage `json:"responseData"`
+}
+
+type obsRecordStatus struct {
+	OutputActive   bool    `json:"outputActive"`
+	OutputDuration float64 `json:"outputDuration"` // milliseconds
+	OutputBytes    float64 `json:"outputBytes"`
+}
+
+func (o *obs) name() string { return "obs" }
+
+// obsAuth computes the authentication string from the password and the
+// challenge and salt sent by the server.
+func obsAuth(password, salt, challenge string) string {
+	secret := sha256.Sum256([]byte(password + salt))
+	auth := sha256.Sum256([]byte(
+		base64.StdEncoding.EncodeToString(secret[:]) + challenge))
+	return base64.StdEncoding.EncodeToString(auth[:])
+}
+
+func (o *obs) receiveLocked(op int, data interface{}) error {
+	for {
+		var msg obsMessage
+		if err := websocket.JSON.Receive(o.conn, &msg); err != nil {
+			return err
+		}
+		if msg.Op == op {
+			return json.Unmarshal(msg.D, data)
+		}
+	}
+}
+
+func (o *obs) sendLocked(op int, data interface{}) error {
+	d, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return websocket.JSON.Send(o.conn, obsMessage{op, d})
+}
+
+func (o *obs) connectLocked() error {
+	cfg, err := websocket.NewConfig(o.url, "http://localhost/")
+	if err != nil {
+		return err
+	}
+	cfg.Protocol = []string{"obswebsocket.json"}
+	if o.conn, err = websocket.DialConfig(cfg); err != nil {
+		return err
+	}
+	o.conn.SetDeadline(time.Now().Add(obsTimeout))
+	var hello obsHello
+	if err := o.receiveLocked(opHello, &hello); err != nil {
+		return err
+	}
+	id := obsIdentify{RPCVersion: 1}
+	if a := hello.Authentication; a != nil {
+		id.Authentication = obsAuth(o.password, a.Salt, a.Challenge)
+	}
+	if err := o.sendLocked(opIdentify, id); err != nil {
+		return err
+	}
+	return o.receiveLocked(opIdentified, &struct{}{})
+}
+
+// request makes a request, connecting first if needed, and stores the
+// response data in result if it is not nil.
+func (o *obs) request(requestType string, result interface{}) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	err := o.requestLocked(requestType, result)
+	if _, ok := err.(obsError); !ok && err != nil && o.conn != nil {
+		// Connection errors leave the protocol in an unknown state.
+		o.conn.Close()
+		o.conn = nil
+	}
+	return err
+}
+
+// obsError is an error returned by obs-websocket for a request.
+type obsError struct {
+	code    int
+	comment string
+}
+
+func (e obsError) Error() string {
+	return fmt.Sprintf("obs-websocket error %d: %s", e.code, e.comment)
+}
+
+func (o *obs) requestLocked(requestType string, result interface{}) error {
+	if o.conn == nil {
+		if err := o.connectLocked(); err != nil {
+			return err
+		}
+	}
+	o.conn.SetDeadline(time.Now().Add(obsTimeout))
+	o.nextID++
+	id := strconv.Itoa(o.nextID)
+	if err := o.sendLocked(opRequest, obsRequest{requestType, id}); err != nil {
+		return err
+	}
+	var resp obsResponse
+	for resp.RequestID != id {
+		resp = obsResponse{}
+		if err := o.receiveLocked(opRequestResponse, &resp); err != nil {
+			return err
+		}
+	}
+	if !resp.RequestStatus.Result {
+		return obsError{resp.RequestStatus.Code, resp.RequestStatus.Comment}
+	}
+	if result == nil || len(resp.ResponseData) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.ResponseData, result); err != nil {
+		return obsError{0, err.Error()}
+	}
+	return nil
+}
+
+func (o *obs) status(i *Info) error {
+	var s obsRecordStatus
+	if err := o.request("GetRecordStatus", &s); err != nil {
+		return err
+	}
+	i.Recording = s.OutputActive
+	i.Elapsed = time.Duration(s.OutputDuration) * time.Millisecond
+	i.Size = unit.Datasize(s.OutputBytes) * unit.Byte
+	return nil
+}
+
+func (o *obs) start() error { return o.request("StartRecord", nil) }
+func (o *obs) stop() error  { return o.request("StopRecord", nil) }
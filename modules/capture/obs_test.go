@@ -0,0 +1,156 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// fakeOBS is a minimal obs-websocket server.
+type fakeOBS struct {
+	*httptest.Server
+	password string
+
+	sync.Mutex
+	recording bool
+	duration  float64
+	bytes     float64
+	requests  []string
+}
+
+func (f *fakeOBS) send(ws *websocket.Conn, op int, d interface{}) {
+	data, _ := json.Marshal(d)
+	websocket.JSON.Send(ws, obsMessage{op, data})
+}
+
+func (f *fakeOBS) handle(ws *websocket.Conn) {
+	defer ws.Close()
+	hello := map[string]interface{}{"obsWebSocketVersion": "5.0.0", "rpcVersion": 1}
+	if f.password != "" {
+		hello["authentication"] = map[string]string{"challenge": "ch", "salt": "na"}
+	}
+	f.send(ws, opHello, hello)
+	var msg obsMessage
+	if websocket.JSON.Receive(ws, &msg) != nil || msg.Op != opIdentify {
+		return
+	}
+	var id obsIdentify
+	json.Unmarshal(msg.D, &id)
+	if f.password != "" && id.Authentication != obsAuth(f.password, "na", "ch") {
+		return
+	}
+	// Events should be ignored.
+	f.send(ws, 5, map[string]string{"eventType": "ExitStarted"})
+	f.send(ws, opIdentified, map[string]int{"negotiatedRpcVersion": 1})
+	for websocket.JSON.Receive(ws, &msg) == nil {
+		var req obsRequest
+		json.Unmarshal(msg.D, &req)
+		resp := map[string]interface{}{
+			"requestType":   req.RequestType,
+			"requestId":     req.RequestID,
+			"requestStatus": map[string]interface{}{"result": true, "code": 100},
+		}
+		f.Lock()
+		f.requests = append(f.requests, req.RequestType)
+		switch req.RequestType {
+		case "GetRecordStatus":
+			resp["responseData"] = map[string]interface{}{
+				"outputActive":   f.recording,
+				"outputDuration": f.duration,
+				"outputBytes":    f.bytes,
+			}
+		case "StartRecord", "StopRecord":
+			if f.recording == (req.RequestType == "StartRecord") {
+				resp["requestStatus"] = map[string]interface{}{
+					"result": false, "code": 500, "comment": "Output state"}
+			}
+			f.recording = req.RequestType == "StartRecord"
+		}
+		f.Unlock()
+		f.send(ws, opRequestResponse, resp)
+	}
+}
+
+func (f *fakeOBS) url() string {
+	return "ws" + strings.TrimPrefix(f.URL, "http")
+}
+
+func newFakeOBS(password string) *fakeOBS {
+	f := &fakeOBS{password: password}
+	f.Server = httptest.NewServer(websocket.Handler(f.handle))
+	return f
+}
+
+func TestOBS(t *testing.T) {
+	testBar.New(t)
+	f := newFakeOBS("hunter2")
+	defer f.Close()
+
+	testBar.Run(OBS(f.url(), "hunter2"))
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"rec"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on start recording")
+	out.AssertText([]string{"REC 0:00"})
+
+	f.Lock()
+	f.duration = 3723000
+	f.bytes = 1.5e9
+	f.Unlock()
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"REC 1:02:03 1.5 GB"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on stop recording").AssertText([]string{"rec"})
+
+	f.Lock()
+	defer f.Unlock()
+	require.Equal(t, []string{
+		"GetRecordStatus", "StartRecord", "GetRecordStatus",
+		"GetRecordStatus", "StopRecord", "GetRecordStatus",
+	}, f.requests, "uses a single connection")
+}
+
+func TestOBSErrors(t *testing.T) {
+	testBar.New(t)
+	obsTimeout = time.Second
+	f := newFakeOBS("hunter2")
+	defer f.Close()
+
+	testBar.Run(OBS(f.url(), "wrong"))
+	testBar.NextOutput("on bad password").AssertEmpty()
+
+	testBar.New(t)
+	testBar.Run(OBS("ws://127.0.0.1:1", ""))
+	testBar.NextOutput("when not running").AssertEmpty()
+
+	o := &obs{url: f.url(), password: "hunter2"}
+	require.NoError(t, o.start())
+	err := o.start()
+	require.Equal(t, obsError{500, "Output state"}, err)
+	require.NotNil(t, o.conn, "keeps connection on request errors")
+}
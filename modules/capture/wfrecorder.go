@@ -0,0 +1,145 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+)
+
+// WfRecorder constructs a module that records using wf-recorder, saving
+// recordings to the given directory. Any additional arguments are passed to
+// wf-recorder, e.g. "-a" to record audio. The module also shows recordings by
+// wf-recorder processes that it did not start, and can stop them.
+func WfRecorder(dir string, args ...string) *Module {
+	return newModule(&wfRecorder{dir: dir, args: args})
+}
+
+// Overridden in tests.
+var (
+	fs          = afero.NewOsFs()
+	execCommand = exec.Command
+	kill        = syscall.Kill
+)
+
+type wfRecorder struct {
+	dir  string
+	args []string
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	done    chan struct{}
+	file    string
+	started time.Time
+}
+
+func (w *wfRecorder) name() string { return "wf-recorder" }
+
+// runningLocked returns true if a recording started by the module is still
+// in progress.
+func (w *wfRecorder) runningLocked() bool {
+	if w.cmd == nil {
+		return false
+	}
+	select {
+	case <-w.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (w *wfRecorder) status(i *Info) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.runningLocked() {
+		i.Recording = findProcess("wf-recorder") > 0
+		i.External = i.Recording
+		return nil
+	}
+	i.Recording = true
+	i.Elapsed = timing.Now().Sub(w.started)
+	i.File = w.file
+	if s, err := fs.Stat(w.file); err == nil {
+		i.Size = unit.Datasize(s.Size()) * unit.Byte
+	}
+	return nil
+}
+
+func (w *wfRecorder) start() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.runningLocked() || findProcess("wf-recorder") > 0 {
+		return errors.New("already recording")
+	}
+	file := filepath.Join(w.dir, timing.Now().Format("2006-01-02_15-04-05")+".mp4")
+	args := append(append([]string{}, w.args...), "-f", file)
+	cmd := execCommand("wf-recorder", args...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	w.cmd, w.done, w.file, w.started = cmd, done, file, timing.Now()
+	return nil
+}
+
+// stop interrupts wf-recorder, which finishes writing the file and exits.
+func (w *wfRecorder) stop() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.runningLocked() {
+		return w.cmd.Process.Signal(os.Interrupt)
+	}
+	if pid := findProcess("wf-recorder"); pid > 0 {
+		return kill(pid, syscall.SIGINT)
+	}
+	return errors.New("not recording")
+}
+
+// findProcess returns the ID of a process with the given name, or 0 if there
+// is no such process.
+func findProcess(name string) int {
+	dirs, err := afero.ReadDir(fs, "/proc")
+	if err != nil {
+		return 0
+	}
+	for _, d := range dirs {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		comm, err := afero.ReadFile(fs, filepath.Join("/proc", d.Name(), "comm"))
+		if err == nil && strings.TrimSpace(string(comm)) == name {
+			return pid
+		}
+	}
+	return 0
+}
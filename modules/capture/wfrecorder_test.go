@@ -0,0 +1,117 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capture
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWfRecorder(t *testing.T) {
+	testBar.New(t)
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/proc/1/comm", []byte("systemd\n"), 0644)
+	started := make(chan []string, 1)
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		started <- append([]string{name}, args...)
+		return exec.Command("sh", "-c", "trap 'exit 0' INT; while :; do sleep 0.01; done")
+	}
+	timing.AdvanceTo(time.Date(2018, 6, 1, 13, 14, 15, 0, time.UTC))
+
+	m := WfRecorder("/videos", "-a")
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"rec"})
+
+	out.At(0).LeftClick()
+	file := "/videos/2018-06-01_13-14-15.mp4"
+	require.Equal(t, []string{"wf-recorder", "-a", "-f", file}, <-started)
+	out = testBar.NextOutput("on start recording")
+	out.AssertText([]string{"REC 0:00"})
+
+	afero.WriteFile(fs, file, make([]byte, 2000), 0644)
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"REC 0:01 2.0 kB"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on stop").AssertText([]string{"REC 0:01 2.0 kB"},
+		"until wf-recorder exits")
+	w := m.recorder.(*wfRecorder)
+	w.mu.Lock()
+	done := w.done
+	w.mu.Unlock()
+	<-done
+	testBar.Tick()
+	testBar.NextOutput("on exit").AssertText([]string{"rec"})
+}
+
+func TestWfRecorderExternal(t *testing.T) {
+	testBar.New(t)
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/proc/1/comm", []byte("systemd\n"), 0644)
+	afero.WriteFile(fs, "/proc/345/comm", []byte("wf-recorder\n"), 0644)
+	execCommand = func(string, ...string) *exec.Cmd {
+		require.Fail(t, "should not start wf-recorder")
+		return nil
+	}
+	type signal struct {
+		pid int
+		sig syscall.Signal
+	}
+	signals := make(chan signal, 1)
+	kill = func(pid int, sig syscall.Signal) error {
+		signals <- signal{pid, sig}
+		fs.Remove("/proc/345/comm")
+		return nil
+	}
+
+	var external bool
+	m := WfRecorder("/videos")
+	m.Output(func(i Info) bar.Output {
+		external = i.External
+		return outputs.Textf("%v", i.Recording).
+			OnClick(click.Map{}.
+				Left(i.Start).
+				Right(i.Stop).
+				Handle)
+	})
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"true"})
+	require.True(t, external)
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on start while recording").AssertText([]string{"true"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	require.Equal(t, signal{345, syscall.SIGINT}, <-signals)
+	testBar.NextOutput("on stop").AssertText([]string{"false"})
+	require.False(t, external)
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	testBar.NextOutput("on stop when not recording").AssertText([]string{"false"})
+}
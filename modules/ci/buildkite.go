@@ -0,0 +1,91 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ci
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Buildkite constructs a module for pipelines in a Buildkite organisation,
+// using an API access token with the read_builds scope. Pipelines are
+// specified using their slug, as shown in the pipeline's URL.
+func Buildkite(apiToken, org string, pipelines ...string) *Module {
+	return newModule(&buildkite{api: buildkiteAPI, token: apiToken, org: org}, pipelines)
+}
+
+// Overridden in tests.
+var buildkiteAPI = "https://api.buildkite.com/v2"
+
+type buildkite struct {
+	api   string
+	token string
+	org   string
+}
+
+func (k *buildkite) name() string { return "buildkite" }
+
+type buildkiteBuild struct {
+	Number     int64      `json:"number"`
+	State      string     `json:"state"`
+	Branch     string     `json:"branch"`
+	WebURL     string     `json:"web_url"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// buildkiteStatus maps the build state to a Status. A "failing" build is still
+// running, but has at least one failed job.
+var buildkiteStatus = map[string]Status{
+	"scheduled": Running,
+	"running":   Running,
+	"blocked":   Running,
+	"canceling": Running,
+	"passed":    Passed,
+	"failing":   Failed,
+	"failed":    Failed,
+	"canceled":  Canceled,
+}
+
+func (k *buildkite) latest(pipeline string) (Build, error) {
+	req, err := http.NewRequest("GET", k.api+"/organizations/"+url.PathEscape(k.org)+
+		"/pipelines/"+url.PathEscape(pipeline)+"/builds?per_page=1", nil)
+	if err != nil {
+		return Build{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	var builds []buildkiteBuild
+	if err := getJSON("buildkite", req, &builds); err != nil {
+		return Build{}, err
+	}
+	if len(builds) == 0 {
+		return Build{}, nil
+	}
+	kb := builds[0]
+	b := Build{
+		Number: kb.Number,
+		Status: buildkiteStatus[kb.State],
+		Branch: kb.Branch,
+		URL:    kb.WebURL,
+	}
+	if kb.StartedAt != nil {
+		b.Started = *kb.StartedAt
+	}
+	if kb.FinishedAt != nil {
+		b.Finished = *kb.FinishedAt
+	}
+	return b, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ci
+
+import (
+	"net/http"
+	"testing"
+
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildkite(t *testing.T) {
+	testBar.New(t)
+	f := newFakeServer(func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer token"
+	})
+	defer f.Close()
+	buildkiteAPI = f.URL
+
+	f.respond("/organizations/acme/pipelines/api/builds?per_page=1", `[{
+		"id":"f62a1b4d","number":123,"state":"passed","branch":"main",
+		"web_url":"https://buildkite.com/acme/api/builds/123",
+		"created_at":"2018-06-01T11:58:00.000Z",
+		"started_at":"2018-06-01T12:00:00.000Z",
+		"finished_at":"2018-06-01T12:05:00.000Z"}]`)
+	f.respond("/organizations/acme/pipelines/web/builds?per_page=1", `[{
+		"number":8,"state":"scheduled","branch":"feature",
+		"web_url":"https://buildkite.com/acme/web/builds/8",
+		"started_at":null,"finished_at":null}]`)
+	f.respond("/organizations/acme/pipelines/new/builds?per_page=1", `[]`)
+
+	m := Buildkite("token", "acme", "api", "web", "new").Output(formatBuilds)
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{
+		"api#123:passed@main 12:00-12:05;web#8:running@feature;new#0:unknown;"})
+
+	for state, status := range map[string]string{
+		"running":   "running",
+		"blocked":   "running",
+		"failing":   "failed",
+		"failed":    "failed",
+		"canceled":  "canceled",
+		"skipped":   "unknown",
+		"not_run":   "unknown",
+		"canceling": "running",
+	} {
+		f.respond("/organizations/acme/pipelines/new/builds?per_page=1",
+			`[{"number":1,"state":"`+state+`","branch":"main"}]`)
+		testBar.Tick()
+		testBar.NextOutput("on refresh").AssertText([]string{
+			"api#123:passed@main 12:00-12:05;web#8:running@feature;" +
+				"new#1:" + status + "@main;"}, state)
+	}
+
+	testBar.New(t)
+	testBar.Run(Buildkite("wrong", "acme", "api"))
+	errs := testBar.NextOutput("with wrong token").AssertError()
+	require.Contains(t, errs[0], "buildkite: 401 Unauthorized")
+
+	testBar.New(t)
+	f.respond("/organizations/acme/pipelines/bad/builds?per_page=1", `{"builds":[]}`)
+	testBar.Run(Buildkite("token", "acme", "bad"))
+	testBar.NextOutput("with invalid response").AssertError()
+}
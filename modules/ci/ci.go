@@ -0,0 +1,234 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ci provides a bar module that shows the result of the latest build
+// of one or more pipelines on Jenkins, Buildkite, or CircleCI.
+package ci // import "barista.run/modules/ci"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/httpclient"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/colors"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Status represents the state of a build.
+type Status int
+
+// Valid values for Status.
+const (
+	// Unknown is used for pipelines without any builds, or for build states
+	// that do not map to any of the other values.
+	Unknown Status = iota
+	Running
+	Passed
+	Failed
+	Canceled
+)
+
+func (s Status) String() string {
+	switch s {
+	case Running:
+		return "running"
+	case Passed:
+		return "passed"
+	case Failed:
+		return "failed"
+	case Canceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// Build represents the latest build of a pipeline.
+type Build struct {
+	// Pipeline is the name of the pipeline, as given to the constructor.
+	Pipeline string
+	Number   int64
+	Status   Status
+	Branch   string
+	Started  time.Time
+	Finished time.Time
+	// URL is the web page for the build.
+	URL string
+}
+
+// Open opens the build's web page in the default browser.
+func (b Build) Open() {
+	if b.URL == "" {
+		return
+	}
+	if err := openURL(b.URL); err != nil {
+		l.Log("Failed to open %s: %v", b.URL, err)
+	}
+}
+
+// Info represents the latest builds of all watched pipelines.
+type Info struct {
+	// Builds has the latest build of each pipeline, in the order given to the
+	// constructor.
+	Builds []Build
+}
+
+// Failed returns the builds that failed.
+func (i Info) Failed() []Build {
+	return i.filter(Failed)
+}
+
+// Running returns the builds that are still running.
+func (i Info) Running() []Build {
+	return i.filter(Running)
+}
+
+// Passed returns true if the latest build of every pipeline passed.
+func (i Info) Passed() bool {
+	return len(i.filter(Passed)) == len(i.Builds)
+}
+
+func (i Info) filter(s Status) []Build {
+	r := []Build{}
+	for _, b := range i.Builds {
+		if b.Status == s {
+			r = append(r, b)
+		}
+	}
+	return r
+}
+
+// provider abstracts a CI service.
+type provider interface {
+	name() string
+	// latest returns the latest build of a pipeline, or a build with an
+	// Unknown status if the pipeline has not been built yet.
+	latest(pipeline string) (Build, error)
+}
+
+// Module represents a bar module that shows the latest build results.
+type Module struct {
+	provider   provider
+	pipelines  []string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+func newModule(p provider, pipelines []string) *Module {
+	m := &Module{
+		provider:  p,
+		pipelines: pipelines,
+		scheduler: timing.NewScheduler().Every(2 * time.Minute),
+	}
+	l.Label(m, p.name())
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		if f := i.Failed(); len(f) > 0 {
+			names := make([]string, len(f))
+			for idx, b := range f {
+				names[idx] = b.Pipeline
+			}
+			return outputs.Textf("CI failed: %s", strings.Join(names, ", ")).
+				Color(colors.Scheme("bad")).Urgent(true).
+				OnClick(click.Left(f[0].Open))
+		}
+		if r := i.Running(); len(r) > 0 {
+			return outputs.Textf("CI running").OnClick(click.Left(r[0].Open))
+		}
+		if i.Passed() {
+			return outputs.Text("CI ok")
+		}
+		return outputs.Text("CI ?")
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	var info Info
+	var err error
+	poller := connectivity.NewPoller(func() { info, err = m.fetch() })
+	poller.Poll()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(poller.Output(func() bar.Output { return outputFunc(info) }))
+		select {
+		case <-m.scheduler.C:
+			poller.Poll()
+		case <-connectivity.Next():
+			poller.Poll()
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func (m *Module) fetch() (Info, error) {
+	i := Info{Builds: make([]Build, len(m.pipelines))}
+	for idx, p := range m.pipelines {
+		b, err := m.provider.latest(p)
+		if err != nil {
+			return i, err
+		}
+		b.Pipeline = p
+		i.Builds[idx] = b
+	}
+	return i, nil
+}
+
+// getJSON sends a request, decoding the JSON response into result.
+func getJSON(provider string, req *http.Request, result interface{}) error {
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s: %s", provider, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Overridden in tests.
+var openURL = func(url string) error {
+	return exec.Command("xdg-open", url).Run()
+}
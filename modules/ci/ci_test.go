@@ -0,0 +1,168 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ci
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	connectivity.SetForTest(true)
+}
+
+type fakeProvider struct {
+	sync.Mutex
+	builds map[string]Build
+	err    error
+}
+
+func (f *fakeProvider) name() string { return "fake" }
+
+func (f *fakeProvider) latest(pipeline string) (Build, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.builds[pipeline], f.err
+}
+
+func (f *fakeProvider) set(pipeline string, b Build) {
+	f.Lock()
+	defer f.Unlock()
+	f.builds[pipeline] = b
+}
+
+// fakeServer serves fixed responses by path after checking authentication.
+type fakeServer struct {
+	*httptest.Server
+
+	sync.Mutex
+	responses map[string]string
+}
+
+func newFakeServer(authorized func(*http.Request) bool) *fakeServer {
+	f := &fakeServer{responses: map[string]string{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"Unauthorized"}`)
+			return
+		}
+		f.Lock()
+		defer f.Unlock()
+		resp, ok := f.responses[r.URL.RequestURI()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"Not Found"}`)
+			return
+		}
+		fmt.Fprint(w, resp)
+	}))
+	return f
+}
+
+func (f *fakeServer) respond(uri, response string) {
+	f.Lock()
+	defer f.Unlock()
+	f.responses[uri] = response
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	colors.LoadFromMap(map[string]string{"bad": "#ff0000"})
+	var opened []string
+	var openedMu sync.Mutex
+	openURL = func(url string) error {
+		openedMu.Lock()
+		defer openedMu.Unlock()
+		opened = append(opened, url)
+		return nil
+	}
+
+	f := &fakeProvider{builds: map[string]Build{}}
+	f.set("api", Build{Number: 10, Status: Passed, URL: "https://ci/api/10"})
+	f.set("web", Build{Number: 4, Status: Passed, URL: "https://ci/web/4"})
+	m := newModule(f, []string{"api", "web"})
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"CI ok"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	f.set("web", Build{Number: 5, Status: Running, URL: "https://ci/web/5"})
+	testBar.Tick()
+	out = testBar.NextOutput("on build start")
+	out.AssertText([]string{"CI running"})
+	out.At(0).LeftClick()
+
+	f.set("api", Build{Number: 11, Status: Failed, URL: "https://ci/api/11"})
+	f.set("web", Build{Number: 5, Status: Failed, URL: "https://ci/web/5"})
+	testBar.Tick()
+	out = testBar.NextOutput("on failure")
+	out.AssertText([]string{"CI failed: api, web"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "urgent on failure")
+	c, _ := out.At(0).Segment().GetColor()
+	require.Equal(t, colors.Scheme("bad"), c)
+	out.At(0).LeftClick()
+
+	openedMu.Lock()
+	require.Equal(t, []string{"https://ci/web/5", "https://ci/api/11"}, opened,
+		"opens running build, then the first failed build")
+	openedMu.Unlock()
+
+	m.Output(func(i Info) bar.Output {
+		s := ""
+		for _, b := range i.Builds {
+			s += fmt.Sprintf("%s#%d:%s;", b.Pipeline, b.Number, b.Status)
+		}
+		return outputs.Text(s)
+	})
+	testBar.NextOutput("on output change").AssertText(
+		[]string{"api#11:failed;web#5:failed;"})
+
+	f.set("api", Build{Number: 12, Status: Canceled})
+	f.set("web", Build{})
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText(
+		[]string{"api#12:canceled;web#0:unknown;"})
+
+	f.Lock()
+	f.err = errors.New("something went wrong")
+	f.Unlock()
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	f := &fakeProvider{builds: map[string]Build{}}
+	f.set("api", Build{Status: Canceled})
+	testBar.Run(newModule(f, []string{"api"}))
+	testBar.NextOutput("on start").AssertText([]string{"CI ?"})
+	require.Equal(t, "unknown", Status(-1).String())
+	Build{}.Open()
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ci
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CircleCI constructs a module for CircleCI projects, using a personal API
+// token. Projects are specified using their slug, e.g. "gh/org/repo". The
+// status of a pipeline combines the status of all its workflows.
+func CircleCI(apiToken string, projects ...string) *Module {
+	return newModule(&circleci{api: circleciAPI, token: apiToken}, projects)
+}
+
+// Overridden in tests.
+var circleciAPI = "https://circleci.com/api/v2"
+
+type circleci struct {
+	api   string
+	token string
+}
+
+func (c *circleci) name() string { return "circleci" }
+
+type circlePipeline struct {
+	ID        string    `json:"id"`
+	Number    int64     `json:"number"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	VCS       struct {
+		Branch string `json:"branch"`
+	} `json:"vcs"`
+}
+
+type circleWorkflow struct {
+	Status    string     `json:"status"`
+	StoppedAt *time.Time `json:"stopped_at"`
+}
+
+// circleStatus maps workflow statuses to a Status, in increasing order of
+// precedence when combining the workflows of a pipeline.
+var circleStatus = map[string]Status{
+	"success":      Passed,
+	"canceled":     Canceled,
+	"running":      Running,
+	"on_hold":      Running,
+	"failing":      Failed,
+	"failed":       Failed,
+	"error":        Failed,
+	"unauthorized": Failed,
+}
+
+var statusPrecedence = map[Status]int{Unknown: 0, Passed: 1, Canceled: 2, Running: 3, Failed: 4}
+
+func (c *circleci) get(path string, result interface{}) error {
+	req, err := http.NewRequest("GET", c.api+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Circle-Token", c.token)
+	return getJSON("circleci", req, result)
+}
+
+func (c *circleci) latest(project string) (Build, error) {
+	var pipelines struct {
+		Items []circlePipeline `json:"items"`
+	}
+	if err := c.get("/project/"+project+"/pipeline", &pipelines); err != nil {
+		return Build{}, err
+	}
+	if len(pipelines.Items) == 0 {
+		return Build{}, nil
+	}
+	p := pipelines.Items[0]
+	b := Build{
+		Number:  p.Number,
+		Branch:  p.VCS.Branch,
+		Started: p.CreatedAt,
+		URL:     fmt.Sprintf("https://app.circleci.com/pipelines/%s/%d", project, p.Number),
+	}
+	if p.State == "errored" {
+		// The configuration could not be processed, so there are no workflows.
+		b.Status = Failed
+		return b, nil
+	}
+	var workflows struct {
+		Items []circleWorkflow `json:"items"`
+	}
+	if err := c.get("/pipeline/"+p.ID+"/workflow", &workflows); err != nil {
+		return Build{}, err
+	}
+	for _, w := range workflows.Items {
+		s := circleStatus[w.Status]
+		if statusPrecedence[s] > statusPrecedence[b.Status] {
+			b.Status = s
+		}
+		if w.StoppedAt != nil && w.StoppedAt.After(b.Finished) {
+			b.Finished = *w.StoppedAt
+		}
+	}
+	if b.Status == Running {
+		b.Finished = time.Time{}
+	}
+	return b, nil
+}
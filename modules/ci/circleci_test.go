@@ -0,0 +1,103 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ci
+
+import (
+	"net/http"
+	"testing"
+
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircleCI(t *testing.T) {
+	testBar.New(t)
+	f := newFakeServer(func(r *http.Request) bool {
+		return r.Header.Get("Circle-Token") == "token"
+	})
+	defer f.Close()
+	circleciAPI = f.URL
+
+	f.respond("/project/gh/acme/api/pipeline", `{"items":[
+		{"id":"p2","number":52,"state":"created","created_at":"2018-06-01T12:00:00Z",
+			"vcs":{"branch":"main"}},
+		{"id":"p1","number":51,"state":"created","created_at":"2018-06-01T11:00:00Z",
+			"vcs":{"branch":"main"}}],"next_page_token":"abc"}`)
+	f.respond("/pipeline/p2/workflow", `{"items":[
+		{"id":"w1","name":"test","status":"success","stopped_at":"2018-06-01T12:04:00Z"},
+		{"id":"w2","name":"deploy","status":"success","stopped_at":"2018-06-01T12:07:00Z"}]}`)
+	f.respond("/project/gh/acme/web/pipeline", `{"items":[
+		{"id":"p3","number":3,"state":"errored","created_at":"2018-06-01T12:30:00Z",
+			"vcs":{"branch":"config"}}]}`)
+	f.respond("/project/gh/acme/new/pipeline", `{"items":[]}`)
+
+	m := CircleCI("token", "gh/acme/api", "gh/acme/web", "gh/acme/new").Output(formatBuilds)
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{
+		"gh/acme/api#52:passed@main 12:00-12:07;" +
+			"gh/acme/web#3:failed@config 12:30;gh/acme/new#0:unknown;"})
+
+	for _, tc := range []struct{ first, second, status string }{
+		{"success", "running", "running"},
+		{"on_hold", "failed", "failed"},
+		{"canceled", "success", "canceled"},
+		{"error", "running", "failed"},
+		{"not_run", "not_run", "unknown"},
+	} {
+		f.respond("/pipeline/p2/workflow", `{"items":[
+			{"id":"w1","status":"`+tc.first+`","stopped_at":null},
+			{"id":"w2","status":"`+tc.second+`","stopped_at":null}]}`)
+		testBar.Tick()
+		testBar.NextOutput("on refresh").AssertText([]string{
+			"gh/acme/api#52:" + tc.status + "@main 12:00;" +
+				"gh/acme/web#3:failed@config 12:30;gh/acme/new#0:unknown;"},
+			"%s + %s", tc.first, tc.second)
+	}
+
+	f.respond("/pipeline/p2/workflow", `{"items":[
+		{"id":"w1","status":"success","stopped_at":"2018-06-01T12:04:00Z"},
+		{"id":"w2","status":"running","stopped_at":null}]}`)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{
+		"gh/acme/api#52:running@main 12:00;" +
+			"gh/acme/web#3:failed@config 12:30;gh/acme/new#0:unknown;"},
+		"running pipelines are not finished")
+
+	testBar.New(t)
+	m = CircleCI("token", "gh/acme/web")
+	testBar.Run(m)
+	out = testBar.NextOutput("default output")
+	out.AssertText([]string{"CI failed: gh/acme/web"})
+	var opened string
+	openURL = func(url string) error {
+		opened = url
+		return nil
+	}
+	out.At(0).LeftClick()
+	require.Equal(t, "https://app.circleci.com/pipelines/gh/acme/web/3", opened)
+
+	testBar.New(t)
+	testBar.Run(CircleCI("wrong", "gh/acme/api"))
+	errs := testBar.NextOutput("with wrong token").AssertError()
+	require.Contains(t, errs[0], "circleci: 401 Unauthorized")
+
+	testBar.New(t)
+	f.respond("/project/gh/acme/gone/pipeline", `{"items":[{"id":"p9","number":9}]}`)
+	testBar.Run(CircleCI("token", "gh/acme/gone"))
+	errs = testBar.NextOutput("with missing workflows").AssertError()
+	require.Contains(t, errs[0], "404 Not Found")
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ci
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Jenkins constructs a module for jobs on a Jenkins server, e.g.
+// "https://ci.example.com", authenticating with a username and API token
+// (both can be empty for anonymous access). Jobs in folders are specified
+// using slashes, e.g. "team/project/main" for a multibranch pipeline.
+func Jenkins(server, username, apiToken string, jobs ...string) *Module {
+	return newModule(&jenkins{
+		server:   strings.TrimSuffix(server, "/"),
+		username: username,
+		token:    apiToken,
+	}, jobs)
+}
+
+type jenkins struct {
+	server   string
+	username string
+	token    string
+}
+
+func (j *jenkins) name() string { return "jenkins" }
+
+type jenkinsJob struct {
+	LastBuild *struct {
+		Number    int64   `json:"number"`
+		Result    *string `json:"result"`
+		Building  bool    `json:"building"`
+		Timestamp int64   `json:"timestamp"` // ms
+		Duration  int64   `json:"duration"`  // ms
+		URL       string  `json:"url"`
+	} `json:"lastBuild"`
+}
+
+func (j *jenkins) latest(job string) (Build, error) {
+	path := "/job/" + strings.Join(strings.Split(job, "/"), "/job/")
+	req, err := http.NewRequest("GET", j.server+path+
+		"/api/json?tree=lastBuild[number,result,building,timestamp,duration,url]", nil)
+	if err != nil {
+		return Build{}, err
+	}
+	if j.username != "" {
+		req.SetBasicAuth(j.username, j.token)
+	}
+	var r jenkinsJob
+	if err := getJSON("jenkins", req, &r); err != nil {
+		return Build{}, err
+	}
+	lb := r.LastBuild
+	if lb == nil {
+		return Build{}, nil
+	}
+	b := Build{
+		Number:  lb.Number,
+		Started: time.Unix(0, lb.Timestamp*int64(time.Millisecond)),
+		URL:     lb.URL,
+	}
+	if lb.Building {
+		b.Status = Running
+		return b, nil
+	}
+	b.Finished = b.Started.Add(time.Duration(lb.Duration) * time.Millisecond)
+	result := ""
+	if lb.Result != nil {
+		result = *lb.Result
+	}
+	switch result {
+	case "SUCCESS":
+		b.Status = Passed
+	case "FAILURE", "UNSTABLE":
+		b.Status = Failed
+	case "ABORTED":
+		b.Status = Canceled
+	}
+	return b, nil
+}
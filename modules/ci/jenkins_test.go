@@ -0,0 +1,100 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ci
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+const jenkinsTree = "/api/json?tree=lastBuild[number,result,building,timestamp,duration,url]"
+
+func formatBuilds(i Info) bar.Output {
+	s := ""
+	for _, b := range i.Builds {
+		s += fmt.Sprintf("%s#%d:%s", b.Pipeline, b.Number, b.Status)
+		if b.Branch != "" {
+			s += "@" + b.Branch
+		}
+		if !b.Started.IsZero() {
+			s += " " + b.Started.UTC().Format("15:04")
+		}
+		if !b.Finished.IsZero() {
+			s += "-" + b.Finished.UTC().Format("15:04")
+		}
+		s += ";"
+	}
+	return outputs.Text(s)
+}
+
+func TestJenkins(t *testing.T) {
+	testBar.New(t)
+	f := newFakeServer(func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return !ok || user == "admin" && pass == "token"
+	})
+	defer f.Close()
+
+	start := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	f.respond("/job/api"+jenkinsTree, fmt.Sprintf(`{"_class":"hudson.model.FreeStyleProject",
+		"lastBuild":{"number":42,"result":"SUCCESS","building":false,
+		"timestamp":%d,"duration":300000,"url":"%s/job/api/42/"}}`, start, f.URL))
+	f.respond("/job/team/job/web/job/main"+jenkinsTree, fmt.Sprintf(`{
+		"lastBuild":{"number":7,"result":null,"building":true,
+		"timestamp":%d,"duration":0,"url":"%s/job/team/job/web/job/main/7/"}}`, start, f.URL))
+	f.respond("/job/new"+jenkinsTree, `{"lastBuild":null}`)
+
+	m := Jenkins(f.URL+"/", "admin", "token", "api", "team/web/main", "new").Output(formatBuilds)
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{
+		"api#42:passed 12:00-12:05;team/web/main#7:running 12:00;new#0:unknown;"})
+
+	for result, status := range map[string]string{
+		`"FAILURE"`:   "failed",
+		`"UNSTABLE"`:  "failed",
+		`"ABORTED"`:   "canceled",
+		`"NOT_BUILT"`: "unknown",
+		`null`:        "unknown",
+	} {
+		f.respond("/job/new"+jenkinsTree, fmt.Sprintf(`{"lastBuild":{"number":1,"result":%s,
+			"building":false,"timestamp":%d,"duration":60000,"url":""}}`, result, start))
+		testBar.Tick()
+		testBar.NextOutput("on refresh").AssertText([]string{
+			"api#42:passed 12:00-12:05;team/web/main#7:running 12:00;" +
+				"new#1:" + status + " 12:00-12:01;"}, result)
+	}
+
+	testBar.New(t)
+	testBar.Run(Jenkins(f.URL, "", "", "api"))
+	testBar.NextOutput("anonymous").AssertText([]string{"CI ok"})
+
+	testBar.New(t)
+	testBar.Run(Jenkins(f.URL, "admin", "wrong", "api"))
+	errs := testBar.NextOutput("with wrong token").AssertError()
+	require.Contains(t, errs[0], "401 Unauthorized")
+
+	testBar.New(t)
+	testBar.Run(Jenkins(f.URL, "admin", "token", "api", "missing"))
+	errs = testBar.NextOutput("with missing job").AssertError()
+	require.Contains(t, errs[0], "404 Not Found")
+}
@@ -0,0 +1,421 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clipboard provides a bar module that shows a preview of the
+// clipboard contents, and keeps a short in-memory history of recent entries.
+//
+// On wayland, the module uses wl-clipboard (wl-paste and wl-copy), which
+// supports compositors that implement the wlr-data-control protocol, and
+// updates whenever the selection changes. On X11, the module uses xclip and
+// checks the selection periodically.
+//
+// Entries are removed when the clipboard is cleared, so that contents cleared
+// by a password manager do not linger in the history.
+package clipboard // import "barista.run/modules/clipboard"
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents the clipboard contents and history.
+type Info struct {
+	// Contents is the current text in the clipboard, or empty if the clipboard
+	// is empty or does not contain text.
+	Contents string
+	// History contains previous clipboard entries, newest first. It does not
+	// include the current contents.
+	History []string
+	// Index is the entry currently selected for display, where 0 is the
+	// current contents and i > 0 is History[i-1].
+	Index int
+
+	m *Module
+}
+
+// Len returns the number of entries that can be selected, including the
+// current contents.
+func (i Info) Len() int {
+	return len(i.History) + 1
+}
+
+// Empty returns true if the clipboard and history are both empty.
+func (i Info) Empty() bool {
+	return i.Contents == "" && len(i.History) == 0
+}
+
+// Selected returns the text of the selected entry.
+func (i Info) Selected() string {
+	if i.Index == 0 || i.Index > len(i.History) {
+		return i.Contents
+	}
+	return i.History[i.Index-1]
+}
+
+// Preview returns the selected entry on a single line, truncated to at most
+// the given number of characters.
+func (i Info) Preview(maxLen int) string {
+	return preview(i.Selected(), maxLen)
+}
+
+func preview(text string, maxLen int) string {
+	r := []rune(strings.Join(strings.Fields(text), " "))
+	if maxLen <= 0 || len(r) <= maxLen {
+		return string(r)
+	}
+	return string(r[:maxLen-1]) + "⋯"
+}
+
+// Next selects the next older entry, wrapping around to the current contents.
+func (i Info) Next() {
+	if i.m != nil {
+		i.m.history.selectIndex(i.Index+1, true)
+	}
+}
+
+// Previous selects the next newer entry, wrapping around to the oldest.
+func (i Info) Previous() {
+	if i.m != nil {
+		i.m.history.selectIndex(i.Index-1, true)
+	}
+}
+
+// Clear clears the clipboard if the current contents are selected, otherwise
+// it removes the selected entry from the history.
+func (i Info) Clear() {
+	if i.m == nil {
+		return
+	}
+	if i.Index > 0 {
+		i.m.history.remove(i.Index - 1)
+		return
+	}
+	if err := i.m.backend.write(""); err != nil {
+		l.Log("Failed to clear clipboard: %v", err)
+	}
+	i.m.history.refresh()
+}
+
+// Restore copies the selected entry back into the clipboard.
+func (i Info) Restore() {
+	if i.m == nil || i.Index == 0 {
+		return
+	}
+	if err := i.m.backend.write(i.Selected()); err != nil {
+		l.Log("Failed to copy to clipboard: %v", err)
+	}
+	i.m.history.refresh()
+}
+
+// backend contains the commands used to access a selection.
+type backend struct {
+	// watch prints a line whenever the selection changes, or nil if the
+	// selection must be polled.
+	watch []string
+	// paste prints the selection as text.
+	paste []string
+	// copy sets the selection to its standard input.
+	copy []string
+	// clear clears the selection, or nil to copy empty text instead.
+	clear []string
+}
+
+// Overridden in tests.
+var (
+	getenv      = os.Getenv
+	execCommand = exec.Command
+)
+
+func waylandBackend(primary bool) backend {
+	var p []string
+	if primary {
+		p = []string{"--primary"}
+	}
+	args := func(cmd string, extra ...string) []string {
+		return append(append([]string{cmd}, p...), extra...)
+	}
+	return backend{
+		watch: args("wl-paste", "--watch", "echo"),
+		paste: args("wl-paste", "--no-newline", "--type", "text"),
+		copy:  args("wl-copy"),
+		clear: args("wl-copy", "--clear"),
+	}
+}
+
+func x11Backend(primary bool) backend {
+	sel := "clipboard"
+	if primary {
+		sel = "primary"
+	}
+	return backend{
+		paste: []string{"xclip", "-out", "-selection", sel, "-target", "UTF8_STRING"},
+		copy:  []string{"xclip", "-in", "-selection", sel},
+	}
+}
+
+func detectBackend(primary bool) backend {
+	if getenv("WAYLAND_DISPLAY") != "" {
+		return waylandBackend(primary)
+	}
+	return x11Backend(primary)
+}
+
+// read returns the text in the selection. Failures of the paste command are
+// treated as an empty selection, since both wl-paste and xclip fail when
+// nothing (or nothing textual) is selected, but a missing command is an error.
+func (b backend) read() (string, error) {
+	out, err := execCommand(b.paste[0], b.paste[1:]...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", nil
+	}
+	return string(out), err
+}
+
+func (b backend) write(text string) error {
+	if text == "" && b.clear != nil {
+		return execCommand(b.clear[0], b.clear[1:]...).Run()
+	}
+	cmd := execCommand(b.copy[0], b.copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// history tracks the clipboard contents and previous entries. It is shared
+// between the module and click handlers.
+type history struct {
+	sync.Mutex
+	contents string
+	entries  []string
+	index    int
+	notifyFn func()
+}
+
+// update sets the current contents, moving the previous contents into the
+// history unless the clipboard was cleared.
+func (h *history) update(contents string, size int) {
+	h.Lock()
+	defer h.Unlock()
+	if contents != h.contents {
+		entries := h.entries[:0:0]
+		if h.contents != "" && contents != "" {
+			entries = append(entries, h.contents)
+		}
+		for _, e := range h.entries {
+			if e != contents {
+				entries = append(entries, e)
+			}
+		}
+		h.contents = contents
+		h.entries = entries
+		h.index = 0
+	}
+	if len(h.entries) > size {
+		h.entries = h.entries[:size]
+	}
+	if h.index > len(h.entries) {
+		h.index = len(h.entries)
+	}
+}
+
+func (h *history) selectIndex(idx int, wrap bool) {
+	h.Lock()
+	count := len(h.entries) + 1
+	if wrap {
+		idx = (idx + count) % count
+	}
+	if idx < 0 || idx >= count {
+		idx = 0
+	}
+	h.index = idx
+	h.Unlock()
+	h.notifyFn()
+}
+
+func (h *history) remove(idx int) {
+	h.Lock()
+	if idx >= 0 && idx < len(h.entries) {
+		h.entries = append(h.entries[:idx:idx], h.entries[idx+1:]...)
+	}
+	if h.index > len(h.entries) {
+		h.index = len(h.entries)
+	}
+	h.Unlock()
+	h.notifyFn()
+}
+
+func (h *history) refresh() {
+	h.notifyFn()
+}
+
+func (h *history) info(m *Module) Info {
+	h.Lock()
+	defer h.Unlock()
+	return Info{
+		Contents: h.contents,
+		History:  append([]string(nil), h.entries...),
+		Index:    h.index,
+		m:        m,
+	}
+}
+
+// Module represents a bar module that shows the clipboard contents.
+type Module struct {
+	backend    backend
+	history    *history
+	notifyCh   <-chan struct{}
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	size       value.Value     // of int
+	scheduler  *timing.Scheduler
+}
+
+func newModule(primary bool) *Module {
+	m := &Module{
+		backend:   detectBackend(primary),
+		history:   &history{},
+		scheduler: timing.NewScheduler(),
+	}
+	m.history.notifyFn, m.notifyCh = notifier.New()
+	l.Register(m, "outputFunc", "size", "scheduler")
+	m.HistorySize(10)
+	m.RefreshInterval(time.Second)
+	m.Output(func(i Info) bar.Output {
+		if i.Empty() {
+			return nil
+		}
+		txt := i.Preview(30)
+		if i.Index > 0 {
+			txt = fmt.Sprintf("%d/%d %s", i.Index, len(i.History), txt)
+		} else if txt == "" {
+			txt = "(empty)"
+		}
+		return outputs.Text(txt).OnClick(click.Map{}.
+			Left(i.Clear).
+			Right(i.Restore).
+			ScrollUp(i.Previous).
+			ScrollDown(i.Next).
+			Handle)
+	})
+	return m
+}
+
+// New constructs a module for the clipboard selection.
+func New() *Module {
+	return newModule(false)
+}
+
+// Primary constructs a module for the primary selection, i.e. the most
+// recently selected text.
+func Primary() *Module {
+	return newModule(true)
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// HistorySize sets the number of previous entries to keep. Defaults to 10.
+func (m *Module) HistorySize(size int) *Module {
+	m.size.Set(size)
+	return m
+}
+
+// RefreshInterval configures how often the selection is checked on X11.
+// On wayland, the module updates whenever the selection changes.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	var changes <-chan struct{}
+	var errCh <-chan error
+	if watch := m.backend.watch; watch != nil {
+		m.scheduler.Stop()
+		cmd := execCommand(watch[0], watch[1:]...)
+		// Prevent SIGUSR for bar pause/resume from propagating to the
+		// child process, as in shell.Tail.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		stdout, err := cmd.StdoutPipe()
+		if sink.Error(err) {
+			return
+		}
+		if sink.Error(cmd.Start()) {
+			return
+		}
+		defer cmd.Process.Kill()
+		changeCh := make(chan struct{}, 1)
+		exitCh := make(chan error, 1)
+		go func() {
+			s := bufio.NewScanner(stdout)
+			for s.Scan() {
+				select {
+				case changeCh <- struct{}{}:
+				default:
+				}
+			}
+			err := cmd.Wait()
+			if err == nil {
+				err = fmt.Errorf("%s exited", watch[0])
+			}
+			exitCh <- err
+		}()
+		changes, errCh = changeCh, exitCh
+	}
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextSize, done := m.size.Subscribe()
+	defer done()
+
+	for {
+		contents, err := m.backend.read()
+		if sink.Error(err) {
+			return
+		}
+		m.history.update(contents, m.size.Get().(int))
+		sink.Output(outputFunc(m.history.info(m)))
+		select {
+		case <-changes:
+		case err := <-errCh:
+			sink.Error(err)
+			return
+		case <-m.scheduler.C:
+		case <-m.notifyCh:
+		case <-nextSize:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clipboard
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClipboard struct {
+	t     *testing.T
+	file  string
+	watch *os.File
+}
+
+func (f *fakeClipboard) set(text string) {
+	require.NoError(f.t, os.WriteFile(f.file, []byte(text), 0644))
+	if f.watch != nil {
+		f.watch.Write([]byte("\n"))
+	}
+}
+
+func (f *fakeClipboard) get() string {
+	b, _ := os.ReadFile(f.file)
+	return string(b)
+}
+
+// fakeBackend returns a backend that stores the selection in a temporary
+// file. If watch is true, changes are signalled using a pipe instead of
+// polling, and the returned clipboard must be used to make changes.
+func fakeBackend(t *testing.T, watch bool) (backend, *fakeClipboard) {
+	f := &fakeClipboard{t: t, file: filepath.Join(t.TempDir(), "clipboard")}
+	require.NoError(t, os.WriteFile(f.file, nil, 0644))
+	b := backend{
+		paste: []string{"cat", f.file},
+		copy:  []string{"sh", "-c", `cat > "$0"`, f.file},
+	}
+	if !watch {
+		execCommand = exec.Command
+		return b, f
+	}
+	b.watch = []string{"fake-watch"}
+	b.clear = []string{"sh", "-c", `: > "$0"`, f.file}
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	f.watch = w
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		if name != "fake-watch" {
+			return exec.Command(name, args...)
+		}
+		cmd := exec.Command("cat")
+		cmd.Stdin = r
+		return cmd
+	}
+	return b, f
+}
+
+func TestBackends(t *testing.T) {
+	env := map[string]string{}
+	getenv = func(key string) string { return env[key] }
+
+	require.Equal(t, x11Backend(false), detectBackend(false))
+	require.Equal(t, backend{
+		paste: []string{"xclip", "-out", "-selection", "primary", "-target", "UTF8_STRING"},
+		copy:  []string{"xclip", "-in", "-selection", "primary"},
+	}, detectBackend(true))
+
+	env["WAYLAND_DISPLAY"] = "wayland-1"
+	require.Equal(t, backend{
+		watch: []string{"wl-paste", "--watch", "echo"},
+		paste: []string{"wl-paste", "--no-newline", "--type", "text"},
+		copy:  []string{"wl-copy"},
+		clear: []string{"wl-copy", "--clear"},
+	}, detectBackend(false))
+	require.Equal(t, []string{"wl-copy", "--primary", "--clear"},
+		detectBackend(true).clear)
+}
+
+func TestRead(t *testing.T) {
+	execCommand = exec.Command
+	text, err := backend{paste: []string{"echo", "-n", "foo"}}.read()
+	require.NoError(t, err)
+	require.Equal(t, "foo", text)
+
+	text, err = backend{paste: []string{"false"}}.read()
+	require.NoError(t, err, "nothing selected")
+	require.Empty(t, text)
+
+	_, err = backend{paste: []string{"/nonexistent/paste"}}.read()
+	require.Error(t, err, "missing command")
+}
+
+func TestPreview(t *testing.T) {
+	require.Equal(t, "", preview("", 10))
+	require.Equal(t, "foo bar baz", preview("  foo\n\tbar   baz\n", 20))
+	require.Equal(t, "foo bar⋯", preview("foo bar baz", 8))
+	require.Equal(t, "日本語⋯", preview("日本語テキスト", 4))
+	require.Equal(t, "unlimited text", preview("unlimited text", 0))
+}
+
+func TestWatch(t *testing.T) {
+	testBar.New(t)
+	b, clip := fakeBackend(t, true)
+	m := New()
+	m.backend = b
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertEmpty("empty clipboard")
+
+	clip.set("hello world")
+	testBar.NextOutput("on copy").AssertText([]string{"hello world"})
+
+	clip.set("second\nentry")
+	testBar.NextOutput("on copy").AssertText([]string{"second entry"})
+
+	clip.set("a very long entry that does not fit in the bar")
+	out := testBar.NextOutput("on copy")
+	out.AssertText([]string{"a very long entry that does n⋯"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	out = testBar.NextOutput("on scroll")
+	out.AssertText([]string{"1/2 second entry"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	out = testBar.NextOutput("on scroll")
+	out.AssertText([]string{"2/2 hello world"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	out = testBar.NextOutput("on scroll")
+	out.AssertText([]string{"a very long entry that does n⋯"}, "wraps around")
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("on scroll")
+	out.AssertText([]string{"2/2 hello world"}, "wraps around")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	out = testBar.NextOutput("on restore")
+	out.AssertText([]string{"hello world"})
+	require.Equal(t, "hello world", clip.get())
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	out = testBar.NextOutput("on scroll")
+	out.AssertText([]string{"1/2 a very long entry that does n⋯"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("on remove")
+	out.AssertText([]string{"1/1 second entry"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("on scroll")
+	out.AssertText([]string{"hello world"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("on clear")
+	out.AssertText([]string{"(empty)"}, "cleared contents are not kept")
+	require.Empty(t, clip.get())
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	out = testBar.NextOutput("on scroll")
+	out.AssertText([]string{"1/1 second entry"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	testBar.NextOutput("on remove").AssertEmpty("no contents or history")
+
+	clip.watch.Close()
+	testBar.NextOutput("on watch exit").AssertError()
+}
+
+func TestPolling(t *testing.T) {
+	testBar.New(t)
+	b, clip := fakeBackend(t, false)
+	clip.set("foo")
+	m := Primary().HistorySize(2)
+	m.backend = b
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"foo"})
+
+	clip.set("bar")
+	testBar.AssertNoOutput("until refresh")
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"bar"})
+
+	for _, s := range []string{"baz", "quux", "bar"} {
+		clip.set(s)
+		testBar.Tick()
+		testBar.NextOutput("on refresh")
+	}
+
+	var info Info
+	m.Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Text(i.Selected())
+	})
+	testBar.NextOutput("on output func change")
+	require.Equal(t, "bar", info.Contents)
+	require.Equal(t, []string{"quux", "baz"}, info.History,
+		"duplicates removed, limited to history size")
+	require.Equal(t, 3, info.Len())
+
+	m.HistorySize(1)
+	testBar.NextOutput("on history size change")
+	require.Equal(t, []string{"quux"}, info.History)
+
+	info.Previous()
+	testBar.NextOutput("on select")
+	require.Equal(t, 1, info.Index)
+	info.Clear()
+	testBar.NextOutput("on remove")
+	require.Empty(t, info.History)
+	require.Equal(t, 0, info.Index)
+
+	info.Clear()
+	testBar.NextOutput("on clear")
+	require.Empty(t, clip.get(), "clears by copying empty text")
+	require.True(t, info.Empty())
+
+	Info{}.Next()
+	Info{}.Clear()
+	Info{}.Restore()
+}
+
+func TestMissingCommand(t *testing.T) {
+	testBar.New(t)
+	execCommand = exec.Command
+	m := New()
+	m.backend = backend{watch: []string{"/nonexistent/watch"}}
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertError("missing watch command")
+
+	testBar.New(t)
+	m = New()
+	m.backend = backend{paste: []string{"/nonexistent/paste"}}
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertError("missing paste command")
+}
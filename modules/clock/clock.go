@@ -22,6 +22,7 @@ import (
 	"barista.run/bar"
 	"barista.run/base/value"
 	"barista.run/base/watchers/localtz"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -31,6 +32,9 @@ import (
 // timezone, output format, and granularity.
 type Module struct {
 	config value.Value
+	// Only used to wrap output functions, which are stored in the config
+	// together with their granularity.
+	outputFunc core.OutputFunc
 }
 
 type config struct {
@@ -51,10 +55,11 @@ func defaultOutput(now time.Time) bar.Output {
 func Zone(timezone *time.Location) *Module {
 	m := &Module{}
 	l.Register(m, "config")
+	m.outputFunc.Set(defaultOutput)
 	m.config.Set(config{
 		timezone:    timezone,
 		granularity: time.Minute,
-		outputFunc:  defaultOutput,
+		outputFunc:  m.outputFunc.Get().(func(time.Time) bar.Output),
 	})
 	return m
 }
@@ -86,8 +91,9 @@ func (m *Module) Output(
 	outputFunc func(time.Time) bar.Output,
 ) *Module {
 	c := m.getConfig()
+	m.outputFunc.Set(outputFunc)
 	c.granularity = granularity
-	c.outputFunc = outputFunc
+	c.outputFunc = m.outputFunc.Get().(func(time.Time) bar.Output)
 	m.config.Set(c)
 	return m
 }
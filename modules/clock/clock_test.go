@@ -176,3 +176,23 @@ func TestZones(t *testing.T) {
 	testBar.LatestOutput(1).At(1).AssertText(
 		"05:15:01", "on timezone change")
 }
+
+func TestPanickingOutput(t *testing.T) {
+	testBar.New(t)
+	timing.AdvanceTo(fixedTime)
+
+	local := Local().Output(time.Second, func(now time.Time) bar.Output {
+		if now.Second() > 0 {
+			panic("oops")
+		}
+		return outputs.Text(now.Format("15:04:05"))
+	})
+	testBar.Run(local)
+	testBar.NextOutput().AssertText(
+		[]string{"00:00:00"}, "on start")
+
+	timing.NextTick()
+	out := testBar.NextOutput("on panic")
+	out.AssertText([]string{"00:00", "!"}, "falls back to default output")
+	require.EqualError(t, out.At(1).Segment().GetError(), "panic: oops")
+}
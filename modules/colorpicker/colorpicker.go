@@ -0,0 +1,332 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package colorpicker provides a bar module that picks a colour from the
+// screen when clicked, shows it as the segment background, and copies its
+// hex value to the clipboard. Recently picked colours are kept in a short
+// history.
+//
+// On wayland, colours are picked using slurp and grim, and copied using
+// wl-copy. On X11, xcolor and xclip are used instead.
+package colorpicker // import "barista.run/modules/colorpicker"
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	"barista.run/colors"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+)
+
+// Info represents the picked colours.
+type Info struct {
+	// History contains the picked colours as "#rrggbb", newest first.
+	History []string
+	// Index is the position of the selected colour in History.
+	Index int
+
+	m *Module
+}
+
+// Selected returns the hex value of the selected colour, or an empty string
+// if no colour has been picked.
+func (i Info) Selected() string {
+	if i.Index >= len(i.History) {
+		return ""
+	}
+	return i.History[i.Index]
+}
+
+// Color returns the selected colour, or nil if no colour has been picked.
+func (i Info) Color() colors.ColorfulColor {
+	if hex := i.Selected(); hex != "" {
+		return colors.Hex(hex)
+	}
+	return nil
+}
+
+// Contrast returns black or white, whichever is more legible on the
+// selected colour.
+func (i Info) Contrast() colors.ColorfulColor {
+	if c := i.Color(); c != nil {
+		if l, _, _ := c.Colorful().Lab(); l < 0.6 {
+			return colors.Hex("#ffffff")
+		}
+	}
+	return colors.Hex("#000000")
+}
+
+// Pick starts the colour picker. The picked colour is added to the history
+// and copied to the clipboard. Pick does not wait for the user to pick a
+// colour.
+func (i Info) Pick() {
+	if i.m != nil {
+		go i.m.pick()
+	}
+}
+
+// Copy copies the selected colour to the clipboard.
+func (i Info) Copy() {
+	if i.m == nil || i.Selected() == "" {
+		return
+	}
+	if err := i.m.backend.copy(i.Selected()); err != nil {
+		l.Log("Failed to copy %s: %v", i.Selected(), err)
+	}
+}
+
+// Next selects the next older colour, wrapping around to the newest.
+func (i Info) Next() {
+	if i.m != nil {
+		i.m.history.selectIndex(i.Index + 1)
+	}
+}
+
+// Previous selects the next newer colour, wrapping around to the oldest.
+func (i Info) Previous() {
+	if i.m != nil {
+		i.m.history.selectIndex(i.Index - 1)
+	}
+}
+
+// Overridden in tests.
+var (
+	getenv      = os.Getenv
+	execCommand = exec.Command
+)
+
+// backend picks colours and copies text using external commands.
+type backend struct {
+	pickFunc func() (string, error)
+	copyCmd  []string
+}
+
+func (b backend) copy(text string) error {
+	cmd := execCommand(b.copyCmd[0], b.copyCmd[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+func detectBackend() backend {
+	if getenv("WAYLAND_DISPLAY") != "" {
+		return backend{pickWayland, []string{"wl-copy"}}
+	}
+	return backend{pickX11, []string{"xclip", "-in", "-selection", "clipboard"}}
+}
+
+// errCancelled is returned if the user cancels picking a colour.
+var errCancelled = errors.New("cancelled")
+
+func output(name string, args ...string) ([]byte, error) {
+	out, err := execCommand(name, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, errCancelled
+	}
+	return out, err
+}
+
+// pickWayland selects a point using slurp, and captures that pixel as a PPM
+// image using grim.
+func pickWayland() (string, error) {
+	geometry, err := output("slurp", "-p")
+	if err != nil {
+		return "", err
+	}
+	img, err := output("grim", "-g", strings.TrimSpace(string(geometry)), "-t", "ppm", "-")
+	if err != nil {
+		return "", err
+	}
+	return parsePPM(img)
+}
+
+func pickX11() (string, error) {
+	out, err := output("xcolor", "--format", "hex")
+	if err != nil {
+		return "", err
+	}
+	return normalize(string(out))
+}
+
+// normalize validates a hex colour and returns it as "#rrggbb".
+func normalize(hex string) (string, error) {
+	hex = strings.ToLower(strings.TrimSpace(hex))
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b); err != nil || len(hex) != 7 {
+		return "", fmt.Errorf("invalid colour %q", hex)
+	}
+	return hex, nil
+}
+
+// parsePPM returns the colour of the first pixel in a binary PPM (P6) image
+// with 8 bits per channel.
+func parsePPM(img []byte) (string, error) {
+	var width, height, maxVal int
+	r := bytes.NewReader(img)
+	var magic string
+	if _, err := fmt.Fscan(r, &magic, &width, &height, &maxVal); err != nil {
+		return "", fmt.Errorf("invalid PPM image: %v", err)
+	}
+	if magic != "P6" {
+		return "", fmt.Errorf("unsupported PPM format %q", magic)
+	}
+	if maxVal != 255 || width < 1 || height < 1 {
+		return "", fmt.Errorf("unsupported PPM image: %dx%d, maximum %d", width, height, maxVal)
+	}
+	// A single whitespace character separates the header from the pixels.
+	pixel := make([]byte, 4)
+	if n, _ := r.Read(pixel); n < 4 {
+		return "", errors.New("invalid PPM image: missing pixel data")
+	}
+	return fmt.Sprintf("#%02x%02x%02x", pixel[1], pixel[2], pixel[3]), nil
+}
+
+// history tracks the picked colours. It is shared between the module and
+// click handlers.
+type history struct {
+	sync.Mutex
+	colors   []string
+	index    int
+	notifyFn func()
+}
+
+func (h *history) add(color string, size int) {
+	h.Lock()
+	colors := []string{color}
+	for _, c := range h.colors {
+		if c != color && len(colors) < size {
+			colors = append(colors, c)
+		}
+	}
+	h.colors = colors
+	h.index = 0
+	h.Unlock()
+	h.notifyFn()
+}
+
+func (h *history) resize(size int) {
+	h.Lock()
+	if len(h.colors) > size {
+		h.colors = h.colors[:size]
+	}
+	if h.index >= len(h.colors) {
+		h.index = 0
+	}
+	h.Unlock()
+}
+
+func (h *history) selectIndex(idx int) {
+	h.Lock()
+	if count := len(h.colors); count > 0 {
+		h.index = (idx%count + count) % count
+	}
+	h.Unlock()
+	h.notifyFn()
+}
+
+func (h *history) info(m *Module) Info {
+	h.Lock()
+	defer h.Unlock()
+	return Info{History: append([]string(nil), h.colors...), Index: h.index, m: m}
+}
+
+// Module represents a bar module that picks colours from the screen.
+type Module struct {
+	backend    backend
+	history    *history
+	notifyCh   <-chan struct{}
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	size       value.Value     // of int
+}
+
+// New constructs a colour picker module.
+func New() *Module {
+	m := &Module{backend: detectBackend(), history: &history{}}
+	m.history.notifyFn, m.notifyCh = notifier.New()
+	l.Register(m, "outputFunc", "size")
+	m.HistorySize(5)
+	m.Output(func(i Info) bar.Output {
+		handler := click.Map{}.
+			Left(i.Pick).
+			Right(i.Copy).
+			ScrollUp(i.Previous).
+			ScrollDown(i.Next).
+			Handle
+		if i.Selected() == "" {
+			return outputs.Text("pick").OnClick(handler)
+		}
+		return outputs.Text(i.Selected()).
+			Background(i.Color()).
+			Color(i.Contrast()).
+			OnClick(handler)
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// HistorySize sets the number of colours to keep. Defaults to 5.
+func (m *Module) HistorySize(size int) *Module {
+	m.size.Set(size)
+	return m
+}
+
+func (m *Module) pick() {
+	color, err := m.backend.pickFunc()
+	if err == errCancelled {
+		return
+	}
+	if err != nil {
+		l.Log("Failed to pick colour: %v", err)
+		return
+	}
+	if err := m.backend.copy(color); err != nil {
+		l.Log("Failed to copy %s: %v", color, err)
+	}
+	m.history.add(color, m.size.Get().(int))
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextSize, done := m.size.Subscribe()
+	defer done()
+	for {
+		sink.Output(outputFunc(m.history.info(m)))
+		select {
+		case <-m.notifyCh:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		case <-nextSize:
+			m.history.resize(m.size.Get().(int))
+		}
+	}
+}
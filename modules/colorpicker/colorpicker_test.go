@@ -0,0 +1,217 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package colorpicker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCommands replaces the picker and clipboard commands with shell
+// commands. The picked colour is read from the pick file, and copied text is
+// written to the clipboard file.
+func fakeCommands(t *testing.T) (pick, clip string) {
+	dir := t.TempDir()
+	pick = filepath.Join(dir, "pick")
+	clip = filepath.Join(dir, "clipboard")
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		switch name {
+		case "slurp":
+			return exec.Command("echo", "12,34 1x1")
+		case "grim":
+			return exec.Command("sh", "-c", `printf "P6\n1 1\n255\n"; cat "$0"`, pick)
+		case "wl-copy", "xclip":
+			return exec.Command("sh", "-c", `cat > "$0"`, clip)
+		}
+		return exec.Command(name, args...)
+	}
+	return pick, clip
+}
+
+func TestBackends(t *testing.T) {
+	env := map[string]string{}
+	getenv = func(key string) string { return env[key] }
+
+	require.Equal(t, []string{"xclip", "-in", "-selection", "clipboard"},
+		detectBackend().copyCmd)
+
+	env["WAYLAND_DISPLAY"] = "wayland-1"
+	require.Equal(t, []string{"wl-copy"}, detectBackend().copyCmd)
+}
+
+func TestXColor(t *testing.T) {
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		require.Equal(t, "xcolor", name)
+		return exec.Command("echo", "#A0B1C2")
+	}
+	color, err := pickX11()
+	require.NoError(t, err)
+	require.Equal(t, "#a0b1c2", color)
+
+	execCommand = func(string, ...string) *exec.Cmd {
+		return exec.Command("echo", "not a colour")
+	}
+	_, err = pickX11()
+	require.Error(t, err)
+
+	execCommand = func(string, ...string) *exec.Cmd {
+		return exec.Command("false")
+	}
+	_, err = pickX11()
+	require.Equal(t, errCancelled, err)
+
+	execCommand = func(string, ...string) *exec.Cmd {
+		return exec.Command("/nonexistent/xcolor")
+	}
+	_, err = pickX11()
+	require.Error(t, err)
+	require.NotEqual(t, errCancelled, err)
+}
+
+func TestParsePPM(t *testing.T) {
+	color, err := parsePPM([]byte("P6\n1 1\n255\n\x12\x34\x56"))
+	require.NoError(t, err)
+	require.Equal(t, "#123456", color)
+
+	color, err = parsePPM([]byte("P6 2 1 255 \xff\x00\x80\x00\x00\x00"))
+	require.NoError(t, err)
+	require.Equal(t, "#ff0080", color, "uses first pixel")
+
+	for _, img := range []string{
+		"",
+		"P3\n1 1\n255\n18 52 86\n",
+		"P6\n1 1\n65535\n\x00\x12\x00\x34\x00\x56",
+		"P6\n1 1\n255\n\x12\x34",
+	} {
+		_, err = parsePPM([]byte(img))
+		require.Error(t, err, "%q", img)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	i := Info{}
+	require.Empty(t, i.Selected())
+	require.Nil(t, i.Color())
+	i.Pick()
+	i.Copy()
+	i.Next()
+	i.Previous()
+
+	i = Info{History: []string{"#ffff00", "#000080"}, Index: 1}
+	require.Equal(t, "#000080", i.Selected())
+	require.Equal(t, colors.Hex("#000080"), i.Color())
+	require.Equal(t, colors.Hex("#ffffff"), i.Contrast())
+	i.Index = 0
+	require.Equal(t, colors.Hex("#000000"), i.Contrast())
+}
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	for start := time.Now(); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			require.Fail(t, "timed out", msg)
+		}
+	}
+}
+
+func TestModule(t *testing.T) {
+	env := map[string]string{"WAYLAND_DISPLAY": "wayland-1"}
+	getenv = func(key string) string { return env[key] }
+	pick, clip := fakeCommands(t)
+
+	testBar.New(t)
+	m := New().HistorySize(3)
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"pick"})
+
+	pickColor := func(rgb string) {
+		require.NoError(t, os.WriteFile(pick, []byte(rgb), 0644))
+		out.At(0).LeftClick()
+		out = testBar.NextOutput("on pick")
+	}
+
+	pickColor("\x12\x34\x56")
+	out.AssertText([]string{"#123456"})
+	bg, _ := out.At(0).Segment().GetBackground()
+	require.Equal(t, colors.Hex("#123456"), bg)
+	fg, _ := out.At(0).Segment().GetColor()
+	require.Equal(t, colors.Hex("#ffffff"), fg)
+	waitFor(t, func() bool {
+		b, _ := os.ReadFile(clip)
+		return string(b) == "#123456"
+	}, "copied to clipboard")
+
+	pickColor("\xff\xff\xff")
+	out.AssertText([]string{"#ffffff"})
+	pickColor("\x00\x00\x00")
+	pickColor("\xff\xff\xff")
+	out.AssertText([]string{"#ffffff"})
+
+	var info Info
+	m.Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Text(i.Selected())
+	})
+	testBar.NextOutput("on output func change")
+	require.Equal(t, []string{"#ffffff", "#000000", "#123456"}, info.History,
+		"duplicates moved to front")
+
+	info.Next()
+	testBar.NextOutput("on select")
+	require.Equal(t, "#000000", info.Selected())
+	info.Previous()
+	testBar.NextOutput("on select")
+	info.Previous()
+	testBar.NextOutput("on select")
+	require.Equal(t, "#123456", info.Selected(), "wraps around")
+
+	require.NoError(t, os.WriteFile(clip, nil, 0644))
+	info.Copy()
+	b, _ := os.ReadFile(clip)
+	require.Equal(t, "#123456", string(b))
+
+	m.HistorySize(1)
+	testBar.NextOutput("on history size change")
+	require.Equal(t, []string{"#ffffff"}, info.History)
+	require.Equal(t, 0, info.Index)
+}
+
+func TestCancelled(t *testing.T) {
+	getenv = func(string) string { return "wayland-1" }
+	picked := make(chan string)
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		picked <- name
+		return exec.Command("false")
+	}
+
+	testBar.New(t)
+	testBar.Run(New())
+	out := testBar.NextOutput("on start")
+	out.At(0).LeftClick()
+	require.Equal(t, "slurp", <-picked)
+	testBar.AssertNoOutput("when cancelled")
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	testBar.AssertNoOutput("copy with nothing picked")
+}
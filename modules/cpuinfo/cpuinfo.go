@@ -0,0 +1,333 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cpuinfo provides an i3bar module that shows CPU utilisation, either
+// for the whole system or for the cgroup that barista is running in.
+package cpuinfo // import "barista.run/modules/cpuinfo"
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/cgroup"
+	"barista.run/base/procstat"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+)
+
+// Info represents CPU utilisation over the most recent refresh interval.
+type Info struct {
+	// Usage is the fraction of available CPU capacity in use, from 0 to 1.
+	Usage float64
+	// CPUs is the available CPU capacity, in CPUs. For a cgroup with a CPU
+	// bandwidth limit, this can be fractional (e.g. 1.5).
+	CPUs float64
+	// Cores contains the utilisation of each online CPU, from 0 to 1, in
+	// order of CPU number. Only available for system-wide modules.
+	Cores []float64
+	// Sockets contains the utilisation of the CPUs in each physical package,
+	// indexed by package ID. Only available for system-wide modules, and only
+	// if the CPU topology is available in sysfs.
+	Sockets []float64
+}
+
+// UsagePct returns the percentage of available CPU capacity in use.
+func (i Info) UsagePct() int {
+	return int(i.Usage*100 + 0.5)
+}
+
+// Used returns the CPU capacity in use, in CPUs.
+func (i Info) Used() float64 {
+	return i.Usage * i.CPUs
+}
+
+// Bars returns a compact representation of per-core utilisation, using one
+// block character per core, e.g. "▂█▁▄".
+func (i Info) Bars() string {
+	const levels = " ▁▂▃▄▅▆▇█"
+	blocks := []rune(levels)
+	out := make([]rune, len(i.Cores))
+	for idx, u := range i.Cores {
+		out[idx] = blocks[level(u, len(blocks)-1)]
+	}
+	return string(out)
+}
+
+// Braille returns a very compact representation of per-core utilisation,
+// using one braille character for every two cores, each shown as a column of
+// up to four dots, e.g. "⣴⣿".
+func (i Info) Braille() string {
+	// Braille dots for each column, bottom to top.
+	left := []rune{0x40, 0x04, 0x02, 0x01}
+	right := []rune{0x80, 0x20, 0x10, 0x08}
+	out := make([]rune, (len(i.Cores)+1)/2)
+	for idx, u := range i.Cores {
+		dots := left
+		if idx%2 == 1 {
+			dots = right
+		}
+		r := &out[idx/2]
+		*r |= 0x2800
+		for d := 0; d < level(u, 4); d++ {
+			*r |= dots[d]
+		}
+	}
+	return string(out)
+}
+
+// level scales a utilisation fraction to a level from 0 to max.
+func level(u float64, max int) int {
+	lvl := int(u*float64(max) + 0.5)
+	if lvl < 0 {
+		return 0
+	}
+	if lvl > max {
+		return max
+	}
+	return lvl
+}
+
+// Module represents a cpuinfo bar module. It supports setting the output
+// format and update frequency.
+type Module struct {
+	cgroup     bool
+	scheduler  *timing.Scheduler
+	ownReads   int32           // atomic bool, set by RefreshInterval.
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// New constructs an instance of the cpuinfo module that shows the CPU
+// utilisation of the whole system.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "scheduler", "outputFunc")
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("CPU: %d%%", i.UsagePct())
+	})
+	return m
+}
+
+// Cgroup constructs an instance of the cpuinfo module that shows the CPU
+// utilisation of the cgroup (v2) that barista is running in, relative to the
+// cgroup's CPU bandwidth limit or the CPUs it is allowed to run on.
+func Cgroup() *Module {
+	m := New()
+	m.cgroup = true
+	l.Label(m, "cgroup")
+	// Cgroup usage is not in /proc/stat, so it is always read separately.
+	m.RefreshInterval(3 * time.Second)
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency. Since utilisation is
+// measured between consecutive readings, it is averaged over this interval.
+//
+// By default, system-wide modules are updated from the shared /proc/stat
+// sample, at the interval set using procstat.RefreshInterval. Setting an
+// interval here makes the module read /proc/stat on its own schedule instead.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	atomic.StoreInt32(&m.ownReads, 1)
+	m.scheduler.Every(interval)
+	return m
+}
+
+// reading is a cumulative measurement of CPU time.
+type reading struct {
+	// busy and total are in arbitrary (but consistent) units. For cgroups,
+	// total is wall time multiplied by capacity, since the kernel does not
+	// track idle time per-cgroup.
+	when  time.Time
+	busy  float64
+	total float64
+	cpus  float64
+	// Per-CPU readings and their physical package IDs (or -1 if unknown),
+	// only for system-wide readings.
+	cores   []procstat.CPU
+	sockets []int
+}
+
+// source returns the function to take readings with, and a channel that
+// signals the next shared sample if the module uses the shared sampler.
+func (m *Module) source() (func() (reading, error), <-chan struct{}) {
+	switch {
+	case m.cgroup:
+		return readCgroup, nil
+	case atomic.LoadInt32(&m.ownReads) == 1:
+		return func() (reading, error) {
+			return readSystem(procstat.StatFile.Read())
+		}, nil
+	}
+	return func() (reading, error) {
+		return readSystem(procstat.StatFile.Get())
+	}, procstat.StatFile.Next()
+}
+
+// Overridden in tests.
+var numCPU = runtime.NumCPU
+
+func readSystem(s procstat.Sample, err error) (reading, error) {
+	if err != nil {
+		return reading{}, err
+	}
+	st := s.Stat()
+	r := reading{
+		when:  s.Time,
+		busy:  float64(st.CPU.Busy()),
+		total: float64(st.CPU.Total()),
+	}
+	for idx, c := range st.CPUs {
+		// Offline CPUs are not reported, and have zero values.
+		if c.Total() == 0 {
+			continue
+		}
+		r.cores = append(r.cores, c)
+		r.sockets = append(r.sockets, socket(idx))
+	}
+	if len(r.cores) == 0 {
+		return reading{}, fmt.Errorf("no CPUs in /proc/stat")
+	}
+	r.cpus = float64(len(r.cores))
+	return r, nil
+}
+
+// Overridden in tests.
+var sysFs = afero.NewOsFs()
+
+// socket returns the physical package ID of a CPU, or -1 if not known.
+func socket(cpu int) int {
+	id, err := afero.ReadFile(sysFs, fmt.Sprintf(
+		"/sys/devices/system/cpu/cpu%d/topology/physical_package_id", cpu))
+	if err != nil {
+		return -1
+	}
+	s, err := strconv.Atoi(strings.TrimSpace(string(id)))
+	if err != nil || s < 0 {
+		return -1
+	}
+	return s
+}
+
+func readCgroup() (reading, error) {
+	c, err := cgroup.ReadCPU()
+	if err != nil {
+		return reading{}, err
+	}
+	cpus := float64(c.CPUs)
+	if cpus == 0 {
+		cpus = float64(numCPU())
+	}
+	if c.Limit > 0 && c.Limit < cpus {
+		cpus = c.Limit
+	}
+	return reading{
+		when: timing.Now(),
+		busy: c.Usage.Seconds(),
+		cpus: cpus,
+	}, nil
+}
+
+// usage computes the utilisation between two readings.
+func usage(prev, cur reading) Info {
+	info := Info{CPUs: cur.cpus}
+	total := cur.total - prev.total
+	if cur.total == 0 {
+		total = cur.when.Sub(prev.when).Seconds() * cur.cpus
+	}
+	if total > 0 {
+		info.Usage = (cur.busy - prev.busy) / total
+	}
+	if info.Usage < 0 {
+		info.Usage = 0
+	}
+	if info.Usage > 1 {
+		info.Usage = 1
+	}
+	if len(cur.cores) != len(prev.cores) {
+		// CPUs were added or removed, so per-core values can't be compared.
+		return info
+	}
+	var socketBusy, socketTotal []uint64
+	for idx, c := range cur.cores {
+		info.Cores = append(info.Cores, c.Usage(prev.cores[idx]))
+		sock := cur.sockets[idx]
+		if sock < 0 {
+			continue
+		}
+		for len(socketBusy) <= sock {
+			socketBusy = append(socketBusy, 0)
+			socketTotal = append(socketTotal, 0)
+		}
+		d := c.Sub(prev.cores[idx])
+		socketBusy[sock] += d.Busy()
+		socketTotal[sock] += d.Total()
+	}
+	for idx := range socketBusy {
+		u := 0.0
+		if socketTotal[idx] > 0 {
+			u = float64(socketBusy[idx]) / float64(socketTotal[idx])
+		}
+		info.Sockets = append(info.Sockets, u)
+	}
+	return info
+}
+
+// Stream starts the module.
+func (m *Module) Stream(s bar.Sink) {
+	read, nextSample := m.source()
+	last, err := read()
+	if s.Error(err) {
+		return
+	}
+	var info Info
+	available := false
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	for {
+		if available {
+			s.Output(outputFunc(info))
+		}
+		select {
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+			continue
+		case <-nextSample:
+		case <-m.scheduler.C:
+		}
+		// RefreshInterval may have switched the module to its own schedule.
+		read, nextSample = m.source()
+		cur, err := read()
+		if s.Error(err) {
+			return
+		}
+		info = usage(last, cur)
+		available = true
+		last = cur
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpuinfo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/cgroup"
+	"barista.run/base/procstat"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystem(t *testing.T) {
+	testFs := afero.NewMemMapFs()
+	procstat.SetFsForTest(testFs)
+	testBar.New(t)
+	stat := func(busy, idle int) {
+		afero.WriteFile(testFs, "/proc/stat", []byte(fmt.Sprintf(
+			"cpu %d 0 0 %d\ncpu0 1 0 0 1\ncpu1 1 0 0 1\ncpu2 0 0 0 0\n",
+			busy, idle)), 0644)
+	}
+	stat(100, 100)
+
+	cpu := New()
+	used := New().Output(func(i Info) bar.Output {
+		return outputs.Textf("%.1f/%.0f", i.Used(), i.CPUs)
+	})
+	testBar.Run(cpu, used)
+	testBar.AssertNoOutput("until first interval elapses")
+
+	stat(125, 175)
+	testBar.Tick()
+	testBar.LatestOutput(0, 1).AssertText(
+		[]string{"CPU: 25%", "0.5/2"}, "on tick, ignoring offline CPUs")
+
+	stat(225, 175)
+	testBar.Tick()
+	testBar.LatestOutput(0, 1).AssertText(
+		[]string{"CPU: 100%", "2.0/2"}, "on tick")
+
+	cpu.Output(func(i Info) bar.Output {
+		return outputs.Textf("%.2f", i.Usage)
+	})
+	testBar.LatestOutput(0).AssertText(
+		[]string{"1.00", "2.0/2"}, "on output change")
+
+	stat(325, 275)
+	used.RefreshInterval(time.Second)
+	start := testBar.Tick()
+	testBar.LatestOutput(1).AssertText(
+		[]string{"1.00", "1.0/2"}, "own read after setting an interval")
+	require.Equal(t, time.Second, testBar.Tick().Sub(start),
+		"reads on its own schedule")
+	testBar.NextOutput().AssertText([]string{"1.00", "0.0/2"})
+
+	testFs.Remove("/proc/stat")
+	testBar.Tick()
+	testBar.LatestOutput(0, 1).AssertError("on read error")
+}
+
+func TestPerCore(t *testing.T) {
+	require := require.New(t)
+	testFs := afero.NewMemMapFs()
+	procstat.SetFsForTest(testFs)
+	sysFs = afero.NewMemMapFs()
+	for cpu, pkg := range []string{"0", "0", "1", "1", "garbage"} {
+		afero.WriteFile(sysFs, fmt.Sprintf(
+			"/sys/devices/system/cpu/cpu%d/topology/physical_package_id", cpu),
+			[]byte(pkg+"\n"), 0644)
+	}
+	testBar.New(t)
+	afero.WriteFile(testFs, "/proc/stat", []byte(
+		"cpu 0 0 0 0\ncpu0 0 0 0 10\ncpu1 0 0 0 10\ncpu2 0 0 0 10\ncpu4 0 0 0 10\n"), 0644)
+
+	var info Info
+	cpu := New().Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Text(i.Bars() + " " + i.Braille())
+	})
+	testBar.Run(cpu)
+	testBar.AssertNoOutput("until first interval elapses")
+
+	afero.WriteFile(testFs, "/proc/stat", []byte(
+		"cpu 0 0 0 0\ncpu0 10 0 0 10\ncpu1 5 0 0 15\ncpu2 0 0 0 20\ncpu4 2 0 0 18\n"), 0644)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"█▄ ▂ ⣧⢀"})
+	require.Equal([]float64{1, 0.5, 0, 0.2}, info.Cores)
+	require.Equal([]float64{0.75, 0}, info.Sockets, "ignores unknown packages")
+
+	afero.WriteFile(testFs, "/proc/stat", []byte(
+		"cpu 0 0 0 0\ncpu0 10 0 0 20\ncpu1 5 0 0 25\n"), 0644)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{" "}, "when CPUs change")
+	require.Empty(info.Cores)
+	require.Empty(info.Sockets)
+}
+
+func TestCgroup(t *testing.T) {
+	require := require.New(t)
+	cgFs := afero.NewMemMapFs()
+	cgroup.SetFsForTest(cgFs)
+	defer cgroup.SetFsForTest(afero.NewOsFs())
+	numCPU = func() int { return 4 }
+	write := func(file, contents string) {
+		afero.WriteFile(cgFs, file, []byte(contents), 0644)
+	}
+	usage := func(d time.Duration) {
+		write("/sys/fs/cgroup/ctr/cpu.stat",
+			fmt.Sprintf("usage_usec %d\n", d/time.Microsecond))
+	}
+	testBar.New(t)
+	write("/proc/self/cgroup", "0::/ctr\n")
+	usage(0)
+
+	unlimited := Cgroup()
+	testBar.Run(unlimited)
+	testBar.AssertNoOutput("until first interval elapses")
+	usage(3 * time.Second)
+	testBar.Tick()
+	testBar.NextOutput().AssertText(
+		[]string{"CPU: 25%"}, "all CPUs without limits")
+
+	testBar.New(t)
+	write("/sys/fs/cgroup/ctr/cpu.max", "150000 100000\n")
+	write("/sys/fs/cgroup/ctr/cpuset.cpus.effective", "0-1\n")
+	var info Info
+	limited := Cgroup().Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Textf("%d%%", i.UsagePct())
+	})
+	testBar.Run(limited)
+	testBar.AssertNoOutput("until first interval elapses")
+	usage(6 * time.Second)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"67%"}, "with CPU limit")
+	require.Equal(1.5, info.CPUs)
+	require.InDelta(1.0, info.Used(), 0.001)
+
+	write("/sys/fs/cgroup/ctr/cpu.max", "max 100000\n")
+	usage(12 * time.Second)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"100%"}, "clamped to capacity")
+	require.Equal(2.0, info.CPUs, "limited to cpuset")
+
+	write("/proc/self/cgroup", "1:cpu:/ctr\n")
+	testBar.Tick()
+	testBar.NextOutput().AssertError("without cgroup v2")
+}
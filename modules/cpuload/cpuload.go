@@ -23,7 +23,7 @@ import (
 	"time"
 
 	"barista.run/bar"
-	"barista.run/base/value"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -51,7 +51,7 @@ func (l LoadAvg) Min15() float64 {
 // format, click handler, update frequency, and urgency/colour functions.
 type Module struct {
 	scheduler  *timing.Scheduler
-	outputFunc value.Value // of func(LoadAvg) bar.Output
+	outputFunc core.OutputFunc // of func(LoadAvg) bar.Output
 }
 
 // New constructs an instance of the cpuload module.
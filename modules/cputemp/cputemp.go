@@ -22,7 +22,8 @@ import (
 	"time"
 
 	"barista.run/bar"
-	"barista.run/base/value"
+	"barista.run/base/hwmon"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -34,19 +35,16 @@ import (
 // Module represents a cputemp bar module. It supports setting the output
 // format, click handler, update frequency, and urgency/colour functions.
 type Module struct {
-	thermalFile string
-	scheduler   *timing.Scheduler
-	outputFunc  value.Value // of func(unit.Temperature) bar.Output
+	readTemp   func() (unit.Temperature, error)
+	scheduler  *timing.Scheduler
+	outputFunc core.OutputFunc // of func(unit.Temperature) bar.Output
 }
 
-// Zone constructs an instance of the cputemp module for the specified zone.
-// The file /sys/class/thermal/<zone>/temp should return cpu temp in 1/1000 deg C.
-func Zone(thermalZone string) *Module {
+func newModule(readTemp func() (unit.Temperature, error)) *Module {
 	m := &Module{
-		thermalFile: fmt.Sprintf("/sys/class/thermal/%s/temp", thermalZone),
-		scheduler:   timing.NewScheduler(),
+		readTemp:  readTemp,
+		scheduler: timing.NewScheduler(),
 	}
-	l.Label(m, thermalZone)
 	l.Register(m, "scheduler", "format")
 	m.RefreshInterval(3 * time.Second)
 	// Default output, if no function is specified later.
@@ -56,29 +54,76 @@ func Zone(thermalZone string) *Module {
 	return m
 }
 
+// Zone constructs an instance of the cputemp module for the specified zone.
+// The file /sys/class/thermal/<zone>/temp should return cpu temp in 1/1000 deg C.
+func Zone(thermalZone string) *Module {
+	thermalFile := fmt.Sprintf("/sys/class/thermal/%s/temp", thermalZone)
+	m := newModule(func() (unit.Temperature, error) {
+		return getTemperature(thermalFile)
+	})
+	l.Label(m, thermalZone)
+	return m
+}
+
+// Sensor constructs an instance of the cputemp module for the first hwmon
+// temperature sensor matching any of the given "chip/label" patterns, e.g.
+// "coretemp/Package id 0", "k10temp/Tctl", or "nvme/Composite". See package
+// hwmon for details of sensor naming.
+func Sensor(patterns ...string) *Module {
+	s, ok := hwmon.First(hwmon.Temperature, patterns...)
+	m := newModule(func() (unit.Temperature, error) {
+		if !ok {
+			return 0, fmt.Errorf("No hwmon sensor matching %v", patterns)
+		}
+		return s.Temperature()
+	})
+	l.Label(m, strings.Join(patterns, ","))
+	return m
+}
+
 // OfType constructs an instance of the cputemp module for the *first* available
 // sensor of the given type. "x86_pkg_temp" usually represents the temperature
 // of the actual CPU package, while others may be available depending on the
 // system, e.g. "iwlwifi" for wifi, or "acpitz" for the motherboard.
 func OfType(typ string) *Module {
+	return Zone(zoneOfType(typ))
+}
+
+func zoneOfType(typ string) string {
 	files, _ := afero.ReadDir(fs, "/sys/class/thermal")
 	for _, file := range files {
 		name := file.Name()
 		typFile := fmt.Sprintf("/sys/class/thermal/%s/type", name)
 		typBytes, _ := afero.ReadFile(fs, typFile)
 		if strings.TrimSpace(string(typBytes)) == typ {
-			return Zone(name)
+			return name
 		}
 	}
-	return Zone("")
+	return ""
 }
 
 // New constructs an instance of the cputemp module for zone type "x86_pkg_temp".
-// Returns nil of the x86_pkg_temp thermal zone is unavailable.
+// If the x86_pkg_temp thermal zone is unavailable, it falls back to the CPU
+// package sensors exposed via hwmon by common drivers (e.g. k10temp on AMD).
 func New() *Module {
+	if zoneOfType("x86_pkg_temp") == "" {
+		if _, ok := hwmon.First(hwmon.Temperature, cpuSensors...); ok {
+			return Sensor(cpuSensors...)
+		}
+	}
 	return OfType("x86_pkg_temp")
 }
 
+// cpuSensors are hwmon sensors that report CPU package temperature, in order
+// of preference.
+var cpuSensors = []string{
+	"coretemp/Package id 0",
+	"k10temp/Tctl",
+	"k10temp/Tdie",
+	"zenpower/Tdie",
+	"cpu_thermal/temp1",
+}
+
 // Output configures a module to display the output of a user-defined function.
 func (m *Module) Output(outputFunc func(unit.Temperature) bar.Output) *Module {
 	m.outputFunc.Set(outputFunc)
@@ -96,7 +141,7 @@ var fs = afero.NewOsFs()
 
 // Stream starts the module.
 func (m *Module) Stream(s bar.Sink) {
-	temp, err := getTemperature(m.thermalFile)
+	temp, err := m.readTemp()
 	outputFunc := m.outputFunc.Get().(func(unit.Temperature) bar.Output)
 	nextOutputFunc, done := m.outputFunc.Subscribe()
 	defer done()
@@ -107,7 +152,7 @@ func (m *Module) Stream(s bar.Sink) {
 		s.Output(outputFunc(temp))
 		select {
 		case <-m.scheduler.C:
-			temp, err = getTemperature(m.thermalFile)
+			temp, err = m.readTemp()
 		case <-nextOutputFunc:
 			outputFunc = m.outputFunc.Get().(func(unit.Temperature) bar.Output)
 		}
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"barista.run/bar"
+	"barista.run/base/hwmon"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
 
@@ -42,8 +43,13 @@ func shouldReturn(temps ...string) {
 	}
 }
 
-func TestCputemp(t *testing.T) {
+func setupFs() {
 	fs = afero.NewMemMapFs()
+	hwmon.SetFsForTest(fs)
+}
+
+func TestCputemp(t *testing.T) {
+	setupFs()
 	testBar.New(t)
 
 	setTypes("x86_pkg_temp")
@@ -120,7 +126,7 @@ func TestCputemp(t *testing.T) {
 }
 
 func TestDefaultZoneDetection(t *testing.T) {
-	fs = afero.NewMemMapFs()
+	setupFs()
 	testBar.New(t)
 
 	setTypes("acpitz", "iwlwifi")
@@ -145,3 +151,34 @@ func TestDefaultZoneDetection(t *testing.T) {
 	out.At(0).AssertError("temperature missing")
 	out.At(1).AssertError("no zone of type")
 }
+
+func TestHwmonSensors(t *testing.T) {
+	setupFs()
+	testBar.New(t)
+
+	for file, contents := range map[string]string{
+		"hwmon0/name":        "k10temp",
+		"hwmon0/temp1_input": "51250",
+		"hwmon0/temp1_label": "Tctl",
+		"hwmon1/name":        "nvme",
+		"hwmon1/temp1_input": "38850",
+		"hwmon1/temp1_label": "Composite",
+	} {
+		afero.WriteFile(fs, "/sys/class/hwmon/"+file, []byte(contents), 0644)
+	}
+	setTypes("acpitz")
+	shouldReturn("27800")
+
+	cpu := New()
+	nvme := Sensor("k10temp/Tccd1", "nvme/Composite")
+	missing := Sensor("amdgpu/edge")
+	testBar.Run(cpu, nvme, missing)
+	out := testBar.LatestOutput()
+	out.At(0).AssertText("51.2℃", "falls back to hwmon without x86_pkg_temp")
+	out.At(1).AssertText("38.9℃", "first matching sensor")
+	require.Contains(t, out.At(2).AssertError(), "amdgpu/edge")
+
+	afero.WriteFile(fs, "/sys/class/hwmon/hwmon0/temp1_input", []byte("60000"), 0644)
+	testBar.Tick()
+	testBar.LatestOutput(0).At(0).AssertText("60.0℃", "on next tick")
+}
@@ -16,14 +16,15 @@
 package diskio // import "barista.run/modules/diskio"
 
 import (
-	"bufio"
-	"strconv"
-	"strings"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"sync"
 	"time"
 
 	"barista.run/bar"
-	"barista.run/base/value"
+	"barista.run/base/procstat"
+	"barista.run/core"
 	"barista.run/format"
 	l "barista.run/logging"
 	"barista.run/outputs"
@@ -36,6 +37,11 @@ import (
 // IO represents input and output rates for a disk.
 type IO struct {
 	Input, Output unit.Datarate
+	// Name of the disk, empty for the combined IO of multiple disks.
+	Name string
+	// For modules that match multiple disks, the individual IO of each disk
+	// that is currently present, sorted by name.
+	Disks []IO
 	// Unexported fields used by module to control output.
 	shouldOutput bool
 	err          error
@@ -54,40 +60,54 @@ type diskInfo struct {
 	updateTime time.Time
 }
 
+// matchInfo tracks a module that combines the IO of multiple disks.
+type matchInfo struct {
+	match  func(string) bool
+	ioChan chan IO
+}
+
 var once sync.Once
 
 var lock sync.Mutex
 var modules map[string]*diskInfo
-var updater *timing.Scheduler
+var matchers []*matchInfo
+
+// The io of each disk from the last update, for new modules that match
+// multiple disks.
+var lastIOs map[string]IO
+
+// Overridden in tests.
+var sysFs = afero.NewOsFs()
 
 // construct initialises diskio's global updating. All diskio
 // modules are updated with just one read of /proc/diskstats.
 func construct() {
 	once.Do(func() {
 		modules = make(map[string]*diskInfo)
-		updater = timing.NewScheduler()
-		l.Attach(nil, updater, "diskio.updater")
-		updater.Every(3 * time.Second)
+		next := procstat.DiskStatsFile.Next()
 		update()
-		go func(updater *timing.Scheduler) {
-			for range updater.C {
+		go func() {
+			for {
+				<-next
+				next = procstat.DiskStatsFile.Next()
 				update()
 			}
-		}(updater)
+		}()
 	})
 }
 
-// RefreshInterval configures the polling frequency.
+// RefreshInterval configures the polling frequency. Since /proc/diskstats is
+// sampled on a shared schedule, this also affects other modules that use
+// procstat.
 func RefreshInterval(interval time.Duration) {
 	construct()
-	// Scheduler is goroutine safe, don't need to lock here.
-	updater.Every(interval)
+	procstat.RefreshInterval(interval)
 }
 
 // Module represents a bar.Module for a single disk's io activity.
 type Module struct {
 	ioChan     <-chan IO
-	outputFunc value.Value
+	outputFunc core.OutputFunc
 }
 
 // New creates a diskio module that displays disk io rates for the given disk.
@@ -109,6 +129,62 @@ func New(disk string) *Module {
 	return m
 }
 
+// Glob creates a diskio module that displays the combined io rates of all
+// disks whose names match the given shell pattern (e.g. "sd?" or "dm-*").
+// Disks are added and removed as they appear in /proc/diskstats, and the
+// individual rates are available in IO.Disks.
+func Glob(pattern string) *Module {
+	m := matching(func(disk string) bool {
+		matched, _ := filepath.Match(pattern, disk)
+		return matched
+	})
+	l.Label(m, pattern)
+	return m
+}
+
+// Regexp creates a diskio module that displays the combined io rates of all
+// disks whose names match the given regular expression. Disks are added and
+// removed as they appear in /proc/diskstats, and the individual rates are
+// available in IO.Disks.
+func Regexp(re *regexp.Regexp) *Module {
+	m := matching(re.MatchString)
+	l.Label(m, re.String())
+	return m
+}
+
+// All creates a diskio module that displays the combined io rates of all
+// physical disks. Partitions and virtual devices (e.g. loop devices, LVM and
+// LUKS mappings) are not included, since their io is already counted by the
+// underlying disk.
+func All() *Module {
+	m := matching(isPhysicalDisk)
+	l.Label(m, "all")
+	return m
+}
+
+func isPhysicalDisk(disk string) bool {
+	// Only physical disks have a device link in /sys/block.
+	_, err := sysFs.Stat(filepath.Join("/sys/block", disk, "device"))
+	return err == nil
+}
+
+func matching(match func(string) bool) *Module {
+	construct()
+	lock.Lock()
+	defer lock.Unlock()
+	mInfo := &matchInfo{match: match, ioChan: make(chan IO, 1)}
+	matchers = append(matchers, mInfo)
+	if lastIOs != nil {
+		mInfo.send(mInfo.combine(lastIOs))
+	}
+	m := &Module{ioChan: mInfo.ioChan}
+	l.Register(m, "ioChan", "outputFunc")
+	m.Output(func(i IO) bar.Output {
+		return outputs.Textf("Disk: %s", format.IByterate(i.Total()))
+	})
+	return m
+}
+
 // Output configures a module to display the output of a user-defined function.
 func (m *Module) Output(outputFunc func(IO) bar.Output) *Module {
 	m.outputFunc.Set(outputFunc)
@@ -180,59 +256,86 @@ func (m *diskInfo) makeChannel() <-chan IO {
 	return ioChan
 }
 
-var fs = afero.NewOsFs()
+// send replaces any unread io for the module with the latest io.
+func (m *matchInfo) send(i IO) {
+	select {
+	case <-m.ioChan:
+	default:
+	}
+	m.ioChan <- i
+}
 
-// To prevent data races in tests.
-var signalChan chan bool
+// combine computes the combined io of all matching disks.
+func (m *matchInfo) combine(ios map[string]IO) IO {
+	var combined IO
+	for disk, i := range ios {
+		if !m.match(disk) {
+			continue
+		}
+		if i.err != nil {
+			return IO{err: i.err}
+		}
+		if !i.shouldOutput {
+			continue
+		}
+		combined.Input += i.Input
+		combined.Output += i.Output
+		combined.Disks = append(combined.Disks, i)
+		combined.shouldOutput = true
+	}
+	sort.Slice(combined.Disks, func(a, b int) bool {
+		return combined.Disks[a].Name < combined.Disks[b].Name
+	})
+	return combined
+}
 
 func update() {
 	lock.Lock()
 	defer lock.Unlock()
-	var err error
-	f, err := fs.Open("/proc/diskstats")
+	sample, err := procstat.DiskStatsFile.Get()
 	if err != nil {
 		for _, m := range modules {
 			m.Error(err)
 		}
+		for _, m := range matchers {
+			m.send(IO{err: err})
+		}
 		return
 	}
-	defer f.Close()
-	s := bufio.NewScanner(f)
-	s.Split(bufio.ScanLines)
+	ios := map[string]IO{}
+	defer func() {
+		lastIOs = ios
+		for _, m := range matchers {
+			m.send(m.combine(ios))
+		}
+	}()
 	// Keep track of which submodules were updated, so that any drives
 	// that were removed can be cleared instead of showing stale data.
 	updated := make(map[string]bool)
-	for s.Scan() {
-		info := strings.Fields(s.Text())
-		if len(info) < 14 {
-			continue
-		}
-		// See https://www.kernel.org/doc/Documentation/iostats.txt
-		disk := info[2]
+	for disk, stat := range sample.DiskStats() {
 		module, found := modules[disk]
 		if !found {
 			module = &diskInfo{}
 			modules[disk] = module
 		}
 		updated[disk] = true
-		reads, err := strconv.ParseUint(info[5], 10, 64)
-		if module.Error(err) {
-			continue
-		}
-		writes, err := strconv.ParseUint(info[9], 10, 64)
-		if module.Error(err) {
+		if module.Error(stat.Err) {
+			ios[disk] = IO{err: stat.Err}
 			continue
 		}
 		shouldOutput := !module.updateTime.IsZero()
-		readRate, writeRate := module.update(reads, writes)
-		module.send(IO{
+		readRate, writeRate := module.update(stat.SectorsRead, stat.SectorsWritten)
+		io := IO{
 			// Linux always considers sectors to be 512 bytes long
 			// independently of the devices real block size.
 			// (from linux/types.h)
 			Input:        unit.Datarate(readRate) * 512 * unit.BytePerSecond,
 			Output:       unit.Datarate(writeRate) * 512 * unit.BytePerSecond,
+			Name:         disk,
 			shouldOutput: shouldOutput,
-		})
+		}
+		ios[disk] = io
+		module.send(io)
 	}
 	for disk, module := range modules {
 		if !updated[disk] {
@@ -17,11 +17,14 @@ package diskio
 import (
 	"bytes"
 	"fmt"
+	"regexp"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"barista.run/bar"
+	"barista.run/base/procstat"
 	"barista.run/format"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
@@ -37,7 +40,7 @@ func shouldReturn(stats diskstats) {
 	idx := 0
 	for disk, stats := range stats {
 		out.WriteString(fmt.Sprintf(
-			"0 %d %s all other %d fields are ignored %d * * * *\n",
+			"8 %d %s 0 0 %d 0 0 0 %d 0 0 0 0\n",
 			idx, disk, stats[0], stats[1]))
 		idx++
 	}
@@ -46,11 +49,17 @@ func shouldReturn(stats diskstats) {
 	lock.Unlock()
 }
 
+var fs afero.Fs
+
 // resetForTest resets diskio's shared state for testing purposes.
 func resetForTest() {
 	fs = afero.NewMemMapFs()
+	procstat.SetFsForTest(fs)
+	lock.Lock()
 	modules = nil
-	updater = nil
+	matchers = nil
+	lastIOs = nil
+	lock.Unlock()
 	once = sync.Once{}
 }
 
@@ -180,3 +189,94 @@ a b sda2 0 0 100 0 0 0 b 0 0 0 0
 		"Disk: 100 KiB/s",
 		"ignores invalid lines in diskstats")
 }
+
+func diskNames(i IO) string {
+	var names []string
+	for _, d := range i.Disks {
+		names = append(names, fmt.Sprintf("%s=%s", d.Name, format.IByterate(d.Total())))
+	}
+	return strings.Join(names, ",")
+}
+
+func TestMatching(t *testing.T) {
+	resetForTest()
+	sysFs = afero.NewMemMapFs()
+	sysFs.MkdirAll("/sys/block/sda/device", 0755)
+	sysFs.MkdirAll("/sys/block/sdb/device", 0755)
+	sysFs.MkdirAll("/sys/block/sdc/device", 0755)
+	sysFs.MkdirAll("/sys/block/dm-0", 0755)
+	testBar.New(t)
+
+	shouldReturn(diskstats{
+		"sda":  []int{0, 0},
+		"sda1": []int{0, 0},
+		"sda2": []int{0, 0},
+		"dm-0": []int{0, 0},
+	})
+	RefreshInterval(time.Second)
+
+	output := func(i IO) bar.Output {
+		return outputs.Textf("%s [%s]", format.IByterate(i.Total()), diskNames(i))
+	}
+	glob := Glob("sda?").Output(output)
+	re := Regexp(regexp.MustCompile("^(sd[b-z]|dm-[0-9]+)$")).Output(output)
+	all := All().Output(output)
+	testBar.Run(glob, re, all)
+	testBar.LatestOutput().Expect("on start")
+
+	shouldReturn(diskstats{
+		"sda":  []int{4, 4},
+		"sda1": []int{2, 0},
+		"sda2": []int{0, 2},
+		"dm-0": []int{2, 2},
+	})
+	testBar.Tick()
+	testBar.LatestOutput(0, 1, 2).AssertText([]string{
+		"2.0 KiB/s [sda1=1.0 KiB/s,sda2=1.0 KiB/s]",
+		"2.0 KiB/s [dm-0=2.0 KiB/s]",
+		"4.0 KiB/s [sda=4.0 KiB/s]",
+	}, "on tick")
+
+	shouldReturn(diskstats{
+		"sda":  []int{4, 4},
+		"sda1": []int{2, 0},
+		"sda2": []int{0, 2},
+		"dm-0": []int{2, 2},
+		"sdb":  []int{0, 0},
+	})
+	testBar.Tick()
+	testBar.LatestOutput(0, 1, 2).AssertText([]string{
+		"0 B/s [sda1=0 B/s,sda2=0 B/s]",
+		"0 B/s [dm-0=0 B/s]",
+		"0 B/s [sda=0 B/s]",
+	}, "new disk not included until the next tick")
+
+	shouldReturn(diskstats{
+		"sda":  []int{4, 4},
+		"sda1": []int{2, 0},
+		"sdb":  []int{8, 0},
+		"sdc":  []int{0, 0},
+	})
+	testBar.Tick()
+	testBar.LatestOutput(0, 1, 2).AssertText([]string{
+		"0 B/s [sda1=0 B/s]",
+		"4.0 KiB/s [sdb=4.0 KiB/s]",
+		"4.0 KiB/s [sda=0 B/s,sdb=4.0 KiB/s]",
+	}, "on disks added and removed")
+
+	shouldReturn(diskstats{
+		"sdc": []int{0, 0},
+	})
+	testBar.Tick()
+	testBar.LatestOutput(0, 1, 2).AssertText([]string{
+		"0 B/s [sdc=0 B/s]",
+		"0 B/s [sdc=0 B/s]",
+	}, "on all disks matching glob removed")
+
+	lock.Lock()
+	afero.WriteFile(fs, "/proc/diskstats", []byte("0 0 sdc 0 0 a 0 0 0 100 0 0 0 0"), 0644)
+	lock.Unlock()
+	testBar.Tick()
+	errs := testBar.LatestOutput(1, 2).AssertError("on error in matching disk")
+	require.Len(t, errs, 2)
+}
@@ -21,6 +21,7 @@ import (
 
 	"barista.run/bar"
 	"barista.run/base/value"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -34,6 +35,12 @@ type Info struct {
 	Available unit.Datasize
 	Free      unit.Datasize
 	Total     unit.Datasize
+	// Mount is set for modules created using Mounts or MountsMatching.
+	Mount Mount
+
+	// Trend analysis, see FillRate and TimeUntilFull.
+	fillRate unit.Datasize
+	horizon  time.Duration
 }
 
 // Used returns the disk space currently in use.
@@ -65,8 +72,10 @@ func (i Info) AvailPct() int {
 // format, click handler, update frequency, and urgency/colour functions.
 type Module struct {
 	path       string
+	filter     func(Mount) bool
 	scheduler  *timing.Scheduler
-	outputFunc value.Value // of func(Info) bar.Output
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	trend      value.Value     // of trendConfig
 }
 
 // New constructs an instance of the diskusage module for the given disk path.
@@ -78,9 +87,15 @@ func New(path string) *Module {
 	l.Label(m, path)
 	l.Register(m, "scheduler", "format")
 	m.RefreshInterval(3 * time.Second)
-	// Construct a simple output that's just 2 decimals of the used disk space.
+	m.trend.Set(defaultTrend)
+	// Construct a simple output that's just 2 decimals of the used disk space,
+	// marked urgent if the disk is projected to fill up soon.
 	m.Output(func(i Info) bar.Output {
-		return outputs.Textf("%.2f GB", i.Used().Gigabytes())
+		out := outputs.Textf("%.2f GB", i.Used().Gigabytes())
+		if i.FullSoon() {
+			out.Urgent(true)
+		}
+		return out
 	})
 	return m
 }
@@ -99,10 +114,18 @@ func (m *Module) RefreshInterval(interval time.Duration) *Module {
 
 // Stream starts the module.
 func (m *Module) Stream(s bar.Sink) {
+	if m.filter != nil {
+		m.streamMounts(s)
+		return
+	}
+	var t trend
 	info, err := getStatFsInfo(m.path)
 	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
 	nextOutputFunc, done := m.outputFunc.Subscribe()
 	defer done()
+	if err == nil {
+		info = t.add(info, m.trend.Get().(trendConfig))
+	}
 	for {
 		if os.IsNotExist(err) {
 			// Disk is not mounted, hide the module.
@@ -118,6 +141,9 @@ func (m *Module) Stream(s bar.Sink) {
 		select {
 		case <-m.scheduler.C:
 			info, err = getStatFsInfo(m.path)
+			if err == nil {
+				info = t.add(info, m.trend.Get().(trendConfig))
+			}
 		case <-nextOutputFunc:
 			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
 		}
@@ -134,5 +160,7 @@ func getStatFsInfo(path string) (info Info, err error) {
 	return // info, err
 }
 
+var defaultTrend = trendConfig{window: 10 * time.Minute, horizon: time.Hour}
+
 // To allow tests to mock out statfs.
 var statfs = unix.Statfs
@@ -0,0 +1,195 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskspace
+
+import (
+	"bufio"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+)
+
+// Mount describes a mounted filesystem.
+type Mount struct {
+	// Path where the filesystem is mounted.
+	Path string
+	// Device or other source of the filesystem, e.g. "/dev/sda1" or "tmpfs".
+	Device string
+	// Filesystem type, e.g. "ext4".
+	FSType string
+}
+
+// Mounts constructs an instance of the diskusage module that shows the disk
+// space of each mounted filesystem for which filter returns true. Mounts are
+// discovered from /proc/self/mountinfo on each refresh, and segments are
+// added or removed as filesystems are mounted or unmounted. The output
+// function is called for each mount, with outputs ordered by mount path.
+func Mounts(filter func(Mount) bool) *Module {
+	m := &Module{
+		filter:    filter,
+		scheduler: timing.NewScheduler(),
+	}
+	l.Label(m, "mounts")
+	l.Register(m, "scheduler", "format")
+	m.RefreshInterval(3 * time.Second)
+	m.trend.Set(defaultTrend)
+	m.Output(func(i Info) bar.Output {
+		out := outputs.Textf("%s: %.2f GB", filepath.Base(i.Mount.Path), i.Used().Gigabytes())
+		if i.FullSoon() {
+			out.Urgent(true)
+		}
+		return out
+	})
+	return m
+}
+
+// MountsMatching constructs an instance of the diskusage module that shows the
+// disk space of each mount whose path matches the given shell pattern, e.g.
+// "/run/media/*/*" for removable drives mounted by udisks.
+func MountsMatching(pattern string) *Module {
+	m := Mounts(func(mnt Mount) bool {
+		matched, _ := filepath.Match(pattern, mnt.Path)
+		return matched
+	})
+	l.Label(m, pattern)
+	return m
+}
+
+func (m *Module) streamMounts(s bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	t := trends{}
+	infos, err := m.getMountInfos()
+	infos = t.add(infos, m.trend.Get().(trendConfig))
+	for {
+		if s.Error(err) {
+			return
+		}
+		out := outputs.Group()
+		for _, i := range infos {
+			out.Append(outputFunc(i))
+		}
+		s.Output(out)
+		select {
+		case <-m.scheduler.C:
+			infos, err = m.getMountInfos()
+			infos = t.add(infos, m.trend.Get().(trendConfig))
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// getMountInfos returns the disk space of all matching mounts.
+func (m *Module) getMountInfos() ([]Info, error) {
+	mounts, err := readMounts()
+	if err != nil {
+		return nil, err
+	}
+	var infos []Info
+	for _, mnt := range mounts {
+		if !m.filter(mnt) {
+			continue
+		}
+		info, err := getStatFsInfo(mnt.Path)
+		if err != nil {
+			// Mounts can disappear between reading mountinfo and calling
+			// statfs, and some (e.g. FUSE) may not allow statfs. Neither
+			// should prevent showing the other mounts.
+			l.Fine("%s: skipping %s: %v", l.ID(m), mnt.Path, err)
+			continue
+		}
+		info.Mount = mnt
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(a, b int) bool {
+		return infos[a].Mount.Path < infos[b].Mount.Path
+	})
+	return infos, nil
+}
+
+// Overridden in tests.
+var fs = afero.NewOsFs()
+
+// readMounts parses /proc/self/mountinfo. If a path has multiple mounts,
+// only the topmost one (which is the visible one) is returned.
+func readMounts() ([]Mount, error) {
+	f, err := fs.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	byPath := map[string]Mount{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Format: id parent major:minor root mountpoint options [optional
+		// fields...] - fstype source superoptions.
+		fields := strings.Fields(s.Text())
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		mnt := Mount{
+			Path:   unescapeMountinfo(fields[4]),
+			FSType: fields[sep+1],
+			Device: unescapeMountinfo(fields[sep+2]),
+		}
+		byPath[mnt.Path] = mnt
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	var mounts []Mount
+	for _, mnt := range byPath {
+		mounts = append(mounts, mnt)
+	}
+	return mounts, nil
+}
+
+// unescapeMountinfo replaces the octal escapes used by the kernel for spaces,
+// tabs, newlines, and backslashes in mountinfo.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				out.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
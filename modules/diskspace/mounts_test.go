@@ -0,0 +1,99 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskspace
+
+import (
+	"os"
+	"testing"
+
+	testBar "barista.run/testing/bar"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+const mountinfoBase = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:21 / /proc rw,nosuid shared:12 - proc proc rw
+`
+
+func setMountinfo(contents string) {
+	afero.WriteFile(fs, "/proc/self/mountinfo", []byte(contents), 0644)
+}
+
+func TestReadMounts(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	setMountinfo(mountinfoBase +
+		`40 22 8:17 / /run/media/user/My\040Drive rw,nosuid master:2 - vfat /dev/sdb1 rw
+41 22 0:40 / /mnt rw - tmpfs tmpfs rw
+42 41 8:33 / /mnt rw - ext4 /dev/sdc1 rw
+bogus line
+`)
+	mounts, err := readMounts()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []Mount{
+		{Path: "/", Device: "/dev/sda1", FSType: "ext4"},
+		{Path: "/proc", Device: "proc", FSType: "proc"},
+		{Path: "/run/media/user/My Drive", Device: "/dev/sdb1", FSType: "vfat"},
+		{Path: "/mnt", Device: "/dev/sdc1", FSType: "ext4"},
+	}, mounts)
+
+	fs = afero.NewMemMapFs()
+	_, err = readMounts()
+	require.Error(t, err, "without mountinfo")
+}
+
+func TestMounts(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	statfs = mockStatfs
+	testBar.New(t)
+
+	stat := func(blocks uint64) unix.Statfs_t {
+		return unix.Statfs_t{Bsize: 1000 * 1000, Blocks: blocks}
+	}
+	shouldReturn("/", stat(4000))
+	shouldReturn("/run/media/user/usb", stat(1000))
+	shouldReturn("/run/media/user/disk", stat(2000))
+	setMountinfo(mountinfoBase)
+
+	m := MountsMatching("/run/media/*/*")
+	testBar.Run(m)
+	testBar.LatestOutput().AssertEmpty("no matching mounts")
+
+	setMountinfo(mountinfoBase +
+		"40 22 8:17 / /run/media/user/usb rw - vfat /dev/sdb1 rw\n")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"usb: 1.00 GB"}, "mount added")
+
+	setMountinfo(mountinfoBase +
+		"40 22 8:17 / /run/media/user/usb rw - vfat /dev/sdb1 rw\n" +
+		"41 22 8:33 / /run/media/user/disk rw - ext4 /dev/sdc1 rw\n" +
+		"42 22 8:49 / /run/media/user/gone rw - ext4 /dev/sdd1 rw\n")
+	testBar.Tick()
+	testBar.NextOutput().AssertText(
+		[]string{"disk: 2.00 GB", "usb: 1.00 GB"},
+		"sorted by path, skipping mounts that fail statfs")
+
+	setMountinfo(mountinfoBase +
+		"41 22 8:33 / /run/media/user/disk rw - ext4 /dev/sdc1 rw\n")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"disk: 2.00 GB"}, "mount removed")
+
+	fs.Remove("/proc/self/mountinfo")
+	testBar.Tick()
+	out := testBar.NextOutput()
+	out.AssertError("on mountinfo error")
+	require.True(t, os.IsNotExist(out.At(0).Segment().GetError()))
+}
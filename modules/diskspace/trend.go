@@ -0,0 +1,135 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskspace
+
+import (
+	"time"
+
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+)
+
+// trendConfig holds the settings used to project when a disk will be full.
+type trendConfig struct {
+	window  time.Duration
+	horizon time.Duration
+}
+
+// Trend configures the window over which the fill rate is computed. Longer
+// windows smooth out short bursts of writes (e.g. a download that is deleted
+// right after). A zero window disables trend analysis. Defaults to 10
+// minutes.
+func (m *Module) Trend(window time.Duration) *Module {
+	c := m.trend.Get().(trendConfig)
+	c.window = window
+	m.trend.Set(c)
+	return m
+}
+
+// Horizon configures how soon the disk must be projected to fill up for
+// Info.FullSoon to return true, which the default output uses to mark the
+// module urgent. Defaults to 1 hour.
+func (m *Module) Horizon(horizon time.Duration) *Module {
+	c := m.trend.Get().(trendConfig)
+	c.horizon = horizon
+	m.trend.Set(c)
+	return m
+}
+
+// FillRate returns the rate at which the available space is being used up,
+// per second, over the trend window. It is negative if space is being freed,
+// and zero if there are not enough samples yet.
+func (i Info) FillRate() unit.Datasize {
+	return i.fillRate
+}
+
+// TimeUntilFull returns the projected time until no space is available, based
+// on the fill rate. It returns 0 if the disk is not filling up.
+func (i Info) TimeUntilFull() time.Duration {
+	if i.fillRate <= 0 {
+		return 0
+	}
+	secs := float64(i.Available) / float64(i.fillRate)
+	return time.Duration(secs) * time.Second
+}
+
+// FullSoon returns true if the disk is projected to fill up within the
+// horizon configured on the module.
+func (i Info) FullSoon() bool {
+	if i.fillRate <= 0 {
+		return false
+	}
+	return i.Available <= 0 || i.TimeUntilFull() < i.horizon
+}
+
+type diskSample struct {
+	when      time.Time
+	available unit.Datasize
+}
+
+// trend tracks the available space of a single disk over a rolling window.
+type trend struct {
+	samples []diskSample
+	total   unit.Datasize
+}
+
+// add records the available space from info, and returns info with the fill
+// rate populated.
+func (t *trend) add(info Info, c trendConfig) Info {
+	info.horizon = c.horizon
+	if c.window <= 0 || info.Total != t.total {
+		// Resizing or replacing the filesystem invalidates the history.
+		t.samples = nil
+		t.total = info.Total
+	}
+	if c.window <= 0 {
+		return info
+	}
+	now := timing.Now()
+	t.samples = append(t.samples, diskSample{now, info.Available})
+	for len(t.samples) > 1 && now.Sub(t.samples[0].when) > c.window {
+		t.samples = t.samples[1:]
+	}
+	first := t.samples[0]
+	if elapsed := now.Sub(first.when).Seconds(); elapsed > 0 {
+		info.fillRate = unit.Datasize(float64(first.available-info.Available) / elapsed)
+	}
+	return info
+}
+
+// trends tracks the available space of multiple disks by mount path.
+type trends map[string]*trend
+
+// add records the available space of all mounts, discarding the history of
+// any mounts that are no longer present.
+func (t trends) add(infos []Info, c trendConfig) []Info {
+	seen := map[string]bool{}
+	for idx, i := range infos {
+		seen[i.Mount.Path] = true
+		tr, ok := t[i.Mount.Path]
+		if !ok {
+			tr = &trend{}
+			t[i.Mount.Path] = tr
+		}
+		infos[idx] = tr.add(i, c)
+	}
+	for path := range t {
+		if !seen[path] {
+			delete(t, path)
+		}
+	}
+	return infos
+}
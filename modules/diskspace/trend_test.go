@@ -0,0 +1,138 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskspace
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	testOutput "barista.run/testing/output"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func statAvail(blocks, avail uint64) unix.Statfs_t {
+	return unix.Statfs_t{Bsize: 1000 * 1000, Blocks: blocks, Bavail: avail, Bfree: avail}
+}
+
+func isUrgent(out testOutput.Assertions) bool {
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	return urgent
+}
+
+func TestTrend(t *testing.T) {
+	statfs = mockStatfs
+	testBar.New(t)
+	shouldReturn("/", statAvail(2000, 1000))
+
+	m := New("/").RefreshInterval(time.Minute)
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%.0f MB/s %v", i.FillRate().Megabytes(), i.TimeUntilFull()).
+			Urgent(i.FullSoon())
+	})
+	testBar.Run(m)
+	testBar.NextOutput().AssertText([]string{"0 MB/s 0s"}, "on start")
+
+	shouldReturn("/", statAvail(2000, 940))
+	testBar.Tick()
+	out := testBar.NextOutput()
+	out.AssertText([]string{"1 MB/s 15m40s"}, "filling up")
+	require.True(t, isUrgent(out), "full within horizon")
+
+	shouldReturn("/", statAvail(2000, 940))
+	testBar.Tick()
+	out = testBar.NextOutput()
+	out.AssertText([]string{"0 MB/s 31m20s"}, "averaged over window")
+	require.True(t, isUrgent(out), "full within horizon")
+
+	m.Horizon(10 * time.Minute)
+	testBar.Tick()
+	out = testBar.NextOutput()
+	require.False(t, isUrgent(out), "not full within new horizon")
+
+	for i := 0; i < 9; i++ {
+		testBar.Tick()
+		testBar.NextOutput()
+	}
+	shouldReturn("/", statAvail(2000, 1000))
+	testBar.Tick()
+	out = testBar.NextOutput()
+	out.AssertText([]string{"-0 MB/s 0s"}, "old samples dropped, space freed")
+	require.False(t, isUrgent(out), "not filling up")
+
+	shouldReturn("/", statAvail(4000, 100))
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"0 MB/s 0s"}, "history reset on resize")
+
+	m.Trend(0)
+	shouldReturn("/", statAvail(4000, 50))
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"0 MB/s 0s"}, "trend disabled")
+}
+
+func TestFullSoon(t *testing.T) {
+	i := Info{Available: 100 * unit.Megabyte, horizon: time.Hour}
+	require.False(t, i.FullSoon(), "without fill rate")
+	require.Equal(t, time.Duration(0), i.TimeUntilFull())
+
+	i.fillRate = unit.Megabyte
+	require.Equal(t, 100*time.Second, i.TimeUntilFull())
+	require.True(t, i.FullSoon())
+
+	i.fillRate = -unit.Megabyte
+	require.Equal(t, time.Duration(0), i.TimeUntilFull(), "when freeing space")
+	require.False(t, i.FullSoon(), "when freeing space")
+
+	i.fillRate = unit.Megabyte
+	i.Available = 0
+	require.True(t, i.FullSoon(), "when already full")
+}
+
+func TestMountTrends(t *testing.T) {
+	timing.TestMode()
+	tr := trends{}
+	c := trendConfig{window: time.Hour, horizon: time.Hour}
+	infos := func(avail ...unit.Datasize) []Info {
+		var r []Info
+		for idx, a := range avail {
+			r = append(r, Info{
+				Available: a,
+				Total:     unit.Terabyte,
+				Mount:     Mount{Path: []string{"/a", "/b"}[idx]},
+			})
+		}
+		return r
+	}
+
+	tr.add(infos(100*unit.Gigabyte, 10*unit.Gigabyte), c)
+	timing.AdvanceBy(100 * time.Second)
+	res := tr.add(infos(90*unit.Gigabyte, 10*unit.Gigabyte), c)
+	require.InDelta(t, 100.0, res[0].FillRate().Megabytes(), 0.001)
+	require.InDelta(t, 0.0, res[1].FillRate().Megabytes(), 0.001)
+
+	tr.add(infos(90*unit.Gigabyte), c)
+	require.Len(t, tr, 1, "history dropped for removed mounts")
+	timing.AdvanceBy(100 * time.Second)
+	res = tr.add(infos(90*unit.Gigabyte, 0), c)
+	require.InDelta(t, 50.0, res[0].FillRate().Megabytes(), 0.001)
+	require.InDelta(t, 0.0, res[1].FillRate().Megabytes(), 0.001,
+		"new mount has no history")
+}
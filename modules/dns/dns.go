@@ -0,0 +1,236 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dns provides a bar module that shows the active DNS resolver, from
+// systemd-resolved or /etc/resolv.conf, whether DNS-over-TLS is in use, and the
+// latency of a test query, marking the output urgent if queries fail.
+package dns // import "barista.run/modules/dns"
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Source describes where the resolver configuration was read from.
+type Source string
+
+// Possible sources of resolver configuration.
+const (
+	SourceNone       = Source("")
+	SourceResolved   = Source("systemd-resolved")
+	SourceResolvConf = Source("resolv.conf")
+)
+
+// Info represents the state of DNS resolution.
+type Info struct {
+	Source Source
+	// Server is the DNS server currently in use, or nil if unknown.
+	Server net.IP
+	// ServerName is the name of the server used to verify its certificate
+	// with DNS-over-TLS, if configured.
+	ServerName string
+	// DNSOverTLS is true if systemd-resolved is configured to use
+	// DNS-over-TLS, either strictly or opportunistically.
+	DNSOverTLS bool
+	// Latency is the time taken by the test query, if it succeeded.
+	Latency time.Duration
+	// Err is the error from the test query, if it failed.
+	Err error
+}
+
+// Failed returns true if the test query failed.
+func (i Info) Failed() bool {
+	return i.Err != nil
+}
+
+// Module represents a bar module that shows DNS health.
+type Module struct {
+	query      string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a DNS module that resolves the given name to measure
+// latency. Answers are usually cached by the resolver after the first query,
+// so the latency is mostly that of the local resolver or nearest cache.
+func New(query string) *Module {
+	m := &Module{
+		query:     query,
+		scheduler: timing.NewScheduler().Every(30 * time.Second),
+	}
+	l.Label(m, query)
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		server := "?"
+		if i.Server != nil {
+			server = i.Server.String()
+		}
+		if i.DNSOverTLS {
+			server += " TLS"
+		}
+		if i.Failed() {
+			return outputs.Textf("DNS %s failed", server).Urgent(true)
+		}
+		return outputs.Textf("DNS %s %dms", server, i.Latency/time.Millisecond)
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures how often the test query is sent.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Overridden in tests.
+var (
+	busType    = dbus.System
+	resolvConf = "/etc/resolv.conf"
+	query      = queryServer
+)
+
+const (
+	resolvedService = "org.freedesktop.resolve1"
+	resolvedIface   = "org.freedesktop.resolve1.Manager"
+	// resolvedStub is the address of the systemd-resolved stub listener.
+	resolvedStub = "127.0.0.53"
+	queryTimeout = 5 * time.Second
+)
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	w := dbus.WatchProperties(busType,
+		resolvedService, "/org/freedesktop/resolve1", resolvedIface).
+		Add("CurrentDNSServer", "CurrentDNSServerEx", "DNSOverTLS")
+	defer w.Unsubscribe()
+
+	info := m.getInfo(w)
+	for {
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info = m.getInfo(w)
+		case <-w.Updates:
+			info = m.getInfo(w)
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func (m *Module) getInfo(w *dbus.PropertiesWatcher) Info {
+	i := Info{}
+	var server string
+	props := w.Get()
+	if len(props) > 0 {
+		i.Source = SourceResolved
+		i.Server, i.ServerName = resolvedServer(props)
+		dot, _ := props["DNSOverTLS"].(string)
+		i.DNSOverTLS = dot == "yes" || dot == "opportunistic"
+		// Queries go through the stub resolver, since that handles
+		// DNS-over-TLS and per-link servers.
+		server = resolvedStub
+	} else if ip := resolvConfServer(); ip != nil {
+		i.Source = SourceResolvConf
+		i.Server = ip
+		server = ip.String()
+	}
+	if server == "" {
+		i.Err = errNoServer
+		return i
+	}
+	i.Latency, i.Err = query(server, m.query)
+	return i
+}
+
+var errNoServer = errors.New("no DNS server configured")
+
+// resolvedServer extracts the current DNS server from the CurrentDNSServerEx
+// (iiayqs) property if available, falling back to CurrentDNSServer (iiay) on
+// older versions of systemd-resolved.
+func resolvedServer(props map[string]interface{}) (net.IP, string) {
+	if s, ok := props["CurrentDNSServerEx"].([]interface{}); ok && len(s) >= 5 {
+		addr, _ := s[2].([]byte)
+		name, _ := s[4].(string)
+		if len(addr) == net.IPv4len || len(addr) == net.IPv6len {
+			return net.IP(addr), name
+		}
+	}
+	if s, ok := props["CurrentDNSServer"].([]interface{}); ok && len(s) >= 3 {
+		addr, _ := s[2].([]byte)
+		if len(addr) == net.IPv4len || len(addr) == net.IPv6len {
+			return net.IP(addr), ""
+		}
+	}
+	return nil, ""
+}
+
+// resolvConfServer returns the first nameserver in resolv.conf.
+func resolvConfServer() net.IP {
+	f, err := os.Open(resolvConf)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if ip := net.ParseIP(fields[1]); ip != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+// queryServer resolves the name using the given DNS server, and returns the
+// time taken.
+func queryServer(server, name string) (time.Duration, error) {
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(server, "53"))
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err := r.LookupHost(ctx, name)
+	return time.Since(start), err
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeQuery struct {
+	sync.Mutex
+	server, name string
+	latency      time.Duration
+	err          error
+}
+
+func (f *fakeQuery) set(latency time.Duration, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.latency, f.err = latency, err
+}
+
+func (f *fakeQuery) last() (server, name string) {
+	f.Lock()
+	defer f.Unlock()
+	return f.server, f.name
+}
+
+func (f *fakeQuery) query(server, name string) (time.Duration, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.server, f.name = server, name
+	return f.latency, f.err
+}
+
+// Modules from earlier tests may still send queries on ticks, so a single fake
+// and resolv.conf are shared across all tests.
+var fake = &fakeQuery{}
+
+func init() {
+	busType = dbus.Test
+	query = fake.query
+	f, err := ioutil.TempFile("", "resolv.conf")
+	if err != nil {
+		panic(err)
+	}
+	f.Close()
+	resolvConf = f.Name()
+}
+
+func writeResolvConf(t *testing.T, contents string) {
+	require.NoError(t, ioutil.WriteFile(resolvConf, []byte(contents), 0644))
+}
+
+func TestResolved(t *testing.T) {
+	testBar.New(t)
+	fake.set(12*time.Millisecond, nil)
+	bus := dbus.SetupTestBus()
+	srv := bus.RegisterService("org.freedesktop.resolve1")
+	obj := srv.Object("/org/freedesktop/resolve1", "org.freedesktop.resolve1.Manager")
+	obj.SetProperties(map[string]interface{}{
+		"CurrentDNSServer": []interface{}{int32(0), int32(2), []byte{9, 9, 9, 9}},
+		"DNSOverTLS":       "no",
+	}, dbus.SignalTypeNone)
+
+	m := New("example.com")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"DNS 9.9.9.9 12ms"})
+	server, name := fake.last()
+	require.Equal(t, "127.0.0.53", server, "queries the stub resolver")
+	require.Equal(t, "example.com", name)
+
+	obj.SetProperties(map[string]interface{}{
+		"CurrentDNSServerEx": []interface{}{int32(3), int32(2), []byte{1, 1, 1, 1},
+			uint16(853), "cloudflare-dns.com"},
+		"DNSOverTLS": "opportunistic",
+	}, dbus.SignalTypeChanged)
+	testBar.NextOutput("on server change").AssertText([]string{"DNS 1.1.1.1 TLS 12ms"})
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %s %v %v", i.Source, i.ServerName, i.DNSOverTLS, i.Failed())
+	})
+	testBar.NextOutput("on output change").AssertText(
+		[]string{"systemd-resolved cloudflare-dns.com true false"})
+
+	fake.set(0, errors.New("i/o timeout"))
+	testBar.Tick()
+	testBar.NextOutput("on query failure").AssertText(
+		[]string{"systemd-resolved cloudflare-dns.com true true"})
+}
+
+func TestDefaultOutputFailure(t *testing.T) {
+	testBar.New(t)
+	fake.set(0, errors.New("i/o timeout"))
+	bus := dbus.SetupTestBus()
+	srv := bus.RegisterService("org.freedesktop.resolve1")
+	obj := srv.Object("/org/freedesktop/resolve1", "org.freedesktop.resolve1.Manager")
+	obj.SetProperties(map[string]interface{}{
+		"CurrentDNSServer": []interface{}{int32(0), int32(10),
+			[]byte{0x26, 0x20, 0, 0xfe, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xfe}},
+		"DNSOverTLS": "yes",
+	}, dbus.SignalTypeNone)
+
+	testBar.Run(New("example.com"))
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"DNS 2620:fe::fe TLS failed"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent)
+}
+
+func TestResolvConf(t *testing.T) {
+	testBar.New(t)
+	fake.set(30*time.Millisecond, nil)
+	dbus.SetupTestBus()
+	writeResolvConf(t, `# Generated by NetworkManager
+search example.org
+nameserver bogus
+nameserver 192.168.1.1
+nameserver 8.8.8.8
+`)
+
+	m := New("google.com")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"DNS 192.168.1.1 30ms"})
+	server, name := fake.last()
+	require.Equal(t, "192.168.1.1", server)
+	require.Equal(t, "google.com", name)
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %v", i.Source, i.Err)
+	})
+	testBar.NextOutput("on output change").AssertText([]string{"resolv.conf <nil>"})
+
+	writeResolvConf(t, "search example.org\n")
+	testBar.Tick()
+	testBar.NextOutput("without nameservers").AssertText(
+		[]string{" no DNS server configured"})
+
+	require.NoError(t, os.Remove(resolvConf))
+	testBar.Tick()
+	testBar.NextOutput("without resolv.conf").AssertText(
+		[]string{" no DNS server configured"})
+	writeResolvConf(t, "")
+}
@@ -0,0 +1,227 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dock provides a bar module that shows the lid and docking state of
+// a laptop, as reported by systemd-logind, and the external displays that
+// are connected. Clicking can run a command to apply a display profile,
+// e.g. using autorandr or kanshi.
+package dock // import "barista.run/modules/dock"
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/uevent"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+)
+
+// Display represents a connected external display.
+type Display struct {
+	// Connector is the name of the display connector, e.g. "DP-1".
+	Connector string
+	// Card is the graphics card the connector belongs to, e.g. "card0".
+	Card string
+	// Enabled is true if the display is currently in use.
+	Enabled bool
+}
+
+// Info represents the lid, dock, and display state.
+type Info struct {
+	// LidClosed is true if the laptop lid is closed. It is always false on
+	// machines without a lid.
+	LidClosed bool
+	// Docked is true if logind considers the machine docked, i.e. it is
+	// connected to a docking station or to more than one display.
+	Docked bool
+	// Displays are the connected external displays, ordered by connector.
+	Displays []Display
+
+	command []string
+}
+
+// RunCommand runs the module's display profile command, if configured.
+func (i Info) RunCommand() {
+	if len(i.command) == 0 {
+		return
+	}
+	if err := runCommand(i.command); err != nil {
+		l.Log("Failed to run %s: %v", i.command[0], err)
+	}
+}
+
+// Module represents a bar module that shows the lid and dock state.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	command    value.Value     // of []string
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a dock module. Display hotplug events update the module
+// immediately, but logind does not signal lid and dock changes, so they are
+// checked every 5 seconds.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "outputFunc", "command", "scheduler")
+	m.RefreshInterval(5 * time.Second)
+	m.command.Set([]string(nil))
+	m.Output(func(i Info) bar.Output {
+		var parts []string
+		if i.Docked {
+			parts = append(parts, "DOCK")
+		}
+		if i.LidClosed {
+			parts = append(parts, "LID")
+		}
+		if len(i.Displays) > 0 {
+			parts = append(parts, fmt.Sprintf("%d ext", len(i.Displays)))
+		}
+		if len(parts) == 0 {
+			return nil
+		}
+		return outputs.Text(strings.Join(parts, " ")).OnClick(func(e bar.Event) {
+			if e.Button == bar.ButtonLeft {
+				i.RunCommand()
+			}
+		})
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Command sets the command run by Info.RunCommand, which the default output
+// runs on left click, e.g. Command("autorandr", "--change").
+func (m *Module) Command(name string, args ...string) *Module {
+	m.command.Set(append([]string{name}, args...))
+	return m
+}
+
+// RefreshInterval configures how often the lid and dock state are checked.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Overridden in tests.
+var (
+	busType    = dbus.System
+	fs         = afero.NewOsFs()
+	runCommand = func(cmd []string) error {
+		return exec.Command(cmd[0], cmd[1:]...).Run()
+	}
+)
+
+const (
+	logindService = "org.freedesktop.login1"
+	logindPath    = "/org/freedesktop/login1"
+	managerIface  = "org.freedesktop.login1.Manager"
+
+	drmRoot = "/sys/class/drm"
+)
+
+// internalConnectors are the prefixes of connectors used for built-in
+// displays.
+var internalConnectors = []string{"eDP", "LVDS", "DSI"}
+
+func isInternal(connector string) bool {
+	for _, p := range internalConnectors {
+		if strings.HasPrefix(connector, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func readFile(path string) string {
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// externalDisplays returns the external displays connected to any card,
+// using the card<N>-<connector> entries in sysfs.
+func externalDisplays() []Display {
+	entries, err := afero.ReadDir(fs, drmRoot)
+	if err != nil {
+		return nil
+	}
+	var r []Display
+	for _, e := range entries {
+		parts := strings.SplitN(e.Name(), "-", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "card") || isInternal(parts[1]) {
+			continue
+		}
+		dir := filepath.Join(drmRoot, e.Name())
+		if readFile(filepath.Join(dir, "status")) != "connected" {
+			continue
+		}
+		r = append(r, Display{
+			Connector: parts[1],
+			Card:      parts[0],
+			Enabled:   readFile(filepath.Join(dir, "enabled")) == "enabled",
+		})
+	}
+	sort.Slice(r, func(a, b int) bool { return r[a].Connector < r[b].Connector })
+	return r
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	// LidClosed and Docked do not emit change signals, so they are fetched
+	// whenever the module updates.
+	w := dbus.WatchProperties(busType, logindService, logindPath, managerIface).
+		Fetch("LidClosed", "Docked")
+	defer w.Unsubscribe()
+	sub := uevent.Subscribe("drm")
+	defer sub.Unsubscribe()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextCommand, done := m.command.Subscribe()
+	defer done()
+
+	for {
+		props := w.Get()
+		i := Info{Displays: externalDisplays(), command: m.command.Get().([]string)}
+		i.LidClosed, _ = props["LidClosed"].(bool)
+		i.Docked, _ = props["Docked"].(bool)
+		sink.Output(outputFunc(i))
+		select {
+		case <-sub.C:
+		case <-m.scheduler.C:
+		case <-nextCommand:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
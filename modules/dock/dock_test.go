@@ -0,0 +1,175 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dock
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/uevent"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func setConnector(name, status, enabled string) {
+	dir := drmRoot + "/" + name
+	afero.WriteFile(fs, dir+"/status", []byte(status+"\n"), 0644)
+	afero.WriteFile(fs, dir+"/enabled", []byte(enabled+"\n"), 0644)
+}
+
+func hotplug() {
+	uevent.Emit(uevent.Event{Action: "change", Subsystem: "drm"})
+}
+
+func setupLogind(lidClosed, docked bool) *dbus.TestBusObject {
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	obj := bus.RegisterService(logindService).Object(logindPath, managerIface)
+	obj.SetProperties(map[string]interface{}{
+		"LidClosed": lidClosed,
+		"Docked":    docked,
+	}, dbus.SignalTypeNone)
+	return obj
+}
+
+func init() {
+	// Dock modules from earlier tests still scan drmRoot on drm uevents and
+	// ticks, so tests remove and re-create it rather than replacing fs.
+	fs = afero.NewMemMapFs()
+	uevent.TestMode()
+}
+
+func TestExternalDisplays(t *testing.T) {
+	fs.RemoveAll(drmRoot)
+	require.Empty(t, externalDisplays(), "without sysfs")
+
+	fs.MkdirAll(drmRoot+"/card0", 0755)
+	fs.MkdirAll(drmRoot+"/renderD128", 0755)
+	afero.WriteFile(fs, drmRoot+"/version", []byte("drm 1.1.0\n"), 0644)
+	setConnector("card0-eDP-1", "connected", "enabled")
+	setConnector("card0-HDMI-A-1", "disconnected", "disabled")
+	setConnector("card0-DP-2", "connected", "disabled")
+	setConnector("card1-DP-1", "connected", "enabled")
+	setConnector("card1-LVDS-1", "connected", "enabled")
+
+	require.Equal(t, []Display{
+		{Connector: "DP-1", Card: "card1", Enabled: true},
+		{Connector: "DP-2", Card: "card0", Enabled: false},
+	}, externalDisplays(), "only connected external displays")
+}
+
+func TestDock(t *testing.T) {
+	testBar.New(t)
+	fs.RemoveAll(drmRoot)
+	setConnector("card0-eDP-1", "connected", "enabled")
+	logind := setupLogind(false, false)
+
+	cmds := make(chan []string, 10)
+	runCommand = func(cmd []string) error {
+		cmds <- cmd
+		return nil
+	}
+
+	d := New().Command("autorandr", "--change")
+	testBar.Run(d)
+	testBar.NextOutput("on start").AssertEmpty("undocked, lid open")
+
+	setConnector("card0-DP-1", "connected", "enabled")
+	hotplug()
+	out := testBar.NextOutput("on hotplug")
+	out.AssertText([]string{"1 ext"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	select {
+	case c := <-cmds:
+		require.Fail(t, "unexpected command", "%v", c)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	select {
+	case c := <-cmds:
+		require.Equal(t, []string{"autorandr", "--change"}, c)
+	case <-time.After(time.Second):
+		require.Fail(t, "expected command on left click")
+	}
+
+	logind.SetProperties(map[string]interface{}{
+		"LidClosed": true,
+		"Docked":    true,
+	}, dbus.SignalTypeNone)
+	testBar.AssertNoOutput("logind does not signal changes")
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"DOCK LID 1 ext"})
+
+	d.Command("kanshi")
+	out = testBar.NextOutput("on command change")
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	select {
+	case c := <-cmds:
+		require.Equal(t, []string{"kanshi"}, c)
+	case <-time.After(time.Second):
+		require.Fail(t, "expected updated command")
+	}
+
+	var info Info
+	d.Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Text("dock")
+	})
+	testBar.NextOutput("on output func change").AssertText([]string{"dock"})
+	require.True(t, info.LidClosed)
+	require.True(t, info.Docked)
+	require.Equal(t, []Display{{Connector: "DP-1", Card: "card0", Enabled: true}},
+		info.Displays)
+}
+
+func TestNoCommand(t *testing.T) {
+	testBar.New(t)
+	fs.RemoveAll(drmRoot)
+	setConnector("card0-DP-1", "connected", "enabled")
+	setupLogind(false, true)
+
+	called := false
+	runCommand = func([]string) error {
+		called = true
+		return nil
+	}
+
+	testBar.Run(New())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"DOCK 1 ext"})
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	require.False(t, called, "no command configured")
+}
+
+func TestNoLogind(t *testing.T) {
+	testBar.New(t)
+	fs.RemoveAll(drmRoot)
+	dbus.SetupTestBus()
+	busType = dbus.Test
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertEmpty("no logind, no displays")
+
+	setConnector("card0-HDMI-A-1", "connected", "enabled")
+	hotplug()
+	testBar.NextOutput("on hotplug").AssertText([]string{"1 ext"})
+}
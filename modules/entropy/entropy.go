@@ -0,0 +1,223 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package entropy provides a bar module that shows the entropy available to
+// the kernel random number generator, along with the state of the jitter
+// entropy source and hardware RNG. This is mostly useful on embedded or
+// headless systems, where a lack of entropy can stall services that read from
+// /dev/random during boot.
+package entropy // import "barista.run/modules/entropy"
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+)
+
+// Jitter represents the state of the CPU jitter entropy source.
+type Jitter int
+
+// Valid values for Jitter.
+const (
+	// JitterMissing indicates that jitterentropy_rng is not loaded.
+	JitterMissing Jitter = iota
+	// JitterUntested indicates that the kernel did not run a self-test.
+	JitterUntested
+	// JitterFailed indicates that the self-test failed.
+	JitterFailed
+	// JitterPassed indicates that the self-test passed.
+	JitterPassed
+)
+
+// Info represents the state of the kernel random number generator.
+type Info struct {
+	// Available is the entropy estimate, in bits. Since Linux 5.18, this is
+	// always equal to PoolSize once the generator has been seeded.
+	Available int
+	// PoolSize is the size of the entropy pool, in bits.
+	PoolSize int
+	// Threshold is the number of bits below which entropy is considered low.
+	Threshold int
+	// Jitter is the state of the jitter entropy source.
+	Jitter Jitter
+	// HWRNG is the name of the active hardware RNG, or empty if there is none.
+	HWRNG string
+}
+
+// Low returns true if the available entropy is below the threshold.
+func (i Info) Low() bool {
+	return i.Available < i.Threshold
+}
+
+// Fraction returns the available entropy as a fraction of the pool size.
+func (i Info) Fraction() float64 {
+	if i.PoolSize == 0 {
+		return 0
+	}
+	return float64(i.Available) / float64(i.PoolSize)
+}
+
+// Healthy returns true if entropy is not low, and the jitter entropy source
+// (if loaded) did not fail its self-test.
+func (i Info) Healthy() bool {
+	return !i.Low() && i.Jitter != JitterFailed
+}
+
+// Module represents an entropy bar module.
+type Module struct {
+	scheduler  *timing.Scheduler
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	threshold  value.Value     // of int
+}
+
+// New constructs a new entropy module.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "scheduler", "outputFunc", "threshold")
+	m.RefreshInterval(5 * time.Second)
+	m.Threshold(256)
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("RNG %d", i.Available).Urgent(!i.Healthy())
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Threshold sets the number of bits of entropy below which the available
+// entropy is considered low (and shown as urgent by the default output).
+func (m *Module) Threshold(bits int) *Module {
+	m.threshold.Set(bits)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextThreshold, done := m.threshold.Subscribe()
+	defer done()
+	info, err := m.read()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info, err = m.read()
+		case <-nextThreshold:
+			info, err = m.read()
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+const (
+	randomDir   = "/proc/sys/kernel/random"
+	cryptoFile  = "/proc/crypto"
+	hwrngFile   = "/sys/class/misc/hw_random/rng_current"
+	jitterEntry = "jitterentropy_rng"
+)
+
+func readInt(path string) (int, error) {
+	b, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+func (m *Module) read() (Info, error) {
+	i := Info{Threshold: m.threshold.Get().(int)}
+	var err error
+	if i.Available, err = readInt(randomDir + "/entropy_avail"); err != nil {
+		return i, err
+	}
+	if i.PoolSize, err = readInt(randomDir + "/poolsize"); err != nil {
+		return i, err
+	}
+	i.Jitter = readJitter()
+	if b, err := afero.ReadFile(fs, hwrngFile); err == nil {
+		if name := strings.TrimSpace(string(b)); name != "none" {
+			i.HWRNG = name
+		}
+	}
+	return i, nil
+}
+
+// readJitter finds the jitter entropy source in /proc/crypto, which lists
+// algorithms as blocks of "key : value" lines separated by blank lines.
+func readJitter() Jitter {
+	f, err := fs.Open(cryptoFile)
+	if err != nil {
+		return JitterMissing
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	found := false
+	for s.Scan() {
+		key, val := s.Text(), ""
+		if idx := strings.Index(key, ":"); idx >= 0 {
+			key, val = key[:idx], strings.TrimSpace(key[idx+1:])
+		}
+		switch strings.TrimSpace(key) {
+		case "":
+			if found {
+				return JitterUntested
+			}
+		case "name":
+			found = val == jitterEntry
+		case "selftest":
+			if !found {
+				continue
+			}
+			switch val {
+			case "passed":
+				return JitterPassed
+			case "unknown":
+				return JitterUntested
+			}
+			return JitterFailed
+		}
+	}
+	if found {
+		return JitterUntested
+	}
+	return JitterMissing
+}
+
+var fs = afero.NewOsFs()
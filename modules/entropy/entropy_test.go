@@ -0,0 +1,146 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entropy
+
+import (
+	"fmt"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+const crypto = `name         : sha256
+driver       : sha256-generic
+module       : kernel
+priority     : 100
+refcnt       : 1
+selftest     : passed
+internal     : no
+type         : shash
+blocksize    : 64
+digestsize   : 32
+
+name         : %s
+driver       : jitterentropy_rng
+module       : kernel
+priority     : 100
+refcnt       : 1
+selftest     : %s
+internal     : no
+type         : rng
+seedsize     : 0
+
+name         : stdrng
+driver       : drbg_nopr_hmac_sha512
+module       : kernel
+priority     : 200
+refcnt       : 1
+selftest     : failed
+internal     : no
+type         : rng
+seedsize     : 0
+`
+
+func setup(avail int, jitter, selftest, hwrng string) {
+	afero.WriteFile(fs, randomDir+"/entropy_avail", []byte(fmt.Sprintf("%d\n", avail)), 0644)
+	afero.WriteFile(fs, randomDir+"/poolsize", []byte("4096\n"), 0644)
+	afero.WriteFile(fs, cryptoFile, []byte(fmt.Sprintf(crypto, jitter, selftest)), 0644)
+	if hwrng == "" {
+		fs.Remove(hwrngFile)
+	} else {
+		afero.WriteFile(fs, hwrngFile, []byte(hwrng+"\n"), 0644)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	testBar.New(t)
+	setup(3072, jitterEntry, "passed", "none")
+	m := New()
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"RNG 3072"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	setup(42, jitterEntry, "passed", "none")
+	testBar.Tick()
+	out = testBar.NextOutput("on low entropy")
+	out.AssertText([]string{"RNG 42"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "urgent when low")
+
+	m.Threshold(32)
+	out = testBar.NextOutput("on threshold change")
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.False(t, urgent, "not urgent above threshold")
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%d/%d %.2f %v %v %d %q",
+			i.Available, i.PoolSize, i.Fraction(), i.Low(), i.Healthy(), i.Jitter, i.HWRNG)
+	})
+	testBar.NextOutput("on output change").AssertText(
+		[]string{`42/4096 0.01 false true 3 ""`})
+
+	setup(2048, jitterEntry, "failed", "tpm-rng-0")
+	testBar.Tick()
+	testBar.NextOutput("on jitter failure").AssertText(
+		[]string{`2048/4096 0.50 false false 2 "tpm-rng-0"`})
+
+	setup(2048, jitterEntry, "unknown", "tpm-rng-0")
+	testBar.Tick()
+	testBar.NextOutput("on jitter untested").AssertText(
+		[]string{`2048/4096 0.50 false true 1 "tpm-rng-0"`})
+
+	setup(16, "ghash", "passed", "")
+	testBar.Tick()
+	testBar.NextOutput("without jitter").AssertText(
+		[]string{`16/4096 0.00 true false 0 ""`})
+
+	fs.Remove(cryptoFile)
+	afero.WriteFile(fs, randomDir+"/entropy_avail", []byte("256\n"), 0644)
+	afero.WriteFile(fs, randomDir+"/poolsize", []byte("256\n"), 0644)
+	testBar.Tick()
+	testBar.NextOutput("on newer kernels").AssertText(
+		[]string{`256/256 1.00 false true 0 ""`})
+
+	afero.WriteFile(fs, randomDir+"/poolsize", []byte("lots\n"), 0644)
+	testBar.Tick()
+	testBar.NextOutput("on invalid pool size").AssertError()
+
+	fs.Remove(randomDir + "/entropy_avail")
+	testBar.NextOutput().At(0).LeftClick()
+	testBar.NextOutput().Expect("on restart")
+	testBar.NextOutput("on missing file").AssertError()
+}
+
+func TestReadJitter(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	require.Equal(t, JitterMissing, readJitter(), "without /proc/crypto")
+
+	afero.WriteFile(fs, cryptoFile, []byte("name : jitterentropy_rng\ntype : rng\n"), 0644)
+	require.Equal(t, JitterUntested, readJitter(), "without selftest at end")
+
+	afero.WriteFile(fs, cryptoFile, []byte(
+		"name : jitterentropy_rng\ntype : rng\n\nname : stdrng\nselftest : passed\n"), 0644)
+	require.Equal(t, JitterUntested, readJitter(), "without selftest in block")
+
+	require.Equal(t, 0.0, Info{}.Fraction())
+}
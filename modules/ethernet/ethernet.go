@@ -0,0 +1,166 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ethernet provides a bar module that shows the link state, speed, and
+// duplex of a wired network interface. It can flag links that negotiated a
+// lower speed than both ends support, which is often caused by a bad cable.
+package ethernet // import "barista.run/modules/ethernet"
+
+import (
+	"fmt"
+	"net"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/netlink"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+
+	"github.com/martinlindhe/unit"
+)
+
+// Duplex represents the duplex mode of an ethernet link.
+type Duplex int
+
+// Duplex modes.
+const (
+	DuplexUnknown Duplex = iota
+	HalfDuplex
+	FullDuplex
+)
+
+// Info represents the state of an ethernet link.
+type Info struct {
+	Name  string
+	State netlink.OperState
+	IPs   []net.IP
+	// Speed is the negotiated speed of the link, or zero if unknown.
+	Speed  unit.Datarate
+	Duplex Duplex
+	// MaxSpeed is the fastest speed supported by both ends of the link, or by
+	// the interface if the link partner's capabilities are unknown.
+	MaxSpeed unit.Datarate
+}
+
+// Connected returns true if the link has a carrier.
+func (i Info) Connected() bool {
+	return i.State == netlink.Up
+}
+
+// Enabled returns true if the interface is enabled.
+func (i Info) Enabled() bool {
+	return i.State > netlink.NotPresent
+}
+
+// Degraded returns true if the link is connected, but has negotiated a lower
+// speed than supported, or half duplex.
+func (i Info) Degraded() bool {
+	if !i.Connected() || i.Speed == 0 {
+		return false
+	}
+	return i.Speed < i.MaxSpeed || i.Duplex == HalfDuplex
+}
+
+func speedString(speed unit.Datarate) string {
+	mbps := speed.MegabitsPerSecond()
+	if mbps >= 1000 {
+		return fmt.Sprintf("%gG", mbps/1000)
+	}
+	return fmt.Sprintf("%gM", mbps)
+}
+
+// Module represents an ethernet bar module.
+type Module struct {
+	intf       string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// Named constructs an instance of the ethernet module for the specified
+// interface.
+func Named(iface string) *Module {
+	m := &Module{intf: iface}
+	l.Label(m, iface)
+	l.Register(m, "outputFunc")
+	// Default output is the link speed when connected, marked urgent if the
+	// link is degraded.
+	m.Output(func(i Info) bar.Output {
+		if !i.Connected() {
+			return nil
+		}
+		if i.Speed == 0 {
+			return outputs.Text("ETH")
+		}
+		return outputs.Textf("ETH %s", speedString(i.Speed)).Urgent(i.Degraded())
+	})
+	return m
+}
+
+// Any constructs an instance of the ethernet module that uses any available
+// wired interface, choosing the 'best' state from all available.
+func Any() *Module {
+	return Named("")
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(s bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	var linkSub *netlink.Subscription
+	if m.intf == "" {
+		// Matches both predictable names (enp3s0) and classic names (eth0).
+		linkSub = netlink.WithPrefix("e")
+	} else {
+		linkSub = netlink.ByName(m.intf)
+	}
+	defer linkSub.Unsubscribe()
+
+	info := getInfo(linkSub.Get())
+	for {
+		s.Output(outputFunc(info))
+		select {
+		case <-linkSub.C:
+			info = getInfo(linkSub.Get())
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func getInfo(link netlink.Link) Info {
+	info := Info{
+		Name:  link.Name,
+		State: link.State,
+		IPs:   link.IPs,
+	}
+	if !info.Connected() {
+		return info
+	}
+	settings, err := getLinkSettings(link.Name)
+	if err != nil {
+		l.Log("%s: ethtool: %v", link.Name, err)
+		return info
+	}
+	info.Speed = settings.speed
+	info.Duplex = settings.duplex
+	info.MaxSpeed = settings.maxSpeed
+	return info
+}
@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethernet
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/netlink"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSettings = map[string]linkSettings{}
+	testMu       sync.RWMutex
+)
+
+func init() {
+	getLinkSettings = func(iface string) (linkSettings, error) {
+		testMu.RLock()
+		defer testMu.RUnlock()
+		s, ok := testSettings[iface]
+		if !ok {
+			return s, errors.New("Operation not supported")
+		}
+		return s, nil
+	}
+}
+
+func settingsShouldBe(iface string, speed, maxSpeed int, duplex Duplex) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	testSettings[iface] = linkSettings{
+		speed:    unit.Datarate(speed) * unit.MegabitPerSecond,
+		maxSpeed: unit.Datarate(maxSpeed) * unit.MegabitPerSecond,
+		duplex:   duplex,
+	}
+}
+
+func TestNoEthernet(t *testing.T) {
+	netlink.TestMode()
+	testBar.New(t)
+	testBar.Run(Named("eth0"), Any())
+	testBar.LatestOutput().AssertEmpty("when no link is present")
+}
+
+func TestEthernet(t *testing.T) {
+	nlt := netlink.TestMode()
+	settingsShouldBe("enp3s0", 1000, 1000, FullDuplex)
+	link := nlt.AddLink(netlink.Link{Name: "enp3s0", State: netlink.Up})
+	nlt.AddLink(netlink.Link{Name: "wlan0", State: netlink.Up})
+
+	testBar.New(t)
+	m := Any()
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"ETH 1G"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	settingsShouldBe("enp3s0", 100, 1000, FullDuplex)
+	nlt.UpdateLink(link, netlink.Link{Name: "enp3s0", State: netlink.LowerLayerDown})
+	testBar.NextOutput("on carrier loss").AssertEmpty()
+	nlt.UpdateLink(link, netlink.Link{Name: "enp3s0", State: netlink.Up})
+	out = testBar.NextOutput("on renegotiation")
+	out.AssertText([]string{"ETH 100M"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "when degraded")
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %v %v %v", i.Name, i.Enabled(), i.Degraded(), i.Duplex)
+	})
+	testBar.NextOutput("on output change").AssertText(
+		[]string{"enp3s0 true true 2"})
+
+	nlt.UpdateLink(link, netlink.Link{Name: "enp3s0", State: netlink.Down})
+	testBar.NextOutput("on link down").AssertText(
+		[]string{"enp3s0 true false 0"})
+
+	settingsShouldBe("enp3s0", 100, 100, HalfDuplex)
+	nlt.UpdateLink(link, netlink.Link{Name: "enp3s0", State: netlink.Up})
+	testBar.NextOutput("on half duplex").AssertText(
+		[]string{"enp3s0 true true 1"})
+
+	settingsShouldBe("enp3s0", 100, 100, FullDuplex)
+	nlt.UpdateLink(link, netlink.Link{Name: "enp3s0", State: netlink.LowerLayerDown})
+	testBar.NextOutput("on carrier loss").AssertText(
+		[]string{"enp3s0 true false 0"})
+	nlt.UpdateLink(link, netlink.Link{Name: "enp3s0", State: netlink.Up})
+	testBar.NextOutput("on slow partner").AssertText(
+		[]string{"enp3s0 true false 2"})
+}
+
+func TestEthtoolUnsupported(t *testing.T) {
+	nlt := netlink.TestMode()
+	nlt.AddLink(netlink.Link{Name: "eth1", State: netlink.Up})
+
+	testBar.New(t)
+	testBar.Run(Named("eth1"))
+	testBar.NextOutput("on start").AssertText([]string{"ETH"},
+		"when speed is unknown")
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethernet
+
+import (
+	"unsafe"
+
+	"github.com/martinlindhe/unit"
+	"golang.org/x/sys/unix"
+)
+
+// ethtoolCmd is struct ethtool_cmd from linux/ethtool.h, used with the
+// (deprecated, but universally supported) ETHTOOL_GSET command.
+type ethtoolCmd struct {
+	cmd           uint32
+	supported     uint32
+	advertising   uint32
+	speed         uint16
+	duplex        uint8
+	port          uint8
+	phyAddress    uint8
+	transceiver   uint8
+	autoneg       uint8
+	mdioSupport   uint8
+	maxTxPkt      uint32
+	maxRxPkt      uint32
+	speedHi       uint16
+	ethTpMdix     uint8
+	ethTpMdixCtrl uint8
+	lpAdvertising uint32
+	reserved      [2]uint32
+}
+
+// ifreq is struct ifreq from linux/if.h, with a pointer to the ethtool
+// command as the data.
+type ifreq struct {
+	name [unix.IFNAMSIZ]byte
+	data unsafe.Pointer
+	_    [16]byte
+}
+
+const (
+	speedUnknown  = 0xffffffff
+	duplexHalf    = 0x00
+	duplexFull    = 0x01
+	duplexUnknown = 0xff
+)
+
+// linkModeSpeeds maps the legacy SUPPORTED_* and ADVERTISED_* link mode bits
+// to their speeds in Mb/s.
+var linkModeSpeeds = map[uint32]uint32{
+	1 << 0:  10,    // 10baseT_Half
+	1 << 1:  10,    // 10baseT_Full
+	1 << 2:  100,   // 100baseT_Half
+	1 << 3:  100,   // 100baseT_Full
+	1 << 4:  1000,  // 1000baseT_Half
+	1 << 5:  1000,  // 1000baseT_Full
+	1 << 12: 10000, // 10000baseT_Full
+	1 << 15: 2500,  // 2500baseX_Full
+	1 << 17: 1000,  // 1000baseKX_Full
+	1 << 18: 10000, // 10000baseKX4_Full
+	1 << 19: 10000, // 10000baseKR_Full
+	1 << 20: 10000, // 10000baseR_FEC
+	1 << 21: 20000, // 20000baseMLD2_Full
+	1 << 22: 20000, // 20000baseKR2_Full
+	1 << 23: 40000, // 40000baseKR4_Full
+	1 << 24: 40000, // 40000baseCR4_Full
+	1 << 25: 40000, // 40000baseSR4_Full
+	1 << 26: 40000, // 40000baseLR4_Full
+}
+
+// linkSettings are the negotiated settings of an ethernet link.
+type linkSettings struct {
+	speed    unit.Datarate
+	maxSpeed unit.Datarate
+	duplex   Duplex
+}
+
+func maxModeSpeed(modes uint32) unit.Datarate {
+	max := uint32(0)
+	for bit, speed := range linkModeSpeeds {
+		if modes&bit != 0 && speed > max {
+			max = speed
+		}
+	}
+	return unit.Datarate(max) * unit.MegabitPerSecond
+}
+
+func (c ethtoolCmd) settings() linkSettings {
+	s := linkSettings{}
+	if speed := uint32(c.speedHi)<<16 | uint32(c.speed); speed != speedUnknown {
+		s.speed = unit.Datarate(speed) * unit.MegabitPerSecond
+	}
+	switch c.duplex {
+	case duplexHalf:
+		s.duplex = HalfDuplex
+	case duplexFull:
+		s.duplex = FullDuplex
+	}
+	// The fastest mode advertised by both ends is what the link should have
+	// negotiated. Not all drivers report the link partner's modes, so fall
+	// back to the fastest mode supported locally.
+	if common := c.advertising & c.lpAdvertising; common != 0 {
+		s.maxSpeed = maxModeSpeed(common)
+	} else {
+		s.maxSpeed = maxModeSpeed(c.supported)
+	}
+	return s
+}
+
+// getLinkSettings uses the SIOCETHTOOL ioctl to get the settings of the named
+// interface. Overridden in tests.
+var getLinkSettings = func(iface string) (linkSettings, error) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return linkSettings{}, err
+	}
+	defer unix.Close(fd)
+	cmd := ethtoolCmd{cmd: unix.ETHTOOL_GSET}
+	req := ifreq{data: unsafe.Pointer(&cmd)}
+	copy(req.name[:unix.IFNAMSIZ-1], iface)
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd),
+		unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&req)))
+	if errno != 0 {
+		return linkSettings{}, errno
+	}
+	return cmd.settings(), nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ethernet
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEthtoolCmdLayout(t *testing.T) {
+	require.Equal(t, uintptr(44), unsafe.Sizeof(ethtoolCmd{}),
+		"must match sizeof(struct ethtool_cmd)")
+}
+
+func TestSettings(t *testing.T) {
+	const (
+		mode100    = 1<<2 | 1<<3
+		mode1000   = 1<<4 | 1<<5
+		mode10000  = 1 << 12
+		modesUpTo1 = 1<<0 | 1<<1 | mode100 | mode1000
+	)
+	for _, tc := range []struct {
+		desc     string
+		cmd      ethtoolCmd
+		expected linkSettings
+	}{
+		{"gigabit",
+			ethtoolCmd{supported: modesUpTo1, advertising: modesUpTo1,
+				lpAdvertising: modesUpTo1, speed: 1000, duplex: duplexFull},
+			linkSettings{1000 * unit.MegabitPerSecond, 1000 * unit.MegabitPerSecond, FullDuplex}},
+		{"downshifted",
+			ethtoolCmd{supported: modesUpTo1, advertising: modesUpTo1,
+				lpAdvertising: modesUpTo1, speed: 100, duplex: duplexFull},
+			linkSettings{100 * unit.MegabitPerSecond, 1000 * unit.MegabitPerSecond, FullDuplex}},
+		{"slow partner",
+			ethtoolCmd{supported: modesUpTo1, advertising: modesUpTo1,
+				lpAdvertising: mode100, speed: 100, duplex: duplexHalf},
+			linkSettings{100 * unit.MegabitPerSecond, 100 * unit.MegabitPerSecond, HalfDuplex}},
+		{"unknown partner",
+			ethtoolCmd{supported: modesUpTo1 | mode10000, speed: 10000, duplex: duplexFull},
+			linkSettings{10000 * unit.MegabitPerSecond, 10000 * unit.MegabitPerSecond, FullDuplex}},
+		{"no link",
+			ethtoolCmd{supported: modesUpTo1, speed: 0xffff, speedHi: 0xffff, duplex: duplexUnknown},
+			linkSettings{0, 1000 * unit.MegabitPerSecond, DuplexUnknown}},
+		{"speed_hi",
+			ethtoolCmd{speed: 0x86a0, speedHi: 0x1, duplex: duplexFull},
+			linkSettings{100000 * unit.MegabitPerSecond, 0, FullDuplex}},
+	} {
+		require.Equal(t, tc.expected, tc.cmd.settings(), tc.desc)
+	}
+}
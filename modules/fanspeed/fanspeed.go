@@ -0,0 +1,191 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fanspeed provides a bar module that shows the speed of system fans,
+// as reported by hwmon.
+package fanspeed // import "barista.run/modules/fanspeed"
+
+import (
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/hwmon"
+	"barista.run/base/value"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Fan represents the current state of a single fan.
+type Fan struct {
+	// Name of the fan, in hwmon "chip/label" form, e.g. "thinkpad/fan1".
+	Name string
+	// RPM is the current speed of the fan.
+	RPM float64
+	// MinRPM is the threshold below which the fan is considered stalled.
+	MinRPM float64
+	// Err is non-nil if the fan speed could not be read.
+	Err error
+}
+
+// Stalled returns true if the fan is spinning slower than its threshold.
+func (f Fan) Stalled() bool {
+	return f.Err == nil && f.RPM < f.MinRPM
+}
+
+// Info represents the state of all fans displayed by the module.
+type Info []Fan
+
+// Stalled returns true if any of the fans are stalled.
+func (i Info) Stalled() bool {
+	for _, f := range i {
+		if f.Stalled() {
+			return true
+		}
+	}
+	return false
+}
+
+// Max returns the speed of the fastest fan, in RPM.
+func (i Info) Max() float64 {
+	max := 0.0
+	for _, f := range i {
+		if f.RPM > max {
+			max = f.RPM
+		}
+	}
+	return max
+}
+
+// Module represents a fan speed bar module.
+type Module struct {
+	patterns   []string
+	scheduler  *timing.Scheduler
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	minRPM     value.Value     // of float64
+	command    value.Value     // of []string
+}
+
+// New constructs a fan speed module for the fans matching the given hwmon
+// patterns (e.g. "thinkpad/fan1", "nct6775/fan*"). With no patterns, all fans
+// are shown. See package hwmon for details of sensor naming.
+func New(patterns ...string) *Module {
+	if len(patterns) == 0 {
+		patterns = []string{"*/*"}
+	}
+	m := &Module{patterns: patterns, scheduler: timing.NewScheduler()}
+	l.Register(m, "scheduler", "outputFunc", "minRPM", "command")
+	m.RefreshInterval(3 * time.Second)
+	m.Threshold(0)
+	m.command.Set([]string(nil))
+	m.Output(func(i Info) bar.Output {
+		out := outputs.Group()
+		for _, f := range i {
+			if f.Err != nil {
+				continue
+			}
+			out.Append(outputs.Textf("%.0f RPM", f.RPM).Urgent(f.Stalled()))
+		}
+		return out
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency for fan speeds.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Threshold sets the minimum expected speed for all fans. Fans spinning slower
+// than this are marked stalled (and shown as urgent by the default output).
+// Use a threshold of 1 to flag only fans that have stopped completely.
+func (m *Module) Threshold(minRPM float64) *Module {
+	m.minRPM.Set(minRPM)
+	return m
+}
+
+// ControlCommand sets a command to run when the module is clicked, e.g. a fan
+// control GUI.
+func (m *Module) ControlCommand(cmd string, args ...string) *Module {
+	m.command.Set(append([]string{cmd}, args...))
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(s bar.Sink) {
+	sensors := m.sensors()
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextThreshold, done := m.minRPM.Subscribe()
+	defer done()
+	nextCommand, done := m.command.Subscribe()
+	defer done()
+
+	info := m.read(sensors)
+	for {
+		out := outputs.Group(outputFunc(info))
+		if cmd := m.command.Get().([]string); len(cmd) > 0 {
+			out.OnClick(click.RunLeft(cmd[0], cmd[1:]...))
+		}
+		s.Output(out)
+		select {
+		case <-m.scheduler.C:
+			if len(sensors) == 0 {
+				// Fans may appear later, e.g. when a module is loaded.
+				sensors = m.sensors()
+			}
+			info = m.read(sensors)
+		case <-nextThreshold:
+			info = m.read(sensors)
+		case <-nextCommand:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func (m *Module) sensors() []hwmon.Sensor {
+	var sensors []hwmon.Sensor
+	seen := map[string]bool{}
+	for _, p := range m.patterns {
+		for _, s := range hwmon.FindOfKind(hwmon.Fan, p) {
+			if !seen[s.String()] {
+				seen[s.String()] = true
+				sensors = append(sensors, s)
+			}
+		}
+	}
+	return sensors
+}
+
+func (m *Module) read(sensors []hwmon.Sensor) Info {
+	minRPM := m.minRPM.Get().(float64)
+	info := make(Info, 0, len(sensors))
+	for _, s := range sensors {
+		f := Fan{Name: s.String(), MinRPM: minRPM}
+		f.RPM, f.Err = s.RPM()
+		info = append(info, f)
+	}
+	return info
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fanspeed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/hwmon"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+var fs afero.Fs
+
+func setRPM(file, rpm string) {
+	afero.WriteFile(fs, "/sys/class/hwmon/"+file, []byte(rpm), 0644)
+}
+
+func setupFans() {
+	fs = afero.NewMemMapFs()
+	hwmon.SetFsForTest(fs)
+	setRPM("hwmon0/name", "thinkpad")
+	setRPM("hwmon0/fan1_input", "2900")
+	setRPM("hwmon1/name", "nct6775")
+	setRPM("hwmon1/fan1_input", "800")
+	setRPM("hwmon1/fan2_input", "1200")
+	setRPM("hwmon1/fan2_label", "CPU_FAN")
+}
+
+func TestFanspeed(t *testing.T) {
+	setupFans()
+	testBar.New(t)
+
+	all := New()
+	cpu := New("*/CPU_FAN").Threshold(1)
+	testBar.Run(all, cpu)
+	out := testBar.LatestOutput()
+	out.At(0).AssertText("2900 RPM")
+	out.At(1).AssertText("800 RPM")
+	out.At(2).AssertText("1200 RPM")
+	out.At(3).AssertText("1200 RPM")
+	urgent, _ := out.At(3).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	setRPM("hwmon1/fan2_input", "0")
+	testBar.Tick()
+	out = testBar.LatestOutput(0, 1)
+	out.At(2).AssertText("0 RPM")
+	urgent, _ = out.At(2).Segment().IsUrgent()
+	require.False(t, urgent, "no threshold")
+	urgent, _ = out.At(3).Segment().IsUrgent()
+	require.True(t, urgent, "stalled fan")
+
+	all.Threshold(1000)
+	testBar.NextOutput("on threshold change")
+	cpu.Output(func(i Info) bar.Output {
+		return outputs.Textf("%d fans, max %.0f, stalled: %v", len(i), i.Max(), i.Stalled())
+	})
+	testBar.LatestOutput(1).At(3).AssertText("1 fans, max 0, stalled: true")
+
+	fs.Remove("/sys/class/hwmon/hwmon0/fan1_input")
+	setRPM("hwmon1/fan2_input", "1100")
+	testBar.Tick()
+	out = testBar.LatestOutput(0, 1)
+	require.Equal(t, 3, out.Len(), "unreadable fan omitted")
+	out.At(0).AssertText("800 RPM")
+	out.At(2).AssertText("1 fans, max 1100, stalled: false")
+}
+
+func TestNoFans(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	hwmon.SetFsForTest(fs)
+	testBar.New(t)
+
+	testBar.Run(New("thinkpad/*"))
+	testBar.NextOutput("no fans").AssertEmpty()
+
+	setRPM("hwmon0/name", "thinkpad")
+	setRPM("hwmon0/fan1_input", "2900")
+	testBar.Tick()
+	testBar.NextOutput("fan appears").AssertText([]string{"2900 RPM"})
+}
+
+func TestControlCommand(t *testing.T) {
+	setupFans()
+	testBar.New(t)
+
+	tmpDir, err := ioutil.TempDir("", "fanspeed")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	clicked := filepath.Join(tmpDir, "clicked")
+
+	m := New("thinkpad/fan1")
+	testBar.Run(m)
+	testBar.NextOutput().At(0).LeftClick()
+	time.Sleep(10 * time.Millisecond)
+	_, err = os.Stat(clicked)
+	require.True(t, os.IsNotExist(err), "no command by default")
+
+	m.ControlCommand("touch", clicked)
+	testBar.NextOutput("on command change").At(0).LeftClick()
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(clicked); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, err, "command runs on click")
+}
@@ -0,0 +1,181 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package flatpak provides a bar module that counts pending Flatpak updates,
+// and optionally pending Snap refreshes. Updates are checked on a schedule, and
+// whenever the appstream data for a Flatpak remote is refreshed.
+package flatpak // import "barista.run/modules/flatpak"
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/run"
+	"barista.run/base/value"
+	"barista.run/base/watchers/file"
+	"barista.run/base/watchers/metered"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents pending updates.
+type Info struct {
+	// Flatpak lists the applications and runtimes with pending updates.
+	Flatpak []string
+	// Snap lists the snaps with pending refreshes. It is always empty unless
+	// the module was constructed with WithSnap.
+	Snap []string
+}
+
+// Count returns the total number of pending updates.
+func (i Info) Count() int {
+	return len(i.Flatpak) + len(i.Snap)
+}
+
+// Module represents a bar module that shows pending Flatpak updates.
+type Module struct {
+	snap       bool
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+	interval   value.Value // of time.Duration
+}
+
+// New constructs a module that shows pending Flatpak updates, checking every
+// hour by default.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "outputFunc", "scheduler")
+	m.RefreshInterval(time.Hour)
+	m.Output(func(i Info) bar.Output {
+		if i.Count() == 0 {
+			return nil
+		}
+		return outputs.Textf("UPD %d", i.Count())
+	})
+	return m
+}
+
+// WithSnap constructs a module that shows pending updates for both Flatpak
+// and Snap.
+func WithSnap() *Module {
+	m := New()
+	m.snap = true
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency for updates. The interval is
+// stretched while the connection is metered (see metered.Interval).
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.interval.Set(interval)
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Overridden in tests.
+var (
+	execCommand   = run.Runner(exec.Command)
+	appstreamDirs = []string{
+		"/var/lib/flatpak/appstream",
+		filepath.Join(dataHome(), "flatpak", "appstream"),
+	}
+)
+
+func dataHome() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "share")
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	// The "active" symlink for each remote and architecture is replaced when
+	// flatpak refreshes its appstream data.
+	notifyFn, appstream := notifier.New()
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, dir := range appstreamDirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*", "*", "active"))
+		for _, f := range files {
+			w := file.Watch(f)
+			defer w.Unsubscribe()
+			// Errors are ignored, since updates are still checked on the
+			// schedule.
+			go w.Forward(notifyFn, stop)
+		}
+	}
+
+	if metered.Metered() {
+		m.scheduler.Every(metered.Interval(m.interval.Get().(time.Duration)))
+	}
+	info, err := m.getInfo()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info, err = m.getInfo()
+		case <-appstream:
+			info, err = m.getInfo()
+		case <-metered.Next():
+			m.scheduler.Every(metered.Interval(m.interval.Get().(time.Duration)))
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func (m *Module) getInfo() (i Info, err error) {
+	out, err := execCommand.Output("flatpak", "remote-ls", "--updates", "--columns=application")
+	if err != nil {
+		return i, err
+	}
+	i.Flatpak = strings.Fields(string(out))
+	if !m.snap {
+		return i, nil
+	}
+	// When there are no refreshes, snap prints a message to stderr instead of
+	// the table.
+	out, err = execCommand.Output("snap", "refresh", "--list")
+	if err != nil {
+		return i, err
+	}
+	for n, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || (n == 0 && fields[0] == "Name") {
+			continue
+		}
+		i.Snap = append(i.Snap, fields[0])
+	}
+	return i, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flatpak
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/metered"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/testing/fakeexec"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Modules from earlier tests may still be watching the appstream directory,
+// so a single directory is shared across all tests.
+var appstream string
+
+func init() {
+	metered.SetForTest(false)
+	execCommand = fakeexec.Command
+	var err error
+	appstream, err = ioutil.TempDir("", "flatpak")
+	if err != nil {
+		panic(err)
+	}
+	appstreamDirs = []string{appstream, filepath.Join(appstream, "nonexistent")}
+}
+
+func setup(t *testing.T) *fakeexec.Fake {
+	testBar.New(t)
+	return fakeexec.New()
+}
+
+func TestFlatpak(t *testing.T) {
+	f := setup(t)
+	f.Set("flatpak", "", "", 0)
+	m := New()
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertEmpty("without updates")
+
+	f.Set("flatpak", "org.gnome.Platform\norg.mozilla.firefox\n", "", 0)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"UPD 2"})
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%v %v", i.Flatpak, i.Snap)
+	})
+	testBar.NextOutput("on output change").AssertText(
+		[]string{"[org.gnome.Platform org.mozilla.firefox] []"})
+
+	f.Set("flatpak", "", "error: Unable to load summary from remote flathub", 1)
+	testBar.Tick()
+	errs := testBar.NextOutput("on error").AssertError()
+	require.Equal(t, "flatpak: error: Unable to load summary from remote flathub", errs[0])
+}
+
+func TestSnap(t *testing.T) {
+	f := setup(t)
+	f.Set("flatpak", "org.mozilla.firefox\n", "", 0)
+	f.Set("snap", "", "All snaps up to date.", 0)
+	testBar.Run(WithSnap().Output(func(i Info) bar.Output {
+		return outputs.Textf("%d: %v %v", i.Count(), i.Flatpak, i.Snap)
+	}))
+	testBar.NextOutput("on start").AssertText(
+		[]string{"1: [org.mozilla.firefox] []"})
+
+	f.Set("snap", `Name    Version   Rev   Publisher   Notes
+core    16-2.35   5548  canonical✓  core
+spotify 1.0.80    21    spotify✓    -
+`, "", 0)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText(
+		[]string{"3: [org.mozilla.firefox] [core spotify]"})
+
+	testBar.New(t)
+	f.Set("snap", "", "error: cannot communicate with server", 1)
+	testBar.Run(WithSnap())
+	testBar.NextOutput("on snap error").AssertError()
+
+	testBar.New(t)
+	testBar.Run(New())
+	testBar.NextOutput("without snap").AssertText([]string{"UPD 1"})
+}
+
+func TestAppstreamRefresh(t *testing.T) {
+	f := setup(t)
+	dir := filepath.Join(appstream, "flathub", "x86_64")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "abc"), 0755))
+	active := filepath.Join(dir, "active")
+	os.Remove(active)
+	require.NoError(t, os.Symlink("abc", active))
+
+	f.Set("flatpak", "", "", 0)
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertEmpty()
+
+	f.Set("flatpak", "org.mozilla.firefox\n", "", 0)
+	require.NoError(t, os.Symlink("def", active+".tmp"))
+	require.NoError(t, os.Rename(active+".tmp", active))
+	testBar.Drain(500*time.Millisecond, "on appstream refresh").
+		AssertText([]string{"UPD 1"})
+}
+
+func TestMetered(t *testing.T) {
+	f := setup(t)
+	defer metered.SetForTest(false)
+	f.Set("flatpak", "", "", 0)
+	testBar.Run(New().RefreshInterval(30 * time.Minute))
+	testBar.NextOutput("on start").AssertEmpty()
+
+	now := timing.Now()
+	require.Equal(t, 30*time.Minute, testBar.Tick().Sub(now), "normal interval")
+	testBar.NextOutput("on tick").AssertEmpty()
+
+	metered.SetForTest(true)
+	testBar.NextOutput("on metered connection").AssertEmpty()
+	f.Set("flatpak", "org.mozilla.firefox\n", "", 0)
+	now = timing.Now()
+	require.Equal(t, 2*time.Hour, testBar.Tick().Sub(now),
+		"interval stretched on metered connection")
+	testBar.NextOutput("on tick").AssertText([]string{"UPD 1"})
+
+	metered.SetForTest(false)
+	testBar.NextOutput("on unmetered connection").AssertText([]string{"UPD 1"})
+	now = timing.Now()
+	require.Equal(t, 30*time.Minute, testBar.Tick().Sub(now),
+		"normal interval restored")
+	testBar.NextOutput("on tick").AssertText([]string{"UPD 1"})
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package focusedproc provides a bar module that shows the CPU and memory
+// usage of the application in the focused window, including all its child
+// processes, e.g. the renderer processes of a browser or the language
+// servers started by an IDE. The focused window is tracked using the i3 (or
+// sway) IPC protocol.
+package focusedproc // import "barista.run/modules/focusedproc"
+
+import (
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/base/watchers/focus"
+	"barista.run/core"
+	"barista.run/format"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+)
+
+// Info represents the resource usage of the focused application.
+type Info struct {
+	// App is the app_id (Wayland) or window class (X11) of the focused
+	// window.
+	App string
+	// Title is the title of the focused window.
+	Title string
+	// PID is the process that owns the focused window, or 0 if no window is
+	// focused or its process is unknown.
+	PID int
+	// Procs is the number of processes in the tree, including PID.
+	Procs int
+	// CPU is the CPU usage of the process tree since the last refresh, as a
+	// percentage of a single core. It can exceed 100 for multi-threaded or
+	// multi-process applications.
+	CPU float64
+	// Memory is the total resident memory of the process tree. Memory shared
+	// between processes is counted once for each process.
+	Memory unit.Datasize
+}
+
+// Focused returns true if a window with a known process is focused.
+func (i Info) Focused() bool {
+	return i.PID != 0
+}
+
+// Module represents a bar module that shows the resource usage of the
+// focused application.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a focused process module.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "outputFunc", "scheduler")
+	m.RefreshInterval(3 * time.Second)
+	m.Output(func(i Info) bar.Output {
+		if !i.Focused() {
+			return nil
+		}
+		return outputs.Textf("%s %.0f%% %s", i.App, i.CPU, format.IBytesize(i.Memory))
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency for process usage.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	var focused value.ErrorValue // of focus.Window
+	nextFocus, done := focused.Subscribe()
+	defer done()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		focused.Error(focus.Watch(func(w focus.Window) { focused.Set(w) }, stop))
+	}()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	var prev, cur snapshot
+	rescan := true
+	for {
+		f, err := focused.Get()
+		if sink.Error(err) {
+			return
+		}
+		if rescan {
+			procs, err := scan()
+			if sink.Error(err) {
+				return
+			}
+			prev, cur = cur, snapshot{procs, timing.Now()}
+		}
+		if w, ok := f.(focus.Window); ok {
+			u := cur.tree(w.PID, prev)
+			i := Info{App: w.App, Title: w.Title, Procs: u.procs, CPU: u.cpu, Memory: u.memory}
+			if u.procs > 0 {
+				i.PID = w.PID
+			}
+			sink.Output(outputFunc(i))
+		}
+		rescan = false
+		select {
+		case <-nextFocus:
+		case <-m.scheduler.C:
+			rescan = true
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package focusedproc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/focus"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+)
+
+func init() {
+	focus.TestMode()
+}
+
+// focusWindow focuses a window of the given app and process.
+func focusWindow(app string, pid int) {
+	focus.Set(focus.Window{App: app, Title: app + " window", PID: pid})
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	pageSize = 4096
+	writeStats(map[int]proc{
+		1:   {ppid: 0, ticks: 1000, rss: 100},
+		100: {ppid: 1, ticks: 500, rss: 2048},
+		101: {ppid: 100, ticks: 200, rss: 512},
+		200: {ppid: 1, ticks: 50, rss: 256},
+	})
+	focusWindow("firefox", 100)
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertText([]string{"firefox 0% 10 MiB"})
+
+	writeStats(map[int]proc{
+		1:   {ppid: 0, ticks: 1000, rss: 100},
+		100: {ppid: 1, ticks: 650, rss: 2048},
+		101: {ppid: 100, ticks: 200, rss: 1536},
+		200: {ppid: 1, ticks: 80, rss: 256},
+	})
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"firefox 50% 14 MiB"})
+
+	focusWindow("emacs", 200)
+	testBar.NextOutput("on focus change").AssertText([]string{"emacs 10% 1.0 MiB"},
+		"uses the latest snapshot")
+
+	focus.Set(focus.Window{})
+	testBar.NextOutput("on empty workspace").AssertEmpty()
+
+	focusWindow("gone", 300)
+	testBar.NextOutput("on unknown process").AssertEmpty()
+
+	focus.Fail(errors.New("window manager exited"))
+	testBar.NextOutput("on window manager exit").AssertError()
+}
+
+func TestCustomOutput(t *testing.T) {
+	testBar.New(t)
+	writeStats(map[int]proc{100: {ppid: 1, ticks: 500, rss: 2048}})
+	focusWindow("code", 100)
+
+	m := New().RefreshInterval(time.Minute).Output(func(i Info) bar.Output {
+		return outputs.Textf("%s: %d (%d procs), %v", i.Title, i.PID, i.Procs, i.Focused())
+	})
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"code window: 100 (1 procs), true"})
+
+	focusWindow("gone", 300)
+	testBar.NextOutput("on unknown process").AssertText([]string{"gone window: 0 (0 procs), false"})
+
+	m.Output(func(i Info) bar.Output { return outputs.Text(i.App) })
+	testBar.NextOutput("on output change").AssertText([]string{"gone"})
+
+	testBar.AssertNoOutput("until refresh interval")
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"gone"})
+}
+
+func TestNoWindow(t *testing.T) {
+	testBar.New(t)
+	writeStats(nil)
+	focus.Set(focus.Window{})
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertEmpty()
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package focusedproc
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc/<pid>/stat, which is
+// 100 on all architectures supported by Go.
+const clockTicks = 100
+
+// Overridden in tests.
+var (
+	fs       = afero.NewOsFs()
+	pageSize = os.Getpagesize()
+)
+
+// proc represents the resource usage of a single process.
+type proc struct {
+	ppid  int
+	ticks uint64 // user + system time.
+	rss   uint64 // in pages.
+}
+
+// parseStat parses a /proc/<pid>/stat file. The command name can contain
+// spaces and parentheses, so fields are counted from the last ')'.
+func parseStat(stat string) (proc, bool) {
+	idx := strings.LastIndex(stat, ")")
+	if idx < 0 {
+		return proc{}, false
+	}
+	fields := strings.Fields(stat[idx+1:])
+	// fields[0] is field 3 (state) in proc(5).
+	if len(fields) < 22 {
+		return proc{}, false
+	}
+	var p proc
+	var err error
+	if p.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return proc{}, false
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	rss, err3 := strconv.ParseInt(fields[21], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return proc{}, false
+	}
+	p.ticks = utime + stime
+	if rss > 0 {
+		p.rss = uint64(rss)
+	}
+	return p, true
+}
+
+// scan reads the stat of all running processes, keyed by PID.
+func scan() (map[int]proc, error) {
+	dirs, err := afero.ReadDir(fs, "/proc")
+	if err != nil {
+		return nil, err
+	}
+	procs := map[int]proc{}
+	for _, d := range dirs {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		stat, err := afero.ReadFile(fs, filepath.Join("/proc", d.Name(), "stat"))
+		if err != nil {
+			// Process exited while scanning.
+			continue
+		}
+		if p, ok := parseStat(string(stat)); ok {
+			procs[pid] = p
+		}
+	}
+	return procs, nil
+}
+
+// snapshot is a scan of all processes at a point in time.
+type snapshot struct {
+	procs map[int]proc
+	at    time.Time
+}
+
+// usage is the combined resource usage of a process tree.
+type usage struct {
+	procs  int
+	cpu    float64
+	memory unit.Datasize
+}
+
+// tree returns the combined usage of the process and all its descendants.
+// CPU usage is the average since the previous snapshot, counting the full
+// CPU time of processes that started in between.
+func (s snapshot) tree(root int, prev snapshot) usage {
+	if _, ok := s.procs[root]; !ok {
+		return usage{}
+	}
+	children := map[int][]int{}
+	for pid, p := range s.procs {
+		children[p.ppid] = append(children[p.ppid], pid)
+	}
+	var u usage
+	var ticks uint64
+	pending := []int{root}
+	for len(pending) > 0 {
+		pid := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		pending = append(pending, children[pid]...)
+		p := s.procs[pid]
+		u.procs++
+		u.memory += unit.Datasize(p.rss*uint64(pageSize)) * unit.Byte
+		if old, ok := prev.procs[pid]; ok && old.ticks <= p.ticks {
+			ticks += p.ticks - old.ticks
+		} else if !ok {
+			ticks += p.ticks
+		}
+	}
+	if elapsed := s.at.Sub(prev.at).Seconds(); prev.procs != nil && elapsed > 0 {
+		u.cpu = float64(ticks) / clockTicks / elapsed * 100
+	}
+	return u
+}
@@ -0,0 +1,110 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package focusedproc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+// statLine returns a /proc/<pid>/stat line with the given fields set.
+func statLine(pid int, comm string, ppid int, utime, stime, rss uint64) string {
+	return fmt.Sprintf("%d (%s) S %d %d %d 0 -1 4194560 1234 0 0 0 %d %d "+
+		"0 0 20 0 1 0 5678 123456789 %d 18446744073709551615\n",
+		pid, comm, ppid, pid, pid, utime, stime, rss)
+}
+
+func TestParseStat(t *testing.T) {
+	p, ok := parseStat(statLine(42, "Web Content", 1, 150, 50, 2048))
+	require.True(t, ok)
+	require.Equal(t, proc{ppid: 1, ticks: 200, rss: 2048}, p)
+
+	p, ok = parseStat(statLine(42, "a) (b", 7, 1, 2, 3))
+	require.True(t, ok, "parentheses in command")
+	require.Equal(t, proc{ppid: 7, ticks: 3, rss: 3}, p)
+
+	for _, bad := range []string{
+		"", "42 (foo", "42 (foo) S 1 2 3",
+		statLine(42, "foo", 1, 1, 1, 1)[:60],
+		"42 (foo) S x 42 42 0 -1 4194560 1234 0 0 0 1 1 0 0 20 0 1 0 5678 1 1 1",
+		"42 (foo) S 1 42 42 0 -1 4194560 1234 0 0 0 x 1 0 0 20 0 1 0 5678 1 1 1",
+	} {
+		_, ok := parseStat(bad)
+		require.False(t, ok, "parseStat(%q)", bad)
+	}
+}
+
+func writeStats(procs map[int]proc) {
+	fs = afero.NewMemMapFs()
+	afero.WriteFile(fs, "/proc/uptime", []byte("1234.56 789.0\n"), 0644)
+	fs.MkdirAll("/proc/self", 0755)
+	for pid, p := range procs {
+		afero.WriteFile(fs, fmt.Sprintf("/proc/%d/stat", pid),
+			[]byte(statLine(pid, "proc", p.ppid, p.ticks, 0, p.rss)), 0644)
+	}
+}
+
+func TestScan(t *testing.T) {
+	pageSize = 4096
+	writeStats(map[int]proc{
+		1:   {ppid: 0, ticks: 1000, rss: 100},
+		100: {ppid: 1, ticks: 500, rss: 1000},
+		101: {ppid: 100, ticks: 200, rss: 500},
+		102: {ppid: 101, ticks: 100, rss: 250},
+		200: {ppid: 1, ticks: 50, rss: 10},
+	})
+	afero.WriteFile(fs, "/proc/300/stat", []byte("garbage"), 0644)
+	procs, err := scan()
+	require.NoError(t, err)
+	require.Len(t, procs, 5, "ignores invalid stat and non-process entries")
+
+	start := time.Unix(1000, 0)
+	first := snapshot{procs, start}
+	u := first.tree(100, snapshot{})
+	require.Equal(t, usage{procs: 3, memory: 1750 * 4 * unit.Kibibyte}, u,
+		"no CPU usage without previous snapshot")
+
+	writeStats(map[int]proc{
+		1:   {ppid: 0, ticks: 1000, rss: 100},
+		100: {ppid: 1, ticks: 600, rss: 1000},
+		101: {ppid: 100, ticks: 250, rss: 500},
+		103: {ppid: 100, ticks: 50, rss: 250},
+		200: {ppid: 1, ticks: 100, rss: 10},
+	})
+	procs, _ = scan()
+	second := snapshot{procs, start.Add(2 * time.Second)}
+	u = second.tree(100, first)
+	require.Equal(t, 3, u.procs)
+	require.InDelta(t, 100.0, u.cpu, 0.001, "200 ticks over 2 seconds")
+	require.Equal(t, 1750*4*unit.Kibibyte, u.memory)
+
+	u = second.tree(200, first)
+	require.InDelta(t, 25.0, u.cpu, 0.001)
+	require.Equal(t, usage{}, second.tree(102, first), "exited process")
+
+	writeStats(map[int]proc{100: {ppid: 1, ticks: 10, rss: 1}})
+	procs, _ = scan()
+	third := snapshot{procs, start.Add(3 * time.Second)}
+	require.Equal(t, 0.0, third.tree(100, second).cpu, "reused PID")
+
+	fs = afero.NewMemMapFs()
+	_, err = scan()
+	require.Error(t, err, "without /proc")
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package focusmode provides a process-wide "focus" switch, and a bar module to
+toggle it. Other modules follow the switch to reduce distractions while focus
+mode is enabled:
+
+	mail := focusmode.Pause(gmail.New(...))      // stops polling, hidden
+	slack := focusmode.Pause(slack.New(...))
+	clock := focusmode.Minimal(clock.Local())    // plain text, no colours
+	dnd := notifications.Dunst().FollowFocusMode() // do-not-disturb
+
+	barista.Run(focusmode.New(), mail, slack, clock, dnd)
+
+The switch can also be controlled directly using Set and Toggle, e.g. from a
+click handler on another module.
+*/
+package focusmode // import "barista.run/modules/focusmode"
+
+import (
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/value"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents the state of the focus switch.
+type Info struct {
+	// Active is true if focus mode is enabled.
+	Active bool
+	// Since is when focus mode was last enabled or disabled. It is zero if
+	// focus mode has not been changed since the bar started.
+	Since time.Time
+}
+
+// Toggle enables or disables focus mode.
+func (i Info) Toggle() { Toggle() }
+
+// Enable enables focus mode.
+func (i Info) Enable() { Set(true) }
+
+// Disable disables focus mode.
+func (i Info) Disable() { Set(false) }
+
+var (
+	state   value.Value // of Info
+	stateMu sync.Mutex
+)
+
+// Get returns the current state of the focus switch.
+func Get() Info {
+	i, _ := state.Get().(Info)
+	return i
+}
+
+// Active returns true if focus mode is enabled.
+func Active() bool {
+	return Get().Active
+}
+
+// Set enables or disables focus mode, notifying all subscribers if the state
+// changed.
+func Set(active bool) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	set(active)
+}
+
+// Toggle enables or disables focus mode.
+func Toggle() {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	set(!Active())
+}
+
+func set(active bool) {
+	if Active() == active {
+		return
+	}
+	l.Log("Focus mode active: %v", active)
+	state.Set(Info{Active: active, Since: timing.Now()})
+}
+
+// Subscribe returns a channel that receives an empty struct{} each time focus
+// mode is enabled or disabled, until it's cleaned up using the done func.
+func Subscribe() (sub <-chan struct{}, done func()) {
+	return state.Subscribe()
+}
+
+// Module represents a bar module that shows and toggles the focus switch.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// New constructs a focus mode module.
+func New() *Module {
+	m := &Module{}
+	l.Register(m, "outputFunc")
+	m.Output(func(i Info) bar.Output {
+		state := "off"
+		if i.Active {
+			state = "on"
+		}
+		return outputs.Textf("focus %s", state).OnClick(click.Left(i.Toggle))
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextState, done := Subscribe()
+	defer done()
+	for {
+		sink.Output(outputFunc(Get()))
+		select {
+		case <-nextState:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
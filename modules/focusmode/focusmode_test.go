@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package focusmode
+
+import (
+	"testing"
+	"time"
+
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func assertNotified(t *testing.T, sub <-chan struct{}, msg string) {
+	select {
+	case <-sub:
+	case <-time.After(time.Second):
+		require.Fail(t, "not notified", msg)
+	}
+}
+
+func assertNotNotified(t *testing.T, sub <-chan struct{}, msg string) {
+	select {
+	case <-sub:
+		require.Fail(t, "unexpected notification", msg)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	testBar.New(t)
+	Set(false)
+	sub, done := Subscribe()
+	defer done()
+	require.False(t, Active())
+
+	Toggle()
+	assertNotified(t, sub, "on toggle")
+	require.True(t, Active())
+	require.Equal(t, timing.Now(), Get().Since)
+
+	timing.AdvanceBy(time.Minute)
+	Set(true)
+	assertNotNotified(t, sub, "unchanged")
+	require.Equal(t, timing.Now().Add(-time.Minute), Get().Since)
+
+	Get().Disable()
+	assertNotified(t, sub, "on disable")
+	require.False(t, Active())
+	require.Equal(t, timing.Now(), Get().Since)
+
+	Get().Enable()
+	assertNotified(t, sub, "on enable")
+	Get().Toggle()
+	assertNotified(t, sub, "on toggle")
+	require.False(t, Active())
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	Set(false)
+	testBar.Run(New())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"focus off"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on click")
+	out.AssertText([]string{"focus on"})
+	require.True(t, Active())
+
+	Set(false)
+	testBar.NextOutput("on change").AssertText([]string{"focus off"})
+}
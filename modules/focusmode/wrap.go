@@ -0,0 +1,149 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package focusmode
+
+import (
+	"sync"
+
+	"barista.run/bar"
+	l "barista.run/logging"
+	"barista.run/modules/meta/reformat"
+)
+
+type pausedModule struct {
+	original bar.Module
+}
+
+// Pause wraps a module so that it is hidden while focus mode is enabled.
+// Since modules cannot be interrupted, the wrapped module is blocked the next
+// time it produces output, which stops any polling until focus mode is
+// disabled. The latest output is shown again when focus mode is disabled.
+func Pause(original bar.Module) bar.Module {
+	m := &pausedModule{original}
+	l.Label(m, l.ID(original))
+	return m
+}
+
+// Stream starts the wrapped module.
+func (m *pausedModule) Stream(s bar.Sink) {
+	var mu sync.Mutex
+	var last bar.Output
+	// blocked is true while the wrapped module is waiting to output, in which
+	// case its new output is shown instead of the last one.
+	var blocked bool
+	output := func(o bar.Output) {
+		mu.Lock()
+		defer mu.Unlock()
+		if Active() {
+			s.Output(nil)
+		} else {
+			s.Output(o)
+		}
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	nextState, done := Subscribe()
+	go func() {
+		defer done()
+		for {
+			select {
+			case <-nextState:
+				mu.Lock()
+				o, skip := last, blocked && !Active()
+				mu.Unlock()
+				if !skip {
+					output(o)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	if Active() {
+		output(nil)
+	}
+
+	unpaused, unsubscribe := Subscribe()
+	defer unsubscribe()
+	m.original.Stream(func(o bar.Output) {
+		mu.Lock()
+		blocked = true
+		mu.Unlock()
+		for Active() {
+			<-unpaused
+		}
+		mu.Lock()
+		last, blocked = o, false
+		mu.Unlock()
+		output(o)
+	})
+}
+
+// Minimal wraps a module so that its output is shown as plain text while
+// focus mode is enabled, without colours, backgrounds, borders, or urgency.
+// Click handlers and errors are unchanged.
+func Minimal(original bar.Module) bar.Module {
+	m := &minimalModule{reformat.New(original)}
+	l.Label(m, l.ID(original))
+	return m
+}
+
+type minimalModule struct {
+	*reformat.Module
+}
+
+// Stream starts the wrapped module.
+func (m *minimalModule) Stream(s bar.Sink) {
+	nextState, done := Subscribe()
+	stop := make(chan struct{})
+	defer close(stop)
+	m.format()
+	go func() {
+		defer done()
+		for {
+			select {
+			case <-nextState:
+				m.format()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	m.Module.Stream(s)
+}
+
+func (m *minimalModule) format() {
+	if Active() {
+		m.Format(reformat.EachSegment(reformat.SkipErrors(minimal)))
+	} else {
+		m.Format(reformat.Original)
+	}
+}
+
+func minimal(in *bar.Segment) *bar.Segment {
+	text, isPango := in.Content()
+	out := bar.TextSegment(text)
+	if isPango {
+		out = bar.PangoSegment(text)
+	}
+	if short, ok := in.GetShortText(); ok {
+		out.ShortText(short)
+	}
+	if in.HasClick() {
+		out.OnClick(in.Click)
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package focusmode
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	testModule "barista.run/testing/module"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPause(t *testing.T) {
+	testBar.New(t)
+	Set(false)
+	original := testModule.New(t)
+	testBar.Run(Pause(original))
+	original.AssertStarted()
+
+	original.OutputText("a")
+	testBar.NextOutput("on output").AssertText([]string{"a"})
+
+	Set(true)
+	testBar.NextOutput("on focus").AssertEmpty("hidden")
+
+	original.OutputText("b")
+	original.OutputText("c")
+	testBar.AssertNoOutput("while paused")
+
+	Set(false)
+	testBar.Drain(50*time.Millisecond, "on unpause").
+		AssertText([]string{"c"}, "queued outputs shown")
+
+	Set(true)
+	testBar.NextOutput("on focus").AssertEmpty("hidden")
+	Set(false)
+	testBar.NextOutput("on unpause").AssertText([]string{"c"},
+		"last output shown")
+}
+
+func TestPauseWhileActive(t *testing.T) {
+	testBar.New(t)
+	Set(true)
+	original := testModule.New(t)
+	testBar.Run(Pause(original))
+	testBar.NextOutput("on start").AssertEmpty()
+
+	original.OutputText("a")
+	testBar.AssertNoOutput("while paused")
+	Set(false)
+	testBar.NextOutput("on unpause").AssertText([]string{"a"})
+}
+
+func TestMinimal(t *testing.T) {
+	testBar.New(t)
+	Set(false)
+	original := testModule.New(t)
+	testBar.Run(Minimal(original))
+	original.AssertStarted()
+
+	red := colors.Hex("#ff0000")
+	original.Output(outputs.Group(
+		outputs.Text("a").Color(red).Background(red).Urgent(true),
+		bar.PangoSegment("<b>b</b>").Border(red),
+		outputs.Errorf("c"),
+	))
+	out := testBar.NextOutput("on output")
+	out.AssertText([]string{"a", "<b>b</b>", "Error"})
+	_, ok := out.At(0).Segment().GetColor()
+	require.True(t, ok)
+
+	Set(true)
+	out = testBar.Drain(50*time.Millisecond, "on focus")
+	out.AssertText([]string{"a", "<b>b</b>", "Error"})
+	for i := 0; i < 2; i++ {
+		s := out.At(i).Segment()
+		_, hasColor := s.GetColor()
+		_, hasBackground := s.GetBackground()
+		_, hasBorder := s.GetBorder()
+		urgent, _ := s.IsUrgent()
+		require.False(t, hasColor || hasBackground || hasBorder || urgent,
+			"segment %d is plain", i)
+	}
+	_, isPango := out.At(1).Segment().Content()
+	require.True(t, isPango)
+	out.At(2).AssertError("errors passed through")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	original.AssertClicked("clicks passed through")
+
+	Set(false)
+	out = testBar.Drain(50*time.Millisecond, "on unfocus")
+	_, ok = out.At(0).Segment().GetColor()
+	require.True(t, ok, "original formatting restored")
+}
@@ -74,13 +74,26 @@ func Every(d time.Duration, f Func) *RepeatingModule {
 // RepeatingModule represents a bar.Module that runs a function at a fixed
 // interval (while accounting for bar paused/resumed state).
 type RepeatingModule struct {
-	fn       Func
-	duration time.Duration
+	fn          Func
+	duration    time.Duration
+	whilePaused bool
+}
+
+// RunWhilePaused keeps running the function even while the bar is paused
+// (hidden). Use this for functions that must keep running regardless of the
+// bar's visibility, e.g. a pomodoro timer that notifies when time is up.
+func (r *RepeatingModule) RunWhilePaused() *RepeatingModule {
+	r.whilePaused = true
+	return r
 }
 
 // Stream starts the module.
 func (r *RepeatingModule) Stream(s bar.Sink) {
-	sch := timing.NewScheduler().Every(r.duration)
+	sch := timing.NewScheduler()
+	if r.whilePaused {
+		sch.RunWhilePaused()
+	}
+	sch.Every(r.duration)
 	for {
 		r.fn(s)
 		sch.Tick()
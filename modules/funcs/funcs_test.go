@@ -23,6 +23,7 @@ import (
 	"barista.run/bar"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
+	"barista.run/timing"
 
 	"github.com/stretchr/testify/require"
 )
@@ -121,3 +122,25 @@ func TestRepeated(t *testing.T) {
 	testBar.NextOutput().AssertText(
 		[]string{"3"}, "Function is called on next tick")
 }
+
+func TestRepeatedWhilePaused(t *testing.T) {
+	testBar.New(t)
+	atomic.StoreInt64(&count, 0)
+
+	paused := Every(time.Minute, doFunc)
+	running := Every(time.Minute, doFunc).RunWhilePaused()
+	testBar.Run(paused, running)
+	testBar.LatestOutput(0, 1).Expect("on start")
+	require.Equal(t, int64(2), atomic.LoadInt64(&count))
+
+	timing.Pause()
+	timing.NextTick()
+	testBar.LatestOutput(1).Expect("running while paused")
+	require.Equal(t, int64(3), atomic.LoadInt64(&count),
+		"only one function called while paused")
+
+	timing.Resume()
+	testBar.LatestOutput(0).Expect("on resume")
+	require.Equal(t, int64(4), atomic.LoadInt64(&count),
+		"paused function called on resume")
+}
@@ -0,0 +1,229 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/oauth"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+// Item represents an issue or pull request.
+type Item struct {
+	// Repo is the full name of the repository, e.g. "owner/name".
+	Repo        string
+	Number      int
+	Title       string
+	URL         string
+	PullRequest bool
+	Updated     time.Time
+}
+
+// Activity represents open issues and pull requests that need the user's
+// attention. Each list contains at most 100 items, most recently updated first.
+type Activity struct {
+	// ReviewRequests are pull requests for which the user's review has been
+	// requested.
+	ReviewRequests []Item
+	// Mentions are issues and pull requests that directly mention the user.
+	Mentions []Item
+	// Assigned are issues assigned to the user.
+	Assigned []Item
+}
+
+// Total returns the total number of items across all categories.
+func (a Activity) Total() int {
+	return len(a.ReviewRequests) + len(a.Mentions) + len(a.Assigned)
+}
+
+// ActivityModule represents a GitHub barista module that displays review
+// requests, mentions, and assigned issues.
+type ActivityModule struct {
+	config     *oauth.Config
+	apiURL     string
+	repos      value.Value // of []string
+	scheduler  *timing.Scheduler
+	outputFunc core.OutputFunc // of func(Activity) bar.Output
+}
+
+// NewActivity creates a GitHub activity module using the given clientID and
+// secret. Since it uses the search API, which has a low rate limit, it refreshes
+// every 5 minutes by default.
+func NewActivity(clientID, clientSecret string) *ActivityModule {
+	return newActivity(github.Endpoint, apiURL, clientID, clientSecret)
+}
+
+// NewEnterpriseActivity creates a GitHub activity module for a GitHub
+// Enterprise server at the given base URL.
+func NewEnterpriseActivity(baseURL, clientID, clientSecret string) *ActivityModule {
+	endpoint, api := enterprise(baseURL)
+	return newActivity(endpoint, api, clientID, clientSecret)
+}
+
+func newActivity(endpoint oauth2.Endpoint, api, clientID, clientSecret string) *ActivityModule {
+	config := oauth.Register(&oauth2.Config{
+		Endpoint:     endpoint,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		// Required to search private repositories.
+		Scopes: []string{"repo"},
+	})
+	m := &ActivityModule{
+		config:    config,
+		apiURL:    api,
+		scheduler: timing.NewScheduler(),
+	}
+	l.Register(m, "scheduler", "repos", "outputFunc")
+	m.repos.Set([]string(nil))
+	m.RefreshInterval(5 * time.Minute)
+	m.Output(func(a Activity) bar.Output {
+		if a.Total() == 0 {
+			return nil
+		}
+		return outputs.Textf("GH: %d/%d/%d",
+			len(a.ReviewRequests), len(a.Mentions), len(a.Assigned))
+	})
+	return m
+}
+
+// Output sets the output format for this module.
+func (m *ActivityModule) Output(outputFunc func(Activity) bar.Output) *ActivityModule {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency.
+func (m *ActivityModule) RefreshInterval(interval time.Duration) *ActivityModule {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Repos restricts the module to items in the given repositories, which can be
+// either a full name ("owner/name") or an owner ("owner") to include all of the
+// owner's repositories. With no arguments, all repositories are included.
+func (m *ActivityModule) Repos(repos ...string) *ActivityModule {
+	m.repos.Set(repos)
+	return m
+}
+
+// Stream starts the module.
+func (m *ActivityModule) Stream(sink bar.Sink) {
+	client, _ := m.config.Client()
+	if wrapForTest != nil {
+		wrapForTest(client)
+	}
+	outf := m.outputFunc.Get().(func(Activity) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	repos := m.repos.Get().([]string)
+	nextRepos, done := m.repos.Subscribe()
+	defer done()
+	activity, err := m.getActivity(client, repos)
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outf(activity))
+		select {
+		case <-nextOutputFunc:
+			outf = m.outputFunc.Get().(func(Activity) bar.Output)
+		case <-nextRepos:
+			repos = m.repos.Get().([]string)
+			activity, err = m.getActivity(client, repos)
+		case <-m.scheduler.C:
+			activity, err = m.getActivity(client, repos)
+		}
+	}
+}
+
+func (m *ActivityModule) getActivity(client *http.Client, repos []string) (a Activity, err error) {
+	filter := ""
+	for _, r := range repos {
+		if strings.Contains(r, "/") {
+			filter += " repo:" + r
+		} else {
+			filter += " user:" + r
+		}
+	}
+	if a.ReviewRequests, err = m.search(client, "is:open is:pr review-requested:@me"+filter); err != nil {
+		return a, err
+	}
+	if a.Mentions, err = m.search(client, "is:open mentions:@me"+filter); err != nil {
+		return a, err
+	}
+	a.Assigned, err = m.search(client, "is:open is:issue assignee:@me"+filter)
+	return a, err
+}
+
+type ghSearchResult struct {
+	Items []struct {
+		Number        int
+		Title         string
+		HTMLURL       string          `json:"html_url"`
+		RepositoryURL string          `json:"repository_url"`
+		PullRequest   json.RawMessage `json:"pull_request"`
+		UpdatedAt     time.Time       `json:"updated_at"`
+	}
+}
+
+func (m *ActivityModule) search(client *http.Client, query string) ([]Item, error) {
+	params := url.Values{
+		"q":        {query},
+		"sort":     {"updated"},
+		"per_page": {"100"},
+	}
+	r, err := client.Get(m.apiURL + "/search/issues?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		return nil, fmt.Errorf("HTTP Status %d", r.StatusCode)
+	}
+	var resp ghSearchResult
+	if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	var items []Item
+	for _, i := range resp.Items {
+		repo := i.RepositoryURL
+		if idx := strings.Index(repo, "/repos/"); idx >= 0 {
+			repo = repo[idx+len("/repos/"):]
+		}
+		items = append(items, Item{
+			Repo:        repo,
+			Number:      i.Number,
+			Title:       i.Title,
+			URL:         i.HTMLURL,
+			PullRequest: len(i.PullRequest) > 0 && string(i.PullRequest) != "null",
+			Updated:     i.UpdatedAt,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+type searchResponder struct {
+	sync.Mutex
+	results map[string]string
+	queries []string
+	status  int
+}
+
+func (s *searchResponder) set(category, items string) {
+	s.Lock()
+	defer s.Unlock()
+	s.results[category] = items
+}
+
+func (s *searchResponder) lastQueries() []string {
+	s.Lock()
+	defer s.Unlock()
+	q := s.queries
+	s.queries = nil
+	return q
+}
+
+func (s *searchResponder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	if r.URL.Path != "/search/issues" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query().Get("q")
+	s.queries = append(s.queries, q)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	items := ""
+	for category, result := range s.results {
+		if strings.Contains(q, category) {
+			items = result
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{"total_count": 0, "items": [%s]}`, items)
+}
+
+func TestActivity(t *testing.T) {
+	require := require.New(t)
+	testBar.New(t)
+	s := &searchResponder{results: map[string]string{}}
+	respondWith(s.ServeHTTP)
+	s.set("review-requested:@me", `{
+		"number": 12, "title": "Add feature",
+		"html_url": "https://github.com/o/r/pull/12",
+		"repository_url": "https://api.github.com/repos/o/r",
+		"pull_request": {"url": "https://api.github.com/repos/o/r/pulls/12"},
+		"updated_at": "2018-10-25T15:16:27Z"
+	}`)
+	s.set("assignee:@me", `{"number": 1, "title": "Bug",
+		"repository_url": "https://api.github.com/repos/o/r"},
+		{"number": 2, "title": "Other bug", "pull_request": null,
+		"repository_url": "https://api.github.com/repos/o/s"}`)
+
+	var activity Activity
+	gh := NewActivity("clientid", "clientsecret").Output(func(a Activity) bar.Output {
+		activity = a
+		return outputs.Textf("%d", a.Total())
+	})
+	testBar.Run(gh)
+	testBar.NextOutput().AssertText([]string{"3"})
+	require.Equal([]string{
+		"is:open is:pr review-requested:@me",
+		"is:open mentions:@me",
+		"is:open is:issue assignee:@me",
+	}, s.lastQueries())
+	require.Equal([]Item{{
+		Repo:        "o/r",
+		Number:      12,
+		Title:       "Add feature",
+		URL:         "https://github.com/o/r/pull/12",
+		PullRequest: true,
+		Updated:     time.Date(2018, 10, 25, 15, 16, 27, 0, time.UTC),
+	}}, activity.ReviewRequests)
+	require.Empty(activity.Mentions)
+	require.Equal([]Item{
+		{Repo: "o/r", Number: 1, Title: "Bug"},
+		{Repo: "o/s", Number: 2, Title: "Other bug"},
+	}, activity.Assigned)
+
+	s.set("mentions:@me", `{"number": 3, "repository_url": "https://api.github.com/repos/o/s"}`)
+	gh.Repos("o/s", "org")
+	testBar.NextOutput().AssertText([]string{"4"}, "on repo filter change")
+	require.Equal([]string{
+		"is:open is:pr review-requested:@me repo:o/s user:org",
+		"is:open mentions:@me repo:o/s user:org",
+		"is:open is:issue assignee:@me repo:o/s user:org",
+	}, s.lastQueries())
+
+	gh.Output(func(a Activity) bar.Output {
+		return outputs.Textf("%d", len(a.Mentions))
+	})
+	testBar.NextOutput().AssertText([]string{"1"}, "on output change")
+	require.Empty(s.lastQueries(), "output change uses existing data")
+
+	s.set("review-requested:@me", "")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"1"}, "on refresh")
+	require.Len(s.lastQueries(), 3)
+
+	s.Lock()
+	s.status = http.StatusForbidden
+	s.Unlock()
+	testBar.Tick()
+	errs := testBar.NextOutput().AssertError("on HTTP error")
+	require.Contains(errs[0], "HTTP Status 403")
+	require.Len(s.lastQueries(), 1, "stops at first error")
+}
+
+func TestActivityDefaults(t *testing.T) {
+	testBar.New(t)
+	s := &searchResponder{results: map[string]string{}}
+	respondWith(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/api/v3")
+		s.ServeHTTP(w, r)
+	})
+	gh := NewEnterpriseActivity("https://github.example.com", "clientid", "clientsecret")
+	testBar.Run(gh)
+	testBar.NextOutput().AssertEmpty("with no items")
+
+	s.set("mentions:@me", `{"number": 1}, {"number": 2}`)
+	s.set("assignee:@me", `{"number": 3}`)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"GH: 0/2/1"})
+}
@@ -12,7 +12,8 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package github provides a barista module to show github notifications.
+// Package github provides barista modules to show github notifications, and
+// pull requests and issues that need the user's attention.
 package github // import "barista.run/modules/github"
 
 import (
@@ -21,10 +22,12 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"barista.run/bar"
-	"barista.run/base/value"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/core"
 	"barista.run/oauth"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -51,7 +54,8 @@ func (n Notifications) Total() int {
 // Module represents a GitHub barista module that displays notification counts.
 type Module struct {
 	config     *oauth.Config
-	outputFunc value.Value // of func(Notifications) bar.Output
+	apiURL     string
+	outputFunc core.OutputFunc // of func(Notifications) bar.Output
 
 	// Use the poll interval and last modified from the previous response to
 	// control when we next check for notifications.
@@ -59,16 +63,41 @@ type Module struct {
 	lastModified string
 }
 
+const apiURL = "https://api.github.com"
+
 // New creates a GitHub module using the given clientID and secret.
 func New(clientID, clientSecret string) *Module {
+	return newModule(github.Endpoint, apiURL, clientID, clientSecret)
+}
+
+// NewEnterprise creates a GitHub module for a GitHub Enterprise server at the
+// given base URL (e.g. "https://github.example.com"), using the given clientID
+// and secret of an OAuth app registered on that server.
+func NewEnterprise(baseURL, clientID, clientSecret string) *Module {
+	endpoint, api := enterprise(baseURL)
+	return newModule(endpoint, api, clientID, clientSecret)
+}
+
+// enterprise returns the OAuth endpoint and API URL for a GitHub Enterprise
+// server.
+func enterprise(baseURL string) (oauth2.Endpoint, string) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return oauth2.Endpoint{
+		AuthURL:  baseURL + "/login/oauth/authorize",
+		TokenURL: baseURL + "/login/oauth/access_token",
+	}, baseURL + "/api/v3"
+}
+
+func newModule(endpoint oauth2.Endpoint, api, clientID, clientSecret string) *Module {
 	config := oauth.Register(&oauth2.Config{
-		Endpoint:     github.Endpoint,
+		Endpoint:     endpoint,
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		Scopes:       []string{"notifications"},
 	})
 	m := &Module{
 		config:    config,
+		apiURL:    api,
 		scheduler: timing.NewScheduler(),
 	}
 	m.Output(func(n Notifications) bar.Output {
@@ -97,23 +126,34 @@ func (m *Module) Stream(sink bar.Sink) {
 	outf := m.outputFunc.Get().(func(Notifications) bar.Output)
 	nextOutputFunc, done := m.outputFunc.Subscribe()
 	defer done()
-	info, err := m.getNotifications(client)
+	var info Notifications
+	var err error
+	poller := connectivity.NewPoller(func() {
+		i, e := m.getNotifications(client)
+		err = e
+		if e != errCached {
+			info = i
+		}
+	})
+	poller.Poll()
 	for {
 		if err != errCached {
 			if sink.Error(err) {
 				return
 			}
-			sink.Output(outf(info))
+			sink.Output(poller.Output(func() bar.Output { return outf(info) }))
 		}
 		err = nil
 		select {
 		case <-nextOutputFunc:
 			outf = m.outputFunc.Get().(func(Notifications) bar.Output)
 		case <-m.scheduler.C:
-			i, e := m.getNotifications(client)
-			err = e
-			if e != errCached {
-				info = i
+			poller.Poll()
+		case <-connectivity.Next():
+			poller.Poll()
+			if err == errCached {
+				// Still need to update the offline marker.
+				err = nil
 			}
 		}
 	}
@@ -123,7 +163,7 @@ func (m *Module) Stream(sink bar.Sink) {
 var errCached = errors.New("NothingChanged")
 
 func (m *Module) getNotifications(client *http.Client) (Notifications, error) {
-	req, _ := http.NewRequest("GET", "https://api.github.com/notifications", nil)
+	req, _ := http.NewRequest("GET", m.apiURL+"/notifications", nil)
 	if m.lastModified != "" {
 		req.Header.Add("If-Modified-Since", m.lastModified)
 	}
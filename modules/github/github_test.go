@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"barista.run/bar"
+	"barista.run/base/watchers/connectivity"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
 	"barista.run/testing/httpclient"
@@ -149,9 +150,23 @@ func TestErrors(t *testing.T) {
 	testBar.NextOutput().AssertError("On HTTP Client Error")
 }
 
+func TestEnterprise(t *testing.T) {
+	testBar.New(t)
+	respondWith(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v3/notifications", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, `[{"reason": "mention", "unread": true}]`)
+	})
+	gh := NewEnterprise("https://github.example.com/", "clientid", "clientsecret")
+	require.Equal(t, "https://github.example.com/api/v3", gh.apiURL)
+	testBar.Run(gh)
+	testBar.NextOutput().AssertText([]string{"GH: 1"})
+}
+
 func TestMain(m *testing.M) {
+	connectivity.SetForTest(true)
 	mux := http.NewServeMux()
-	mux.HandleFunc("/notifications", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		responseFuncMu.Lock()
 		defer responseFuncMu.Unlock()
 		responseFunc(w, r)
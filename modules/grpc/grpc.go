@@ -0,0 +1,260 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package grpc provides a bar module that shows a module running in a separate
+process, using the barista.Module gRPC service defined in barista.proto. This
+allows modules to be written in other languages, and isolates the bar from
+modules that crash or leak.
+
+Go modules can be served using modules/grpc/server. Modules in other languages
+can generate a server from barista.proto, and listen on the address in the
+BARISTA_GRPC_ADDRESS environment variable.
+
+Only unencrypted HTTP/2 is supported, so connections to other hosts should
+use a unix socket forwarded over ssh, or a similar secure channel.
+*/
+package grpc // import "barista.run/modules/grpc"
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"barista.run/bar"
+	l "barista.run/logging"
+	"barista.run/modules/grpc/wire"
+
+	"golang.org/x/net/http2"
+)
+
+// Module represents a bar module that shows the output of a module served
+// over gRPC.
+type Module struct {
+	address string
+	cmd     []string
+}
+
+// New constructs a module that connects to a module server at the given
+// address, either "unix:<path>" for a unix socket, or "host:port" for TCP.
+// If the connection fails, the module shows an error, and reconnects on
+// click.
+func New(address string) *Module {
+	m := &Module{address: address}
+	l.Label(m, address)
+	return m
+}
+
+// Command constructs a module that starts the given command, and connects to
+// the module it serves. The command is given a unix socket address to listen
+// on in the BARISTA_GRPC_ADDRESS environment variable. If the command exits,
+// the module shows an error, and restarts the command on click.
+func Command(name string, args ...string) *Module {
+	m := &Module{cmd: append([]string{name}, args...)}
+	l.Label(m, name)
+	return m
+}
+
+// Overridden in tests.
+var (
+	connectTimeout = 10 * time.Second
+	clickTimeout   = 5 * time.Second
+	exitWait       = time.Second
+)
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	address, exited := m.address, (<-chan error)(nil)
+	if m.cmd != nil {
+		dir, err := ioutil.TempDir("", "barista-grpc")
+		if sink.Error(err) {
+			return
+		}
+		defer os.RemoveAll(dir)
+		address = "unix:" + filepath.Join(dir, "module.sock")
+		cmd := exec.Command(m.cmd[0], m.cmd[1:]...)
+		cmd.Env = append(os.Environ(), wire.AddressEnv+"="+address)
+		cmd.Stderr = os.Stderr
+		// Prevent SIGUSR for bar pause/resume from propagating to the child
+		// process, as in shell.Tail.
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		if sink.Error(cmd.Start()) {
+			return
+		}
+		exitCh := make(chan error, 1)
+		go func() { exitCh <- cmd.Wait() }()
+		defer cmd.Process.Kill()
+		exited = exitCh
+	}
+
+	c := newClient(address)
+	defer c.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp, err := c.connect(ctx, exited)
+	if sink.Error(err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	outputs := make(chan wire.Output)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			var o wire.Output
+			err := wire.ReadMessage(resp.Body, &o)
+			if err == io.EOF {
+				if err = wire.Status(resp); err == nil {
+					err = errors.New("stream ended")
+				}
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case outputs <- o:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case o := <-outputs:
+			sink.Output(o.ToSegments(c.click))
+		case err := <-errs:
+			// If the command crashed, show its exit status instead.
+			select {
+			case exitErr := <-exited:
+				err = exitError(exitErr)
+			case <-time.After(exitWait):
+			}
+			sink.Error(err)
+			return
+		case err := <-exited:
+			sink.Error(exitError(err))
+			return
+		}
+	}
+}
+
+func exitError(err error) error {
+	if err == nil {
+		return errors.New("module exited")
+	}
+	return fmt.Errorf("module exited: %v", err)
+}
+
+// client makes gRPC calls over unencrypted HTTP/2.
+type client struct {
+	http      *http.Client
+	transport *http2.Transport
+	base      string
+}
+
+func newClient(address string) *client {
+	network, addr, host := "tcp", address, address
+	if path := strings.TrimPrefix(address, "unix:"); path != address {
+		network, addr, host = "unix", strings.TrimPrefix(path, "//"), "localhost"
+	}
+	t := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, _, _ string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	return &client{&http.Client{Transport: t}, t, "http://" + host}
+}
+
+func (c *client) close() {
+	c.transport.CloseIdleConnections()
+}
+
+// call starts a gRPC call, returning the response once headers have been
+// received.
+func (c *client) call(ctx context.Context, method string, req wire.Marshaler) (*http.Response, error) {
+	var body bytes.Buffer
+	if err := wire.WriteMessage(&body, req); err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, "POST", c.base+method, &body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", wire.ContentType)
+	r.Header.Set("TE", "trailers")
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: HTTP %s", method, resp.Status)
+	}
+	if err := wire.Status(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// connect starts streaming output. If the module is served by a command,
+// connecting is retried until the command is listening, or exits.
+func (c *client) connect(ctx context.Context, exited <-chan error) (*http.Response, error) {
+	resp, err := c.call(ctx, wire.StreamOutput, wire.Empty{})
+	if exited == nil {
+		return resp, err
+	}
+	deadline := time.Now().Add(connectTimeout)
+	for err != nil && time.Now().Before(deadline) {
+		select {
+		case err := <-exited:
+			return nil, exitError(err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		resp, err = c.call(ctx, wire.StreamOutput, wire.Empty{})
+	}
+	return resp, err
+}
+
+func (c *client) click(click wire.Click) {
+	ctx, cancel := context.WithTimeout(context.Background(), clickTimeout)
+	defer cancel()
+	resp, err := c.call(ctx, wire.SendClick, click)
+	if err == nil {
+		defer resp.Body.Close()
+		var r wire.Empty
+		if err = wire.ReadMessage(resp.Body, &r); err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			err = wire.Status(resp)
+		}
+	}
+	if err != nil {
+		l.Log("Failed to send click: %v", err)
+	}
+}
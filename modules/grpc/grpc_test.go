@@ -0,0 +1,140 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/modules/grpc/server"
+	"barista.run/modules/static"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	testModule "barista.run/testing/module"
+
+	"github.com/stretchr/testify/require"
+)
+
+const helperEnv = "BARISTA_GRPC_TEST_HELPER"
+
+func init() {
+	connectTimeout = 5 * time.Second
+}
+
+// TestHelperProcess is run as a separate process by the Command tests, and
+// serves a module that exits the process when right clicked.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv(helperEnv) == "" {
+		return
+	}
+	m := static.New(nil)
+	var out func(string) bar.Output
+	out = func(text string) bar.Output {
+		return outputs.Text(text).OnClick(func(e bar.Event) {
+			if e.Button == bar.ButtonRight {
+				os.Exit(3)
+			}
+			m.Set(out("clicked"))
+		})
+	}
+	m.Set(out("helper"))
+	if err := server.ServeFromEnv(m); err != nil {
+		os.Exit(2)
+	}
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	original := testModule.New(t)
+	path := filepath.Join(t.TempDir(), "module.sock")
+	l, err := server.Listen("unix:" + path)
+	require.NoError(t, err)
+	go server.Serve(l, original)
+	original.AssertStarted()
+
+	testBar.Run(New("unix:" + path))
+	testBar.AssertNoOutput("until module outputs")
+
+	red := colors.Hex("#ff0000")
+	original.Output(outputs.Group(
+		outputs.Text("a").Color(red),
+		outputs.Text("b").Urgent(true),
+	))
+	out := testBar.NextOutput("on output")
+	out.AssertText([]string{"a", "b"})
+	c, _ := out.At(0).Segment().GetColor()
+	require.Equal(t, red, c)
+
+	out.At(1).Click(bar.Event{Button: bar.ScrollDown, X: 2})
+	require.Equal(t, bar.Event{Button: bar.ScrollDown, X: 2},
+		original.AssertClicked("click forwarded"))
+
+	original.OutputText("c")
+	testBar.NextOutput("on output").AssertText([]string{"c"})
+
+	l.Close()
+	original.OutputText("d")
+	testBar.NextOutput("on output").AssertText([]string{"d"},
+		"existing stream continues after listener closes")
+}
+
+func TestConnectionError(t *testing.T) {
+	testBar.New(t)
+	testBar.Run(New("unix:" + filepath.Join(t.TempDir(), "missing.sock")))
+	testBar.NextOutput("on start").AssertError("connection fails")
+}
+
+func TestCommand(t *testing.T) {
+	testBar.New(t)
+	t.Setenv(helperEnv, "1")
+	testBar.Run(Command(os.Args[0], "-test.run=^TestHelperProcess$"))
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"helper"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on click")
+	out.AssertText([]string{"clicked"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	out = testBar.Drain(50*time.Millisecond, "on crash")
+	errs := out.AssertError()
+	require.Contains(t, errs[0], "exit status 3")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonMiddle})
+	for {
+		// The previous output is shown without errors until the new
+		// process starts.
+		out = testBar.NextOutput("on restart")
+		if out.Len() > 0 && out.At(0).Segment().GetError() == nil {
+			break
+		}
+	}
+	out.AssertText([]string{"helper"}, "command restarted")
+}
+
+func TestCommandExits(t *testing.T) {
+	testBar.New(t)
+	testBar.Run(Command("false"))
+	errs := testBar.NextOutput("on start").AssertError()
+	require.Contains(t, errs[0], "module exited")
+
+	testBar.New(t)
+	testBar.Run(Command("/nonexistent/module"))
+	testBar.NextOutput("on start").AssertError()
+}
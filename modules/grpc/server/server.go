@@ -0,0 +1,192 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server serves a bar module over the barista.Module gRPC service,
+// so that it can run in a separate process from the bar. The bar shows the
+// module using modules/grpc:
+//
+//	// In the module process, e.g. started by grpc.Command("my-module").
+//	func main() {
+//		if err := server.ServeFromEnv(weather.New(...)); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+package server // import "barista.run/modules/grpc/server"
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/core"
+	"barista.run/modules/grpc/wire"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Handler is an http.Handler for the barista.Module service. It must be
+// served over HTTP/2, e.g. using h2c for unencrypted connections.
+type Handler struct {
+	output value.Value // of bar.Segments
+}
+
+// NewHandler constructs a handler for the given module, and starts streaming
+// it. The module is restarted on click if it finishes, as it would be on the
+// bar.
+func NewHandler(module bar.Module) *Handler {
+	h := &Handler{}
+	go core.NewModule(module).Stream(func(o bar.Output) {
+		var segments bar.Segments
+		if o != nil {
+			segments = o.Segments()
+		}
+		h.output.Set(segments)
+	})
+	return h
+}
+
+// ServeHTTP handles a gRPC call.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || !strings.HasPrefix(r.Header.Get("Content-Type"), wire.ContentType) {
+		http.Error(w, "expected a gRPC request", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", wire.ContentType)
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	var code int
+	var err error
+	switch r.URL.Path {
+	case wire.StreamOutput:
+		code, err = h.streamOutput(w, r)
+	case wire.SendClick:
+		code, err = h.sendClick(w, r)
+	default:
+		code, err = wire.StatusUnimplemented, fmt.Errorf("unknown method %s", r.URL.Path)
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if err != nil {
+		w.Header().Set("Grpc-Message", err.Error())
+	}
+}
+
+func (h *Handler) streamOutput(w http.ResponseWriter, r *http.Request) (int, error) {
+	var req wire.Empty
+	if err := wire.ReadMessage(r.Body, &req); err != nil {
+		return wire.StatusInvalidArgument, err
+	}
+	sub, done := h.output.Subscribe()
+	defer done()
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for {
+		// Nothing is sent until the module produces its first output.
+		if out, ok := h.output.Get().(bar.Segments); ok {
+			if err := wire.WriteMessage(w, wire.FromSegments(out)); err != nil {
+				return wire.StatusUnavailable, err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		select {
+		case <-sub:
+		case <-r.Context().Done():
+			return wire.StatusOK, nil
+		}
+	}
+}
+
+func (h *Handler) sendClick(w http.ResponseWriter, r *http.Request) (int, error) {
+	var click wire.Click
+	if err := wire.ReadMessage(r.Body, &click); err != nil {
+		return wire.StatusInvalidArgument, err
+	}
+	out, _ := h.output.Get().(bar.Segments)
+	if click.Segment < 0 || int(click.Segment) >= len(out) {
+		return wire.StatusNotFound, fmt.Errorf("no segment %d", click.Segment)
+	}
+	out[click.Segment].Click(click.Event())
+	if err := wire.WriteMessage(w, wire.Empty{}); err != nil {
+		return wire.StatusUnavailable, err
+	}
+	return wire.StatusOK, nil
+}
+
+// Listen listens on the given address, either "unix:<path>" for a unix socket,
+// or "host:port" for TCP. Any existing unix socket at the path is removed.
+func Listen(address string) (net.Listener, error) {
+	if path := strings.TrimPrefix(address, "unix:"); path != address {
+		path = strings.TrimPrefix(path, "//")
+		os.Remove(path)
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", address)
+}
+
+// Serve serves the module over unencrypted HTTP/2 on the given listener. It
+// only returns on error.
+func Serve(l net.Listener, module bar.Module) error {
+	srv := &http.Server{Handler: h2c.NewHandler(NewHandler(module), &http2.Server{})}
+	return srv.Serve(l)
+}
+
+// ListenAndServe serves the module on the given address. See Listen for the
+// supported addresses.
+func ListenAndServe(address string, module bar.Module) error {
+	l, err := Listen(address)
+	if err != nil {
+		return err
+	}
+	return Serve(l, module)
+}
+
+// parentPollInterval is how often ServeFromEnv checks whether the bar exited.
+const parentPollInterval = time.Second
+
+// ServeFromEnv serves the module on the address given by the bar in the
+// BARISTA_GRPC_ADDRESS environment variable. Since the module process is
+// started by the bar, ServeFromEnv returns once the bar exits.
+func ServeFromEnv(module bar.Module) error {
+	address := os.Getenv(wire.AddressEnv)
+	if address == "" {
+		return errors.New(wire.AddressEnv + " is not set")
+	}
+	l, err := Listen(address)
+	if err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	go func(parent int) {
+		for os.Getppid() == parent {
+			time.Sleep(parentPollInterval)
+		}
+		close(exited)
+		l.Close()
+	}(os.Getppid())
+	err = Serve(l, module)
+	select {
+	case <-exited:
+		return errors.New("bar exited")
+	default:
+		return err
+	}
+}
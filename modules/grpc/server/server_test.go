@@ -0,0 +1,110 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/modules/grpc/wire"
+	testModule "barista.run/testing/module"
+
+	"github.com/stretchr/testify/require"
+)
+
+func call(h http.Handler, method string, body []byte) *http.Response {
+	req := httptest.NewRequest("POST", method, bytes.NewReader(body))
+	req.Header.Set("Content-Type", wire.ContentType)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func frame(m wire.Marshaler) []byte {
+	var buf bytes.Buffer
+	wire.WriteMessage(&buf, m)
+	return buf.Bytes()
+}
+
+func TestHandler(t *testing.T) {
+	original := testModule.New(t)
+	h := NewHandler(original)
+	original.AssertStarted()
+
+	resp := call(h, wire.SendClick, frame(wire.Click{}))
+	require.Equal(t, wire.StatusError{Code: wire.StatusNotFound, Message: "no segment 0"},
+		wire.Status(resp), "before first output")
+
+	original.OutputText("hello")
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, ok := h.output.Get().(bar.Segments); ok {
+			break
+		}
+		require.True(t, time.Since(start) < time.Second, "output received")
+	}
+
+	resp = call(h, wire.SendClick, frame(wire.Click{Button: int32(bar.ScrollUp), X: 5}))
+	require.NoError(t, wire.Status(resp))
+	require.Equal(t, wire.ContentType, resp.Header.Get("Content-Type"))
+	var empty wire.Empty
+	require.NoError(t, wire.ReadMessage(resp.Body, &empty))
+	require.Equal(t, bar.Event{Button: bar.ScrollUp, X: 5},
+		original.AssertClicked("click forwarded"))
+
+	resp = call(h, wire.SendClick, frame(wire.Click{Segment: 1}))
+	require.Equal(t, wire.StatusError{Code: wire.StatusNotFound, Message: "no segment 1"}, wire.Status(resp))
+	original.AssertNotClicked("invalid segment")
+
+	resp = call(h, wire.SendClick, []byte{0, 0, 0})
+	require.Equal(t, wire.StatusInvalidArgument, wire.Status(resp).(wire.StatusError).Code)
+
+	resp = call(h, "/barista.Module/Other", frame(wire.Empty{}))
+	require.Equal(t, wire.StatusUnimplemented, wire.Status(resp).(wire.StatusError).Code)
+
+	req := httptest.NewRequest("GET", wire.StreamOutput, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
+
+func TestListen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "module.sock")
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	l, err := Listen("unix:" + path)
+	require.NoError(t, err, "replaces stale socket")
+	require.Equal(t, "unix", l.Addr().Network())
+	l.Close()
+
+	l, err = Listen("unix://" + path)
+	require.NoError(t, err)
+	require.Equal(t, path, l.Addr().String())
+	l.Close()
+
+	l, err = Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	require.Equal(t, "tcp", l.Addr().Network())
+	l.Close()
+
+	t.Setenv(wire.AddressEnv, "")
+	require.Error(t, ServeFromEnv(testModule.New(t)))
+	t.Setenv(wire.AddressEnv, "unix:"+filepath.Join(t.TempDir(), "missing", "module.sock"))
+	require.Error(t, ServeFromEnv(testModule.New(t)))
+}
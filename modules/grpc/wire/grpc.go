@@ -0,0 +1,231 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"net/http"
+	"strconv"
+
+	"barista.run/bar"
+	"barista.run/colors"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Method paths of the barista.Module service.
+const (
+	StreamOutput = "/barista.Module/StreamOutput"
+	SendClick    = "/barista.Module/SendClick"
+)
+
+// AddressEnv is the environment variable that holds the address that a module
+// process started by the bar should listen on.
+const AddressEnv = "BARISTA_GRPC_ADDRESS"
+
+// ContentType is the content type of gRPC requests and responses.
+const ContentType = "application/grpc"
+
+// Status codes used by the service, from the gRPC specification.
+const (
+	StatusOK              = 0
+	StatusInvalidArgument = 3
+	StatusNotFound        = 5
+	StatusUnimplemented   = 12
+	StatusInternal        = 13
+	StatusUnavailable     = 14
+)
+
+// maxMessageSize limits the size of received messages, matching the gRPC
+// default.
+const maxMessageSize = 4 << 20
+
+// WriteMessage writes a length-prefixed message.
+func WriteMessage(w io.Writer, m Marshaler) error {
+	data := m.Marshal()
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	_, err := w.Write(append(frame, data...))
+	return err
+}
+
+// ReadMessage reads a length-prefixed message. It returns io.EOF if there are
+// no more messages.
+func ReadMessage(r io.Reader, m Unmarshaler) error {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return errTruncated
+		}
+		return err
+	}
+	if header[0] != 0 {
+		return errors.New("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessageSize {
+		return fmt.Errorf("message too large: %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return errTruncated
+	}
+	return m.Unmarshal(data)
+}
+
+// StatusError is an error returned by a gRPC call.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", e.Code, e.Message)
+}
+
+// Status returns the error from the grpc-status and grpc-message values of a
+// response's trailers, or headers for a response without a body. It returns
+// nil if the call succeeded, or if the status is not yet available.
+func Status(resp *http.Response) error {
+	h := resp.Trailer
+	if h.Get("Grpc-Status") == "" {
+		h = resp.Header
+	}
+	status := h.Get("Grpc-Status")
+	if status == "" {
+		return nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("invalid grpc status %q", status)
+	}
+	if code == StatusOK {
+		return nil
+	}
+	return StatusError{code, h.Get("Grpc-Message")}
+}
+
+func hex(c color.Color, ok bool) string {
+	if !ok || c == nil {
+		return ""
+	}
+	if cf, ok := colorful.MakeColor(c); ok {
+		return cf.Hex()
+	}
+	return ""
+}
+
+// FromSegments converts bar segments into an Output message.
+func FromSegments(segments bar.Segments) Output {
+	var o Output
+	for _, s := range segments {
+		ws := Segment{Clickable: s.HasClick()}
+		ws.Text, ws.Pango = s.Content()
+		ws.ShortText, _ = s.GetShortText()
+		ws.Tooltip, _ = s.GetTooltip()
+		if err := s.GetError(); err != nil {
+			ws.Error = err.Error()
+		}
+		ws.Color = hex(s.GetColor())
+		ws.Background = hex(s.GetBackground())
+		ws.Border = hex(s.GetBorder())
+		ws.Urgent, _ = s.IsUrgent()
+		align, _ := s.GetAlignment()
+		ws.Align = string(align)
+		switch w, _ := s.GetMinWidth(); w := w.(type) {
+		case int:
+			ws.MinWidth = int32(w)
+		case string:
+			ws.MinWidthPlaceholder = w
+		}
+		o.Segments = append(o.Segments, ws)
+	}
+	return o
+}
+
+// ToSegments converts an Output message into bar segments. Clicks on clickable
+// segments are passed to onClick.
+func (o Output) ToSegments(onClick func(Click)) bar.Segments {
+	var out bar.Segments
+	for idx, ws := range o.Segments {
+		s := bar.TextSegment(ws.Text)
+		if ws.Pango {
+			s = bar.PangoSegment(ws.Text)
+		}
+		if ws.ShortText != "" {
+			s.ShortText(ws.ShortText)
+		}
+		if ws.Tooltip != "" {
+			s.Tooltip(ws.Tooltip)
+		}
+		if ws.Error != "" {
+			s.Error(errors.New(ws.Error))
+		}
+		if c := colors.Hex(ws.Color); c != nil {
+			s.Color(c)
+		}
+		if c := colors.Hex(ws.Background); c != nil {
+			s.Background(c)
+		}
+		if c := colors.Hex(ws.Border); c != nil {
+			s.Border(c)
+		}
+		if ws.Urgent {
+			s.Urgent(true)
+		}
+		if ws.Align != "" {
+			s.Align(bar.TextAlignment(ws.Align))
+		}
+		if ws.MinWidth != 0 {
+			s.MinWidth(int(ws.MinWidth))
+		} else if ws.MinWidthPlaceholder != "" {
+			s.MinWidthPlaceholder(ws.MinWidthPlaceholder)
+		}
+		if ws.Clickable && onClick != nil {
+			idx := int32(idx)
+			s.OnClick(func(e bar.Event) { onClick(FromEvent(idx, e)) })
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// FromEvent converts a click event on the segment at the given index into a
+// Click message.
+func FromEvent(segment int32, e bar.Event) Click {
+	return Click{
+		Segment: segment,
+		Button:  int32(e.Button),
+		X:       int32(e.X),
+		Y:       int32(e.Y),
+		Width:   int32(e.Width),
+		Height:  int32(e.Height),
+	}
+}
+
+// Event converts a Click message into a bar event.
+func (c Click) Event() bar.Event {
+	return bar.Event{
+		Button: bar.Button(c.Button),
+		X:      int(c.X),
+		Y:      int(c.Y),
+		Width:  int(c.Width),
+		Height: int(c.Height),
+	}
+}
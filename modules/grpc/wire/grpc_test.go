@@ -0,0 +1,109 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFraming(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteMessage(&buf, Click{Button: 1}))
+	require.NoError(t, WriteMessage(&buf, Empty{}))
+	require.Equal(t, []byte{0, 0, 0, 0, 2, 0x10, 0x01, 0, 0, 0, 0, 0}, buf.Bytes())
+
+	var c Click
+	require.NoError(t, ReadMessage(&buf, &c))
+	require.Equal(t, Click{Button: 1}, c)
+	var e Empty
+	require.NoError(t, ReadMessage(&buf, &e))
+	require.Equal(t, io.EOF, ReadMessage(&buf, &e))
+
+	for _, data := range [][]byte{
+		{0, 0, 0},
+		{0, 0, 0, 0, 2, 0x10},
+		{1, 0, 0, 0, 0},
+		{0, 0xff, 0, 0, 0},
+	} {
+		require.Error(t, ReadMessage(bytes.NewReader(data), &e), "%x", data)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}, Trailer: http.Header{}}
+	require.NoError(t, Status(resp), "no status yet")
+
+	resp.Trailer.Set("Grpc-Status", "0")
+	require.NoError(t, Status(resp))
+
+	resp.Trailer.Set("Grpc-Status", "5")
+	resp.Trailer.Set("Grpc-Message", "not found")
+	require.Equal(t, StatusError{5, "not found"}, Status(resp))
+	require.Equal(t, "grpc status 5: not found", Status(resp).Error())
+
+	resp.Trailer = http.Header{}
+	resp.Header.Set("Grpc-Status", "12")
+	require.Equal(t, StatusError{Code: 12}, Status(resp), "trailers-only response")
+
+	resp.Header.Set("Grpc-Status", "bad")
+	require.Error(t, Status(resp))
+}
+
+func TestSegments(t *testing.T) {
+	red := colors.Hex("#ff0000")
+	in := bar.Segments{
+		outputs.Text("plain"),
+		bar.PangoSegment("<b>pango</b>").ShortText("p").Tooltip("tip").
+			Color(red).Background(red).Border(red).Urgent(true),
+		outputs.Text("aligned").Align(bar.AlignEnd).MinWidth(50),
+		outputs.Text("placeholder").MinWidthPlaceholder("00:00"),
+		outputs.Text("click").OnClick(func(bar.Event) {}),
+		outputs.Error(errors.New("oops")),
+	}
+	o := FromSegments(in)
+	require.Equal(t, []Segment{
+		{Text: "plain"},
+		{Text: "<b>pango</b>", Pango: true, ShortText: "p", Tooltip: "tip",
+			Color: "#ff0000", Background: "#ff0000", Border: "#ff0000", Urgent: true},
+		{Text: "aligned", Align: "right", MinWidth: 50},
+		{Text: "placeholder", MinWidthPlaceholder: "00:00"},
+		{Text: "click", Clickable: true},
+	}, o.Segments[:5], "converted segments")
+	require.Equal(t, "oops", o.Segments[5].Error)
+
+	var clicks []Click
+	out := o.ToSegments(func(c Click) { clicks = append(clicks, c) })
+	require.Len(t, out, 6)
+	require.Equal(t, o, FromSegments(out), "round trip")
+
+	require.False(t, out[0].HasClick())
+	out[4].Click(bar.Event{Button: bar.ButtonLeft, X: 3, Y: 4, Width: 50, Height: 20})
+	require.Equal(t, []Click{{Segment: 4, Button: 1, X: 3, Y: 4, Width: 50, Height: 20}}, clicks)
+	require.Equal(t, bar.Event{Button: bar.ButtonLeft, X: 3, Y: 4, Width: 50, Height: 20},
+		clicks[0].Event())
+
+	require.Error(t, out[5].GetError())
+	require.Empty(t, Output{}.ToSegments(nil))
+}
@@ -0,0 +1,292 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wire implements the messages and framing of the barista.Module gRPC
+// service defined in barista.proto. The messages are encoded by hand, so that
+// the bar does not need the protobuf and gRPC libraries.
+package wire // import "barista.run/modules/grpc/wire"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Marshaler is a protobuf message that can be encoded.
+type Marshaler interface {
+	Marshal() []byte
+}
+
+// Unmarshaler is a protobuf message that can be decoded.
+type Unmarshaler interface {
+	Unmarshal(data []byte) error
+}
+
+// Protobuf wire types.
+const (
+	typeVarint  = 0
+	typeFixed64 = 1
+	typeBytes   = 2
+	typeFixed32 = 5
+)
+
+type encoder []byte
+
+func (e *encoder) varint(v uint64) {
+	*e = binary.AppendUvarint(*e, v)
+}
+
+func (e *encoder) tag(field, wireType int) {
+	e.varint(uint64(field<<3 | wireType))
+}
+
+func (e *encoder) bytes(field int, b []byte) {
+	e.tag(field, typeBytes)
+	e.varint(uint64(len(b)))
+	*e = append(*e, b...)
+}
+
+func (e *encoder) string(field int, s string) {
+	if s != "" {
+		e.bytes(field, []byte(s))
+	}
+}
+
+func (e *encoder) bool(field int, b bool) {
+	if b {
+		e.tag(field, typeVarint)
+		e.varint(1)
+	}
+}
+
+func (e *encoder) int32(field int, v int32) {
+	if v != 0 {
+		e.tag(field, typeVarint)
+		// Negative values are sign-extended to 64 bits.
+		e.varint(uint64(int64(v)))
+	}
+}
+
+var errTruncated = errors.New("truncated message")
+
+// field is a single decoded field. Val is set for varint fields, and data for
+// length-delimited fields.
+type field struct {
+	num  int
+	val  uint64
+	data []byte
+}
+
+func (f field) int32() int32 { return int32(f.val) }
+func (f field) bool() bool   { return f.val != 0 }
+func (f field) str() string  { return string(f.data) }
+
+// decode calls fn for each field in a message. Fixed-width fields are
+// skipped, since no message uses them.
+func decode(data []byte, fn func(field) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		f := field{num: int(tag >> 3)}
+		switch wireType := tag & 7; wireType {
+		case typeVarint:
+			if f.val, n = binary.Uvarint(data); n <= 0 {
+				return errTruncated
+			}
+			data = data[n:]
+		case typeBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errTruncated
+			}
+			f.data = data[n : n+int(size)]
+			data = data[n+int(size):]
+		case typeFixed64, typeFixed32:
+			size := 8
+			if wireType == typeFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errTruncated
+			}
+			data = data[size:]
+			continue
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Empty is a message without any fields, used for StreamOutputRequest and
+// SendClickResponse.
+type Empty struct{}
+
+// Marshal encodes the message.
+func (Empty) Marshal() []byte { return nil }
+
+// Unmarshal decodes the message, ignoring any fields.
+func (*Empty) Unmarshal(data []byte) error {
+	return decode(data, func(field) error { return nil })
+}
+
+// Segment is a single segment of output.
+type Segment struct {
+	Text                string
+	Pango               bool
+	ShortText           string
+	Tooltip             string
+	Error               string
+	Color               string
+	Background          string
+	Border              string
+	Urgent              bool
+	Clickable           bool
+	Align               string
+	MinWidth            int32
+	MinWidthPlaceholder string
+}
+
+// Marshal encodes the message.
+func (s Segment) Marshal() []byte {
+	var e encoder
+	e.string(1, s.Text)
+	e.bool(2, s.Pango)
+	e.string(3, s.ShortText)
+	e.string(4, s.Tooltip)
+	e.string(5, s.Error)
+	e.string(6, s.Color)
+	e.string(7, s.Background)
+	e.string(8, s.Border)
+	e.bool(9, s.Urgent)
+	e.bool(10, s.Clickable)
+	e.string(11, s.Align)
+	e.int32(12, s.MinWidth)
+	e.string(13, s.MinWidthPlaceholder)
+	return e
+}
+
+// Unmarshal decodes the message.
+func (s *Segment) Unmarshal(data []byte) error {
+	*s = Segment{}
+	return decode(data, func(f field) error {
+		switch f.num {
+		case 1:
+			s.Text = f.str()
+		case 2:
+			s.Pango = f.bool()
+		case 3:
+			s.ShortText = f.str()
+		case 4:
+			s.Tooltip = f.str()
+		case 5:
+			s.Error = f.str()
+		case 6:
+			s.Color = f.str()
+		case 7:
+			s.Background = f.str()
+		case 8:
+			s.Border = f.str()
+		case 9:
+			s.Urgent = f.bool()
+		case 10:
+			s.Clickable = f.bool()
+		case 11:
+			s.Align = f.str()
+		case 12:
+			s.MinWidth = f.int32()
+		case 13:
+			s.MinWidthPlaceholder = f.str()
+		}
+		return nil
+	})
+}
+
+// Output is the complete output of a module.
+type Output struct {
+	Segments []Segment
+}
+
+// Marshal encodes the message.
+func (o Output) Marshal() []byte {
+	var e encoder
+	for _, s := range o.Segments {
+		e.bytes(1, s.Marshal())
+	}
+	return e
+}
+
+// Unmarshal decodes the message.
+func (o *Output) Unmarshal(data []byte) error {
+	*o = Output{}
+	return decode(data, func(f field) error {
+		if f.num != 1 {
+			return nil
+		}
+		var s Segment
+		if err := s.Unmarshal(f.data); err != nil {
+			return err
+		}
+		o.Segments = append(o.Segments, s)
+		return nil
+	})
+}
+
+// Click is a click event on a segment of the latest output.
+type Click struct {
+	Segment       int32
+	Button        int32
+	X, Y          int32
+	Width, Height int32
+}
+
+// Marshal encodes the message.
+func (c Click) Marshal() []byte {
+	var e encoder
+	e.int32(1, c.Segment)
+	e.int32(2, c.Button)
+	e.int32(3, c.X)
+	e.int32(4, c.Y)
+	e.int32(5, c.Width)
+	e.int32(6, c.Height)
+	return e
+}
+
+// Unmarshal decodes the message.
+func (c *Click) Unmarshal(data []byte) error {
+	*c = Click{}
+	return decode(data, func(f field) error {
+		switch f.num {
+		case 1:
+			c.Segment = f.int32()
+		case 2:
+			c.Button = f.int32()
+		case 3:
+			c.X = f.int32()
+		case 4:
+			c.Y = f.int32()
+		case 5:
+			c.Width = f.int32()
+		case 6:
+			c.Height = f.int32()
+		}
+		return nil
+	})
+}
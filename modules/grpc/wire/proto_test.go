@@ -0,0 +1,107 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegment(t *testing.T) {
+	s := Segment{
+		Text:                "text",
+		Pango:               true,
+		ShortText:           "short",
+		Tooltip:             "tooltip",
+		Error:               "error",
+		Color:               "#ff0000",
+		Background:          "#00ff00",
+		Border:              "#0000ff",
+		Urgent:              true,
+		Clickable:           true,
+		Align:               "center",
+		MinWidth:            -20,
+		MinWidthPlaceholder: "placeholder",
+	}
+	var decoded Segment
+	require.NoError(t, decoded.Unmarshal(s.Marshal()))
+	require.Equal(t, s, decoded)
+
+	require.Empty(t, Segment{}.Marshal(), "default values are omitted")
+	require.NoError(t, decoded.Unmarshal(nil))
+	require.Equal(t, Segment{}, decoded, "fields are reset")
+}
+
+func TestEncoding(t *testing.T) {
+	// Reference encodings from protoc.
+	require.Equal(t, []byte{0x0a, 0x02, 'h', 'i', 0x10, 0x01},
+		Segment{Text: "hi", Pango: true}.Marshal())
+	require.Equal(t, []byte{0x08, 0x02, 0x10, 0x01, 0x18,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01},
+		Click{Segment: 2, Button: 1, X: -1}.Marshal())
+}
+
+func TestOutput(t *testing.T) {
+	o := Output{Segments: []Segment{{Text: "a"}, {}, {Text: "c", Urgent: true}}}
+	var decoded Output
+	require.NoError(t, decoded.Unmarshal(o.Marshal()))
+	require.Equal(t, o, decoded)
+
+	require.NoError(t, decoded.Unmarshal(nil))
+	require.Empty(t, decoded.Segments)
+}
+
+func TestClick(t *testing.T) {
+	c := Click{Segment: 1, Button: 4, X: 10, Y: -5, Width: 100, Height: 20}
+	var decoded Click
+	require.NoError(t, decoded.Unmarshal(c.Marshal()))
+	require.Equal(t, c, decoded)
+}
+
+func TestUnknownFields(t *testing.T) {
+	var e encoder
+	e.string(1, "text")
+	e.tag(20, typeFixed64)
+	e = append(e, 1, 2, 3, 4, 5, 6, 7, 8)
+	e.tag(21, typeFixed32)
+	e = append(e, 1, 2, 3, 4)
+	e.string(22, "unknown")
+	e.int32(23, 42)
+	e.bool(9, true)
+
+	var s Segment
+	require.NoError(t, s.Unmarshal(e))
+	require.Equal(t, Segment{Text: "text", Urgent: true}, s)
+
+	var empty Empty
+	require.NoError(t, empty.Unmarshal(e))
+}
+
+func TestInvalid(t *testing.T) {
+	var s Segment
+	for _, data := range [][]byte{
+		{0x0a},             // Missing length.
+		{0x0a, 0x05, 'a'},  // Truncated string.
+		{0x10},             // Missing varint.
+		{0x10, 0x80},       // Truncated varint.
+		{0x09, 0x01, 0x02}, // Truncated fixed64.
+		{0x0b},             // Unsupported group.
+	} {
+		require.Error(t, s.Unmarshal(data), "%x", data)
+	}
+	var o Output
+	require.Error(t, o.Unmarshal([]byte{0x0a, 0x01, 0x0a}), "invalid segment")
+}
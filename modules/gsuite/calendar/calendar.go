@@ -17,10 +17,14 @@ package calendar // import "barista.run/modules/gsuite/calendar"
 
 import (
 	"net/http"
+	"os/exec"
+	"regexp"
 	"time"
 
 	"barista.run/bar"
+	"barista.run/base/click"
 	"barista.run/base/value"
+	"barista.run/core"
 	"barista.run/oauth"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -51,6 +55,9 @@ type Event struct {
 	Response    Status
 	Location    string
 	Summary     string
+	// ConferenceURL is the URL used to join the event's video conference
+	// (e.g. Google Meet or Zoom), if any.
+	ConferenceURL string
 }
 
 // UntilStart returns the time remaining until the event starts.
@@ -69,6 +76,21 @@ func (e Event) UntilAlert() time.Duration {
 	return e.Alert.Sub(timing.Now())
 }
 
+// Overridden in tests.
+var openURL = func(url string) {
+	exec.Command("xdg-open", url).Run()
+}
+
+// Join returns a click handler that opens the event's video conference, or nil
+// if the event does not have one.
+func (e Event) Join() func(bar.Event) {
+	if e.ConferenceURL == "" {
+		return nil
+	}
+	url := e.ConferenceURL
+	return click.Left(func() { openURL(url) })
+}
+
 // EventList represents the list of events split by the temporal state of each
 // event: in progress, alerting (upcoming but within notification duration), or
 // upcoming beyond the notification duration.
@@ -81,6 +103,41 @@ type EventList struct {
 	Upcoming []Event
 }
 
+// Next returns the next event that has not yet started, if any.
+func (l EventList) Next() (Event, bool) {
+	for _, evts := range [][]Event{l.Alerting, l.Upcoming} {
+		if len(evts) > 0 {
+			return evts[0], true
+		}
+	}
+	return Event{}, false
+}
+
+// Meeting returns the event whose video conference should be joined now: an
+// event in progress with a conference URL, or failing that, the first alerting
+// event with a conference URL.
+func (l EventList) Meeting() (Event, bool) {
+	for _, evts := range [][]Event{l.InProgress, l.Alerting} {
+		for _, e := range evts {
+			if e.ConferenceURL != "" {
+				return e, true
+			}
+		}
+	}
+	return Event{}, false
+}
+
+// JoinClick returns a click handler that opens the video conference of the
+// current meeting (see Meeting), or nil if there is no meeting to join. Since
+// meetings only become joinable once alerting, this can be used as the click
+// handler for a countdown to the next event.
+func (l EventList) JoinClick() func(bar.Event) {
+	if e, ok := l.Meeting(); ok {
+		return e.Join()
+	}
+	return nil
+}
+
 type config struct {
 	calendarID   string
 	lookahead    time.Duration
@@ -92,7 +149,7 @@ type Module struct {
 	oauthConfig *oauth.Config
 	config      value.Value // of config
 	scheduler   *timing.Scheduler
-	outputFunc  value.Value // of func(EventList) bar.Output
+	outputFunc  core.OutputFunc // of func(EventList) bar.Output
 }
 
 // New creates a calendar module from the given oauth config.
@@ -129,7 +186,7 @@ func New(clientConfig []byte) *Module {
 				break
 			}
 		}
-		return out
+		return out.OnClick(evts.JoinClick())
 	})
 	return m
 }
@@ -185,7 +242,8 @@ func fetch(srv *calendar.Service, conf config) ([]Event, error) {
 	req.SingleEvents(true)
 	req.TimeMin(timeMin.Format(time.RFC3339))
 	req.TimeMax(timeMax.Format(time.RFC3339))
-	req.Fields("items(end,location,start,status,summary,attendees,reminders),defaultReminders")
+	req.Fields("items(end,location,start,status,summary,attendees,reminders," +
+		"description,hangoutLink,conferenceData/entryPoints),defaultReminders")
 	res, err := req.Do()
 	if err != nil {
 		return nil, err
@@ -226,18 +284,43 @@ func fetch(srv *calendar.Service, conf config) ([]Event, error) {
 			continue
 		}
 		events = append(events, Event{
-			Start:       start,
-			End:         end,
-			Alert:       start.Add(-alert),
-			EventStatus: eventStatus,
-			Response:    selfStatus,
-			Location:    e.Location,
-			Summary:     e.Summary,
+			Start:         start,
+			End:           end,
+			Alert:         start.Add(-alert),
+			EventStatus:   eventStatus,
+			Response:      selfStatus,
+			Location:      e.Location,
+			Summary:       e.Summary,
+			ConferenceURL: conferenceURL(e),
 		})
 	}
 	return events, nil
 }
 
+// conferenceURLRe matches links to common video conferencing services, for
+// events that only include the link in the location or description.
+var conferenceURLRe = regexp.MustCompile(
+	`https://(meet\.google\.com|([a-z0-9-]+\.)?zoom\.us|teams\.microsoft\.com|([a-z0-9-]+\.)?webex\.com)/[^\s"'<>]*`)
+
+func conferenceURL(e *calendar.Event) string {
+	if e.ConferenceData != nil {
+		for _, ep := range e.ConferenceData.EntryPoints {
+			if ep.EntryPointType == "video" && ep.Uri != "" {
+				return ep.Uri
+			}
+		}
+	}
+	if e.HangoutLink != "" {
+		return e.HangoutLink
+	}
+	for _, text := range []string{e.Location, e.Description} {
+		if url := conferenceURLRe.FindString(text); url != "" {
+			return url
+		}
+	}
+	return ""
+}
+
 func getEarliestPopupReminder(rs []*calendar.EventReminder) time.Duration {
 	duration := time.Duration(0)
 	for _, r := range rs {
@@ -54,13 +54,25 @@ type reminders struct {
 
 // test events mapped more to the calendar api.
 type event struct {
-	Start       datetime   `json:"start"`
-	End         datetime   `json:"end"`
-	EventStatus string     `json:"status"`
-	Attendees   []attendee `json:"attendees"`
-	Location    string     `json:"location"`
-	Summary     string     `json:"summary"`
-	Reminders   reminders  `json:"reminders"`
+	Start       datetime    `json:"start"`
+	End         datetime    `json:"end"`
+	EventStatus string      `json:"status"`
+	Attendees   []attendee  `json:"attendees"`
+	Location    string      `json:"location"`
+	Summary     string      `json:"summary"`
+	Reminders   reminders   `json:"reminders"`
+	Description string      `json:"description,omitempty"`
+	HangoutLink string      `json:"hangoutLink,omitempty"`
+	Conference  *conference `json:"conferenceData,omitempty"`
+}
+
+type entryPoint struct {
+	Type string `json:"entryPointType"`
+	URI  string `json:"uri"`
+}
+
+type conference struct {
+	EntryPoints []entryPoint `json:"entryPoints"`
 }
 
 var (
@@ -230,6 +242,109 @@ func TestCalendar(t *testing.T) {
 	testBar.NextOutput().AssertEmpty("all events in the past")
 }
 
+func TestMeetings(t *testing.T) {
+	require := require.New(t)
+	fixedTime := time.Date(2000, time.January, 1, 10, 0, 0, 0, time.UTC)
+	at := func(e event, start time.Duration) event {
+		e.Start.DateTime = fixedTime.Add(start).Format(time.RFC3339)
+		e.End.DateTime = fixedTime.Add(start + 30*time.Minute).Format(time.RFC3339)
+		e.Reminders.UseDefault = true
+		return e
+	}
+	resetEvents()
+	setEvents("primary",
+		at(event{Summary: "Standup", Conference: &conference{[]entryPoint{
+			{"phone", "tel:+1-555-0100"},
+			{"video", "https://meet.google.com/abc-defg-hij"},
+		}}}, 0),
+		at(event{Summary: "Lunch", Location: "Cafeteria"}, 35*time.Minute),
+		at(event{Summary: "1:1", HangoutLink: "https://meet.google.com/xyz"}, 60*time.Minute),
+		at(event{Summary: "Vendor call",
+			Description: "Join: <a href=\"https://acme.zoom.us/j/123?pwd=x\">here</a>"},
+			2*time.Hour),
+		at(event{Summary: "Review", Location: "https://teams.microsoft.com/l/meetup/1 (Room 2)",
+			Attendees: []attendee{{true, "tentative"}}}, 3*time.Hour),
+	)
+
+	var opened []string
+	var openedMu sync.Mutex
+	openURL = func(url string) {
+		openedMu.Lock()
+		defer openedMu.Unlock()
+		opened = append(opened, url)
+	}
+	lastOpened := func() []string {
+		openedMu.Lock()
+		defer openedMu.Unlock()
+		o := opened
+		opened = nil
+		return o
+	}
+
+	testBar.New(t)
+	timing.AdvanceTo(fixedTime.Add(-10 * time.Minute))
+	cal := New(fakeClientConfig).RefreshInterval(720 * time.Hour)
+	var list EventList
+	var listMu sync.Mutex
+	cal.Output(func(l EventList) bar.Output {
+		listMu.Lock()
+		defer listMu.Unlock()
+		list = l
+		next, _ := l.Next()
+		return outputs.Text(next.Summary).OnClick(l.JoinClick())
+	})
+	getList := func() EventList {
+		listMu.Lock()
+		defer listMu.Unlock()
+		return list
+	}
+	testBar.Run(cal)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"Standup"})
+	next, ok := getList().Next()
+	require.True(ok)
+	require.Equal(fixedTime, next.Start)
+	require.Equal("https://meet.google.com/abc-defg-hij", next.ConferenceURL,
+		"video entry point from conference data")
+	_, ok = getList().Meeting()
+	require.False(ok, "meeting not joinable until alerting")
+	out.At(0).LeftClick()
+	require.Empty(lastOpened())
+
+	timing.NextTick()
+	out = testBar.NextOutput("on alert")
+	out.AssertText([]string{"Standup"})
+	out.At(0).LeftClick()
+	require.Equal([]string{"https://meet.google.com/abc-defg-hij"}, lastOpened())
+
+	timing.NextTick()
+	out = testBar.NextOutput("on start of event")
+	out.AssertText([]string{"Lunch"}, "next event not yet started")
+	out.At(0).LeftClick()
+	require.Equal([]string{"https://meet.google.com/abc-defg-hij"}, lastOpened(),
+		"in progress meeting")
+
+	evts := getList().Upcoming
+	require.Len(evts, 4)
+	require.Equal("", evts[0].ConferenceURL)
+	require.Nil(evts[0].Join())
+	require.Equal("https://meet.google.com/xyz", evts[1].ConferenceURL, "hangout link")
+	require.Equal("https://acme.zoom.us/j/123?pwd=x", evts[2].ConferenceURL, "from description")
+	require.Equal("https://teams.microsoft.com/l/meetup/1", evts[3].ConferenceURL, "from location")
+	require.Equal(StatusTentative, evts[3].Response)
+
+	for timing.Now().Before(fixedTime.Add(3 * time.Hour)) {
+		timing.NextTick()
+		testBar.NextOutput()
+	}
+	_, ok = getList().Next()
+	require.False(ok, "no more events")
+	meeting, ok := getList().Meeting()
+	require.True(ok)
+	require.Equal("Review", meeting.Summary)
+}
+
 func TestErrors(t *testing.T) {
 	resetEvents()
 
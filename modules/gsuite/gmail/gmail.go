@@ -20,7 +20,7 @@ import (
 	"time"
 
 	"barista.run/bar"
-	"barista.run/base/value"
+	"barista.run/core"
 	"barista.run/oauth"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -29,12 +29,42 @@ import (
 	gmail "google.golang.org/api/gmail/v1"
 )
 
-// Info represents the unread and total thread counts for labels.
+// Info represents the unread and total thread counts for labels, and the
+// number of threads matching search queries.
 // The keys are the names (not IDs) of the labels, and the values are the thread
 // counts (Threads is total threads, while Unread is just unread threads).
+// For modules with multiple accounts, counts for labels and queries with the
+// same name are added together across all accounts.
 type Info struct {
 	Threads map[string]int64
 	Unread  map[string]int64
+	// Queries is the estimated number of threads matching each query, keyed
+	// by the name given to the query.
+	Queries map[string]int64
+	// Accounts contains the counts for each account, keyed by account name.
+	// It is only set for modules created using Accounts.
+	Accounts map[string]Info
+}
+
+func newInfo() Info {
+	return Info{
+		Threads: map[string]int64{},
+		Unread:  map[string]int64{},
+		Queries: map[string]int64{},
+	}
+}
+
+// add adds the counts from other to i.
+func (i Info) add(other Info) {
+	for k, v := range other.Threads {
+		i.Threads[k] += v
+	}
+	for k, v := range other.Unread {
+		i.Unread[k] += v
+	}
+	for k, v := range other.Queries {
+		i.Queries[k] += v
+	}
 }
 
 // TotalUnread is the total number of unread threads across all labels. (as set
@@ -56,12 +86,62 @@ func (i Info) TotalThreads() int64 {
 	return t
 }
 
+// TotalQueries is the total number of threads matching all configured queries.
+// Threads that match more than one query are counted more than once.
+func (i Info) TotalQueries() int64 {
+	t := int64(0)
+	for _, c := range i.Queries {
+		t += c
+	}
+	return t
+}
+
+type query struct {
+	name, q string
+}
+
+// Account represents a gmail account, along with the labels and search queries
+// to fetch for it.
+type Account struct {
+	name    string
+	config  *oauth.Config
+	labels  []string
+	queries []query
+}
+
+// NewAccount creates a gmail account with the given name from the given oauth
+// config. Each account is authorised separately during oauth setup, so the same
+// client config can be used for several accounts. Without any labels or
+// queries, the account's INBOX is used.
+func NewAccount(name string, clientConfig []byte) *Account {
+	// Searching requires more than just the labels scope.
+	config, err := google.ConfigFromJSON(clientConfig, gmail.GmailReadonlyScope)
+	if err != nil {
+		panic("Bad client config: " + err.Error())
+	}
+	return &Account{name: name, config: oauth.RegisterAccount(config, name)}
+}
+
+// Labels adds labels for which to fetch unread and total thread counts.
+func (a *Account) Labels(labels ...string) *Account {
+	a.labels = append(a.labels, labels...)
+	return a
+}
+
+// Query adds a search query (e.g. "is:unread label:alerts"), using the same
+// syntax as the gmail search box. The estimated number of matching threads is
+// available in Info.Queries under the given name.
+func (a *Account) Query(name, q string) *Account {
+	a.queries = append(a.queries, query{name, q})
+	return a
+}
+
 // Module represents a Gmail barista module.
 type Module struct {
-	config     *oauth.Config
-	labels     []string
+	accounts   []*Account
+	multi      bool
 	scheduler  *timing.Scheduler
-	outputFunc value.Value // of func(Info) bar.Output
+	outputFunc core.OutputFunc // of func(Info) bar.Output
 }
 
 // New creates a gmail module from the given oauth config, that fetches unread
@@ -71,20 +151,38 @@ func New(clientConfig []byte, labels ...string) *Module {
 	if err != nil {
 		panic("Bad client config: " + err.Error())
 	}
-	if len(labels) == 0 {
-		labels = []string{"INBOX"}
+	return newModule(&Account{
+		config: oauth.Register(config),
+		labels: labels,
+	})
+}
+
+// Accounts creates a gmail module that fetches counts for several accounts.
+// Counts are aggregated across accounts, and are also available separately
+// for each account in Info.Accounts.
+func Accounts(accounts ...*Account) *Module {
+	m := newModule(accounts...)
+	m.multi = true
+	return m
+}
+
+func newModule(accounts ...*Account) *Module {
+	for _, a := range accounts {
+		if len(a.labels) == 0 && len(a.queries) == 0 {
+			a.labels = []string{"INBOX"}
+		}
 	}
 	m := &Module{
-		config:    oauth.Register(config),
-		labels:    labels,
+		accounts:  accounts,
 		scheduler: timing.NewScheduler(),
 	}
 	m.RefreshInterval(5 * time.Minute)
 	m.Output(func(i Info) bar.Output {
-		if i.TotalUnread() == 0 {
+		total := i.TotalUnread() + i.TotalQueries()
+		if total == 0 {
 			return nil
 		}
-		return outputs.Textf("Gmail: %d", i.TotalUnread())
+		return outputs.Textf("Gmail: %d", total)
 	})
 	return m
 }
@@ -92,22 +190,35 @@ func New(clientConfig []byte, labels ...string) *Module {
 // for tests, to wrap the client in a transport that redirects requests.
 var wrapForTest func(*http.Client)
 
+// account is a connected account.
+type account struct {
+	*Account
+	srv      *gmail.Service
+	labelIDs map[string]string
+}
+
 // Stream starts the module.
 func (m *Module) Stream(sink bar.Sink) {
-	client, _ := m.config.Client()
-	if wrapForTest != nil {
-		wrapForTest(client)
-	}
-	srv, _ := gmail.New(client)
-	r, err := srv.Users.Labels.List("me").Do()
-	if sink.Error(err) {
-		return
-	}
-	labelIDs := map[string]string{}
-	for _, l := range r.Labels {
-		labelIDs[l.Name] = l.Id
+	var accounts []account
+	for _, a := range m.accounts {
+		client, _ := a.config.Client()
+		if wrapForTest != nil {
+			wrapForTest(client)
+		}
+		srv, _ := gmail.New(client)
+		acct := account{Account: a, srv: srv, labelIDs: map[string]string{}}
+		if len(a.labels) > 0 {
+			r, err := srv.Users.Labels.List("me").Do()
+			if sink.Error(err) {
+				return
+			}
+			for _, l := range r.Labels {
+				acct.labelIDs[l.Name] = l.Id
+			}
+		}
+		accounts = append(accounts, acct)
 	}
-	i, err := fetch(srv, m.labels, labelIDs)
+	i, err := m.fetch(accounts)
 	outf := m.outputFunc.Get().(func(Info) bar.Output)
 	nextOutputFunc, done := m.outputFunc.Subscribe()
 	defer done()
@@ -120,24 +231,46 @@ func (m *Module) Stream(sink bar.Sink) {
 		case <-nextOutputFunc:
 			outf = m.outputFunc.Get().(func(Info) bar.Output)
 		case <-m.scheduler.C:
-			i, err = fetch(srv, m.labels, labelIDs)
+			i, err = m.fetch(accounts)
 		}
 	}
 }
 
-func fetch(srv *gmail.Service, labels []string, labelIDs map[string]string) (Info, error) {
-	i := Info{
-		Threads: map[string]int64{},
-		Unread:  map[string]int64{},
+func (m *Module) fetch(accounts []account) (Info, error) {
+	i := newInfo()
+	if m.multi {
+		i.Accounts = map[string]Info{}
+	}
+	for _, a := range accounts {
+		ai, err := a.fetch()
+		if err != nil {
+			return i, err
+		}
+		i.add(ai)
+		if m.multi {
+			i.Accounts[a.name] = ai
+		}
 	}
-	for _, l := range labels {
-		r, err := srv.Users.Labels.Get("me", labelIDs[l]).Do()
+	return i, nil
+}
+
+func (a account) fetch() (Info, error) {
+	i := newInfo()
+	for _, l := range a.labels {
+		r, err := a.srv.Users.Labels.Get("me", a.labelIDs[l]).Do()
 		if err != nil {
 			return i, err
 		}
 		i.Threads[l] = r.ThreadsTotal
 		i.Unread[l] = r.ThreadsUnread
 	}
+	for _, q := range a.queries {
+		r, err := a.srv.Users.Threads.List("me").Q(q.q).MaxResults(1).Do()
+		if err != nil {
+			return i, err
+		}
+		i.Queries[q.name] = r.ResultSizeEstimate
+	}
 	return i, nil
 }
 
@@ -42,6 +42,21 @@ var (
 	labelsMu sync.Mutex
 )
 
+var (
+	// Estimated thread counts, keyed by access token and then query.
+	queryResults   = map[string]map[string]int64{}
+	queryResultsMu sync.Mutex
+)
+
+func setQueryResult(token, q string, estimate int64) {
+	queryResultsMu.Lock()
+	defer queryResultsMu.Unlock()
+	if queryResults[token] == nil {
+		queryResults[token] = map[string]int64{}
+	}
+	queryResults[token][q] = estimate
+}
+
 func setLabels(testLabels ...label) {
 	labelsMu.Lock()
 	defer labelsMu.Unlock()
@@ -117,8 +132,98 @@ func TestErrors(t *testing.T) {
 	testBar.NextOutput().AssertError("error fetching list of labels")
 }
 
+func TestQueries(t *testing.T) {
+	testBar.New(t)
+	setLabels(label{"INBOX", "INBOX", 10, 2})
+	setQueryResult(defaultToken, "is:unread label:alerts", 3)
+	setQueryResult(defaultToken, "is:starred", 5)
+
+	gm := Accounts(NewAccount("me", fakeClientConfig).
+		Query("alerts", "is:unread label:alerts").
+		Query("starred", "is:starred"))
+	testBar.Run(gm)
+	testBar.NextOutput().AssertText([]string{"Gmail: 8"},
+		"without labels, only queries are counted")
+
+	gm.Output(func(i Info) bar.Output {
+		return outputs.Textf("%d,%d,%d",
+			i.Queries["alerts"], i.Queries["starred"], len(i.Unread))
+	})
+	testBar.NextOutput().AssertText([]string{"3,5,0"})
+
+	setQueryResult(defaultToken, "is:starred", 0)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"3,0,0"}, "on refresh")
+}
+
+func TestAccounts(t *testing.T) {
+	require := require.New(t)
+	setLabels(
+		label{"INBOX", "INBOX", 10, 2},
+		label{"label-000", "Work", 4, 1},
+	)
+	setQueryResult("token-work", "is:unread label:alerts", 3)
+	setQueryResult("token-home", "is:unread label:alerts", 1)
+
+	accountCount := 0
+	wrapForTest = func(c *http.Client) {
+		wrapWithToken(c, []string{"token-work", "token-home", "token-other"}[accountCount])
+		accountCount++
+	}
+	defer func() {
+		wrapForTest = func(c *http.Client) { wrapWithToken(c, defaultToken) }
+	}()
+
+	testBar.New(t)
+	var info Info
+	gm := Accounts(
+		NewAccount("work", fakeClientConfig).
+			Labels("INBOX", "Work").
+			Query("alerts", "is:unread label:alerts"),
+		NewAccount("home", fakeClientConfig).
+			Query("alerts", "is:unread label:alerts"),
+		NewAccount("other", fakeClientConfig),
+	).Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Textf("%d", i.TotalUnread()+i.TotalQueries())
+	})
+	testBar.Run(gm)
+	testBar.NextOutput().AssertText([]string{"9"})
+	require.Equal(3, accountCount)
+
+	require.Equal(map[string]int64{"INBOX": 4, "Work": 1}, info.Unread,
+		"labels added across accounts")
+	require.Equal(map[string]int64{"alerts": 4}, info.Queries,
+		"queries added across accounts")
+	require.Equal(Info{
+		Threads: map[string]int64{"INBOX": 10, "Work": 4},
+		Unread:  map[string]int64{"INBOX": 2, "Work": 1},
+		Queries: map[string]int64{"alerts": 3},
+	}, info.Accounts["work"])
+	require.Equal(int64(1), info.Accounts["home"].TotalQueries())
+	require.Equal(map[string]int64{"INBOX": 2}, info.Accounts["other"].Unread,
+		"INBOX used by default")
+}
+
+const defaultToken = "authtoken-placeholder"
+
+var wrapWithToken func(c *http.Client, token string)
+
 func TestMain(m *testing.M) {
 	mux := http.NewServeMux()
+	mux.HandleFunc("/gmail/v1/users/me/threads", func(w http.ResponseWriter, r *http.Request) {
+		queryResultsMu.Lock()
+		defer queryResultsMu.Unlock()
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		estimate, ok := queryResults[token][r.URL.Query().Get("q")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]int64{"resultSizeEstimate": estimate})
+	})
 	mux.HandleFunc("/gmail/v1/users/me/labels", func(w http.ResponseWriter, r *http.Request) {
 		labelsMu.Lock()
 		defer labelsMu.Unlock()
@@ -153,10 +258,11 @@ func TestMain(m *testing.M) {
 	server := httptest.NewServer(mux)
 	defer server.Close()
 
-	wrapForTest = func(c *http.Client) {
-		httpclient.FreezeOauthToken(c, "authtoken-placeholder")
+	wrapWithToken = func(c *http.Client, token string) {
+		httpclient.FreezeOauthToken(c, token)
 		httpclient.Wrap(c, server.URL)
 	}
+	wrapForTest = func(c *http.Client) { wrapWithToken(c, defaultToken) }
 
 	os.Exit(m.Run())
 }
@@ -0,0 +1,324 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package matrix provides a bar module that shows the number of unread
+// notifications and highlights across all joined Matrix rooms.
+//
+// It only uses the notification counts computed by the homeserver, so no
+// encryption keys are needed, and encrypted rooms are counted the same way as
+// any other room.
+package matrix // import "barista.run/modules/matrix"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/httpclient"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+)
+
+// Room represents the unread state of a joined room.
+type Room struct {
+	ID   string
+	Name string
+	// Notifications is the number of unread messages that trigger a
+	// notification according to the user's push rules.
+	Notifications int
+	// Highlights is the number of unread messages that mention the user, or
+	// otherwise match a highlight push rule.
+	Highlights int
+}
+
+// Info represents the unread state of all joined rooms.
+type Info struct {
+	// Rooms is the list of rooms with unread notifications, ordered by the
+	// number of highlights and then by the number of notifications.
+	Rooms []Room
+
+	url string
+}
+
+// Unread returns the total number of unread notifications.
+func (i Info) Unread() int {
+	c := 0
+	for _, r := range i.Rooms {
+		c += r.Notifications
+	}
+	return c
+}
+
+// Highlights returns the total number of unread highlights.
+func (i Info) Highlights() int {
+	c := 0
+	for _, r := range i.Rooms {
+		c += r.Highlights
+	}
+	return c
+}
+
+// Open opens the Matrix client in the default browser.
+func (i Info) Open() {
+	if i.url == "" {
+		return
+	}
+	if err := openURL(i.url); err != nil {
+		l.Log("Failed to open %s: %v", i.url, err)
+	}
+}
+
+// Module represents a bar module that shows unread Matrix notifications.
+type Module struct {
+	homeserver string
+	token      string
+	url        string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+
+	// Only accessed by the sync goroutine.
+	since string
+	rooms map[string]*Room
+}
+
+// New constructs a Matrix module for the given homeserver base URL (e.g.
+// "https://matrix.org") and access token. Updates are received by long-polling
+// the sync API, so changes are shown as soon as the homeserver sees them.
+func New(homeserver, accessToken string) *Module {
+	m := &Module{
+		homeserver: strings.TrimSuffix(homeserver, "/"),
+		token:      accessToken,
+		url:        "https://app.element.io/",
+		rooms:      map[string]*Room{},
+	}
+	l.Label(m, m.homeserver)
+	l.Register(m, "outputFunc")
+	m.Output(func(i Info) bar.Output {
+		if i.Unread() == 0 {
+			return nil
+		}
+		if h := i.Highlights(); h > 0 {
+			return outputs.Textf("MSG %d (%d)", i.Unread(), h).
+				Urgent(true).OnClick(click.Left(i.Open))
+		}
+		return outputs.Textf("MSG %d", i.Unread()).OnClick(click.Left(i.Open))
+	})
+	return m
+}
+
+// App sets the URL that is opened by Info.Open, by default the Element web
+// client. It must be called before the module is started.
+func (m *Module) App(url string) *Module {
+	m.url = url
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	updates := make(chan Info)
+	errs := make(chan error, 1)
+	go m.poll(updates, errs)
+	var info Info
+	started := false
+	for {
+		select {
+		case info = <-updates:
+			started = true
+		case err := <-errs:
+			sink.Error(err)
+			return
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+			if !started {
+				continue
+			}
+		}
+		sink.Output(outputFunc(info))
+	}
+}
+
+// poll repeatedly calls the sync API, sending the new info whenever the
+// unread counts change, until an error occurs.
+func (m *Module) poll(updates chan<- Info, errs chan<- error) {
+	timeout := time.Duration(0)
+	var last Info
+	for first := true; ; first = false {
+		if err := m.sync(timeout); err != nil {
+			errs <- err
+			return
+		}
+		timeout = pollTimeout
+		info := m.info()
+		if first || !equal(info, last) {
+			updates <- info
+		}
+		last = info
+	}
+}
+
+// filter limits the sync response to the unread counts and room names.
+const filter = `{
+	"presence": {"not_types": ["*"]},
+	"account_data": {"not_types": ["*"]},
+	"room": {
+		"account_data": {"not_types": ["*"]},
+		"ephemeral": {"not_types": ["*"]},
+		"state": {"types": ["m.room.name"], "lazy_load_members": true},
+		"timeline": {"types": ["m.room.name"], "limit": 1}
+	}
+}`
+
+type event struct {
+	Type    string `json:"type"`
+	Content struct {
+		Name string `json:"name"`
+	} `json:"content"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Unread *struct {
+				Notifications int `json:"notification_count"`
+				Highlights    int `json:"highlight_count"`
+			} `json:"unread_notifications"`
+			State struct {
+				Events []event `json:"events"`
+			} `json:"state"`
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Leave map[string]json.RawMessage `json:"leave"`
+	} `json:"rooms"`
+}
+
+type matrixError struct {
+	Code    string `json:"errcode"`
+	Message string `json:"error"`
+}
+
+func (m *Module) sync(timeout time.Duration) error {
+	q := url.Values{
+		"filter":       {filter},
+		"timeout":      {fmt.Sprintf("%d", timeout/time.Millisecond)},
+		"set_presence": {"offline"},
+	}
+	if m.since != "" {
+		q.Set("since", m.since)
+	}
+	req, err := http.NewRequest("GET", m.homeserver+"/_matrix/client/v3/sync?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		var e matrixError
+		if json.Unmarshal(body, &e) == nil && e.Code != "" {
+			return fmt.Errorf("matrix: %s: %s", e.Code, e.Message)
+		}
+		return fmt.Errorf("matrix: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var r syncResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	for id, room := range r.Rooms.Join {
+		rm, ok := m.rooms[id]
+		if !ok {
+			rm = &Room{ID: id}
+			m.rooms[id] = rm
+		}
+		if room.Unread != nil {
+			rm.Notifications = room.Unread.Notifications
+			rm.Highlights = room.Unread.Highlights
+		}
+		for _, evts := range [][]event{room.State.Events, room.Timeline.Events} {
+			for _, e := range evts {
+				if e.Type == "m.room.name" {
+					rm.Name = e.Content.Name
+				}
+			}
+		}
+	}
+	for id := range r.Rooms.Leave {
+		delete(m.rooms, id)
+	}
+	m.since = r.NextBatch
+	return nil
+}
+
+func (m *Module) info() Info {
+	i := Info{Rooms: []Room{}, url: m.url}
+	for _, r := range m.rooms {
+		if r.Notifications > 0 || r.Highlights > 0 {
+			i.Rooms = append(i.Rooms, *r)
+		}
+	}
+	sort.Slice(i.Rooms, func(a, b int) bool {
+		ra, rb := i.Rooms[a], i.Rooms[b]
+		if ra.Highlights != rb.Highlights {
+			return ra.Highlights > rb.Highlights
+		}
+		if ra.Notifications != rb.Notifications {
+			return ra.Notifications > rb.Notifications
+		}
+		return ra.ID < rb.ID
+	})
+	return i
+}
+
+func equal(a, b Info) bool {
+	if len(a.Rooms) != len(b.Rooms) {
+		return false
+	}
+	for i := range a.Rooms {
+		if a.Rooms[i] != b.Rooms[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Overridden in tests.
+var (
+	pollTimeout = 30 * time.Second
+	openURL     = func(url string) error {
+		return exec.Command("xdg-open", url).Run()
+	}
+)
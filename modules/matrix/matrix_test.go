@@ -0,0 +1,205 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHomeserver struct {
+	sync.Mutex
+	batch     int
+	sinces    []string
+	responses chan string
+}
+
+func newFakeHomeserver() *fakeHomeserver {
+	return &fakeHomeserver{responses: make(chan string, 10)}
+}
+
+func (f *fakeHomeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"errcode":"M_UNKNOWN_TOKEN","error":"Invalid access token passed."}`)
+		return
+	}
+	q := r.URL.Query()
+	if r.URL.Path != "/_matrix/client/v3/sync" ||
+		q.Get("set_presence") != "offline" || !json.Valid([]byte(q.Get("filter"))) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	timeout, _ := strconv.Atoi(q.Get("timeout"))
+	rooms := "{}"
+	select {
+	case rooms = <-f.responses:
+	default:
+		select {
+		case rooms = <-f.responses:
+		case <-time.After(time.Duration(timeout) * time.Millisecond):
+		}
+	}
+	f.Lock()
+	defer f.Unlock()
+	if rooms != "{}" {
+		// Only record the since token for syncs with changes.
+		f.sinces = append(f.sinces, q.Get("since"))
+	}
+	if rooms == "error" {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "Internal error")
+		return
+	}
+	f.batch++
+	fmt.Fprintf(w, `{"next_batch":"s%d","rooms":%s}`, f.batch, rooms)
+}
+
+func (f *fakeHomeserver) sinceTokens() []string {
+	f.Lock()
+	defer f.Unlock()
+	return f.sinces
+}
+
+func joined(id string, notifications, highlights int, name string) string {
+	state := "[]"
+	if name != "" {
+		state = fmt.Sprintf(`[{"type":"m.room.name","state_key":"","content":{"name":%q}}]`, name)
+	}
+	return fmt.Sprintf(`%q:{
+		"unread_notifications":{"notification_count":%d,"highlight_count":%d},
+		"state":{"events":%s},"timeline":{"events":[],"limited":false}
+	}`, id, notifications, highlights, state)
+}
+
+func TestMatrix(t *testing.T) {
+	testBar.New(t)
+	pollTimeout = 10 * time.Millisecond
+	var opened []string
+	var openedMu sync.Mutex
+	openURL = func(url string) error {
+		openedMu.Lock()
+		defer openedMu.Unlock()
+		opened = append(opened, url)
+		return nil
+	}
+	f := newFakeHomeserver()
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	f.responses <- fmt.Sprintf(`{"join":{%s,%s}}`,
+		joined("!a:example.com", 2, 0, "Barista"),
+		joined("!b:example.com", 0, 0, "Quiet"))
+	m := New(srv.URL+"/", "token")
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"MSG 2"})
+	out.At(0).LeftClick()
+	openedMu.Lock()
+	require.Equal(t, []string{"https://app.element.io/"}, opened)
+	openedMu.Unlock()
+
+	testBar.AssertNoOutput("when nothing changes")
+
+	f.responses <- fmt.Sprintf(`{"join":{%s}}`,
+		joined("!b:example.com", 3, 1, ""))
+	out = testBar.NextOutput("on new messages")
+	out.AssertText([]string{"MSG 5 (1)"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "urgent with highlights")
+
+	m.Output(func(i Info) bar.Output {
+		s := ""
+		for _, r := range i.Rooms {
+			s += fmt.Sprintf("%s:%d/%d;", r.Name, r.Notifications, r.Highlights)
+		}
+		return outputs.Text(s)
+	})
+	testBar.NextOutput("on output change").AssertText(
+		[]string{"Quiet:3/1;Barista:2/0;"}, "ordered by highlights")
+
+	f.responses <- `{"join":{"!a:example.com":{"timeline":{"events":[
+		{"type":"m.room.name","state_key":"","content":{"name":"Barista dev"}}
+	]}}}}`
+	testBar.NextOutput("on rename").AssertText(
+		[]string{"Quiet:3/1;Barista dev:2/0;"}, "keeps counts when not included")
+
+	f.responses <- `{"leave":{"!b:example.com":{}}}`
+	testBar.NextOutput("on leave").AssertText([]string{"Barista dev:2/0;"})
+
+	f.responses <- fmt.Sprintf(`{"join":{%s}}`, joined("!a:example.com", 0, 0, ""))
+	testBar.NextOutput("on read").AssertText([]string{""})
+
+	sinces := f.sinceTokens()
+	require.Equal(t, "", sinces[0], "initial sync")
+	for _, s := range sinces[1:] {
+		require.NotEmpty(t, s, "incremental sync")
+	}
+
+	f.responses <- "error"
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestErrors(t *testing.T) {
+	testBar.New(t)
+	pollTimeout = 10 * time.Millisecond
+	f := newFakeHomeserver()
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	m := New(srv.URL, "wrong")
+	testBar.Run(m)
+	errs := testBar.NextOutput("on start").AssertError()
+	require.Contains(t, errs[0], "M_UNKNOWN_TOKEN")
+
+	testBar.New(t)
+	f.responses <- `"invalid"`
+	testBar.Run(New(srv.URL, "token"))
+	testBar.NextOutput("on invalid response").AssertError()
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	pollTimeout = 10 * time.Millisecond
+	openURL = func(string) error {
+		require.Fail(t, "should not open without an app URL")
+		return nil
+	}
+	f := newFakeHomeserver()
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	f.responses <- fmt.Sprintf(`{"join":{%s}}`, joined("!a:example.com", 0, 0, "Empty"))
+	m := New(srv.URL, "token").App("")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertEmpty()
+
+	f.responses <- fmt.Sprintf(`{"join":{%s}}`, joined("!a:example.com", 1, 0, ""))
+	out := testBar.NextOutput("on message")
+	out.AssertText([]string{"MSG 1"})
+	out.At(0).LeftClick()
+}
@@ -0,0 +1,215 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"barista.run/bar"
+	"barista.run/base/httpclient"
+	"barista.run/base/watchers/metered"
+	l "barista.run/logging"
+	"barista.run/outputs"
+
+	"github.com/spf13/afero"
+)
+
+// ArtRenderer converts album art into output for the bar. It receives the
+// path to a local copy of the album art, and should return nil if the image
+// cannot be displayed, in which case a text badge is shown instead. The bar
+// protocol used by i3bar and swaybar does not support images, so renderers
+// are only useful with backends that do.
+type ArtRenderer func(path string) bar.Output
+
+// ArtRenderer sets the renderer used to display album art in Info.Art().
+func (m *Module) ArtRenderer(renderer ArtRenderer) *Module {
+	m.artRenderer.Set(renderer)
+	return m
+}
+
+// ArtRenderer sets the renderer used to display album art in Info.Art().
+func (m *AutoModule) ArtRenderer(renderer ArtRenderer) *AutoModule {
+	m.module.ArtRenderer(renderer)
+	return m
+}
+
+// Art returns the album art for the current track, using the module's art
+// renderer. If there is no art, or it cannot be rendered, a text badge is
+// returned instead.
+func (i Info) Art() bar.Output {
+	if i.ArtPath != "" && i.renderArt != nil {
+		if out := i.renderArt(i.ArtPath); out != nil {
+			return out
+		}
+	}
+	return outputs.Text(i.ArtBadge())
+}
+
+// ArtBadge returns a short text replacement for album art, made up of the
+// initials of the album (or track title if there is no album).
+func (i Info) ArtBadge() string {
+	name := i.Album
+	if name == "" {
+		name = i.Title
+	}
+	badge := ""
+	for _, word := range strings.Fields(name) {
+		r, _ := utf8.DecodeRuneInString(word)
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			badge += string(unicode.ToUpper(r))
+		}
+		if utf8.RuneCountInString(badge) == 2 {
+			break
+		}
+	}
+	if badge == "" {
+		return "♪"
+	}
+	return badge
+}
+
+// Overridden in tests.
+var (
+	fs       = afero.NewOsFs()
+	cacheDir = getCacheDir()
+)
+
+// The maximum number of downloaded images to keep in the cache, and the
+// largest image that will be downloaded.
+const (
+	maxCachedArt = 50
+	maxArtSize   = 10 * 1024 * 1024
+)
+
+// getCacheDir gets an XDG compliant directory for caching album art.
+func getCacheDir() string {
+	cacheRoot := os.ExpandEnv("$HOME/.cache")
+	if xdgCache, ok := os.LookupEnv("XDG_CACHE_HOME"); ok {
+		cacheRoot = xdgCache
+	}
+	return filepath.Join(cacheRoot, "barista", "media-art")
+}
+
+type artResult struct {
+	url  string
+	path string
+}
+
+// updateArt updates the art path of the info if the art URL has changed,
+// downloading the art in the background if it is not available locally. The
+// downloaded art is sent to the results channel. Art is not downloaded while
+// the connection is metered, but previously cached art is still used.
+func updateArt(info *Info, lastURL string, results chan<- artResult) {
+	if info.ArtURL == lastURL {
+		return
+	}
+	info.ArtPath = ""
+	u, err := url.Parse(info.ArtURL)
+	if err != nil || info.ArtURL == "" {
+		return
+	}
+	switch u.Scheme {
+	case "file":
+		info.ArtPath = u.Path
+	case "http", "https":
+		cached := cachePath(info.ArtURL, u)
+		if _, err := fs.Stat(cached); err == nil {
+			info.ArtPath = cached
+			return
+		}
+		if metered.Metered() {
+			return
+		}
+		go func(artURL string) {
+			err := downloadArt(artURL, cached)
+			if err != nil {
+				l.Log("Failed to download album art from %s: %v", artURL, err)
+				cached = ""
+			}
+			results <- artResult{artURL, cached}
+		}(info.ArtURL)
+	}
+}
+
+// cachePath returns the path used to cache art from the given URL. The file
+// extension is kept, since some renderers rely on it to detect the format.
+func cachePath(artURL string, u *url.URL) string {
+	hash := sha256.Sum224([]byte(artURL))
+	return filepath.Join(cacheDir, hex.EncodeToString(hash[:])+path.Ext(u.Path))
+}
+
+func downloadArt(artURL, dest string) error {
+	req, err := http.NewRequest("GET", artURL, nil)
+	if err != nil {
+		return err
+	}
+	// Art is already cached on disk, so keep it out of the in-memory cache.
+	req.Header.Set("Cache-Control", "no-store")
+	response, err := httpclient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %s", response.Status)
+	}
+	if err := fs.MkdirAll(cacheDir, 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first, to avoid partial images in the cache.
+	f, err := afero.TempFile(fs, cacheDir, "download")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, io.LimitReader(response.Body, maxArtSize))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Rename(f.Name(), dest)
+	}
+	if err != nil {
+		fs.Remove(f.Name())
+		return err
+	}
+	pruneArtCache()
+	return nil
+}
+
+// pruneArtCache removes the oldest images if the cache is too large.
+func pruneArtCache() {
+	files, err := afero.ReadDir(fs, cacheDir)
+	if err != nil || len(files) <= maxCachedArt {
+		return
+	}
+	sort.Slice(files, func(a, b int) bool {
+		return files[a].ModTime().Before(files[b].ModTime())
+	})
+	for _, f := range files[:len(files)-maxCachedArt] {
+		fs.Remove(filepath.Join(cacheDir, f.Name()))
+	}
+}
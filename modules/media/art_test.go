@@ -0,0 +1,201 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package media
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	dbusWatcher "barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/metered"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/godbus/dbus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtBadge(t *testing.T) {
+	for _, tc := range []struct {
+		album, title, badge string
+	}{
+		{"Abbey Road", "Something", "AR"},
+		{"", "Bohemian Rhapsody", "BR"},
+		{"1989", "", "1"},
+		{"The Dark Side of the Moon", "", "TD"},
+		{"(What's the Story) Morning Glory?", "", "TS"},
+		{"écoute", "", "É"},
+		{"", "", "♪"},
+	} {
+		i := Info{Album: tc.album, Title: tc.title}
+		require.Equal(t, tc.badge, i.ArtBadge(), "%+v", tc)
+	}
+}
+
+func TestArt(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	cacheDir = "/cache"
+	var mu sync.Mutex
+	var cacheControl []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		cacheControl = append(cacheControl, r.Header.Get("Cache-Control"))
+		mu.Unlock()
+		if r.URL.Path == "/missing.png" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Header().Set("ETag", `"art"`)
+		w.Write([]byte("image:" + r.URL.Path))
+	}))
+	defer srv.Close()
+
+	testBar.New(t)
+	bus := dbusWatcher.SetupTestBus()
+	svc := bus.RegisterService("org.mpris.MediaPlayer2.art")
+	obj := svc.Object("/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player")
+	setArt := func(url string, signal dbusWatcher.SignalType) {
+		obj.SetProperty("Metadata", map[string]dbus.Variant{
+			"xesam:title":  dbus.MakeVariant("Song"),
+			"xesam:album":  dbus.MakeVariant("Great Album"),
+			"mpris:artUrl": dbus.MakeVariant(url),
+		}, signal)
+	}
+	obj.SetProperty("PlaybackStatus", "Paused", dbusWatcher.SignalTypeNone)
+	setArt(srv.URL+"/cover.png", dbusWatcher.SignalTypeNone)
+
+	pl := New("art").Output(func(i Info) bar.Output {
+		return outputs.Group(i.Art(), outputs.Text(i.Title))
+	}).ArtRenderer(func(path string) bar.Output {
+		if filepath.Ext(path) == ".gif" {
+			return nil
+		}
+		return outputs.Text("img:" + path)
+	})
+	testBar.Run(pl)
+	testBar.NextOutput("on start").AssertText([]string{"GA", "Song"},
+		"badge while downloading")
+
+	coverURL, _ := url.Parse(srv.URL + "/cover.png")
+	path := cachePath(coverURL.String(), coverURL)
+	require.Equal(t, "/cache", filepath.Dir(path))
+	require.Equal(t, ".png", filepath.Ext(path))
+	testBar.NextOutput("on download").AssertText(
+		[]string{"img:" + path, "Song"})
+	contents, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	require.Equal(t, "image:/cover.png", string(contents))
+	mu.Lock()
+	require.Equal(t, []string{"no-store"}, cacheControl,
+		"art is kept out of the in-memory HTTP cache")
+	mu.Unlock()
+
+	setArt("file:///home/user/art.jpg", dbusWatcher.SignalTypeChanged)
+	testBar.NextOutput("on art change").AssertText(
+		[]string{"img:/home/user/art.jpg", "Song"}, "uses local files directly")
+
+	setArt(srv.URL+"/cover.png", dbusWatcher.SignalTypeChanged)
+	testBar.NextOutput("on art change").AssertText(
+		[]string{"img:" + path, "Song"}, "uses cached art")
+
+	setArt(srv.URL+"/other.gif", dbusWatcher.SignalTypeChanged)
+	testBar.NextOutput("on art change").AssertText(
+		[]string{"GA", "Song"}, "while downloading")
+	testBar.NextOutput("on download").AssertText(
+		[]string{"GA", "Song"}, "when renderer does not support art")
+
+	setArt(srv.URL+"/missing.png", dbusWatcher.SignalTypeChanged)
+	testBar.NextOutput("on art change").AssertText(
+		[]string{"GA", "Song"}, "while downloading")
+	testBar.NextOutput("on download error").AssertText(
+		[]string{"GA", "Song"}, "on download error")
+	files, _ := afero.ReadDir(fs, "/cache")
+	require.Len(t, files, 2, "failed download is not cached")
+
+	setArt(srv.URL+"/cover.png", dbusWatcher.SignalTypeChanged)
+	testBar.NextOutput("on art change").AssertText([]string{"img:" + path, "Song"})
+	pl.ArtRenderer(nil)
+	testBar.NextOutput("on renderer change").AssertText(
+		[]string{"GA", "Song"}, "badge without renderer")
+}
+
+func TestArtWhileMetered(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	cacheDir = "/cache"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image:" + r.URL.Path))
+	}))
+	defer srv.Close()
+	defer metered.SetForTest(false)
+
+	testBar.New(t)
+	bus := dbusWatcher.SetupTestBus()
+	svc := bus.RegisterService("org.mpris.MediaPlayer2.metered")
+	obj := svc.Object("/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player")
+	obj.SetProperty("PlaybackStatus", "Playing", dbusWatcher.SignalTypeNone)
+	obj.SetProperty("Metadata", map[string]dbus.Variant{
+		"xesam:title":  dbus.MakeVariant("Song"),
+		"xesam:album":  dbus.MakeVariant("Great Album"),
+		"mpris:artUrl": dbus.MakeVariant(srv.URL + "/cover.png"),
+	}, dbusWatcher.SignalTypeNone)
+
+	metered.SetForTest(true)
+	testBar.Run(New("metered").Output(func(i Info) bar.Output {
+		return outputs.Group(i.Art(), outputs.Text(i.Title))
+	}).ArtRenderer(func(path string) bar.Output {
+		return outputs.Text("img:" + path)
+	}))
+	testBar.NextOutput("on start").AssertText([]string{"GA", "Song"})
+	testBar.AssertNoOutput("no download while metered")
+	files, _ := afero.ReadDir(fs, "/cache")
+	require.Empty(t, files, "nothing downloaded while metered")
+
+	metered.SetForTest(false)
+	testBar.NextOutput("on unmetered connection").AssertText([]string{"GA", "Song"})
+	coverURL, _ := url.Parse(srv.URL + "/cover.png")
+	path := cachePath(coverURL.String(), coverURL)
+	testBar.NextOutput("on download").AssertText([]string{"img:" + path, "Song"})
+
+	metered.SetForTest(true)
+	testBar.NextOutput("on metered connection").AssertText(
+		[]string{"img:" + path, "Song"}, "downloaded art is kept")
+}
+
+func testTime(minutes int) time.Time {
+	return time.Date(2018, 1, 1, 0, minutes, 0, 0, time.UTC)
+}
+
+func TestPruneArtCache(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	cacheDir = "/cache"
+	for i := 0; i < maxCachedArt+5; i++ {
+		name := filepath.Join(cacheDir, string(rune('a'+i%26))+string(rune('a'+i/26)))
+		afero.WriteFile(fs, name, nil, 0600)
+		fs.Chtimes(name, testTime(i), testTime(i))
+	}
+	pruneArtCache()
+	files, _ := afero.ReadDir(fs, cacheDir)
+	require.Len(t, files, maxCachedArt)
+	for _, f := range files {
+		require.False(t, f.ModTime().Before(testTime(5)), "oldest files removed")
+	}
+}
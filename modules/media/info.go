@@ -80,11 +80,54 @@ func (i Info) Next() { i.call("Next") }
 // Previous switches to the previous track.
 func (i Info) Previous() { i.call("Previous") }
 
-// Seek seeks to the given position within the currently playing track.
+// Seek seeks by the given offset relative to the current position.
 func (i Info) Seek(offset time.Duration) {
 	i.call("Seek", int64(offset/time.Microsecond))
 }
 
+// SetPosition seeks to the given absolute position within the current track.
+// Positions outside the track are ignored.
+func (i Info) SetPosition(position time.Duration) {
+	if position < 0 || (i.Length > 0 && position > i.Length) {
+		return
+	}
+	i.call("SetPosition", i.trackPath, int64(position/time.Microsecond))
+}
+
+// Rate returns the current playback rate, where 1.0 is normal speed.
+func (i Info) Rate() float64 { return i.rate }
+
+// SetRate sets the playback rate, limited to the range supported by the
+// player.
+func (i Info) SetRate(rate float64) {
+	if rate < i.MinimumRate {
+		rate = i.MinimumRate
+	}
+	if rate > i.MaximumRate {
+		rate = i.MaximumRate
+	}
+	i.setProp("Rate", rate)
+}
+
+// SetShuffle enables or disables shuffled playback.
+func (i Info) SetShuffle(shuffle bool) { i.setProp("Shuffle", shuffle) }
+
+// SetLoopStatus sets the repeat mode of the player.
+func (i Info) SetLoopStatus(status LoopStatus) { i.setProp("LoopStatus", string(status)) }
+
+// NextLoopStatus cycles through the repeat modes of the player,
+// from None to Playlist to Track, and back to None.
+func (i Info) NextLoopStatus() {
+	switch i.LoopStatus {
+	case LoopNone:
+		i.SetLoopStatus(LoopPlaylist)
+	case LoopPlaylist:
+		i.SetLoopStatus(LoopTrack)
+	default:
+		i.SetLoopStatus(LoopNone)
+	}
+}
+
 func (i *Info) set(key string, value interface{}) {
 	switch key {
 	case "Rate":
@@ -95,6 +138,29 @@ func (i *Info) set(key string, value interface{}) {
 		i.lastPosition = time.Duration(getDouble(value)) * time.Microsecond
 	case "Shuffle":
 		i.Shuffle, _ = value.(bool)
+	case "LoopStatus":
+		status, _ := value.(string)
+		i.LoopStatus = LoopStatus(status)
+	case "CanControl":
+		i.CanControl, _ = value.(bool)
+	case "CanPlay":
+		i.CanPlay, _ = value.(bool)
+	case "CanPause":
+		i.CanPause, _ = value.(bool)
+	case "CanSeek":
+		i.CanSeek, _ = value.(bool)
+	case "CanGoNext":
+		i.CanGoNext, _ = value.(bool)
+	case "CanGoPrevious":
+		i.CanGoPrevious, _ = value.(bool)
+	case "MinimumRate":
+		if value != nil {
+			i.MinimumRate = getDouble(value)
+		}
+	case "MaximumRate":
+		if value != nil {
+			i.MaximumRate = getDouble(value)
+		}
 	case "PlaybackStatus":
 		status, _ := value.(string)
 		i.updatePlaybackStatus(status)
@@ -168,12 +234,24 @@ func (i *Info) updateMetadata(metadata map[string]dbus.Variant) {
 		i.Title = title.Value().(string)
 	}
 	i.ArtURL = ""
-	if ArtURL, ok := metadata["mpris:ArtURL"]; ok {
-		i.ArtURL = ArtURL.Value().(string)
+	// mpris:artUrl is the correct key, but some players use mpris:ArtURL.
+	for _, key := range []string{"mpris:artUrl", "mpris:ArtURL"} {
+		if artURL, ok := metadata[key]; ok {
+			i.ArtURL, _ = artURL.Value().(string)
+			break
+		}
 	}
 	trackID := ""
+	i.trackPath = ""
 	if id, ok := metadata["mpris:trackid"]; ok {
 		trackID = id.String()
+		// Some players incorrectly use a string instead of an object path.
+		switch path := id.Value().(type) {
+		case dbus.ObjectPath:
+			i.trackPath = path
+		case string:
+			i.trackPath = dbus.ObjectPath(path)
+		}
 	}
 	if trackID != i.trackID {
 		// mpris suggests that position should be reset on track change.
@@ -17,15 +17,19 @@ package media // import "barista.run/modules/media"
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"barista.run/bar"
 	"barista.run/base/value"
 	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/metered"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 
+	godbus "github.com/godbus/dbus"
 	"golang.org/x/time/rate"
 )
 
@@ -43,11 +47,37 @@ const (
 	Stopped = PlaybackStatus("Stopped")
 )
 
+// LoopStatus represents the repeat mode of the media player.
+type LoopStatus string
+
+const (
+	// LoopNone if playback stops at the end of the playlist.
+	LoopNone = LoopStatus("None")
+	// LoopTrack if the current track repeats.
+	LoopTrack = LoopStatus("Track")
+	// LoopPlaylist if playback restarts at the end of the playlist.
+	LoopPlaylist = LoopStatus("Playlist")
+)
+
 // Info represents the current information from the media player.
 type Info struct {
 	PlayerName     string
 	PlaybackStatus PlaybackStatus
 	Shuffle        bool
+	// LoopStatus is empty if the player does not support looping.
+	LoopStatus LoopStatus
+	// Capabilities of the player, which can be used to hide unsupported
+	// controls. Calling unsupported methods has no effect.
+	CanControl    bool
+	CanPlay       bool
+	CanPause      bool
+	CanSeek       bool
+	CanGoNext     bool
+	CanGoPrevious bool
+	// The range of supported playback rates. Both are 1.0 for players that
+	// do not support changing the rate.
+	MinimumRate float64
+	MaximumRate float64
 	// From Metadata
 	Length      time.Duration
 	Title       string
@@ -57,6 +87,11 @@ type Info struct {
 	// Although ArtURL cannot be used in the module output, it can still be
 	// used for notifications or colour extraction.
 	ArtURL string
+	// ArtPath is the path to a local copy of the album art, once available.
+	// Remote art is downloaded and cached, so this is empty while the art is
+	// being downloaded, or if the download fails.
+	ArtPath   string
+	renderArt ArtRenderer
 	// Position is computed from the last known position and rate,
 	// since position updates don't trigger any updates.
 	lastUpdated  time.Time
@@ -66,15 +101,20 @@ type Info struct {
 	// a track change or a metadata update to the current track.
 	// unexported because it won't be set when position is not being tracked.
 	trackID string
-	// A method to forward DBus calls, allowing control of the player.
-	call func(string, ...interface{}) ([]interface{}, error)
+	// trackPath is the object path of the track, used for SetPosition.
+	trackPath godbus.ObjectPath
+	// Methods to forward DBus calls and property changes, allowing control
+	// of the player.
+	call    func(string, ...interface{}) ([]interface{}, error)
+	setProp func(string, interface{}) error
 }
 
 // Module represents a bar.Module that displays media information
 // from an MPRIS-compatible media player.
 type Module struct {
-	playerName value.Value // of string
-	outputFunc value.Value // of func(Info) bar.Output
+	playerName  value.Value     // of string
+	outputFunc  core.OutputFunc // of func(Info) bar.Output
+	artRenderer value.Value     // of ArtRenderer
 }
 
 // New constructs an instance of the media module for the given player.
@@ -82,7 +122,7 @@ func New(player string) *Module {
 	m := new(Module)
 	m.playerName.Set(player)
 	l.Label(m, player)
-	l.Register(m, "playerName", "outputFunc")
+	l.Register(m, "playerName", "outputFunc", "artRenderer")
 	// Default output is just the currently playing track.
 	m.Output(func(i Info) bar.Output {
 		if i.Playing() {
@@ -125,26 +165,37 @@ func (m *Module) RepeatingOutput(outputFunc func(Info) bar.Output) *Module {
 	})
 }
 
-// AutoModule is a media module that automatically switches to the newest media
-// player seen on D-Bus.
+// AutoModule is a media module that automatically follows the most relevant
+// media player seen on D-Bus.
 type AutoModule struct {
-	module   *Module
-	excluded map[string]bool
+	module    *Module
+	excluded  map[string]bool
+	preferred value.Value // of []string
 }
 
-// Auto constructs an instance of the media module that shows the most recently
-// connected player (based on D-Bus name acquisition). It can optionally ignore
+// Auto constructs an instance of the media module that tracks all players,
+// and shows the most recently active one. Players that are playing are
+// always preferred, followed by players given to Prefer, and then the player
+// that most recently started playing or connected. It can optionally ignore
 // one or more named players from this detection.
 func Auto(excluding ...string) *AutoModule {
 	excluded := map[string]bool{}
 	for _, e := range excluding {
 		excluded[e] = true
 	}
-	m := &AutoModule{New(""), excluded}
+	m := &AutoModule{module: New(""), excluded: excluded}
+	m.preferred.Set([]string(nil))
 	l.Attach(m.module, m, "~auto")
 	return m
 }
 
+// Prefer sets the players to prefer, highest priority first, when choosing
+// between multiple players that are all playing or all not playing.
+func (m *AutoModule) Prefer(players ...string) *AutoModule {
+	m.preferred.Set(players)
+	return m
+}
+
 // Output configures a module to display the output of a user-defined function.
 func (m *AutoModule) Output(outputFunc func(Info) bar.Output) *AutoModule {
 	m.module.Output(outputFunc)
@@ -198,22 +249,43 @@ func (m *Module) Stream(s bar.Sink) {
 	nextPlayerName, done := m.playerName.Subscribe()
 	defer done()
 
+	artRenderer, _ := m.artRenderer.Get().(ArtRenderer)
+	nextArtRenderer, done := m.artRenderer.Subscribe()
+	defer done()
+
+	artResults := make(chan artResult)
 	w, info := subscribeToPlayer(playerName)
+	updateArt(&info, "", artResults)
 	for {
+		info.renderArt = artRenderer
 		s.Output(outputs.Group(outputFunc(info)).
 			OnClick(defaultClickHandler(info)))
+		lastArtURL := info.ArtURL
 		select {
 		case <-nextPlayerName:
 			w.Unsubscribe()
 			playerName = m.playerName.Get().(string)
 			w, info = subscribeToPlayer(playerName)
+			lastArtURL = ""
 		case <-nextOutputFunc:
 			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		case <-nextArtRenderer:
+			artRenderer, _ = m.artRenderer.Get().(ArtRenderer)
 		case u := <-w.Updates:
 			for k, v := range u {
 				info.set(k, v[1])
 			}
+		case r := <-artResults:
+			if r.url == info.ArtURL {
+				info.ArtPath = r.path
+			}
+		case <-metered.Next():
+			if info.ArtPath == "" {
+				// Retry art that was skipped while metered.
+				lastArtURL = ""
+			}
 		}
+		updateArt(&info, lastArtURL, artResults)
 	}
 }
 
@@ -223,12 +295,20 @@ func subscribeToPlayer(playerName string) (*dbus.PropertiesWatcher, Info) {
 	w := dbus.WatchProperties(busType,
 		fmt.Sprintf("org.mpris.MediaPlayer2.%s", playerName),
 		"/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player").
-		Add("Rate", "Shuffle", "PlaybackStatus", "Metadata").
+		Add("Rate", "Shuffle", "LoopStatus", "PlaybackStatus", "Metadata",
+			"CanControl", "CanPlay", "CanPause", "CanSeek", "CanGoNext",
+			"CanGoPrevious", "MinimumRate", "MaximumRate").
 		FetchOnSignal("Position").
 		AddSignalHandler("Seeked", func(s *dbus.Signal, _ dbus.Fetcher) map[string]interface{} {
 			return map[string]interface{}{"Position": s.Body[0]}
 		})
-	info := Info{PlayerName: playerName, call: w.Call}
+	info := Info{
+		PlayerName:  playerName,
+		MinimumRate: 1.0,
+		MaximumRate: 1.0,
+		call:        w.Call,
+		setProp:     w.SetProperty,
+	}
 	for k, v := range w.Get() {
 		info.set(k, v)
 	}
@@ -236,53 +316,178 @@ func subscribeToPlayer(playerName string) (*dbus.PropertiesWatcher, Info) {
 	return w, info
 }
 
-// Stream starts the module and the D-Bus listener for media player name
-// acquisitions and releases.
+// Stream starts the module and the D-Bus listeners for media players.
 func (m *AutoModule) Stream(s bar.Sink) {
 	w := dbus.WatchNameOwners(busType, "org.mpris.MediaPlayer2")
 	defer w.Unsubscribe()
-	ownerStack := []string{}
+	t := &playerTracker{
+		players:  map[string]*trackedPlayer{},
+		statuses: make(chan playerStatus),
+	}
+	var names []string
 	for k := range w.GetOwners() {
-		if len(ownerStack) == 0 {
-			l.Fine("%s, starting with %s", l.ID(m), k)
-			m.playerName(k)
+		if !m.isExcluded(k) {
+			names = append(names, k)
 		}
-		ownerStack = append(ownerStack, k)
 	}
-	go m.listenForPlayerUpdates(w.Updates, ownerStack)
+	sort.Strings(names)
+	for _, n := range names {
+		t.add(n)
+	}
+	if best := t.best(m.preferred.Get().([]string)); best != "" {
+		l.Fine("%s, starting with %s", l.ID(m), best)
+		m.playerName(best)
+	}
+	go m.trackPlayers(w.Updates, t)
 	m.module.Stream(s)
 }
 
+func (m *AutoModule) isExcluded(dbusName string) bool {
+	return m.excluded[strings.TrimPrefix(dbusName, "org.mpris.MediaPlayer2.")]
+}
+
 func (m *AutoModule) playerName(dbusName string) {
 	m.module.Player(strings.TrimPrefix(dbusName, "org.mpris.MediaPlayer2."))
 }
 
-func (m *AutoModule) listenForPlayerUpdates(updates <-chan dbus.NameOwnerChange, ownerStack []string) {
-	for u := range updates {
-		if m.excluded[strings.TrimPrefix(u.Name, "org.mpris.MediaPlayer2.")] {
-			continue
+func (m *AutoModule) trackPlayers(updates <-chan dbus.NameOwnerChange, t *playerTracker) {
+	nextPreferred, done := m.preferred.Subscribe()
+	defer done()
+	for {
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				return
+			}
+			if m.isExcluded(u.Name) {
+				continue
+			}
+			if u.Owner != "" {
+				l.Fine("%s: new player %s", l.ID(m), u.Name)
+				t.add(u.Name)
+			} else {
+				l.Fine("%s: player %s disconnected", l.ID(m), u.Name)
+				t.remove(u.Name)
+			}
+		case st := <-t.statuses:
+			t.setStatus(st)
+		case <-nextPreferred:
+		}
+		best := t.best(m.preferred.Get().([]string))
+		curr := "org.mpris.MediaPlayer2." + m.module.playerName.Get().(string)
+		if best != "" && best != curr {
+			l.Fine("%s: switching to %s", l.ID(m), best)
+			m.playerName(best)
+		}
+	}
+}
+
+// playerTracker tracks the playback status of all media players, to
+// determine which player should be displayed.
+type playerTracker struct {
+	players  map[string]*trackedPlayer
+	statuses chan playerStatus
+	// Incremented on each player activity, to order players by recency.
+	activity int
+}
+
+type trackedPlayer struct {
+	watcher    *dbus.PropertiesWatcher
+	done       chan struct{}
+	playing    bool
+	lastActive int
+}
+
+type playerStatus struct {
+	name   string
+	player *trackedPlayer
+	status PlaybackStatus
+}
+
+// add starts tracking a player, which counts as activity for the player.
+func (t *playerTracker) add(name string) {
+	t.remove(name)
+	w := dbus.WatchProperties(busType, name,
+		"/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player").
+		Add("PlaybackStatus")
+	t.activity++
+	p := &trackedPlayer{watcher: w, done: make(chan struct{}), lastActive: t.activity}
+	status, _ := w.Get()["PlaybackStatus"].(string)
+	p.playing = PlaybackStatus(status) == Playing
+	t.players[name] = p
+	go func() {
+		for {
+			select {
+			case u := <-w.Updates:
+				status, _ := u["PlaybackStatus"][1].(string)
+				select {
+				case t.statuses <- playerStatus{name, p, PlaybackStatus(status)}:
+				case <-p.done:
+					return
+				}
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+func (t *playerTracker) remove(name string) {
+	if p, ok := t.players[name]; ok {
+		close(p.done)
+		p.watcher.Unsubscribe()
+		delete(t.players, name)
+	}
+}
+
+// setStatus updates the status of a player. Starting playback counts as
+// activity for the player.
+func (t *playerTracker) setStatus(st playerStatus) {
+	if t.players[st.name] != st.player {
+		// Stale update from a player that was since removed.
+		return
+	}
+	playing := st.status == Playing
+	if playing && !st.player.playing {
+		t.activity++
+		st.player.lastActive = t.activity
+	}
+	st.player.playing = playing
+}
+
+// best returns the D-Bus name of the player that should be displayed, or an
+// empty string if there are no players.
+func (t *playerTracker) best(preferred []string) string {
+	rank := func(name string) int {
+		for i, p := range preferred {
+			if "org.mpris.MediaPlayer2."+p == name {
+				return i
+			}
 		}
-		if u.Owner != "" {
-			// New player, switch to it.
-			l.Fine("%s: switching to new player %s", l.ID(m), u.Name)
-			m.playerName(u.Name)
-			ownerStack = append(ownerStack, u.Name)
+		return len(preferred)
+	}
+	best := ""
+	for name, p := range t.players {
+		if best == "" {
+			best = name
 			continue
 		}
-		for i, n := range ownerStack {
-			if n == u.Name {
-				ownerStack = append(ownerStack[:i], ownerStack[i+1:]...)
+		b := t.players[best]
+		if p.playing != b.playing {
+			if p.playing {
+				best = name
 			}
+			continue
 		}
-		l.Fine("player %s disconnected", u.Name)
-		curr := m.module.playerName.Get().(string)
-		if u.Name == "org.mpris.MediaPlayer2."+curr {
-			l.Fine("%s: current player %s disconnected", l.ID(m), u.Name)
-			count := len(ownerStack)
-			if count > 0 {
-				l.Fine("%s: switching to %s", l.ID(m), ownerStack[count-1])
-				m.playerName(ownerStack[count-1])
+		if r, rb := rank(name), rank(best); r != rb {
+			if r < rb {
+				best = name
 			}
+			continue
+		}
+		if p.lastActive > b.lastActive {
+			best = name
 		}
 	}
+	return best
 }
@@ -20,6 +20,7 @@ import (
 
 	"barista.run/bar"
 	dbusWatcher "barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/metered"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
 	"barista.run/timing"
@@ -31,6 +32,7 @@ import (
 
 func init() {
 	busType = dbusWatcher.Test
+	metered.SetForTest(false)
 }
 
 type methodCall struct {
@@ -276,9 +278,17 @@ func TestAutoMedia(t *testing.T) {
 
 	objB.SetProperties(map[string]interface{}{"PlaybackStatus": "Playing"},
 		dbusWatcher.SignalTypeChanged)
+	testBar.NextOutput("on inactive player playing").
+		AssertText([]string{"Playing: TitleB"})
+
+	objC.SetProperties(map[string]interface{}{"PlaybackStatus": "Paused"},
+		dbusWatcher.SignalTypeChanged)
 	testBar.AssertNoOutput("on inactive player change")
+
 	srvB.Unregister()
-	testBar.AssertNoOutput("on inactive player disconnect")
+	testBar.
+		Drain(time.Second, "on active player disconnect").
+		AssertText([]string{"Paused: TitleC"}, "switches to most recent player")
 
 	srvC.Unregister()
 	testBar.
@@ -293,6 +303,161 @@ func TestAutoMedia(t *testing.T) {
 		AssertText([]string{": "})
 }
 
+func TestAutoPreferences(t *testing.T) {
+	testBar.New(t)
+	bus := dbusWatcher.SetupTestBus()
+	player := func(name, status string) *dbusWatcher.TestBusObject {
+		srv := bus.RegisterService("org.mpris.MediaPlayer2." + name)
+		obj := srv.Object("/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player")
+		obj.SetProperties(map[string]interface{}{
+			"PlaybackStatus": status,
+			"Metadata": map[string]dbus.Variant{
+				"xesam:title": dbus.MakeVariant(name),
+			},
+		}, dbusWatcher.SignalTypeNone)
+		return obj
+	}
+	setStatus := func(obj *dbusWatcher.TestBusObject, status string) {
+		obj.SetProperty("PlaybackStatus", status, dbusWatcher.SignalTypeChanged)
+	}
+	x := player("X", "Paused")
+	y := player("Y", "Paused")
+
+	auto := Auto().Prefer("X").Output(func(i Info) bar.Output {
+		return outputs.Textf("%v: %s", i.PlaybackStatus, i.Title)
+	})
+	testBar.Run(auto)
+	testBar.NextOutput("on start").AssertText([]string{"Paused: X"},
+		"preferred player")
+
+	setStatus(y, "Playing")
+	testBar.NextOutput("on playback").AssertText([]string{"Playing: Y"},
+		"playing player over preferred player")
+
+	setStatus(x, "Playing")
+	testBar.NextOutput("on playback").AssertText([]string{"Playing: X"},
+		"preferred player when both are playing")
+
+	setStatus(x, "Stopped")
+	testBar.Drain(time.Second, "on stop").AssertText([]string{"Playing: Y"})
+
+	setStatus(y, "Paused")
+	testBar.Drain(time.Second, "on pause").AssertText([]string{"Stopped: X"},
+		"preferred player when none are playing")
+
+	auto.Prefer("Y", "X")
+	testBar.NextOutput("on preference change").AssertText([]string{"Paused: Y"})
+
+	z := player("Z", "Paused")
+	testBar.AssertNoOutput("on new player that is not preferred")
+
+	setStatus(z, "Playing")
+	testBar.NextOutput("on playback").AssertText([]string{"Playing: Z"})
+}
+
+func TestControls(t *testing.T) {
+	testBar.New(t)
+	bus := dbusWatcher.SetupTestBus()
+	srv := bus.RegisterService("org.mpris.MediaPlayer2.controls")
+	obj := srv.Object("/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player")
+	obj.SetProperties(map[string]interface{}{
+		"PlaybackStatus": "Paused",
+		"Rate":           1.0,
+		"Shuffle":        false,
+		"LoopStatus":     "None",
+		"CanSeek":        true,
+		"CanGoNext":      true,
+		"MinimumRate":    0.5,
+		"MaximumRate":    2.0,
+		"Metadata": map[string]dbus.Variant{
+			"xesam:title":   dbus.MakeVariant("Song"),
+			"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/track/1")),
+			"mpris:length":  dbus.MakeVariant(int64(300 * 1000 * 1000)),
+		},
+	}, dbusWatcher.SignalTypeNone)
+	calls := make(chan methodCall, 10)
+	var args [][]interface{}
+	obj.OnElse(func(method string, a ...interface{}) ([]interface{}, error) {
+		args = append(args, a)
+		calls <- methodCall{name: method}
+		return nil, nil
+	})
+
+	pl := New("controls").Output(func(i Info) bar.Output {
+		return outputs.Textf("%s shuffle:%v loop:%s rate:%v seek:%v next:%v prev:%v",
+			i.Title, i.Shuffle, i.LoopStatus, i.Rate(),
+			i.CanSeek, i.CanGoNext, i.CanGoPrevious).
+			OnClick(func(e bar.Event) {
+				switch e.Button {
+				case bar.ButtonLeft:
+					i.SetShuffle(!i.Shuffle)
+				case bar.ButtonRight:
+					i.NextLoopStatus()
+				case bar.ScrollUp:
+					i.SetRate(i.Rate() * 4)
+				case bar.ScrollDown:
+					i.SetRate(i.Rate() / 8)
+				case bar.ButtonMiddle:
+					i.SetPosition(time.Minute)
+				case bar.ButtonBack:
+					i.SetPosition(time.Hour)
+				}
+			})
+	})
+	testBar.Run(pl)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{
+		"Song shuffle:false loop:None rate:1 seek:true next:true prev:false"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on shuffle")
+	out.AssertText([]string{
+		"Song shuffle:true loop:None rate:1 seek:true next:true prev:false"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	out = testBar.NextOutput("on loop change")
+	out.AssertText([]string{
+		"Song shuffle:true loop:Playlist rate:1 seek:true next:true prev:false"})
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	out = testBar.NextOutput("on loop change")
+	out.AssertText([]string{
+		"Song shuffle:true loop:Track rate:1 seek:true next:true prev:false"})
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	out = testBar.NextOutput("on loop change")
+	out.AssertText([]string{
+		"Song shuffle:true loop:None rate:1 seek:true next:true prev:false"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("on rate change")
+	out.AssertText([]string{
+		"Song shuffle:true loop:None rate:2 seek:true next:true prev:false"},
+		"limited to maximum rate")
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	out = testBar.NextOutput("on rate change")
+	out.AssertText([]string{
+		"Song shuffle:true loop:None rate:0.5 seek:true next:true prev:false"},
+		"limited to minimum rate")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonMiddle})
+	require.Equal(t,
+		methodCall{name: "org.mpris.MediaPlayer2.Player.SetPosition"},
+		<-calls, "On set position")
+	require.Equal(t,
+		[]interface{}{dbus.ObjectPath("/track/1"), int64(60 * 1000 * 1000)},
+		args[0])
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonBack})
+	select {
+	case c := <-calls:
+		require.Fail(t, "Unexpected method call", "%v beyond track length", c)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	obj.SetProperty("CanGoPrevious", true, dbusWatcher.SignalTypeChanged)
+	testBar.NextOutput("on capability change").AssertText([]string{
+		"Song shuffle:true loop:None rate:0.5 seek:true next:true prev:true"})
+}
+
 func TestDbusLongAndFloats(t *testing.T) {
 	for _, tc := range []struct {
 		val      interface{}
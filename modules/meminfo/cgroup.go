@@ -0,0 +1,101 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meminfo
+
+import (
+	"sync/atomic"
+
+	"barista.run/base/cgroup"
+	"barista.run/base/value"
+	l "barista.run/logging"
+
+	"github.com/martinlindhe/unit"
+)
+
+// cgroupInfo stores the last value computed for the current cgroup.
+var cgroupInfo = new(value.ErrorValue) // of Info
+
+// cgroupEnabled is set once a cgroup module is created, so that cgroup files
+// are not read unless needed.
+var cgroupEnabled int32
+
+// Cgroup creates a new meminfo module that shows the memory usage and limits
+// of the cgroup (v2) that barista is running in, rather than the whole system.
+// This is useful in containers and resource-constrained systemd slices.
+//
+// The Info provided to the output function contains the following keys,
+// derived from the cgroup's usage and limits:
+//   - MemTotal: the cgroup's memory limit, or the system total if lower.
+//   - MemFree: the portion of MemTotal not used by the cgroup.
+//   - MemAvailable: MemFree plus reclaimable (inactive) page cache.
+//   - Cached: page cache charged to the cgroup.
+//   - SwapTotal, SwapFree: as above, if swap accounting is enabled.
+func Cgroup() *Module {
+	construct()
+	if atomic.CompareAndSwapInt32(&cgroupEnabled, 0, 1) {
+		l.Attach(nil, &cgroupInfo, "meminfo.cgroupInfo")
+		host, _ := currentInfo.Get()
+		info, _ := host.(Info)
+		updateCgroup(info)
+	}
+	m := New()
+	m.cgroup = true
+	l.Label(m, "cgroup")
+	return m
+}
+
+// updateCgroup computes the cgroup's memory info, using the system memory
+// info for limits that are not set.
+func updateCgroup(host Info) {
+	mem, err := cgroup.ReadMemory()
+	if cgroupInfo.Error(err) {
+		return
+	}
+	info := make(Info)
+	total := limit(host["MemTotal"], mem.Max)
+	info["MemTotal"] = total
+	info["MemFree"] = sub(total, byteSize(mem.Current))
+	info["MemAvailable"] = info["MemFree"] + byteSize(mem.Stat["inactive_file"])
+	if info["MemAvailable"] > total {
+		info["MemAvailable"] = total
+	}
+	info["Cached"] = byteSize(mem.Stat["file"])
+	if mem.SwapAccounting {
+		swapTotal := limit(host["SwapTotal"], mem.SwapMax)
+		info["SwapTotal"] = swapTotal
+		info["SwapFree"] = sub(swapTotal, byteSize(mem.SwapCurrent))
+	}
+	cgroupInfo.Set(info)
+}
+
+func byteSize(b uint64) unit.Datasize {
+	return unit.Datasize(b) * unit.Byte
+}
+
+// limit returns the lower of the system value and the cgroup limit.
+func limit(system unit.Datasize, max uint64) unit.Datasize {
+	if max == cgroup.Unlimited || (system > 0 && byteSize(max) > system) {
+		return system
+	}
+	return byteSize(max)
+}
+
+// sub returns a-b, or 0 if b > a.
+func sub(a, b unit.Datasize) unit.Datasize {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
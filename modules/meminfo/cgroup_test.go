@@ -0,0 +1,91 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meminfo
+
+import (
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/base/cgroup"
+	"barista.run/format"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/spf13/afero"
+)
+
+func TestCgroup(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	cgFs := afero.NewMemMapFs()
+	cgroup.SetFsForTest(cgFs)
+	defer cgroup.SetFsForTest(afero.NewOsFs())
+	writeCgroup := func(file, contents string) {
+		afero.WriteFile(cgFs, file, []byte(contents), 0644)
+	}
+	writeCgroup("/proc/self/cgroup", "0::/slice\n")
+	writeCgroup("/sys/fs/cgroup/slice/memory.current", "1048576\n")
+	writeCgroup("/sys/fs/cgroup/slice/memory.max", "2097152\n")
+	writeCgroup("/sys/fs/cgroup/slice/memory.stat", "file 786432\ninactive_file 524288\n")
+	shouldReturn(meminfo{
+		"MemAvailable": 2048,
+		"MemTotal":     4096,
+		"MemFree":      1024,
+		"SwapTotal":    1024,
+		"SwapFree":     1024,
+	})
+	testBar.New(t)
+	resetForTest()
+
+	host := New()
+	cg := Cgroup()
+	swap := Cgroup().Output(func(i Info) bar.Output {
+		if _, ok := i["SwapTotal"]; !ok {
+			return outputs.Text("no swap")
+		}
+		return outputs.Textf("%s/%s",
+			format.IBytesize(i["SwapFree"]), format.IBytesize(i["SwapTotal"]))
+	})
+	total := Cgroup().Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %s cached",
+			format.IBytesize(i["MemTotal"]), format.IBytesize(i["Cached"]))
+	})
+	testBar.Run(host, cg, swap, total)
+	testBar.LatestOutput(0, 1, 2, 3).AssertText([]string{
+		"Mem: 2.0 MiB", "Mem: 1.5 MiB", "no swap", "2.0 MiB 768 KiB cached",
+	}, "on start")
+
+	writeCgroup("/sys/fs/cgroup/slice/memory.max", "max\n")
+	writeCgroup("/sys/fs/cgroup/slice/memory.current", "3670016\n")
+	writeCgroup("/sys/fs/cgroup/slice/memory.swap.current", "262144\n")
+	testBar.Tick()
+	testBar.LatestOutput(1, 2, 3).AssertText([]string{
+		"Mem: 2.0 MiB", "Mem: 1.0 MiB", "768 KiB/1.0 MiB", "4.0 MiB 768 KiB cached",
+	}, "uses system values when unlimited")
+
+	writeCgroup("/sys/fs/cgroup/slice/memory.current", "8388608\n")
+	writeCgroup("/sys/fs/cgroup/slice/memory.swap.max", "131072\n")
+	testBar.Tick()
+	testBar.LatestOutput(1, 2).AssertText([]string{
+		"Mem: 2.0 MiB", "Mem: 512 KiB", "0 B/128 KiB", "4.0 MiB 768 KiB cached",
+	}, "usage over limits")
+
+	cgFs.Remove("/sys/fs/cgroup/slice/memory.current")
+	testBar.Tick()
+	out := testBar.LatestOutput(1, 2, 3)
+	out.At(0).AssertText("Mem: 2.0 MiB")
+	for i := 1; i < 4; i++ {
+		out.At(i).AssertError("cgroup error")
+	}
+}
@@ -20,10 +20,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"barista.run/bar"
 	"barista.run/base/value"
+	"barista.run/core"
 	"barista.run/format"
 	l "barista.run/logging"
 	"barista.run/outputs"
@@ -92,7 +94,8 @@ func RefreshInterval(interval time.Duration) {
 
 // Module represents a bar.Module that displays memory information.
 type Module struct {
-	outputFunc value.Value
+	cgroup     bool
+	outputFunc core.OutputFunc
 }
 
 func defaultOutput(i Info) bar.Output {
@@ -116,8 +119,12 @@ func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
 
 // Stream subscribes to meminfo and updates the module's output accordingly.
 func (m *Module) Stream(s bar.Sink) {
-	i, err := currentInfo.Get()
-	nextInfo, done := currentInfo.Subscribe()
+	source := currentInfo
+	if m.cgroup {
+		source = cgroupInfo
+	}
+	i, err := source.Get()
+	nextInfo, done := source.Subscribe()
 	defer done()
 	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
 	nextOutputFunc, done := m.outputFunc.Subscribe()
@@ -132,7 +139,7 @@ func (m *Module) Stream(s bar.Sink) {
 		case <-nextOutputFunc:
 			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
 		case <-nextInfo:
-			i, err = currentInfo.Get()
+			i, err = source.Get()
 		}
 	}
 }
@@ -168,4 +175,7 @@ func update() {
 		}
 	}
 	currentInfo.Set(info)
+	if atomic.LoadInt32(&cgroupEnabled) == 1 {
+		updateCgroup(info)
+	}
 }
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -44,6 +45,8 @@ func shouldReturn(info meminfo) {
 
 func resetForTest() {
 	currentInfo = &value.ErrorValue{}
+	cgroupInfo = &value.ErrorValue{}
+	atomic.StoreInt32(&cgroupEnabled, 0)
 	once = sync.Once{}
 	construct()
 	// Flush upates for test.
@@ -159,10 +162,14 @@ func TestErrors(t *testing.T) {
 	`), 0644)
 	testBar.Tick()
 	out := testBar.LatestOutput()
-	out.At(1).AssertError("non-numeric value")
-	out.At(2).AssertError("non-numeric value")
 	// MemAvailable is parsed, but total is 0.
 	out.At(0).AssertText("+Inf")
+	// Errors from output functions fall back to the default output, followed
+	// by an error marker.
+	out.At(1).AssertText("Mem: 1.0 MiB", "non-numeric value")
+	out.At(2).AssertError("non-numeric value")
+	out.At(3).AssertText("Mem: 1.0 MiB", "non-numeric value")
+	out.At(4).AssertError("non-numeric value")
 
 	afero.WriteFile(fs, "/proc/meminfo", []byte(`
 	MemAvailable: 1024 kB
@@ -0,0 +1,182 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package timeout provides a module that wraps a network-backed module, and
+restarts it if a refresh hangs, e.g. on a TCP connection that never completes.
+
+The wrapped module is expected to produce output at least once per timeout,
+so the timeout should be longer than its refresh interval plus the time a
+refresh usually takes:
+
+	timeout.New(weather.New(provider).RefreshInterval(10*time.Minute), 11*time.Minute)
+
+If the wrapped module does not produce output in time, its previous output
+is shown with a stale marker, and the module is restarted, with exponential
+backoff if it keeps timing out. Since modules cannot be interrupted, the
+timed out module is blocked the next time it produces output.
+*/
+package timeout // import "barista.run/modules/meta/timeout"
+
+import (
+	"fmt"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	l "barista.run/logging"
+	"barista.run/timing"
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// Module wraps a module with a timeout.
+type Module struct {
+	original  bar.Module
+	timeout   time.Duration
+	staleFunc value.Value // of func(bar.Segments, error) bar.Output
+	refreshFn func()
+	refreshCh <-chan struct{}
+}
+
+// New wraps a module, restarting it if it does not produce output for longer
+// than the given timeout.
+func New(original bar.Module, timeout time.Duration) *Module {
+	m := &Module{original: original, timeout: timeout}
+	m.refreshFn, m.refreshCh = notifier.New()
+	l.Label(m, l.ID(original))
+	l.Register(m, "staleFunc", "refreshCh")
+	m.Stale(DefaultStale)
+	return m
+}
+
+// DefaultStale shows the previous output, followed by a small error marker
+// that shows the timeout error when right-clicked.
+func DefaultStale(last bar.Segments, err error) bar.Output {
+	return append(append(bar.Segments{}, last...), bar.TextSegment("!").Error(err))
+}
+
+// Stale sets the output shown when the wrapped module times out, given the
+// previous output of the module, if any.
+func (m *Module) Stale(staleFunc func(bar.Segments, error) bar.Output) *Module {
+	m.staleFunc.Set(staleFunc)
+	return m
+}
+
+// Refresh refreshes the wrapped module if supported, and retries immediately
+// if the module is waiting to be restarted after a timeout.
+func (m *Module) Refresh() {
+	m.refreshFn()
+}
+
+// Stream starts the wrapped module.
+func (m *Module) Stream(s bar.Sink) {
+	sch := timing.NewScheduler()
+	l.Attach(m, sch, "~timeout")
+	defer sch.Stop()
+	backoff := minBackoff
+	var last bar.Segments
+	for {
+		finished, hadOutput := m.run(s, sch, &last)
+		if finished {
+			return
+		}
+		if hadOutput {
+			backoff = minBackoff
+		}
+		err := fmt.Errorf("no output for %v, retrying in %v", m.timeout, backoff)
+		l.Log("%s: %v", l.ID(m), err)
+		staleFunc := m.staleFunc.Get().(func(bar.Segments, error) bar.Output)
+		s.Output(staleFunc(last, err))
+		m.wait(sch, backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// run streams the wrapped module until it finishes, or times out. It returns
+// true if the module finished, and whether it produced any output.
+func (m *Module) run(s bar.Sink, sch *timing.Scheduler, last *bar.Segments) (finished, hadOutput bool) {
+	outputCh := make(chan bar.Output)
+	doneCh := make(chan struct{})
+	abandoned := make(chan struct{})
+	go func() {
+		m.original.Stream(func(o bar.Output) {
+			select {
+			case outputCh <- o:
+			case <-abandoned:
+				// Block the timed out module in case it was restarted.
+				select {}
+			}
+		})
+		close(doneCh)
+	}()
+
+	// Ticks may be pending from an earlier trigger, so the deadline is also
+	// checked on each tick.
+	deadline := timing.Now().Add(m.timeout)
+	sch.After(m.timeout)
+	for {
+		select {
+		case o := <-outputCh:
+			hadOutput = true
+			if o == nil {
+				*last = nil
+			} else {
+				*last = o.Segments()
+			}
+			s.Output(o)
+			deadline = timing.Now().Add(m.timeout)
+			sch.After(m.timeout)
+		case <-doneCh:
+			return true, hadOutput
+		case <-m.refreshCh:
+			if r, ok := m.original.(bar.RefresherModule); ok {
+				r.Refresh()
+			}
+			if d := timing.Now().Add(m.timeout); d.After(deadline) {
+				deadline = d
+				sch.After(m.timeout)
+			}
+		case <-sch.C:
+			if timing.Now().Before(deadline) {
+				continue
+			}
+			close(abandoned)
+			return false, hadOutput
+		}
+	}
+}
+
+// wait waits for the backoff delay to elapse, or until refreshed.
+func (m *Module) wait(sch *timing.Scheduler, delay time.Duration) {
+	retryAt := timing.Now().Add(delay)
+	sch.After(delay)
+	for {
+		select {
+		case <-m.refreshCh:
+			return
+		case <-sch.C:
+			if !timing.Now().Before(retryAt) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+// hangingModule is a module that is restarted on each stream, and only
+// outputs when told to, simulating a module with a hung refresh.
+type hangingModule struct {
+	sinks     chan bar.Sink
+	finish    chan struct{}
+	refreshed chan struct{}
+}
+
+func newHangingModule() *hangingModule {
+	return &hangingModule{
+		sinks:     make(chan bar.Sink, 10),
+		finish:    make(chan struct{}),
+		refreshed: make(chan struct{}, 10),
+	}
+}
+
+func (h *hangingModule) Stream(s bar.Sink) {
+	h.sinks <- s
+	<-h.finish
+}
+
+func (h *hangingModule) Refresh() {
+	h.refreshed <- struct{}{}
+}
+
+func (h *hangingModule) nextStream(t *testing.T, msg string) bar.Sink {
+	select {
+	case s := <-h.sinks:
+		return s
+	case <-time.After(time.Second):
+		require.Fail(t, "module not streamed", msg)
+	}
+	return nil
+}
+
+func (h *hangingModule) assertNotStreamed(t *testing.T, msg string) {
+	select {
+	case <-h.sinks:
+		require.Fail(t, "module streamed", msg)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	testBar.New(t)
+	h := newHangingModule()
+	m := New(h, time.Minute)
+	testBar.Run(m)
+
+	s := h.nextStream(t, "on start")
+	s.Output(outputs.Text("a"))
+	testBar.NextOutput("on output").AssertText([]string{"a"})
+
+	m.Refresh()
+	select {
+	case <-h.refreshed:
+	case <-time.After(time.Second):
+		require.Fail(t, "refresh not forwarded")
+	}
+
+	testBar.Tick()
+	out := testBar.NextOutput("on timeout")
+	out.At(0).AssertText("a", "previous output")
+	require.Contains(t, out.At(1).AssertError(), "retrying in 1s")
+	h.assertNotStreamed(t, "until backoff")
+
+	testBar.Tick()
+	old := s
+	s = h.nextStream(t, "on retry")
+	go old.Output(outputs.Text("late"))
+	testBar.AssertNoOutput("from timed out module")
+
+	s.Output(outputs.Text("b"))
+	testBar.NextOutput("on output").AssertText([]string{"b"})
+	testBar.Tick()
+	out = testBar.NextOutput("on timeout")
+	require.Contains(t, out.At(1).AssertError(), "retrying in 1s",
+		"backoff reset after successful output")
+
+	testBar.Tick()
+	h.nextStream(t, "on retry")
+	testBar.Tick()
+	out = testBar.NextOutput("on timeout")
+	out.At(0).AssertText("b", "last output from any attempt")
+	require.Contains(t, out.At(1).AssertError(), "retrying in 2s")
+
+	m.Refresh()
+	s = h.nextStream(t, "on refresh during backoff")
+	s.Output(nil)
+	testBar.NextOutput("on empty output").AssertEmpty()
+
+	m.Stale(func(last bar.Segments, err error) bar.Output {
+		return outputs.Textf("stale (%d)", len(last))
+	})
+	testBar.Tick()
+	testBar.NextOutput("on timeout").AssertText([]string{"stale (0)"})
+
+	testBar.Tick()
+	h.nextStream(t, "on retry")
+	close(h.finish)
+	testBar.NextOutput("with restart handlers when module finishes").
+		AssertText([]string{"stale (0)"})
+	testBar.Tick()
+	h.assertNotStreamed(t, "after module finishes")
+}
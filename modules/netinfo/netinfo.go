@@ -16,9 +16,12 @@
 package netinfo // import "barista.run/modules/netinfo"
 
 import (
+	"net"
+	"sort"
+
 	"barista.run/bar"
-	"barista.run/base/value"
 	"barista.run/base/watchers/netlink"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 )
@@ -43,10 +46,156 @@ func (s State) Enabled() bool {
 	return s.State > netlink.NotPresent
 }
 
+// Scope represents the range over which an address is reachable.
+type Scope int
+
+// Address scopes, from narrowest to widest.
+const (
+	// ScopeHost is for addresses only reachable from this machine (loopback).
+	ScopeHost Scope = iota
+	// ScopeLink is for addresses only reachable on the local link, e.g. fe80::/10.
+	ScopeLink
+	// ScopeSite is for private addresses, e.g. 192.168.0.0/16 or fd00::/8.
+	ScopeSite
+	// ScopeGlobal is for publicly routable addresses.
+	ScopeGlobal
+)
+
+var privateNets = []*net.IPNet{
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("100.64.0.0/10"), // Carrier-grade NAT.
+	mustParseCIDR("fc00::/7"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// ScopeOf returns the scope of the given IP address.
+func ScopeOf(ip net.IP) Scope {
+	switch {
+	case ip.IsLoopback(), ip.IsUnspecified():
+		return ScopeHost
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast(),
+		ip.IsInterfaceLocalMulticast():
+		return ScopeLink
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return ScopeSite
+		}
+	}
+	return ScopeGlobal
+}
+
+// AddrsInScope returns the addresses of the interface with any of the given
+// scopes (or all addresses if no scopes are given), in order of preference.
+//
+// Addresses with a wider scope are preferred, followed by addresses that are
+// not deprecated, followed by IPv4 over IPv6, and finally temporary (privacy
+// extension) IPv6 addresses over stable ones, since those are used for
+// outgoing connections.
+func (s State) AddrsInScope(scopes ...Scope) []netlink.Addr {
+	var addrs []netlink.Addr
+	for _, a := range s.Addrs {
+		if matchesScope(a, scopes) {
+			addrs = append(addrs, a)
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return preferred(addrs[i], addrs[j])
+	})
+	return addrs
+}
+
+func matchesScope(a netlink.Addr, scopes []Scope) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	scope := ScopeOf(a.IP)
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// preferred returns true if a should be preferred over b.
+func preferred(a, b netlink.Addr) bool {
+	if sa, sb := ScopeOf(a.IP), ScopeOf(b.IP); sa != sb {
+		return sa > sb
+	}
+	if a.Deprecated != b.Deprecated {
+		return b.Deprecated
+	}
+	if a4, b4 := isIPv4(a), isIPv4(b); a4 != b4 {
+		return a4
+	}
+	return a.Temporary && !b.Temporary
+}
+
+func isIPv4(a netlink.Addr) bool {
+	return a.IP.To4() != nil
+}
+
+// IPv4Addrs returns the IPv4 addresses of the interface, in order of
+// preference. See AddrsInScope for the preference rules.
+func (s State) IPv4Addrs() []netlink.Addr {
+	return s.filter(isIPv4)
+}
+
+// IPv6Addrs returns the IPv6 addresses of the interface, in order of
+// preference. See AddrsInScope for the preference rules.
+func (s State) IPv6Addrs() []netlink.Addr {
+	return s.filter(func(a netlink.Addr) bool { return !isIPv4(a) })
+}
+
+func (s State) filter(keep func(netlink.Addr) bool) []netlink.Addr {
+	var addrs []netlink.Addr
+	for _, a := range s.AddrsInScope() {
+		if keep(a) {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// PreferredAddr returns the most meaningful address of the interface to
+// display, or an empty address if the interface has no addresses.
+func (s State) PreferredAddr() netlink.Addr {
+	return first(s.AddrsInScope())
+}
+
+// PreferredIPv4 returns the preferred IPv4 address of the interface,
+// or an empty address if the interface has no IPv4 addresses.
+func (s State) PreferredIPv4() netlink.Addr {
+	return first(s.IPv4Addrs())
+}
+
+// PreferredIPv6 returns the preferred IPv6 address of the interface,
+// or an empty address if the interface has no IPv6 addresses.
+func (s State) PreferredIPv6() netlink.Addr {
+	return first(s.IPv6Addrs())
+}
+
+func first(addrs []netlink.Addr) netlink.Addr {
+	if len(addrs) == 0 {
+		return netlink.Addr{}
+	}
+	return addrs[0]
+}
+
 // Module represents a netinfo bar module.
 type Module struct {
 	subscriber func() *netlink.Subscription
-	outputFunc value.Value // of func(State) bar.Output
+	outputFunc core.OutputFunc // of func(State) bar.Output
 }
 
 // netWithSubscriber constructs a netinfo module using the given
@@ -91,6 +240,14 @@ func Prefix(prefix string) *Module {
 	return m
 }
 
+// Auto constructs an instance of the netinfo module that follows the
+// interface carrying the default route.
+func Auto() *Module {
+	m := newWithSubscriber(netlink.DefaultRoute)
+	l.Label(m, "auto")
+	return m
+}
+
 // Output configures a module to display the output of a user-defined function.
 func (m *Module) Output(outputFunc func(State) bar.Output) *Module {
 	m.outputFunc.Set(outputFunc)
@@ -15,12 +15,15 @@
 package netinfo
 
 import (
+	"net"
 	"testing"
 
 	"barista.run/bar"
 	"barista.run/base/watchers/netlink"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestNetinfo(t *testing.T) {
@@ -75,3 +78,135 @@ func TestNetinfo(t *testing.T) {
 	})
 	testBar.NextOutput().AssertText([]string{"6", "W:down", "E:eth1", "eth1"})
 }
+
+func TestAuto(t *testing.T) {
+	nlt := netlink.TestMode()
+	eth0 := nlt.AddLink(netlink.Link{Name: "eth0", State: netlink.Up})
+	wlan0 := nlt.AddLink(netlink.Link{Name: "wlan0", State: netlink.Up})
+	wg0 := nlt.AddLink(netlink.Link{Name: "wg0", State: netlink.Unknown})
+	nlt.AddDefaultRoute(wlan0, 600)
+
+	testBar.New(t)
+	testBar.Run(Auto().Output(func(s State) bar.Output {
+		if s.State == netlink.Gone {
+			return outputs.Text("offline")
+		}
+		return outputs.Text(s.Name)
+	}))
+	testBar.NextOutput().AssertText([]string{"wlan0"}, "on start")
+
+	nlt.AddDefaultRoute(eth0, 100)
+	testBar.NextOutput().AssertText([]string{"eth0"}, "lower metric")
+
+	nlt.AddDefaultRoute(wg0, 50)
+	testBar.NextOutput().AssertText([]string{"wg0"}, "on vpn connection")
+
+	nlt.RemoveLink(wg0)
+	testBar.NextOutput().AssertText([]string{"eth0"}, "on vpn removal")
+
+	nlt.UpdateLink(wlan0, netlink.Link{State: netlink.Down})
+	testBar.AssertNoOutput("on change to other link")
+
+	nlt.RemoveDefaultRoute(eth0, 100)
+	testBar.NextOutput().AssertText([]string{"wlan0"})
+
+	nlt.RemoveDefaultRoute(wlan0, 600)
+	testBar.NextOutput().AssertText([]string{"offline"}, "without default route")
+}
+
+func addr(cidr string, temporary, deprecated bool) netlink.Addr {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return netlink.Addr{
+		IPNet:      net.IPNet{IP: ip, Mask: ipNet.Mask},
+		Temporary:  temporary,
+		Deprecated: deprecated,
+	}
+}
+
+func addrStrings(addrs []netlink.Addr) []string {
+	var strs []string
+	for _, a := range addrs {
+		strs = append(strs, a.String())
+	}
+	return strs
+}
+
+func TestScopeOf(t *testing.T) {
+	for ip, scope := range map[string]Scope{
+		"127.0.0.1":    ScopeHost,
+		"::1":          ScopeHost,
+		"0.0.0.0":      ScopeHost,
+		"169.254.1.1":  ScopeLink,
+		"fe80::1":      ScopeLink,
+		"10.1.2.3":     ScopeSite,
+		"172.20.0.1":   ScopeSite,
+		"192.168.1.1":  ScopeSite,
+		"100.64.0.1":   ScopeSite,
+		"fd12:3456::1": ScopeSite,
+		"8.8.8.8":      ScopeGlobal,
+		"172.32.0.1":   ScopeGlobal,
+		"2001:db8::1":  ScopeGlobal,
+		"2a00:1450::1": ScopeGlobal,
+	} {
+		require.Equal(t, scope, ScopeOf(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestAddrs(t *testing.T) {
+	nlt := netlink.TestMode()
+	eth0 := nlt.AddLink(netlink.Link{Name: "eth0", State: netlink.Up})
+	for _, a := range []netlink.Addr{
+		addr("fe80::1234/64", false, false),
+		addr("192.168.1.10/24", false, false),
+		addr("2001:db8::1/64", false, false),
+		addr("2001:db8::abcd/64", true, true),
+		addr("2001:db8::beef/64", true, false),
+	} {
+		nlt.AddAddr(eth0, a)
+	}
+
+	testBar.New(t)
+	n := Interface("eth0").Output(func(s State) bar.Output {
+		return outputs.Textf("%v", s.PreferredAddr())
+	})
+	testBar.Run(n)
+	testBar.LatestOutput().AssertText([]string{"2001:db8::beef/64"},
+		"prefers global temporary address")
+
+	n.Output(func(s State) bar.Output {
+		return outputs.Textf("%v %v", s.PreferredIPv4(), s.PreferredIPv4().PrefixLen())
+	})
+	testBar.NextOutput().AssertText([]string{"192.168.1.10/24 24"})
+
+	nlt.AddAddr(eth0, addr("203.0.113.5/32", false, false))
+	testBar.NextOutput().AssertText([]string{"203.0.113.5/32 32"})
+
+	var state State
+	n.Output(func(s State) bar.Output {
+		state = s
+		return outputs.Text(s.PreferredIPv6().String())
+	})
+	testBar.NextOutput().AssertText([]string{"2001:db8::beef/64"})
+
+	require.Equal(t, []string{
+		"203.0.113.5/32",
+		"2001:db8::beef/64",
+		"2001:db8::1/64",
+		"2001:db8::abcd/64",
+		"192.168.1.10/24",
+		"fe80::1234/64",
+	}, addrStrings(state.AddrsInScope()), "all addresses in order of preference")
+	require.Equal(t, []string{"192.168.1.10/24", "fe80::1234/64"},
+		addrStrings(state.AddrsInScope(ScopeLink, ScopeSite)), "scope filtered")
+	require.Equal(t, []string{"203.0.113.5/32", "192.168.1.10/24"},
+		addrStrings(state.IPv4Addrs()))
+	require.Equal(t, []string{
+		"2001:db8::beef/64", "2001:db8::1/64", "2001:db8::abcd/64", "fe80::1234/64",
+	}, addrStrings(state.IPv6Addrs()))
+
+	require.Nil(t, State{}.PreferredAddr().IP, "no addresses")
+	require.Empty(t, State{}.IPv6Addrs())
+}
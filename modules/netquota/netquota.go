@@ -0,0 +1,382 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package netquota provides an i3bar module that tracks data usage on metered
+connections (e.g. LTE modems or phone tethering) against a monthly cap.
+
+Traffic on the matching interfaces is accumulated into daily totals, which
+are persisted in $XDG_STATE_HOME/barista/netquota, so that usage is retained
+across restarts of the bar and reboots. The usage for the current billing
+period is the sum of the daily totals since the configured reset day.
+*/
+package netquota // import "barista.run/modules/netquota"
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/procstat"
+	"barista.run/base/value"
+	"barista.run/core"
+	"barista.run/format"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+)
+
+// Usage represents the data transferred over a period.
+type Usage struct {
+	Rx, Tx unit.Datasize
+}
+
+// Total returns the data transferred in both directions.
+func (u Usage) Total() unit.Datasize {
+	return u.Rx + u.Tx
+}
+
+// Info represents the data usage on the tracked interfaces.
+type Info struct {
+	// Today is the usage since midnight.
+	Today Usage
+	// Period is the usage in the current billing period.
+	Period Usage
+	// PeriodStart and PeriodEnd are the bounds of the current billing period.
+	PeriodStart, PeriodEnd time.Time
+	// Cap is the data allowance for each billing period, or 0 if not set.
+	Cap unit.Datasize
+
+	now time.Time
+}
+
+// Remaining returns the data remaining in the current billing period.
+func (i Info) Remaining() unit.Datasize {
+	if r := i.Cap - i.Period.Total(); r > 0 {
+		return r
+	}
+	return 0
+}
+
+// UsedFrac returns the fraction of the cap used in the current billing period,
+// which may be more than 1 if the cap has been exceeded.
+func (i Info) UsedFrac() float64 {
+	if i.Cap <= 0 {
+		return 0
+	}
+	return float64(i.Period.Total()) / float64(i.Cap)
+}
+
+// UsedPct returns the percentage of the cap used in the current billing period.
+func (i Info) UsedPct() int {
+	return int(i.UsedFrac()*100 + 0.5)
+}
+
+// OverCap returns true if the cap has been exceeded.
+func (i Info) OverCap() bool {
+	return i.Cap > 0 && i.Period.Total() > i.Cap
+}
+
+// Projected returns the expected usage at the end of the billing period, if
+// data continues to be used at the same average rate as so far.
+func (i Info) Projected() unit.Datasize {
+	elapsed := i.now.Sub(i.PeriodStart)
+	if elapsed <= 0 {
+		return i.Period.Total()
+	}
+	total := i.PeriodEnd.Sub(i.PeriodStart)
+	return unit.Datasize(float64(i.Period.Total()) * float64(total) / float64(elapsed))
+}
+
+// Module represents a netquota bar module.
+type Module struct {
+	patterns   []string
+	file       string
+	scheduler  *timing.Scheduler
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	cap        value.Value     // of unit.Datasize
+	resetDay   value.Value     // of int
+}
+
+// New constructs a netquota module that tracks the total traffic on all
+// interfaces matching any of the given shell patterns, e.g. New("wwan*",
+// "usb0"). Modules with the same patterns share their persisted totals.
+func New(patterns ...string) *Module {
+	m := &Module{
+		patterns:  patterns,
+		file:      url.PathEscape(strings.Join(patterns, ",")) + ".json",
+		scheduler: timing.NewScheduler(),
+	}
+	l.Label(m, strings.Join(patterns, ","))
+	l.Register(m, "scheduler", "outputFunc", "cap", "resetDay")
+	m.RefreshInterval(10 * time.Second)
+	m.cap.Set(unit.Datasize(0))
+	m.resetDay.Set(1)
+	m.Output(func(i Info) bar.Output {
+		if i.Cap <= 0 {
+			return outputs.Textf("%s", format.IBytesize(i.Period.Total()))
+		}
+		out := outputs.Textf("%s/%s",
+			format.IBytesize(i.Period.Total()), format.IBytesize(i.Cap))
+		if i.OverCap() {
+			out.Urgent(true)
+		}
+		return out
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency for traffic counters.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Cap sets the data allowance for each billing period.
+func (m *Module) Cap(cap unit.Datasize) *Module {
+	m.cap.Set(cap)
+	return m
+}
+
+// ResetDay sets the day of the month on which the billing period starts.
+// Days past the end of a shorter month reset on the last day of that month.
+// Defaults to the 1st.
+func (m *Module) ResetDay(day int) *Module {
+	if day < 1 {
+		day = 1
+	}
+	m.resetDay.Set(day)
+	return m
+}
+
+// counters are byte counts, either raw interface counters or daily totals.
+type counters struct {
+	Rx, Tx uint64
+}
+
+func (c counters) add(o counters) counters {
+	return counters{c.Rx + o.Rx, c.Tx + o.Tx}
+}
+
+func (c counters) usage() Usage {
+	return Usage{
+		Rx: unit.Datasize(c.Rx) * unit.Byte,
+		Tx: unit.Datasize(c.Tx) * unit.Byte,
+	}
+}
+
+// state is persisted between runs of the bar.
+type state struct {
+	// Days holds the bytes transferred on each day, keyed by date
+	// (YYYY-MM-DD).
+	Days map[string]counters
+	// BootID identifies the boot for which Counters were recorded. Counters
+	// are only meaningful within a single boot, since they start from 0.
+	BootID   string
+	Counters map[string]counters
+}
+
+// Days older than this are dropped from the state, since they cannot be part
+// of the current billing period.
+const keepDays = 62
+
+// Overridden in tests.
+var (
+	fs       = afero.NewOsFs()
+	stateDir = getStateDir()
+	netDev   = func() (map[string]procstat.NetDev, error) {
+		s, err := procstat.NetDevFile.Read()
+		return s.NetDev(), err
+	}
+	bootID = func() string {
+		id, _ := afero.ReadFile(fs, "/proc/sys/kernel/random/boot_id")
+		return strings.TrimSpace(string(id))
+	}
+)
+
+func getStateDir() string {
+	stateRoot := os.ExpandEnv("$HOME/.local/state")
+	if xdgState, ok := os.LookupEnv("XDG_STATE_HOME"); ok {
+		stateRoot = xdgState
+	}
+	return filepath.Join(stateRoot, "barista", "netquota")
+}
+
+// Stream starts the module.
+func (m *Module) Stream(s bar.Sink) {
+	st := m.load()
+	boot := bootID()
+	if st.BootID != boot {
+		// Counters restarted from 0 on boot, so all traffic since then
+		// counts towards the current day.
+		st.BootID = boot
+		st.Counters = nil
+	}
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextCap, done := m.cap.Subscribe()
+	defer done()
+	nextResetDay, done := m.resetDay.Subscribe()
+	defer done()
+	err := m.update(&st)
+	for {
+		if s.Error(err) {
+			return
+		}
+		s.Output(outputFunc(m.info(st, timing.Now())))
+		select {
+		case <-m.scheduler.C:
+			err = m.update(&st)
+		case <-nextCap:
+		case <-nextResetDay:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// update reads the interface counters, adds any traffic since the last read
+// to the current day, and persists the state if it changed.
+func (m *Module) update(st *state) error {
+	devs, err := netDev()
+	if err != nil {
+		return err
+	}
+	var delta counters
+	seen := map[string]counters{}
+	for name, dev := range devs {
+		if !m.matches(name) {
+			continue
+		}
+		cur := counters{dev.RxBytes, dev.TxBytes}
+		prev := st.Counters[name]
+		if cur.Rx < prev.Rx || cur.Tx < prev.Tx {
+			// The counters were reset, e.g. by a modem being reconnected.
+			prev = counters{}
+		}
+		delta.Rx += cur.Rx - prev.Rx
+		delta.Tx += cur.Tx - prev.Tx
+		seen[name] = cur
+	}
+	// Interfaces that disappear will start from 0 if they come back.
+	st.Counters = seen
+	if delta.Rx+delta.Tx == 0 {
+		return nil
+	}
+	today := timing.Now().Format("2006-01-02")
+	if st.Days == nil {
+		st.Days = map[string]counters{}
+	}
+	st.Days[today] = st.Days[today].add(delta)
+	cutoff := timing.Now().AddDate(0, 0, -keepDays).Format("2006-01-02")
+	for day := range st.Days {
+		if day < cutoff {
+			delete(st.Days, day)
+		}
+	}
+	m.save(*st)
+	return nil
+}
+
+func (m *Module) matches(iface string) bool {
+	for _, p := range m.patterns {
+		if ok, _ := filepath.Match(p, iface); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// info computes the usage for today and the current billing period.
+func (m *Module) info(st state, now time.Time) Info {
+	day := m.resetDay.Get().(int)
+	start := periodStart(now, day)
+	y, mon := start.Year(), start.Month()+1
+	i := Info{
+		PeriodStart: start,
+		PeriodEnd:   time.Date(y, mon, clampDay(y, mon, day), 0, 0, 0, 0, now.Location()),
+		Cap:         m.cap.Get().(unit.Datasize),
+		now:         now,
+	}
+	today := now.Format("2006-01-02")
+	from := start.Format("2006-01-02")
+	var period counters
+	for day, c := range st.Days {
+		if day == today {
+			i.Today = c.usage()
+		}
+		if day >= from && day <= today {
+			period = period.add(c)
+		}
+	}
+	i.Period = period.usage()
+	return i
+}
+
+// periodStart returns the start of the billing period containing now, for
+// periods that reset on the given day of each month.
+func periodStart(now time.Time, day int) time.Time {
+	y, mon, d := now.Date()
+	if d < clampDay(y, mon, day) {
+		mon--
+	}
+	return time.Date(y, mon, clampDay(y, mon, day), 0, 0, 0, 0, now.Location())
+}
+
+// clampDay returns day, or the last day of the month if it has fewer days.
+func clampDay(y int, mon time.Month, day int) int {
+	// Day 0 of the next month is the last day of this month.
+	if last := time.Date(y, mon+1, 0, 0, 0, 0, 0, time.UTC).Day(); day > last {
+		return last
+	}
+	return day
+}
+
+func (m *Module) load() state {
+	var st state
+	bytes, err := afero.ReadFile(fs, filepath.Join(stateDir, m.file))
+	if err != nil {
+		return st
+	}
+	if err := json.Unmarshal(bytes, &st); err != nil {
+		l.Log("Ignoring bad netquota state: %v", err)
+		return state{}
+	}
+	return st
+}
+
+func (m *Module) save(st state) {
+	bytes, _ := json.Marshal(st)
+	err := fs.MkdirAll(stateDir, 0700)
+	if err == nil {
+		err = afero.WriteFile(fs, filepath.Join(stateDir, m.file), bytes, 0600)
+	}
+	if err != nil {
+		l.Log("Failed to save netquota state: %v", err)
+	}
+}
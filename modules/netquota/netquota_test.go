@@ -0,0 +1,262 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netquota
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/procstat"
+	"barista.run/format"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	devs   = map[string]procstat.NetDev{}
+	devsMu sync.Mutex
+	boot   = "boot-1"
+)
+
+func setDev(name string, rx, tx uint64) {
+	devsMu.Lock()
+	defer devsMu.Unlock()
+	devs[name] = procstat.NetDev{RxBytes: rx, TxBytes: tx}
+}
+
+func removeDev(name string) {
+	devsMu.Lock()
+	defer devsMu.Unlock()
+	delete(devs, name)
+}
+
+func setBoot(id string) {
+	devsMu.Lock()
+	defer devsMu.Unlock()
+	boot = id
+}
+
+func init() {
+	stateDir = "/state/netquota"
+	netDev = func() (map[string]procstat.NetDev, error) {
+		devsMu.Lock()
+		defer devsMu.Unlock()
+		r := map[string]procstat.NetDev{}
+		for k, v := range devs {
+			r[k] = v
+		}
+		return r, nil
+	}
+	bootID = func() string {
+		devsMu.Lock()
+		defer devsMu.Unlock()
+		return boot
+	}
+}
+
+func reset() {
+	fs = afero.NewMemMapFs()
+	devsMu.Lock()
+	devs = map[string]procstat.NetDev{}
+	boot = "boot-1"
+	devsMu.Unlock()
+}
+
+const mb = 1000 * 1000
+
+func usageOutput(i Info) bar.Output {
+	return outputs.Textf("%.0f/%.0f %s-%s",
+		i.Today.Total().Megabytes(), i.Period.Total().Megabytes(),
+		i.PeriodStart.Format("01/02"), i.PeriodEnd.Format("01/02"))
+}
+
+func TestNetquota(t *testing.T) {
+	reset()
+	testBar.New(t)
+	setDev("wwan0", 1*mb, 0)
+	setDev("eth0", 100*mb, 100*mb)
+
+	m := New("wwan*", "usb0").ResetDay(20).RefreshInterval(time.Hour).Output(usageOutput)
+	testBar.Run(m)
+	testBar.NextOutput().AssertText([]string{"1/1 11/20-12/20"},
+		"traffic since boot counted on start")
+
+	setDev("wwan0", 2*mb, 1*mb)
+	setDev("eth0", 200*mb, 200*mb)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"3/3 11/20-12/20"},
+		"only matching interfaces counted")
+
+	for i := 0; i < 2; i++ {
+		testBar.Tick()
+		testBar.NextOutput().AssertText([]string{"3/3 11/20-12/20"},
+			"without traffic")
+	}
+	setDev("usb0", 2*mb, 0)
+	testBar.Tick()
+	require.Equal(t, 26, timing.Now().Day())
+	testBar.NextOutput().AssertText([]string{"2/5 11/20-12/20"},
+		"new day, multiple interfaces")
+
+	setDev("wwan0", 1*mb, 0)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"3/6 11/20-12/20"},
+		"counter reset")
+
+	removeDev("usb0")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"3/6 11/20-12/20"},
+		"interface removed")
+	setDev("usb0", 3*mb, 0)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"6/9 11/20-12/20"},
+		"interface added again")
+
+	m.ResetDay(26)
+	testBar.NextOutput().AssertText([]string{"6/6 11/26-12/26"},
+		"on reset day change")
+}
+
+func TestPersistence(t *testing.T) {
+	reset()
+	testBar.New(t)
+	setDev("wwan0", 5*mb, 5*mb)
+	testBar.Run(New("wwan0").Output(usageOutput))
+	testBar.NextOutput().AssertText([]string{"10/10 11/01-12/01"})
+
+	setDev("wwan0", 8*mb, 7*mb)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"15/15 11/01-12/01"})
+
+	testBar.New(t)
+	setDev("wwan0", 10*mb, 7*mb)
+	testBar.Run(New("wwan0").Output(usageOutput))
+	testBar.NextOutput().AssertText([]string{"17/17 11/01-12/01"},
+		"restart in same boot")
+
+	testBar.New(t)
+	setBoot("boot-2")
+	setDev("wwan0", 1*mb, 0)
+	m := New("wwan0").Output(usageOutput)
+	testBar.Run(m)
+	testBar.NextOutput().AssertText([]string{"18/18 11/01-12/01"},
+		"after reboot")
+
+	testBar.New(t)
+	testBar.Run(New("wwan1").Output(usageOutput))
+	testBar.NextOutput().AssertText([]string{"0/0 11/01-12/01"},
+		"separate state for different interfaces")
+
+	afero.WriteFile(fs, "/state/netquota/wwan0.json", []byte("{bad"), 0600)
+	testBar.New(t)
+	testBar.Run(New("wwan0").Output(usageOutput))
+	testBar.NextOutput().AssertText([]string{"1/1 11/01-12/01"},
+		"bad state ignored")
+}
+
+func TestOldDays(t *testing.T) {
+	reset()
+	testBar.New(t)
+	afero.WriteFile(fs, "/state/netquota/wwan0.json", []byte(`{"Days": {
+		"2016-08-01": {"Rx": 1000000000},
+		"2016-10-31": {"Rx": 1000000},
+		"2016-11-01": {"Rx": 1000000, "Tx": 1000000},
+		"2016-11-25": {"Tx": 2000000}
+	}, "BootID": "boot-1"}`), 0600)
+	setDev("wwan0", 1*mb, 0)
+	testBar.Run(New("wwan0").Output(usageOutput))
+	testBar.NextOutput().AssertText([]string{"3/5 11/01-12/01"})
+
+	st := New("wwan0").load()
+	require.Equal(t, 3, len(st.Days), "old days removed on save")
+}
+
+func TestDefaultOutput(t *testing.T) {
+	reset()
+	testBar.New(t)
+	setDev("wwan0", 600*mb, 0)
+	m := New("wwan0")
+	testBar.Run(m)
+	testBar.NextOutput().AssertText([]string{format.IBytesize(600 * mb * unit.Byte)})
+
+	m.Cap(unit.Gigabyte)
+	out := testBar.NextOutput()
+	out.AssertText([]string{fmt.Sprintf("%s/%s",
+		format.IBytesize(600*mb*unit.Byte), format.IBytesize(unit.Gigabyte))})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	setDev("wwan0", 1200*mb, 0)
+	testBar.Tick()
+	out = testBar.NextOutput()
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "over cap")
+}
+
+func TestPeriodStart(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		now      time.Time
+		day      int
+		expected time.Time
+	}{
+		{date(2020, time.March, 15), 1, date(2020, time.March, 1)},
+		{date(2020, time.March, 15), 15, date(2020, time.March, 15)},
+		{date(2020, time.March, 15), 16, date(2020, time.February, 16)},
+		{date(2020, time.January, 5), 10, date(2019, time.December, 10)},
+		{date(2020, time.March, 15), 31, date(2020, time.February, 29)},
+		{date(2021, time.February, 28), 31, date(2021, time.February, 28)},
+		{date(2021, time.February, 27), 31, date(2021, time.January, 31)},
+	} {
+		require.Equal(t, tc.expected, periodStart(tc.now.Add(time.Hour), tc.day),
+			"%v on day %d", tc.now, tc.day)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	i := Info{
+		Period:      Usage{Rx: 3 * unit.Gigabyte, Tx: unit.Gigabyte},
+		PeriodStart: time.Date(2020, time.April, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2020, time.May, 1, 0, 0, 0, 0, time.UTC),
+		now:         time.Date(2020, time.April, 11, 0, 0, 0, 0, time.UTC),
+	}
+	require.Equal(t, 0, i.UsedPct(), "without cap")
+	require.False(t, i.OverCap(), "without cap")
+	require.InDelta(t, 12.0, i.Projected().Gigabytes(), 0.001)
+
+	i.Cap = 10 * unit.Gigabyte
+	require.Equal(t, 40, i.UsedPct())
+	require.InDelta(t, 6.0, i.Remaining().Gigabytes(), 0.001)
+	require.False(t, i.OverCap())
+
+	i.Period.Rx = 12 * unit.Gigabyte
+	require.Equal(t, 130, i.UsedPct())
+	require.Equal(t, unit.Datasize(0), i.Remaining())
+	require.True(t, i.OverCap())
+
+	i.now = i.PeriodStart
+	require.InDelta(t, 13.0, i.Projected().Gigabytes(), 0.001,
+		"at start of period")
+}
@@ -16,22 +16,27 @@
 package netspeed // import "barista.run/modules/netspeed"
 
 import (
+	"fmt"
+	"sync/atomic"
 	"time"
 
 	"barista.run/bar"
-	"barista.run/base/value"
+	"barista.run/base/procstat"
+	"barista.run/base/watchers/netlink"
+	"barista.run/core"
 	"barista.run/format"
 	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
 
 	"github.com/martinlindhe/unit"
-	"github.com/vishvananda/netlink"
 )
 
 // Speeds represents bidirectional network traffic.
 type Speeds struct {
 	Rx, Tx unit.Datarate
+	// Interface for which the speeds were measured.
+	Interface string
 	// Keep track of whether these speeds are actually 0
 	// or uninitialised.
 	available bool
@@ -46,8 +51,10 @@ func (s Speeds) Total() unit.Datarate {
 // format, click handler, and update frequency.
 type Module struct {
 	iface      string
+	auto       bool
 	scheduler  *timing.Scheduler
-	outputFunc value.Value // of func(Speeds) bar.Output
+	ownReads   int32           // atomic bool, set by RefreshInterval.
+	outputFunc core.OutputFunc // of func(Speeds) bar.Output
 }
 
 // New constructs an instance of the netspeed module for the given interface.
@@ -58,7 +65,6 @@ func New(iface string) *Module {
 	}
 	l.Label(m, iface)
 	l.Register(m, "scheduler", "outputFunc")
-	m.RefreshInterval(3 * time.Second)
 	// Default output is just the up and down speeds in SI.
 	m.Output(func(s Speeds) bar.Output {
 		return outputs.Textf("%s up | %s down",
@@ -67,6 +73,17 @@ func New(iface string) *Module {
 	return m
 }
 
+// Auto constructs an instance of the netspeed module that follows the
+// interface carrying the default route. Speeds are measured afresh whenever
+// the default route moves to a different interface, and no output is shown
+// while there is no default route.
+func Auto() *Module {
+	m := New("")
+	m.auto = true
+	l.Label(m, "auto")
+	return m
+}
+
 // Output configures a module to display the output of a user-defined function.
 func (m *Module) Output(outputFunc func(Speeds) bar.Output) *Module {
 	m.outputFunc.Set(outputFunc)
@@ -76,23 +93,62 @@ func (m *Module) Output(outputFunc func(Speeds) bar.Output) *Module {
 // RefreshInterval configures the polling frequency for network speed.
 // Since there is no concept of an instantaneous network speed, the speeds will
 // be averaged over this interval before being displayed.
+//
+// By default, speeds are updated from the shared /proc/net/dev sample, at the
+// interval set using procstat.RefreshInterval. Setting an interval here makes
+// the module read /proc/net/dev on its own schedule instead.
 func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	atomic.StoreInt32(&m.ownReads, 1)
 	m.scheduler.Every(interval)
 	return m
 }
 
 // For tests.
-var linkByName = netlink.LinkByName
+var netDev = func() (map[string]procstat.NetDev, error) {
+	s, err := procstat.NetDevFile.Read()
+	return s.NetDev(), err
+}
+
+// reader returns interface statistics and the time they were read at.
+type reader func() (map[string]procstat.NetDev, time.Time, error)
+
+func ownNetDev() (map[string]procstat.NetDev, time.Time, error) {
+	devs, err := netDev()
+	return devs, timing.Now(), err
+}
+
+func sharedNetDev() (map[string]procstat.NetDev, time.Time, error) {
+	s, err := procstat.NetDevFile.Get()
+	return s.NetDev(), s.Time, err
+}
+
+// readNetDev returns the reader to use, and a channel that signals the next
+// shared sample if the module uses the shared sampler.
+func (m *Module) readNetDev() (reader, <-chan struct{}) {
+	if atomic.LoadInt32(&m.ownReads) == 1 {
+		return ownNetDev, nil
+	}
+	return sharedNetDev, procstat.NetDevFile.Next()
+}
 
 // Stream starts the module.
 func (m *Module) Stream(s bar.Sink) {
-	lastRead := timing.Now()
-	lastRx, lastTx, err := linkRxTx(m.iface)
+	iface := m.iface
+	var sub *netlink.Subscription
+	var ifaceChanged <-chan struct{}
+	if m.auto {
+		sub = netlink.DefaultRoute()
+		defer sub.Unsubscribe()
+		iface, ifaceChanged = sub.Get().Name, sub.C
+	}
+
+	read, nextSample := m.readNetDev()
+	lastRx, lastTx, lastRead, err := linkRxTx(iface, read)
 	if s.Error(err) {
 		return
 	}
 
-	var speeds Speeds
+	speeds := Speeds{Interface: iface}
 	outputFunc := m.outputFunc.Get().(func(Speeds) bar.Output)
 	nextOutputFunc, done := m.outputFunc.Subscribe()
 	defer done()
@@ -101,36 +157,75 @@ func (m *Module) Stream(s bar.Sink) {
 		if speeds.available {
 			s.Output(outputFunc(speeds))
 		}
+		refresh := false
 		select {
 		case <-nextOutputFunc:
 			outputFunc = m.outputFunc.Get().(func(Speeds) bar.Output)
-		case <-m.scheduler.C:
-			rx, tx, err := linkRxTx(m.iface)
+		case <-ifaceChanged:
+			// Updates to the current link don't affect the speeds.
+			if sub.Get().Name == iface {
+				break
+			}
+			iface = sub.Get().Name
+			// Keep showing the previous speeds until the next refresh,
+			// unless there's no longer a default route.
+			if iface == "" {
+				speeds.available = false
+				s.Output(nil)
+			}
+			lastRx, lastTx, lastRead, err = linkRxTx(iface, read)
 			if s.Error(err) {
 				return
 			}
-			now := timing.Now()
-			duration := now.Sub(lastRead).Seconds()
+		case <-nextSample:
+			refresh = true
+		case <-m.scheduler.C:
+			refresh = true
+		}
+		if !refresh {
+			continue
+		}
+		// RefreshInterval may have switched the module to its own schedule.
+		read, nextSample = m.readNetDev()
+		if iface == "" {
+			continue
+		}
+		rx, tx, now, err := linkRxTx(iface, read)
+		if s.Error(err) {
+			return
+		}
+		duration := now.Sub(lastRead).Seconds()
+		if duration <= 0 {
+			continue
+		}
 
-			speeds.available = true
-			speeds.Rx = unit.Datarate(float64(rx-lastRx)/duration) * unit.BytePerSecond
-			speeds.Tx = unit.Datarate(float64(tx-lastTx)/duration) * unit.BytePerSecond
+		speeds.available = true
+		speeds.Interface = iface
+		speeds.Rx = unit.Datarate(float64(rx-lastRx)/duration) * unit.BytePerSecond
+		speeds.Tx = unit.Datarate(float64(tx-lastTx)/duration) * unit.BytePerSecond
 
-			lastRead = now
-			lastRx = rx
-			lastTx = tx
-		}
+		lastRead = now
+		lastRx = rx
+		lastTx = tx
 	}
 }
 
-func linkRxTx(iface string) (rx, tx uint64, err error) {
-	var link netlink.Link
-	link, err = linkByName(iface)
+// linkRxTx returns the bytes received and transmitted by the given interface,
+// and when they were read. An empty interface (used in auto mode when there's
+// no default route) always returns 0 for both.
+func linkRxTx(iface string, read reader) (rx, tx uint64, when time.Time, err error) {
+	if iface == "" {
+		return 0, 0, timing.Now(), nil
+	}
+	var devs map[string]procstat.NetDev
+	devs, when, err = read()
 	if err != nil {
 		return
 	}
-	linkStats := link.Attrs().Statistics
-	rx = linkStats.RxBytes
-	tx = linkStats.TxBytes
-	return
+	dev, ok := devs[iface]
+	if !ok {
+		err = fmt.Errorf("No such interface: %s", iface)
+		return
+	}
+	return dev.RxBytes, dev.TxBytes, when, nil
 }
@@ -21,23 +21,18 @@ import (
 	"time"
 
 	"barista.run/bar"
+	"barista.run/base/procstat"
+	"barista.run/base/watchers/netlink"
 	"barista.run/format"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
 	"barista.run/timing"
 
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
-	"github.com/vishvananda/netlink"
 )
 
-type testLink netlink.LinkStatistics
-
-func (t testLink) Attrs() *netlink.LinkAttrs {
-	return &netlink.LinkAttrs{Statistics: (*netlink.LinkStatistics)(&t)}
-}
-func (t testLink) Type() string { return "test" }
-
-var ifaces = make(map[string]testLink)
+var ifaces = make(map[string]procstat.NetDev)
 var ifacesLock sync.Mutex
 
 func removeLink(name string) {
@@ -46,28 +41,28 @@ func removeLink(name string) {
 	delete(ifaces, name)
 }
 
-func setLink(name string, stats netlink.LinkStatistics) {
+func setLink(name string, stats procstat.NetDev) {
 	ifacesLock.Lock()
 	defer ifacesLock.Unlock()
-	ifaces[name] = testLink(stats)
+	ifaces[name] = stats
 }
 
 var signalChan chan struct{}
 
 func init() {
-	linkByName = func(name string) (netlink.Link, error) {
+	netDev = func() (map[string]procstat.NetDev, error) {
 		ifacesLock.Lock()
-		link, ok := ifaces[name]
+		devs := map[string]procstat.NetDev{}
+		for k, v := range ifaces {
+			devs[k] = v
+		}
 		sigCh := signalChan
 		signalChan = nil
 		ifacesLock.Unlock()
 		if sigCh != nil {
 			sigCh <- struct{}{}
 		}
-		if !ok {
-			return nil, fmt.Errorf("No such link: %s", name)
-		}
-		return link, nil
+		return devs, nil
 	}
 }
 
@@ -75,7 +70,7 @@ func TestNetspeed(t *testing.T) {
 	require := require.New(t)
 	testBar.New(t)
 
-	setLink("if0", netlink.LinkStatistics{
+	setLink("if0", procstat.NetDev{
 		RxBytes: 1024,
 		TxBytes: 1024,
 	})
@@ -90,7 +85,7 @@ func TestNetspeed(t *testing.T) {
 	testBar.Run(n)
 	testBar.AssertNoOutput("on start")
 
-	setLink("if0", netlink.LinkStatistics{
+	setLink("if0", procstat.NetDev{
 		RxBytes: 4096,
 		TxBytes: 2048,
 	})
@@ -98,7 +93,7 @@ func TestNetspeed(t *testing.T) {
 
 	testBar.NextOutput().AssertEqual(outputs.Text("3/1"), "on tick")
 
-	setLink("if0", netlink.LinkStatistics{
+	setLink("if0", procstat.NetDev{
 		RxBytes: 8192,
 		TxBytes: 3072,
 	})
@@ -140,7 +135,7 @@ func TestErrors(t *testing.T) {
 	testBar.NextOutput().AssertError("on start for missing interface")
 	out := testBar.NextOutput("sets restart click handler")
 
-	setLink("if0", netlink.LinkStatistics{
+	setLink("if0", procstat.NetDev{
 		RxBytes: 0,
 		TxBytes: 0,
 	})
@@ -151,7 +146,7 @@ func TestErrors(t *testing.T) {
 	testBar.NextOutput().AssertText([]string{},
 		"clears error on click after interface is available")
 
-	setLink("if0", netlink.LinkStatistics{
+	setLink("if0", procstat.NetDev{
 		RxBytes: 4096,
 		TxBytes: 2048,
 	})
@@ -163,3 +158,92 @@ func TestErrors(t *testing.T) {
 	testBar.Tick()
 	testBar.NextOutput().AssertError("on tick after losing interface")
 }
+
+func TestAuto(t *testing.T) {
+	nlt := netlink.TestMode()
+	eth0 := nlt.AddLink(netlink.Link{Name: "eth0", State: netlink.Up})
+	wlan0 := nlt.AddLink(netlink.Link{Name: "wlan0", State: netlink.Up})
+	nlt.AddDefaultRoute(wlan0, 600)
+	setLink("eth0", procstat.NetDev{RxBytes: 10240, TxBytes: 10240})
+	setLink("wlan0", procstat.NetDev{RxBytes: 1024, TxBytes: 1024})
+
+	testBar.New(t)
+	testBar.Run(Auto().
+		RefreshInterval(time.Second).
+		Output(func(s Speeds) bar.Output {
+			return outputs.Textf("%s: %v/%v", s.Interface,
+				s.Rx.KibibytesPerSecond(), s.Tx.KibibytesPerSecond())
+		}))
+	testBar.AssertNoOutput("on start")
+
+	setLink("wlan0", procstat.NetDev{RxBytes: 3072, TxBytes: 2048})
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"wlan0: 2/1"}, "on tick")
+
+	nlt.AddDefaultRoute(eth0, 100)
+	testBar.NextOutput().AssertText([]string{"wlan0: 2/1"},
+		"previous speeds until next tick")
+
+	setLink("eth0", procstat.NetDev{RxBytes: 14336, TxBytes: 11264})
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"eth0: 4/1"},
+		"speeds from new interface")
+
+	nlt.RemoveDefaultRoute(eth0, 100)
+	nlt.RemoveDefaultRoute(wlan0, 600)
+	testBar.LatestOutput().AssertEmpty("when there's no default route")
+	testBar.Tick()
+	testBar.AssertNoOutput("on tick without default route")
+
+	sigCh := make(chan struct{})
+	ifacesLock.Lock()
+	signalChan = sigCh
+	ifacesLock.Unlock()
+	nlt.AddDefaultRoute(eth0, 100)
+	<-sigCh // Wait for the new interface to be read.
+	setLink("eth0", procstat.NetDev{RxBytes: 15360, TxBytes: 11264})
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"eth0: 1/0"},
+		"on tick after default route is restored")
+}
+
+func writeNetDev(t *testing.T, fs afero.Fs, rx, tx int) {
+	require.NoError(t, afero.WriteFile(fs, "/proc/net/dev", []byte(fmt.Sprintf(
+		`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+   if0: %d 0 0 0 0 0 0 0 %d 0 0 0 0 0 0 0
+`, rx, tx)), 0644))
+}
+
+func TestSharedSampler(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	procstat.SetFsForTest(fs)
+	defer procstat.SetFsForTest(afero.NewOsFs())
+	testBar.New(t)
+	writeNetDev(t, fs, 0, 0)
+
+	n := New("if0").Output(func(s Speeds) bar.Output {
+		return outputs.Textf("%v/%v",
+			s.Rx.KibibytesPerSecond(), s.Tx.KibibytesPerSecond())
+	})
+	testBar.Run(n)
+	testBar.AssertNoOutput("on start")
+
+	writeNetDev(t, fs, 6144, 3072)
+	start := timing.Now()
+	require.Equal(t, 3*time.Second, testBar.Tick().Sub(start),
+		"uses the shared procstat interval")
+	testBar.NextOutput().AssertText([]string{"2/1"}, "on shared sample")
+
+	setLink("if0", procstat.NetDev{RxBytes: 6144, TxBytes: 3072})
+	n.RefreshInterval(time.Second)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"0/0"}, "on first own read")
+
+	writeNetDev(t, fs, 0, 0)
+	setLink("if0", procstat.NetDev{RxBytes: 7168, TxBytes: 4096})
+	start = timing.Now()
+	require.Equal(t, time.Second, testBar.Tick().Sub(start))
+	testBar.NextOutput().AssertText([]string{"1/1"},
+		"reads on its own schedule after setting an interval")
+}
@@ -0,0 +1,226 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nettop provides a bar module that attributes the current network
+// throughput to processes, showing the "top talker" to help find out what is
+// saturating the connection.
+//
+// Throughput is measured per connection using the byte counters in
+// /proc/net/nf_conntrack, which requires connection tracking with accounting
+// enabled (sysctl net.netfilter.nf_conntrack_acct=1). Connections are matched
+// to processes by the inodes of their sockets, so unless barista runs as root,
+// only processes of the current user can be identified. All other traffic,
+// including forwarded traffic, is reported as unattributed.
+package nettop // import "barista.run/modules/nettop"
+
+import (
+	"sort"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/core"
+	"barista.run/format"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+)
+
+// Throughput represents bidirectional network traffic.
+type Throughput struct {
+	Rx, Tx unit.Datarate
+}
+
+// Total gets the total throughput (both up and down).
+func (t Throughput) Total() unit.Datarate {
+	return t.Rx + t.Tx
+}
+
+// Process represents the network throughput of a single process.
+type Process struct {
+	PID  int
+	Name string
+	Throughput
+}
+
+// Info represents the network throughput of the busiest processes.
+type Info struct {
+	// Processes with any traffic, busiest first, up to the configured limit.
+	Processes []Process
+	// Unattributed is the throughput of connections that could not be
+	// matched to a process.
+	Unattributed Throughput
+}
+
+// Top returns the busiest process, if any process had network traffic.
+func (i Info) Top() (Process, bool) {
+	if len(i.Processes) == 0 {
+		return Process{}, false
+	}
+	return i.Processes[0], true
+}
+
+// Module represents a nettop bar module. It supports setting the output
+// format, the number of processes tracked, and update frequency.
+type Module struct {
+	scheduler  *timing.Scheduler
+	limit      value.Value     // of int
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// New constructs an instance of the nettop module.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "scheduler", "outputFunc")
+	m.RefreshInterval(3 * time.Second)
+	m.Limit(5)
+	// Default output is the top talker and its total throughput, if any.
+	m.Output(func(i Info) bar.Output {
+		p, ok := i.Top()
+		if !ok {
+			return nil
+		}
+		return outputs.Textf("%s %s", p.Name, format.IByterate(p.Total()))
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency. Since throughput is
+// computed from byte counters, it is averaged over this interval.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Limit configures the maximum number of processes included in the Info.
+func (m *Module) Limit(limit int) *Module {
+	m.limit.Set(limit)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(s bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	last, err := takeSample()
+	var info Info
+	available := false
+	for {
+		if s.Error(err) {
+			return
+		}
+		if available {
+			s.Output(outputFunc(info))
+		}
+		select {
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		case <-m.scheduler.C:
+			var next sample
+			next, err = takeSample()
+			if err == nil {
+				info = next.throughput(last, m.limit.Get().(int))
+				last, available = next, true
+			}
+		}
+	}
+}
+
+// sample is a snapshot of the byte counters of all tracked connections.
+type sample struct {
+	conns map[string]conn
+	at    time.Time
+}
+
+func takeSample() (sample, error) {
+	conns, err := readConntrack()
+	if err != nil {
+		return sample{}, err
+	}
+	s := sample{map[string]conn{}, timing.Now()}
+	for _, c := range conns {
+		s.conns[c.id()] = c
+	}
+	return s, nil
+}
+
+// throughput attributes the traffic since the previous sample to processes.
+// Connections that were not present in the previous sample are counted in
+// full, since all their traffic happened in between.
+func (s sample) throughput(prev sample, limit int) Info {
+	var i Info
+	elapsed := s.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return i
+	}
+	rate := func(bytes uint64) unit.Datarate {
+		return unit.Datarate(float64(bytes)/elapsed) * unit.BytePerSecond
+	}
+	sockets := readSockets()
+	owners, _ := socketOwners()
+	byPID := map[int]*Process{}
+	for id, c := range s.conns {
+		orig, resp := c.orig, c.resp
+		if old, ok := prev.conns[id]; ok && old.orig <= orig && old.resp <= resp {
+			// Counters only decrease if the entry was replaced.
+			orig -= old.orig
+			resp -= old.resp
+		}
+		if orig == 0 && resp == 0 {
+			continue
+		}
+		inode, outgoing, found := sockets.lookup(c)
+		rx, tx := resp, orig
+		if found && !outgoing {
+			rx, tx = orig, resp
+		}
+		owner, owned := owners[inode]
+		if !found || !owned {
+			i.Unattributed.Rx += rate(rx)
+			i.Unattributed.Tx += rate(tx)
+			continue
+		}
+		p, ok := byPID[owner.pid]
+		if !ok {
+			p = &Process{PID: owner.pid, Name: owner.name}
+			byPID[owner.pid] = p
+		}
+		p.Rx += rate(rx)
+		p.Tx += rate(tx)
+	}
+	for _, p := range byPID {
+		i.Processes = append(i.Processes, *p)
+	}
+	sort.Slice(i.Processes, func(a, b int) bool {
+		pa, pb := i.Processes[a], i.Processes[b]
+		if pa.Total() != pb.Total() {
+			return pa.Total() > pb.Total()
+		}
+		return pa.PID < pb.PID
+	})
+	if limit >= 0 && len(i.Processes) > limit {
+		i.Processes = i.Processes[:limit]
+	}
+	return i
+}
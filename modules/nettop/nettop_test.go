@@ -0,0 +1,131 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nettop
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModule(t *testing.T) {
+	resetProc()
+	testBar.New(t)
+	writeSockets("tcp",
+		socketLine(0, "192.168.1.2:50000", "1.2.3.4:443", 100),
+		socketLine(1, "192.168.1.2:50001", "5.6.7.8:443", 101),
+		socketLine(2, "192.168.1.2:22", "9.9.9.9:60000", 200),
+	)
+	addProcess(10, "firefox", 100, 101)
+	addProcess(20, "sshd", 200)
+	writeConntrack(
+		conntrackLine("tcp", "192.168.1.2:50000", "1.2.3.4:443", 1000, 10000),
+		conntrackLine("tcp", "9.9.9.9:60000", "192.168.1.2:22", 500, 500),
+	)
+
+	testBar.Run(New())
+	testBar.AssertNoOutput("until throughput is known")
+
+	writeConntrack(
+		conntrackLine("tcp", "192.168.1.2:50000", "1.2.3.4:443", 4000, 13000),
+		conntrackLine("tcp", "192.168.1.2:50001", "5.6.7.8:443", 3000, 9000),
+		conntrackLine("tcp", "9.9.9.9:60000", "192.168.1.2:22", 3500, 500),
+	)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"firefox 5.9 KiB/s"})
+
+	testBar.Tick()
+	testBar.NextOutput("without traffic").AssertEmpty()
+}
+
+func TestInfo(t *testing.T) {
+	resetProc()
+	testBar.New(t)
+	writeSockets("tcp6",
+		socketLine(0, "[2001:db8::2]:50000", "[2001:db8::80]:80", 100),
+		socketLine(1, "[::ffff:192.168.1.2]:8080", "[::ffff:10.0.0.5]:40000", 200),
+	)
+	writeSockets("udp", socketLine(0, "0.0.0.0:5353", "0.0.0.0:0", 300))
+	addProcess(10, "wget", 100)
+	addProcess(20, "server", 200)
+	addProcess(30, "avahi", 300)
+	writeConntrack()
+
+	infos := make(chan Info, 10)
+	m := New().Limit(2).RefreshInterval(2 * time.Second).Output(func(i Info) bar.Output {
+		infos <- i
+		return outputs.Text("ok")
+	})
+	testBar.Run(m)
+	testBar.AssertNoOutput("until throughput is known")
+
+	writeConntrack(
+		conntrackLine("tcp", "[2001:db8::2]:50000", "[2001:db8::80]:80", 200, 8000),
+		conntrackLine("tcp", "10.0.0.5:40000", "192.168.1.2:8080", 400, 4000),
+		conntrackLine("udp", "192.168.1.7:5353", "224.0.0.251:5353", 1000, 0),
+		conntrackLine("tcp", "10.0.0.2:1234", "8.8.8.8:443", 100, 300),
+	)
+	testBar.Tick()
+	testBar.NextOutput("on refresh")
+
+	var info Info
+	select {
+	case info = <-infos:
+	case <-time.After(time.Second):
+		require.Fail(t, "No info received")
+	}
+	bps := func(b float64) unit.Datarate { return unit.Datarate(b) * unit.BytePerSecond }
+	require.Equal(t, []Process{
+		{PID: 10, Name: "wget", Throughput: Throughput{Rx: bps(4000), Tx: bps(100)}},
+		{PID: 20, Name: "server", Throughput: Throughput{Rx: bps(200), Tx: bps(2000)}},
+	}, info.Processes, "busiest processes, limited")
+	require.Equal(t, Throughput{Rx: bps(150), Tx: bps(50)}, info.Unattributed,
+		"forwarded traffic is unattributed")
+	require.InDelta(t, 200, info.Unattributed.Total().BytesPerSecond(), 0.01)
+	top, ok := info.Top()
+	require.True(t, ok)
+	require.Equal(t, "wget", top.Name)
+
+	require.Empty(t, Info{}.Processes)
+	_, ok = Info{}.Top()
+	require.False(t, ok, "no top process without traffic")
+}
+
+func TestErrors(t *testing.T) {
+	resetProc()
+	testBar.New(t)
+	testBar.Run(New())
+	testBar.NextOutput("without conntrack").AssertError()
+
+	testBar.New(t)
+	writeConntrack("ipv4     2 tcp      6 431999 ESTABLISHED src=192.168.1.2 dst=1.2.3.4 sport=50000 dport=443 src=1.2.3.4 dst=192.168.1.2 sport=443 dport=50000 [ASSURED] mark=0 use=2")
+	testBar.Run(New())
+	errs := testBar.NextOutput("without accounting").AssertError()
+	require.Equal(t, errNoAccounting.Error(), errs[0])
+
+	testBar.New(t)
+	writeConntrack()
+	testBar.Run(New())
+	testBar.AssertNoOutput("on start")
+	fs.Remove("/proc/net/nf_conntrack")
+	testBar.Tick()
+	testBar.NextOutput("on read error").AssertError()
+}
@@ -0,0 +1,305 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nettop
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Overridden in tests.
+var (
+	fs       = afero.NewOsFs()
+	readlink = os.Readlink
+)
+
+// errNoAccounting is returned when conntrack entries do not include byte
+// counters, which requires the nf_conntrack_acct sysctl.
+var errNoAccounting = errors.New(
+	"conntrack accounting is disabled (sysctl net.netfilter.nf_conntrack_acct=1)")
+
+// endpoint is one end of a connection.
+type endpoint struct {
+	ip   string // Normalised, so IPv4-mapped IPv6 addresses match IPv4.
+	port int
+}
+
+func (e endpoint) String() string {
+	return net.JoinHostPort(e.ip, strconv.Itoa(e.port))
+}
+
+// conn is a tracked connection from /proc/net/nf_conntrack. Addresses and the
+// orig byte counter are for the original direction (from src to dst).
+type conn struct {
+	proto      string
+	src, dst   endpoint
+	orig, resp uint64 // Bytes sent by src and dst respectively.
+}
+
+// id uniquely identifies a connection across reads.
+func (c conn) id() string {
+	return c.proto + " " + c.src.String() + " " + c.dst.String()
+}
+
+// parseConntrack parses the contents of /proc/net/nf_conntrack. Only TCP and
+// UDP connections are returned, since other protocols have no sockets that
+// can be attributed to processes.
+func parseConntrack(contents string) ([]conn, error) {
+	var conns []conn
+	entries, counted := 0, 0
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		entries++
+		c := conn{proto: fields[2]}
+		if c.proto != "tcp" && c.proto != "udp" {
+			continue
+		}
+		// Each key appears once for the original direction, and again for
+		// the reply direction, which is not needed apart from its bytes.
+		seen := map[string]int{}
+		hasBytes, ok := false, true
+		for _, f := range fields[3:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			seen[kv[0]]++
+			reply := seen[kv[0]] > 1
+			switch kv[0] {
+			case "src", "dst":
+				if reply {
+					continue
+				}
+				ip := net.ParseIP(kv[1])
+				if ip == nil {
+					ok = false
+				} else if kv[0] == "src" {
+					c.src.ip = ip.String()
+				} else {
+					c.dst.ip = ip.String()
+				}
+			case "sport", "dport":
+				if reply {
+					continue
+				}
+				port, err := strconv.Atoi(kv[1])
+				if err != nil {
+					ok = false
+				} else if kv[0] == "sport" {
+					c.src.port = port
+				} else {
+					c.dst.port = port
+				}
+			case "bytes":
+				b, err := strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					ok = false
+				} else if reply {
+					c.resp = b
+				} else {
+					c.orig = b
+				}
+				hasBytes = true
+			}
+		}
+		if hasBytes {
+			counted++
+		}
+		if ok && c.src.ip != "" && c.dst.ip != "" {
+			conns = append(conns, c)
+		}
+	}
+	if entries > 0 && counted == 0 {
+		return nil, errNoAccounting
+	}
+	return conns, nil
+}
+
+// readConntrack reads and parses all tracked connections.
+func readConntrack() ([]conn, error) {
+	contents, err := afero.ReadFile(fs, "/proc/net/nf_conntrack")
+	if err != nil {
+		return nil, err
+	}
+	return parseConntrack(string(contents))
+}
+
+// socket is a socket from /proc/net/{tcp,udp}[6].
+type socket struct {
+	proto         string
+	local, remote endpoint
+	inode         uint64
+}
+
+// parseHexAddr parses an address from /proc/net/{tcp,udp}[6], e.g.
+// "0100007F:0035". The IP address is stored as 32-bit words in host byte
+// order, which is assumed to be little endian.
+func parseHexAddr(addr string) (endpoint, error) {
+	parts := strings.Split(addr, ":")
+	if len(parts) != 2 {
+		return endpoint{}, fmt.Errorf("invalid address %q", addr)
+	}
+	ip, err := hex.DecodeString(parts[0])
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return endpoint{}, fmt.Errorf("invalid address %q", addr)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = ip[i+3], ip[i+2], ip[i+1], ip[i]
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("invalid address %q", addr)
+	}
+	return endpoint{net.IP(ip).String(), int(port)}, nil
+}
+
+// parseSockets parses a /proc/net/{tcp,udp}[6] file.
+func parseSockets(proto, contents string) []socket {
+	var sockets []socket
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.Fields(line)
+		// The first line is a header, starting with "sl".
+		if len(fields) < 10 || fields[0] == "sl" {
+			continue
+		}
+		local, err1 := parseHexAddr(fields[1])
+		remote, err2 := parseHexAddr(fields[2])
+		inode, err3 := strconv.ParseUint(fields[9], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil || inode == 0 {
+			continue
+		}
+		sockets = append(sockets, socket{proto, local, remote, inode})
+	}
+	return sockets
+}
+
+// socketTable finds the inode of the local socket for a connection.
+type socketTable map[string]uint64
+
+func (s socketTable) add(sock socket) {
+	s[sock.proto+" "+sock.local.String()+" "+sock.remote.String()] = sock.inode
+	if sock.remote.port != 0 {
+		return
+	}
+	// Unconnected (e.g. listening or UDP) sockets can handle traffic for
+	// many connections, possibly on any local address.
+	s[sock.proto+" "+sock.local.String()] = sock.inode
+	if ip := net.ParseIP(sock.local.ip); ip != nil && ip.IsUnspecified() {
+		s[sock.proto+" *:"+strconv.Itoa(sock.local.port)] = sock.inode
+	}
+}
+
+// lookup finds the local socket for a connection, preferring connected
+// sockets. It returns the socket's inode, and whether the socket is at the
+// source end of the connection (i.e. the connection is outgoing).
+func (s socketTable) lookup(c conn) (inode uint64, outgoing, ok bool) {
+	keys := func(local, remote endpoint) []string {
+		return []string{
+			c.proto + " " + local.String() + " " + remote.String(),
+			c.proto + " " + local.String(),
+			c.proto + " *:" + strconv.Itoa(local.port),
+		}
+	}
+	out, in := keys(c.src, c.dst), keys(c.dst, c.src)
+	for i := range out {
+		if inode, ok := s[out[i]]; ok {
+			return inode, true, true
+		}
+		if inode, ok := s[in[i]]; ok {
+			return inode, false, true
+		}
+	}
+	return 0, false, false
+}
+
+// readSockets reads all TCP and UDP sockets. Missing files are ignored, since
+// e.g. IPv6 may be disabled.
+func readSockets() socketTable {
+	table := socketTable{}
+	for _, f := range []struct{ file, proto string }{
+		{"tcp", "tcp"}, {"tcp6", "tcp"}, {"udp", "udp"}, {"udp6", "udp"},
+	} {
+		contents, err := afero.ReadFile(fs, filepath.Join("/proc/net", f.file))
+		if err != nil {
+			continue
+		}
+		for _, sock := range parseSockets(f.proto, string(contents)) {
+			table.add(sock)
+		}
+	}
+	return table
+}
+
+// process identifies a process that owns sockets.
+type process struct {
+	pid  int
+	name string
+}
+
+// socketOwners maps socket inodes to the processes that have them open. Only
+// processes whose file descriptors are readable are included, which usually
+// means only processes of the current user unless running as root.
+func socketOwners() (map[uint64]process, error) {
+	dirs, err := afero.ReadDir(fs, "/proc")
+	if err != nil {
+		return nil, err
+	}
+	owners := map[uint64]process{}
+	for _, d := range dirs {
+		pid, err := strconv.Atoi(d.Name())
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		fdDir := filepath.Join("/proc", d.Name(), "fd")
+		fds, err := afero.ReadDir(fs, fdDir)
+		if err != nil {
+			// Process exited, or belongs to another user.
+			continue
+		}
+		var name string
+		for _, fd := range fds {
+			target, err := readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(
+				strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+			if name == "" {
+				comm, _ := afero.ReadFile(fs, filepath.Join("/proc", d.Name(), "comm"))
+				name = strings.TrimSpace(string(comm))
+			}
+			// Sockets shared by multiple processes (e.g. after fork) are
+			// attributed to the first process found.
+			if _, ok := owners[inode]; !ok {
+				owners[inode] = process{pid, name}
+			}
+		}
+	}
+	return owners, nil
+}
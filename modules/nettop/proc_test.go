@@ -0,0 +1,244 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nettop
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+// conntrackLine formats a tracked connection as in /proc/net/nf_conntrack.
+func conntrackLine(proto, src, dst string, orig, resp uint64) string {
+	family, num := "ipv4 2", map[string]int{"tcp": 6, "udp": 17}[proto]
+	srcIP, srcPort, _ := net.SplitHostPort(src)
+	dstIP, dstPort, _ := net.SplitHostPort(dst)
+	if strings.Contains(srcIP, ":") {
+		family = "ipv6 10"
+	}
+	state := ""
+	if proto == "tcp" {
+		state = "ESTABLISHED "
+	}
+	return fmt.Sprintf("%s %s %d 431999 %s"+
+		"src=%s dst=%s sport=%s dport=%s packets=10 bytes=%d "+
+		"src=%s dst=%s sport=%s dport=%s packets=12 bytes=%d "+
+		"[ASSURED] mark=0 zone=0 use=2",
+		family, proto, num, state,
+		srcIP, dstIP, srcPort, dstPort, orig,
+		dstIP, srcIP, dstPort, srcPort, resp)
+}
+
+// hexAddr formats an address as in /proc/net/{tcp,udp}[6].
+func hexAddr(addr string) string {
+	host, port, _ := net.SplitHostPort(addr)
+	ip := net.ParseIP(host)
+	if v4 := ip.To4(); v4 != nil && !strings.Contains(host, ":") {
+		ip = v4
+	}
+	ip = append(net.IP(nil), ip...)
+	for i := 0; i < len(ip); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = ip[i+3], ip[i+2], ip[i+1], ip[i]
+	}
+	p, _ := strconv.Atoi(port)
+	return fmt.Sprintf("%s:%04X", strings.ToUpper(hex.EncodeToString(ip)), p)
+}
+
+// socketLine formats a socket as in /proc/net/{tcp,udp}[6].
+func socketLine(n int, local, remote string, inode uint64) string {
+	return fmt.Sprintf("%4d: %s %s 01 00000000:00000000 00:00000000 00000000  1000        0 %d 1 0000000000000000 20 4 30 10 -1",
+		n, hexAddr(local), hexAddr(remote), inode)
+}
+
+const socketHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode"
+
+var (
+	linksMu sync.Mutex
+	links   = map[string]string{}
+)
+
+func init() {
+	readlink = func(path string) (string, error) {
+		linksMu.Lock()
+		defer linksMu.Unlock()
+		if target, ok := links[path]; ok {
+			return target, nil
+		}
+		return "", os.ErrNotExist
+	}
+}
+
+func resetProc() {
+	fs = afero.NewMemMapFs()
+	linksMu.Lock()
+	links = map[string]string{}
+	linksMu.Unlock()
+}
+
+func writeConntrack(lines ...string) {
+	afero.WriteFile(fs, "/proc/net/nf_conntrack", []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func writeSockets(file string, lines ...string) {
+	lines = append([]string{socketHeader}, lines...)
+	afero.WriteFile(fs, filepath.Join("/proc/net", file), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// addProcess adds a process with the given socket inodes open, as well as a
+// regular file to make sure it's ignored.
+func addProcess(pid int, name string, inodes ...uint64) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	afero.WriteFile(fs, filepath.Join(dir, "comm"), []byte(name+"\n"), 0644)
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	fds := append([]string{"/dev/null"}, make([]string, len(inodes))...)
+	for i, inode := range inodes {
+		fds[i+1] = fmt.Sprintf("socket:[%d]", inode)
+	}
+	for fd, target := range fds {
+		path := filepath.Join(dir, "fd", strconv.Itoa(fd))
+		afero.WriteFile(fs, path, nil, 0644)
+		links[path] = target
+	}
+}
+
+func TestParseConntrack(t *testing.T) {
+	conns, err := parseConntrack(strings.Join([]string{
+		conntrackLine("tcp", "192.168.1.2:50000", "1.2.3.4:443", 1000, 20000),
+		conntrackLine("udp", "[2001:db8::2]:40000", "[2001:db8::53]:53", 60, 120),
+		"ipv4     2 icmp     1 29 src=192.168.1.2 dst=1.1.1.1 type=8 code=0 id=5 packets=1 bytes=84 src=1.1.1.1 dst=192.168.1.2 type=0 code=0 id=5 packets=1 bytes=84 mark=0 use=1",
+		"ipv4     2 tcp      6 10 ESTABLISHED src=bogus dst=1.2.3.4 sport=1 dport=2 packets=1 bytes=1 src=1.2.3.4 dst=bogus sport=2 dport=1 packets=1 bytes=1 use=1",
+		"",
+	}, "\n"))
+	require.NoError(t, err)
+	require.Equal(t, []conn{
+		{"tcp", endpoint{"192.168.1.2", 50000}, endpoint{"1.2.3.4", 443}, 1000, 20000},
+		{"udp", endpoint{"2001:db8::2", 40000}, endpoint{"2001:db8::53", 53}, 60, 120},
+	}, conns)
+	require.Equal(t, "tcp 192.168.1.2:50000 1.2.3.4:443", conns[0].id())
+	require.Equal(t, "udp [2001:db8::2]:40000 [2001:db8::53]:53", conns[1].id())
+
+	conns, err = parseConntrack("")
+	require.NoError(t, err, "no connections")
+	require.Empty(t, conns)
+
+	_, err = parseConntrack("ipv4     2 tcp      6 431999 ESTABLISHED src=192.168.1.2 dst=1.2.3.4 sport=50000 dport=443 src=1.2.3.4 dst=192.168.1.2 sport=443 dport=50000 [ASSURED] mark=0 use=2\n")
+	require.Equal(t, errNoAccounting, err, "without byte counters")
+}
+
+func TestParseHexAddr(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		ip   string
+		port int
+	}{
+		{"0100007F:0035", "127.0.0.1", 53},
+		{"0201A8C0:C350", "192.168.1.2", 50000},
+		{"00000000:0000", "0.0.0.0", 0},
+		{"00000000000000000000000001000000:0016", "::1", 22},
+		{"0000000000000000FFFF00000201A8C0:01BB", "192.168.1.2", 443},
+		{"B80D0120000000000000000002000000:9C40", "2001:db8::2", 40000},
+	} {
+		e, err := parseHexAddr(tc.addr)
+		require.NoError(t, err, tc.addr)
+		require.Equal(t, endpoint{tc.ip, tc.port}, e, tc.addr)
+	}
+	for _, addr := range []string{"", "0100007F", "0100007F:", "ZZ00007F:0035", "01007F:0035", "0100007F:10000"} {
+		_, err := parseHexAddr(addr)
+		require.Error(t, err, addr)
+	}
+}
+
+func TestSockets(t *testing.T) {
+	resetProc()
+	writeSockets("tcp",
+		socketLine(0, "192.168.1.2:50000", "1.2.3.4:443", 100),
+		socketLine(1, "0.0.0.0:22", "0.0.0.0:0", 200),
+		socketLine(2, "192.168.1.2:22", "5.6.7.8:60000", 201),
+		"   3: garbage",
+		socketLine(4, "192.168.1.2:50001", "1.2.3.4:443", 0),
+	)
+	writeSockets("udp6",
+		socketLine(0, "[::]:5353", "[::]:0", 300),
+		socketLine(1, "[2001:db8::2]:40000", "[::]:0", 301),
+	)
+	sockets := readSockets()
+
+	for _, tc := range []struct {
+		desc     string
+		c        conn
+		inode    uint64
+		outgoing bool
+	}{
+		{"outgoing connection",
+			conn{proto: "tcp", src: endpoint{"192.168.1.2", 50000}, dst: endpoint{"1.2.3.4", 443}},
+			100, true},
+		{"accepted connection",
+			conn{proto: "tcp", src: endpoint{"5.6.7.8", 60000}, dst: endpoint{"192.168.1.2", 22}},
+			201, false},
+		{"listening socket",
+			conn{proto: "tcp", src: endpoint{"5.6.7.8", 60001}, dst: endpoint{"192.168.1.2", 22}},
+			200, false},
+		{"unconnected udp socket",
+			conn{proto: "udp", src: endpoint{"2001:db8::2", 40000}, dst: endpoint{"2001:db8::53", 53}},
+			301, true},
+		{"wildcard udp socket",
+			conn{proto: "udp", src: endpoint{"192.168.1.5", 40000}, dst: endpoint{"192.168.1.2", 5353}},
+			300, false},
+	} {
+		inode, outgoing, ok := sockets.lookup(tc.c)
+		require.True(t, ok, tc.desc)
+		require.Equal(t, tc.inode, inode, tc.desc)
+		require.Equal(t, tc.outgoing, outgoing, tc.desc)
+	}
+
+	_, _, ok := sockets.lookup(conn{proto: "tcp",
+		src: endpoint{"192.168.1.2", 50001}, dst: endpoint{"1.2.3.4", 443}})
+	require.False(t, ok, "socket without inode")
+	_, _, ok = sockets.lookup(conn{proto: "udp",
+		src: endpoint{"10.0.0.2", 1234}, dst: endpoint{"8.8.8.8", 53}})
+	require.False(t, ok, "forwarded connection")
+}
+
+func TestSocketOwners(t *testing.T) {
+	resetProc()
+	addProcess(100, "firefox", 1001, 1002)
+	addProcess(200, "curl", 2001)
+	addProcess(201, "curl-child", 2001)
+	addProcess(300, "idle")
+	afero.WriteFile(fs, "/proc/self", nil, 0644)
+	afero.WriteFile(fs, "/proc/400/comm", []byte("other-user\n"), 0644)
+
+	owners, err := socketOwners()
+	require.NoError(t, err)
+	require.Equal(t, map[uint64]process{
+		1001: {100, "firefox"},
+		1002: {100, "firefox"},
+		2001: {200, "curl"},
+	}, owners)
+
+	fs = afero.NewMemMapFs()
+	_, err = socketOwners()
+	require.Error(t, err, "without /proc")
+}
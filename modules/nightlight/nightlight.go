@@ -0,0 +1,364 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nightlight provides a bar module that shows and controls the active
+// night-light daemon. wl-gammarelay-rs is controlled over D-Bus, and supports
+// reading and adjusting the color temperature. gammastep, redshift, and wlsunset
+// do not expose their state, and can only be toggled using SIGUSR1.
+package nightlight // import "barista.run/modules/nightlight"
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/osd"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/spf13/afero"
+)
+
+// NeutralTemperature is the color temperature, in Kelvin, of an unfiltered
+// display.
+const NeutralTemperature = 6500
+
+// Info represents the state of the night-light daemon.
+type Info struct {
+	// Daemon is the name of the running night-light daemon, or empty if no
+	// supported daemon is running.
+	Daemon string
+	// Enabled is true if the display is being filtered. For daemons that are
+	// toggled using signals, the module assumes that the filter is enabled
+	// when the daemon starts.
+	Enabled bool
+	// Temperature is the current color temperature in Kelvin, or 0 if the
+	// daemon does not expose it.
+	Temperature int
+
+	ctrl controller
+	step int
+}
+
+// Running returns true if a supported night-light daemon is running.
+func (i Info) Running() bool { return i.Daemon != "" }
+
+// CanAdjust returns true if the daemon supports changing the temperature.
+func (i Info) CanAdjust() bool { return i.Temperature > 0 }
+
+// Toggle enables or disables the night-light filter.
+func (i Info) Toggle() {
+	if i.ctrl == nil {
+		return
+	}
+	if err := i.ctrl.toggle(i); err != nil {
+		l.Log("Failed to toggle %s: %v", i.Daemon, err)
+	}
+}
+
+// Adjust changes the color temperature by the given amount in Kelvin. It has
+// no effect if the daemon does not support it.
+func (i Info) Adjust(kelvin int) {
+	if i.ctrl == nil || !i.CanAdjust() {
+		return
+	}
+	if err := i.ctrl.adjust(i, kelvin); err != nil {
+		l.Log("Failed to adjust %s: %v", i.Daemon, err)
+	}
+}
+
+// Warmer decreases the color temperature by the module's step.
+func (i Info) Warmer() { i.Adjust(-i.step) }
+
+// Cooler increases the color temperature by the module's step.
+func (i Info) Cooler() { i.Adjust(i.step) }
+
+// controller abstracts the control interface of a night-light daemon.
+type controller interface {
+	toggle(Info) error
+	adjust(Info, int) error
+}
+
+// Module represents a bar module that shows the state of a night-light daemon.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	step       value.Value     // of int
+	osd        value.Value     // of osd.Indicator
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a night-light module. Since daemons toggled using signals can
+// start and stop at any time, the module checks for them every 5 seconds.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler().Every(5 * time.Second)}
+	l.Register(m, "outputFunc", "step", "osd", "scheduler")
+	m.Step(100)
+	m.Output(func(i Info) bar.Output {
+		if !i.Running() {
+			return nil
+		}
+		var out *bar.Segment
+		switch {
+		case !i.Enabled:
+			out = outputs.Text("off")
+		case i.CanAdjust():
+			out = outputs.Textf("%dK", i.Temperature)
+		default:
+			out = outputs.Text("on")
+		}
+		return out.OnClick(click.Map{}.
+			Left(i.Toggle).
+			ScrollUp(i.Cooler).
+			ScrollDown(i.Warmer).
+			Handle)
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Step configures the temperature change, in Kelvin, used by Info.Warmer and
+// Info.Cooler. By default, scrolling up makes the display cooler, and
+// scrolling down makes it warmer.
+func (m *Module) Step(kelvin int) *Module {
+	m.step.Set(kelvin)
+	return m
+}
+
+// OSD configures an on-screen display indicator that is shown whenever the
+// color temperature changes after the module has started. Only daemons that
+// expose the temperature are supported.
+func (m *Module) OSD(indicator osd.Indicator) *Module {
+	m.osd.Set(indicator)
+	return m
+}
+
+// RefreshInterval configures how often the module checks for daemons that
+// are toggled using signals.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	w := dbus.WatchProperties(busType, gammarelayService, "/", gammarelayIface).
+		Add("Temperature")
+	defer w.Unsubscribe()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	refreshCh := make(chan struct{}, 1)
+	s := &signaller{refresh: func() {
+		select {
+		case refreshCh <- struct{}{}:
+		default:
+		}
+	}}
+	g := &gammarelay{w: w, last: 4500}
+
+	var last Info
+	for {
+		i := g.info()
+		if !i.Running() {
+			i = s.info()
+		}
+		i.step = m.step.Get().(int)
+		sink.Output(outputFunc(i))
+		if ind, ok := m.osd.Get().(osd.Indicator); ok && temperatureChanged(last, i) {
+			if out := ind.Show(temperatureEvent(i)); out != nil {
+				sink.Output(out)
+			}
+		}
+		last = i
+		select {
+		case <-w.Updates:
+		case <-m.scheduler.C:
+		case <-refreshCh:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// temperatureChanged returns true if the color temperature set by the same
+// daemon has changed. The first value read after starting is never a change.
+func temperatureChanged(last, i Info) bool {
+	return i.CanAdjust() && last.Daemon == i.Daemon &&
+		last.Temperature != i.Temperature
+}
+
+// temperatureEvent returns the indicator event for the color temperature,
+// as a fraction of the neutral temperature.
+func temperatureEvent(i Info) osd.Event {
+	frac := float64(i.Temperature) / NeutralTemperature
+	if frac > 1 {
+		frac = 1
+	}
+	return osd.Event{
+		Kind:     osd.ColorTemperature,
+		Fraction: frac,
+		Muted:    !i.Enabled,
+		Text:     fmt.Sprintf("%dK", i.Temperature),
+	}
+}
+
+// Overridden in tests.
+var busType = dbus.Session
+
+const (
+	gammarelayService = "rs.wl-gammarelay"
+	gammarelayIface   = "rs.wl.gammarelay"
+)
+
+// gammarelay controls wl-gammarelay-rs, which has no notion of being enabled,
+// so it is considered disabled at the neutral temperature. Disabling it
+// remembers the last temperature, which is restored when enabled again.
+type gammarelay struct {
+	w *dbus.PropertiesWatcher
+
+	mu   sync.Mutex
+	last int
+}
+
+func (g *gammarelay) info() Info {
+	temp, ok := g.w.Get()["Temperature"].(uint16)
+	if !ok {
+		return Info{}
+	}
+	i := Info{
+		Daemon:      "wl-gammarelay",
+		Enabled:     temp != NeutralTemperature,
+		Temperature: int(temp),
+		ctrl:        g,
+	}
+	if i.Enabled {
+		g.mu.Lock()
+		g.last = i.Temperature
+		g.mu.Unlock()
+	}
+	return i
+}
+
+func (g *gammarelay) toggle(i Info) error {
+	if i.Enabled {
+		return g.w.SetProperty("Temperature", uint16(NeutralTemperature))
+	}
+	g.mu.Lock()
+	last := g.last
+	g.mu.Unlock()
+	return g.w.SetProperty("Temperature", uint16(last))
+}
+
+func (g *gammarelay) adjust(i Info, kelvin int) error {
+	_, err := g.w.Call("UpdateTemperature", int16(kelvin))
+	return err
+}
+
+// signalDaemons are the daemons that toggle between the night and day
+// temperatures on SIGUSR1, in order of preference. wlsunset cycles between
+// forced and automatic modes instead. They are found by their process name.
+var signalDaemons = []string{"gammastep", "redshift", "wlsunset"}
+
+// Overridden in tests.
+var (
+	fs   = afero.NewOsFs()
+	kill = syscall.Kill
+)
+
+// signaller controls daemons using SIGUSR1. Their state cannot be queried, so
+// it is tracked for each process, assuming it starts enabled.
+type signaller struct {
+	refresh func()
+
+	mu      sync.Mutex
+	pid     int
+	enabled bool
+}
+
+// findDaemon returns the name and process ID of the first running daemon
+// that is toggled using signals.
+func findDaemon() (name string, pid int) {
+	dirs, err := afero.ReadDir(fs, "/proc")
+	if err != nil {
+		return "", 0
+	}
+	found := map[string]int{}
+	for _, d := range dirs {
+		p, err := strconv.Atoi(d.Name())
+		if err != nil || !d.IsDir() {
+			continue
+		}
+		comm, err := afero.ReadFile(fs, filepath.Join("/proc", d.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		found[strings.TrimSpace(string(comm))] = p
+	}
+	for _, n := range signalDaemons {
+		if p, ok := found[n]; ok {
+			return n, p
+		}
+	}
+	return "", 0
+}
+
+func (s *signaller) info() Info {
+	name, pid := findDaemon()
+	if pid == 0 {
+		return Info{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pid != pid {
+		s.pid = pid
+		s.enabled = true
+	}
+	return Info{Daemon: name, Enabled: s.enabled, ctrl: s}
+}
+
+func (s *signaller) toggle(i Info) error {
+	s.mu.Lock()
+	pid := s.pid
+	s.mu.Unlock()
+	if err := kill(pid, syscall.SIGUSR1); err != nil {
+		return fmt.Errorf("signal %d: %v", pid, err)
+	}
+	s.mu.Lock()
+	if s.pid == pid {
+		s.enabled = !s.enabled
+	}
+	s.mu.Unlock()
+	s.refresh()
+	return nil
+}
+
+func (s *signaller) adjust(i Info, kelvin int) error {
+	return fmt.Errorf("%s does not support adjusting the temperature", i.Daemon)
+}
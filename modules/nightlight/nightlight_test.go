@@ -0,0 +1,184 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nightlight
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/osd"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func setupProcs(procs map[string]string) {
+	fs = afero.NewMemMapFs()
+	fs.MkdirAll("/proc/self", 0755)
+	for pid, comm := range procs {
+		afero.WriteFile(fs, "/proc/"+pid+"/comm", []byte(comm+"\n"), 0644)
+	}
+}
+
+func TestGammarelay(t *testing.T) {
+	testBar.New(t)
+	setupProcs(map[string]string{"1": "systemd", "42": "gammastep"})
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	obj := bus.RegisterService(gammarelayService).Object("/", gammarelayIface)
+	obj.SetProperty("Temperature", uint16(4000), dbus.SignalTypeNone)
+	deltas := make(chan int16, 10)
+	obj.On("UpdateTemperature", func(args ...interface{}) ([]interface{}, error) {
+		deltas <- args[0].(int16)
+		return nil, nil
+	})
+
+	testBar.Run(New().Step(250))
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"4000K"}, "prefers D-Bus daemon")
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	require.Equal(t, int16(250), <-deltas)
+	obj.SetProperty("Temperature", uint16(4250), dbus.SignalTypeChanged)
+	out = testBar.NextOutput("on temperature change")
+	out.AssertText([]string{"4250K"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollDown})
+	require.Equal(t, int16(-250), <-deltas)
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on toggle")
+	out.AssertText([]string{"off"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on toggle").AssertText([]string{"4250K"},
+		"restores previous temperature")
+}
+
+func TestSignalDaemons(t *testing.T) {
+	testBar.New(t)
+	setupProcs(map[string]string{"1": "systemd", "42": "wlsunset", "56": "redshift"})
+	dbus.SetupTestBus()
+	busType = dbus.Test
+	type signal struct {
+		pid int
+		sig syscall.Signal
+	}
+	signals := make(chan signal, 10)
+	var killErr error
+	kill = func(pid int, sig syscall.Signal) error {
+		signals <- signal{pid, sig}
+		return killErr
+	}
+
+	testBar.Run(New().Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %v %d", i.Daemon, i.Enabled, i.Temperature).
+			OnClick(func(e bar.Event) {
+				if e.Button == bar.ScrollUp {
+					i.Cooler()
+				} else {
+					i.Toggle()
+				}
+			})
+	}))
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"redshift true 0"}, "in order of preference")
+
+	out.At(0).LeftClick()
+	require.Equal(t, signal{56, syscall.SIGUSR1}, <-signals)
+	out = testBar.NextOutput("on toggle")
+	out.AssertText([]string{"redshift false 0"})
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	testBar.AssertNoOutput("on scroll")
+	require.Empty(t, signals, "not adjustable")
+
+	killErr = errors.New("no such process")
+	out.At(0).LeftClick()
+	<-signals
+	testBar.AssertNoOutput("on failed toggle")
+
+	setupProcs(map[string]string{"70": "redshift"})
+	testBar.Tick()
+	testBar.NextOutput("on restart").AssertText([]string{"redshift true 0"},
+		"assumed enabled on restart")
+
+	setupProcs(map[string]string{"70": "other"})
+	testBar.Tick()
+	testBar.NextOutput("on exit").AssertText([]string{" false 0"})
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	setupProcs(map[string]string{"1": "systemd"})
+	dbus.SetupTestBus()
+	busType = dbus.Test
+	kill = func(int, syscall.Signal) error { return nil }
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertEmpty("no daemon")
+
+	setupProcs(map[string]string{"10": "gammastep"})
+	testBar.Tick()
+	out := testBar.NextOutput("on daemon start")
+	out.AssertText([]string{"on"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on toggle").AssertText([]string{"off"})
+}
+
+type testIndicator chan osd.Event
+
+func (t testIndicator) Show(e osd.Event) bar.Output {
+	t <- e
+	return nil
+}
+
+func TestOSD(t *testing.T) {
+	testBar.New(t)
+	setupProcs(map[string]string{"1": "systemd"})
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	obj := bus.RegisterService(gammarelayService).Object("/", gammarelayIface)
+	obj.SetProperty("Temperature", uint16(3250), dbus.SignalTypeNone)
+	events := make(testIndicator, 10)
+
+	testBar.Run(New().OSD(events))
+	testBar.NextOutput("on start").AssertText([]string{"3250K"})
+	require.Empty(t, events, "no indicator on start")
+
+	obj.SetProperty("Temperature", uint16(4550), dbus.SignalTypeChanged)
+	testBar.NextOutput("on change").AssertText([]string{"4550K"})
+	require.Equal(t, osd.Event{
+		Kind:     osd.ColorTemperature,
+		Fraction: 0.7,
+		Text:     "4550K",
+	}, <-events)
+
+	obj.SetProperty("Temperature", uint16(NeutralTemperature), dbus.SignalTypeChanged)
+	testBar.NextOutput("on disable").AssertText([]string{"off"})
+	e := <-events
+	require.True(t, e.Muted)
+	require.Equal(t, 1.0, e.Fraction)
+
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"off"})
+	require.Empty(t, events, "no indicator without change")
+}
@@ -0,0 +1,329 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notifications provides a bar module that shows the do-not-disturb
+// state and the number of waiting notifications of the dunst or mako
+// notification daemons, using their D-Bus control interfaces.
+package notifications // import "barista.run/modules/notifications"
+
+import (
+	"reflect"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/watchers/dbus"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/modules/focusmode"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents the state of the notification daemon.
+type Info struct {
+	// Daemon is the name of the notification daemon, "dunst" or "mako".
+	Daemon string
+	// Paused is true if do-not-disturb is enabled.
+	Paused bool
+	// Waiting is the number of notifications that have not been dismissed,
+	// including any held back while do-not-disturb is enabled.
+	Waiting int
+	// History is the number of dismissed notifications that can be shown
+	// again.
+	History int
+
+	connected bool
+	daemon    daemon
+	w         *dbus.PropertiesWatcher
+	refresh   func()
+}
+
+// Connected returns true if the notification daemon is running.
+func (i Info) Connected() bool { return i.connected }
+
+// SetPaused enables or disables do-not-disturb.
+func (i Info) SetPaused(paused bool) {
+	if err := i.daemon.setPaused(i.w, paused); err != nil {
+		l.Log("Failed to set %s paused: %v", i.Daemon, err)
+	}
+	i.refresh()
+}
+
+// TogglePaused toggles do-not-disturb.
+func (i Info) TogglePaused() { i.SetPaused(!i.Paused) }
+
+// ShowHistory shows the most recently dismissed notification again.
+func (i Info) ShowHistory() {
+	if err := i.daemon.showHistory(i.w); err != nil {
+		l.Log("Failed to show %s history: %v", i.Daemon, err)
+	}
+	i.refresh()
+}
+
+// daemon abstracts the control interface of a notification daemon.
+type daemon interface {
+	name() string
+	watch() *dbus.PropertiesWatcher
+	// info fills in the daemon's state, or returns false if the daemon is
+	// not running.
+	info(w *dbus.PropertiesWatcher, i *Info) bool
+	setPaused(w *dbus.PropertiesWatcher, paused bool) error
+	showHistory(w *dbus.PropertiesWatcher) error
+}
+
+// Module represents a bar module that shows the state of a notification
+// daemon.
+type Module struct {
+	daemon      daemon
+	outputFunc  core.OutputFunc // of func(Info) bar.Output
+	scheduler   *timing.Scheduler
+	followFocus bool
+}
+
+func newModule(d daemon) *Module {
+	m := &Module{daemon: d, scheduler: timing.NewScheduler()}
+	l.Label(m, d.name())
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		if !i.Connected() {
+			return nil
+		}
+		out := outputs.Textf("%d", i.Waiting)
+		if i.Paused {
+			out = outputs.Textf("DND %d", i.Waiting)
+		}
+		return out.OnClick(click.Map{}.
+			Left(i.TogglePaused).
+			Right(i.ShowHistory).
+			Handle)
+	})
+	return m
+}
+
+// Dunst constructs a module for the dunst notification daemon. Dunst signals
+// all changes, so the module does not poll.
+func Dunst() *Module {
+	return newModule(dunst{})
+}
+
+// Mako constructs a module for the mako notification daemon, which uses the
+// "do-not-disturb" mode for do-not-disturb.
+func Mako() *Module {
+	return MakoWithMode("do-not-disturb")
+}
+
+// MakoWithMode constructs a module for the mako notification daemon, using
+// the given mode for do-not-disturb. Mako does not signal any changes, so the
+// module polls it every 3 seconds by default.
+func MakoWithMode(dndMode string) *Module {
+	m := newModule(mako{dndMode})
+	m.RefreshInterval(3 * time.Second)
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency. Changes made using the
+// module's controls are always shown immediately.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// FollowFocusMode enables do-not-disturb whenever focus mode is enabled, and
+// disables it whenever focus mode is disabled. Do-not-disturb can still be
+// toggled using the module's controls in between.
+func (m *Module) FollowFocusMode() *Module {
+	m.followFocus = true
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	w := m.daemon.watch()
+	defer w.Unsubscribe()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	refreshCh := make(chan struct{}, 1)
+	refresh := func() {
+		select {
+		case refreshCh <- struct{}{}:
+		default:
+		}
+	}
+
+	var nextFocus <-chan struct{}
+	if m.followFocus {
+		var done func()
+		nextFocus, done = focusmode.Subscribe()
+		defer done()
+		if focusmode.Active() {
+			m.setPaused(w, true)
+		}
+	}
+
+	for {
+		i := Info{Daemon: m.daemon.name(), daemon: m.daemon, w: w, refresh: refresh}
+		i.connected = m.daemon.info(w, &i)
+		sink.Output(outputFunc(i))
+		select {
+		case <-w.Updates:
+		case <-m.scheduler.C:
+		case <-refreshCh:
+		case <-nextFocus:
+			m.setPaused(w, focusmode.Active())
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func (m *Module) setPaused(w *dbus.PropertiesWatcher, paused bool) {
+	if err := m.daemon.setPaused(w, paused); err != nil {
+		l.Log("Failed to set %s paused: %v", m.daemon.name(), err)
+	}
+}
+
+// Overridden in tests.
+var busType = dbus.Session
+
+const notificationsService = "org.freedesktop.Notifications"
+
+// dunst uses the org.dunstproject.cmd0 interface, which exposes the state as
+// properties and signals changes to them.
+type dunst struct{}
+
+func (dunst) name() string { return "dunst" }
+
+func (dunst) watch() *dbus.PropertiesWatcher {
+	return dbus.WatchProperties(busType, notificationsService,
+		"/org/freedesktop/Notifications", "org.dunstproject.cmd0").
+		Add("paused", "displayedLength", "waitingLength", "historyLength")
+}
+
+func (dunst) info(w *dbus.PropertiesWatcher, i *Info) bool {
+	props := w.Get()
+	paused, ok := props["paused"].(bool)
+	if !ok {
+		return false
+	}
+	i.Paused = paused
+	displayed, _ := props["displayedLength"].(uint32)
+	waiting, _ := props["waitingLength"].(uint32)
+	history, _ := props["historyLength"].(uint32)
+	i.Waiting = int(displayed + waiting)
+	i.History = int(history)
+	return true
+}
+
+func (dunst) setPaused(w *dbus.PropertiesWatcher, paused bool) error {
+	return w.SetProperty("paused", paused)
+}
+
+func (dunst) showHistory(w *dbus.PropertiesWatcher) error {
+	_, err := w.Call("NotificationShow")
+	return err
+}
+
+// mako uses the fr.emersion.Mako interface, which only provides methods.
+// Do-not-disturb is a mode, set using SetModes on mako 1.7 and newer, or
+// SetMode on older versions.
+type mako struct{ dndMode string }
+
+func (mako) name() string { return "mako" }
+
+func (mako) watch() *dbus.PropertiesWatcher {
+	return dbus.WatchProperties(busType, notificationsService,
+		"/fr/emersion/Mako", "fr.emersion.Mako")
+}
+
+func count(w *dbus.PropertiesWatcher, method string) (int, error) {
+	r, err := w.Call(method)
+	if err != nil || len(r) == 0 {
+		return 0, err
+	}
+	// The lists are arrays of a{sv}, but only their length is needed.
+	if list := reflect.ValueOf(r[0]); list.Kind() == reflect.Slice {
+		return list.Len(), nil
+	}
+	return 0, nil
+}
+
+// modes returns the active modes, and whether multiple modes are supported.
+func (mako) modes(w *dbus.PropertiesWatcher) (modes []string, multiple bool, err error) {
+	if r, err := w.Call("ListModes"); err == nil && len(r) > 0 {
+		modes, _ = r[0].([]string)
+		return modes, true, nil
+	}
+	r, err := w.Call("GetMode")
+	if err != nil || len(r) == 0 {
+		return nil, false, err
+	}
+	mode, _ := r[0].(string)
+	return []string{mode}, false, nil
+}
+
+func (m mako) info(w *dbus.PropertiesWatcher, i *Info) bool {
+	var err error
+	if i.Waiting, err = count(w, "ListNotifications"); err != nil {
+		return false
+	}
+	// ListHistory is not supported by older versions of mako.
+	i.History, _ = count(w, "ListHistory")
+	modes, _, _ := m.modes(w)
+	for _, mode := range modes {
+		if mode == m.dndMode {
+			i.Paused = true
+		}
+	}
+	return true
+}
+
+func (m mako) setPaused(w *dbus.PropertiesWatcher, paused bool) error {
+	modes, multiple, err := m.modes(w)
+	if err != nil {
+		return err
+	}
+	if !multiple {
+		mode := "default"
+		if paused {
+			mode = m.dndMode
+		}
+		_, err = w.Call("SetMode", mode)
+		return err
+	}
+	newModes := []string{}
+	for _, mode := range modes {
+		if mode != m.dndMode {
+			newModes = append(newModes, mode)
+		}
+	}
+	if paused {
+		newModes = append(newModes, m.dndMode)
+	}
+	_, err = w.Call("SetModes", newModes)
+	return err
+}
+
+func (mako) showHistory(w *dbus.PropertiesWatcher) error {
+	_, err := w.Call("RestoreNotification")
+	return err
+}
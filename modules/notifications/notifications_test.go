@@ -0,0 +1,191 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/modules/focusmode"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDunst(t *testing.T) {
+	testBar.New(t)
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	srv := bus.RegisterService(notificationsService)
+	obj := srv.Object("/org/freedesktop/Notifications", "org.dunstproject.cmd0")
+	obj.SetProperties(map[string]interface{}{
+		"paused":          false,
+		"displayedLength": uint32(1),
+		"waitingLength":   uint32(0),
+		"historyLength":   uint32(4),
+	}, dbus.SignalTypeNone)
+	shown := make(chan bool, 1)
+	obj.On("NotificationShow", func(...interface{}) ([]interface{}, error) {
+		shown <- true
+		return nil, nil
+	})
+
+	testBar.Run(Dunst())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"1"})
+
+	out.At(0).LeftClick()
+	testBar.Drain(time.Second, "on toggle").AssertText([]string{"DND 1"})
+	paused, _ := obj.GetProperty("org.dunstproject.cmd0.paused")
+	require.Equal(t, true, paused.Value())
+
+	obj.SetProperties(map[string]interface{}{
+		"displayedLength": uint32(0),
+		"waitingLength":   uint32(3),
+	}, dbus.SignalTypeChanged)
+	out = testBar.NextOutput("on property change")
+	out.AssertText([]string{"DND 3"}, "includes waiting notifications")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	require.True(t, <-shown, "history shown on right click")
+	testBar.NextOutput("on refresh").AssertText([]string{"DND 3"})
+
+	srv.Unregister()
+	testBar.NextOutput("on disconnect").AssertEmpty()
+}
+
+func TestFollowFocusMode(t *testing.T) {
+	testBar.New(t)
+	focusmode.Set(false)
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	obj := bus.RegisterService(notificationsService).
+		Object("/org/freedesktop/Notifications", "org.dunstproject.cmd0")
+	obj.SetProperties(map[string]interface{}{
+		"paused":          false,
+		"displayedLength": uint32(0),
+		"waitingLength":   uint32(0),
+		"historyLength":   uint32(0),
+	}, dbus.SignalTypeNone)
+
+	testBar.Run(Dunst().FollowFocusMode())
+	testBar.NextOutput("on start").AssertText([]string{"0"})
+
+	focusmode.Set(true)
+	testBar.Drain(time.Second, "on focus").AssertText([]string{"DND 0"})
+	paused, _ := obj.GetProperty("org.dunstproject.cmd0.paused")
+	require.Equal(t, true, paused.Value())
+
+	focusmode.Set(false)
+	testBar.Drain(time.Second, "on unfocus").AssertText([]string{"0"})
+	paused, _ = obj.GetProperty("org.dunstproject.cmd0.paused")
+	require.Equal(t, false, paused.Value())
+}
+
+func TestMako(t *testing.T) {
+	testBar.New(t)
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	obj := bus.RegisterService(notificationsService).
+		Object("/fr/emersion/Mako", "fr.emersion.Mako")
+	notifications := []map[string]interface{}{{"id": uint32(1)}, {"id": uint32(2)}}
+	modes := []string{"work"}
+	restored := make(chan bool, 1)
+	list := func(l []map[string]interface{}) func(...interface{}) ([]interface{}, error) {
+		return func(...interface{}) ([]interface{}, error) {
+			return []interface{}{l}, nil
+		}
+	}
+	obj.On("ListNotifications", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{notifications}, nil
+	})
+	obj.On("ListHistory", list(notifications[:1]))
+	obj.On("ListModes", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{modes}, nil
+	})
+	obj.On("SetModes", func(args ...interface{}) ([]interface{}, error) {
+		modes = args[0].([]string)
+		return nil, nil
+	})
+	obj.On("RestoreNotification", func(...interface{}) ([]interface{}, error) {
+		restored <- true
+		return nil, nil
+	})
+
+	testBar.Run(MakoWithMode("dnd").Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %v %d/%d", i.Daemon, i.Paused, i.Waiting, i.History).
+			OnClick(func(e bar.Event) {
+				if e.Button == bar.ButtonRight {
+					i.ShowHistory()
+				} else {
+					i.TogglePaused()
+				}
+			})
+	}))
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"mako false 2/1"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on toggle")
+	out.AssertText([]string{"mako true 2/1"})
+	require.Equal(t, []string{"work", "dnd"}, modes, "other modes kept")
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on toggle").AssertText([]string{"mako false 2/1"})
+	require.Equal(t, []string{"work"}, modes)
+
+	notifications = nil
+	testBar.AssertNoOutput("until refresh")
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"mako false 0/1"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	require.True(t, <-restored, "history shown on click")
+}
+
+func TestMakoSingleMode(t *testing.T) {
+	testBar.New(t)
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	obj := bus.RegisterService(notificationsService).
+		Object("/fr/emersion/Mako", "fr.emersion.Mako")
+	mode := "default"
+	obj.On("ListNotifications", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{[]map[string]interface{}{}}, nil
+	})
+	obj.On("GetMode", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{mode}, nil
+	})
+	obj.On("SetMode", func(args ...interface{}) ([]interface{}, error) {
+		mode = args[0].(string)
+		return nil, nil
+	})
+
+	testBar.Run(Mako())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"0"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on toggle")
+	out.AssertText([]string{"DND 0"})
+	require.Equal(t, "do-not-disturb", mode)
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on toggle").AssertText([]string{"0"})
+	require.Equal(t, "default", mode)
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notifymonitor provides a bar module that briefly shows the summary
+// of each desktop notification sent over D-Bus. It becomes a monitor of calls
+// to org.freedesktop.Notifications, so it works alongside any notification
+// daemon, including when popups are suppressed (e.g. for fullscreen games).
+package notifymonitor // import "barista.run/modules/notifymonitor"
+
+import (
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// Urgency represents the urgency level of a notification.
+type Urgency byte
+
+// Urgency levels defined by the desktop notifications specification.
+const (
+	Low Urgency = iota
+	Normal
+	Critical
+)
+
+// Notification represents a desktop notification.
+type Notification struct {
+	AppName string
+	Summary string
+	Body    string
+	Urgency Urgency
+
+	dismiss func()
+}
+
+// Dismiss stops showing the notification before its duration elapses.
+func (n Notification) Dismiss() { n.dismiss() }
+
+// Module represents a bar module that shows the most recent notification.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Notification) bar.Output
+	duration   value.Value     // of time.Duration
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a notification monitor module that shows each notification
+// for 5 seconds.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "outputFunc", "duration", "scheduler")
+	m.Duration(5 * time.Second)
+	m.Output(func(n Notification) bar.Output {
+		text := n.Summary
+		if text == "" {
+			text = n.AppName
+		}
+		return outputs.Text(text).
+			Urgent(n.Urgency == Critical).
+			OnClick(click.Left(n.Dismiss))
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Notification) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Duration configures how long each notification is shown for.
+func (m *Module) Duration(duration time.Duration) *Module {
+	m.duration.Set(duration)
+	return m
+}
+
+// Overridden in tests.
+var busType = dbus.Session
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	w, err := dbus.WatchMethodCalls(busType, "org.freedesktop.Notifications", "Notify")
+	if sink.Error(err) {
+		return
+	}
+	defer w.Unsubscribe()
+
+	outputFunc := m.outputFunc.Get().(func(Notification) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	dismissCh := make(chan struct{}, 1)
+	dismiss := func() {
+		select {
+		case dismissCh <- struct{}{}:
+		default:
+		}
+	}
+
+	var current *Notification
+	output := func() {
+		if current == nil {
+			sink.Output(nil)
+		} else {
+			sink.Output(outputFunc(*current))
+		}
+	}
+	output()
+	for {
+		select {
+		case c := <-w.Updates:
+			n, ok := parseNotify(c.Args)
+			if !ok {
+				l.Log("Unexpected Notify call: %+v", c.Args)
+				continue
+			}
+			n.dismiss = dismiss
+			current = &n
+			m.scheduler.After(m.duration.Get().(time.Duration))
+		case <-m.scheduler.C:
+			current = nil
+		case <-dismissCh:
+			m.scheduler.Stop()
+			current = nil
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Notification) bar.Output)
+		}
+		output()
+	}
+}
+
+// parseNotify extracts a notification from the arguments of a Notify call:
+// app_name, replaces_id, app_icon, summary, body, actions, hints, and
+// expire_timeout.
+func parseNotify(args []interface{}) (n Notification, ok bool) {
+	if len(args) < 7 {
+		return n, false
+	}
+	if n.AppName, ok = args[0].(string); !ok {
+		return n, false
+	}
+	if n.Summary, ok = args[3].(string); !ok {
+		return n, false
+	}
+	if n.Body, ok = args[4].(string); !ok {
+		return n, false
+	}
+	n.Urgency = Normal
+	hints, _ := args[6].(map[string]godbus.Variant)
+	if u, ok := hints["urgency"].Value().(byte); ok {
+		n.Urgency = Urgency(u)
+	}
+	return n, true
+}
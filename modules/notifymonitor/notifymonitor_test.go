@@ -0,0 +1,121 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notifymonitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+func notify(obj *dbus.TestBusObject, app, summary string, urgency byte) {
+	obj.Call("Notify", 0, app, uint32(0), "", summary, "body of "+summary,
+		[]string{}, map[string]godbus.Variant{"urgency": godbus.MakeVariant(urgency)},
+		int32(-1))
+}
+
+func setupNotificationsService() *dbus.TestBusObject {
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	obj := bus.RegisterService("org.freedesktop.Notifications").
+		Object("/org/freedesktop/Notifications", "org.freedesktop.Notifications")
+	obj.On("Notify", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{uint32(1)}, nil
+	})
+	return obj
+}
+
+func TestNotifyMonitor(t *testing.T) {
+	testBar.New(t)
+	obj := setupNotificationsService()
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertEmpty()
+
+	notify(obj, "chat", "New message", 1)
+	out := testBar.NextOutput("on notification")
+	out.AssertText([]string{"New message"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	testBar.Tick()
+	testBar.NextOutput("after duration").AssertEmpty()
+
+	notify(obj, "battery", "", 2)
+	out = testBar.NextOutput("on critical notification")
+	out.AssertText([]string{"battery"}, "app name when summary is empty")
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent)
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on dismiss").AssertEmpty()
+
+	obj.Call("Notify", 0, "bad")
+	testBar.AssertNoOutput("on malformed call")
+
+	obj.Call("GetServerInformation", 0)
+	testBar.AssertNoOutput("on other methods")
+}
+
+func TestCustomOutput(t *testing.T) {
+	testBar.New(t)
+	obj := setupNotificationsService()
+
+	m := New().Duration(time.Minute).Output(func(n Notification) bar.Output {
+		return outputs.Textf("%s: %s (%d)", n.AppName, n.Body, n.Urgency)
+	})
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertEmpty()
+
+	start := testBar.Tick()
+	notify(obj, "mail", "Hello", 0)
+	testBar.NextOutput("on notification").
+		AssertText([]string{"mail: body of Hello (0)"})
+
+	notify(obj, "mail", "World", 1)
+	testBar.NextOutput("on newer notification").
+		AssertText([]string{"mail: body of World (1)"})
+
+	m.Output(func(n Notification) bar.Output {
+		return outputs.Text(n.Summary)
+	})
+	testBar.NextOutput("on output func change").AssertText([]string{"World"})
+
+	now := testBar.Tick()
+	require.True(t, now.Sub(start) >= time.Minute,
+		"shown for configured duration, got %v", now.Sub(start))
+	testBar.NextOutput("after duration").AssertEmpty()
+}
+
+func TestMonitorError(t *testing.T) {
+	testBar.New(t)
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	bus.BusObject().On("org.freedesktop.DBus.Monitoring.BecomeMonitor",
+		func(...interface{}) ([]interface{}, error) {
+			return nil, fmt.Errorf("access denied")
+		})
+
+	testBar.Run(New())
+	testBar.NextOutput("on error").AssertError()
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ntp provides a bar module that shows whether the system clock is
+// synchronized, using chrony if it is running, or systemd-timedated
+// otherwise. Only chrony reports the offset of the system clock.
+package ntp // import "barista.run/modules/ntp"
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/colors"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents the synchronization state of the system clock.
+type Info struct {
+	// Daemon is the source of the information, "chrony" or "timedated".
+	Daemon string
+	// Synchronized is true if the clock is synchronized to a time source.
+	Synchronized bool
+	// Offset is how far the system clock is ahead of the time source, or
+	// negative if it is behind. Always 0 for timedated.
+	Offset time.Duration
+	// Server is the name or address of the reference time source, and Stratum
+	// is its NTP stratum. Only set for chrony.
+	Server  string
+	Stratum int
+	// Threshold is the offset beyond which the clock is considered wrong.
+	Threshold time.Duration
+}
+
+// OffsetExceeded returns true if the offset of the clock exceeds the
+// threshold in either direction.
+func (i Info) OffsetExceeded() bool {
+	return i.Offset > i.Threshold || i.Offset < -i.Threshold
+}
+
+// Healthy returns true if the clock is synchronized and within the threshold.
+func (i Info) Healthy() bool {
+	return i.Synchronized && !i.OffsetExceeded()
+}
+
+// Module represents a bar module that shows the clock synchronization state.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	threshold  value.Value     // of time.Duration
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a clock synchronization module, which refreshes every
+// minute and considers offsets over 100ms to be wrong.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "outputFunc", "threshold", "scheduler")
+	m.RefreshInterval(time.Minute)
+	m.Threshold(100 * time.Millisecond)
+	m.Output(func(i Info) bar.Output {
+		switch {
+		case !i.Synchronized:
+			return outputs.Text("NTP unsync").
+				Color(colors.Scheme("bad")).Urgent(true)
+		case i.Daemon == "timedated":
+			return outputs.Text("NTP ok")
+		default:
+			return outputs.Textf("NTP %s", formatOffset(i.Offset)).
+				Urgent(i.OffsetExceeded())
+		}
+	})
+	return m
+}
+
+// formatOffset formats an offset with a sign and a precision that depends on
+// its magnitude, e.g. "+1.234ms" or "-12µs".
+func formatOffset(d time.Duration) string {
+	sign := "+"
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	switch {
+	case d >= time.Second:
+		d = d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		d = d.Round(time.Microsecond)
+	}
+	return sign + d.String()
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Threshold sets the offset beyond which the clock is considered wrong.
+func (m *Module) Threshold(offset time.Duration) *Module {
+	m.threshold.Set(offset)
+	return m
+}
+
+// RefreshInterval configures the polling frequency.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextThreshold, done := m.threshold.Subscribe()
+	defer done()
+
+	info, err := getInfo()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		info.Threshold = m.threshold.Get().(time.Duration)
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info, err = getInfo()
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		case <-nextThreshold:
+		}
+	}
+}
+
+// Overridden in tests.
+var (
+	chronycTracking = func() ([]byte, error) {
+		return exec.Command("chronyc", "-c", "tracking").Output()
+	}
+	timedatectlSynced = func() ([]byte, error) {
+		return exec.Command("timedatectl", "show",
+			"--property=NTPSynchronized", "--value").Output()
+	}
+)
+
+func getInfo() (Info, error) {
+	i, chronyErr := chronyInfo()
+	if chronyErr == nil {
+		return i, nil
+	}
+	i, err := timedatedInfo()
+	if err == nil {
+		return i, nil
+	}
+	return Info{}, fmt.Errorf("chrony: %v, timedated: %v", chronyErr, err)
+}
+
+// chronyInfo parses the CSV output of 'chronyc -c tracking'. The fields are
+// the same as the regular output, documented in chronyc(1).
+func chronyInfo() (Info, error) {
+	out, err := chronycTracking()
+	if err != nil {
+		return Info{}, err
+	}
+	fields := strings.Split(strings.TrimSpace(string(out)), ",")
+	if len(fields) < 14 {
+		return Info{}, errors.New("unexpected tracking output")
+	}
+	i := Info{
+		Daemon:       "chrony",
+		Server:       fields[1],
+		Synchronized: fields[13] != "Not synchronised",
+	}
+	if i.Stratum, err = strconv.Atoi(fields[2]); err != nil {
+		return Info{}, err
+	}
+	// The 'System time' field is the correction that chronyd is applying,
+	// which is positive when the system clock is slow.
+	correction, err := strconv.ParseFloat(fields[4], 64)
+	if err != nil {
+		return Info{}, err
+	}
+	i.Offset = -time.Duration(correction * float64(time.Second))
+	return i, nil
+}
+
+// timedatedInfo queries the NTPSynchronized property of timedated using
+// timedatectl, which also starts timedated if it is not running.
+func timedatedInfo() (Info, error) {
+	out, err := timedatectlSynced()
+	if err != nil {
+		return Info{}, err
+	}
+	switch v := strings.TrimSpace(string(out)); v {
+	case "yes", "no":
+		return Info{Daemon: "timedated", Synchronized: v == "yes"}, nil
+	default:
+		return Info{}, fmt.Errorf("unexpected NTPSynchronized value %q", v)
+	}
+}
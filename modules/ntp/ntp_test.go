@@ -0,0 +1,156 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ntp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCommand struct {
+	sync.Mutex
+	out []byte
+	err error
+}
+
+func (f *fakeCommand) set(out string, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.out, f.err = []byte(out), err
+}
+
+func (f *fakeCommand) run() ([]byte, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.out, f.err
+}
+
+var chronyc, timedatectl fakeCommand
+
+func init() {
+	chronycTracking = chronyc.run
+	timedatectlSynced = timedatectl.run
+}
+
+const notRunning = "506 Cannot talk to daemon"
+
+func tracking(server, stratum, systemTime, leap string) string {
+	return "A9FEA97B," + server + "," + stratum + ",1609459200.123456789," +
+		systemTime + ",-0.000001234,0.000023456,-12.345,0.001,0.012," +
+		"0.000456,0.000123,64.2," + leap + "\n"
+}
+
+func TestChrony(t *testing.T) {
+	testBar.New(t)
+	chronyc.set(tracking("time.example.com", "2", "0.000012345", "Normal"), nil)
+	timedatectl.set("yes\n", nil)
+
+	testBar.Run(New())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"NTP -12.345µs"}, "prefers chrony")
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	chronyc.set(tracking("time.example.com", "2", "-0.1234567", "Normal"), nil)
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"NTP +123.457ms"}, "clock ahead")
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "offset above threshold")
+
+	chronyc.set(tracking("", "0", "2.5", "Not synchronised"), nil)
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"NTP unsync"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent)
+	col, _ := out.At(0).Segment().GetColor()
+	require.Equal(t, colors.Scheme("bad"), col)
+}
+
+func TestTimedated(t *testing.T) {
+	testBar.New(t)
+	chronyc.set(notRunning, errors.New("exit status 1"))
+	timedatectl.set("yes\n", nil)
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertText([]string{"NTP ok"})
+
+	timedatectl.set("no\n", nil)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"NTP unsync"})
+
+	timedatectl.set("", errors.New("timedatectl: not found"))
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestThreshold(t *testing.T) {
+	testBar.New(t)
+	chronyc.set(tracking("10.0.0.1", "3", "0.05", "Normal"), nil)
+
+	m := New().Threshold(time.Second).Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %s/%d %v %v %v", i.Daemon, i.Server, i.Stratum,
+			i.Offset, i.OffsetExceeded(), i.Healthy())
+	})
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText(
+		[]string{"chrony 10.0.0.1/3 -50ms false true"})
+
+	m.Threshold(10 * time.Millisecond)
+	testBar.NextOutput("on threshold change").AssertText(
+		[]string{"chrony 10.0.0.1/3 -50ms true false"})
+}
+
+func TestParseErrors(t *testing.T) {
+	timedatectl.set("", errors.New("not found"))
+	for _, out := range []string{
+		"",
+		"A9FEA97B,server,2\n",
+		tracking("server", "x", "0.1", "Normal"),
+		tracking("server", "2", "x", "Normal"),
+	} {
+		chronyc.set(out, nil)
+		_, err := getInfo()
+		require.Error(t, err, "chronyc output %q", out)
+	}
+	chronyc.set(notRunning, errors.New("exit status 1"))
+	timedatectl.set("maybe\n", nil)
+	_, err := getInfo()
+	require.Error(t, err, "unexpected timedatectl output")
+}
+
+func TestFormatOffset(t *testing.T) {
+	for _, tc := range []struct {
+		offset   time.Duration
+		expected string
+	}{
+		{0, "+0s"},
+		{12345 * time.Nanosecond, "+12.345µs"},
+		{-1234567 * time.Nanosecond, "-1.235ms"},
+		{2500123456 * time.Nanosecond, "+2.5s"},
+	} {
+		require.Equal(t, tc.expected, formatOffset(tc.offset))
+	}
+}
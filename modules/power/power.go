@@ -0,0 +1,282 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package power provides an i3bar module to display the current power draw,
+// using Intel RAPL energy counters and the battery discharge rate.
+package power // import "barista.run/modules/power"
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+)
+
+// Zone represents the power draw of a single RAPL zone.
+type Zone struct {
+	// Name is the name of the zone, e.g. "package-0", "core", "uncore",
+	// "dram", "psys". Sub-zones of each package have the same names.
+	Name  string
+	Power unit.Power
+}
+
+// Info represents the current power draw.
+type Info struct {
+	// Zones contains the power draw of each RAPL zone, keyed by the zone's
+	// powercap directory, e.g. "intel-rapl:0" or "intel-rapl:1:0".
+	Zones map[string]Zone
+	// Battery is the rate at which the battery is discharging, or 0 if the
+	// battery is not discharging or is unavailable.
+	Battery unit.Power
+	// Average is the rolling average of System() over the averaging window.
+	Average unit.Power
+}
+
+// Zone returns the total power drawn by all zones with the given name, e.g.
+// "core" for the cores of all packages.
+func (i Info) Zone(name string) unit.Power {
+	total := unit.Power(0)
+	for _, z := range i.Zones {
+		if z.Name == name {
+			total += z.Power
+		}
+	}
+	return total
+}
+
+// Package returns the total power drawn by all CPU packages.
+func (i Info) Package() unit.Power {
+	total := unit.Power(0)
+	for _, z := range i.Zones {
+		if strings.HasPrefix(z.Name, "package-") {
+			total += z.Power
+		}
+	}
+	return total
+}
+
+func (i Info) hasZone(name string) bool {
+	for _, z := range i.Zones {
+		if z.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// System returns the best available estimate of total system power draw: the
+// platform (psys) RAPL zone if available, otherwise the battery discharge
+// rate, falling back to CPU package power.
+func (i Info) System() unit.Power {
+	if i.hasZone("psys") {
+		return i.Zone("psys")
+	}
+	if i.Battery > 0 {
+		return i.Battery
+	}
+	return i.Package()
+}
+
+// Module represents a power draw bar module.
+type Module struct {
+	scheduler  *timing.Scheduler
+	window     value.Value     // of time.Duration
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// New constructs an instance of the power module.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "scheduler", "window", "outputFunc")
+	m.RefreshInterval(3 * time.Second)
+	m.AverageOver(time.Minute)
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%.1f W", i.Average.Watts())
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency. Since RAPL only provides
+// cumulative energy counters, power draw is averaged over this interval.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// AverageOver sets the window over which the rolling average is computed.
+func (m *Module) AverageOver(window time.Duration) *Module {
+	m.window.Set(window)
+	return m
+}
+
+var fs = afero.NewOsFs()
+
+const (
+	raplDir    = "/sys/class/powercap"
+	batteryDir = "/sys/class/power_supply"
+)
+
+// zone represents a single RAPL powercap zone. Zones are identified by their
+// directory, since sub-zone names are repeated for each package.
+type zone struct {
+	id       string
+	name     string
+	dir      string
+	maxRange uint64
+}
+
+type sample struct {
+	when  time.Time
+	power unit.Power
+}
+
+// Stream starts the module.
+func (m *Module) Stream(s bar.Sink) {
+	zones := raplZones()
+	lastRead := timing.Now()
+	lastEnergy := readEnergy(zones)
+
+	var info Info
+	var history []sample
+	available := false
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	for {
+		if available {
+			s.Output(outputFunc(info))
+		}
+		select {
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		case <-m.scheduler.C:
+			now := timing.Now()
+			energy := readEnergy(zones)
+			duration := now.Sub(lastRead).Seconds()
+			info = Info{Zones: map[string]Zone{}, Battery: batteryPower()}
+			for _, z := range zones {
+				curr, ok := energy[z.id]
+				last, lastOk := lastEnergy[z.id]
+				if !ok || !lastOk || duration <= 0 {
+					continue
+				}
+				delta := curr - last
+				if curr < last {
+					// Counter wrapped around.
+					delta = z.maxRange - last + curr
+				}
+				info.Zones[z.id] = Zone{
+					Name:  z.name,
+					Power: unit.Power(float64(delta)/duration/1e6) * unit.Watt,
+				}
+			}
+			lastRead, lastEnergy = now, energy
+
+			window := m.window.Get().(time.Duration)
+			history = append(history, sample{now, info.System()})
+			for len(history) > 1 && now.Sub(history[0].when) > window {
+				history = history[1:]
+			}
+			total := unit.Power(0)
+			for _, h := range history {
+				total += h.power
+			}
+			info.Average = total / unit.Power(len(history))
+			available = true
+		}
+	}
+}
+
+// raplZones returns all RAPL zones, including sub-zones (e.g. core, dram).
+func raplZones() []zone {
+	var zones []zone
+	dirs, _ := afero.Glob(fs, filepath.Join(raplDir, "intel-rapl:*"))
+	for _, dir := range dirs {
+		name, err := readString(filepath.Join(dir, "name"))
+		if err != nil {
+			continue
+		}
+		maxRange, _ := readUint(filepath.Join(dir, "max_energy_range_uj"))
+		zones = append(zones, zone{filepath.Base(dir), name, dir, maxRange})
+	}
+	return zones
+}
+
+// readEnergy reads the cumulative energy counter for each zone, in µJ, keyed
+// by zone id.
+func readEnergy(zones []zone) map[string]uint64 {
+	energy := map[string]uint64{}
+	for _, z := range zones {
+		if e, err := readUint(filepath.Join(z.dir, "energy_uj")); err == nil {
+			energy[z.id] = e
+		} else {
+			l.Fine("Failed to read RAPL zone %s (%s): %v", z.id, z.name, err)
+		}
+	}
+	return energy
+}
+
+// batteryPower returns the total discharge rate of all batteries.
+func batteryPower() unit.Power {
+	total := unit.Power(0)
+	dirs, _ := afero.Glob(fs, filepath.Join(batteryDir, "BAT*"))
+	for _, dir := range dirs {
+		status, _ := readString(filepath.Join(dir, "status"))
+		if status != "Discharging" {
+			continue
+		}
+		if uw, err := readUint(filepath.Join(dir, "power_now")); err == nil {
+			total += unit.Power(float64(uw)/1e6) * unit.Watt
+			continue
+		}
+		// Some batteries only report current and voltage.
+		ua, errA := readUint(filepath.Join(dir, "current_now"))
+		uv, errV := readUint(filepath.Join(dir, "voltage_now"))
+		if errA == nil && errV == nil {
+			total += unit.Power(float64(ua)*float64(uv)/1e12) * unit.Watt
+		}
+	}
+	return total
+}
+
+func readString(file string) (string, error) {
+	bytes, err := afero.ReadFile(fs, file)
+	return strings.TrimSpace(string(bytes)), err
+}
+
+func readUint(file string) (uint64, error) {
+	str, err := readString(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(str, 10, 64)
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package power
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func write(file string, value interface{}) {
+	afero.WriteFile(fs, file, []byte(fmt.Sprintf("%v\n", value)), 0644)
+}
+
+func setupRAPL() {
+	fs = afero.NewMemMapFs()
+	write(raplDir+"/intel-rapl:0/name", "package-0")
+	write(raplDir+"/intel-rapl:0/energy_uj", 1000000)
+	write(raplDir+"/intel-rapl:0/max_energy_range_uj", 262143328850)
+	write(raplDir+"/intel-rapl:0:0/name", "core")
+	write(raplDir+"/intel-rapl:0:0/energy_uj", 500000)
+	write(raplDir+"/intel-rapl:0:0/max_energy_range_uj", 262143328850)
+}
+
+func TestRAPL(t *testing.T) {
+	setupRAPL()
+	testBar.New(t)
+
+	m := New().RefreshInterval(time.Second).AverageOver(2 * time.Second)
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%.1f %.1f %.1f %.1f",
+			i.Package().Watts(), i.Zone("core").Watts(),
+			i.System().Watts(), i.Average.Watts())
+	})
+	testBar.Run(m)
+	testBar.AssertNoOutput("until first sample")
+
+	write(raplDir+"/intel-rapl:0/energy_uj", 11000000)
+	write(raplDir+"/intel-rapl:0:0/energy_uj", 4500000)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"10.0 4.0 10.0 10.0"})
+
+	write(raplDir+"/intel-rapl:0/energy_uj", 17000000)
+	write(raplDir+"/intel-rapl:0:0/energy_uj", 6500000)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"6.0 2.0 6.0 8.0"})
+
+	write(raplDir+"/intel-rapl:0/energy_uj", 19000000)
+	write(raplDir+"/intel-rapl:0:0/energy_uj", 7500000)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"2.0 1.0 2.0 6.0"})
+
+	write(raplDir+"/intel-rapl:0/energy_uj", 21000000)
+	write(raplDir+"/intel-rapl:0:0/energy_uj", 8500000)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"2.0 1.0 2.0 3.3"},
+		"old samples dropped from average")
+}
+
+func TestMultiplePackages(t *testing.T) {
+	setupRAPL()
+	write(raplDir+"/intel-rapl:1/name", "package-1")
+	write(raplDir+"/intel-rapl:1/energy_uj", 0)
+	write(raplDir+"/intel-rapl:1:0/name", "core")
+	write(raplDir+"/intel-rapl:1:0/energy_uj", 0)
+	testBar.New(t)
+
+	var info Info
+	m := New().RefreshInterval(time.Second).Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Textf("%.1f %.1f", i.Package().Watts(), i.Zone("core").Watts())
+	})
+	testBar.Run(m)
+	testBar.AssertNoOutput("until first sample")
+
+	write(raplDir+"/intel-rapl:0/energy_uj", 11000000)
+	write(raplDir+"/intel-rapl:0:0/energy_uj", 4500000)
+	write(raplDir+"/intel-rapl:1/energy_uj", 5000000)
+	write(raplDir+"/intel-rapl:1:0/energy_uj", 3000000)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"15.0 7.0"},
+		"sub-zones of each package are counted separately")
+	require.Equal(t, map[string]Zone{
+		"intel-rapl:0":   {"package-0", 10 * unit.Watt},
+		"intel-rapl:0:0": {"core", 4 * unit.Watt},
+		"intel-rapl:1":   {"package-1", 5 * unit.Watt},
+		"intel-rapl:1:0": {"core", 3 * unit.Watt},
+	}, info.Zones)
+}
+
+func TestWraparound(t *testing.T) {
+	setupRAPL()
+	write(raplDir+"/intel-rapl:0/energy_uj", 262143328850-1000000)
+	testBar.New(t)
+
+	m := New().RefreshInterval(time.Second).Output(func(i Info) bar.Output {
+		return outputs.Textf("%.1f", i.Package().Watts())
+	})
+	testBar.Run(m)
+	testBar.AssertNoOutput("until first sample")
+
+	write(raplDir+"/intel-rapl:0/energy_uj", 2000000)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"3.0"}, "on counter wraparound")
+
+	fs.Remove(raplDir + "/intel-rapl:0/energy_uj")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"0.0"}, "on read error")
+}
+
+func TestBatteryAndPsys(t *testing.T) {
+	setupRAPL()
+	write(batteryDir+"/BAT0/status", "Discharging")
+	write(batteryDir+"/BAT0/power_now", 7500000)
+	write(batteryDir+"/BAT1/status", "Discharging")
+	write(batteryDir+"/BAT1/current_now", 500000)
+	write(batteryDir+"/BAT1/voltage_now", 11000000)
+	testBar.New(t)
+
+	output := func(i Info) bar.Output {
+		return outputs.Textf("%.1f %.1f", i.Battery.Watts(), i.System().Watts())
+	}
+	testBar.Run(New().Output(output))
+	testBar.AssertNoOutput("until first sample")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"13.0 13.0"},
+		"battery preferred over package")
+
+	write(batteryDir+"/BAT0/status", "Charging")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"5.5 5.5"})
+
+	write(batteryDir+"/BAT1/status", "Full")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"0.0 0.0"},
+		"package power without battery")
+
+	write(raplDir+"/intel-rapl:1/name", "psys")
+	write(raplDir+"/intel-rapl:1/energy_uj", 0)
+	write(batteryDir+"/BAT0/status", "Discharging")
+	testBar.New(t)
+	testBar.Run(New().Output(output))
+	testBar.AssertNoOutput("until first sample")
+	write(raplDir+"/intel-rapl:1/energy_uj", 3*25000000)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"7.5 25.0"},
+		"psys preferred over battery")
+}
+
+func TestDefaultOutput(t *testing.T) {
+	setupRAPL()
+	testBar.New(t)
+	testBar.Run(New())
+	testBar.AssertNoOutput("until first sample")
+	write(raplDir+"/intel-rapl:0/energy_uj", 1000000+3*12500000)
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"12.5 W"})
+}
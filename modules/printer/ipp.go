@@ -0,0 +1,263 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"barista.run/base/httpclient"
+)
+
+// IPP operations used by the module. See RFC 8011 and the CUPS
+// implementation of IPP (https://www.cups.org/doc/spec-ipp.html).
+const (
+	opCancelJob       uint16 = 0x0008
+	opGetJobs         uint16 = 0x000A
+	opCUPSGetPrinters uint16 = 0x4002
+)
+
+// IPP delimiter and value tags.
+const (
+	tagOperation byte = 0x01
+	tagJob       byte = 0x02
+	tagEnd       byte = 0x03
+	tagPrinter   byte = 0x04
+
+	tagInteger  byte = 0x21
+	tagBoolean  byte = 0x22
+	tagEnum     byte = 0x23
+	tagText     byte = 0x41
+	tagName     byte = 0x42
+	tagKeyword  byte = 0x44
+	tagURI      byte = 0x45
+	tagCharset  byte = 0x47
+	tagLanguage byte = 0x48
+)
+
+// ippAttribute is an attribute in an IPP request. Values must be strings for
+// string tags, int for integer and enum tags, and bool for boolean tags.
+type ippAttribute struct {
+	tag    byte
+	name   string
+	values []interface{}
+}
+
+func attr(tag byte, name string, values ...interface{}) ippAttribute {
+	return ippAttribute{tag, name, values}
+}
+
+// ippGroup is a group of attributes in an IPP response, e.g. for one job.
+type ippGroup struct {
+	tag   byte
+	attrs map[string][]interface{}
+}
+
+func (g ippGroup) str(name string) string {
+	if v := g.attrs[name]; len(v) > 0 {
+		s, _ := v[0].(string)
+		return s
+	}
+	return ""
+}
+
+func (g ippGroup) strs(name string) []string {
+	var r []string
+	for _, v := range g.attrs[name] {
+		if s, ok := v.(string); ok {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+func (g ippGroup) int(name string) int {
+	if v := g.attrs[name]; len(v) > 0 {
+		i, _ := v[0].(int)
+		return i
+	}
+	return 0
+}
+
+func (g ippGroup) bool(name string) bool {
+	if v := g.attrs[name]; len(v) > 0 {
+		b, _ := v[0].(bool)
+		return b
+	}
+	return false
+}
+
+// encodeRequest encodes an IPP/1.1 request. The required charset and language
+// attributes are added before the given operation attributes.
+func encodeRequest(op uint16, id uint32, attrs ...ippAttribute) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{1, 1})
+	binary.Write(&b, binary.BigEndian, op)
+	binary.Write(&b, binary.BigEndian, id)
+	b.WriteByte(tagOperation)
+	attrs = append([]ippAttribute{
+		attr(tagCharset, "attributes-charset", "utf-8"),
+		attr(tagLanguage, "attributes-natural-language", "en"),
+	}, attrs...)
+	for _, a := range attrs {
+		for i, v := range a.values {
+			name := a.name
+			if i > 0 {
+				// Additional values of the same attribute have no name.
+				name = ""
+			}
+			b.WriteByte(a.tag)
+			binary.Write(&b, binary.BigEndian, uint16(len(name)))
+			b.WriteString(name)
+			var val []byte
+			switch v := v.(type) {
+			case string:
+				val = []byte(v)
+			case int:
+				val = make([]byte, 4)
+				binary.BigEndian.PutUint32(val, uint32(v))
+			case bool:
+				val = []byte{0}
+				if v {
+					val[0] = 1
+				}
+			}
+			binary.Write(&b, binary.BigEndian, uint16(len(val)))
+			b.Write(val)
+		}
+	}
+	b.WriteByte(tagEnd)
+	return b.Bytes()
+}
+
+var errMalformed = errors.New("malformed IPP response")
+
+// decodeResponse decodes an IPP response, returning the status code and all
+// attribute groups.
+func decodeResponse(data []byte) (status uint16, groups []ippGroup, err error) {
+	r := bytes.NewReader(data)
+	var header struct {
+		Version [2]byte
+		Status  uint16
+		ID      uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return 0, nil, errMalformed
+	}
+	var group *ippGroup
+	var lastName string
+	for {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, errMalformed
+		}
+		if tag == tagEnd {
+			return header.Status, groups, nil
+		}
+		if tag < 0x10 {
+			groups = append(groups, ippGroup{tag, map[string][]interface{}{}})
+			group = &groups[len(groups)-1]
+			continue
+		}
+		name, err := readString(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		val, err := readString(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		if group == nil {
+			return 0, nil, errMalformed
+		}
+		if name == "" {
+			name = lastName
+		}
+		lastName = name
+		group.attrs[name] = append(group.attrs[name], decodeValue(tag, val))
+	}
+}
+
+func readString(r io.Reader) (string, error) {
+	var l uint16
+	if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+		return "", errMalformed
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", errMalformed
+	}
+	return string(b), nil
+}
+
+func decodeValue(tag byte, val string) interface{} {
+	switch {
+	case (tag == tagInteger || tag == tagEnum) && len(val) == 4:
+		return int(int32(binary.BigEndian.Uint32([]byte(val))))
+	case tag == tagBoolean && len(val) == 1:
+		return val[0] != 0
+	case tag >= 0x40 && tag < 0x60:
+		// Character-string values (text, name, keyword, uri, etc.)
+		return val
+	}
+	// Other values, such as dates and resolutions, are not needed.
+	return []byte(val)
+}
+
+// ippStatusError is returned for IPP responses that do not indicate success.
+type ippStatusError uint16
+
+func (e ippStatusError) Error() string {
+	return fmt.Sprintf("IPP error 0x%04x", uint16(e))
+}
+
+// request sends an IPP request to the given URL, and returns the groups of
+// the given type from the response.
+func request(url string, op uint16, groupTag byte, attrs ...ippAttribute) ([]ippGroup, error) {
+	resp, err := httpclient.Client().Post(url, "application/ipp",
+		bytes.NewReader(encodeRequest(op, 1, attrs...)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	status, groups, err := decodeResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	// 0x0000-0x00FF are successful status codes, with 0x0406 (not-found)
+	// returned by CUPS when there are no jobs or printers.
+	if status > 0x00FF && status != 0x0406 {
+		return nil, ippStatusError(status)
+	}
+	var r []ippGroup
+	for _, g := range groups {
+		if g.tag == groupTag {
+			r = append(r, g)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// ippValue is a value in an IPP response built by tests.
+type ippValue struct {
+	tag  byte
+	name string
+	val  interface{}
+}
+
+// encodeResponse encodes an IPP response with the given groups, each group
+// starting with a delimiter tag and followed by values.
+func encodeResponse(status uint16, groups ...[]ippValue) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{1, 1})
+	binary.Write(&b, binary.BigEndian, status)
+	binary.Write(&b, binary.BigEndian, uint32(1))
+	for _, g := range groups {
+		b.WriteByte(g[0].tag)
+		for _, v := range g[1:] {
+			// Reuse request encoding for individual values, removing the
+			// header, operation tag, charset and language, and end tag.
+			enc := encodeRequest(0, 0, attr(v.tag, v.name, v.val))
+			b.Write(enc[9+len(charsetAndLanguage) : len(enc)-1])
+		}
+	}
+	b.WriteByte(tagEnd)
+	return b.Bytes()
+}
+
+var charsetAndLanguage = encodeRequest(0, 0)[9 : len(encodeRequest(0, 0))-1]
+
+func group(tag byte, values ...ippValue) []ippValue {
+	return append([]ippValue{{tag: tag}}, values...)
+}
+
+func TestEncodeRequest(t *testing.T) {
+	req := encodeRequest(opGetJobs, 7,
+		attr(tagURI, "printer-uri", "ipp://localhost/"),
+		attr(tagKeyword, "requested-attributes", "job-id", "job-name"),
+		attr(tagInteger, "limit", 5),
+		attr(tagBoolean, "my-jobs", true))
+	require.Equal(t, []byte{1, 1, 0x00, 0x0A, 0, 0, 0, 7, tagOperation}, req[:9])
+	require.Equal(t, []byte{tagEnd}, req[len(req)-1:])
+	expected := []byte{
+		tagCharset, 0, 18}
+	expected = append(expected, "attributes-charset"...)
+	expected = append(expected, 0, 5)
+	expected = append(expected, "utf-8"...)
+	require.Equal(t, expected, req[9:9+len(expected)])
+
+	// Requests have the same structure as responses, with the operation
+	// instead of the status code.
+	op, groups, err := decodeResponse(req)
+	require.NoError(t, err)
+	require.Equal(t, opGetJobs, op)
+	require.Equal(t, []ippGroup{{tagOperation, map[string][]interface{}{
+		"attributes-charset":          {"utf-8"},
+		"attributes-natural-language": {"en"},
+		"printer-uri":                 {"ipp://localhost/"},
+		"requested-attributes":        {"job-id", "job-name"},
+		"limit":                       {5},
+		"my-jobs":                     {true},
+	}}}, groups)
+}
+
+func TestDecodeResponse(t *testing.T) {
+	resp := encodeResponse(0x0001,
+		group(tagOperation, ippValue{tagCharset, "attributes-charset", "utf-8"}),
+		group(tagJob,
+			ippValue{tagInteger, "job-id", 12},
+			ippValue{tagEnum, "job-state", -1},
+			ippValue{0x31, "date-time-at-creation", "01234567890"}),
+		group(tagJob, ippValue{tagInteger, "job-id", 13}))
+	status, groups, err := decodeResponse(resp)
+	require.NoError(t, err)
+	require.Equal(t, uint16(1), status)
+	require.Len(t, groups, 3)
+	require.Equal(t, 12, groups[1].int("job-id"))
+	require.Equal(t, -1, groups[1].int("job-state"))
+	require.Equal(t, []interface{}{[]byte("01234567890")},
+		groups[1].attrs["date-time-at-creation"])
+	require.Equal(t, "", groups[1].str("job-id"), "wrong type")
+	require.Equal(t, 0, groups[1].int("job-name"), "missing")
+	require.False(t, groups[1].bool("job-id"))
+	require.Equal(t, 13, groups[2].int("job-id"))
+
+	for _, bad := range [][]byte{
+		{},
+		resp[:8],
+		resp[:len(resp)-1],
+		resp[:12],
+		append([]byte{1, 1, 0, 0, 0, 0, 0, 1}, tagInteger, 0, 0, 0, 0, tagEnd),
+	} {
+		_, _, err := decodeResponse(bad)
+		require.Equal(t, errMalformed, err, "%v", bad)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package printer provides a bar module that shows the print queue and
+// printer state from CUPS, using IPP.
+package printer // import "barista.run/modules/printer"
+
+import (
+	"net/url"
+	"os/exec"
+	"os/user"
+	"path"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// PrinterState is the state of a printer.
+type PrinterState int
+
+// Printer states defined by IPP.
+const (
+	PrinterIdle       PrinterState = 3
+	PrinterProcessing PrinterState = 4
+	PrinterStopped    PrinterState = 5
+)
+
+// JobState is the state of a print job.
+type JobState int
+
+// Job states defined by IPP. Only pending, held, processing, and stopped jobs
+// are included in the queue.
+const (
+	JobPending    JobState = 3
+	JobHeld       JobState = 4
+	JobProcessing JobState = 5
+	JobStopped    JobState = 6
+	JobCanceled   JobState = 7
+	JobAborted    JobState = 8
+	JobCompleted  JobState = 9
+)
+
+// Printer represents a printer (or class) configured in CUPS.
+type Printer struct {
+	Name  string
+	State PrinterState
+	// Message is a human-readable description of the state, if any.
+	Message string
+	// Reasons are keywords for the state, e.g. "media-empty-error".
+	Reasons   []string
+	Accepting bool
+}
+
+// Job represents a print job in the queue.
+type Job struct {
+	ID      int
+	Name    string
+	User    string
+	Printer string
+	State   JobState
+	Reasons []string
+
+	uri string
+	m   *Module
+}
+
+// Cancel cancels the print job. Canceling jobs owned by other users usually
+// requires authentication, which is not supported.
+func (j Job) Cancel() {
+	if err := j.m.cancel(j); err != nil {
+		l.Log("Failed to cancel job %d: %v", j.ID, err)
+	}
+}
+
+// Info represents the state of all printers and the print queue.
+type Info struct {
+	Printers []Printer
+	// Jobs are all jobs that have not completed, in queue order.
+	Jobs []Job
+
+	m *Module
+}
+
+// Printer returns the printer with the given name, if it exists.
+func (i Info) Printer(name string) (Printer, bool) {
+	for _, p := range i.Printers {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Printer{}, false
+}
+
+// Failed returns the jobs that were stopped by an error, or are queued on a
+// stopped printer.
+func (i Info) Failed() []Job {
+	var failed []Job
+	for _, j := range i.Jobs {
+		p, _ := i.Printer(j.Printer)
+		if j.State == JobStopped || p.State == PrinterStopped {
+			failed = append(failed, j)
+		}
+	}
+	return failed
+}
+
+// Stalled returns true if any jobs cannot be printed without intervention.
+func (i Info) Stalled() bool { return len(i.Failed()) > 0 }
+
+// OpenWebUI opens the CUPS web interface in the default browser.
+func (i Info) OpenWebUI() {
+	if err := openURL(i.m.server); err != nil {
+		l.Log("Failed to open %s: %v", i.m.server, err)
+	}
+}
+
+// Module represents a bar module that shows the CUPS print queue.
+type Module struct {
+	server     string
+	uri        string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+	refreshCh  chan struct{}
+}
+
+// New constructs a printer module for the local CUPS server.
+func New() *Module {
+	return Server("http://localhost:631")
+}
+
+// Server constructs a printer module for the CUPS server at the given URL,
+// which is also used for the web interface.
+func Server(server string) *Module {
+	m := &Module{
+		server:    strings.TrimSuffix(server, "/") + "/",
+		scheduler: timing.NewScheduler().Every(10 * time.Second),
+		refreshCh: make(chan struct{}, 1),
+	}
+	m.uri = m.server
+	if u, err := url.Parse(m.server); err == nil {
+		u.Scheme = strings.Replace(u.Scheme, "http", "ipp", 1)
+		m.uri = u.String()
+	}
+	l.Label(m, server)
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		if len(i.Jobs) == 0 {
+			return nil
+		}
+		out := outputs.Textf("PRN %d", len(i.Jobs))
+		handler := click.Map{}.Left(i.OpenWebUI)
+		if failed := i.Failed(); len(failed) > 0 {
+			out.Urgent(true)
+			handler = handler.Middle(failed[0].Cancel)
+		}
+		return out.OnClick(handler.Handle)
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	info, err := m.getInfo()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info, err = m.getInfo()
+		case <-m.refreshCh:
+			info, err = m.getInfo()
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// Overridden in tests.
+var (
+	openURL = func(url string) error {
+		return exec.Command("xdg-open", url).Run()
+	}
+	currentUser = func() string {
+		if u, err := user.Current(); err == nil {
+			return u.Username
+		}
+		return "barista"
+	}
+)
+
+func (m *Module) getInfo() (Info, error) {
+	i := Info{m: m}
+	printers, err := request(m.server, opCUPSGetPrinters, tagPrinter,
+		attr(tagName, "requesting-user-name", currentUser()),
+		attr(tagKeyword, "requested-attributes",
+			"printer-name", "printer-state", "printer-state-message",
+			"printer-state-reasons", "printer-is-accepting-jobs"))
+	if err != nil {
+		return i, err
+	}
+	for _, g := range printers {
+		i.Printers = append(i.Printers, Printer{
+			Name:      g.str("printer-name"),
+			State:     PrinterState(g.int("printer-state")),
+			Message:   g.str("printer-state-message"),
+			Reasons:   g.strs("printer-state-reasons"),
+			Accepting: g.bool("printer-is-accepting-jobs"),
+		})
+	}
+	jobs, err := request(m.server, opGetJobs, tagJob,
+		attr(tagURI, "printer-uri", m.uri),
+		attr(tagName, "requesting-user-name", currentUser()),
+		attr(tagKeyword, "which-jobs", "not-completed"),
+		attr(tagKeyword, "requested-attributes",
+			"job-id", "job-uri", "job-name", "job-originating-user-name",
+			"job-printer-uri", "job-state", "job-state-reasons"))
+	if err != nil {
+		return i, err
+	}
+	for _, g := range jobs {
+		i.Jobs = append(i.Jobs, Job{
+			ID:      g.int("job-id"),
+			Name:    g.str("job-name"),
+			User:    g.str("job-originating-user-name"),
+			Printer: path.Base(g.str("job-printer-uri")),
+			State:   JobState(g.int("job-state")),
+			Reasons: g.strs("job-state-reasons"),
+			uri:     g.str("job-uri"),
+			m:       m,
+		})
+	}
+	return i, nil
+}
+
+func (m *Module) cancel(j Job) error {
+	_, err := request(m.server+"jobs/", opCancelJob, tagOperation,
+		attr(tagURI, "job-uri", j.uri),
+		attr(tagName, "requesting-user-name", currentUser()))
+	select {
+	case m.refreshCh <- struct{}{}:
+	default:
+	}
+	return err
+}
@@ -0,0 +1,198 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeJob struct {
+	id      int
+	printer string
+	state   JobState
+}
+
+type fakeCUPS struct {
+	*httptest.Server
+	sync.Mutex
+	status   uint16
+	printers map[string]PrinterState
+	jobs     []fakeJob
+	canceled chan string
+}
+
+func (f *fakeCUPS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := ioutil.ReadAll(r.Body)
+	op, groups, err := decodeResponse(data)
+	if err != nil || r.Header.Get("Content-Type") != "application/ipp" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	opGroup := group(tagOperation, ippValue{tagCharset, "attributes-charset", "utf-8"})
+	resp := [][]ippValue{opGroup}
+	switch op {
+	case opCUPSGetPrinters:
+		for name, state := range f.printers {
+			resp = append(resp, group(tagPrinter,
+				ippValue{tagName, "printer-name", name},
+				ippValue{tagEnum, "printer-state", int(state)},
+				ippValue{tagText, "printer-state-message", "state of " + name},
+				ippValue{tagKeyword, "printer-state-reasons", "none"},
+				ippValue{tagBoolean, "printer-is-accepting-jobs", true}))
+		}
+	case opGetJobs:
+		if groups[0].str("which-jobs") != "not-completed" ||
+			groups[0].str("printer-uri") != "ipp"+f.URL[4:]+"/" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, j := range f.jobs {
+			resp = append(resp, group(tagJob,
+				ippValue{tagInteger, "job-id", j.id},
+				ippValue{tagURI, "job-uri", "ipp://localhost/jobs/" + strconv.Itoa(j.id)},
+				ippValue{tagName, "job-name", "doc.pdf"},
+				ippValue{tagName, "job-originating-user-name", "user"},
+				ippValue{tagURI, "job-printer-uri", "ipp://localhost/printers/" + j.printer},
+				ippValue{tagEnum, "job-state", int(j.state)},
+				ippValue{tagKeyword, "job-state-reasons", "none"}))
+		}
+	case opCancelJob:
+		f.canceled <- r.URL.Path + " " + groups[0].str("job-uri")
+		for i, j := range f.jobs {
+			if groups[0].str("job-uri") == "ipp://localhost/jobs/"+strconv.Itoa(j.id) {
+				f.jobs = append(f.jobs[:i], f.jobs[i+1:]...)
+				break
+			}
+		}
+	}
+	w.Write(encodeResponse(f.status, resp...))
+}
+
+func newFakeCUPS() *fakeCUPS {
+	f := &fakeCUPS{
+		printers: map[string]PrinterState{},
+		canceled: make(chan string, 10),
+	}
+	f.Server = httptest.NewServer(f)
+	return f
+}
+
+func TestPrinter(t *testing.T) {
+	testBar.New(t)
+	f := newFakeCUPS()
+	defer f.Close()
+	f.printers["laser"] = PrinterIdle
+	opened := make(chan string, 1)
+	openURL = func(url string) error {
+		opened <- url
+		return nil
+	}
+
+	testBar.Run(Server(f.URL))
+	testBar.NextOutput("on start").AssertEmpty("no jobs")
+
+	f.Lock()
+	f.printers["laser"] = PrinterProcessing
+	f.jobs = []fakeJob{{1, "laser", JobProcessing}, {2, "laser", JobPending}}
+	f.Unlock()
+	testBar.Tick()
+	out := testBar.NextOutput("on jobs")
+	out.AssertText([]string{"PRN 2"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	out.At(0).LeftClick()
+	require.Equal(t, f.URL+"/", <-opened)
+
+	f.Lock()
+	f.printers["laser"] = PrinterStopped
+	f.Unlock()
+	testBar.Tick()
+	out = testBar.NextOutput("on stopped printer")
+	out.AssertText([]string{"PRN 2"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "stalled queue")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonMiddle})
+	require.Equal(t, "/jobs/ ipp://localhost/jobs/1", <-f.canceled)
+	testBar.NextOutput("on cancel").AssertText([]string{"PRN 1"})
+
+	f.Lock()
+	f.status = 0x0500
+	f.Unlock()
+	testBar.Tick()
+	testBar.NextOutput("on server error").AssertError()
+}
+
+func TestCustomOutput(t *testing.T) {
+	testBar.New(t)
+	f := newFakeCUPS()
+	defer f.Close()
+	f.printers["laser"] = PrinterIdle
+	f.printers["inkjet"] = PrinterIdle
+	f.jobs = []fakeJob{{3, "inkjet", JobStopped}, {4, "laser", JobHeld}}
+
+	infos := make(chan Info, 10)
+	testBar.Run(Server(f.URL + "/").Output(func(i Info) bar.Output {
+		infos <- i
+		return outputs.Textf("%d/%d", len(i.Failed()), len(i.Jobs))
+	}))
+	testBar.NextOutput("on start").AssertText([]string{"1/2"})
+	i := <-infos
+	require.True(t, i.Stalled())
+	p, ok := i.Printer("inkjet")
+	require.True(t, ok)
+	require.Equal(t, Printer{"inkjet", PrinterIdle, "state of inkjet", []string{"none"}, true}, p)
+	_, ok = i.Printer("other")
+	require.False(t, ok)
+	require.Equal(t, Job{
+		ID: 4, Name: "doc.pdf", User: "user", Printer: "laser",
+		State: JobHeld, Reasons: []string{"none"},
+		uri: "ipp://localhost/jobs/4", m: i.m,
+	}, i.Jobs[1])
+
+	i.Jobs[1].Cancel()
+	<-f.canceled
+	testBar.NextOutput("on cancel").AssertText([]string{"1/1"})
+}
+
+func TestErrors(t *testing.T) {
+	testBar.New(t)
+	f := newFakeCUPS()
+	f.Close()
+	testBar.Run(Server(f.URL))
+	testBar.NextOutput("when not running").AssertError()
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not ipp"))
+	}))
+	defer bad.Close()
+	testBar.New(t)
+	testBar.Run(Server(bad.URL))
+	testBar.NextOutput("on malformed response").AssertError()
+}
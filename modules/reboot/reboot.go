@@ -0,0 +1,242 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reboot provides a bar module that shows when a reboot is needed,
+// either because a newer kernel has been installed than the one running, or
+// because the package manager has requested a reboot (Debian and Ubuntu's
+// /var/run/reboot-required). It updates whenever packages are installed.
+package reboot // import "barista.run/modules/reboot"
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/watchers/file"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+)
+
+// Info represents whether a reboot is needed, and why.
+type Info struct {
+	// Running is the release of the running kernel, e.g. "4.16.13-2-ARCH".
+	Running string
+	// Latest is the release of the newest installed kernel, or empty if
+	// installed kernels could not be determined.
+	Latest string
+	// Flagged is true if the package manager requested a reboot.
+	Flagged bool
+	// Packages lists the packages that requested a reboot, if known.
+	Packages []string
+}
+
+// KernelUpdated returns true if the newest installed kernel is not the one
+// that is currently running.
+func (i Info) KernelUpdated() bool {
+	return i.Latest != "" && i.Latest != i.Running
+}
+
+// Required returns true if a reboot is needed.
+func (i Info) Required() bool {
+	return i.Flagged || i.KernelUpdated()
+}
+
+// Module represents a bar module that shows when a reboot is needed.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// New constructs a module that shows when a reboot is needed. By default, it
+// shows nothing unless a reboot is required.
+func New() *Module {
+	m := &Module{}
+	l.Register(m, "outputFunc")
+	m.Output(func(i Info) bar.Output {
+		if !i.Required() {
+			return nil
+		}
+		return outputs.Text("REBOOT")
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Overridden in tests.
+var (
+	osRelease      = "/proc/sys/kernel/osrelease"
+	modulesDir     = "/lib/modules"
+	rebootRequired = "/var/run/reboot-required"
+	// Files that change when packages are installed or removed, for the
+	// package managers that are commonly used.
+	packageFiles = []string{
+		"/var/lib/pacman/db.lck",
+		"/var/lib/dpkg/status",
+		"/var/lib/rpm/rpmdb.sqlite",
+	}
+)
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	notifyFn, updates := notifier.New()
+	errs := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, f := range append([]string{rebootRequired}, packageFiles...) {
+		w := file.Watch(f)
+		defer w.Unsubscribe()
+		go forward(w, notifyFn, errs, stop)
+	}
+
+	info, err := getInfo()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(info))
+		select {
+		case <-updates:
+			info, err = getInfo()
+		case err = <-errs:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// forward calls notifyFn on any updates from the file watcher, and sends the
+// first error (if any) to errs.
+func forward(w *file.Watcher, notifyFn func(), errs chan<- error, stop <-chan struct{}) {
+	if err := w.Forward(notifyFn, stop); err != nil {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+}
+
+func getInfo() (i Info, err error) {
+	release, err := ioutil.ReadFile(osRelease)
+	if err != nil {
+		return i, err
+	}
+	i.Running = strings.TrimSpace(string(release))
+	i.Latest, err = latestKernel()
+	if err != nil {
+		return i, err
+	}
+	if _, err := os.Stat(rebootRequired); err == nil {
+		i.Flagged = true
+		i.Packages = readLines(rebootRequired + ".pkgs")
+	}
+	return i, nil
+}
+
+// latestKernel returns the release of the newest kernel with modules
+// installed. Directories without a modules.dep are ignored, since they are
+// usually left over from kernels that have been removed.
+func latestKernel() (string, error) {
+	dirs, err := ioutil.ReadDir(modulesDir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(modulesDir, d.Name(), "modules.dep")); err != nil {
+			continue
+		}
+		if latest == "" || compareVersions(d.Name(), latest) > 0 {
+			latest = d.Name()
+		}
+	}
+	return latest, nil
+}
+
+func readLines(filename string) []string {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var lines []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// compareVersions compares two kernel releases, treating runs of digits as
+// numbers so that "4.9" sorts before "4.10". The result is -1, 0, or 1, like
+// strings.Compare.
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		var x, y string
+		x, a = nextPart(a)
+		y, b = nextPart(b)
+		if c := comparePart(x, y); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// nextPart splits off the leading run of digits or non-digits from s.
+func nextPart(s string) (part, rest string) {
+	i := 1
+	for i < len(s) && isDigit(s[i]) == isDigit(s[0]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func comparePart(x, y string) int {
+	if !isDigit(x[0]) || !isDigit(y[0]) {
+		return strings.Compare(x, y)
+	}
+	x = strings.TrimLeft(x, "0")
+	y = strings.TrimLeft(y, "0")
+	switch {
+	case len(x) < len(y):
+		return -1
+	case len(x) > len(y):
+		return 1
+	}
+	return strings.Compare(x, y)
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reboot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Modules from earlier tests may still be running, so all tests share a single
+// directory and only change its contents.
+var root string
+
+const wait = 500 * time.Millisecond
+
+func init() {
+	var err error
+	root, err = ioutil.TempDir("", "reboot")
+	if err != nil {
+		panic(err)
+	}
+	osRelease = filepath.Join(root, "osrelease")
+	modulesDir = filepath.Join(root, "modules")
+	rebootRequired = filepath.Join(root, "run", "reboot-required")
+	packageFiles = []string{filepath.Join(root, "pacman", "db.lck")}
+}
+
+func reset(t *testing.T, running string, installed ...string) {
+	testBar.New(t)
+	require.NoError(t, os.RemoveAll(modulesDir))
+	for _, f := range []string{rebootRequired, packageFiles[0]} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(f), 0755))
+		os.Remove(f)
+	}
+	os.Remove(rebootRequired + ".pkgs")
+	require.NoError(t, ioutil.WriteFile(osRelease, []byte(running+"\n"), 0644))
+	for _, k := range installed {
+		installKernel(t, k)
+	}
+}
+
+func installKernel(t *testing.T, release string) {
+	dir := filepath.Join(modulesDir, release)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "modules.dep"), nil, 0644))
+}
+
+func runPackageManager(t *testing.T) {
+	lock := packageFiles[0]
+	require.NoError(t, ioutil.WriteFile(lock, nil, 0644))
+	require.NoError(t, os.Remove(lock))
+}
+
+func TestKernelUpdate(t *testing.T) {
+	reset(t, "4.16.13-1-ARCH", "4.16.13-1-ARCH")
+	m := New()
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertEmpty("when running latest kernel")
+
+	installKernel(t, "4.16.13-2-ARCH")
+	// Leftover module directories from removed kernels are ignored.
+	require.NoError(t, os.MkdirAll(filepath.Join(modulesDir, "4.17.0-1-ARCH"), 0755))
+	runPackageManager(t)
+	testBar.Drain(wait, "on package install").AssertText([]string{"REBOOT"})
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%s -> %s", i.Running, i.Latest)
+	})
+	testBar.NextOutput("on output change").AssertText(
+		[]string{"4.16.13-1-ARCH -> 4.16.13-2-ARCH"})
+}
+
+func TestRebootRequired(t *testing.T) {
+	reset(t, "4.15.0-23-generic", "4.15.0-9-generic", "4.15.0-23-generic")
+	testBar.Run(New().Output(func(i Info) bar.Output {
+		return outputs.Textf("%v %v %v", i.KernelUpdated(), i.Flagged, i.Packages)
+	}))
+	testBar.NextOutput("on start").AssertText([]string{"false false []"})
+
+	require.NoError(t, ioutil.WriteFile(rebootRequired+".pkgs", []byte("libc6\n\ndbus\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(rebootRequired, nil, 0644))
+	testBar.Drain(wait, "on reboot-required").AssertText(
+		[]string{"false true [libc6 dbus]"})
+
+	require.NoError(t, os.Remove(rebootRequired))
+	testBar.Drain(wait, "on reboot-required removed").AssertText(
+		[]string{"false false []"})
+}
+
+func TestErrors(t *testing.T) {
+	reset(t, "4.16.13-1-ARCH")
+	require.NoError(t, os.Remove(osRelease))
+	testBar.Run(New())
+	testBar.NextOutput("on missing osrelease").AssertError()
+
+	reset(t, "4.16.13-1-ARCH")
+	testBar.Run(New())
+	testBar.NextOutput("without modules").AssertEmpty()
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"4.9.0", "4.10.0", -1},
+		{"4.15.0-23-generic", "4.15.0-9-generic", 1},
+		{"4.16.13-2-ARCH", "4.16.13-2-ARCH", 0},
+		{"5.0.0", "5.0.0-rc1", -1},
+		{"5.0.01", "5.0.1", 0},
+		{"6.1.0-13-amd64", "6.1.0-13-arm64", -1},
+	} {
+		require.Equal(t, tc.expected, compareVersions(tc.a, tc.b),
+			"compareVersions(%q, %q)", tc.a, tc.b)
+	}
+}
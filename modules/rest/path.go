@@ -0,0 +1,72 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// splitPath splits a path into its components, at each unescaped '.'.
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			part.WriteByte(path[i])
+		case path[i] == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(path[i])
+		}
+	}
+	return append(parts, part.String())
+}
+
+// lookup returns the value at the given path in a decoded JSON document.
+// Paths use a subset of the gjson syntax: components are separated by '.',
+// array elements are selected by index, and '#' returns the length of an
+// array. A literal '.' in an object key must be escaped as '\.'.
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	val := doc
+	for _, part := range splitPath(path) {
+		switch v := val.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if val, ok = v[part]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			if part == "#" {
+				val = float64(len(v))
+				continue
+			}
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+			val = v[idx]
+		default:
+			return nil, false
+		}
+	}
+	return val, true
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPath(t *testing.T) {
+	require.Empty(t, splitPath(""))
+	require.Equal(t, []string{"a"}, splitPath("a"))
+	require.Equal(t, []string{"a", "b", "0"}, splitPath("a.b.0"))
+	require.Equal(t, []string{"a.b", "c"}, splitPath(`a\.b.c`))
+	require.Equal(t, []string{`a\`}, splitPath(`a\`))
+	require.Equal(t, []string{"", ""}, splitPath("."))
+}
+
+func TestLookup(t *testing.T) {
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"name": "test",
+		"count": 3,
+		"nested": {"ok": true, "none": null},
+		"items": [{"id": "a"}, {"id": "b", "tags": ["x", "y", "z"]}],
+		"dotted.key": 1
+	}`), &doc))
+
+	for path, expected := range map[string]interface{}{
+		"name":           "test",
+		"count":          3.0,
+		"nested.ok":      true,
+		"nested.none":    nil,
+		"items.1.id":     "b",
+		"items.#":        2.0,
+		"items.1.tags.#": 3.0,
+		"items.1.tags.2": "z",
+		`dotted\.key`:    1.0,
+		"items.0":        map[string]interface{}{"id": "a"},
+	} {
+		val, ok := lookup(doc, path)
+		require.True(t, ok, path)
+		require.Equal(t, expected, val, path)
+	}
+
+	val, ok := lookup(doc, "")
+	require.True(t, ok)
+	require.Equal(t, doc, val, "empty path returns document")
+
+	for _, path := range []string{
+		"missing", "name.length", "items.2", "items.-1", "items.id",
+		"nested.#", "count.0", "dotted.key", "items.0.tags.#",
+	} {
+		_, ok := lookup(doc, path)
+		require.False(t, ok, path)
+	}
+}
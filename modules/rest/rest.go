@@ -0,0 +1,351 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package rest provides a bar module that polls a JSON API, and shows values
+extracted from the response. It covers simple integrations that do not need a
+dedicated module:
+
+	rest.New("https://api.example.com/status").
+		Header("Authorization", "Bearer "+token).
+		Text("%v build %v", "project.name", "builds.0.state").
+		When(rest.Equals("builds.0.state", "failed"),
+			rest.Color(colors.Scheme("bad")), rest.Urgent()).
+		When(rest.Above("queue.#", 10),
+			rest.Color(colors.Scheme("degraded")))
+
+Values are selected using paths, which use a subset of the gjson syntax:
+components are separated by '.', array elements are selected by index, and
+'#' returns the length of an array. For example, given
+
+	{"builds": [{"state": "passed", "tags": ["a", "b"]}]}
+
+"builds.0.state" is "passed", and "builds.0.tags.#" is 2. JSON numbers are
+always float64, so should be formatted using %v or %f.
+*/
+package rest // import "barista.run/modules/rest"
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/httpclient"
+	"barista.run/base/value"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents a JSON response.
+type Info struct {
+	doc interface{}
+}
+
+// Get returns the value at the given path, and whether it exists. Objects
+// are map[string]interface{}, arrays are []interface{}, and numbers are
+// float64.
+func (i Info) Get(path string) (interface{}, bool) {
+	return lookup(i.doc, path)
+}
+
+// String returns the value at the given path formatted as a string, or an
+// empty string if it does not exist.
+func (i Info) String(path string) string {
+	if v, ok := i.Get(path); ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Float returns the numeric value at the given path, converting strings if
+// necessary, and whether it is a number.
+func (i Info) Float(path string) (float64, bool) {
+	switch v, _ := i.Get(path); v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		var f float64
+		_, err := fmt.Sscan(v, &f)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Bool returns true if the value at the given path is true, a non-zero
+// number, or a non-empty string other than "false".
+func (i Info) Bool(path string) bool {
+	switch v, _ := i.Get(path); v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != "" && v != "false"
+	}
+	return false
+}
+
+// Condition is a test against the response, used to apply formatting rules.
+type Condition func(Info) bool
+
+// Exists matches if the given path has a non-null value.
+func Exists(path string) Condition {
+	return func(i Info) bool {
+		v, ok := i.Get(path)
+		return ok && v != nil
+	}
+}
+
+// Equals matches if the value at the given path is equal to the given value,
+// when both are formatted as strings. For example, Equals("code", 200)
+// matches {"code": 200}.
+func Equals(path string, val interface{}) Condition {
+	expected := fmt.Sprint(val)
+	return func(i Info) bool {
+		v, ok := i.Get(path)
+		return ok && v != nil && fmt.Sprint(v) == expected
+	}
+}
+
+// Above matches if the value at the given path is a number greater than the
+// given threshold.
+func Above(path string, threshold float64) Condition {
+	return func(i Info) bool {
+		v, ok := i.Float(path)
+		return ok && v > threshold
+	}
+}
+
+// Below matches if the value at the given path is a number less than the
+// given threshold.
+func Below(path string, threshold float64) Condition {
+	return func(i Info) bool {
+		v, ok := i.Float(path)
+		return ok && v < threshold
+	}
+}
+
+// True matches if the value at the given path is truthy, as determined by
+// Info.Bool.
+func True(path string) Condition {
+	return func(i Info) bool { return i.Bool(path) }
+}
+
+// Format modifies the output segment when a rule matches.
+type Format func(*bar.Segment)
+
+// Color sets the text colour of the output.
+func Color(c color.Color) Format {
+	return func(s *bar.Segment) { s.Color(c) }
+}
+
+// Background sets the background colour of the output.
+func Background(c color.Color) Format {
+	return func(s *bar.Segment) { s.Background(c) }
+}
+
+// Urgent marks the output as urgent.
+func Urgent() Format {
+	return func(s *bar.Segment) { s.Urgent(true) }
+}
+
+type rule struct {
+	cond    Condition
+	formats []Format
+}
+
+// Template is a declarative output configuration: a format string with values
+// selected by path, and rules that modify the output segment. It is used by
+// the default output of this module, and of other modules that receive JSON,
+// such as websocket.
+type Template struct {
+	text  string
+	paths []string
+	rules []rule
+}
+
+// Text constructs a template that formats the given values using a format
+// string. If any value is missing, an error is shown instead.
+func Text(text string, paths ...string) Template {
+	return Template{text: text, paths: paths}
+}
+
+// Text returns a copy of the template with a different format string and
+// values. Any rules are kept.
+func (t Template) Text(text string, paths ...string) Template {
+	t.text, t.paths = text, paths
+	return t
+}
+
+// When returns a copy of the template with an additional rule, which applies
+// the given formats if the condition matches. Rules are applied in order, so
+// later rules take precedence.
+func (t Template) When(cond Condition, formats ...Format) Template {
+	t.rules = append(t.rules[:len(t.rules):len(t.rules)], rule{cond, formats})
+	return t
+}
+
+// Output formats the given response using the template.
+func (t Template) Output(i Info) *bar.Segment {
+	args := make([]interface{}, len(t.paths))
+	for idx, path := range t.paths {
+		v, ok := i.Get(path)
+		if !ok {
+			return outputs.Errorf("no value at %q", path)
+		}
+		args[idx] = v
+	}
+	out := outputs.Textf(t.text, args...)
+	for _, r := range t.rules {
+		if r.cond(i) {
+			for _, apply := range r.formats {
+				apply(out)
+			}
+		}
+	}
+	return out
+}
+
+// Module represents a bar module that polls a JSON API.
+type Module struct {
+	url        string
+	headers    http.Header
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	template   value.Value     // of Template
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a module that fetches the given URL every minute. By
+// default, the whole response is shown, which is only useful for simple
+// values; use Text to select the values to show.
+func New(url string) *Module {
+	m := &Module{
+		url:       url,
+		headers:   http.Header{},
+		scheduler: timing.NewScheduler().Every(time.Minute),
+	}
+	l.Label(m, url)
+	l.Register(m, "outputFunc", "template", "scheduler")
+	m.template.Set(Text("%v", ""))
+	m.Output(func(i Info) bar.Output {
+		return m.template.Get().(Template).Output(i)
+	})
+	return m
+}
+
+// Header adds an HTTP header to each request, e.g. for authentication. It
+// must be called before the module is streamed.
+func (m *Module) Header(name, value string) *Module {
+	m.headers.Add(name, value)
+	return m
+}
+
+// Text sets the format string for the default output, and the paths of the
+// values used as its arguments. If any value is missing, an error is shown
+// instead.
+func (m *Module) Text(text string, paths ...string) *Module {
+	m.template.Set(m.template.Get().(Template).Text(text, paths...))
+	return m
+}
+
+// When adds a rule to the default output, which applies the given formats if
+// the condition matches. Rules are applied in order, so later rules take
+// precedence.
+func (m *Module) When(cond Condition, formats ...Format) *Module {
+	m.template.Set(m.template.Get().(Template).When(cond, formats...))
+	return m
+}
+
+// Output configures a module to display the output of a user-defined
+// function. This replaces the default output, so Text and When have no
+// effect.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextTemplate, done := m.template.Subscribe()
+	defer done()
+
+	var info Info
+	var err error
+	poller := connectivity.NewPoller(func() { info, err = m.fetch() })
+	poller.Poll()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(poller.Output(func() bar.Output { return outputFunc(info) }))
+		select {
+		case <-m.scheduler.C:
+			poller.Poll()
+		case <-connectivity.Next():
+			poller.Poll()
+		case <-nextTemplate:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func (m *Module) fetch() (Info, error) {
+	req, err := http.NewRequest("GET", m.url, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	for name, vals := range m.headers {
+		req.Header[name] = vals
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return Info{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Info{}, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Info{}, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a JSON document.
+func Parse(data []byte) (Info, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Info{}, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return Info{doc}, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	connectivity.SetForTest(true)
+}
+
+type fakeServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	response string
+	status   int
+	headers  http.Header
+	requests int
+}
+
+func newServer(t *testing.T) *fakeServer {
+	s := &fakeServer{status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.headers = r.Header.Clone()
+		s.requests++
+		w.WriteHeader(s.status)
+		fmt.Fprint(w, s.response)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeServer) set(status int, response string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.response = status, response
+}
+
+func (s *fakeServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *fakeServer) header(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.headers.Get(name)
+}
+
+func TestInfo(t *testing.T) {
+	var doc interface{} = map[string]interface{}{
+		"num":   12.5,
+		"str":   "42",
+		"text":  "hello",
+		"no":    "false",
+		"empty": "",
+		"yes":   true,
+		"zero":  0.0,
+		"null":  nil,
+	}
+	i := Info{doc}
+
+	require.Equal(t, "12.5", i.String("num"))
+	require.Equal(t, "hello", i.String("text"))
+	require.Equal(t, "", i.String("null"))
+	require.Equal(t, "", i.String("missing"))
+
+	f, ok := i.Float("num")
+	require.True(t, ok)
+	require.Equal(t, 12.5, f)
+	f, ok = i.Float("str")
+	require.True(t, ok, "parses strings")
+	require.Equal(t, 42.0, f)
+	_, ok = i.Float("text")
+	require.False(t, ok)
+	_, ok = i.Float("yes")
+	require.False(t, ok)
+
+	for path, expected := range map[string]bool{
+		"num": true, "str": true, "yes": true,
+		"no": false, "empty": false, "zero": false, "null": false, "missing": false,
+	} {
+		require.Equal(t, expected, i.Bool(path), path)
+		require.Equal(t, expected, True(path)(i), path)
+	}
+
+	require.True(t, Exists("zero")(i))
+	require.False(t, Exists("null")(i))
+	require.False(t, Exists("missing")(i))
+	require.True(t, Equals("num", 12.5)(i))
+	require.True(t, Equals("str", 42)(i))
+	require.False(t, Equals("null", nil)(i))
+	require.True(t, Above("num", 12)(i))
+	require.False(t, Above("num", 12.5)(i))
+	require.True(t, Below("str", 50)(i))
+	require.False(t, Below("text", 50)(i))
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	srv := newServer(t)
+	srv.set(http.StatusOK, `"ok"`)
+
+	m := New(srv.URL).Header("Authorization", "Bearer token")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"ok"})
+	require.Equal(t, "Bearer token", srv.header("Authorization"))
+	require.Equal(t, "application/json", srv.header("Accept"))
+
+	srv.set(http.StatusOK, `{"name": "barista", "builds": [{"state": "failed"}], "queue": []}`)
+	testBar.AssertNoOutput("until refresh")
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText(
+		[]string{"map[builds:[map[state:failed]] name:barista queue:[]]"})
+
+	red := colors.Hex("#ff0000")
+	yellow := colors.Hex("#ffff00")
+	m.Text("%v: %v (%v)", "name", "builds.0.state", "queue.#")
+	out := testBar.NextOutput("on text change")
+	out.AssertText([]string{"barista: failed (0)"})
+
+	m.When(Equals("builds.0.state", "failed"), Color(red), Urgent())
+	out = testBar.NextOutput("on rule change")
+	seg := out.At(0).Segment()
+	c, _ := seg.GetColor()
+	require.Equal(t, red, c)
+	urgent, _ := seg.IsUrgent()
+	require.True(t, urgent)
+
+	m.When(Below("queue.#", 1), Color(yellow), Background(red))
+	seg = testBar.NextOutput("on rule change").At(0).Segment()
+	c, _ = seg.GetColor()
+	require.Equal(t, yellow, c, "later rules take precedence")
+	bg, _ := seg.GetBackground()
+	require.Equal(t, red, bg)
+
+	srv.set(http.StatusOK, `{"name": "barista", "builds": [], "queue": [1]}`)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertError("missing value")
+
+	srv.set(http.StatusOK, `{"name": "barista", "builds": [{"state": "passed"}], "queue": [1, 2]}`)
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"barista: passed (2)"})
+	_, hasColor := out.At(0).Segment().GetColor()
+	require.False(t, hasColor, "no rules matched")
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%s", i.String("builds.0.state"))
+	})
+	testBar.NextOutput("on output func change").AssertText([]string{"passed"})
+
+	srv.set(http.StatusServiceUnavailable, `{}`)
+	testBar.Tick()
+	out = testBar.NextOutput("on HTTP error")
+	errs := out.AssertError()
+	require.Contains(t, errs[0], "503")
+
+	srv.set(http.StatusOK, `not json`)
+	out.At(0).LeftClick()
+	errs = testBar.Drain(50*time.Millisecond, "on restart").AssertError()
+	require.Contains(t, errs[0], "invalid JSON")
+}
+
+func TestOffline(t *testing.T) {
+	testBar.New(t)
+	srv := newServer(t)
+	srv.set(http.StatusOK, `"ok"`)
+	connectivity.SetForTest(false)
+	defer connectivity.SetForTest(true)
+
+	testBar.Run(New(srv.URL))
+	testBar.NextOutput("on start").AssertText([]string{"no network"})
+	testBar.Tick()
+	testBar.NextOutput("on tick").AssertText([]string{"no network"})
+	require.Equal(t, 0, srv.requestCount(), "no polling while offline")
+
+	connectivity.SetForTest(true)
+	testBar.NextOutput("on reconnect").AssertText([]string{"ok"})
+	require.Equal(t, 1, srv.requestCount())
+
+	srv.set(http.StatusOK, `"stale"`)
+	connectivity.SetForTest(false)
+	testBar.NextOutput("on disconnect").AssertText([]string{"ok", "no network"})
+	testBar.Tick()
+	testBar.NextOutput("on tick").AssertText([]string{"ok", "no network"})
+	require.Equal(t, 1, srv.requestCount(), "no polling while offline")
+
+	connectivity.SetForTest(true)
+	testBar.NextOutput("on reconnect").AssertText([]string{"stale"})
+}
+
+func TestTemplate(t *testing.T) {
+	i, err := Parse([]byte(`{"price": 101.5, "symbol": "ABC"}`))
+	require.NoError(t, err)
+	_, err = Parse([]byte(`{"price":`))
+	require.Error(t, err)
+
+	red := colors.Hex("#ff0000")
+	base := Text("%v %.1f", "symbol", "price")
+	tmpl := base.When(Above("price", 100), Color(red))
+	out := outputs.Textf("ABC 101.5")
+	require.Equal(t, out, base.Output(i))
+	require.Equal(t, out.Color(red), tmpl.Output(i))
+	require.Equal(t, outputs.Textf("ABC 101.5"), base.Output(i),
+		"When does not modify the original template")
+
+	require.Equal(t, outputs.Textf("101.5").Color(red),
+		tmpl.Text("%v", "price").Output(i), "rules kept when text changes")
+}
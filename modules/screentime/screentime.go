@@ -0,0 +1,307 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package screentime provides a bar module that shows how long each
+// application has been used today. Usage is either tracked by the module
+// itself, using the focused window in i3 or sway, or queried from a local
+// ActivityWatch server.
+package screentime // import "barista.run/modules/screentime"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/httpclient"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/focus"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// App represents the time spent in an application today.
+type App struct {
+	// Name is the app_id or window class of the application.
+	Name     string
+	Duration time.Duration
+}
+
+// Info represents the screen time for today.
+type Info struct {
+	// Apps contains all applications used today, most used first.
+	Apps []App
+	// Total is the total active time today.
+	Total time.Duration
+}
+
+// Top returns the n most used applications.
+func (i Info) Top(n int) []App {
+	if n > len(i.Apps) {
+		n = len(i.Apps)
+	}
+	return i.Apps[:n]
+}
+
+func newInfo(totals map[string]time.Duration) Info {
+	var i Info
+	for name, d := range totals {
+		i.Apps = append(i.Apps, App{name, d})
+		i.Total += d
+	}
+	sort.Slice(i.Apps, func(a, b int) bool {
+		if i.Apps[a].Duration != i.Apps[b].Duration {
+			return i.Apps[a].Duration > i.Apps[b].Duration
+		}
+		return i.Apps[a].Name < i.Apps[b].Name
+	})
+	return i
+}
+
+// Module represents a bar module that shows today's screen time.
+type Module struct {
+	// server is the ActivityWatch server, or empty to track usage using the
+	// focused window.
+	server     string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+func newModule(server string) *Module {
+	m := &Module{server: server, scheduler: timing.NewScheduler()}
+	l.Label(m, server)
+	l.Register(m, "outputFunc", "scheduler")
+	m.RefreshInterval(time.Minute)
+	m.Output(func(i Info) bar.Output {
+		if len(i.Apps) == 0 {
+			return nil
+		}
+		top := i.Apps[0]
+		return outputs.Textf("%s (%s %s)", formatDuration(i.Total),
+			top.Name, formatDuration(top.Duration))
+	})
+	return m
+}
+
+// New constructs a screen time module that tracks the focused window in i3
+// or sway. Only time while the bar is running is counted, and time is not
+// counted while the logind session is idle.
+func New() *Module {
+	return newModule("")
+}
+
+// ActivityWatch constructs a screen time module that queries the local
+// ActivityWatch server, excluding time when the user was away.
+func ActivityWatch() *Module {
+	return ActivityWatchServer("http://localhost:5600")
+}
+
+// ActivityWatchServer constructs a screen time module that queries the
+// ActivityWatch server at the given URL.
+func ActivityWatchServer(server string) *Module {
+	return newModule(strings.TrimSuffix(server, "/"))
+}
+
+// formatDuration formats a duration as hours and minutes, e.g. "1h05m", or
+// just minutes if less than an hour, e.g. "12m".
+func formatDuration(d time.Duration) string {
+	m := int(d.Minutes())
+	if m < 60 {
+		return fmt.Sprintf("%dm", m)
+	}
+	return fmt.Sprintf("%dh%02dm", m/60, m%60)
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures how often the output is updated, and for
+// ActivityWatch, how often the server is queried.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	if m.server != "" {
+		m.streamActivityWatch(sink)
+	} else {
+		m.streamTracker(sink)
+	}
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, mon, d := t.Date()
+	return time.Date(y, mon, d, 0, 0, 0, 0, t.Location())
+}
+
+// tracker accumulates the time spent in each application today.
+type tracker struct {
+	day    time.Time
+	totals map[string]time.Duration
+	app    string
+	since  time.Time
+}
+
+// switchTo records the time spent in the current app, and switches to the
+// given app. An empty app stops counting, e.g. when nothing is focused.
+func (t *tracker) switchTo(app string, now time.Time) {
+	if day := startOfDay(now); !day.Equal(t.day) {
+		t.day = day
+		t.totals = map[string]time.Duration{}
+		if t.since.Before(day) {
+			t.since = day
+		}
+	}
+	if t.app != "" && now.After(t.since) {
+		t.totals[t.app] += now.Sub(t.since)
+	}
+	t.app = app
+	t.since = now
+}
+
+func (t *tracker) info(now time.Time) Info {
+	t.switchTo(t.app, now)
+	return newInfo(t.totals)
+}
+
+const (
+	logindService = "org.freedesktop.login1"
+	logindSession = "/org/freedesktop/login1/session/auto"
+	logindIface   = "org.freedesktop.login1.Session"
+)
+
+// Overridden in tests.
+var busType = dbus.System
+
+func (m *Module) streamTracker(sink bar.Sink) {
+	var focused value.ErrorValue // of focus.Window
+	nextFocus, done := focused.Subscribe()
+	defer done()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		focused.Error(focus.Watch(func(w focus.Window) { focused.Set(w) }, stop))
+	}()
+	idle := dbus.WatchProperties(busType, logindService, logindSession, logindIface).
+		Add("IdleHint")
+	defer idle.Unsubscribe()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	var t tracker
+	for {
+		f, err := focused.Get()
+		if sink.Error(err) {
+			return
+		}
+		app := ""
+		if w, ok := f.(focus.Window); ok {
+			app = w.App
+		}
+		if isIdle, _ := idle.Get()["IdleHint"].(bool); isIdle {
+			app = ""
+		}
+		now := timing.Now()
+		t.switchTo(app, now)
+		sink.Output(outputFunc(t.info(now)))
+		select {
+		case <-nextFocus:
+		case <-idle.Updates:
+		case <-m.scheduler.C:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// activityWatchQuery merges window events by app, limited to the periods
+// where the user was not away, in the same way as the ActivityWatch web UI.
+var activityWatchQuery = []string{
+	`window = flood(query_bucket(find_bucket("aw-watcher-window_")));`,
+	`afk = flood(query_bucket(find_bucket("aw-watcher-afk_")));`,
+	`afk = filter_keyvals(afk, "status", ["not-afk"]);`,
+	`window = filter_period_intersect(window, afk);`,
+	`RETURN = merge_events_by_keys(window, ["app"]);`,
+}
+
+type awEvent struct {
+	// Duration is in seconds.
+	Duration float64 `json:"duration"`
+	Data     struct {
+		App string `json:"app"`
+	} `json:"data"`
+}
+
+func (m *Module) queryActivityWatch(now time.Time) (Info, error) {
+	day := startOfDay(now)
+	body, _ := json.Marshal(map[string]interface{}{
+		"timeperiods": []string{
+			day.Format(time.RFC3339) + "/" + day.AddDate(0, 0, 1).Format(time.RFC3339),
+		},
+		"query": activityWatchQuery,
+	})
+	resp, err := httpclient.Client().Post(m.server+"/api/0/query/", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return Info{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Info{}, fmt.Errorf("ActivityWatch query: HTTP %s", resp.Status)
+	}
+	var periods [][]awEvent
+	if err := json.NewDecoder(resp.Body).Decode(&periods); err != nil {
+		return Info{}, err
+	}
+	totals := map[string]time.Duration{}
+	for _, events := range periods {
+		for _, e := range events {
+			totals[e.Data.App] += time.Duration(e.Duration * float64(time.Second))
+		}
+	}
+	return newInfo(totals), nil
+}
+
+func (m *Module) streamActivityWatch(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	info, err := m.queryActivityWatch(timing.Now())
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info, err = m.queryActivityWatch(timing.Now())
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
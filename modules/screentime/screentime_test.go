@@ -0,0 +1,221 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package screentime
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/focus"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	focus.TestMode()
+}
+
+func TestFormatDuration(t *testing.T) {
+	require.Equal(t, "0m", formatDuration(30*time.Second))
+	require.Equal(t, "12m", formatDuration(12*time.Minute+59*time.Second))
+	require.Equal(t, "1h05m", formatDuration(65*time.Minute))
+	require.Equal(t, "10h00m", formatDuration(10*time.Hour))
+}
+
+func TestInfo(t *testing.T) {
+	i := newInfo(map[string]time.Duration{
+		"firefox": time.Hour,
+		"emacs":   2 * time.Hour,
+		"foot":    time.Hour,
+	})
+	require.Equal(t, []App{
+		{"emacs", 2 * time.Hour},
+		{"firefox", time.Hour},
+		{"foot", time.Hour},
+	}, i.Apps, "sorted by duration, then name")
+	require.Equal(t, 4*time.Hour, i.Total)
+	require.Equal(t, []App{{"emacs", 2 * time.Hour}}, i.Top(1))
+	require.Len(t, i.Top(5), 3)
+	require.Empty(t, Info{}.Top(3))
+}
+
+func TestTracker(t *testing.T) {
+	start := time.Date(2018, 3, 4, 22, 0, 0, 0, time.Local)
+	var tr tracker
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	tr.switchTo("firefox", at(0))
+	tr.switchTo("emacs", at(30*time.Minute))
+	tr.switchTo("", at(45*time.Minute))
+	tr.switchTo("firefox", at(time.Hour))
+	require.Equal(t, Info{
+		Apps:  []App{{"firefox", 40 * time.Minute}, {"emacs", 15 * time.Minute}},
+		Total: 55 * time.Minute,
+	}, tr.info(at(70*time.Minute)), "includes current app")
+
+	require.Equal(t, Info{
+		Apps:  []App{{"firefox", 30 * time.Minute}},
+		Total: 30 * time.Minute,
+	}, tr.info(at(2*time.Hour+30*time.Minute)), "resets at midnight")
+}
+
+func setupLogind() *dbus.TestBusObject {
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	obj := bus.RegisterService(logindService).Object(logindSession, logindIface)
+	obj.SetProperty("IdleHint", false, dbus.SignalTypeNone)
+	return obj
+}
+
+func TestTrackerModule(t *testing.T) {
+	testBar.New(t)
+	logind := setupLogind()
+	focus.Set(focus.Window{})
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertEmpty("nothing tracked yet")
+
+	focus.Set(focus.Window{App: "firefox", PID: 100})
+	testBar.Drain(50*time.Millisecond, "on focus").AssertEmpty("no time yet")
+
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"1m (firefox 1m)"})
+
+	timing.AdvanceBy(30 * time.Minute)
+	focus.Set(focus.Window{App: "emacs", PID: 200})
+	testBar.Drain(50*time.Millisecond, "on focus change").
+		AssertText([]string{"31m (firefox 31m)"})
+
+	logind.SetProperty("IdleHint", true, dbus.SignalTypeChanged)
+	testBar.NextOutput("on idle")
+	timing.AdvanceBy(time.Hour + 30*time.Second)
+	testBar.Drain(50*time.Millisecond, "while idle").
+		AssertText([]string{"31m (firefox 31m)"}, "idle time not counted")
+
+	logind.SetProperty("IdleHint", false, dbus.SignalTypeChanged)
+	testBar.NextOutput("on idle end")
+	timing.AdvanceBy(45 * time.Minute)
+	testBar.Drain(50*time.Millisecond, "after idle").
+		AssertText([]string{"1h16m (emacs 45m)"})
+
+	focus.Fail(errors.New("exited"))
+	testBar.NextOutput("on window manager exit").AssertError()
+}
+
+type fakeActivityWatch struct {
+	*httptest.Server
+	sync.Mutex
+	requests []map[string]interface{}
+	response string
+	status   int
+}
+
+func (f *fakeActivityWatch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if r.Method != "POST" || r.URL.Path != "/api/0/query/" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var req map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&req)
+	f.requests = append(f.requests, req)
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+	}
+	w.Write([]byte(f.response))
+}
+
+func (f *fakeActivityWatch) set(status int, response string) {
+	f.Lock()
+	defer f.Unlock()
+	f.status = status
+	f.response = response
+}
+
+func (f *fakeActivityWatch) lastRequest() map[string]interface{} {
+	f.Lock()
+	defer f.Unlock()
+	return f.requests[len(f.requests)-1]
+}
+
+func startActivityWatch() *fakeActivityWatch {
+	f := &fakeActivityWatch{}
+	f.Server = httptest.NewServer(f)
+	return f
+}
+
+func TestActivityWatch(t *testing.T) {
+	testBar.New(t)
+	aw := startActivityWatch()
+	defer aw.Close()
+	aw.set(0, `[[
+		{"timestamp": "2018-01-01T09:00:00Z", "duration": 5400.5, "data": {"app": "firefox"}},
+		{"timestamp": "2018-01-01T10:00:00Z", "duration": 1500, "data": {"app": "emacs"}}
+	]]`)
+
+	m := ActivityWatchServer(aw.URL + "/")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"1h55m (firefox 1h30m)"})
+
+	req := aw.lastRequest()
+	day := startOfDay(timing.Now())
+	require.Equal(t, []interface{}{
+		day.Format(time.RFC3339) + "/" + day.AddDate(0, 0, 1).Format(time.RFC3339),
+	}, req["timeperiods"])
+	query := req["query"].([]interface{})
+	require.Contains(t, query[0], "aw-watcher-window_")
+	require.Contains(t, query[len(query)-1], `merge_events_by_keys(window, ["app"])`)
+
+	aw.set(0, `[[]]`)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertEmpty("no activity")
+
+	var info Info
+	m.Output(func(i Info) bar.Output {
+		info = i
+		return outputs.Text("screentime")
+	})
+	testBar.NextOutput("on output func change")
+	require.Empty(t, info.Apps)
+
+	aw.set(http.StatusInternalServerError, `{"message": "error"}`)
+	testBar.Tick()
+	testBar.NextOutput("on server error").AssertError()
+
+	testBar.New(t)
+	aw.set(0, `not json`)
+	testBar.Run(ActivityWatchServer(aw.URL))
+	testBar.NextOutput("on invalid response").AssertError()
+
+	testBar.New(t)
+	aw.Close()
+	testBar.Run(ActivityWatchServer(aw.URL))
+	testBar.NextOutput("on connection error").AssertError()
+}
+
+func TestDefaultServer(t *testing.T) {
+	require.Equal(t, "http://localhost:5600", ActivityWatch().server)
+	require.Empty(t, New().server)
+}
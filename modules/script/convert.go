@@ -0,0 +1,296 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"reflect"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+
+	starlarktime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// segment wraps a bar segment constructed by a script.
+type segment struct {
+	seg *bar.Segment
+}
+
+func (s segment) String() string {
+	text, _ := s.seg.Content()
+	return fmt.Sprintf("segment(%q)", text)
+}
+
+func (s segment) Type() string          { return "segment" }
+func (s segment) Freeze()               {}
+func (s segment) Truth() starlark.Bool  { return starlark.True }
+func (s segment) Hash() (uint32, error) { return 0, errors.New("unhashable type: segment") }
+
+var outputModule = &starlarkstruct.Module{
+	Name: "output",
+	Members: starlark.StringDict{
+		"segment": starlark.NewBuiltin("segment", newSegment),
+		"pango":   starlark.NewBuiltin("pango", newSegment),
+	},
+}
+
+func newSegment(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var content, shortText, tooltip, fg, bg, border string
+	var urgent bool
+	var minWidth int
+	contentArg := "text"
+	if b.Name() == "pango" {
+		contentArg = "markup"
+	}
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+		contentArg, &content,
+		"short_text?", &shortText,
+		"tooltip?", &tooltip,
+		"color?", &fg,
+		"background?", &bg,
+		"border?", &border,
+		"urgent?", &urgent,
+		"min_width?", &minWidth,
+	); err != nil {
+		return nil, err
+	}
+	s := bar.TextSegment(content)
+	if b.Name() == "pango" {
+		s = bar.PangoSegment(content)
+	}
+	if shortText != "" {
+		s.ShortText(shortText)
+	}
+	if tooltip != "" {
+		s.Tooltip(tooltip)
+	}
+	for _, c := range []struct {
+		name  string
+		value string
+		set   func(color.Color) *bar.Segment
+	}{
+		{"color", fg, s.Color},
+		{"background", bg, s.Background},
+		{"border", border, s.Border},
+	} {
+		if c.value == "" {
+			continue
+		}
+		col, err := parseColor(c.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", b.Name(), c.name, err)
+		}
+		c.set(col)
+	}
+	if urgent {
+		s.Urgent(true)
+	}
+	if minWidth > 0 {
+		s.MinWidth(minWidth)
+	}
+	return segment{s}, nil
+}
+
+// parseColor returns a hex colour if the value starts with '#', or the named
+// colour from the scheme otherwise.
+func parseColor(value string) (color.Color, error) {
+	if !strings.HasPrefix(value, "#") {
+		return colors.Scheme(value), nil
+	}
+	if c := colors.Hex(value); c != nil {
+		return c, nil
+	}
+	return nil, fmt.Errorf("invalid colour %q", value)
+}
+
+// toOutput converts the return value of a script function to bar output,
+// adding the click handler to each segment if given.
+func toOutput(v starlark.Value, onClick func(bar.Event)) (bar.Output, error) {
+	segments, err := toSegments(v)
+	if err != nil {
+		return nil, err
+	}
+	if onClick != nil {
+		for _, s := range segments {
+			s.OnClick(onClick)
+		}
+	}
+	switch len(segments) {
+	case 0:
+		return nil, nil
+	case 1:
+		return segments[0], nil
+	}
+	out := outputs.Group()
+	for _, s := range segments {
+		out.Append(s)
+	}
+	return out, nil
+}
+
+func toSegments(v starlark.Value) ([]*bar.Segment, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.String:
+		return []*bar.Segment{outputs.Text(string(v))}, nil
+	case segment:
+		// Scripts may return the same segment from several calls.
+		return []*bar.Segment{v.seg.Clone()}, nil
+	case starlark.Int, starlark.Float:
+		return []*bar.Segment{outputs.Text(v.String())}, nil
+	case starlark.Iterable:
+		var segments []*bar.Segment
+		iter := v.Iterate()
+		defer iter.Done()
+		var item starlark.Value
+		for iter.Next(&item) {
+			s, err := toSegments(item)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, s...)
+		}
+		return segments, nil
+	}
+	return nil, fmt.Errorf("cannot use %s as output", v.Type())
+}
+
+var buttonNames = map[bar.Button]string{
+	bar.ButtonLeft:    "left",
+	bar.ButtonRight:   "right",
+	bar.ButtonMiddle:  "middle",
+	bar.ButtonBack:    "back",
+	bar.ButtonForward: "forward",
+	bar.ScrollUp:      "scroll_up",
+	bar.ScrollDown:    "scroll_down",
+	bar.ScrollLeft:    "scroll_left",
+	bar.ScrollRight:   "scroll_right",
+}
+
+func eventValue(e bar.Event) starlark.Value {
+	button, ok := buttonNames[e.Button]
+	if !ok {
+		button = fmt.Sprintf("button%d", e.Button)
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"button": starlark.String(button),
+		"x":      starlark.MakeInt(e.X),
+		"y":      starlark.MakeInt(e.Y),
+		"width":  starlark.MakeInt(e.Width),
+		"height": starlark.MakeInt(e.Height),
+	})
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// toValue converts a Go value, typically a module's Info, to a Starlark
+// value. Structs are converted to Starlark structs with their exported fields
+// and exported methods that take no arguments and return a single value, so
+// a script can use info.SSID or info.Connected().
+func toValue(v interface{}) starlark.Value {
+	return fromReflect(reflect.ValueOf(v))
+}
+
+func fromReflect(v reflect.Value) starlark.Value {
+	if !v.IsValid() {
+		return starlark.None
+	}
+	switch v.Type() {
+	case timeType:
+		return starlarktime.Time(v.Interface().(time.Time))
+	case durationType:
+		return starlarktime.Duration(v.Int())
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return starlark.Bool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return starlark.MakeInt64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return starlark.MakeUint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return starlark.Float(v.Float())
+	case reflect.String:
+		return starlark.String(v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return starlark.None
+		}
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+			return fromStruct(v)
+		}
+		return fromReflect(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return starlark.None
+		}
+		items := make([]starlark.Value, v.Len())
+		for i := range items {
+			items[i] = fromReflect(v.Index(i))
+		}
+		return starlark.NewList(items)
+	case reflect.Map:
+		d := starlark.NewDict(v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			// Keys of unhashable types are skipped.
+			d.SetKey(fromReflect(iter.Key()), fromReflect(iter.Value()))
+		}
+		return d
+	case reflect.Struct:
+		return fromStruct(v)
+	}
+	return starlark.String(fmt.Sprint(v.Interface()))
+}
+
+// fromStruct converts a struct, or pointer to a struct, including methods
+// declared on either.
+func fromStruct(v reflect.Value) starlark.Value {
+	members := starlark.StringDict{}
+	elem := reflect.Indirect(v)
+	typ := elem.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); f.PkgPath == "" {
+			members[f.Name] = fromReflect(elem.Field(i))
+		}
+	}
+	for i := 0; i < v.NumMethod(); i++ {
+		method := v.Type().Method(i)
+		fn := v.Method(i)
+		if fn.Type().NumIn() != 0 || fn.Type().NumOut() != 1 {
+			continue
+		}
+		members[method.Name] = starlark.NewBuiltin(method.Name,
+			func(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+				if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+					return nil, err
+				}
+				return fromReflect(fn.Call(nil)[0]), nil
+			})
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, members)
+}
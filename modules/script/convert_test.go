@@ -0,0 +1,122 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+
+	"github.com/stretchr/testify/require"
+	starlarktime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+func TestToValue(t *testing.T) {
+	now := time.Now()
+	var nilPtr *testInfo
+	for _, tc := range []struct {
+		in       interface{}
+		expected string
+	}{
+		{nil, "None"},
+		{true, "True"},
+		{-12, "-12"},
+		{uint8(12), "12"},
+		{1.5, "1.5"},
+		{"text", `"text"`},
+		{nilPtr, "None"},
+		{[]string{"a", "b"}, `["a", "b"]`},
+		{[]string(nil), "None"},
+		{[2]int{1, 2}, "[1, 2]"},
+		{map[string]int{"a": 1}, `{"a": 1}`},
+		{time.Minute, "1m0s"},
+		{bar.ButtonLeft, "1"},
+	} {
+		require.Equal(t, tc.expected, toValue(tc.in).String(), "%#v", tc.in)
+	}
+	require.Equal(t, starlarktime.Time(now), toValue(now))
+
+	for _, v := range []interface{}{testInfo{Name: "a", Count: 1}, &testInfo{Name: "a", Count: 1}} {
+		s, ok := toValue(v).(starlark.HasAttrs)
+		require.True(t, ok, "%#v", v)
+		require.ElementsMatch(t, []string{"Active", "Count", "Name", "Tags"}, s.AttrNames())
+		name, _ := s.Attr("Name")
+		require.Equal(t, starlark.String("a"), name)
+		active, _ := s.Attr("Active")
+		res, err := starlark.Call(new(starlark.Thread), active, nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, starlark.True, res)
+	}
+}
+
+func TestToOutput(t *testing.T) {
+	red := colors.Hex("#ff0000")
+	seg, err := newSegment(nil, starlark.NewBuiltin("pango", nil),
+		starlark.Tuple{starlark.String("<b>a</b>")},
+		[]starlark.Tuple{
+			{starlark.String("short_text"), starlark.String("a")},
+			{starlark.String("border"), starlark.String("#ff0000")},
+			{starlark.String("urgent"), starlark.True},
+		})
+	require.NoError(t, err)
+	expected := bar.PangoSegment("<b>a</b>").ShortText("a").Border(red).Urgent(true)
+
+	out, err := toOutput(seg, nil)
+	require.NoError(t, err)
+	require.Equal(t, expected, out)
+
+	out, err = toOutput(starlark.None, nil)
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	var events []bar.Event
+	onClick := func(e bar.Event) { events = append(events, e) }
+	out, err = toOutput(starlark.NewList([]starlark.Value{
+		starlark.String("a"), starlark.Tuple{starlark.MakeInt(1), seg},
+	}), onClick)
+	require.NoError(t, err)
+	segments := out.Segments()
+	require.Len(t, segments, 3)
+	for i, text := range []string{"a", "1", "<b>a</b>"} {
+		content, _ := segments[i].Content()
+		require.Equal(t, text, content)
+		segments[i].Click(bar.Event{Button: bar.ScrollUp})
+	}
+	require.Len(t, events, 3)
+	require.False(t, seg.(segment).seg.HasClick(), "returned segments are copied")
+
+	_, err = toOutput(starlark.NewDict(0), nil)
+	require.NoError(t, err, "dicts are iterable")
+	_, err = toOutput(starlark.False, nil)
+	require.Error(t, err)
+}
+
+func TestEventValue(t *testing.T) {
+	for button, expected := range map[bar.Button]string{
+		bar.ButtonLeft: "left",
+		bar.ScrollUp:   "scroll_up",
+		bar.Button(12): "button12",
+	} {
+		e := eventValue(bar.Event{Button: button, X: 5}).(starlark.HasAttrs)
+		v, err := e.Attr("button")
+		require.NoError(t, err)
+		require.Equal(t, starlark.String(expected), v)
+		x, _ := e.Attr("x")
+		require.Equal(t, starlark.MakeInt(5), x)
+	}
+}
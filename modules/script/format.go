@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"sync"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+)
+
+// Formatter is a format function defined by a script, which can be used in
+// the output function of any module:
+//
+//	f := script.Format("~/.config/barista/wlan.star", "format")
+//	wlan.Any().Output(func(i wlan.Info) bar.Output { return f.Output(i) })
+//
+// where wlan.star contains:
+//
+//	def format(info):
+//	    if not info.Connected():
+//	        return None
+//	    return output.segment(info.SSID, color="good")
+//
+// The value is passed to the script as a struct with its exported fields,
+// and its exported methods that take no arguments and return a single value.
+// Format scripts do not have access to http or timing.every, since output
+// functions should not block.
+type Formatter struct {
+	filename string
+	function string
+
+	mu      sync.Mutex
+	program *program
+}
+
+// Format constructs a format function that calls the given function defined
+// by a script. The script is loaded when first used; if it fails to load, an
+// error is shown and loading is retried on the next update.
+func Format(filename, function string) *Formatter {
+	return &Formatter{filename: filename, function: function}
+}
+
+// Output calls the script function with the given value, and returns its
+// output, or an error segment if the script fails.
+func (f *Formatter) Output(v interface{}) bar.Output {
+	p, err := f.load()
+	if err != nil {
+		return outputs.Error(err)
+	}
+	res, err := p.call(f.function, toValue(v))
+	if err != nil {
+		return outputs.Error(err)
+	}
+	out, err := toOutput(res, nil)
+	if err != nil {
+		return outputs.Error(err)
+	}
+	return out
+}
+
+func (f *Formatter) load() (*program, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.program != nil {
+		return f.program, nil
+	}
+	p, err := load(f.filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	f.program = p
+	return p, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testInfo struct {
+	Name    string
+	Count   int
+	Tags    []string
+	private int
+}
+
+func (i testInfo) Active() bool { return i.Count > 0 }
+
+func (i testInfo) Tag(idx int) string { return i.Tags[idx] }
+
+func TestFormat(t *testing.T) {
+	good := colors.Hex("#00ff00")
+	colors.Set("good", good)
+	blue := colors.Hex("#0000ff")
+
+	f := Format(writeScript(t, `
+def format(info):
+    if not info.Active():
+        return None
+    text = "%s: %d (%s)" % (info.Name, info.Count, ", ".join(info.Tags))
+    return output.segment(text, color="good", background="#0000ff")
+
+def tag(info):
+    return info.Tag(0)
+
+def private(info):
+    return info.private
+`), "format")
+
+	require.Nil(t, f.Output(testInfo{Name: "a"}))
+	require.Equal(t,
+		outputs.Text("b: 2 (x, y)").Color(good).Background(blue),
+		f.Output(testInfo{Name: "b", Count: 2, Tags: []string{"x", "y"}}))
+
+	out := Format(f.filename, "tag").Output(testInfo{Tags: []string{"x"}})
+	require.Error(t, out.(*bar.Segment).GetError(),
+		"methods that take arguments are not available")
+	out = Format(f.filename, "private").Output(testInfo{private: 1})
+	require.Error(t, out.(*bar.Segment).GetError(),
+		"unexported fields are not available")
+	out = Format(f.filename, "missing").Output(testInfo{})
+	require.Contains(t, out.(*bar.Segment).GetError().Error(), "missing is not defined")
+}
+
+func TestFormatLoading(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "format.star")
+	f := Format(filename, "format")
+	out := f.Output("a")
+	require.Contains(t, out.(*bar.Segment).GetError().Error(), "no such file")
+
+	require.NoError(t, ioutil.WriteFile(filename,
+		[]byte("def format(s):\n    return s.upper()\n"), 0644))
+	require.Equal(t, outputs.Text("A"), f.Output("a"), "retries loading on error")
+
+	require.NoError(t, ioutil.WriteFile(filename,
+		[]byte("def format(s):\n    return s\n"), 0644))
+	require.Equal(t, outputs.Text("B"), f.Output("b"), "loads only once")
+}
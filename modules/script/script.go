@@ -0,0 +1,316 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package script provides a bar module, and format functions for other modules,
+defined by Starlark scripts loaded when the bar starts. It fills the gap
+between shell commands and modules written in Go:
+
+	script.New("~/.config/barista/status.star")
+
+where status.star contains:
+
+	timing.every("30s")
+
+	def update():
+	    status = json.decode(http.get("https://api.example.com/status"))
+	    if status["ok"]:
+	        return "ok"
+	    return output.segment("down: " + status["reason"], color="bad", urgent=True)
+
+	def click(event):
+	    if event.button == "right":
+	        http.get("https://api.example.com/retry")
+
+update is called on start, on each refresh, and after each click, and returns
+a string, an output.segment, a list of outputs, or None to hide the module.
+If click is defined, it receives the button ("left", "scroll_up", ...) and the
+x, y, width, and height of the click.
+
+Scripts are sandboxed: they cannot access files or run commands, load is not
+supported, and each call is limited to a fixed number of execution steps.
+In addition to the Starlark built-ins, scripts have access to:
+
+	output.segment(text, **options)  a text segment, see below
+	output.pango(markup, **options)  a pango segment
+	timing.every(interval)           sets the refresh interval, e.g. "5m"
+	timing.now()                     the current time, as a time.time
+	http.get(url, headers={})        the response body, as a string
+	json.encode, json.decode         from the Starlark json library
+	time                             the Starlark time library
+
+Segment options are short_text, tooltip, color, background, border (colours
+are names from the colour scheme, or hex values such as "#ff0000"), urgent,
+and min_width.
+*/
+package script // import "barista.run/modules/script"
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/httpclient"
+	l "barista.run/logging"
+	"barista.run/timing"
+
+	"go.starlark.net/lib/json"
+	starlarktime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// maxSteps limits the execution steps of each call into a script, to prevent
+// a runaway script from blocking the bar.
+const maxSteps = 10000000
+
+// maxResponseSize limits the size of responses to http.get.
+const maxResponseSize = 1 << 20
+
+// program is a loaded script. Scripts can keep state in global lists and
+// dicts, so calls are serialised.
+type program struct {
+	filename string
+	mu       sync.Mutex
+	globals  starlark.StringDict
+}
+
+// load reads and executes a script, with the common bindings and any
+// additional predeclared values.
+func load(filename string, extra starlark.StringDict) (*program, error) {
+	filename = expandHome(filename)
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &program{filename: filename}
+	predeclared := starlark.StringDict{
+		"output": outputModule,
+		"json":   json.Module,
+		"time":   starlarktime.Module,
+	}
+	for k, v := range extra {
+		predeclared[k] = v
+	}
+	p.globals, err = starlark.ExecFile(p.thread(), filename, src, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *program) thread() *starlark.Thread {
+	t := &starlark.Thread{
+		Name: p.filename,
+		Print: func(_ *starlark.Thread, msg string) {
+			l.Log("%s: %s", p.filename, msg)
+		},
+	}
+	t.SetMaxExecutionSteps(maxSteps)
+	return t
+}
+
+// has returns true if the script defines a function with the given name.
+func (p *program) has(name string) bool {
+	_, ok := p.globals[name].(starlark.Callable)
+	return ok
+}
+
+// call calls a function defined by the script.
+func (p *program) call(name string, args ...starlark.Value) (starlark.Value, error) {
+	fn, ok := p.globals[name].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not defined", p.filename, name)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return starlark.Call(p.thread(), fn, args, nil)
+}
+
+func expandHome(filename string) string {
+	if !strings.HasPrefix(filename, "~/") {
+		return filename
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filename
+	}
+	return filepath.Join(home, filename[2:])
+}
+
+// Module represents a bar module defined by a Starlark script.
+type Module struct {
+	filename  string
+	scheduler *timing.Scheduler
+}
+
+// New constructs a module that runs the given script. The script is loaded
+// each time the module starts, so changes take effect on restart, e.g. after
+// an error.
+func New(filename string) *Module {
+	m := &Module{filename: filename, scheduler: timing.NewScheduler()}
+	l.Label(m, filepath.Base(filename))
+	l.Register(m, "scheduler")
+	return m
+}
+
+// RefreshInterval sets the interval between calls to update. Without an
+// interval, either from this method or timing.every in the script, update is
+// only called on start and after clicks.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	p, err := load(m.filename, starlark.StringDict{
+		"timing": m.timingModule(),
+		"http":   httpModule,
+	})
+	if sink.Error(err) {
+		return
+	}
+	if !p.has("update") {
+		sink.Error(fmt.Errorf("%s: update is not defined", m.filename))
+		return
+	}
+	clicked := make(chan error, 1)
+	var onClick func(bar.Event)
+	if p.has("click") {
+		onClick = func(e bar.Event) {
+			_, err := p.call("click", eventValue(e))
+			select {
+			case clicked <- err:
+			default:
+			}
+		}
+	}
+	for {
+		res, err := p.call("update")
+		var out bar.Output
+		if err == nil {
+			out, err = toOutput(res, onClick)
+		}
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(out)
+		select {
+		case <-m.scheduler.C:
+		case err := <-clicked:
+			if sink.Error(err) {
+				return
+			}
+		}
+	}
+}
+
+func (m *Module) timingModule() *starlarkstruct.Module {
+	return &starlarkstruct.Module{
+		Name: "timing",
+		Members: starlark.StringDict{
+			"every": starlark.NewBuiltin("every", m.every),
+			"now":   starlark.NewBuiltin("now", now),
+		},
+	}
+}
+
+func (m *Module) every(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var interval starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &interval); err != nil {
+		return nil, err
+	}
+	d, err := toDuration(interval)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	if d <= 0 {
+		return nil, fmt.Errorf("%s: interval must be positive", b.Name())
+	}
+	m.scheduler.Every(d)
+	return starlark.None, nil
+}
+
+func now(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return starlarktime.Time(timing.Now()), nil
+}
+
+// toDuration converts a duration string, a number of seconds, or a Starlark
+// time.duration to a time.Duration.
+func toDuration(v starlark.Value) (time.Duration, error) {
+	switch v := v.(type) {
+	case starlark.String:
+		return time.ParseDuration(string(v))
+	case starlarktime.Duration:
+		return time.Duration(v), nil
+	}
+	if secs, ok := starlark.AsFloat(v); ok {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return 0, fmt.Errorf("invalid duration %s", v)
+}
+
+var httpModule = &starlarkstruct.Module{
+	Name: "http",
+	Members: starlark.StringDict{
+		"get": starlark.NewBuiltin("get", httpGet),
+	},
+}
+
+func httpGet(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url string
+	headers := new(starlark.Dict)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &url, "headers?", &headers); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range headers.Items() {
+		name, ok1 := starlark.AsString(item[0])
+		val, ok2 := starlark.AsString(item[1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%s: headers must be strings", b.Name())
+		}
+		req.Header.Add(name, val)
+	}
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxResponseSize {
+		return nil, fmt.Errorf("%s: response too large", b.Name())
+	}
+	return starlark.String(body), nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeScript(t *testing.T, src string) string {
+	filename := filepath.Join(t.TempDir(), "test.star")
+	require.NoError(t, ioutil.WriteFile(filename, []byte(src), 0644))
+	return filename
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	m := New(writeScript(t, `
+state = {"updates": 0, "button": "none"}
+timing.every("5s")
+
+def update():
+    state["updates"] += 1
+    return "%d: %s" % (state["updates"], state["button"])
+
+def click(event):
+    state["button"] = event.button
+    if event.button == "middle":
+        fail("middle click at", event.x)
+`))
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"1: none"})
+	testBar.AssertNoOutput("until refresh")
+
+	testBar.Tick()
+	out := testBar.NextOutput("on refresh")
+	out.AssertText([]string{"2: none"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on click")
+	out.AssertText([]string{"3: left"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonMiddle, X: 12})
+	errs := testBar.Drain(50*time.Millisecond, "on click error").AssertError()
+	require.Contains(t, errs[0], "middle click at 12")
+
+	testBar.LatestOutput().At(0).Click(bar.Event{Button: bar.ButtonMiddle})
+	testBar.Drain(50*time.Millisecond, "on restart").AssertText(
+		[]string{"1: none"}, "script is reloaded on restart")
+}
+
+func TestRefreshInterval(t *testing.T) {
+	testBar.New(t)
+	m := New(writeScript(t, `
+def update():
+    return timing.now().unix
+`))
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText(
+		[]string{fmt.Sprintf("%d", timing.Now().Unix())})
+	testBar.AssertNoOutput("without refresh interval")
+
+	m.RefreshInterval(time.Minute)
+	now := testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText(
+		[]string{fmt.Sprintf("%d", now.Unix())}, "uses timing.Now")
+}
+
+func TestErrors(t *testing.T) {
+	for desc, tc := range map[string]struct {
+		src      string
+		expected string
+	}{
+		"syntax error":     {"def update(:\n    pass\n", "test.star:1:"},
+		"no update":        {"x = 1\n", "update is not defined"},
+		"runtime error":    {"def update():\n    return 1 // 0\n", "division by zero"},
+		"invalid output":   {"def update():\n    return True\n", "cannot use bool as output"},
+		"invalid colour":   {"def update():\n    return output.segment('x', color='#xyz')\n", "invalid colour"},
+		"invalid interval": {"timing.every('soon')\ndef update():\n    return 'x'\n", "invalid duration"},
+		"load":             {"load('other.star', 'x')\ndef update():\n    return x\n", "load"},
+		"too many steps": {
+			"def update():\n    for i in range(100000000):\n        pass\n",
+			"too many steps",
+		},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			testBar.New(t)
+			testBar.Run(New(writeScript(t, tc.src)))
+			errs := testBar.NextOutput().AssertError()
+			require.Contains(t, errs[0], tc.expected)
+		})
+	}
+
+	testBar.New(t)
+	testBar.Run(New(filepath.Join(t.TempDir(), "missing.star")))
+	errs := testBar.NextOutput("missing file").AssertError()
+	require.Contains(t, errs[0], "no such file")
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/value":
+			fmt.Fprintf(w, `{"value": %q}`, r.Header.Get("X-Value"))
+		case "/large":
+			fmt.Fprint(w, strings.Repeat("x", maxResponseSize+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for path, expected := range map[string]string{
+		"/value":   "",
+		"/large":   "response too large",
+		"/missing": "404",
+	} {
+		testBar.New(t)
+		testBar.Run(New(writeScript(t, fmt.Sprintf(`
+def update():
+    body = http.get(%q, headers={"X-Value": "42"})
+    return json.decode(body)["value"]
+`, srv.URL+path))))
+		out := testBar.NextOutput(path)
+		if expected == "" {
+			out.AssertText([]string{"42"})
+		} else {
+			errs := out.AssertError()
+			require.Contains(t, errs[0], expected, path)
+		}
+	}
+}
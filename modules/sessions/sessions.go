@@ -0,0 +1,318 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sessions provides a bar module that shows the login sessions known
+// to systemd-logind, and flags new remote (e.g. SSH) logins until they are
+// acknowledged, so that unexpected access to the machine is noticed quickly.
+package sessions // import "barista.run/modules/sessions"
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/watchers/dbus"
+	"barista.run/colors"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// Session represents a single logind session.
+type Session struct {
+	ID   string
+	User string
+	// Seat is the seat the session is attached to, e.g. "seat0". It is empty
+	// for remote sessions.
+	Seat string
+	// Type is the session type, e.g. "tty", "x11", "wayland", or "unspecified".
+	Type string
+	// Class is the session class, e.g. "user" or "greeter".
+	Class string
+	// Service is the PAM service that created the session, e.g. "sshd".
+	Service string
+	// State is "online", "active", or "closing".
+	State string
+	TTY   string
+	// Remote is true for sessions that were created over the network, in
+	// which case RemoteHost is the source address (or host name), and
+	// RemoteUser is the user on the remote host, if known.
+	Remote     bool
+	RemoteHost string
+	RemoteUser string
+	Started    time.Time
+}
+
+// String returns a short description of the session, e.g. "alice@10.0.0.5"
+// for remote sessions, or "alice@seat0" for local sessions.
+func (s Session) String() string {
+	where := s.Seat
+	switch {
+	case s.Remote && s.RemoteHost != "":
+		where = s.RemoteHost
+	case s.Remote:
+		where = "remote"
+	case where == "":
+		where = s.TTY
+	}
+	return fmt.Sprintf("%s@%s", s.User, where)
+}
+
+// Info represents the current login sessions.
+type Info struct {
+	// Sessions contains all sessions, ordered by start time.
+	Sessions []Session
+	// New contains the remote sessions that started after the module, and
+	// have not been acknowledged yet.
+	New []Session
+
+	ack func()
+}
+
+// Remote returns all remote sessions.
+func (i Info) Remote() []Session {
+	var r []Session
+	for _, s := range i.Sessions {
+		if s.Remote {
+			r = append(r, s)
+		}
+	}
+	return r
+}
+
+// Users returns the number of distinct users with a session.
+func (i Info) Users() int {
+	users := map[string]bool{}
+	for _, s := range i.Sessions {
+		users[s.User] = true
+	}
+	return len(users)
+}
+
+// Acknowledge clears the list of new remote sessions.
+func (i Info) Acknowledge() {
+	if i.ack != nil {
+		i.ack()
+	}
+}
+
+// Module represents a bar module that shows login sessions.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// New constructs a sessions module. By default, it shows nothing unless a
+// remote session is active, and flags new remote sessions as urgent until
+// they are clicked.
+func New() *Module {
+	m := &Module{}
+	l.Register(m, "outputFunc")
+	m.Output(func(i Info) bar.Output {
+		if len(i.New) > 0 {
+			s := i.New[len(i.New)-1]
+			out := outputs.Textf("SSH %s", s)
+			if len(i.New) > 1 {
+				out = outputs.Textf("SSH %s (+%d)", s, len(i.New)-1)
+			}
+			return out.Color(colors.Scheme("bad")).Urgent(true).
+				OnClick(func(e bar.Event) {
+					if e.Button == bar.ButtonLeft {
+						i.Acknowledge()
+					}
+				})
+		}
+		if r := i.Remote(); len(r) > 0 {
+			return outputs.Textf("SSH %d", len(r))
+		}
+		return nil
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Overridden in tests.
+var busType = dbus.System
+
+const (
+	logindService = "org.freedesktop.login1"
+	logindPath    = "/org/freedesktop/login1"
+	managerIface  = "org.freedesktop.login1.Manager"
+	sessionIface  = "org.freedesktop.login1.Session"
+)
+
+var sessionProps = []string{
+	"Id", "Name", "Seat", "Type", "Class", "Service", "State", "TTY",
+	"Remote", "RemoteHost", "RemoteUser", "Timestamp",
+}
+
+// session wraps a properties watcher for a single logind session, and
+// forwards its updates until closed.
+type session struct {
+	w    *dbus.PropertiesWatcher
+	done chan struct{}
+}
+
+func watchSession(path godbus.ObjectPath, notifyFn func()) *session {
+	s := &session{
+		w:    dbus.WatchProperties(busType, logindService, string(path), sessionIface).Add(sessionProps...),
+		done: make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-s.w.Updates:
+				notifyFn()
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+func (s *session) close() {
+	close(s.done)
+	s.w.Unsubscribe()
+}
+
+func (s *session) info() Session {
+	props := s.w.Get()
+	var i Session
+	i.ID, _ = props["Id"].(string)
+	i.User, _ = props["Name"].(string)
+	if seat, ok := props["Seat"].([]interface{}); ok && len(seat) > 0 {
+		i.Seat, _ = seat[0].(string)
+	}
+	i.Type, _ = props["Type"].(string)
+	i.Class, _ = props["Class"].(string)
+	i.Service, _ = props["Service"].(string)
+	i.State, _ = props["State"].(string)
+	i.TTY, _ = props["TTY"].(string)
+	i.Remote, _ = props["Remote"].(bool)
+	i.RemoteHost, _ = props["RemoteHost"].(string)
+	i.RemoteUser, _ = props["RemoteUser"].(string)
+	if ts, ok := props["Timestamp"].(uint64); ok && ts > 0 {
+		i.Started = time.Unix(0, int64(ts)*int64(time.Microsecond))
+	}
+	return i
+}
+
+func sessionsChanged(s *dbus.Signal, _ dbus.Fetcher) map[string]interface{} {
+	return map[string]interface{}{"Sessions": s.Body}
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	w := dbus.WatchProperties(busType, logindService, logindPath, managerIface).
+		AddSignalHandler("SessionNew", sessionsChanged).
+		AddSignalHandler("SessionRemoved", sessionsChanged)
+	defer w.Unsubscribe()
+
+	notifyFn, sessionUpdates := notifier.New()
+	sessions := map[godbus.ObjectPath]*session{}
+	defer func() {
+		for _, s := range sessions {
+			s.close()
+		}
+	}()
+	ackFn, acks := notifier.New()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	enumerate(w, sessions, notifyFn)
+	// Sessions that existed when the module started, or were acknowledged.
+	seen := map[string]bool{}
+	for _, s := range info(sessions).Sessions {
+		seen[s.ID] = true
+	}
+	for {
+		i := info(sessions)
+		i.ack = ackFn
+		for _, s := range i.Sessions {
+			if s.Remote && !seen[s.ID] {
+				i.New = append(i.New, s)
+			}
+		}
+		sink.Output(outputFunc(i))
+		select {
+		case <-w.Updates:
+			enumerate(w, sessions, notifyFn)
+		case <-sessionUpdates:
+		case <-acks:
+			for _, s := range i.New {
+				seen[s.ID] = true
+			}
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// enumerate updates the set of watched sessions to match those reported by
+// logind, adding watchers for new sessions and removing those that are gone.
+func enumerate(w *dbus.PropertiesWatcher, sessions map[godbus.ObjectPath]*session, notifyFn func()) {
+	var list []struct {
+		ID   string
+		UID  uint32
+		User string
+		Seat string
+		Path godbus.ObjectPath
+	}
+	if r, err := w.Call("ListSessions"); err != nil {
+		l.Log("Failed to list logind sessions: %v", err)
+	} else if err := godbus.Store(r, &list); err != nil {
+		l.Log("Failed to list logind sessions: %v", err)
+	}
+	current := map[godbus.ObjectPath]bool{}
+	for _, s := range list {
+		current[s.Path] = true
+		if _, ok := sessions[s.Path]; !ok {
+			sessions[s.Path] = watchSession(s.Path, notifyFn)
+		}
+	}
+	for p, s := range sessions {
+		if !current[p] {
+			s.close()
+			delete(sessions, p)
+		}
+	}
+}
+
+func info(sessions map[godbus.ObjectPath]*session) Info {
+	var i Info
+	for _, s := range sessions {
+		if sess := s.info(); sess.ID != "" {
+			i.Sessions = append(i.Sessions, sess)
+		}
+	}
+	sort.Slice(i.Sessions, func(a, b int) bool {
+		sa, sb := i.Sessions[a], i.Sessions[b]
+		if !sa.Started.Equal(sb.Started) {
+			return sa.Started.Before(sb.Started)
+		}
+		return sa.ID < sb.ID
+	})
+	return i
+}
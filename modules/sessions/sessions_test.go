@@ -0,0 +1,194 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessions
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogind struct {
+	svc     *dbus.TestBusService
+	manager *dbus.TestBusObject
+
+	mu       sync.Mutex
+	sessions [][]interface{}
+}
+
+func setupTestLogind() *testLogind {
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	u := &testLogind{svc: bus.RegisterService(logindService)}
+	u.manager = u.svc.Object(logindPath, managerIface)
+	u.manager.On("ListSessions", func(...interface{}) ([]interface{}, error) {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return []interface{}{append([][]interface{}{}, u.sessions...)}, nil
+	})
+	return u
+}
+
+func sessionPath(id string) godbus.ObjectPath {
+	return godbus.ObjectPath(logindPath + "/session/_3" + id)
+}
+
+func (u *testLogind) add(id, user string, props map[string]interface{}) *dbus.TestBusObject {
+	path := sessionPath(id)
+	obj := u.svc.Object(path, sessionIface)
+	props["Id"] = id
+	props["Name"] = user
+	obj.SetProperties(props, dbus.SignalTypeNone)
+	seat := ""
+	if s, ok := props["Seat"].([]interface{}); ok {
+		seat = s[0].(string)
+	}
+	u.mu.Lock()
+	u.sessions = append(u.sessions, []interface{}{id, uint32(1000), user, seat, path})
+	u.mu.Unlock()
+	u.manager.Emit("SessionNew", id, path)
+	return obj
+}
+
+func (u *testLogind) remove(id string) {
+	path := sessionPath(id)
+	u.mu.Lock()
+	for i, s := range u.sessions {
+		if s[4] == path {
+			u.sessions = append(u.sessions[:i], u.sessions[i+1:]...)
+			break
+		}
+	}
+	u.mu.Unlock()
+	u.manager.Emit("SessionRemoved", id, path)
+}
+
+func local(started time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"Seat":      []interface{}{"seat0", godbus.ObjectPath(logindPath + "/seat/seat0")},
+		"Type":      "wayland",
+		"Class":     "user",
+		"Service":   "gdm-password",
+		"State":     "active",
+		"TTY":       "tty2",
+		"Remote":    false,
+		"Timestamp": uint64(started.UnixNano() / 1000),
+	}
+}
+
+func ssh(host string, started time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"Seat":       []interface{}{"", godbus.ObjectPath("/")},
+		"Type":       "tty",
+		"Class":      "user",
+		"Service":    "sshd",
+		"State":      "online",
+		"TTY":        "pts/1",
+		"Remote":     true,
+		"RemoteHost": host,
+		"Timestamp":  uint64(started.UnixNano() / 1000),
+	}
+}
+
+var start = time.Date(2018, 10, 1, 9, 0, 0, 0, time.UTC)
+
+func TestSessions(t *testing.T) {
+	testBar.New(t)
+	u := setupTestLogind()
+	u.add("1", "alice", local(start))
+	u.add("2", "alice", ssh("10.0.0.5", start.Add(time.Minute)))
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertText([]string{"SSH 1"},
+		"existing remote sessions are not new")
+
+	u.add("3", "mallory", ssh("203.0.113.7", start.Add(time.Hour)))
+	out := testBar.NextOutput("on new remote session")
+	out.AssertText([]string{"SSH mallory@203.0.113.7"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent)
+	col, _ := out.At(0).Segment().GetColor()
+	require.Equal(t, colors.Scheme("bad"), col)
+
+	u.add("4", "bob", ssh("", start.Add(2*time.Hour)))
+	out = testBar.NextOutput("on another remote session")
+	out.AssertText([]string{"SSH bob@remote (+1)"})
+
+	u.add("5", "carol", local(start.Add(3*time.Hour)))
+	testBar.NextOutput("on local session").
+		AssertText([]string{"SSH bob@remote (+1)"}, "local sessions are not flagged")
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	testBar.AssertNoOutput("on scroll")
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on acknowledge")
+	out.AssertText([]string{"SSH 3"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	u.remove("2")
+	u.remove("3")
+	u.remove("4")
+	testBar.LatestOutput().AssertEmpty("no remote sessions")
+}
+
+func TestSessionDetails(t *testing.T) {
+	testBar.New(t)
+	u := setupTestLogind()
+	u.add("c1", "gdm", map[string]interface{}{"Class": "greeter", "TTY": "tty1"})
+	u.add("1", "alice", local(start))
+
+	testBar.Run(New().Output(func(i Info) bar.Output {
+		out := outputs.Group()
+		for _, s := range i.Sessions {
+			out.Append(outputs.Textf("%s:%s %s/%s %s",
+				s.ID, s, s.Service, s.Type, s.Started.UTC().Format("15:04")))
+		}
+		return out.Append(outputs.Textf("%d users, %d new", i.Users(), len(i.New)))
+	}))
+	testBar.NextOutput("on start").AssertText([]string{
+		"c1:gdm@tty1 / 00:00",
+		"1:alice@seat0 gdm-password/wayland 09:00",
+		"2 users, 0 new",
+	})
+
+	obj := u.add("2", "alice", ssh("10.0.0.5", start.Add(time.Minute)))
+	testBar.LatestOutput().AssertText([]string{
+		"c1:gdm@tty1 / 00:00",
+		"1:alice@seat0 gdm-password/wayland 09:00",
+		"2:alice@10.0.0.5 sshd/tty 09:01",
+		"2 users, 1 new",
+	})
+
+	obj.SetProperty("State", "closing", dbus.SignalTypeChanged)
+	testBar.NextOutput("on session property change")
+}
+
+func TestNoLogind(t *testing.T) {
+	testBar.New(t)
+	dbus.SetupTestBus()
+	busType = dbus.Test
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertEmpty()
+}
@@ -27,7 +27,7 @@ import (
 
 	"barista.run/bar"
 	"barista.run/base/notifier"
-	"barista.run/base/value"
+	"barista.run/core"
 	"barista.run/outputs"
 	"barista.run/timing"
 )
@@ -36,7 +36,7 @@ import (
 type Module struct {
 	cmd       string
 	args      []string
-	outf      value.Value // of func(string) bar.Output
+	outf      core.OutputFunc // of func(string) bar.Output
 	notifyCh  <-chan struct{}
 	notifyFn  func()
 	scheduler *timing.Scheduler
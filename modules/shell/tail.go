@@ -20,7 +20,7 @@ import (
 	"syscall"
 
 	"barista.run/bar"
-	"barista.run/base/value"
+	"barista.run/core"
 	"barista.run/outputs"
 )
 
@@ -29,7 +29,7 @@ import (
 type TailModule struct {
 	cmd  string
 	args []string
-	outf value.Value // of func(string) bar.Output
+	outf core.OutputFunc // of func(string) bar.Output
 }
 
 // Tail constructs a module that displays the last line of output from a long
@@ -0,0 +1,159 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"barista.run/base/httpclient"
+
+	"golang.org/x/net/websocket"
+)
+
+// Mattermost constructs a module for a Mattermost server, e.g.
+// "https://mattermost.example.com", using a personal access token. Events are
+// received through the websocket API, and unread counts include all teams.
+// Clicking opens the server in the default browser.
+func Mattermost(server, accessToken string) *Module {
+	server = strings.TrimSuffix(server, "/")
+	return newModule(&mattermost{server: server, token: accessToken}, server)
+}
+
+type mattermost struct {
+	server string
+	token  string
+}
+
+func (m *mattermost) name() string { return "mattermost" }
+
+type mattermostError struct {
+	Message string `json:"message"`
+}
+
+// get makes a Mattermost API request, decoding the response into result.
+func (m *mattermost) get(path string, result interface{}) error {
+	req, err := http.NewRequest("GET", m.server+"/api/v4"+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		var e mattermostError
+		if json.Unmarshal(body, &e) == nil && e.Message != "" {
+			return fmt.Errorf("mattermost: %s: %s", resp.Status, e.Message)
+		}
+		return fmt.Errorf("mattermost: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (m *mattermost) counts() ([]Conversation, error) {
+	var teams []struct {
+		ID string `json:"id"`
+	}
+	if err := m.get("/users/me/teams", &teams); err != nil {
+		return nil, err
+	}
+	var convs []Conversation
+	// Direct and group messages are included in the channels for every team.
+	seen := map[string]bool{}
+	for _, t := range teams {
+		var channels []struct {
+			ID       string `json:"id"`
+			Type     string `json:"type"`
+			Messages int64  `json:"total_msg_count"`
+		}
+		if err := m.get("/users/me/teams/"+t.ID+"/channels", &channels); err != nil {
+			return nil, err
+		}
+		var members []struct {
+			ChannelID string `json:"channel_id"`
+			Messages  int64  `json:"msg_count"`
+			Mentions  int    `json:"mention_count"`
+		}
+		if err := m.get("/users/me/teams/"+t.ID+"/channels/members", &members); err != nil {
+			return nil, err
+		}
+		read := map[string]int64{}
+		mentions := map[string]int{}
+		for _, cm := range members {
+			read[cm.ChannelID] = cm.Messages
+			mentions[cm.ChannelID] = cm.Mentions
+		}
+		for _, c := range channels {
+			if seen[c.ID] {
+				continue
+			}
+			seen[c.ID] = true
+			convs = append(convs, Conversation{
+				ID:       c.ID,
+				Direct:   c.Type == "D" || c.Type == "G",
+				Unread:   c.Messages > read[c.ID],
+				Mentions: mentions[c.ID],
+			})
+		}
+	}
+	return convs, nil
+}
+
+// mattermostEvents is the set of websocket events that may change the unread
+// counts.
+var mattermostEvents = map[string]bool{
+	"posted":                   true,
+	"post_deleted":             true,
+	"channel_viewed":           true,
+	"multiple_channels_viewed": true,
+	"channel_created":          true,
+	"channel_deleted":          true,
+	"direct_added":             true,
+	"group_added":              true,
+	"user_added":               true,
+	"user_removed":             true,
+}
+
+func (m *mattermost) listen(notify func()) error {
+	wsURL := "ws" + strings.TrimPrefix(m.server, "http") + "/api/v4/websocket"
+	cfg, err := websocket.NewConfig(wsURL, m.server)
+	if err != nil {
+		return err
+	}
+	cfg.Header.Set("Authorization", "Bearer "+m.token)
+	conn, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		var evt struct {
+			Event string `json:"event"`
+		}
+		if err := websocket.JSON.Receive(conn, &evt); err != nil {
+			return err
+		}
+		if mattermostEvents[evt.Event] {
+			notify()
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+type fakeMattermost struct {
+	*httptest.Server
+
+	sync.Mutex
+	responses map[string]string
+	connects  int
+	events    chan string
+}
+
+func newFakeMattermost() *fakeMattermost {
+	f := &fakeMattermost{
+		responses: map[string]string{},
+		events:    make(chan string, 10),
+	}
+	ws := websocket.Handler(func(ws *websocket.Conn) {
+		f.Lock()
+		f.connects++
+		f.Unlock()
+		fmt.Fprint(ws, `{"event":"hello","data":{"server_version":"9.0.0"},"seq":0}`)
+		for evt := range f.events {
+			if evt == "close" {
+				return
+			}
+			fmt.Fprint(ws, evt)
+		}
+	})
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"id":"api.context.session_expired.app_error",`+
+				`"message":"Invalid or expired session, please login again.","status_code":401}`)
+			return
+		}
+		if r.URL.Path == "/api/v4/websocket" {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		f.Lock()
+		defer f.Unlock()
+		resp, ok := f.responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "404 page not found")
+			return
+		}
+		fmt.Fprint(w, resp)
+	}))
+	return f
+}
+
+func (f *fakeMattermost) respond(path, response string) {
+	f.Lock()
+	defer f.Unlock()
+	f.responses["/api/v4"+path] = response
+}
+
+func (f *fakeMattermost) connectCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.connects
+}
+
+func TestMattermost(t *testing.T) {
+	testBar.New(t)
+	f := newFakeMattermost()
+	defer f.Close()
+
+	f.respond("/users/me/teams", `[{"id":"t1"},{"id":"t2"}]`)
+	f.respond("/users/me/teams/t1/channels", `[
+		{"id":"c1","type":"O","total_msg_count":10},
+		{"id":"c2","type":"P","total_msg_count":5},
+		{"id":"d1","type":"D","total_msg_count":3}]`)
+	f.respond("/users/me/teams/t1/channels/members", `[
+		{"channel_id":"c1","msg_count":8,"mention_count":0},
+		{"channel_id":"c2","msg_count":5,"mention_count":0},
+		{"channel_id":"d1","msg_count":3,"mention_count":0}]`)
+	f.respond("/users/me/teams/t2/channels", `[
+		{"id":"c3","type":"O","total_msg_count":1},
+		{"id":"d1","type":"D","total_msg_count":3}]`)
+	f.respond("/users/me/teams/t2/channels/members", `[
+		{"channel_id":"c3","msg_count":1,"mention_count":0},
+		{"channel_id":"d1","msg_count":3,"mention_count":0}]`)
+
+	m := Mattermost(f.URL+"/", "token")
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%d/%d/%d", i.Unread(), i.Direct(), i.Mentions())
+	})
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"1/0/0"})
+	for f.connectCount() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	f.events <- `{"event":"typing","data":{},"broadcast":{"channel_id":"d1"},"seq":1}`
+	testBar.AssertNoOutput("on unrelated event")
+
+	f.respond("/users/me/teams/t1/channels/members", `[
+		{"channel_id":"c1","msg_count":8,"mention_count":0},
+		{"channel_id":"c2","msg_count":5,"mention_count":0},
+		{"channel_id":"d1","msg_count":3,"mention_count":2},
+		{"channel_id":"g1","msg_count":0,"mention_count":1}]`)
+	f.respond("/users/me/teams/t1/channels", `[
+		{"id":"c1","type":"O","total_msg_count":10},
+		{"id":"c2","type":"P","total_msg_count":5},
+		{"id":"d1","type":"D","total_msg_count":5},
+		{"id":"g1","type":"G","total_msg_count":1}]`)
+	f.respond("/users/me/teams/t2/channels", `[
+		{"id":"c3","type":"O","total_msg_count":2},
+		{"id":"d1","type":"D","total_msg_count":5},
+		{"id":"g1","type":"G","total_msg_count":1}]`)
+	f.respond("/users/me/teams/t2/channels/members", `[
+		{"channel_id":"c3","msg_count":1,"mention_count":1},
+		{"channel_id":"d1","msg_count":3,"mention_count":2},
+		{"channel_id":"g1","msg_count":0,"mention_count":1}]`)
+	f.events <- `{"event":"posted","data":{"channel_type":"D"},"broadcast":{"channel_id":"d1"},"seq":2}`
+	testBar.NextOutput("on post").AssertText([]string{"4/2/4"},
+		"direct channels are only counted once")
+
+	f.events <- "close"
+	testBar.NextOutput("on disconnect").AssertText([]string{"4/2/4"})
+	for f.connectCount() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	f.respond("/users/me/teams", `[]`)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"0/0/0"})
+
+	delete(f.responses, "/api/v4/users/me/teams")
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestMattermostErrors(t *testing.T) {
+	testBar.New(t)
+	f := newFakeMattermost()
+	defer f.Close()
+	f.respond("/users/me/teams", `[{"id":"t1"}]`)
+
+	testBar.Run(Mattermost(f.URL, "wrong"))
+	errs := testBar.NextOutput("on start").AssertError()
+	require.Contains(t, errs[0], "Invalid or expired session")
+
+	testBar.New(t)
+	testBar.Run(Mattermost(f.URL, "token"))
+	errs = testBar.NextOutput("on start").AssertError("with missing channels")
+	require.Contains(t, errs[0], "404 page not found")
+
+	testBar.New(t)
+	f.respond("/users/me/teams/t1/channels", `[]`)
+	testBar.Run(Mattermost(f.URL, "token"))
+	errs = testBar.NextOutput("on start").AssertError("with missing members")
+	require.Contains(t, errs[0], "404")
+
+	mm := &mattermost{server: "http://127.0.0.1:1", token: "token"}
+	require.Error(t, mm.listen(func() {}))
+}
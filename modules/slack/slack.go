@@ -0,0 +1,206 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package slack provides a bar module that shows the number of unread
+// conversations and mentions in Slack or Mattermost. It listens for events on
+// the real-time websocket API, and fetches the unread counts whenever a
+// message is posted or a conversation is read.
+package slack // import "barista.run/modules/slack"
+
+import (
+	"os/exec"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Conversation represents the unread state of a channel or direct message.
+type Conversation struct {
+	ID string
+	// Direct is true for direct messages and group direct messages.
+	Direct bool
+	// Unread is true if there are any unread messages.
+	Unread bool
+	// Mentions is the number of unread messages that mention the user. All
+	// unread messages in direct conversations count as mentions.
+	Mentions int
+}
+
+// Info represents the unread state of all conversations.
+type Info struct {
+	// Backend is the name of the service, "slack" or "mattermost".
+	Backend string
+	// Conversations is the list of conversations with unread messages.
+	Conversations []Conversation
+
+	url string
+}
+
+// Unread returns the number of conversations with unread messages.
+func (i Info) Unread() int {
+	return len(i.Conversations)
+}
+
+// Mentions returns the total number of unread mentions.
+func (i Info) Mentions() int {
+	c := 0
+	for _, conv := range i.Conversations {
+		c += conv.Mentions
+	}
+	return c
+}
+
+// Direct returns the number of direct conversations with unread messages.
+func (i Info) Direct() int {
+	c := 0
+	for _, conv := range i.Conversations {
+		if conv.Direct {
+			c++
+		}
+	}
+	return c
+}
+
+// Open opens the chat client.
+func (i Info) Open() {
+	if i.url == "" {
+		return
+	}
+	if err := openURL(i.url); err != nil {
+		l.Log("Failed to open %s: %v", i.url, err)
+	}
+}
+
+// backend abstracts a chat service.
+type backend interface {
+	name() string
+	// counts returns the unread state of all conversations the user is in.
+	counts() ([]Conversation, error)
+	// listen connects to the real-time API and calls notify for each event
+	// that may change the unread counts, until the connection fails.
+	listen(notify func()) error
+}
+
+// Module represents a bar module that shows unread conversations.
+type Module struct {
+	backend    backend
+	url        string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+
+	listenOnce sync.Once
+	updates    chan struct{}
+}
+
+func newModule(b backend, url string) *Module {
+	m := &Module{
+		backend:   b,
+		url:       url,
+		scheduler: timing.NewScheduler().Every(5 * time.Minute),
+		updates:   make(chan struct{}, 1),
+	}
+	l.Label(m, b.name())
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		if i.Unread() == 0 {
+			return nil
+		}
+		if n := i.Mentions(); n > 0 {
+			return outputs.Textf("MSG %d (%d)", i.Unread(), n).
+				Urgent(true).OnClick(click.Left(i.Open))
+		}
+		return outputs.Textf("MSG %d", i.Unread()).OnClick(click.Left(i.Open))
+	})
+	return m
+}
+
+// App sets the URL that is opened by Info.Open. It must be called before the
+// module is started.
+func (m *Module) App(url string) *Module {
+	m.url = url
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency for unread counts, in case
+// any real-time events are missed, e.g. while reconnecting.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+func (m *Module) notify() {
+	select {
+	case m.updates <- struct{}{}:
+	default:
+	}
+}
+
+// listen keeps a real-time connection open for the lifetime of the module,
+// reconnecting after a delay on errors.
+func (m *Module) listen() {
+	for {
+		err := m.backend.listen(m.notify)
+		l.Log("%s: real-time connection lost: %v", m.backend.name(), err)
+		// Events may have been missed while disconnected.
+		m.notify()
+		time.Sleep(reconnectDelay)
+	}
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	m.listenOnce.Do(func() { go m.listen() })
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	for {
+		convs, err := m.backend.counts()
+		if sink.Error(err) {
+			return
+		}
+		i := Info{Backend: m.backend.name(), Conversations: []Conversation{}, url: m.url}
+		for _, c := range convs {
+			if c.Unread || c.Mentions > 0 {
+				i.Conversations = append(i.Conversations, c)
+			}
+		}
+		sink.Output(outputFunc(i))
+		select {
+		case <-m.scheduler.C:
+		case <-m.updates:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// Overridden in tests.
+var (
+	reconnectDelay = 30 * time.Second
+	openURL        = func(url string) error {
+		return exec.Command("xdg-open", url).Run()
+	}
+)
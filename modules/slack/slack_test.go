@@ -0,0 +1,170 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackend struct {
+	sync.Mutex
+	convs   []Conversation
+	err     error
+	listens int
+
+	events     chan struct{}
+	disconnect chan error
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		events:     make(chan struct{}),
+		disconnect: make(chan error),
+	}
+}
+
+func (f *fakeBackend) name() string { return "fake" }
+
+func (f *fakeBackend) counts() ([]Conversation, error) {
+	f.Lock()
+	defer f.Unlock()
+	return append([]Conversation(nil), f.convs...), f.err
+}
+
+func (f *fakeBackend) listen(notify func()) error {
+	f.Lock()
+	f.listens++
+	f.Unlock()
+	for {
+		select {
+		case <-f.events:
+			notify()
+		case err := <-f.disconnect:
+			return err
+		}
+	}
+}
+
+func (f *fakeBackend) set(convs []Conversation, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.convs = convs
+	f.err = err
+}
+
+func (f *fakeBackend) listenCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.listens
+}
+
+func init() {
+	reconnectDelay = 10 * time.Millisecond
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	var opened []string
+	var openedMu sync.Mutex
+	openURL = func(url string) error {
+		openedMu.Lock()
+		defer openedMu.Unlock()
+		opened = append(opened, url)
+		return nil
+	}
+
+	f := newFakeBackend()
+	f.set([]Conversation{
+		{ID: "C1", Unread: true},
+		{ID: "C2"},
+		{ID: "C3", Unread: true},
+	}, nil)
+	m := newModule(f, "https://chat.example.com")
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"MSG 2"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent, "not urgent without mentions")
+	out.At(0).LeftClick()
+	openedMu.Lock()
+	require.Equal(t, []string{"https://chat.example.com"}, opened)
+	openedMu.Unlock()
+
+	f.set([]Conversation{
+		{ID: "C1", Unread: true, Mentions: 1},
+		{ID: "D1", Direct: true, Unread: true, Mentions: 2},
+	}, nil)
+	f.events <- struct{}{}
+	out = testBar.NextOutput("on event")
+	out.AssertText([]string{"MSG 2 (3)"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "urgent with mentions")
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %d/%d/%d", i.Backend, i.Unread(), i.Direct(), i.Mentions())
+	})
+	testBar.NextOutput("on output change").AssertText([]string{"fake 2/1/3"})
+
+	f.set([]Conversation{{ID: "D1", Direct: true, Mentions: 1}}, nil)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"fake 1/1/1"},
+		"includes mentions without unread messages")
+
+	f.set(nil, nil)
+	f.disconnect <- errors.New("connection reset")
+	testBar.NextOutput("on disconnect").AssertText([]string{"fake 0/0/0"})
+	for f.listenCount() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	f.set([]Conversation{{ID: "C1", Unread: true}}, nil)
+	f.events <- struct{}{}
+	testBar.NextOutput("after reconnect").AssertText([]string{"fake 1/0/0"})
+
+	f.set(nil, errors.New("something went wrong"))
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+
+	f.set(nil, nil)
+	testBar.NextOutput().At(0).LeftClick()
+	testBar.NextOutput().Expect("on restart")
+	testBar.NextOutput("after restart").AssertText([]string{"fake 0/0/0"})
+	require.Equal(t, 2, f.listenCount(), "keeps connection across restarts")
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	openURL = func(string) error {
+		return fmt.Errorf("should not open without an app URL")
+	}
+	f := newFakeBackend()
+	testBar.Run(newModule(f, "").App(""))
+	testBar.NextOutput("on start").AssertEmpty()
+
+	f.set([]Conversation{{ID: "C1", Unread: true}}, nil)
+	testBar.Tick()
+	out := testBar.NextOutput("on refresh")
+	out.AssertText([]string{"MSG 1"})
+	out.At(0).LeftClick()
+}
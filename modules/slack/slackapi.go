@@ -0,0 +1,159 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"barista.run/base/httpclient"
+
+	"golang.org/x/net/websocket"
+)
+
+// Slack constructs a module for a Slack workspace, using a user token (xoxp-)
+// since bot tokens do not have access to the user's unread state. Events are
+// received through the RTM API, and the unread counts are fetched using the
+// same endpoint as the Slack clients. Clicking opens the Slack app.
+func Slack(userToken string) *Module {
+	return newModule(&slack{api: slackAPI, token: userToken}, "slack://open")
+}
+
+// Overridden in tests.
+var slackAPI = "https://slack.com/api"
+
+type slack struct {
+	api   string
+	token string
+}
+
+func (s *slack) name() string { return "slack" }
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+type slackCount struct {
+	ID         string `json:"id"`
+	HasUnreads bool   `json:"has_unreads"`
+	Mentions   int    `json:"mention_count"`
+}
+
+// call makes a Slack Web API call, decoding the response into result.
+func (s *slack) call(method string, result interface{}) error {
+	req, err := http.NewRequest("POST", s.api+"/"+method, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("slack: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var r slackResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return err
+	}
+	if !r.OK {
+		return fmt.Errorf("slack: %s: %s", method, r.Error)
+	}
+	return json.Unmarshal(body, result)
+}
+
+func (s *slack) counts() ([]Conversation, error) {
+	var r struct {
+		Channels []slackCount `json:"channels"`
+		MPIMs    []slackCount `json:"mpims"`
+		IMs      []slackCount `json:"ims"`
+	}
+	if err := s.call("client.counts", &r); err != nil {
+		return nil, err
+	}
+	var convs []Conversation
+	add := func(counts []slackCount, direct bool) {
+		for _, c := range counts {
+			convs = append(convs, Conversation{
+				ID:       c.ID,
+				Direct:   direct,
+				Unread:   c.HasUnreads,
+				Mentions: c.Mentions,
+			})
+		}
+	}
+	add(r.Channels, false)
+	add(r.MPIMs, true)
+	add(r.IMs, true)
+	return convs, nil
+}
+
+// slackEvents is the set of RTM events that may change the unread counts.
+var slackEvents = map[string]bool{
+	"message":        true,
+	"channel_marked": true,
+	"group_marked":   true,
+	"im_marked":      true,
+	"mpim_marked":    true,
+	"channel_joined": true,
+	"channel_left":   true,
+	"group_joined":   true,
+	"group_left":     true,
+	"im_created":     true,
+}
+
+func (s *slack) listen(notify func()) error {
+	var r struct {
+		URL string `json:"url"`
+	}
+	if err := s.call("rtm.connect", &r); err != nil {
+		return err
+	}
+	conn, err := websocket.Dial(r.URL, "", "https://slack.com/")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for {
+		var evt struct {
+			Type  string `json:"type"`
+			Error struct {
+				Msg string `json:"msg"`
+			} `json:"error"`
+		}
+		if err := websocket.JSON.Receive(conn, &evt); err != nil {
+			return err
+		}
+		switch {
+		case evt.Type == "error":
+			return fmt.Errorf("slack: %s", evt.Error.Msg)
+		case evt.Type == "goodbye":
+			return errors.New("slack: server closed connection")
+		case slackEvents[evt.Type]:
+			notify()
+		}
+	}
+}
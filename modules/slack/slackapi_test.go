@@ -0,0 +1,163 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slack
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+type fakeSlack struct {
+	*httptest.Server
+
+	sync.Mutex
+	counts   string
+	connects int
+	events   chan string
+}
+
+func newFakeSlack() *fakeSlack {
+	f := &fakeSlack{events: make(chan string, 10)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", f.handleAPI)
+	mux.Handle("/rtm", websocket.Handler(func(ws *websocket.Conn) {
+		for evt := range f.events {
+			fmt.Fprint(ws, evt)
+			if strings.Contains(evt, `"goodbye"`) || strings.Contains(evt, `"error"`) {
+				return
+			}
+		}
+	}))
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func (f *fakeSlack) handleAPI(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer xoxp-token" {
+		fmt.Fprint(w, `{"ok":false,"error":"invalid_auth"}`)
+		return
+	}
+	switch r.URL.Path {
+	case "/api/rtm.connect":
+		f.connects++
+		fmt.Fprintf(w, `{"ok":true,"url":"ws%s/rtm","self":{"id":"U1"}}`,
+			strings.TrimPrefix(f.URL, "http"))
+	case "/api/client.counts":
+		if f.counts == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, f.counts)
+	default:
+		fmt.Fprint(w, `{"ok":false,"error":"unknown_method"}`)
+	}
+}
+
+func (f *fakeSlack) setCounts(counts string) {
+	f.Lock()
+	defer f.Unlock()
+	f.counts = counts
+}
+
+func (f *fakeSlack) connectCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return f.connects
+}
+
+func TestSlack(t *testing.T) {
+	testBar.New(t)
+	f := newFakeSlack()
+	defer f.Close()
+	slackAPI = f.URL + "/api"
+
+	f.setCounts(`{"ok":true,
+		"channels":[{"id":"C1","has_unreads":true,"mention_count":0},
+			{"id":"C2","has_unreads":false,"mention_count":0}],
+		"mpims":[],
+		"ims":[{"id":"D1","has_unreads":false,"mention_count":0}]}`)
+	m := Slack("xoxp-token")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"MSG 1"})
+
+	f.events <- `{"type":"hello"}`
+	f.events <- `{"type":"user_typing","channel":"D1","user":"U2"}`
+	testBar.AssertNoOutput("on unrelated events")
+
+	f.setCounts(`{"ok":true,
+		"channels":[{"id":"C1","has_unreads":true,"mention_count":1}],
+		"mpims":[{"id":"G1","has_unreads":true,"mention_count":0}],
+		"ims":[{"id":"D1","has_unreads":true,"mention_count":2}]}`)
+	f.events <- `{"type":"message","channel":"D1","user":"U2","text":"hi"}`
+	testBar.NextOutput("on message").AssertText([]string{"MSG 3 (3)"})
+
+	f.setCounts(`{"ok":true,"channels":[],"mpims":[],"ims":[]}`)
+	f.events <- `{"type":"im_marked","channel":"D1","ts":"1528000000.000100"}`
+	testBar.NextOutput("on read").AssertEmpty()
+
+	f.events <- `{"type":"goodbye"}`
+	testBar.NextOutput("on disconnect").AssertEmpty()
+	for f.connectCount() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	f.setCounts(`{"ok":true,"channels":[{"id":"C2","has_unreads":true}],"mpims":[],"ims":[]}`)
+	f.events <- `{"type":"channel_marked","channel":"C2"}`
+	testBar.NextOutput("after reconnect").AssertText([]string{"MSG 1"})
+
+	f.events <- `{"type":"error","error":{"code":1,"msg":"Socket URL has expired"}}`
+	testBar.NextOutput("on websocket error").AssertText([]string{"MSG 1"})
+
+	f.setCounts("")
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestSlackErrors(t *testing.T) {
+	testBar.New(t)
+	f := newFakeSlack()
+	defer f.Close()
+	slackAPI = f.URL + "/api"
+
+	testBar.Run(Slack("xoxb-token"))
+	errs := testBar.NextOutput("on start").AssertError()
+	require.Contains(t, errs[0], "invalid_auth")
+
+	testBar.New(t)
+	f.setCounts(`not json`)
+	testBar.Run(Slack("xoxp-token"))
+	testBar.NextOutput("on start").AssertError("with invalid response")
+
+	s := &slack{api: slackAPI, token: "xoxp-token"}
+	require.Error(t, s.call("unknown.method", &struct{}{}))
+	s.api = "http://127.0.0.1:1"
+	require.Error(t, s.listen(func() {}), "when rtm.connect fails")
+}
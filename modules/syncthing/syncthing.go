@@ -0,0 +1,315 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package syncthing provides a bar module that shows the sync status of a
+// Syncthing instance, using its REST API. The events API is used to refresh
+// the status as soon as anything changes.
+package syncthing // import "barista.run/modules/syncthing"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/httpclient"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"github.com/martinlindhe/unit"
+)
+
+// Folder represents the local state of a shared folder.
+type Folder struct {
+	ID    string
+	Label string
+	// State is the folder state reported by Syncthing, e.g. "idle",
+	// "scanning", "syncing", or "error".
+	State string
+	// Global is the size of the folder when fully synced, and Need is the
+	// amount of data that still needs to be synced locally.
+	Global, Need unit.Datasize
+	// Errors is the number of items that could not be synced.
+	Errors int
+}
+
+// Completion returns the local sync completion of the folder as a percentage.
+func (f Folder) Completion() float64 {
+	return completion(f.Global, f.Need)
+}
+
+// InSync returns true if the folder has nothing left to sync.
+func (f Folder) InSync() bool {
+	return f.Need == 0 && f.Errors == 0 && f.State != "error"
+}
+
+// HasError returns true if the folder is in an error state, or some items
+// could not be synced.
+func (f Folder) HasError() bool {
+	return f.Errors > 0 || f.State == "error"
+}
+
+func completion(global, need unit.Datasize) float64 {
+	if global <= 0 {
+		return 100
+	}
+	return 100 * (1 - need.Bytes()/global.Bytes())
+}
+
+// Info represents the status of a Syncthing instance.
+type Info struct {
+	// Folders are all unpaused folders, in configuration order.
+	Folders []Folder
+	// Devices is the number of remote devices configured, and Connected is
+	// the number of those that are currently connected.
+	Devices, Connected int
+}
+
+// Completion returns the local sync completion across all folders as a
+// percentage.
+func (i Info) Completion() float64 {
+	var global, need unit.Datasize
+	for _, f := range i.Folders {
+		global += f.Global
+		need += f.Need
+	}
+	return completion(global, need)
+}
+
+// OutOfSync returns the number of folders that are not in sync.
+func (i Info) OutOfSync() int {
+	count := 0
+	for _, f := range i.Folders {
+		if !f.InSync() {
+			count++
+		}
+	}
+	return count
+}
+
+// HasErrors returns true if any folder has errors.
+func (i Info) HasErrors() bool {
+	for _, f := range i.Folders {
+		if f.HasError() {
+			return true
+		}
+	}
+	return false
+}
+
+// Module represents a bar module that shows the status of Syncthing.
+type Module struct {
+	server     string
+	apiKey     string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a Syncthing module for the local instance, using the API key
+// from the Syncthing settings.
+func New(apiKey string) *Module {
+	return Server("http://localhost:8384", apiKey)
+}
+
+// Server constructs a Syncthing module for the instance at the given URL.
+// Since changes are signalled using events, the full status is only
+// refreshed every minute by default.
+func Server(server, apiKey string) *Module {
+	m := &Module{
+		server:    strings.TrimSuffix(server, "/"),
+		apiKey:    apiKey,
+		scheduler: timing.NewScheduler().Every(time.Minute),
+	}
+	l.Label(m, server)
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		out := outputs.Textf("%.0f%% %d/%d", i.Completion(), i.Connected, i.Devices)
+		if n := i.OutOfSync(); n > 0 {
+			out = outputs.Textf("%.0f%% (%d) %d/%d",
+				i.Completion(), n, i.Connected, i.Devices)
+		}
+		return out.Urgent(i.HasErrors())
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency, in addition to refreshing
+// whenever Syncthing emits a relevant event.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	events := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go m.watchEvents(events, stop)
+
+	info, err := m.getInfo()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info, err = m.getInfo()
+		case <-events:
+			info, err = m.getInfo()
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// eventRetryDelay is how long to wait before retrying after the events API
+// fails, e.g. while Syncthing is restarting.
+const eventRetryDelay = 10 * time.Second
+
+func (m *Module) get(path string, params url.Values, result interface{}) error {
+	u := m.server + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", m.apiKey)
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: HTTP %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// watchEvents long-polls the events API, notifying on each batch of relevant
+// events, until stop is closed.
+func (m *Module) watchEvents(events chan<- struct{}, stop <-chan struct{}) {
+	since := 0
+	params := url.Values{}
+	params.Set("timeout", "60")
+	params.Set("events", strings.Join([]string{
+		"StateChanged", "FolderSummary", "FolderErrors", "FolderPaused",
+		"FolderResumed", "DeviceConnected", "DeviceDisconnected", "ConfigSaved",
+	}, ","))
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		params.Set("since", fmt.Sprintf("%d", since))
+		var batch []struct {
+			ID int `json:"id"`
+		}
+		if err := m.get("/rest/events", params, &batch); err != nil {
+			l.Fine("%s: events: %v", l.ID(m), err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(eventRetryDelay):
+			}
+			continue
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		since = batch[len(batch)-1].ID
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type folderConfig struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Paused bool   `json:"paused"`
+}
+
+type folderStatus struct {
+	GlobalBytes int64  `json:"globalBytes"`
+	NeedBytes   int64  `json:"needBytes"`
+	State       string `json:"state"`
+	Errors      int    `json:"errors"`
+	// Older versions of Syncthing only report pull errors.
+	PullErrors int `json:"pullErrors"`
+}
+
+func (m *Module) getInfo() (Info, error) {
+	var i Info
+	var folders []folderConfig
+	if err := m.get("/rest/config/folders", nil, &folders); err != nil {
+		return i, err
+	}
+	for _, fc := range folders {
+		if fc.Paused {
+			continue
+		}
+		var s folderStatus
+		if err := m.get("/rest/db/status", url.Values{"folder": {fc.ID}}, &s); err != nil {
+			return i, err
+		}
+		f := Folder{
+			ID:     fc.ID,
+			Label:  fc.Label,
+			State:  s.State,
+			Global: unit.Datasize(s.GlobalBytes) * unit.Byte,
+			Need:   unit.Datasize(s.NeedBytes) * unit.Byte,
+			Errors: s.Errors,
+		}
+		if s.PullErrors > f.Errors {
+			f.Errors = s.PullErrors
+		}
+		i.Folders = append(i.Folders, f)
+	}
+	var conns struct {
+		Connections map[string]struct {
+			Connected bool `json:"connected"`
+			Paused    bool `json:"paused"`
+		} `json:"connections"`
+	}
+	if err := m.get("/rest/system/connections", nil, &conns); err != nil {
+		return i, err
+	}
+	for _, c := range conns.Connections {
+		i.Devices++
+		if c.Connected {
+			i.Connected++
+		}
+	}
+	return i, nil
+}
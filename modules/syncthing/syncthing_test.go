@@ -0,0 +1,188 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syncthing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSyncthing struct {
+	*httptest.Server
+	sync.Mutex
+	folders  []folderConfig
+	status   map[string]folderStatus
+	devices  map[string]bool
+	events   chan int
+	since    chan string
+	closed   chan struct{}
+	failPath string
+}
+
+func (f *fakeSyncthing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-API-Key") != "key" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.URL.Path == "/rest/events" {
+		f.since <- r.URL.Query().Get("since")
+		select {
+		case id := <-f.events:
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"id": id - 1, "type": "StateChanged"},
+				{"id": id, "type": "StateChanged"},
+			})
+		case <-f.closed:
+		case <-r.Context().Done():
+		}
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	if r.URL.Path == f.failPath {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var resp interface{}
+	switch r.URL.Path {
+	case "/rest/config/folders":
+		resp = f.folders
+	case "/rest/db/status":
+		resp = f.status[r.URL.Query().Get("folder")]
+	case "/rest/system/connections":
+		conns := map[string]interface{}{}
+		for id, connected := range f.devices {
+			conns[id] = map[string]interface{}{"connected": connected}
+		}
+		resp = map[string]interface{}{"connections": conns}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newFakeSyncthing(t *testing.T) *fakeSyncthing {
+	f := &fakeSyncthing{
+		status:  map[string]folderStatus{},
+		devices: map[string]bool{},
+		events:  make(chan int),
+		since:   make(chan string, 10),
+		closed:  make(chan struct{}),
+	}
+	f.Server = httptest.NewServer(f)
+	return f
+}
+
+func (f *fakeSyncthing) close() {
+	close(f.closed)
+	f.Close()
+}
+
+func TestSyncthing(t *testing.T) {
+	testBar.New(t)
+	f := newFakeSyncthing(t)
+	defer f.close()
+	f.folders = []folderConfig{{"a", "Docs", false}, {"b", "Photos", false}, {"c", "Old", true}}
+	f.status["a"] = folderStatus{GlobalBytes: 1000, State: "idle"}
+	f.status["b"] = folderStatus{GlobalBytes: 3000, NeedBytes: 1000, State: "syncing"}
+	f.devices["phone"] = true
+	f.devices["laptop"] = false
+
+	testBar.Run(Server(f.URL+"/", "key"))
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"75% (1) 1/2"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	require.Equal(t, "0", <-f.since)
+	f.Lock()
+	f.status["b"] = folderStatus{GlobalBytes: 3000, State: "idle"}
+	f.Unlock()
+	f.events <- 5
+	testBar.NextOutput("on event").AssertText([]string{"100% 1/2"})
+	require.Equal(t, "5", <-f.since, "continues from last event")
+
+	f.Lock()
+	f.status["a"] = folderStatus{GlobalBytes: 1000, State: "idle", PullErrors: 2}
+	f.devices["laptop"] = true
+	f.Unlock()
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"100% (1) 2/2"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "folder errors")
+
+	f.Lock()
+	f.failPath = "/rest/db/status"
+	f.Unlock()
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestCustomOutput(t *testing.T) {
+	testBar.New(t)
+	f := newFakeSyncthing(t)
+	defer f.close()
+	f.folders = []folderConfig{{"a", "Docs", false}, {"b", "Photos", false}}
+	f.status["a"] = folderStatus{GlobalBytes: 1000, NeedBytes: 250, State: "syncing"}
+	f.status["b"] = folderStatus{State: "error"}
+
+	infos := make(chan Info, 10)
+	testBar.Run(Server(f.URL, "key").Output(func(i Info) bar.Output {
+		infos <- i
+		return outputs.Textf("%d", len(i.Folders))
+	}))
+	testBar.NextOutput("on start").AssertText([]string{"2"})
+	i := <-infos
+	require.Equal(t, Folder{"a", "Docs", "syncing", 1000 * unit.Byte, 250 * unit.Byte, 0},
+		i.Folders[0])
+	require.InDelta(t, 75.0, i.Folders[0].Completion(), 0.01)
+	require.False(t, i.Folders[0].InSync())
+	require.False(t, i.Folders[0].HasError())
+	require.InDelta(t, 100.0, i.Folders[1].Completion(), 0.01, "empty folder")
+	require.True(t, i.Folders[1].HasError())
+	require.False(t, i.Folders[1].InSync(), "error state")
+	require.Equal(t, 2, i.OutOfSync())
+	require.Equal(t, 0, i.Devices)
+}
+
+func TestErrors(t *testing.T) {
+	testBar.New(t)
+	f := newFakeSyncthing(t)
+	defer f.close()
+
+	testBar.Run(Server(f.URL, "wrong"))
+	testBar.NextOutput("on bad api key").AssertError()
+
+	for _, path := range []string{"/rest/config/folders", "/rest/system/connections"} {
+		f.Lock()
+		f.failPath = path
+		f.Unlock()
+		testBar.New(t)
+		testBar.Run(Server(f.URL, "key"))
+		testBar.NextOutput("on error from %s", path).AssertError()
+	}
+}
@@ -21,6 +21,7 @@ import (
 
 	"barista.run/bar"
 	"barista.run/base/value"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
@@ -75,7 +76,7 @@ func RefreshInterval(interval time.Duration) {
 
 // Module represents a bar.Module that displays memory information.
 type Module struct {
-	outputFunc value.Value
+	outputFunc core.OutputFunc
 }
 
 func defaultOutput(i Info) bar.Output {
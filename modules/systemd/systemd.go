@@ -20,9 +20,9 @@ import (
 	"time"
 
 	"barista.run/bar"
-	"barista.run/base/value"
 	"barista.run/base/watchers/dbus"
 	"barista.run/base/watchers/localtz"
+	"barista.run/core"
 	"barista.run/outputs"
 	"barista.run/timing"
 
@@ -110,7 +110,7 @@ type ServiceInfo struct {
 // ServiceModule watches a systemd service and updates on status change
 type ServiceModule struct {
 	name       string
-	outputFunc value.Value
+	outputFunc core.OutputFunc
 }
 
 // Service creates a module that watches the status of a systemd service.
@@ -215,7 +215,7 @@ type TimerInfo struct {
 // TimerModule watches a systemd timer and updates on status change
 type TimerModule struct {
 	name       string
-	outputFunc value.Value
+	outputFunc core.OutputFunc
 }
 
 // Timer creates a module that watches the status of a systemd timer.
@@ -0,0 +1,239 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package taskwarrior provides a bar module that shows counts of due and
+// overdue tasks from Taskwarrior, and the most urgent task. It updates
+// whenever the task data changes, and periodically as tasks become due.
+package taskwarrior // import "barista.run/modules/taskwarrior"
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/watchers/file"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Task represents a pending task.
+type Task struct {
+	ID          int
+	UUID        string
+	Description string
+	Project     string
+	Tags        []string
+	// Due is the due date of the task, or zero if it has none.
+	Due     time.Time
+	Urgency float64
+
+	refresh func()
+}
+
+// Overdue returns true if the task is past its due date.
+func (t Task) Overdue() bool {
+	return !t.Due.IsZero() && t.Due.Before(timing.Now())
+}
+
+// Complete marks the task as done.
+func (t Task) Complete() {
+	if _, err := task(t.UUID, "done"); err != nil {
+		l.Log("Failed to complete task %s: %v", t.UUID, err)
+	}
+	t.refresh()
+}
+
+// Info represents the state of pending tasks.
+type Info struct {
+	// Pending is the total number of pending tasks.
+	Pending int
+	// Due is the number of tasks due within the next week, the same as
+	// Taskwarrior's default for the DUE virtual tag. It includes overdue
+	// tasks.
+	Due int
+	// Overdue is the number of tasks past their due date.
+	Overdue int
+	// MostUrgent is the pending task with the highest urgency.
+	MostUrgent Task
+}
+
+// HasTasks returns true if there are any pending tasks.
+func (i Info) HasTasks() bool {
+	return i.Pending > 0
+}
+
+// dueWindow matches the default value of Taskwarrior's rc.due setting.
+const dueWindow = 7 * 24 * time.Hour
+
+// Module represents a bar module that shows Taskwarrior tasks.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a Taskwarrior module. The data directory is watched for
+// changes, but since tasks become due as time passes, tasks are also reloaded
+// every 5 minutes by default.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler().Every(5 * time.Minute)}
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		if i.Due == 0 {
+			return nil
+		}
+		if i.Overdue > 0 {
+			return outputs.Textf("%d due (%d overdue)", i.Due, i.Overdue).Urgent(true)
+		}
+		return outputs.Textf("%d due", i.Due)
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency for tasks.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Overridden in tests.
+var (
+	execCommand = exec.Command
+	dataDir     = taskData()
+)
+
+func taskData() string {
+	if dir := os.Getenv("TASKDATA"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".task")
+}
+
+// dataFiles are the files modified when tasks change, for Taskwarrior 2
+// and Taskwarrior 3 respectively.
+var dataFiles = []string{"pending.data", "taskchampion.sqlite3"}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	notifyFn, updates := notifier.New()
+	stop := make(chan struct{})
+	defer close(stop)
+	for _, f := range dataFiles {
+		w := file.Watch(filepath.Join(dataDir, f))
+		defer w.Unsubscribe()
+		// Errors are ignored, since tasks are still reloaded on the schedule.
+		go w.Forward(notifyFn, stop)
+	}
+
+	info, err := getInfo(notifyFn)
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.scheduler.C:
+			info, err = getInfo(notifyFn)
+		case <-updates:
+			info, err = getInfo(notifyFn)
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// taskTimeFormat is the format of dates in the output of "task export".
+const taskTimeFormat = "20060102T150405Z"
+
+type exportedTask struct {
+	ID          int      `json:"id"`
+	UUID        string   `json:"uuid"`
+	Description string   `json:"description"`
+	Project     string   `json:"project"`
+	Tags        []string `json:"tags"`
+	Due         string   `json:"due"`
+	Urgency     float64  `json:"urgency"`
+}
+
+func getInfo(refresh func()) (Info, error) {
+	// Garbage collection and hooks are disabled, so that exporting tasks does
+	// not modify the data files and cause another update.
+	out, err := task("rc.gc=off", "rc.hooks=off", "status:pending", "export")
+	if err != nil {
+		return Info{}, err
+	}
+	var tasks []exportedTask
+	if err := json.Unmarshal(out, &tasks); err != nil {
+		return Info{}, err
+	}
+	i := Info{Pending: len(tasks)}
+	now := timing.Now()
+	for idx, t := range tasks {
+		task := Task{
+			ID:          t.ID,
+			UUID:        t.UUID,
+			Description: t.Description,
+			Project:     t.Project,
+			Tags:        t.Tags,
+			Urgency:     t.Urgency,
+			refresh:     refresh,
+		}
+		if t.Due != "" {
+			if task.Due, err = time.Parse(taskTimeFormat, t.Due); err != nil {
+				return Info{}, err
+			}
+			if task.Due.Before(now.Add(dueWindow)) {
+				i.Due++
+			}
+			if task.Overdue() {
+				i.Overdue++
+			}
+		}
+		if idx == 0 || task.Urgency > i.MostUrgent.Urgency {
+			i.MostUrgent = task
+		}
+	}
+	return i, nil
+}
+
+// task runs a Taskwarrior command without any prompts, and returns its output,
+// including anything written to stderr in the error if the command fails.
+func task(args ...string) ([]byte, error) {
+	args = append([]string{"rc.verbose=nothing", "rc.confirmation=off"}, args...)
+	out, err := execCommand("task", args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if msg := strings.TrimSpace(string(exitErr.Stderr)); msg != "" {
+			return nil, fmt.Errorf("task: %s", msg)
+		}
+		return nil, fmt.Errorf("task: %s", err)
+	}
+	return out, err
+}
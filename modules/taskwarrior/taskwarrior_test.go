@@ -0,0 +1,122 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskwarrior
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/testing/fakeexec"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	execCommand = fakeexec.Command
+	// Modules from earlier tests may still be watching the data directory,
+	// so a single directory is shared across all tests.
+	var err error
+	dataDir, err = ioutil.TempDir("", "taskwarrior")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// actions returns the commands run other than exports.
+func actions(f *fakeexec.Fake) (cmds []string) {
+	for _, c := range f.Commands() {
+		if !strings.HasSuffix(c, " export") {
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds
+}
+
+const tasks = `[
+{"id":1,"uuid":"aaaa","description":"Write docs","due":"20180601T170000Z","urgency":8.9,"status":"pending"},
+{"id":2,"uuid":"bbbb","description":"File taxes","project":"home","tags":["admin"],"due":"20180530T000000Z","urgency":12.5,"status":"pending"},
+{"id":3,"uuid":"cccc","description":"Plan trip","due":"20180701T000000Z","urgency":3.2,"status":"pending"},
+{"id":4,"uuid":"dddd","description":"Read book","urgency":1.8,"status":"pending"}
+]`
+
+func TestTaskwarrior(t *testing.T) {
+	testBar.New(t)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	f := fakeexec.New()
+	f.Set("task", tasks, "", 0)
+
+	m := New()
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"2 due (1 overdue)"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent)
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%d/%d %s %v %v", i.Pending, i.Due,
+			i.MostUrgent.Description, i.MostUrgent.Tags, i.MostUrgent.Overdue()).
+			OnClick(func(bar.Event) { i.MostUrgent.Complete() })
+	})
+	out = testBar.NextOutput("on output change")
+	out.AssertText([]string{"4/2 File taxes [admin] true"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on complete")
+	require.Equal(t,
+		[]string{"task rc.verbose=nothing rc.confirmation=off bbbb done"},
+		actions(f))
+
+	f.Set("task", `[{"id":1,"uuid":"dddd","description":"Read book","urgency":1.8}]`, "", 0)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dataDir, "pending.data"), nil, 0644))
+	testBar.Drain(500*time.Millisecond, "on data change").
+		AssertText([]string{"1/0 Read book [] false"})
+
+	f.Set("task", "[]", "", 0)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"0/0  [] false"})
+
+	f.Set("task", `[{"uuid":"eeee","due":"tomorrow"}]`, "", 0)
+	testBar.Tick()
+	testBar.NextOutput("on invalid due date").AssertError()
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	f := fakeexec.New()
+	f.Set("task", `[{"id":1,"uuid":"aaaa","description":"Write docs","due":"20180605T170000Z","urgency":8.9}]`, "", 0)
+	testBar.Run(New())
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"1 due"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	testBar.New(t)
+	f.Set("task", `[{"id":1,"uuid":"aaaa","description":"Whenever","urgency":1}]`, "", 0)
+	testBar.Run(New())
+	testBar.NextOutput("without due tasks").AssertEmpty()
+
+	testBar.New(t)
+	f.Set("task", "", "Unable to find the 'task' command", 127)
+	testBar.Run(New())
+	testBar.NextOutput("on error").AssertError()
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thinkpad
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// ErrUnsupported is returned by backends for controls that the hardware or
+// driver does not provide.
+var ErrUnsupported = errors.New("Not supported")
+
+// State represents the current state of the vendor-specific laptop controls.
+type State struct {
+	// ChargeStartThreshold is the capacity in percent below which the battery
+	// will start charging, or 0 if not supported.
+	ChargeStartThreshold int
+	// ChargeEndThreshold is the capacity in percent at which the battery will
+	// stop charging, or 0 if charge thresholds are not supported.
+	ChargeEndThreshold int
+	// FanLevel is the current fan level, e.g. "auto", "full-speed" or "0" to
+	// "7", or empty if fan control is not supported.
+	FanLevel string
+	// FanSpeed is the current fan speed in RPM.
+	FanSpeed int
+}
+
+// HasThresholds returns true if the battery supports charge thresholds.
+func (s State) HasThresholds() bool {
+	return s.ChargeEndThreshold > 0
+}
+
+// HasFan returns true if the fan level is available.
+func (s State) HasFan() bool {
+	return s.FanLevel != ""
+}
+
+// Write represents a single privileged write to a sysfs or procfs file,
+// performed by the helper configured using Module.Helper.
+type Write struct {
+	Path, Value string
+}
+
+// Backend provides the controls of a vendor-specific laptop driver. Backends
+// read state directly, but return the writes needed to change it, since those
+// usually require root and are delegated to a privileged helper.
+type Backend interface {
+	// Read returns the current state of all supported controls.
+	Read() (State, error)
+	// SetThresholds returns the writes needed to set the charge thresholds.
+	SetThresholds(start, end int) ([]Write, error)
+	// SetFanLevel returns the writes needed to set the fan level.
+	SetFanLevel(level string) ([]Write, error)
+}
+
+// Overridden in tests.
+var fs = afero.NewOsFs()
+
+const (
+	powerSupplyRoot = "/sys/class/power_supply"
+	thinkpadFan     = "/proc/acpi/ibm/fan"
+)
+
+type thinkpadACPI struct {
+	battery string
+}
+
+// ThinkPad returns a backend for the thinkpad_acpi driver, controlling the
+// charge thresholds of the named battery (e.g. "BAT0"). Fan control requires
+// thinkpad_acpi to be loaded with fan_control=1.
+func ThinkPad(battery string) Backend {
+	return &thinkpadACPI{battery}
+}
+
+func readFile(path string) (string, error) {
+	b, err := afero.ReadFile(fs, path)
+	return strings.TrimSpace(string(b)), err
+}
+
+func readInt(path string) (int, error) {
+	s, err := readFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
+
+func (t *thinkpadACPI) threshold(name string) string {
+	return filepath.Join(powerSupplyRoot, t.battery,
+		fmt.Sprintf("charge_control_%s_threshold", name))
+}
+
+func (t *thinkpadACPI) Read() (State, error) {
+	var s State
+	var err error
+	if s.ChargeEndThreshold, err = readInt(t.threshold("end")); err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	if s.ChargeStartThreshold, err = readInt(t.threshold("start")); err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	fan, err := afero.ReadFile(fs, thinkpadFan)
+	if err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	s.FanLevel, s.FanSpeed = parseFan(fan)
+	return s, nil
+}
+
+// parseFan parses /proc/acpi/ibm/fan, which contains lines like "speed: 2900"
+// and "level: auto".
+func parseFan(contents []byte) (level string, speed int) {
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		val := strings.TrimSpace(parts[1])
+		switch parts[0] {
+		case "speed":
+			speed, _ = strconv.Atoi(val)
+		case "level":
+			level = val
+		}
+	}
+	return level, speed
+}
+
+func (t *thinkpadACPI) SetThresholds(start, end int) ([]Write, error) {
+	current, err := t.Read()
+	if err != nil {
+		return nil, err
+	}
+	if !current.HasThresholds() {
+		return nil, ErrUnsupported
+	}
+	startWrite := Write{t.threshold("start"), strconv.Itoa(start)}
+	endWrite := Write{t.threshold("end"), strconv.Itoa(end)}
+	// The driver rejects a start threshold at or above the end threshold, so
+	// the order of writes depends on the direction of the change.
+	if start >= current.ChargeEndThreshold {
+		return []Write{endWrite, startWrite}, nil
+	}
+	return []Write{startWrite, endWrite}, nil
+}
+
+func (t *thinkpadACPI) SetFanLevel(level string) ([]Write, error) {
+	switch level {
+	case "auto", "full-speed", "disengaged",
+		"0", "1", "2", "3", "4", "5", "6", "7":
+	default:
+		return nil, fmt.Errorf("Invalid fan level: %q", level)
+	}
+	if _, err := fs.Stat(thinkpadFan); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUnsupported
+		}
+		return nil, err
+	}
+	return []Write{{thinkpadFan, "level " + level}}, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thinkpad
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	// Modules started by TestThinkPad keep polling the sysfs backend, so later
+	// tests use resetFs to clear the battery and fan files in place.
+	fs = afero.NewMemMapFs()
+}
+
+func writeFile(path, contents string) {
+	afero.WriteFile(fs, path, []byte(contents), 0644)
+}
+
+func setThresholds(battery string, start, end int) {
+	dir := powerSupplyRoot + "/" + battery
+	writeFile(dir+"/charge_control_start_threshold", fmt.Sprintf("%d\n", start))
+	writeFile(dir+"/charge_control_end_threshold", fmt.Sprintf("%d\n", end))
+}
+
+func setFan(level string, speed int) {
+	writeFile(thinkpadFan, fmt.Sprintf(
+		"status:\t\tenabled\nspeed:\t\t%d\nlevel:\t\t%s\n"+
+			"commands:\tlevel <level> (<level> is 0-7, auto, disengaged, full-speed)\n",
+		speed, level))
+}
+
+func resetFs() {
+	fs.RemoveAll(powerSupplyRoot)
+	fs.RemoveAll(thinkpadFan)
+}
+
+func TestThinkPadRead(t *testing.T) {
+	resetFs()
+	b := ThinkPad("BAT0")
+
+	s, err := b.Read()
+	require.NoError(t, err, "missing files are unsupported controls")
+	require.False(t, s.HasThresholds())
+	require.False(t, s.HasFan())
+
+	setThresholds("BAT0", 75, 80)
+	setFan("auto", 2900)
+	s, err = b.Read()
+	require.NoError(t, err)
+	require.Equal(t, State{
+		ChargeStartThreshold: 75,
+		ChargeEndThreshold:   80,
+		FanLevel:             "auto",
+		FanSpeed:             2900,
+	}, s)
+	require.True(t, s.HasThresholds())
+	require.True(t, s.HasFan())
+
+	s, err = ThinkPad("BAT1").Read()
+	require.NoError(t, err)
+	require.False(t, s.HasThresholds(), "other battery")
+	require.True(t, s.HasFan())
+
+	writeFile(powerSupplyRoot+"/BAT0/charge_control_end_threshold", "garbage")
+	_, err = b.Read()
+	require.Error(t, err, "invalid threshold")
+}
+
+func TestThinkPadSetThresholds(t *testing.T) {
+	resetFs()
+	b := ThinkPad("BAT0")
+	dir := powerSupplyRoot + "/BAT0/"
+
+	_, err := b.SetThresholds(75, 80)
+	require.Equal(t, ErrUnsupported, err)
+
+	setThresholds("BAT0", 0, 100)
+	w, err := b.SetThresholds(75, 80)
+	require.NoError(t, err)
+	require.Equal(t, []Write{
+		{dir + "charge_control_start_threshold", "75"},
+		{dir + "charge_control_end_threshold", "80"},
+	}, w, "start first when lowering")
+
+	setThresholds("BAT0", 40, 50)
+	w, err = b.SetThresholds(75, 80)
+	require.NoError(t, err)
+	require.Equal(t, []Write{
+		{dir + "charge_control_end_threshold", "80"},
+		{dir + "charge_control_start_threshold", "75"},
+	}, w, "end first when start would exceed current end")
+}
+
+func TestThinkPadSetFanLevel(t *testing.T) {
+	resetFs()
+	b := ThinkPad("BAT0")
+
+	_, err := b.SetFanLevel("auto")
+	require.Equal(t, ErrUnsupported, err)
+
+	setFan("auto", 2900)
+	w, err := b.SetFanLevel("full-speed")
+	require.NoError(t, err)
+	require.Equal(t, []Write{{thinkpadFan, "level full-speed"}}, w)
+
+	w, err = b.SetFanLevel("3")
+	require.NoError(t, err)
+	require.Equal(t, []Write{{thinkpadFan, "level 3"}}, w)
+
+	_, err = b.SetFanLevel("8")
+	require.Error(t, err, "invalid level")
+	_, err = b.SetFanLevel("auto\nlevel 0")
+	require.Error(t, err, "invalid level")
+}
+
+func TestParseFan(t *testing.T) {
+	level, speed := parseFan(nil)
+	require.Empty(t, level)
+	require.Equal(t, 0, speed)
+
+	level, speed = parseFan([]byte("status:\t\tdisabled\nlevel:\t\t7\n"))
+	require.Equal(t, "7", level)
+	require.Equal(t, 0, speed)
+}
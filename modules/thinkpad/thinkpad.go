@@ -0,0 +1,233 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package thinkpad provides a bar module that shows and controls
+// vendor-specific laptop features: battery conservation mode (using charge
+// thresholds), and the fan level. It ships with a backend for the
+// thinkpad_acpi driver, and other vendor drivers (e.g. asus-wmi) can be
+// supported by implementing Backend.
+//
+// Changing settings requires root, so the module delegates writes to a
+// privileged helper, usually run through pkexec so that polkit can decide
+// whether the user is allowed to make the change.
+package thinkpad // import "barista.run/modules/thinkpad"
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents the current state of the laptop controls.
+type Info struct {
+	State
+
+	ctrl *controller
+}
+
+// Conservation returns true if conservation mode is enabled, i.e. the battery
+// stops charging before it is full.
+func (i Info) Conservation() bool {
+	return i.HasThresholds() && i.ChargeEndThreshold < 100
+}
+
+// SetConservation enables or disables conservation mode, using the charge
+// thresholds configured with Module.Conservation.
+func (i Info) SetConservation(on bool) error {
+	if !on {
+		return i.SetThresholds(0, 100)
+	}
+	if i.ctrl == nil {
+		return errors.New("Not connected")
+	}
+	return i.SetThresholds(i.ctrl.conservation[0], i.ctrl.conservation[1])
+}
+
+// ToggleConservation toggles conservation mode.
+func (i Info) ToggleConservation() error {
+	return i.SetConservation(!i.Conservation())
+}
+
+// SetThresholds sets the charge start and end thresholds (in percent).
+func (i Info) SetThresholds(start, end int) error {
+	if start < 0 || end > 100 || start >= end {
+		return fmt.Errorf("Invalid charge thresholds: %d-%d", start, end)
+	}
+	if i.ctrl == nil {
+		return errors.New("Not connected")
+	}
+	return i.ctrl.apply(i.ctrl.backend.SetThresholds(start, end))
+}
+
+// SetFanLevel sets the fan level, using a value supported by the backend,
+// e.g. "auto", "full-speed", or "0" to "7" for thinkpad_acpi.
+func (i Info) SetFanLevel(level string) error {
+	if i.ctrl == nil {
+		return errors.New("Not connected")
+	}
+	return i.ctrl.apply(i.ctrl.backend.SetFanLevel(level))
+}
+
+// controller performs writes for a backend using the configured helper.
+type controller struct {
+	backend      Backend
+	helper       []string
+	conservation [2]int
+	refresh      func()
+}
+
+// Overridden in tests.
+var runHelper = func(cmd []string) error {
+	return exec.Command(cmd[0], cmd[1:]...).Run()
+}
+
+func (c *controller) apply(writes []Write, err error) error {
+	if err != nil {
+		return err
+	}
+	if len(c.helper) == 0 {
+		return errors.New("No helper configured")
+	}
+	defer c.refresh()
+	for _, w := range writes {
+		cmd := append(c.helper[:len(c.helper):len(c.helper)], w.Path, w.Value)
+		if err := runHelper(cmd); err != nil {
+			return fmt.Errorf("Failed to write %s: %v", w.Path, err)
+		}
+	}
+	return nil
+}
+
+// Module represents a bar module that shows vendor-specific laptop controls.
+type Module struct {
+	backend      Backend
+	outputFunc   core.OutputFunc // of func(Info) bar.Output
+	helper       value.Value     // of []string
+	conservation value.Value     // of [2]int
+	scheduler    *timing.Scheduler
+}
+
+// New constructs a module for a ThinkPad, using the first battery.
+func New() *Module {
+	return Using(ThinkPad("BAT0"))
+}
+
+// Using constructs a module that uses the given backend.
+func Using(backend Backend) *Module {
+	m := &Module{backend: backend, scheduler: timing.NewScheduler()}
+	l.Register(m, "outputFunc", "helper", "conservation", "scheduler")
+	m.helper.Set([]string(nil))
+	m.Conservation(75, 80)
+	m.RefreshInterval(5 * time.Second)
+	m.Output(func(i Info) bar.Output {
+		out := outputs.Group()
+		if i.HasThresholds() {
+			txt := "CHG full"
+			if i.Conservation() {
+				txt = fmt.Sprintf("CHG %d-%d%%", i.ChargeStartThreshold, i.ChargeEndThreshold)
+			}
+			out.Append(outputs.Text(txt).OnClick(click.Left(func() {
+				if err := i.ToggleConservation(); err != nil {
+					l.Log("Failed to toggle conservation mode: %v", err)
+				}
+			})))
+		}
+		if i.HasFan() {
+			next := "full-speed"
+			if i.FanLevel != "auto" {
+				next = "auto"
+			}
+			out.Append(outputs.Textf("FAN %s", i.FanLevel).OnClick(click.Left(func() {
+				if err := i.SetFanLevel(next); err != nil {
+					l.Log("Failed to set fan level: %v", err)
+				}
+			})))
+		}
+		return out
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Helper sets the privileged command used to change settings. It is invoked
+// once per write, with the path and the value to write appended to the given
+// arguments, so Helper("pkexec", "/usr/local/bin/sysfs-write") runs
+// "pkexec /usr/local/bin/sysfs-write /proc/acpi/ibm/fan 'level auto'". The
+// helper should only allow writes to the files it expects.
+func (m *Module) Helper(cmd string, args ...string) *Module {
+	m.helper.Set(append([]string{cmd}, args...))
+	return m
+}
+
+// Conservation sets the charge thresholds used when enabling conservation
+// mode. Defaults to 75-80%.
+func (m *Module) Conservation(start, end int) *Module {
+	m.conservation.Set([2]int{start, end})
+	return m
+}
+
+// RefreshInterval configures the polling frequency, since the drivers do not
+// notify changes. Changes made through the module are shown immediately.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	refreshFn, refreshCh := notifier.New()
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextHelper, done := m.helper.Subscribe()
+	defer done()
+	nextConservation, done := m.conservation.Subscribe()
+	defer done()
+
+	for {
+		s, err := m.backend.Read()
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(Info{State: s, ctrl: &controller{
+			backend:      m.backend,
+			helper:       m.helper.Get().([]string),
+			conservation: m.conservation.Get().([2]int),
+			refresh:      refreshFn,
+		}}))
+		select {
+		case <-m.scheduler.C:
+		case <-refreshCh:
+		case <-nextHelper:
+		case <-nextConservation:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
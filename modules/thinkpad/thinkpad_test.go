@@ -0,0 +1,167 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package thinkpad
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHelper struct {
+	sync.Mutex
+	calls [][]string
+	err   error
+}
+
+// run simulates a helper that writes the value to the path.
+func (f *fakeHelper) run(cmd []string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.calls = append(f.calls, cmd)
+	if f.err != nil {
+		return f.err
+	}
+	path, val := cmd[len(cmd)-2], cmd[len(cmd)-1]
+	if path == thinkpadFan {
+		setFan(strings.TrimPrefix(val, "level "), 4500)
+	} else {
+		writeFile(path, val+"\n")
+	}
+	return nil
+}
+
+func (f *fakeHelper) Calls() [][]string {
+	f.Lock()
+	defer f.Unlock()
+	r := f.calls
+	f.calls = nil
+	return r
+}
+
+func setupHelper() *fakeHelper {
+	f := &fakeHelper{}
+	runHelper = f.run
+	return f
+}
+
+func TestThinkPad(t *testing.T) {
+	testBar.New(t)
+	resetFs()
+	setThresholds("BAT0", 0, 100)
+	setFan("auto", 2900)
+	helper := setupHelper()
+
+	m := New().Helper("pkexec", "sysfs-write")
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"CHG full", "FAN auto"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("on conservation toggle")
+	out.AssertText([]string{"CHG 75-80%", "FAN auto"})
+	dir := powerSupplyRoot + "/BAT0/"
+	require.Equal(t, [][]string{
+		{"pkexec", "sysfs-write", dir + "charge_control_start_threshold", "75"},
+		{"pkexec", "sysfs-write", dir + "charge_control_end_threshold", "80"},
+	}, helper.Calls())
+
+	out.At(1).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("on fan toggle")
+	out.AssertText([]string{"CHG 75-80%", "FAN full-speed"})
+	require.Equal(t, [][]string{
+		{"pkexec", "sysfs-write", thinkpadFan, "level full-speed"},
+	}, helper.Calls())
+
+	out.At(1).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("on fan toggle")
+	out.AssertText([]string{"CHG 75-80%", "FAN auto"})
+	helper.Calls()
+
+	m.Conservation(50, 60)
+	out = testBar.NextOutput("on conservation change")
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("on conservation toggle")
+	out.AssertText([]string{"CHG full", "FAN auto"})
+	require.Equal(t, [][]string{
+		{"pkexec", "sysfs-write", dir + "charge_control_start_threshold", "0"},
+		{"pkexec", "sysfs-write", dir + "charge_control_end_threshold", "100"},
+	}, helper.Calls(), "disables conservation")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonLeft})
+	out = testBar.NextOutput("on conservation toggle")
+	out.AssertText([]string{"CHG 50-60%", "FAN auto"})
+	helper.Calls()
+
+	setFan("7", 6000)
+	testBar.AssertNoOutput("until refresh")
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"CHG 50-60%", "FAN 7"})
+}
+
+func TestInfoActions(t *testing.T) {
+	testBar.New(t)
+	resetFs()
+	setThresholds("BAT0", 75, 80)
+	helper := setupHelper()
+
+	var info Info
+	infos := make(chan Info, 10)
+	m := New().Output(func(i Info) bar.Output {
+		infos <- i
+		return outputs.Text("tp")
+	})
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"tp"})
+	info = <-infos
+	require.True(t, info.Conservation())
+	require.False(t, info.HasFan())
+
+	require.EqualError(t, info.ToggleConservation(), "No helper configured")
+	require.Error(t, info.SetFanLevel("auto"), "fan not supported")
+	require.Error(t, info.SetThresholds(80, 75), "invalid thresholds")
+	require.Error(t, info.SetThresholds(-1, 75), "invalid thresholds")
+	require.Error(t, info.SetThresholds(20, 101), "invalid thresholds")
+	require.Empty(t, helper.Calls())
+
+	m.Helper("helper")
+	testBar.NextOutput("on helper change")
+	info = <-infos
+	helper.err = errors.New("not authorized")
+	require.EqualError(t, info.SetThresholds(40, 60),
+		"Failed to write "+powerSupplyRoot+"/BAT0/charge_control_start_threshold: not authorized")
+	require.Len(t, helper.Calls(), 1, "stops on first failure")
+	testBar.NextOutput("refreshes after failed write")
+
+	require.Error(t, Info{}.SetConservation(true), "zero value")
+	require.Error(t, Info{}.SetFanLevel("auto"), "zero value")
+}
+
+func TestReadError(t *testing.T) {
+	testBar.New(t)
+	resetFs()
+	writeFile(thinkpadFan, "level: auto\n")
+	writeFile(powerSupplyRoot+"/BAT0/charge_control_end_threshold", "??")
+
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertError("invalid threshold")
+}
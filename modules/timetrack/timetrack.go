@@ -0,0 +1,177 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timetrack provides a bar module that shows the task currently being
+// tracked in Timewarrior or Toggl Track, along with the elapsed time and the
+// total time tracked today, and can stop or continue tracking.
+package timetrack // import "barista.run/modules/timetrack"
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents the state of time tracking.
+type Info struct {
+	// Backend is the name of the time tracker, "timewarrior" or "toggl".
+	Backend string
+	// Tracking is true if a task is currently being tracked.
+	Tracking bool
+	// Task describes the current task. For Timewarrior, this is the tags of the
+	// current interval, and for Toggl, the description of the time entry.
+	Task string
+	Tags []string
+	// Started is the start time of the current task.
+	Started time.Time
+	// Today is the total time tracked today, including the current task.
+	Today time.Duration
+
+	ctrl    backend
+	refresh func()
+}
+
+// Elapsed returns the time spent on the current task.
+func (i Info) Elapsed() time.Duration {
+	if !i.Tracking {
+		return 0
+	}
+	return timing.Now().Sub(i.Started)
+}
+
+// Stop stops tracking the current task.
+func (i Info) Stop() { i.do("stop", i.ctrl.stop) }
+
+// Continue starts tracking the most recent task again.
+func (i Info) Continue() { i.do("continue", i.ctrl.resume) }
+
+// Toggle stops tracking if a task is being tracked, otherwise continues the
+// most recent task.
+func (i Info) Toggle() {
+	if i.Tracking {
+		i.Stop()
+	} else {
+		i.Continue()
+	}
+}
+
+func (i Info) do(action string, fn func() error) {
+	if err := fn(); err != nil {
+		l.Log("Failed to %s tracking in %s: %v", action, i.Backend, err)
+	}
+	i.refresh()
+}
+
+// backend abstracts a time tracker.
+type backend interface {
+	name() string
+	// status fills in the current task and today's total.
+	status(*Info) error
+	stop() error
+	resume() error
+}
+
+// Module represents a bar module that shows time tracking status.
+type Module struct {
+	backend    backend
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+func newModule(b backend, interval time.Duration) *Module {
+	m := &Module{backend: b, scheduler: timing.NewScheduler().Every(interval)}
+	l.Label(m, b.name())
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		if !i.Tracking {
+			return outputs.Textf("idle (%s)", formatDuration(i.Today)).
+				OnClick(click.Left(i.Continue))
+		}
+		task := i.Task
+		if task == "" {
+			task = strings.Join(i.Tags, " ")
+		}
+		return outputs.Textf("%s %s (%s)", task,
+			formatDuration(i.Elapsed()), formatDuration(i.Today)).
+			OnClick(click.Left(i.Stop))
+	})
+	return m
+}
+
+// formatDuration formats a duration as hours and minutes, e.g. "1:05".
+func formatDuration(d time.Duration) string {
+	m := int(d.Minutes())
+	return fmt.Sprintf("%d:%02d", m/60, m%60)
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	refreshCh := make(chan struct{}, 1)
+	refresh := func() {
+		select {
+		case refreshCh <- struct{}{}:
+		default:
+		}
+	}
+	for {
+		i := Info{Backend: m.backend.name(), ctrl: m.backend, refresh: refresh}
+		if sink.Error(m.backend.status(&i)) {
+			return
+		}
+		sink.Output(outputFunc(i))
+		select {
+		case <-m.scheduler.C:
+		case <-refreshCh:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// trackedToday returns the part of the interval from start to end (or now,
+// if end is zero) that falls on the current day.
+func trackedToday(start, end time.Time) time.Duration {
+	if end.IsZero() {
+		end = timing.Now()
+	}
+	if midnight := timing.StartOfDay(); start.Before(midnight) {
+		start = midnight
+	}
+	if end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timetrack
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/localtz"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackend struct {
+	sync.Mutex
+	info    Info
+	err     error
+	actions []string
+}
+
+func (f *fakeBackend) name() string { return "fake" }
+
+func (f *fakeBackend) status(i *Info) error {
+	f.Lock()
+	defer f.Unlock()
+	i.Tracking = f.info.Tracking
+	i.Task = f.info.Task
+	i.Tags = f.info.Tags
+	i.Started = f.info.Started
+	i.Today = f.info.Today
+	return f.err
+}
+
+func (f *fakeBackend) do(action string, tracking bool) error {
+	f.Lock()
+	defer f.Unlock()
+	f.actions = append(f.actions, action)
+	f.info.Tracking = tracking
+	return nil
+}
+
+func (f *fakeBackend) stop() error   { return f.do("stop", false) }
+func (f *fakeBackend) resume() error { return f.do("continue", true) }
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 14, 0, 0, 0, time.UTC))
+	f := &fakeBackend{info: Info{
+		Tracking: true,
+		Tags:     []string{"barista", "review"},
+		Started:  now.Add(-65 * time.Minute),
+		Today:    3*time.Hour + 5*time.Minute,
+	}}
+	m := newModule(f, time.Minute)
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"barista review 1:05 (3:05)"})
+
+	out.At(0).LeftClick()
+	out = testBar.NextOutput("on stop")
+	out.AssertText([]string{"idle (3:05)"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on continue").AssertText([]string{"barista review 1:05 (3:05)"})
+
+	f.Lock()
+	actions := f.actions
+	f.info.Task = "Code review"
+	f.Unlock()
+	require.Equal(t, []string{"stop", "continue"}, actions)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"Code review 1:06 (3:05)"})
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %v %v", i.Backend, i.Tracking, i.Elapsed())
+	})
+	testBar.NextOutput("on output change").AssertText([]string{"fake true 1h6m0s"})
+
+	f.Lock()
+	f.err = errors.New("something went wrong")
+	f.Unlock()
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestTrackedToday(t *testing.T) {
+	localtz.SetForTest(time.UTC)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 1, 0, 0, 0, time.UTC))
+	midnight := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, midnight, timing.StartOfDay())
+
+	require.Equal(t, 30*time.Minute,
+		trackedToday(now.Add(-30*time.Minute), time.Time{}), "running")
+	require.Equal(t, time.Hour,
+		trackedToday(now.Add(-3*time.Hour), time.Time{}), "running since yesterday")
+	require.Equal(t, 15*time.Minute,
+		trackedToday(now.Add(-45*time.Minute), now.Add(-30*time.Minute)))
+	require.Equal(t, time.Duration(0),
+		trackedToday(now.Add(-3*time.Hour), now.Add(-2*time.Hour)), "yesterday")
+}
+
+func TestFormatDuration(t *testing.T) {
+	require.Equal(t, "0:00", formatDuration(59*time.Second))
+	require.Equal(t, "0:05", formatDuration(5*time.Minute))
+	require.Equal(t, "12:34", formatDuration(12*time.Hour+34*time.Minute+20*time.Second))
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timetrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Timewarrior constructs a time tracking module using Timewarrior, checking
+// for changes every 10 seconds by default.
+func Timewarrior() *Module {
+	return newModule(timewarrior{}, 10*time.Second)
+}
+
+// Overridden in tests.
+var execCommand = exec.Command
+
+type timewarrior struct{}
+
+func (timewarrior) name() string { return "timewarrior" }
+
+// timewTimeFormat is the format of times in the output of "timew export".
+const timewTimeFormat = "20060102T150405Z"
+
+type timewInterval struct {
+	Start      string   `json:"start"`
+	End        string   `json:"end"`
+	Tags       []string `json:"tags"`
+	Annotation string   `json:"annotation"`
+}
+
+func (timewarrior) status(i *Info) error {
+	out, err := timew("export", ":day")
+	if err != nil {
+		return err
+	}
+	var intervals []timewInterval
+	if err := json.Unmarshal(out, &intervals); err != nil {
+		return err
+	}
+	for _, interval := range intervals {
+		start, err := time.Parse(timewTimeFormat, interval.Start)
+		if err != nil {
+			return err
+		}
+		var end time.Time
+		if interval.End != "" {
+			if end, err = time.Parse(timewTimeFormat, interval.End); err != nil {
+				return err
+			}
+		} else {
+			// The open interval, if any, is the current task.
+			i.Tracking = true
+			i.Task = interval.Annotation
+			i.Tags = interval.Tags
+			i.Started = start
+		}
+		i.Today += trackedToday(start, end)
+	}
+	return nil
+}
+
+func (timewarrior) stop() error {
+	_, err := timew("stop")
+	return err
+}
+
+func (timewarrior) resume() error {
+	_, err := timew("continue")
+	return err
+}
+
+// timew runs a timewarrior command and returns its output, including anything
+// written to stderr in the error if the command fails.
+func timew(args ...string) ([]byte, error) {
+	out, err := execCommand("timew", args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if msg := strings.TrimSpace(string(exitErr.Stderr)); msg != "" {
+			return nil, fmt.Errorf("timew: %s", msg)
+		}
+		return nil, fmt.Errorf("timew: %s", err)
+	}
+	return out, err
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timetrack
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/localtz"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/testing/fakeexec"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	execCommand = fakeexec.Command
+}
+
+// actions returns the commands run other than exports.
+func actions(f *fakeexec.Fake) (cmds []string) {
+	for _, c := range f.Commands() {
+		if !strings.HasPrefix(c, "timew export") {
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds
+}
+
+func TestTimewarrior(t *testing.T) {
+	testBar.New(t)
+	localtz.SetForTest(time.UTC)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 14, 0, 0, 0, time.UTC))
+	f := fakeexec.New()
+	f.Set("timew", `[
+{"id":3,"start":"20180531T230000Z","end":"20180601T010000Z","tags":["sleep"]},
+{"id":2,"start":"20180601T090000Z","end":"20180601T113000Z","tags":["email"]},
+{"id":1,"start":"20180601T131500Z","tags":["barista","review"],"annotation":"PR #42"}
+]`, "", 0)
+
+	m := Timewarrior()
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"PR #42 0:45 (4:15)"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on click")
+	require.Equal(t, []string{"timew stop"}, actions(f))
+
+	f.Set("timew", `[{"id":1,"start":"20180601T090000Z","end":"20180601T113000Z","tags":["email"]}]`, "", 0)
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%v %v %v", i.Tracking, i.Tags, i.Today).
+			OnClick(func(bar.Event) { i.Continue() })
+	})
+	out = testBar.NextOutput("on output change")
+	out.AssertText([]string{"false [] 2h30m0s"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on continue")
+	require.Equal(t, []string{"timew stop", "timew continue"}, actions(f))
+
+	f.Set("timew", "[]", "", 0)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"false [] 0s"})
+
+	f.Set("timew", `[{"start":"yesterday"}]`, "", 0)
+	testBar.Tick()
+	testBar.NextOutput("on invalid time").AssertError()
+
+	testBar.New(t)
+	f.Set("timew", "", "timew: command not found", 127)
+	testBar.Run(Timewarrior())
+	errs := testBar.NextOutput("on failure").AssertError()
+	require.Equal(t, "timew: timew: command not found", errs[0])
+}
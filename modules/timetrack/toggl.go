@@ -0,0 +1,179 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timetrack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"barista.run/base/httpclient"
+	"barista.run/timing"
+)
+
+// Toggl constructs a time tracking module using Toggl Track, with an API token
+// from the Toggl profile settings. To stay well within the API rate limits,
+// it only checks for changes every minute by default.
+func Toggl(apiToken string) *Module {
+	return newModule(&toggl{token: apiToken}, time.Minute)
+}
+
+// Overridden in tests.
+var togglAPI = "https://api.track.toggl.com/api/v9"
+
+type toggl struct {
+	token string
+}
+
+func (t *toggl) name() string { return "toggl" }
+
+type togglEntry struct {
+	ID          int64      `json:"id"`
+	WorkspaceID int64      `json:"workspace_id"`
+	ProjectID   *int64     `json:"project_id"`
+	TaskID      *int64     `json:"task_id"`
+	Billable    bool       `json:"billable"`
+	Description string     `json:"description"`
+	Tags        []string   `json:"tags"`
+	Start       time.Time  `json:"start"`
+	Stop        *time.Time `json:"stop"`
+	// Duration is negative for the running time entry.
+	Duration int64 `json:"duration"`
+}
+
+func (e togglEntry) running() bool {
+	return e.Duration < 0
+}
+
+func (e togglEntry) end() time.Time {
+	if e.running() || e.Stop == nil {
+		return time.Time{}
+	}
+	return *e.Stop
+}
+
+func (t *toggl) status(i *Info) error {
+	midnight := timing.StartOfDay()
+	var entries []togglEntry
+	err := t.request("GET", "/me/time_entries?"+url.Values{
+		"start_date": {midnight.Format(time.RFC3339)},
+		"end_date":   {midnight.AddDate(0, 0, 1).Format(time.RFC3339)},
+	}.Encode(), nil, &entries)
+	if err != nil {
+		return err
+	}
+	// The running entry may have started before today, in which case it is
+	// not included in today's entries.
+	var current *togglEntry
+	if err := t.request("GET", "/me/time_entries/current", nil, &current); err != nil {
+		return err
+	}
+	if current != nil {
+		i.Tracking = true
+		i.Task = current.Description
+		i.Tags = current.Tags
+		i.Started = current.Start
+		i.Today += trackedToday(current.Start, time.Time{})
+	}
+	for _, e := range entries {
+		if current != nil && e.ID == current.ID {
+			continue
+		}
+		i.Today += trackedToday(e.Start, e.end())
+	}
+	return nil
+}
+
+func (t *toggl) stop() error {
+	var current *togglEntry
+	if err := t.request("GET", "/me/time_entries/current", nil, &current); err != nil {
+		return err
+	}
+	if current == nil {
+		return errors.New("no running time entry")
+	}
+	return t.request("PATCH", fmt.Sprintf("/workspaces/%d/time_entries/%d/stop",
+		current.WorkspaceID, current.ID), nil, nil)
+}
+
+func (t *toggl) resume() error {
+	var recent []togglEntry
+	if err := t.request("GET", "/me/time_entries", nil, &recent); err != nil {
+		return err
+	}
+	if len(recent) == 0 {
+		return errors.New("no recent time entries")
+	}
+	last := recent[0]
+	for _, e := range recent {
+		if e.Start.After(last.Start) {
+			last = e
+		}
+	}
+	if last.running() {
+		return nil
+	}
+	return t.request("POST", fmt.Sprintf("/workspaces/%d/time_entries", last.WorkspaceID),
+		map[string]interface{}{
+			"created_with": "barista",
+			"workspace_id": last.WorkspaceID,
+			"project_id":   last.ProjectID,
+			"task_id":      last.TaskID,
+			"billable":     last.Billable,
+			"description":  last.Description,
+			"tags":         last.Tags,
+			"start":        timing.Now().UTC().Format(time.RFC3339),
+			"duration":     -1,
+		}, nil)
+}
+
+// request sends a request to the Toggl API, encoding the body (if any) and
+// decoding the response into result as JSON.
+func (t *toggl) request(method, path string, body, result interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, togglAPI+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.token, "api_token")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("toggl: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timetrack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/localtz"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeToggl struct {
+	*httptest.Server
+
+	sync.Mutex
+	entries  []map[string]interface{}
+	created  []map[string]interface{}
+	stopped  []string
+	failPath string
+}
+
+func (f *fakeToggl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if user, pass, _ := r.BasicAuth(); user != "token" || pass != "api_token" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "Incorrect username and/or password\n")
+		return
+	}
+	if r.URL.Path == f.failPath {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/me/time_entries/current":
+		var current interface{}
+		for _, e := range f.entries {
+			if e["duration"].(int) < 0 {
+				current = e
+			}
+		}
+		json.NewEncoder(w).Encode(current)
+	case r.Method == "GET" && r.URL.Path == "/me/time_entries":
+		start, _ := time.Parse(time.RFC3339, r.URL.Query().Get("start_date"))
+		entries := []map[string]interface{}{}
+		for _, e := range f.entries {
+			if t, _ := time.Parse(time.RFC3339, e["start"].(string)); !t.Before(start) {
+				entries = append(entries, e)
+			}
+		}
+		json.NewEncoder(w).Encode(entries)
+	case r.Method == "PATCH":
+		f.stopped = append(f.stopped, r.URL.Path)
+		fmt.Fprint(w, "{}")
+	case r.Method == "POST" && r.URL.Path == "/workspaces/12/time_entries":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.created = append(f.created, body)
+		fmt.Fprint(w, "{}")
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeToggl) setEntries(entries ...map[string]interface{}) {
+	f.Lock()
+	defer f.Unlock()
+	f.entries = entries
+}
+
+func entry(id int, desc string, start time.Time, duration time.Duration) map[string]interface{} {
+	e := map[string]interface{}{
+		"id": id, "workspace_id": 12, "project_id": 34, "task_id": nil,
+		"billable": true, "description": desc, "tags": []string{"dev"},
+		"start": start.Format(time.RFC3339), "duration": int(duration.Seconds()),
+	}
+	if duration < 0 {
+		e["duration"] = -1
+	} else {
+		e["stop"] = start.Add(duration).Format(time.RFC3339)
+	}
+	return e
+}
+
+func TestToggl(t *testing.T) {
+	testBar.New(t)
+	localtz.SetForTest(time.UTC)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 14, 0, 0, 0, time.UTC))
+	f := &fakeToggl{}
+	f.Server = httptest.NewServer(f)
+	defer f.Close()
+	togglAPI = f.URL
+
+	f.setEntries(
+		entry(1, "Yesterday", now.Add(-20*time.Hour), time.Hour),
+		entry(2, "Meetings", now.Add(-5*time.Hour), 90*time.Minute),
+		entry(3, "Barista", now.Add(-30*time.Minute), -1),
+	)
+	m := Toggl("token")
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"Barista 0:30 (2:00)"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on stop")
+	f.Lock()
+	stopped := f.stopped
+	f.Unlock()
+	require.Equal(t, []string{"/workspaces/12/time_entries/3/stop"}, stopped)
+
+	f.setEntries(
+		entry(2, "Meetings", now.Add(-5*time.Hour), 90*time.Minute),
+		entry(3, "Barista", now.Add(-30*time.Minute), 30*time.Minute),
+	)
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%v %v", i.Tracking, i.Today).
+			OnClick(func(bar.Event) { i.Continue() })
+	})
+	out = testBar.NextOutput("on output change")
+	out.AssertText([]string{"false 2h0m0s"})
+
+	out.At(0).LeftClick()
+	testBar.NextOutput("on continue")
+	f.Lock()
+	created := f.created
+	f.Unlock()
+	require.Len(t, created, 1)
+	require.Equal(t, "Barista", created[0]["description"])
+	require.Equal(t, float64(34), created[0]["project_id"])
+	require.Equal(t, float64(-1), created[0]["duration"])
+	require.Equal(t, "2018-06-01T14:00:00Z", created[0]["start"])
+
+	f.setEntries(
+		entry(1, "Overnight", now.Add(-16*time.Hour), -1),
+	)
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText([]string{"true 14h1m0s"},
+		"counts running entry from yesterday")
+
+	f.Lock()
+	f.failPath = "/me/time_entries/current"
+	f.Unlock()
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+
+	testBar.New(t)
+	testBar.Run(Toggl("wrong"))
+	errs := testBar.NextOutput("on bad token").AssertError()
+	require.Equal(t, "toggl: 403 Forbidden: Incorrect username and/or password", errs[0])
+}
@@ -0,0 +1,245 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package todo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"barista.run/base/httpclient"
+	"barista.run/base/watchers/localtz"
+)
+
+// CalDAV constructs a todo module for the VTODO entries in a CalDAV
+// collection, e.g. a Nextcloud or Radicale task list. After the first refresh,
+// only changed entries are fetched using the WebDAV sync-collection report
+// (RFC 6578). Use App to set a URL to open on click.
+func CalDAV(collectionURL, username, password string) *Module {
+	return newModule(&caldav{
+		collection: collectionURL,
+		username:   username,
+		password:   password,
+	}, "", 5*time.Minute)
+}
+
+type caldav struct {
+	collection string
+	username   string
+	password   string
+	syncToken  string
+	items      map[string]Task // by href
+}
+
+func (c *caldav) name() string { return "caldav" }
+
+const syncCollection = `<?xml version="1.0" encoding="utf-8"?>
+<d:sync-collection xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+<d:sync-token>%s</d:sync-token>
+<d:sync-level>1</d:sync-level>
+<d:prop><d:getetag/><c:calendar-data/></d:prop>
+</d:sync-collection>`
+
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Status   string `xml:"DAV: status"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+	SyncToken string `xml:"DAV: sync-token"`
+}
+
+func (c *caldav) sync() ([]Task, error) {
+	ms, err := c.report()
+	if _, ok := err.(invalidTokenError); ok && c.syncToken != "" {
+		// The server has discarded the token, so start again from scratch.
+		c.syncToken = ""
+		ms, err = c.report()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.items == nil || c.syncToken == "" {
+		c.items = map[string]Task{}
+	}
+	for _, r := range ms.Responses {
+		if strings.Contains(r.Status, " 404 ") {
+			delete(c.items, r.Href)
+			continue
+		}
+		data := ""
+		for _, ps := range r.Propstat {
+			if strings.Contains(ps.Status, " 200 ") {
+				data = ps.Prop.CalendarData
+			}
+		}
+		if data == "" {
+			// Not all servers include calendar-data in the report.
+			if data, err = c.get(r.Href); err != nil {
+				return nil, err
+			}
+		}
+		if task, ok := parseVTODO(data); ok {
+			c.items[r.Href] = task
+		} else {
+			delete(c.items, r.Href)
+		}
+	}
+	c.syncToken = ms.SyncToken
+	tasks := make([]Task, 0, len(c.items))
+	for _, task := range c.items {
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// invalidTokenError is returned when the server rejects the sync token.
+type invalidTokenError struct{ error }
+
+func (c *caldav) report() (*multistatus, error) {
+	var body bytes.Buffer
+	xml.EscapeText(&body, []byte(c.syncToken))
+	respBody, err := c.request("REPORT", c.collection,
+		fmt.Sprintf(syncCollection, body.String()))
+	if err != nil {
+		return nil, err
+	}
+	ms := &multistatus{}
+	return ms, xml.Unmarshal(respBody, ms)
+}
+
+func (c *caldav) get(href string) (string, error) {
+	base, err := url.Parse(c.collection)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	data, err := c.request("GET", base.ResolveReference(ref).String(), "")
+	return string(data), err
+}
+
+func (c *caldav) request(method, target, body string) ([]byte, error) {
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", `application/xml; charset="utf-8"`)
+		req.Header.Set("Depth", "0")
+	}
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		err = fmt.Errorf("caldav: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+		// RFC 6578 uses the DAV:valid-sync-token precondition to report
+		// invalid tokens, usually with 403 Forbidden or 409 Conflict.
+		if bytes.Contains(data, []byte("valid-sync-token")) {
+			err = invalidTokenError{err}
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseVTODO extracts the first VTODO from iCalendar data, returning false if
+// there is none, or if it is completed, cancelled, or has no due date.
+func parseVTODO(data string) (Task, bool) {
+	// Unfold continuation lines (RFC 5545 section 3.1).
+	data = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(data)
+	var t Task
+	inTodo := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		params := strings.Split(line[:colon], ";")
+		name, val := strings.ToUpper(params[0]), line[colon+1:]
+		switch {
+		case name == "BEGIN" && val == "VTODO":
+			inTodo = true
+		case !inTodo:
+		case name == "END" && val == "VTODO":
+			return t, !t.Due.IsZero()
+		case name == "UID":
+			t.ID = val
+		case name == "SUMMARY":
+			t.Title = unescapeText(val)
+		case name == "DUE":
+			t.Due, t.AllDay = parseICalTime(params[1:], val)
+		case name == "COMPLETED":
+			return t, false
+		case name == "STATUS" && (val == "COMPLETED" || val == "CANCELLED"):
+			return t, false
+		}
+	}
+	return t, false
+}
+
+// parseICalTime parses a DATE or DATE-TIME value, using the TZID parameter if
+// present, and returns the zero time if the value is invalid.
+func parseICalTime(params []string, val string) (time.Time, bool) {
+	if len(val) == len("20060102") {
+		d, err := time.Parse("20060102", val)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return date(d.Year(), d.Month(), d.Day()), true
+	}
+	if strings.HasSuffix(val, "Z") {
+		t, _ := time.Parse("20060102T150405Z", val)
+		return t, false
+	}
+	loc := localtz.Get()
+	for _, p := range params {
+		if strings.HasPrefix(strings.ToUpper(p), "TZID=") {
+			if tz, err := time.LoadLocation(strings.Trim(p[5:], `"`)); err == nil {
+				loc = tz
+			}
+		}
+	}
+	t, _ := time.ParseInLocation("20060102T150405", val, loc)
+	return t, false
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\,`, `,`, `\;`, `;`, `\n`, "\n", `\N`, "\n")
+
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
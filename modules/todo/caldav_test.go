@@ -0,0 +1,238 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package todo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/base/watchers/localtz"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func vtodo(uid, extra string) string {
+	return strings.Replace(`BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//barista//test//EN
+BEGIN:VTODO
+UID:`+uid+`
+DTSTAMP:20180601T080000Z
+`+extra+`
+END:VTODO
+END:VCALENDAR
+`, "\n", "\r\n", -1)
+}
+
+type fakeCalDAV struct {
+	sync.Mutex
+	tokens    []string
+	responses []string
+	objects   map[string]string
+}
+
+func (f *fakeCalDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if user, pass, _ := r.BasicAuth(); user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == "GET" {
+		if obj, ok := f.objects[r.URL.Path]; ok {
+			fmt.Fprint(w, obj)
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	if r.Method != "REPORT" || r.URL.Path != "/dav/tasks/" ||
+		r.Header.Get("Depth") != "0" || !strings.Contains(string(body), "sync-collection") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	token := string(body)
+	token = token[strings.Index(token, "<d:sync-token>")+len("<d:sync-token>"):]
+	token = token[:strings.Index(token, "<")]
+	f.tokens = append(f.tokens, token)
+	if len(f.responses) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	resp := f.responses[0]
+	f.responses = f.responses[1:]
+	if resp == "invalid" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<?xml version="1.0"?><d:error xmlns:d="DAV:"><d:valid-sync-token/></d:error>`)
+		return
+	}
+	w.WriteHeader(207)
+	fmt.Fprint(w, resp)
+}
+
+func (f *fakeCalDAV) respond(token string, responses ...string) {
+	f.Lock()
+	defer f.Unlock()
+	f.responses = append(f.responses, fmt.Sprintf(
+		`<?xml version="1.0" encoding="utf-8"?>
+<d:multistatus xmlns:d="DAV:" xmlns:cal="urn:ietf:params:xml:ns:caldav">%s
+<d:sync-token>%s</d:sync-token>
+</d:multistatus>`, strings.Join(responses, ""), token))
+}
+
+func (f *fakeCalDAV) syncTokens() []string {
+	f.Lock()
+	defer f.Unlock()
+	return f.tokens
+}
+
+func changed(href, data string) string {
+	if data != "" {
+		data = "<cal:calendar-data>" + strings.Replace(data, "&", "&amp;", -1) + "</cal:calendar-data>"
+	}
+	return fmt.Sprintf(`<d:response><d:href>%s</d:href><d:propstat><d:prop>
+<d:getetag>"1"</d:getetag>%s</d:prop><d:status>HTTP/1.1 200 OK</d:status>
+</d:propstat></d:response>`, href, data)
+}
+
+func removed(href string) string {
+	return fmt.Sprintf(`<d:response><d:href>%s</d:href>
+<d:status>HTTP/1.1 404 Not Found</d:status></d:response>`, href)
+}
+
+func TestCalDAV(t *testing.T) {
+	testBar.New(t)
+	localtz.SetForTest(time.UTC)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 14, 0, 0, 0, time.UTC))
+	f := &fakeCalDAV{objects: map[string]string{
+		"/dav/tasks/c.ics": vtodo("c", "SUMMARY:Fetched\nDUE;VALUE=DATE:20180601"),
+	}}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	f.respond("http://example.com/sync/1",
+		changed("/dav/tasks/a.ics", vtodo("a", "SUMMARY:Water plants\nDUE;VALUE=DATE:20180601")),
+		changed("/dav/tasks/b.ics", vtodo("b", "SUMMARY:Call back\nDUE:20180601T160000Z")),
+		changed("/dav/tasks/d.ics", vtodo("d", "SUMMARY:Someday")),
+		changed("/dav/tasks/e.ics", vtodo("e", "SUMMARY:Next week\nDUE;VALUE=DATE:20180608")),
+	)
+	m := CalDAV(srv.URL+"/dav/tasks/", "user", "pass")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"2 todo"})
+
+	f.respond("http://example.com/sync/2",
+		changed("/dav/tasks/a.ics", vtodo("a", "SUMMARY:Water plants\nDUE;VALUE=DATE:20180601\nSTATUS:COMPLETED")),
+		removed("/dav/tasks/b.ics"),
+		changed("/dav/tasks/c.ics", ""),
+		changed("/dav/tasks/e.ics", vtodo("e", "SUMMARY:Next week\nDUE;VALUE=DATE:20180531")),
+	)
+	testBar.Tick()
+	testBar.NextOutput("on incremental sync").
+		AssertText([]string{"2 todo (1 overdue)"})
+
+	f.Lock()
+	f.responses = append(f.responses, "invalid")
+	f.Unlock()
+	f.respond("http://example.com/sync/3",
+		changed("/dav/tasks/f.ics", vtodo("f", "SUMMARY:Only one\nDUE;VALUE=DATE:20180601")),
+	)
+	testBar.Tick()
+	testBar.NextOutput("on invalid token").AssertText([]string{"1 todo"},
+		"resyncs from scratch if the token is rejected")
+
+	require.Equal(t, []string{
+		"",
+		"http://example.com/sync/1",
+		"http://example.com/sync/2",
+		"",
+	}, f.syncTokens())
+
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestCalDAVErrors(t *testing.T) {
+	testBar.New(t)
+	f := &fakeCalDAV{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	testBar.Run(CalDAV(srv.URL+"/dav/tasks/", "user", "wrong"))
+	testBar.NextOutput("on start").AssertError("with wrong password")
+
+	testBar.New(t)
+	f.respond("1", changed("/dav/tasks/missing.ics", ""))
+	testBar.Run(CalDAV(srv.URL+"/dav/tasks/", "user", "pass"))
+	testBar.NextOutput("on start").AssertError("when fetching data fails")
+
+	testBar.New(t)
+	f.Lock()
+	f.responses = append(f.responses, "invalid")
+	f.Unlock()
+	testBar.Run(CalDAV(srv.URL+"/dav/tasks/", "user", "pass"))
+	testBar.NextOutput("on start").AssertError("when initial sync is rejected")
+}
+
+func TestParseVTODO(t *testing.T) {
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	ny, _ := time.LoadLocation("America/New_York")
+	localtz.SetForTest(la)
+
+	task, ok := parseVTODO(vtodo("a",
+		`SUMMARY:Buy milk\, eggs\; and a very long
+  line\nwith escapes
+DUE;VALUE=DATE:20180601`))
+	require.True(t, ok)
+	require.Equal(t, Task{
+		ID:     "a",
+		Title:  "Buy milk, eggs; and a very long line\nwith escapes",
+		Due:    time.Date(2018, 6, 1, 0, 0, 0, 0, la),
+		AllDay: true,
+	}, task)
+
+	task, ok = parseVTODO(vtodo("b", "SUMMARY:Floating\nDUE:20180601T093000"))
+	require.True(t, ok)
+	require.True(t, time.Date(2018, 6, 1, 9, 30, 0, 0, la).Equal(task.Due))
+	require.False(t, task.AllDay)
+
+	task, ok = parseVTODO(vtodo("c", "SUMMARY:Zoned\nDUE;TZID=America/New_York:20180601T093000"))
+	require.True(t, ok)
+	require.True(t, time.Date(2018, 6, 1, 9, 30, 0, 0, ny).Equal(task.Due))
+
+	task, ok = parseVTODO(vtodo("d", "SUMMARY:UTC\nDUE:20180601T093000Z"))
+	require.True(t, ok)
+	require.True(t, time.Date(2018, 6, 1, 9, 30, 0, 0, time.UTC).Equal(task.Due))
+
+	for _, extra := range []string{
+		"SUMMARY:No due date",
+		"SUMMARY:Invalid\nDUE:June",
+		"SUMMARY:Done\nDUE:20180601T093000Z\nCOMPLETED:20180601T100000Z",
+		"SUMMARY:Cancelled\nDUE:20180601T093000Z\nSTATUS:CANCELLED",
+	} {
+		_, ok = parseVTODO(vtodo("e", extra))
+		require.False(t, ok, extra)
+	}
+	_, ok = parseVTODO("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20180601T093000Z\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	require.False(t, ok, "without any VTODO")
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package todo provides a bar module that shows the tasks remaining for today
+// from Todoist or a CalDAV task list, using incremental sync so that only
+// changes are fetched on each refresh.
+package todo // import "barista.run/modules/todo"
+
+import (
+	"os/exec"
+	"sort"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/click"
+	"barista.run/base/watchers/localtz"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Task represents a single open task with a due date.
+type Task struct {
+	ID    string
+	Title string
+	// Due is the due date of the task. For tasks without a due time, this is
+	// local midnight at the start of the due date, and AllDay is true.
+	Due    time.Time
+	AllDay bool
+}
+
+// Overdue returns true if the task was due before the current time, or for
+// all-day tasks, before today.
+func (t Task) Overdue() bool {
+	if t.AllDay {
+		return t.Due.Before(timing.StartOfDay())
+	}
+	return t.Due.Before(timing.Now())
+}
+
+// Info represents the tasks remaining for today.
+type Info struct {
+	// Backend is the name of the task service, "todoist" or "caldav".
+	Backend string
+	// Tasks is the list of incomplete tasks due today or earlier, ordered by
+	// due date.
+	Tasks []Task
+
+	url string
+}
+
+// Count returns the number of tasks remaining for today.
+func (i Info) Count() int {
+	return len(i.Tasks)
+}
+
+// Overdue returns the number of tasks that are past their due date.
+func (i Info) Overdue() int {
+	c := 0
+	for _, t := range i.Tasks {
+		if t.Overdue() {
+			c++
+		}
+	}
+	return c
+}
+
+// Open opens the task app in the default browser.
+func (i Info) Open() {
+	if i.url == "" {
+		return
+	}
+	if err := openURL(i.url); err != nil {
+		l.Log("Failed to open %s: %v", i.url, err)
+	}
+}
+
+// backend abstracts a task service.
+type backend interface {
+	name() string
+	// sync brings the local copy of tasks up to date and returns all open
+	// tasks that have a due date.
+	sync() ([]Task, error)
+}
+
+// Module represents a bar module that shows today's remaining tasks.
+type Module struct {
+	backend    backend
+	url        string
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+func newModule(b backend, url string, interval time.Duration) *Module {
+	m := &Module{
+		backend:   b,
+		url:       url,
+		scheduler: timing.NewScheduler().Every(interval),
+	}
+	l.Label(m, b.name())
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		if i.Count() == 0 {
+			return nil
+		}
+		if o := i.Overdue(); o > 0 {
+			return outputs.Textf("%d todo (%d overdue)", i.Count(), o).
+				Urgent(true).OnClick(click.Left(i.Open))
+		}
+		return outputs.Textf("%d todo", i.Count()).OnClick(click.Left(i.Open))
+	})
+	return m
+}
+
+// App sets the URL that is opened by Info.Open, for example a web interface
+// for the task list. It must be called before the module is started.
+func (m *Module) App(url string) *Module {
+	m.url = url
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// RefreshInterval configures the polling frequency. Since only changes are
+// fetched, frequent refreshes are relatively cheap.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	tasks, err := m.backend.sync()
+	for {
+		if sink.Error(err) {
+			return
+		}
+		sink.Output(outputFunc(Info{
+			Backend: m.backend.name(),
+			Tasks:   dueToday(tasks),
+			url:     m.url,
+		}))
+		select {
+		case <-m.scheduler.C:
+			tasks, err = m.backend.sync()
+		case <-localtz.Next():
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// dueToday returns the tasks due before the end of the current day, ordered by
+// due date and then by title.
+func dueToday(tasks []Task) []Task {
+	tomorrow := timing.StartOfDay().AddDate(0, 0, 1)
+	r := []Task{}
+	for _, t := range tasks {
+		if t.Due.Before(tomorrow) {
+			r = append(r, t)
+		}
+	}
+	sort.SliceStable(r, func(a, b int) bool {
+		if !r[a].Due.Equal(r[b].Due) {
+			return r[a].Due.Before(r[b].Due)
+		}
+		return r[a].Title < r[b].Title
+	})
+	return r
+}
+
+// date returns local midnight at the start of the given date.
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, localtz.Get())
+}
+
+// Overridden in tests.
+var openURL = func(url string) error {
+	return exec.Command("xdg-open", url).Run()
+}
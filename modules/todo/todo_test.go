@@ -0,0 +1,147 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package todo
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/localtz"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackend struct {
+	sync.Mutex
+	tasks []Task
+	err   error
+	syncs int
+}
+
+func (f *fakeBackend) name() string { return "fake" }
+
+func (f *fakeBackend) sync() ([]Task, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.syncs++
+	return append([]Task(nil), f.tasks...), f.err
+}
+
+func (f *fakeBackend) set(tasks []Task, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.tasks = tasks
+	f.err = err
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	localtz.SetForTest(time.UTC)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 14, 0, 0, 0, time.UTC))
+	var opened []string
+	var openedMu sync.Mutex
+	openURL = func(url string) error {
+		openedMu.Lock()
+		defer openedMu.Unlock()
+		opened = append(opened, url)
+		return nil
+	}
+
+	f := &fakeBackend{}
+	f.set([]Task{
+		{ID: "1", Title: "Water plants", Due: date(2018, 6, 1), AllDay: true},
+		{ID: "2", Title: "Call back", Due: now.Add(2 * time.Hour)},
+		{ID: "3", Title: "Renew passport", Due: date(2018, 6, 2), AllDay: true},
+	}, nil)
+	m := newModule(f, "https://example.com/today", time.Minute)
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"2 todo"})
+	out.At(0).LeftClick()
+	openedMu.Lock()
+	require.Equal(t, []string{"https://example.com/today"}, opened)
+	openedMu.Unlock()
+
+	f.set([]Task{
+		{ID: "1", Title: "Water plants", Due: date(2018, 5, 31), AllDay: true},
+		{ID: "2", Title: "Call back", Due: now.Add(-time.Minute)},
+		{ID: "4", Title: "Buy milk", Due: date(2018, 6, 1), AllDay: true},
+	}, nil)
+	testBar.Tick()
+	out = testBar.NextOutput("on refresh")
+	out.AssertText([]string{"3 todo (2 overdue)"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.True(t, urgent, "urgent when overdue")
+
+	m.Output(func(i Info) bar.Output {
+		titles := ""
+		for _, t := range i.Tasks {
+			titles += t.Title + ";"
+		}
+		return outputs.Textf("%s %s", i.Backend, titles)
+	})
+	testBar.NextOutput("on output change").AssertText(
+		[]string{"fake Water plants;Buy milk;Call back;"},
+		"ordered by due date, then title")
+
+	f.set(nil, nil)
+	m.Output(func(i Info) bar.Output { return nil })
+	testBar.NextOutput("on output change").AssertEmpty()
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%d", i.Count()).OnClick(func(bar.Event) { i.Open() })
+	})
+	testBar.NextOutput("without refresh").AssertText([]string{"3"},
+		"output change does not sync")
+
+	f.set(nil, errors.New("something went wrong"))
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	localtz.SetForTest(time.UTC)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 14, 0, 0, 0, time.UTC))
+	openURL = func(string) error {
+		require.Fail(t, "should not open without an app URL")
+		return nil
+	}
+	f := &fakeBackend{}
+	f.set([]Task{{Title: "Tomorrow", Due: date(2018, 6, 2), AllDay: true}}, nil)
+	m := newModule(f, "", time.Minute)
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertEmpty("no tasks due today")
+
+	f.set([]Task{{Title: "Today", Due: date(2018, 6, 1), AllDay: true}}, nil)
+	testBar.Tick()
+	out := testBar.NextOutput("on refresh")
+	out.AssertText([]string{"1 todo"})
+	out.At(0).LeftClick()
+}
+
+func TestTaskOverdue(t *testing.T) {
+	localtz.SetForTest(time.UTC)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 14, 0, 0, 0, time.UTC))
+	require.False(t, Task{Due: date(2018, 6, 1), AllDay: true}.Overdue())
+	require.True(t, Task{Due: date(2018, 5, 31), AllDay: true}.Overdue())
+	require.True(t, Task{Due: now.Add(-time.Second)}.Overdue())
+	require.False(t, Task{Due: now.Add(time.Second)}.Overdue())
+}
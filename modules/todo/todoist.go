@@ -0,0 +1,126 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package todo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"barista.run/base/httpclient"
+	"barista.run/base/watchers/localtz"
+)
+
+// Todoist constructs a todo module using the Todoist Sync API, with an API
+// token from the Todoist integration settings. After the first refresh, only
+// changed tasks are fetched using the sync token. Clicking opens the Todoist
+// web app on the "Today" view.
+func Todoist(apiToken string) *Module {
+	return newModule(&todoist{token: apiToken}, "https://todoist.com/app/today", time.Minute)
+}
+
+// Overridden in tests.
+var todoistAPI = "https://api.todoist.com/sync/v9/sync"
+
+type todoist struct {
+	token     string
+	syncToken string
+	items     map[string]Task
+}
+
+func (t *todoist) name() string { return "todoist" }
+
+type todoistItem struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	Checked bool   `json:"checked"`
+	Deleted bool   `json:"is_deleted"`
+	Due     *struct {
+		Date string `json:"date"`
+	} `json:"due"`
+}
+
+type todoistResponse struct {
+	SyncToken string        `json:"sync_token"`
+	FullSync  bool          `json:"full_sync"`
+	Items     []todoistItem `json:"items"`
+}
+
+func (t *todoist) sync() ([]Task, error) {
+	token := t.syncToken
+	if token == "" || t.items == nil {
+		token = "*"
+	}
+	req, err := http.NewRequest("POST", todoistAPI, strings.NewReader(url.Values{
+		"sync_token":     {token},
+		"resource_types": {`["items"]`},
+	}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("todoist: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var r todoistResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	if r.FullSync || t.items == nil {
+		t.items = map[string]Task{}
+	}
+	for _, it := range r.Items {
+		if it.Deleted || it.Checked || it.Due == nil {
+			delete(t.items, it.ID)
+			continue
+		}
+		due, allDay, err := parseTodoistDate(it.Due.Date)
+		if err != nil {
+			return nil, err
+		}
+		t.items[it.ID] = Task{ID: it.ID, Title: it.Content, Due: due, AllDay: allDay}
+	}
+	t.syncToken = r.SyncToken
+	tasks := make([]Task, 0, len(t.items))
+	for _, task := range t.items {
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// parseTodoistDate parses a due date, which can be a full-day date, a
+// "floating" date and time in the local timezone, or a date and time in UTC.
+func parseTodoistDate(s string) (t time.Time, allDay bool, err error) {
+	if t, err = time.ParseInLocation("2006-01-02", s, localtz.Get()); err == nil {
+		return t, true, nil
+	}
+	if strings.HasSuffix(s, "Z") {
+		t, err = time.Parse("2006-01-02T15:04:05Z", s)
+	} else {
+		t, err = time.ParseInLocation("2006-01-02T15:04:05", s, localtz.Get())
+	}
+	return t, false, err
+}
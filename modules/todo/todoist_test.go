@@ -0,0 +1,179 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package todo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/base/watchers/localtz"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTodoist struct {
+	sync.Mutex
+	tokens    []string
+	responses []string
+}
+
+func (f *fakeTodoist) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "Forbidden\n")
+		return
+	}
+	if r.FormValue("resource_types") != `["items"]` {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.tokens = append(f.tokens, r.FormValue("sync_token"))
+	if len(f.responses) == 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprint(w, f.responses[0])
+	f.responses = f.responses[1:]
+}
+
+func (f *fakeTodoist) respond(full bool, token string, items ...map[string]interface{}) {
+	f.Lock()
+	defer f.Unlock()
+	if items == nil {
+		items = []map[string]interface{}{}
+	}
+	r, _ := json.Marshal(map[string]interface{}{
+		"sync_token": token,
+		"full_sync":  full,
+		"items":      items,
+	})
+	f.responses = append(f.responses, string(r))
+}
+
+func (f *fakeTodoist) syncTokens() []string {
+	f.Lock()
+	defer f.Unlock()
+	return f.tokens
+}
+
+func item(id, content, due string) map[string]interface{} {
+	i := map[string]interface{}{"id": id, "content": content, "checked": false, "is_deleted": false}
+	if due != "" {
+		i["due"] = map[string]interface{}{"date": due, "is_recurring": false}
+	}
+	return i
+}
+
+func TestTodoist(t *testing.T) {
+	testBar.New(t)
+	localtz.SetForTest(time.UTC)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 14, 0, 0, 0, time.UTC))
+	f := &fakeTodoist{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	todoistAPI = srv.URL
+
+	f.respond(true, "t1",
+		item("1", "Water plants", "2018-06-01"),
+		item("2", "Call back", "2018-06-01T16:00:00"),
+		item("3", "Renew passport", "2018-06-20"),
+		item("4", "Someday", ""),
+	)
+	m := Todoist("token")
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"2 todo"})
+
+	checked := item("1", "Water plants", "2018-06-01")
+	checked["checked"] = true
+	deleted := item("2", "Call back", "2018-06-01T16:00:00")
+	deleted["is_deleted"] = true
+	f.respond(false, "t2", checked, deleted,
+		item("5", "Pay rent", "2018-05-31"),
+		item("6", "Standup", "2018-06-01T09:30:00Z"),
+	)
+	testBar.Tick()
+	testBar.NextOutput("on incremental sync").
+		AssertText([]string{"2 todo (2 overdue)"})
+
+	f.respond(false, "t3")
+	testBar.Tick()
+	testBar.NextOutput("on sync without changes").
+		AssertText([]string{"2 todo (2 overdue)"})
+
+	f.respond(true, "t4", item("7", "Moved", "2018-06-01"))
+	testBar.Tick()
+	testBar.NextOutput("on full sync").AssertText([]string{"1 todo"})
+
+	require.Equal(t, []string{"*", "t1", "t2", "t3"}, f.syncTokens())
+
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+
+	m.App("https://example.com")
+	testBar.New(t)
+	timing.AdvanceTo(time.Date(2018, 6, 1, 15, 0, 0, 0, time.UTC))
+	f.respond(false, "t5")
+	testBar.Run(m)
+	testBar.NextOutput("on restart").AssertText([]string{"1 todo"},
+		"keeps tasks across restarts")
+	require.Equal(t, "t4", f.syncTokens()[5])
+}
+
+func TestTodoistErrors(t *testing.T) {
+	testBar.New(t)
+	localtz.SetForTest(time.UTC)
+	f := &fakeTodoist{}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	todoistAPI = srv.URL
+
+	testBar.Run(Todoist("invalid"))
+	testBar.NextOutput("on start").AssertError("with invalid token")
+
+	testBar.New(t)
+	f.respond(true, "t1", item("1", "Bad date", "tomorrow"))
+	testBar.Run(Todoist("token"))
+	testBar.NextOutput("on start").AssertError("with invalid date")
+}
+
+func TestParseTodoistDate(t *testing.T) {
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	localtz.SetForTest(la)
+	for _, tc := range []struct {
+		in     string
+		out    time.Time
+		allDay bool
+	}{
+		{"2018-06-01", time.Date(2018, 6, 1, 0, 0, 0, 0, la), true},
+		{"2018-06-01T12:30:00", time.Date(2018, 6, 1, 12, 30, 0, 0, la), false},
+		{"2018-06-01T12:30:00Z", time.Date(2018, 6, 1, 12, 30, 0, 0, time.UTC), false},
+	} {
+		out, allDay, err := parseTodoistDate(tc.in)
+		require.NoError(t, err, tc.in)
+		require.True(t, tc.out.Equal(out), "%s: %v != %v", tc.in, tc.out, out)
+		require.Equal(t, tc.allDay, allDay, tc.in)
+	}
+	_, _, err := parseTodoistDate("2018-06-01 12:30")
+	require.Error(t, err)
+}
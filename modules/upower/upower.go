@@ -0,0 +1,356 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package upower provides a bar module that shows the battery levels of
+// peripheral devices (mice, keyboards, headsets, phones, etc.) known to UPower.
+package upower // import "barista.run/modules/upower"
+
+import (
+	"sort"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// Type represents the type of a UPower device.
+type Type uint32
+
+// Device types, as defined by UPower.
+const (
+	UnknownType Type = iota
+	LinePower
+	Battery
+	UPS
+	Monitor
+	Mouse
+	Keyboard
+	PDA
+	Phone
+	MediaPlayer
+	Tablet
+	Computer
+	GamingInput
+	Pen
+	Touchpad
+	Modem
+	Network
+	Headset
+	Speakers
+	Headphones
+	Video
+	OtherAudio
+	RemoteControl
+	Printer
+	Scanner
+	Camera
+	Wearable
+	Toy
+	BluetoothGeneric
+)
+
+var typeNames = []string{
+	"unknown", "line-power", "battery", "ups", "monitor", "mouse", "keyboard",
+	"pda", "phone", "media-player", "tablet", "computer", "gaming-input", "pen",
+	"touchpad", "modem", "network", "headset", "speakers", "headphones", "video",
+	"other-audio", "remote-control", "printer", "scanner", "camera", "wearable",
+	"toy", "bluetooth-generic",
+}
+
+func (t Type) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return typeNames[UnknownType]
+}
+
+// State represents the charging state of a UPower device.
+type State uint32
+
+// Device states, as defined by UPower.
+const (
+	UnknownState State = iota
+	Charging
+	Discharging
+	Empty
+	FullyCharged
+	PendingCharge
+	PendingDischarge
+)
+
+// Device represents a single device known to UPower.
+type Device struct {
+	// Path is the D-Bus object path of the device.
+	Path   string
+	Type   Type
+	Model  string
+	Vendor string
+	Serial string
+	// Percentage of battery remaining, from 0 to 100.
+	Percentage float64
+	State      State
+	// IconName is the freedesktop icon name suggested by UPower.
+	IconName string
+	// PowerSupply is true if the device powers the computer.
+	PowerSupply bool
+	// Present is true if the device's battery is present.
+	Present bool
+}
+
+// Name returns a human-readable name for the device, preferring the model.
+func (d Device) Name() string {
+	switch {
+	case d.Model != "":
+		return d.Model
+	case d.Vendor != "":
+		return d.Vendor + " " + d.Type.String()
+	default:
+		return d.Type.String()
+	}
+}
+
+// Charging returns true if the device is currently being charged.
+func (d Device) Charging() bool {
+	return d.State == Charging || d.State == PendingCharge
+}
+
+// Info represents the devices being displayed by the module.
+type Info struct {
+	// Devices contains all matching devices, ordered by path.
+	Devices []Device
+	// Threshold is the percentage below which a device is considered low.
+	Threshold float64
+}
+
+// Low returns all devices whose battery level is below the threshold and
+// which are not being charged.
+func (i Info) Low() []Device {
+	var low []Device
+	for _, d := range i.Devices {
+		if d.Percentage < i.Threshold && !d.Charging() {
+			low = append(low, d)
+		}
+	}
+	return low
+}
+
+// Module represents a bar module that shows UPower device batteries.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	filter     value.Value     // of func(Device) bool
+	threshold  value.Value     // of float64
+}
+
+// New constructs a module that shows all peripheral devices reported by
+// UPower, i.e. all devices with a battery that do not power the computer.
+func New() *Module {
+	m := new(Module)
+	l.Register(m, "outputFunc", "filter", "threshold")
+	m.Threshold(20)
+	m.Filter(func(d Device) bool {
+		return !d.PowerSupply && d.Present && d.Type != LinePower
+	})
+	m.Output(func(i Info) bar.Output {
+		out := outputs.Group()
+		for _, d := range i.Devices {
+			out.Append(outputs.Textf("%s %.0f%%", d.Name(), d.Percentage).
+				Urgent(d.Percentage < i.Threshold && !d.Charging()))
+		}
+		return out
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Filter configures the devices shown by the module. Only devices for which
+// the filter function returns true are included in the output.
+func (m *Module) Filter(filter func(Device) bool) *Module {
+	m.filter.Set(filter)
+	return m
+}
+
+// Types restricts the module to devices of the given types.
+func (m *Module) Types(types ...Type) *Module {
+	return m.Filter(func(d Device) bool {
+		for _, t := range types {
+			if d.Type == t {
+				return d.Present
+			}
+		}
+		return false
+	})
+}
+
+// Threshold sets the battery percentage below which a device is considered
+// low. The default output marks low devices as urgent.
+func (m *Module) Threshold(pct float64) *Module {
+	m.threshold.Set(pct)
+	return m
+}
+
+// Overridden in tests.
+var busType = dbus.System
+
+const (
+	upowerService = "org.freedesktop.UPower"
+	upowerPath    = "/org/freedesktop/UPower"
+	upowerIface   = "org.freedesktop.UPower"
+	deviceIface   = "org.freedesktop.UPower.Device"
+)
+
+var deviceProps = []string{
+	"Type", "Model", "Vendor", "Serial", "Percentage",
+	"State", "IconName", "PowerSupply", "IsPresent",
+}
+
+// device wraps a properties watcher for a single UPower device, and forwards
+// its updates until closed.
+type device struct {
+	w    *dbus.PropertiesWatcher
+	done chan struct{}
+}
+
+func watchDevice(path godbus.ObjectPath, notifyFn func()) *device {
+	d := &device{
+		w:    dbus.WatchProperties(busType, upowerService, string(path), deviceIface).Add(deviceProps...),
+		done: make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-d.w.Updates:
+				notifyFn()
+			case <-d.done:
+				return
+			}
+		}
+	}()
+	return d
+}
+
+func (d *device) close() {
+	close(d.done)
+	d.w.Unsubscribe()
+}
+
+func (d *device) info(path godbus.ObjectPath) Device {
+	props := d.w.Get()
+	i := Device{Path: string(path)}
+	if t, ok := props["Type"].(uint32); ok {
+		i.Type = Type(t)
+	}
+	if s, ok := props["State"].(uint32); ok {
+		i.State = State(s)
+	}
+	i.Model, _ = props["Model"].(string)
+	i.Vendor, _ = props["Vendor"].(string)
+	i.Serial, _ = props["Serial"].(string)
+	i.Percentage, _ = props["Percentage"].(float64)
+	i.IconName, _ = props["IconName"].(string)
+	i.PowerSupply, _ = props["PowerSupply"].(bool)
+	i.Present, _ = props["IsPresent"].(bool)
+	return i
+}
+
+func devicesChanged(s *dbus.Signal, _ dbus.Fetcher) map[string]interface{} {
+	return map[string]interface{}{"Devices": s.Body}
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	w := dbus.WatchProperties(busType, upowerService, upowerPath, upowerIface).
+		Add("DaemonVersion").
+		AddSignalHandler("DeviceAdded", devicesChanged).
+		AddSignalHandler("DeviceRemoved", devicesChanged)
+	defer w.Unsubscribe()
+
+	notifyFn, deviceUpdates := notifier.New()
+	devices := map[godbus.ObjectPath]*device{}
+	defer func() {
+		for _, d := range devices {
+			d.close()
+		}
+	}()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextFilter, done := m.filter.Subscribe()
+	defer done()
+	nextThreshold, done := m.threshold.Subscribe()
+	defer done()
+
+	enumerate(w, devices, notifyFn)
+	for {
+		sink.Output(outputFunc(m.info(devices)))
+		select {
+		case <-w.Updates:
+			enumerate(w, devices, notifyFn)
+		case <-deviceUpdates:
+		case <-nextFilter:
+		case <-nextThreshold:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+// enumerate updates the set of watched devices to match those reported by
+// UPower, adding watchers for new devices and removing those that are gone.
+func enumerate(w *dbus.PropertiesWatcher, devices map[godbus.ObjectPath]*device, notifyFn func()) {
+	var paths []godbus.ObjectPath
+	if r, err := w.Call("EnumerateDevices"); err != nil {
+		l.Log("Failed to enumerate UPower devices: %v", err)
+	} else if len(r) > 0 {
+		paths, _ = r[0].([]godbus.ObjectPath)
+	}
+	current := map[godbus.ObjectPath]bool{}
+	for _, p := range paths {
+		current[p] = true
+		if _, ok := devices[p]; !ok {
+			devices[p] = watchDevice(p, notifyFn)
+		}
+	}
+	for p, d := range devices {
+		if !current[p] {
+			d.close()
+			delete(devices, p)
+		}
+	}
+}
+
+func (m *Module) info(devices map[godbus.ObjectPath]*device) Info {
+	filter := m.filter.Get().(func(Device) bool)
+	i := Info{Threshold: m.threshold.Get().(float64)}
+	for p, d := range devices {
+		if dev := d.info(p); filter(dev) {
+			i.Devices = append(i.Devices, dev)
+		}
+	}
+	sort.Slice(i.Devices, func(a, b int) bool {
+		return i.Devices[a].Path < i.Devices[b].Path
+	})
+	return i
+}
@@ -0,0 +1,163 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upower
+
+import (
+	"fmt"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/testing/output"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+type testUPower struct {
+	svc   *dbus.TestBusService
+	root  *dbus.TestBusObject
+	paths []godbus.ObjectPath
+}
+
+func setupTestUPower() *testUPower {
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	u := &testUPower{svc: bus.RegisterService(upowerService)}
+	u.root = u.svc.Object(upowerPath, upowerIface)
+	u.root.SetProperty("DaemonVersion", "0.99.11", dbus.SignalTypeNone)
+	u.root.On("EnumerateDevices", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{u.paths}, nil
+	})
+	return u
+}
+
+func (u *testUPower) add(name string, props map[string]interface{}) *dbus.TestBusObject {
+	path := godbus.ObjectPath(fmt.Sprintf("%s/devices/%s", upowerPath, name))
+	obj := u.svc.Object(path, deviceIface)
+	obj.SetProperties(props, dbus.SignalTypeNone)
+	u.paths = append(u.paths, path)
+	return obj
+}
+
+func (u *testUPower) remove(name string) {
+	path := godbus.ObjectPath(fmt.Sprintf("%s/devices/%s", upowerPath, name))
+	for i, p := range u.paths {
+		if p == path {
+			u.paths = append(u.paths[:i], u.paths[i+1:]...)
+		}
+	}
+	u.root.Emit("DeviceRemoved", path)
+}
+
+func peripheral(t Type, model string, pct float64) map[string]interface{} {
+	return map[string]interface{}{
+		"Type":        uint32(t),
+		"Model":       model,
+		"Percentage":  pct,
+		"State":       uint32(Discharging),
+		"PowerSupply": false,
+		"IsPresent":   true,
+	}
+}
+
+func isUrgent(out output.Assertions) bool {
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	return urgent
+}
+
+func TestUPower(t *testing.T) {
+	testBar.New(t)
+	u := setupTestUPower()
+	u.add("line_power_AC", map[string]interface{}{
+		"Type": uint32(LinePower), "PowerSupply": true, "IsPresent": true,
+	})
+	u.add("battery_BAT0", map[string]interface{}{
+		"Type": uint32(Battery), "PowerSupply": true, "IsPresent": true,
+		"Percentage": 50.0, "Model": "Laptop",
+	})
+	mouse := u.add("mouse_dev_00", peripheral(Mouse, "MX Master", 55))
+
+	m := New()
+	testBar.Run(m)
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"MX Master 55%"})
+	require.False(t, isUrgent(out))
+
+	mouse.SetProperty("Percentage", 15.0, dbus.SignalTypeChanged)
+	out = testBar.NextOutput("on percentage change")
+	out.AssertText([]string{"MX Master 15%"})
+	require.True(t, isUrgent(out), "below threshold")
+
+	mouse.SetProperty("State", uint32(Charging), dbus.SignalTypeChanged)
+	out = testBar.NextOutput("on state change")
+	require.False(t, isUrgent(out), "charging")
+
+	headset := u.add("headset_dev_01", peripheral(Headset, "", 80))
+	headset.SetProperty("Vendor", "Sony", dbus.SignalTypeNone)
+	u.root.Emit("DeviceAdded", godbus.ObjectPath(upowerPath+"/devices/headset_dev_01"))
+	testBar.LatestOutput().AssertText([]string{"Sony headset 80%", "MX Master 15%"})
+
+	u.remove("mouse_dev_00")
+	testBar.LatestOutput().AssertText([]string{"Sony headset 80%"})
+
+	m.Threshold(90)
+	out = testBar.NextOutput("on threshold change")
+	require.True(t, isUrgent(out), "below new threshold")
+
+	m.Types(Keyboard)
+	testBar.NextOutput("on filter change").AssertEmpty()
+
+	kbd := u.add("keyboard_dev_02", peripheral(Keyboard, "K380", 40))
+	u.root.Emit("DeviceAdded", godbus.ObjectPath(upowerPath+"/devices/keyboard_dev_02"))
+	testBar.LatestOutput().AssertText([]string{"K380 40%"})
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("%d low", len(i.Low()))
+	})
+	testBar.NextOutput("on output func change").AssertText([]string{"1 low"})
+
+	kbd.SetProperty("IsPresent", false, dbus.SignalTypeChanged)
+	testBar.NextOutput("on device removal").AssertText([]string{"0 low"})
+}
+
+func TestDisconnected(t *testing.T) {
+	testBar.New(t)
+	u := setupTestUPower()
+	u.add("mouse_dev_00", peripheral(Mouse, "", 30))
+	u.svc.Unregister()
+
+	testBar.Run(New())
+	testBar.NextOutput("without upower").AssertEmpty()
+}
+
+func TestDevice(t *testing.T) {
+	require := require.New(t)
+	require.Equal("keyboard", Device{Type: Keyboard}.Name())
+	require.Equal("Logitech mouse", Device{Type: Mouse, Vendor: "Logitech"}.Name())
+	require.Equal("Pixel 3", Device{Type: Phone, Vendor: "Google", Model: "Pixel 3"}.Name())
+	require.Equal("unknown", Type(1000).String())
+	require.True(Device{State: PendingCharge}.Charging())
+	require.False(Device{State: FullyCharged}.Charging())
+
+	i := Info{Threshold: 25, Devices: []Device{
+		{Model: "a", Percentage: 10},
+		{Model: "b", Percentage: 20, State: Charging},
+		{Model: "c", Percentage: 30},
+	}}
+	require.Equal([]Device{{Model: "a", Percentage: 10}}, i.Low())
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package uptime provides a bar module that shows the system uptime in a
+// humanized form, e.g. "42m", "5h", or "3d". Instead of polling, the module
+// schedules its next update for when the displayed value changes.
+package uptime // import "barista.run/modules/uptime"
+
+import (
+	"fmt"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+
+	"golang.org/x/sys/unix"
+)
+
+// Info represents the system uptime.
+type Info struct {
+	Uptime time.Duration
+}
+
+// Boot returns the time when the system was booted.
+func (i Info) Boot() time.Time {
+	return timing.Now().Add(-i.Uptime)
+}
+
+// unit returns the unit used to display the uptime: minutes for the first
+// hour, hours for the first day, and days after that.
+func (i Info) unit() time.Duration {
+	switch {
+	case i.Uptime < time.Hour:
+		return time.Minute
+	case i.Uptime < 24*time.Hour:
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Humanized returns the uptime using the largest whole unit, e.g. "5h" for an
+// uptime of 5 hours and 59 minutes.
+func (i Info) Humanized() string {
+	u := i.unit()
+	n := int64(i.Uptime / u)
+	switch u {
+	case time.Minute:
+		return fmt.Sprintf("%dm", n)
+	case time.Hour:
+		return fmt.Sprintf("%dh", n)
+	}
+	return fmt.Sprintf("%dd", n)
+}
+
+// nextRollover returns the delay until the humanized uptime changes.
+func (i Info) nextRollover() time.Duration {
+	u := i.unit()
+	return (i.Uptime/u+1)*u - i.Uptime
+}
+
+// Module represents an uptime bar module.
+type Module struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	scheduler  *timing.Scheduler
+}
+
+// New constructs a new uptime module.
+func New() *Module {
+	m := &Module{scheduler: timing.NewScheduler()}
+	l.Register(m, "outputFunc", "scheduler")
+	m.Output(func(i Info) bar.Output {
+		return outputs.Textf("up %s", i.Humanized())
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+// The output is only refreshed when the humanized uptime changes, so outputs
+// that show the uptime more precisely will not be updated in time.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	for {
+		var si unix.Sysinfo_t
+		if sink.Error(sysinfo(&si)) {
+			return
+		}
+		i := Info{Uptime: time.Duration(si.Uptime) * time.Second}
+		sink.Output(outputFunc(i))
+		// The uptime is read again on each update, since timers do not
+		// account for suspend, and the delay is capped so that the output
+		// catches up soon after resuming.
+		delay := i.nextRollover()
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		m.scheduler.After(delay)
+		select {
+		case <-m.scheduler.C:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+const maxDelay = time.Hour
+
+// To allow tests to mock out unix.Sysinfo.
+var sysinfo = unix.Sysinfo
@@ -0,0 +1,131 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package uptime
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	mu      sync.Mutex
+	boot    time.Time
+	suspend time.Duration
+	sysErr  error
+)
+
+func init() {
+	sysinfo = func(out *unix.Sysinfo_t) error {
+		mu.Lock()
+		defer mu.Unlock()
+		out.Uptime = int64((timing.Now().Sub(boot) + suspend) / time.Second)
+		return sysErr
+	}
+}
+
+func setup(t *testing.T, uptime time.Duration) time.Time {
+	testBar.New(t)
+	now := timing.AdvanceTo(time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC))
+	mu.Lock()
+	defer mu.Unlock()
+	boot = now.Add(-uptime)
+	suspend = 0
+	sysErr = nil
+	return boot
+}
+
+func TestUptime(t *testing.T) {
+	boot := setup(t, 58*time.Minute+30*time.Second)
+	testBar.Run(New())
+	testBar.NextOutput("on start").AssertText([]string{"up 58m"})
+
+	require.Equal(t, boot.Add(59*time.Minute), testBar.Tick())
+	testBar.NextOutput("on minute").AssertText([]string{"up 59m"})
+
+	require.Equal(t, boot.Add(time.Hour), testBar.Tick())
+	testBar.NextOutput("on hour").AssertText([]string{"up 1h"})
+
+	require.Equal(t, boot.Add(2*time.Hour), testBar.Tick(),
+		"updates every hour after the first hour")
+	testBar.NextOutput("on hour").AssertText([]string{"up 2h"})
+
+	timing.AdvanceTo(boot.Add(23*time.Hour + 30*time.Minute))
+	testBar.NextOutput("on tick").AssertText([]string{"up 23h"})
+	require.Equal(t, boot.Add(24*time.Hour), testBar.Tick())
+	testBar.NextOutput("on day").AssertText([]string{"up 1d"})
+
+	require.Equal(t, boot.Add(25*time.Hour), testBar.Tick(),
+		"updates at least every hour")
+	testBar.NextOutput("on hourly check").AssertText([]string{"up 1d"})
+
+	mu.Lock()
+	suspend = 23 * time.Hour
+	mu.Unlock()
+	require.Equal(t, boot.Add(26*time.Hour), testBar.Tick())
+	testBar.NextOutput("after suspend").AssertText([]string{"up 2d"},
+		"includes time spent suspended")
+}
+
+func TestOutput(t *testing.T) {
+	boot := setup(t, 3*time.Hour+20*time.Minute)
+	m := New().Output(func(i Info) bar.Output {
+		return outputs.Textf("%v since %s", i.Uptime, i.Boot().Format("15:04"))
+	})
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"3h20m0s since 08:40"})
+	require.Equal(t, boot.Add(4*time.Hour), testBar.Tick())
+	testBar.NextOutput("on hour").AssertText([]string{"4h0m0s since 08:40"})
+
+	m.Output(func(i Info) bar.Output {
+		return outputs.Text(i.Humanized())
+	})
+	testBar.NextOutput("on output change").AssertText([]string{"4h"})
+
+	mu.Lock()
+	sysErr = errors.New("something went wrong")
+	mu.Unlock()
+	testBar.Tick()
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestHumanized(t *testing.T) {
+	for _, tc := range []struct {
+		uptime time.Duration
+		out    string
+		next   time.Duration
+	}{
+		{0, "0m", time.Minute},
+		{59 * time.Second, "0m", time.Second},
+		{59*time.Minute + 59*time.Second, "59m", time.Second},
+		{time.Hour, "1h", time.Hour},
+		{23*time.Hour + 15*time.Minute, "23h", 45 * time.Minute},
+		{24 * time.Hour, "1d", 24 * time.Hour},
+		{100*24*time.Hour + 5*time.Hour, "100d", 19 * time.Hour},
+	} {
+		i := Info{Uptime: tc.uptime}
+		require.Equal(t, tc.out, i.Humanized(), "%v", tc.uptime)
+		require.Equal(t, tc.next, i.nextRollover(), "%v", tc.uptime)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visualizer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// source provides audio levels. Sources read continuously, but only keep
+// the latest data, and do the work of computing levels only when asked, so
+// that the CPU usage depends on the frame rate rather than the audio stream.
+type source interface {
+	// run reads from the source until stop is closed or an error occurs.
+	run(stop <-chan struct{}) error
+	// levels returns the latest levels for the given number of bars, each
+	// from 0 to 1, or nil if no data has been read yet.
+	levels(bars int) []float64
+}
+
+// cavaSource reads frames from cava's raw output, using
+//
+//	method = raw
+//	raw_target = <path>
+//	data_format = ascii
+//	ascii_max_range = <maxRange>
+type cavaSource struct {
+	path     string
+	maxRange int
+
+	mu   sync.Mutex
+	last string
+}
+
+func (c *cavaSource) run(stop <-chan struct{}) error {
+	// Opening a FIFO blocks until cava opens it for writing.
+	f, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-stop
+		f.Close()
+	}()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		c.mu.Lock()
+		c.last = s.Text()
+		c.mu.Unlock()
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return errors.New("cava stopped writing to " + c.path)
+}
+
+func (c *cavaSource) levels(bars int) []float64 {
+	c.mu.Lock()
+	line := c.last
+	c.mu.Unlock()
+	if line == "" {
+		return nil
+	}
+	var values []float64
+	for _, v := range strings.Split(strings.TrimSuffix(line, ";"), ";") {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil
+		}
+		values = append(values, clamp(float64(n)/float64(c.maxRange)))
+	}
+	return resample(values, bars)
+}
+
+// Audio captured from commands must be signed 16-bit little-endian mono.
+const (
+	sampleRate = 44100
+	windowSize = 1024
+	// Frequency range and loudness range shown by the bars.
+	minFreq, maxFreq = 50.0, 10000.0
+	minDB            = -60.0
+)
+
+// Overridden in tests.
+var execCommand = exec.Command
+
+// pcmSource runs a command that captures raw audio, and computes a spectrum
+// from the most recent window of samples.
+type pcmSource struct {
+	cmd []string
+
+	mu      sync.Mutex
+	samples [windowSize]int16
+	pos     int
+	filled  bool
+}
+
+func (p *pcmSource) run(stop <-chan struct{}) error {
+	cmd := execCommand(p.cmd[0], p.cmd[1:]...)
+	// Prevent SIGUSR for bar pause/resume from propagating to the
+	// child process, as in shell.Tail.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		<-stop
+		cmd.Process.Kill()
+	}()
+	r := bufio.NewReader(stdout)
+	buf := make([]byte, 512)
+	for {
+		n, err := io.ReadFull(r, buf)
+		p.add(buf[:n&^1])
+		if err != nil {
+			break
+		}
+	}
+	err = cmd.Wait()
+	if err == nil {
+		err = fmt.Errorf("%s exited", p.cmd[0])
+	}
+	return err
+}
+
+func (p *pcmSource) add(data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i+1 < len(data); i += 2 {
+		p.samples[p.pos] = int16(binary.LittleEndian.Uint16(data[i:]))
+		p.pos = (p.pos + 1) % windowSize
+		if p.pos == 0 {
+			p.filled = true
+		}
+	}
+}
+
+func (p *pcmSource) levels(bars int) []float64 {
+	p.mu.Lock()
+	if !p.filled {
+		p.mu.Unlock()
+		return nil
+	}
+	window := make([]complex128, windowSize)
+	for i := range window {
+		s := float64(p.samples[(p.pos+i)%windowSize]) / 32768
+		// Hann window, to reduce leakage between frequency bins.
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(windowSize-1))
+		window[i] = complex(s*w, 0)
+	}
+	p.mu.Unlock()
+	fft(window)
+	return spectrum(window, bars)
+}
+
+// spectrum groups the bins of an FFT into logarithmically spaced bands, and
+// returns the loudness of each band from 0 (minDB or quieter) to 1 (full
+// scale).
+func spectrum(bins []complex128, bars int) []float64 {
+	if bars <= 0 {
+		return nil
+	}
+	binWidth := float64(sampleRate) / float64(len(bins))
+	out := make([]float64, bars)
+	for b := range out {
+		lo := minFreq * math.Pow(maxFreq/minFreq, float64(b)/float64(bars))
+		hi := minFreq * math.Pow(maxFreq/minFreq, float64(b+1)/float64(bars))
+		from, to := int(lo/binWidth), int(hi/binWidth)
+		if to <= from {
+			to = from + 1
+		}
+		peak := 0.0
+		for i := from; i < to && i < len(bins)/2; i++ {
+			// The Hann window halves the amplitude of a sine wave.
+			if m := 4 * cmplx.Abs(bins[i]) / float64(len(bins)); m > peak {
+				peak = m
+			}
+		}
+		if peak > 0 {
+			out[b] = clamp((20*math.Log10(peak) - minDB) / -minDB)
+		}
+	}
+	return out
+}
+
+// fft computes the discrete Fourier transform of x in place, using the
+// iterative radix-2 Cooley-Tukey algorithm. len(x) must be a power of 2.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// resample averages (or repeats) values to fit the given number of bars.
+func resample(values []float64, bars int) []float64 {
+	if len(values) == 0 || bars <= 0 {
+		return nil
+	}
+	out := make([]float64, bars)
+	for b := range out {
+		from := b * len(values) / bars
+		to := (b + 1) * len(values) / bars
+		if to <= from {
+			to = from + 1
+		}
+		sum := 0.0
+		for _, v := range values[from:to] {
+			sum += v
+		}
+		out[b] = sum / float64(to-from)
+	}
+	return out
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,169 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visualizer
+
+import (
+	"encoding/binary"
+	"math"
+	"math/cmplx"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sine(freq, amplitude float64, count int) []int16 {
+	out := make([]int16, count)
+	for i := range out {
+		out[i] = int16(amplitude * 32767 * math.Sin(2*math.Pi*freq*float64(i)/sampleRate))
+	}
+	return out
+}
+
+func encode(samples []int16) []byte {
+	out := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(out[2*i:], uint16(s))
+	}
+	return out
+}
+
+func TestFFT(t *testing.T) {
+	x := make([]complex128, 8)
+	x[0] = 1
+	fft(x)
+	for i, v := range x {
+		require.InDelta(t, 1, cmplx.Abs(v), 1e-9, "impulse has a flat spectrum (bin %d)", i)
+	}
+
+	x = make([]complex128, 64)
+	for i := range x {
+		x[i] = complex(math.Cos(2*math.Pi*5*float64(i)/64), 0)
+	}
+	fft(x)
+	for i, v := range x {
+		exp := 0.0
+		if i == 5 || i == 59 {
+			exp = 32
+		}
+		require.InDelta(t, exp, cmplx.Abs(v), 1e-9, "bin %d", i)
+	}
+}
+
+func TestSpectrum(t *testing.T) {
+	p := &pcmSource{}
+	require.Nil(t, p.levels(8), "without data")
+
+	p.add(encode(make([]int16, windowSize)))
+	require.Equal(t, make([]float64, 8), p.levels(8), "silence")
+
+	p.add(encode(sine(1000, 1, windowSize)))
+	levels := p.levels(8)
+	// 1kHz is in the fifth of 8 logarithmic bands from 50Hz to 10kHz.
+	loudest := 0
+	for i, l := range levels {
+		if l > levels[loudest] {
+			loudest = i
+		}
+	}
+	require.Equal(t, 4, loudest)
+	require.InDelta(t, 1, levels[4], 0.1, "full scale sine")
+	require.Less(t, levels[0], 0.5, "low frequencies")
+	require.Less(t, levels[7], 0.5, "high frequencies")
+
+	p.add(encode(sine(1000, 0.01, windowSize)))
+	require.InDelta(t, 1.0/3, p.levels(8)[4], 0.1, "-40dB sine")
+
+	require.Nil(t, spectrum(nil, 0))
+}
+
+func TestResample(t *testing.T) {
+	require.Nil(t, resample(nil, 4))
+	require.Nil(t, resample([]float64{1}, 0))
+	require.Equal(t, []float64{0.5, 0.25}, resample([]float64{1, 0, 0.5, 0}, 2))
+	require.Equal(t, []float64{1, 1, 0, 0}, resample([]float64{1, 0}, 4))
+	require.Equal(t, []float64{0.2, 0.4}, resample([]float64{0.2, 0.4}, 2))
+}
+
+// waitFor waits for the cava source to read the data written to the FIFO.
+func waitFor(t *testing.T, cond func() bool) {
+	for start := time.Now(); !cond(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			require.Fail(t, "timed out waiting for cava data")
+		}
+	}
+}
+
+func TestCavaSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cava.fifo")
+	require.NoError(t, syscall.Mkfifo(path, 0600))
+	c := &cavaSource{path: path, maxRange: 1000}
+	require.Nil(t, c.levels(4), "without data")
+
+	errs := make(chan error, 1)
+	stop := make(chan struct{})
+	go func() { errs <- c.run(stop) }()
+	w, err := os.OpenFile(path, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	w.Write([]byte("0;1000;500;250;\n"))
+	waitFor(t, func() bool { return c.levels(4) != nil })
+	require.Equal(t, []float64{0, 1, 0.5, 0.25}, c.levels(4))
+	require.Equal(t, []float64{0.5, 0.375}, c.levels(2))
+
+	w.Write([]byte("2000;x;\n"))
+	waitFor(t, func() bool { return c.levels(4) == nil })
+
+	w.Close()
+	require.Error(t, <-errs, "when cava exits")
+
+	require.Error(t, (&cavaSource{path: filepath.Join(t.TempDir(), "missing")}).run(stop))
+	close(stop)
+}
+
+func TestPCMSource(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audio.raw")
+	require.NoError(t, os.WriteFile(file, encode(sine(1000, 1, 2*windowSize)), 0644))
+	var cmds [][]string
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		cmds = append(cmds, append([]string{name}, args...))
+		return exec.Command("cat", file)
+	}
+	defer func() { execCommand = exec.Command }()
+
+	p := &pcmSource{cmd: []string{"pw-record", "-"}}
+	require.Error(t, p.run(nil), "when capture exits")
+	require.Equal(t, [][]string{{"pw-record", "-"}}, cmds)
+	require.InDelta(t, 1, p.levels(8)[4], 0.1)
+
+	execCommand = exec.Command
+	p = &pcmSource{cmd: []string{"/nonexistent/capture"}}
+	require.Error(t, p.run(nil), "missing command")
+
+	p = &pcmSource{cmd: []string{"sleep", "10"}}
+	stop := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() { errs <- p.run(stop) }()
+	close(stop)
+	select {
+	case err := <-errs:
+		require.Error(t, err, "killed")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "capture not stopped")
+	}
+}
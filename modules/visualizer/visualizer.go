@@ -0,0 +1,215 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package visualizer provides a bar module that shows a compact spectrum of
+// the audio being played, using block or braille characters.
+//
+// Audio levels are read either from cava's raw output, or computed from the
+// audio captured by a command, such as pw-record for the PipeWire default
+// output. The module only renders at the configured frame rate (15 fps by
+// default), and does not update while nothing is playing.
+package visualizer // import "barista.run/modules/visualizer"
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+	"barista.run/timing"
+)
+
+// Info represents a single frame of the visualizer.
+type Info struct {
+	// Levels contains the level of each bar, from 0 to 1.
+	Levels []float64
+}
+
+// Peak returns the highest level of all bars.
+func (i Info) Peak() float64 {
+	peak := 0.0
+	for _, l := range i.Levels {
+		peak = math.Max(peak, l)
+	}
+	return peak
+}
+
+// Silent returns true if all bars are (nearly) empty.
+func (i Info) Silent() bool {
+	return i.Peak() < 1.0/16
+}
+
+var blocks = []rune(" ▁▂▃▄▅▆▇█")
+
+// Blocks renders the levels using one block character per bar.
+func (i Info) Blocks() string {
+	var s strings.Builder
+	for _, l := range i.Levels {
+		s.WriteRune(blocks[int(math.Round(clamp(l)*8))])
+	}
+	return s.String()
+}
+
+// Braille dots for each column, from the bottom up.
+var brailleDots = [2][4]rune{
+	{0x40, 0x04, 0x02, 0x01},
+	{0x80, 0x20, 0x10, 0x08},
+}
+
+// Braille renders the levels using braille characters, which fit two bars
+// in each character at a lower vertical resolution.
+func (i Info) Braille() string {
+	var s strings.Builder
+	for c := 0; c < len(i.Levels); c += 2 {
+		r := rune(0x2800)
+		for col := 0; col < 2 && c+col < len(i.Levels); col++ {
+			height := int(math.Round(clamp(i.Levels[c+col]) * 4))
+			for row := 0; row < height; row++ {
+				r |= brailleDots[col][row]
+			}
+		}
+		s.WriteRune(r)
+	}
+	return s.String()
+}
+
+// Module represents a bar module that shows an audio visualizer.
+type Module struct {
+	source     source
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	bars       value.Value     // of int
+	scheduler  *timing.Scheduler
+}
+
+func newModule(s source) *Module {
+	m := &Module{source: s, scheduler: timing.NewScheduler()}
+	l.Register(m, "outputFunc", "bars", "scheduler")
+	m.Bars(8)
+	m.FrameRate(15)
+	m.Output(func(i Info) bar.Output {
+		if i.Silent() {
+			return nil
+		}
+		return outputs.Text(i.Blocks())
+	})
+	return m
+}
+
+// Cava constructs a visualizer that reads cava's raw output from the given
+// FIFO. cava must be configured with 'method = raw', 'raw_target' set to the
+// path, 'data_format = ascii', and 'ascii_max_range' set to maxRange (1000
+// by default). The bars from cava are combined to fit the module's bars.
+func Cava(fifoPath string, maxRange int) *Module {
+	m := newModule(&cavaSource{path: fifoPath, maxRange: maxRange})
+	l.Label(m, fifoPath)
+	return m
+}
+
+// PipeWire constructs a visualizer for the default PipeWire audio output,
+// using pw-record to capture it.
+func PipeWire() *Module {
+	return Capture("pw-record", "--raw", "--format", "s16", "--rate", "44100",
+		"--channels", "1", "-P", "{ stream.capture.sink = true }", "-")
+}
+
+// Capture constructs a visualizer that runs a command to capture audio. The
+// command must write signed 16-bit little-endian mono audio at 44.1kHz to
+// standard output, e.g. "parec --raw --format=s16le --rate=44100 --channels=1
+// --device=@DEFAULT_MONITOR@" for PulseAudio.
+func Capture(cmd string, args ...string) *Module {
+	m := newModule(&pcmSource{cmd: append([]string{cmd}, args...)})
+	l.Label(m, cmd)
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Bars sets the number of bars in the visualizer.
+func (m *Module) Bars(bars int) *Module {
+	m.bars.Set(bars)
+	return m
+}
+
+// maxFrameRate limits updates to the bar, which usually redraws all modules
+// on each update.
+const maxFrameRate = 30
+
+// FrameRate sets how many times per second the visualizer is updated, up to
+// a maximum of 30.
+func (m *Module) FrameRate(fps int) *Module {
+	if fps > maxFrameRate {
+		fps = maxFrameRate
+	}
+	if fps < 1 {
+		fps = 1
+	}
+	m.scheduler.Every(time.Second / time.Duration(fps))
+	return m
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	stop := make(chan struct{})
+	defer close(stop)
+	errCh := make(chan error, 1)
+	go func() { errCh <- m.source.run(stop) }()
+
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextBars, done := m.bars.Subscribe()
+	defer done()
+
+	var last Info
+	silent, started := false, false
+	for {
+		select {
+		case err := <-errCh:
+			sink.Error(err)
+			return
+		case <-m.scheduler.C:
+		case <-nextBars:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+			started = false
+		}
+		i := Info{Levels: m.source.levels(m.bars.Get().(int))}
+		// Skip identical frames, and all but the first silent frame.
+		if started && (equal(i.Levels, last.Levels) || silent && i.Silent()) {
+			continue
+		}
+		sink.Output(outputFunc(i))
+		last, silent, started = i, i.Silent(), true
+	}
+}
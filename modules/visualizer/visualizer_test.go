@@ -0,0 +1,140 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visualizer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRendering(t *testing.T) {
+	i := Info{Levels: []float64{0, 0.125, 0.5, 1, 1.5, -1}}
+	require.Equal(t, " ▁▄██ ", i.Blocks())
+	require.Equal(t, "⢀⣼⡇", i.Braille())
+	require.Equal(t, 1.5, i.Peak())
+	require.False(t, i.Silent())
+
+	require.Equal(t, "⡀", Info{Levels: []float64{0.25}}.Braille(), "odd number of bars")
+	require.Equal(t, "", Info{}.Blocks())
+	require.True(t, Info{}.Silent())
+	require.True(t, Info{Levels: []float64{0.05, 0}}.Silent())
+}
+
+type fakeSource struct {
+	sync.Mutex
+	values  []float64
+	bars    chan int
+	errCh   chan error
+	stopped chan struct{}
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		bars:    make(chan int, 100),
+		errCh:   make(chan error),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (f *fakeSource) run(stop <-chan struct{}) error {
+	select {
+	case err := <-f.errCh:
+		return err
+	case <-stop:
+		close(f.stopped)
+		return nil
+	}
+}
+
+func (f *fakeSource) levels(bars int) []float64 {
+	f.Lock()
+	defer f.Unlock()
+	select {
+	case f.bars <- bars:
+	default:
+	}
+	return resample(f.values, bars)
+}
+
+func (f *fakeSource) set(values ...float64) {
+	f.Lock()
+	defer f.Unlock()
+	f.values = values
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	src := newFakeSource()
+	m := newModule(src).Bars(4)
+	testBar.Run(m)
+	testBar.AssertNoOutput("before first frame")
+
+	testBar.Tick()
+	testBar.NextOutput("first frame").AssertEmpty("silent")
+	testBar.Tick()
+	testBar.AssertNoOutput("while silent")
+
+	src.set(0.5, 1, 0.25, 0)
+	start := testBar.Tick()
+	testBar.NextOutput("on audio").AssertText([]string{"▄█▂ "})
+	next := testBar.Tick()
+	require.Equal(t, time.Second/15, next.Sub(start), "default frame rate")
+	testBar.AssertNoOutput("identical frame")
+
+	src.set(1, 0.5)
+	testBar.Tick()
+	testBar.NextOutput("on change").AssertText([]string{"██▄▄"})
+
+	m.Bars(2)
+	testBar.NextOutput("on bars change").AssertText([]string{"█▄"})
+
+	m.FrameRate(100)
+	start = testBar.Tick()
+	require.Equal(t, time.Second/30, testBar.Tick().Sub(start), "limited frame rate")
+	m.FrameRate(0)
+	start = testBar.Tick()
+	require.Equal(t, time.Second, testBar.Tick().Sub(start), "at least 1 fps")
+
+	m.Output(func(i Info) bar.Output { return outputs.Text(i.Braille()) })
+	testBar.NextOutput("on output change").AssertText([]string{"⣧"})
+
+	src.set(0, 0)
+	testBar.Tick()
+	testBar.NextOutput("on silence").AssertText([]string{"⠀"})
+
+	src.errCh <- errors.New("cava exited")
+	testBar.NextOutput("on error").AssertError()
+}
+
+func TestConstructors(t *testing.T) {
+	c := Cava("/tmp/cava.fifo", 1000).source.(*cavaSource)
+	require.Equal(t, "/tmp/cava.fifo", c.path)
+	require.Equal(t, 1000, c.maxRange)
+
+	p := PipeWire().source.(*pcmSource)
+	require.Equal(t, "pw-record", p.cmd[0])
+	require.Equal(t, "-", p.cmd[len(p.cmd)-1], "writes to stdout")
+
+	p = Capture("parec", "--raw").source.(*pcmSource)
+	require.Equal(t, []string{"parec", "--raw"}, p.cmd)
+}
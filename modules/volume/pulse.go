@@ -18,6 +18,7 @@ import (
 	"C"
 	"fmt"
 	"os"
+	"strings"
 
 	"barista.run/base/value"
 	l "barista.run/logging"
@@ -31,7 +32,8 @@ type paModule struct {
 }
 
 type paController struct {
-	sink dbus.BusObject
+	obj   dbus.BusObject
+	iface string
 }
 
 func dialAndAuth(addr string) (*dbus.Conn, error) {
@@ -95,25 +97,76 @@ func DefaultSink() *Module {
 }
 
 func (c *paController) setVolume(newVol int64) error {
-	return c.sink.Call(
-		"org.freedesktop.DBus.Properties.Set",
-		0,
-		"org.PulseAudio.Core1.Device",
-		"Volume",
-		dbus.MakeVariant([]uint32{uint32(newVol)}),
-	).Err
+	return setProperty(c.obj, c.iface, "Volume", []uint32{uint32(newVol)})
 }
 
 func (c *paController) setMuted(muted bool) error {
-	return c.sink.Call(
+	return setProperty(c.obj, c.iface, "Mute", muted)
+}
+
+func setProperty(obj dbus.BusObject, iface, name string, value interface{}) error {
+	return obj.Call(
 		"org.freedesktop.DBus.Properties.Set",
 		0,
-		"org.PulseAudio.Core1.Device",
-		"Mute",
-		dbus.MakeVariant(muted),
+		iface,
+		name,
+		dbus.MakeVariant(value),
 	).Err
 }
 
+// paSinkController also supports switching the output device.
+type paSinkController struct {
+	paController
+	conn *dbus.Conn
+	core dbus.BusObject
+}
+
+// paDevice identifies a PulseAudio output device. Either sink (and port, if
+// the sink has ports) is set, or card and profile for a card profile that
+// needs to be activated before its sink is available.
+type paDevice struct {
+	sink, port    dbus.ObjectPath
+	card, profile dbus.ObjectPath
+}
+
+func (c *paSinkController) setDevice(device Device) error {
+	d, ok := device.id.(paDevice)
+	if !ok {
+		return fmt.Errorf("unknown device %q", device.Description)
+	}
+	sinkPath := d.sink
+	if d.profile != "" {
+		card := c.conn.Object("org.PulseAudio.Core1.Card", d.card)
+		err := setProperty(card, "org.PulseAudio.Core1.Card", "ActiveProfile", d.profile)
+		if err != nil {
+			return err
+		}
+		sinks := getPaths(card, "org.PulseAudio.Core1.Card.Sinks")
+		if len(sinks) == 0 {
+			return fmt.Errorf("no sinks for %q", device.Description)
+		}
+		sinkPath = sinks[0]
+	}
+	if d.port != "" {
+		sink := c.conn.Object("org.PulseAudio.Core1.Sink", sinkPath)
+		err := setProperty(sink, "org.PulseAudio.Core1.Device", "ActivePort", d.port)
+		if err != nil {
+			return err
+		}
+	}
+	err := setProperty(c.core, "org.PulseAudio.Core1", "FallbackSink", sinkPath)
+	if err != nil {
+		return err
+	}
+	// The fallback sink is only used for new streams, so move existing streams
+	// as well. Not all streams can be moved, so errors are ignored.
+	for _, path := range getPaths(c.core, "org.PulseAudio.Core1.PlaybackStreams") {
+		c.conn.Object("org.PulseAudio.Core1.Stream", path).
+			Call("org.PulseAudio.Core1.Stream.Move", 0, sinkPath)
+	}
+	return nil
+}
+
 func listen(core dbus.BusObject, signal string, objects ...dbus.ObjectPath) error {
 	return core.Call(
 		"org.PulseAudio.Core1.ListenForSignal",
@@ -158,10 +211,19 @@ func getVolume(sink dbus.BusObject) (Volume, error) {
 	}
 	v.Max = int64(max.Value().(uint32))
 
-	vol, err := sink.GetProperty("org.PulseAudio.Core1.Device.Volume")
+	v.Vol, v.Mute, err = getVolumeAndMute(sink, "org.PulseAudio.Core1.Device")
 	if err != nil {
 		return v, err
 	}
+	v.controller = &paController{sink, "org.PulseAudio.Core1.Device"}
+	return v, nil
+}
+
+func getVolumeAndMute(obj dbus.BusObject, iface string) (int64, bool, error) {
+	vol, err := obj.GetProperty(iface + ".Volume")
+	if err != nil {
+		return 0, false, err
+	}
 
 	// Take the volume as the average across all channels.
 	var totalVol int64
@@ -169,15 +231,236 @@ func getVolume(sink dbus.BusObject) (Volume, error) {
 	for _, ch := range channels {
 		totalVol += int64(ch)
 	}
-	v.Vol = totalVol / int64(len(channels))
+	if len(channels) > 0 {
+		totalVol /= int64(len(channels))
+	}
+
+	mute, err := obj.GetProperty(iface + ".Mute")
+	if err != nil {
+		return 0, false, err
+	}
+	return totalVol, mute.Value().(bool), nil
+}
+
+// Stream volumes are not relative to a base volume, so use PA_VOLUME_NORM
+// (100%) as the maximum.
+const paVolumeNorm = 0x10000
+
+// getStreams returns the playback streams on the given sink.
+func getStreams(conn *dbus.Conn, core dbus.BusObject, sinkPath dbus.ObjectPath) ([]Stream, error) {
+	paths, err := core.GetProperty("org.PulseAudio.Core1.PlaybackStreams")
+	if err != nil {
+		return nil, err
+	}
+	var streams []Stream
+	for _, path := range paths.Value().([]dbus.ObjectPath) {
+		obj := conn.Object("org.PulseAudio.Core1.Stream", path)
+		// Errors are ignored, since streams can disappear at any time.
+		dev, err := obj.GetProperty("org.PulseAudio.Core1.Stream.Device")
+		if err != nil || dev.Value() != sinkPath {
+			continue
+		}
+		s := Stream{Name: streamName(obj)}
+		s.Max = paVolumeNorm
+		s.Vol, s.Mute, err = getVolumeAndMute(obj, "org.PulseAudio.Core1.Stream")
+		if err != nil {
+			continue
+		}
+		s.controller = &paController{obj, "org.PulseAudio.Core1.Stream"}
+		streams = append(streams, s)
+	}
+	return streams, nil
+}
+
+// streamName returns the application name from a stream's property list.
+func streamName(obj dbus.BusObject) string {
+	props := getPropertyList(obj, "org.PulseAudio.Core1.Stream")
+	if name := props["application.name"]; name != "" {
+		return name
+	}
+	return props["media.name"]
+}
 
-	mute, err := sink.GetProperty("org.PulseAudio.Core1.Device.Mute")
+// getDevices returns the device for the given sink, and all output devices.
+// This includes the available ports of each sink, and output profiles of
+// cards that would add a new sink.
+func getDevices(conn *dbus.Conn, core, current dbus.BusObject) (Device, []Device, error) {
+	sinks, err := core.GetProperty("org.PulseAudio.Core1.Sinks")
+	if err != nil {
+		return Device{}, nil, err
+	}
+	var active Device
+	var devices []Device
+	for _, path := range sinks.Value().([]dbus.ObjectPath) {
+		sink := conn.Object("org.PulseAudio.Core1.Sink", path)
+		sinkDevices, activeIdx := getSinkDevices(conn, sink)
+		if path == current.Path() && activeIdx >= 0 {
+			active = sinkDevices[activeIdx]
+		}
+		devices = append(devices, sinkDevices...)
+	}
+	for _, path := range getPaths(core, "org.PulseAudio.Core1.Cards") {
+		devices = append(devices, getProfileDevices(conn, path)...)
+	}
+	return active, devices, nil
+}
+
+// getSinkDevices returns a device for each available port of the sink, and
+// the index of the active port.
+func getSinkDevices(conn *dbus.Conn, sink dbus.BusObject) ([]Device, int) {
+	props := getPropertyList(sink, "org.PulseAudio.Core1.Device")
+	desc := props["device.description"]
+	if desc == "" {
+		desc = getString(sink, "org.PulseAudio.Core1.Device.Name")
+	}
+	icon := props["device.icon_name"]
+	if icon == "" {
+		icon = "audio-card"
+	}
+	ports := getPaths(sink, "org.PulseAudio.Core1.Device.Ports")
+	if len(ports) == 0 {
+		return []Device{{
+			Description: desc,
+			Icon:        icon,
+			id:          paDevice{sink: sink.Path()},
+		}}, 0
+	}
+	activePort, _ := sink.GetProperty("org.PulseAudio.Core1.Device.ActivePort")
+	var devices []Device
+	active := -1
+	for _, path := range ports {
+		port := conn.Object("org.PulseAudio.Core1.DevicePort", path)
+		isActive := activePort.Value() == path
+		// Skip ports that are known to be unavailable, e.g. unplugged
+		// headphones. An available value of 1 is PA_PORT_AVAILABLE_NO.
+		avail, err := port.GetProperty("org.PulseAudio.Core1.DevicePort.Available")
+		if err == nil && avail.Value() == uint32(1) && !isActive {
+			continue
+		}
+		if isActive {
+			active = len(devices)
+		}
+		portDesc := getString(port, "org.PulseAudio.Core1.DevicePort.Description")
+		if portDesc == "" {
+			portDesc = desc
+		}
+		portName := getString(port, "org.PulseAudio.Core1.DevicePort.Name")
+		devices = append(devices, Device{
+			Description: portDesc,
+			Icon:        iconFor(portName, icon),
+			id:          paDevice{sink: sink.Path(), port: path},
+		})
+	}
+	return devices, active
+}
+
+// getProfileDevices returns a device for each inactive output-only profile
+// of the card, excluding profiles whose output is provided by the active
+// profile (e.g. output:analog-stereo when the active profile is
+// output:analog-stereo+input:analog-stereo).
+func getProfileDevices(conn *dbus.Conn, cardPath dbus.ObjectPath) []Device {
+	card := conn.Object("org.PulseAudio.Core1.Card", cardPath)
+	activeProfile, err := card.GetProperty("org.PulseAudio.Core1.Card.ActiveProfile")
+	if err != nil {
+		return nil
+	}
+	activePath, _ := activeProfile.Value().(dbus.ObjectPath)
+	activeName := getString(
+		conn.Object("org.PulseAudio.Core1.CardProfile", activePath),
+		"org.PulseAudio.Core1.CardProfile.Name")
+	var devices []Device
+	for _, path := range getPaths(card, "org.PulseAudio.Core1.Card.Profiles") {
+		if path == activePath {
+			continue
+		}
+		profile := conn.Object("org.PulseAudio.Core1.CardProfile", path)
+		name := getString(profile, "org.PulseAudio.Core1.CardProfile.Name")
+		sinks, _ := profile.GetProperty("org.PulseAudio.Core1.CardProfile.Sinks")
+		sources, _ := profile.GetProperty("org.PulseAudio.Core1.CardProfile.Sources")
+		numSinks, _ := sinks.Value().(uint32)
+		numSources, _ := sources.Value().(uint32)
+		if numSinks == 0 || numSources > 0 ||
+			name == "" || strings.HasPrefix(activeName, name+"+") {
+			continue
+		}
+		devices = append(devices, Device{
+			Description: getString(profile, "org.PulseAudio.Core1.CardProfile.Description"),
+			Icon:        iconFor(name, "audio-card"),
+			id:          paDevice{card: cardPath, profile: path},
+		})
+	}
+	return devices
+}
+
+// iconFor returns an icon name based on a port or profile name, falling
+// back to the given icon if the type of output is unknown.
+func iconFor(name, fallback string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.Contains(name, "headphone"), strings.Contains(name, "headset"):
+		return "audio-headphones"
+	case strings.Contains(name, "hdmi"), strings.Contains(name, "displayport"):
+		return "video-display"
+	case strings.Contains(name, "speaker"):
+		return "audio-speakers"
+	}
+	return fallback
+}
+
+func getString(obj dbus.BusObject, prop string) string {
+	v, err := obj.GetProperty(prop)
+	if err != nil {
+		return ""
+	}
+	s, _ := v.Value().(string)
+	return s
+}
+
+func getPaths(obj dbus.BusObject, prop string) []dbus.ObjectPath {
+	v, err := obj.GetProperty(prop)
+	if err != nil {
+		return nil
+	}
+	paths, _ := v.Value().([]dbus.ObjectPath)
+	return paths
+}
+
+func getPropertyList(obj dbus.BusObject, iface string) map[string]string {
+	v, err := obj.GetProperty(iface + ".PropertyList")
+	if err != nil {
+		return nil
+	}
+	propList, _ := v.Value().(map[string][]byte)
+	r := map[string]string{}
+	for k, val := range propList {
+		// Property values are null-terminated strings.
+		r[k] = strings.TrimRight(string(val), "\x00")
+	}
+	return r
+}
+
+func getState(conn *dbus.Conn, core, sink dbus.BusObject) (Volume, error) {
+	v, err := getVolume(sink)
 	if err != nil {
 		return v, err
 	}
-	v.Mute = mute.Value().(bool)
-	v.controller = &paController{sink}
-	return v, nil
+	v.controller = &paSinkController{
+		paController{sink, "org.PulseAudio.Core1.Device"}, conn, core}
+	v.Streams, err = getStreams(conn, core, sink.Path())
+	if err != nil {
+		return v, err
+	}
+	v.Device, v.Devices, err = getDevices(conn, core, sink)
+	return v, err
+}
+
+func listenAll(core dbus.BusObject, signals ...string) error {
+	for _, signal := range signals {
+		if err := listen(core, signal); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (m *paModule) worker(s *value.ErrorValue) {
@@ -194,14 +477,29 @@ func (m *paModule) worker(s *value.ErrorValue) {
 		sink, err = openSinkByName(conn, core, m.sinkName)
 	} else {
 		sink, err = openFallbackSink(conn, core)
-		if err != nil {
+		if err == nil {
 			err = listen(core, "FallbackSinkUpdated")
 		}
 	}
+	if err == nil {
+		err = listenAll(core,
+			"NewPlaybackStream",
+			"PlaybackStreamRemoved",
+			"Stream.DeviceUpdated",
+			"Stream.VolumeUpdated",
+			"Stream.MuteUpdated",
+			"NewSink",
+			"SinkRemoved",
+			"Device.ActivePortUpdated",
+			"NewCard",
+			"CardRemoved",
+			"Card.ActiveProfileUpdated",
+		)
+	}
 	if s.Error(err) {
 		return
 	}
-	if s.SetOrError(getVolume(sink)) {
+	if s.SetOrError(getState(conn, core, sink)) {
 		return
 	}
 
@@ -210,15 +508,25 @@ func (m *paModule) worker(s *value.ErrorValue) {
 
 	// Listen for signals from D-Bus, and update appropriately.
 	for signal := range signals {
-		// If the fallback sink changed, open the new one.
-		if m.sinkName == "" && signal.Path == core.Path() {
+		// If the fallback sink changed or was removed, open the new one.
+		if m.sinkName == "" && fallbackSinkChanged(signal, sink) {
 			sink, err = openFallbackSink(conn, core)
 			if s.Error(err) {
 				return
 			}
 		}
-		if s.SetOrError(getVolume(sink)) {
+		if s.SetOrError(getState(conn, core, sink)) {
 			return
 		}
 	}
 }
+
+func fallbackSinkChanged(signal *dbus.Signal, sink dbus.BusObject) bool {
+	switch signal.Name {
+	case "org.PulseAudio.Core1.FallbackSinkUpdated":
+		return true
+	case "org.PulseAudio.Core1.SinkRemoved":
+		return len(signal.Body) > 0 && signal.Body[0] == sink.Path()
+	}
+	return false
+}
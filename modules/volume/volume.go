@@ -17,11 +17,14 @@
 package volume // import "barista.run/modules/volume"
 
 import (
+	"fmt"
 	"time"
 
 	"barista.run/bar"
 	"barista.run/base/value"
+	"barista.run/core"
 	l "barista.run/logging"
+	"barista.run/osd"
 	"barista.run/outputs"
 
 	"golang.org/x/time/rate"
@@ -31,8 +34,33 @@ import (
 type Volume struct {
 	Min, Max, Vol int64
 	Mute          bool
-	controller    controller
-	update        func(Volume)
+	// Per-application playback streams on the device. Only supported by the
+	// PulseAudio backend (which includes PipeWire's PulseAudio server).
+	Streams []Stream
+	// The output device for the volume, and all available output devices.
+	// Only supported by the PulseAudio backend.
+	Device     Device
+	Devices    []Device
+	controller controller
+	update     func(Volume)
+}
+
+// Device represents an audio output device, such as speakers, headphones, or
+// an HDMI output.
+type Device struct {
+	// Human-readable description, e.g. "Headphones".
+	Description string
+	// Freedesktop icon name for the device, e.g. "audio-headphones".
+	Icon string
+	id   interface{} // backend-specific, must be comparable.
+}
+
+// Stream represents the volume and mute state of a single application's
+// playback stream, which can be controlled independently of the device.
+type Stream struct {
+	// Name of the application that owns the stream.
+	Name string
+	Volume
 }
 
 // Frac returns the current volume as a fraction of the total range.
@@ -78,11 +106,45 @@ func (v Volume) SetMuted(muted bool) {
 	v.update(v)
 }
 
+// SetDevice switches audio output to the given device, which must be one of
+// the available Devices. Only modules that follow the default device (e.g.
+// DefaultSink) will switch to displaying the volume of the new device.
+func (v Volume) SetDevice(device Device) {
+	c, ok := v.controller.(deviceController)
+	if !ok || device == v.Device {
+		return
+	}
+	if err := c.setDevice(device); err != nil {
+		l.Log("Error switching output device: %v", err)
+	}
+}
+
+// NextDevice switches audio output to the next available device, wrapping
+// around at the end of the list.
+func (v Volume) NextDevice() {
+	if len(v.Devices) == 0 {
+		return
+	}
+	next := 0
+	for i, d := range v.Devices {
+		if d == v.Device {
+			next = (i + 1) % len(v.Devices)
+		}
+	}
+	v.SetDevice(v.Devices[next])
+}
+
 type controller interface {
 	setVolume(int64) error
 	setMuted(bool) error
 }
 
+// deviceController is implemented by controllers that support switching
+// the output device.
+type deviceController interface {
+	setDevice(Device) error
+}
+
 // Interface that must be implemented by individual volume implementations.
 type moduleImpl interface {
 	// Infinite loop: push updates and errors to the provided ErrorValue.
@@ -91,7 +153,8 @@ type moduleImpl interface {
 
 // Module represents a bar.Module that displays volume information.
 type Module struct {
-	outputFunc value.Value // of func(Volume) bar.Output
+	outputFunc core.OutputFunc // of func(Volume) bar.Output
+	osd        value.Value     // of osd.Indicator
 	impl       moduleImpl
 }
 
@@ -102,11 +165,19 @@ func (m *Module) Output(outputFunc func(Volume) bar.Output) *Module {
 	return m
 }
 
+// OSD configures an on-screen display indicator that is shown whenever the
+// volume or mute state of the device changes after the module has started.
+func (m *Module) OSD(indicator osd.Indicator) *Module {
+	m.osd.Set(indicator)
+	return m
+}
+
 // Throttle volume updates to once every ~20ms to avoid unexpected behaviour.
 var rateLimiter = rate.NewLimiter(rate.Every(20*time.Millisecond), 1)
 
 // defaultClickHandler provides a simple example of the click handler capabilities.
-// It toggles mute on left click, and raises/lowers the volume on scroll.
+// It toggles mute on left click, switches to the next output device on right
+// click, and raises/lowers the volume on scroll.
 func defaultClickHandler(v Volume) func(bar.Event) {
 	return func(e bar.Event) {
 		if !rateLimiter.Allow() {
@@ -117,6 +188,10 @@ func defaultClickHandler(v Volume) func(bar.Event) {
 			v.SetMuted(!v.Mute)
 			return
 		}
+		if e.Button == bar.ButtonRight {
+			v.NextDevice()
+			return
+		}
 		volStep := (v.Max - v.Min) / 100
 		if volStep == 0 {
 			volStep = 1
@@ -143,14 +218,23 @@ func (m *Module) Stream(s bar.Sink) {
 	nextOutputFunc, done := m.outputFunc.Subscribe()
 	defer done()
 
+	var last Volume
+	hasLast := false
 	for {
 		if s.Error(err) {
 			return
 		}
 		if volume, ok := v.(Volume); ok {
-			volume.update = func(v Volume) { vol.Set(v) }
+			volume = withUpdate(volume, func(v Volume) { vol.Set(v) })
 			s.Output(outputs.Group(outputFunc(volume)).
 				OnClick(defaultClickHandler(volume)))
+			ind, ok := m.osd.Get().(osd.Indicator)
+			if ok && hasLast && volumeChanged(last, volume) {
+				if out := ind.Show(volumeEvent(volume)); out != nil {
+					s.Output(out)
+				}
+			}
+			last, hasLast = volume, true
 		}
 		select {
 		case <-nextV:
@@ -161,6 +245,38 @@ func (m *Module) Stream(s bar.Sink) {
 	}
 }
 
+// volumeChanged returns true if the volume or mute state of the same device
+// has changed. Switching devices does not show the indicator.
+func volumeChanged(last, v Volume) bool {
+	return last.Device == v.Device &&
+		(last.Vol != v.Vol || last.Mute != v.Mute)
+}
+
+func volumeEvent(v Volume) osd.Event {
+	text := fmt.Sprintf("%d%%", v.Pct())
+	if v.Mute {
+		text = "MUT"
+	}
+	return osd.Event{Kind: osd.Volume, Fraction: v.Frac(), Muted: v.Mute, Text: text}
+}
+
+// withUpdate sets the update function of the volume and its streams, so that
+// changes to a stream's volume also update the streams of the device volume.
+func withUpdate(v Volume, update func(Volume)) Volume {
+	v.update = update
+	v.Streams = append([]Stream(nil), v.Streams...)
+	for i := range v.Streams {
+		i := i
+		v.Streams[i].update = func(s Volume) {
+			newV := v
+			newV.Streams = append([]Stream(nil), v.Streams...)
+			newV.Streams[i].Volume = s
+			update(newV)
+		}
+	}
+	return v
+}
+
 // createModule creates a new module with the given backing implementation.
 func createModule(impl moduleImpl) *Module {
 	m := &Module{impl: impl}
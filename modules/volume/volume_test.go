@@ -16,14 +16,17 @@ package volume
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 
 	"barista.run/bar"
 	"barista.run/base/value"
+	"barista.run/osd"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
 
+	"github.com/stretchr/testify/require"
 	"golang.org/x/time/rate"
 )
 
@@ -183,3 +186,202 @@ func TestModule(t *testing.T) {
 
 	testBar.NextOutput("on error").AssertError()
 }
+
+type testStreamsImpl struct {
+	device, music, browser *testVolumeImpl
+}
+
+func (t *testStreamsImpl) worker(v *value.ErrorValue) {
+	v.Set(Volume{
+		Max: 100, Vol: 50, controller: t.device,
+		Streams: []Stream{
+			{Name: "Music", Volume: Volume{Max: 100, Vol: 30, controller: t.music}},
+			{Name: "Browser", Volume: Volume{Max: 100, Vol: 80, controller: t.browser}},
+		},
+	})
+}
+
+func TestStreams(t *testing.T) {
+	testBar.New(t)
+	oldRateLimiter := rateLimiter
+	defer func() { rateLimiter = oldRateLimiter }()
+	rateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	testImpl := &testStreamsImpl{&testVolumeImpl{}, &testVolumeImpl{}, &testVolumeImpl{}}
+	v := createModule(testImpl).Output(func(vol Volume) bar.Output {
+		out := outputs.Group(outputs.Textf("%d%%", vol.Pct()))
+		for _, s := range vol.Streams {
+			s := s
+			text := fmt.Sprintf("%s:%d%%", s.Name, s.Pct())
+			if s.Mute {
+				text = fmt.Sprintf("%s:MUT", s.Name)
+			}
+			out.Append(outputs.Text(text).OnClick(func(e bar.Event) {
+				switch e.Button {
+				case bar.ButtonLeft:
+					s.SetMuted(!s.Mute)
+				case bar.ScrollUp:
+					s.SetVolume(s.Vol + 5)
+				}
+			}))
+		}
+		return out
+	})
+	testBar.Run(v)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"50%", "Music:30%", "Browser:80%"})
+
+	out.At(1).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("on stream volume change")
+	out.AssertText([]string{"50%", "Music:35%", "Browser:80%"})
+	require.Equal(t, int64(35), testImpl.music.vol)
+
+	out.At(2).LeftClick()
+	out = testBar.NextOutput("on stream mute")
+	out.AssertText([]string{"50%", "Music:35%", "Browser:MUT"},
+		"keeps earlier stream changes")
+	require.True(t, testImpl.browser.mute)
+	require.False(t, testImpl.device.mute)
+
+	out.At(0).Click(bar.Event{Button: bar.ScrollUp})
+	out = testBar.NextOutput("on device volume change")
+	out.AssertText([]string{"51%", "Music:35%", "Browser:MUT"})
+	require.Equal(t, int64(51), testImpl.device.vol)
+	require.Equal(t, int64(35), testImpl.music.vol, "stream volume unchanged")
+}
+
+type testDevicesImpl struct {
+	*testVolumeImpl
+	devices []Device
+	current chan Device
+}
+
+func (t *testDevicesImpl) setDevice(d Device) error {
+	t.Lock()
+	defer t.Unlock()
+	if t.error != nil {
+		return t.error
+	}
+	t.current <- d
+	return nil
+}
+
+func (t *testDevicesImpl) worker(v *value.ErrorValue) {
+	for d := range t.current {
+		v.Set(Volume{Max: 100, Vol: 50, controller: t, Device: d, Devices: t.devices})
+	}
+}
+
+func TestDevices(t *testing.T) {
+	testBar.New(t)
+	oldRateLimiter := rateLimiter
+	defer func() { rateLimiter = oldRateLimiter }()
+	rateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	speakers := Device{Description: "Speakers", Icon: "audio-speakers", id: 1}
+	headphones := Device{Description: "Headphones", Icon: "audio-headphones", id: 2}
+	hdmi := Device{Description: "HDMI", Icon: "video-display", id: 3}
+	testImpl := &testDevicesImpl{
+		testVolumeImpl: &testVolumeImpl{},
+		devices:        []Device{speakers, headphones, hdmi},
+		current:        make(chan Device, 1),
+	}
+	testImpl.current <- headphones
+	v := createModule(testImpl).Output(func(vol Volume) bar.Output {
+		return outputs.Textf("%s (%s) %d%%", vol.Device.Description, vol.Device.Icon, vol.Pct())
+	})
+	testBar.Run(v)
+
+	out := testBar.NextOutput("on start")
+	out.AssertText([]string{"Headphones (audio-headphones) 50%"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	out = testBar.NextOutput("on device change")
+	out.AssertText([]string{"HDMI (video-display) 50%"})
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	out = testBar.NextOutput("on device change")
+	out.AssertText([]string{"Speakers (audio-speakers) 50%"}, "wraps around")
+
+	testImpl.setError(errors.New("foo"))
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	testBar.AssertNoOutput("error during device change")
+	testImpl.setError(nil)
+
+	v.Output(func(vol Volume) bar.Output {
+		return outputs.Text(vol.Device.Description).OnClick(func(bar.Event) {
+			vol.SetDevice(speakers)
+		})
+	})
+	out = testBar.NextOutput("on output format change")
+	out.At(0).LeftClick()
+	testBar.AssertNoOutput("device already active")
+}
+
+func TestNoDevices(t *testing.T) {
+	testBar.New(t)
+	oldRateLimiter := rateLimiter
+	defer func() { rateLimiter = oldRateLimiter }()
+	rateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	testImpl := &testVolumeImpl{max: 100, vol: 50, volChan: make(chan int64)}
+	testBar.Run(createModule(testImpl))
+	out := testBar.NextOutput("on start")
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	testBar.AssertNoOutput("no devices")
+}
+
+type testIndicator chan osd.Event
+
+func (t testIndicator) Show(e osd.Event) bar.Output {
+	t <- e
+	return nil
+}
+
+func TestOSD(t *testing.T) {
+	testBar.New(t)
+	testImpl := &testVolumeImpl{
+		min: 0, max: 100, vol: 40,
+		volChan: make(chan int64, 1), muteChan: make(chan bool, 1),
+	}
+	events := make(testIndicator, 10)
+	testBar.Run(createModule(testImpl).OSD(events))
+	testBar.NextOutput("on start").AssertText([]string{"40%"})
+	require.Empty(t, events, "no indicator on start")
+
+	testImpl.volChan <- 55
+	testBar.NextOutput("on volume change").AssertText([]string{"55%"})
+	require.Equal(t, osd.Event{Kind: osd.Volume, Fraction: 0.55, Text: "55%"}, <-events)
+
+	testImpl.muteChan <- true
+	testBar.NextOutput("on mute").AssertText([]string{"MUT"})
+	require.Equal(t, osd.Event{Kind: osd.Volume, Fraction: 0.55, Muted: true, Text: "MUT"}, <-events)
+
+	testImpl.muteChan <- true
+	testBar.NextOutput("on update").AssertText([]string{"MUT"})
+	require.Empty(t, events, "no indicator without change")
+}
+
+func TestOSDDeviceChange(t *testing.T) {
+	testBar.New(t)
+	oldRateLimiter := rateLimiter
+	defer func() { rateLimiter = oldRateLimiter }()
+	rateLimiter = rate.NewLimiter(rate.Inf, 0)
+
+	speakers := Device{Description: "Speakers", id: 1}
+	headphones := Device{Description: "Headphones", id: 2}
+	testImpl := &testDevicesImpl{
+		testVolumeImpl: &testVolumeImpl{},
+		devices:        []Device{speakers, headphones},
+		current:        make(chan Device, 1),
+	}
+	testImpl.current <- speakers
+	events := make(testIndicator, 10)
+	testBar.Run(createModule(testImpl).OSD(events))
+	out := testBar.NextOutput("on start")
+
+	out.At(0).Click(bar.Event{Button: bar.ButtonRight})
+	testBar.NextOutput("on device change").AssertText([]string{"50%"})
+	require.Empty(t, events, "no indicator when switching devices")
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vpn
+
+import (
+	"strings"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/watchers/netlink"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+)
+
+// Connection represents a single VPN connection.
+type Connection struct {
+	// Name is the NetworkManager connection name if available, otherwise the
+	// name of the interface.
+	Name string
+	// Interface is the network interface used by the connection, if known.
+	Interface string
+	State     State
+	// NetworkManager is true if the connection is managed by NetworkManager.
+	NetworkManager bool
+}
+
+// Info represents the state of all VPN connections.
+type Info struct {
+	Connections []Connection
+}
+
+// State returns the 'best' state of all connections, so the VPN is
+// considered connected if any connection is connected.
+func (i Info) State() State {
+	s := Disconnected
+	for _, c := range i.Connections {
+		if c.State > s {
+			s = c.State
+		}
+	}
+	return s
+}
+
+// Secure returns true if any VPN connection is connected.
+func (i Info) Secure() bool {
+	return i.State().Connected()
+}
+
+// Connected returns the names of all connected VPN connections.
+func (i Info) Connected() []string {
+	var names []string
+	for _, c := range i.Connections {
+		if c.State.Connected() {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// vpnPrefixes are the prefixes of interfaces that are considered VPNs.
+var vpnPrefixes = []string{"tun", "tap", "wg", "ppp"}
+
+func isVpnInterface(name string) bool {
+	for _, p := range vpnPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllModule represents a bar module that aggregates all VPN connections.
+type AllModule struct {
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+}
+
+// All constructs a VPN module that shows the status of all VPN interfaces
+// (tun, tap, wg, and ppp), and all VPN connections managed by NetworkManager.
+func All() *AllModule {
+	m := &AllModule{}
+	l.Register(m, "outputFunc")
+	// Default output is the connected VPNs, or 'exposed' if none are up.
+	m.Output(func(i Info) bar.Output {
+		if i.Secure() {
+			return outputs.Textf("secure: %s", strings.Join(i.Connected(), ", "))
+		}
+		return outputs.Text("exposed")
+	})
+	return m
+}
+
+// Output configures a module to display the output of a user-defined function.
+func (m *AllModule) Output(outputFunc func(Info) bar.Output) *AllModule {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Stream starts the module.
+func (m *AllModule) Stream(s bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+
+	notifyFn, nmUpdates := notifier.New()
+	nm := watchNetworkManager(notifyFn)
+	defer nm.close()
+
+	links := netlink.All()
+	nextLinks := links.Next()
+	info := getInfo(links.Get(), nm)
+	for {
+		s.Output(outputFunc(info))
+		select {
+		case <-nextLinks:
+			nextLinks = links.Next()
+			info = getInfo(links.Get(), nm)
+		case <-nmUpdates:
+			nm.update()
+			info = getInfo(links.Get(), nm)
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func getInfo(links []netlink.Link, nm *nmWatcher) Info {
+	i := Info{Connections: nm.connections()}
+	managed := map[string]bool{}
+	for _, c := range i.Connections {
+		if c.Interface != "" {
+			managed[c.Interface] = true
+		}
+	}
+	for _, link := range links {
+		if !isVpnInterface(link.Name) {
+			continue
+		}
+		if managed[link.Name] {
+			continue
+		}
+		i.Connections = append(i.Connections, Connection{
+			Name:      link.Name,
+			Interface: link.Name,
+			State:     getState(link.State),
+		})
+	}
+	return i
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vpn
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/netlink"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	godbus "github.com/godbus/dbus"
+)
+
+const wait = 500 * time.Millisecond
+
+func init() {
+	busType = dbus.Test
+}
+
+func connectionsOutput(i Info) bar.Output {
+	var conns []string
+	for _, c := range i.Connections {
+		conns = append(conns, strings.Join([]string{
+			c.Name, c.Interface, []string{"off", "wait", "on"}[c.State],
+		}, "|"))
+	}
+	return outputs.Textf("%v %s", i.Secure(), strings.Join(conns, " "))
+}
+
+func TestAllInterfaces(t *testing.T) {
+	nlt := netlink.TestMode()
+	dbus.SetupTestBus()
+	nlt.AddLink(netlink.Link{Name: "wlan0", State: netlink.Up})
+	tun := nlt.AddLink(netlink.Link{Name: "tun0", State: netlink.Down})
+
+	testBar.New(t)
+	m := All()
+	testBar.Run(m)
+	testBar.NextOutput("on start").AssertText([]string{"exposed"})
+
+	nlt.UpdateLink(tun, netlink.Link{Name: "tun0", State: netlink.Up})
+	testBar.NextOutput("on tun up").AssertText([]string{"secure: tun0"})
+
+	wg := nlt.AddLink(netlink.Link{Name: "wg0", State: netlink.Up})
+	testBar.NextOutput("on wg added").AssertText([]string{"secure: tun0, wg0"})
+
+	m.Output(connectionsOutput)
+	testBar.NextOutput("on output change").AssertText(
+		[]string{"true tun0|tun0|on wg0|wg0|on"})
+
+	nlt.RemoveLink(wg)
+	nlt.UpdateLink(tun, netlink.Link{Name: "tun0", State: netlink.Dormant})
+	testBar.Drain(wait, "on wg removed").AssertText([]string{"false tun0|tun0|wait"})
+}
+
+func TestNetworkManager(t *testing.T) {
+	nlt := netlink.TestMode()
+	bus := dbus.SetupTestBus()
+	nm := bus.RegisterService(nmService)
+	root := nm.Object(nmPath, nmIface)
+	root.SetProperty("ActiveConnections",
+		[]godbus.ObjectPath{"/active/1", "/active/2"}, dbus.SignalTypeNone)
+
+	wifi := nm.Object("/active/1", activeIface)
+	wifi.SetProperties(map[string]interface{}{
+		"Id": "Home", "Type": "802-11-wireless", "Vpn": false, "State": uint32(2),
+		"Devices": []godbus.ObjectPath{"/devices/1"},
+	}, dbus.SignalTypeNone)
+	work := nm.Object("/active/2", activeIface)
+	work.SetProperties(map[string]interface{}{
+		"Id": "Work", "Type": "vpn", "Vpn": true, "State": uint32(1),
+		"Devices": []godbus.ObjectPath{"/devices/1"},
+	}, dbus.SignalTypeNone)
+	nm.Object("/devices/1", deviceIface).
+		SetProperty("Interface", "wlan0", dbus.SignalTypeNone)
+	nm.Object("/devices/2", deviceIface).
+		SetProperty("Interface", "wg-home", dbus.SignalTypeNone)
+
+	nlt.AddLink(netlink.Link{Name: "wlan0", State: netlink.Up})
+	wg := nlt.AddLink(netlink.Link{Name: "wg-home", State: netlink.Down})
+
+	testBar.New(t)
+	testBar.Run(All().Output(connectionsOutput))
+	testBar.NextOutput("on start").AssertText(
+		[]string{"false Work||wait wg-home|wg-home|off"})
+
+	work.SetProperty("State", uint32(2), dbus.SignalTypeChanged)
+	testBar.NextOutput("on vpn connected").AssertText(
+		[]string{"true Work||on wg-home|wg-home|off"})
+
+	home := nm.Object("/active/3", activeIface)
+	home.SetProperties(map[string]interface{}{
+		"Id": "Home VPN", "Type": "wireguard", "Vpn": false, "State": uint32(2),
+		"Devices": []godbus.ObjectPath{"/devices/2"},
+	}, dbus.SignalTypeNone)
+	root.SetProperty("ActiveConnections",
+		[]godbus.ObjectPath{"/active/1", "/active/2", "/active/3"}, dbus.SignalTypeChanged)
+	nlt.UpdateLink(wg, netlink.Link{Name: "wg-home", State: netlink.Up})
+	testBar.Drain(wait, "on wireguard connected").AssertText(
+		[]string{"true Work||on Home VPN|wg-home|on"},
+		"merges NetworkManager connections with their interface")
+
+	root.SetProperty("ActiveConnections",
+		[]godbus.ObjectPath{"/active/1", "/active/3"}, dbus.SignalTypeChanged)
+	testBar.NextOutput("on vpn deactivated").AssertText(
+		[]string{"true Home VPN|wg-home|on"})
+}
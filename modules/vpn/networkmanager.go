@@ -0,0 +1,189 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vpn
+
+import (
+	"sort"
+
+	"barista.run/base/watchers/dbus"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// Overridden in tests.
+var busType = dbus.System
+
+const (
+	nmService   = "org.freedesktop.NetworkManager"
+	nmPath      = "/org/freedesktop/NetworkManager"
+	nmIface     = "org.freedesktop.NetworkManager"
+	activeIface = "org.freedesktop.NetworkManager.Connection.Active"
+	deviceIface = "org.freedesktop.NetworkManager.Device"
+)
+
+// NM_ACTIVE_CONNECTION_STATE_* values.
+const (
+	nmActivating = 1
+	nmActivated  = 2
+)
+
+// nmWatcher tracks the active connections of NetworkManager. If NetworkManager
+// is not running, it simply has no connections.
+type nmWatcher struct {
+	nm       *dbus.PropertiesWatcher
+	done     chan struct{}
+	notifyFn func()
+	active   map[godbus.ObjectPath]*nmConnection
+}
+
+// nmConnection tracks an active connection, and for VPNs that have their own
+// device (e.g. WireGuard), the device.
+type nmConnection struct {
+	conn *dbus.PropertiesWatcher
+	done chan struct{}
+
+	devicePath godbus.ObjectPath
+	device     *dbus.PropertiesWatcher
+	deviceDone chan struct{}
+}
+
+func watchNetworkManager(notifyFn func()) *nmWatcher {
+	n := &nmWatcher{
+		nm:       dbus.WatchProperties(busType, nmService, nmPath, nmIface).Add("ActiveConnections"),
+		done:     make(chan struct{}),
+		notifyFn: notifyFn,
+		active:   map[godbus.ObjectPath]*nmConnection{},
+	}
+	go n.nm.Forward(notifyFn, n.done)
+	n.update()
+	return n
+}
+
+// update watches any new active connections and their devices, and stops
+// watching connections that are no longer active.
+func (n *nmWatcher) update() {
+	paths, _ := n.nm.Get()["ActiveConnections"].([]godbus.ObjectPath)
+	current := map[godbus.ObjectPath]bool{}
+	for _, path := range paths {
+		current[path] = true
+		if _, ok := n.active[path]; ok {
+			continue
+		}
+		c := &nmConnection{
+			conn: dbus.WatchProperties(busType, nmService, string(path), activeIface).
+				Add("Id", "Type", "Vpn", "State", "Devices"),
+			done: make(chan struct{}),
+		}
+		go c.conn.Forward(n.notifyFn, c.done)
+		n.active[path] = c
+	}
+	for path, c := range n.active {
+		if !current[path] {
+			c.close()
+			delete(n.active, path)
+		}
+	}
+	for _, c := range n.active {
+		c.updateDevice(n.notifyFn)
+	}
+}
+
+func isVpnConnection(props map[string]interface{}) bool {
+	if vpn, _ := props["Vpn"].(bool); vpn {
+		return true
+	}
+	switch props["Type"] {
+	case "vpn", "wireguard", "tun":
+		return true
+	}
+	return false
+}
+
+// updateDevice watches the device of the connection, for VPNs that have their
+// own device. Plugin VPNs (e.g. OpenVPN) report the underlying device instead,
+// so their interface is not known.
+func (c *nmConnection) updateDevice(notifyFn func()) {
+	props := c.conn.Get()
+	var path godbus.ObjectPath
+	if isVpnConnection(props) && props["Type"] != "vpn" {
+		if devices, _ := props["Devices"].([]godbus.ObjectPath); len(devices) > 0 {
+			path = devices[0]
+		}
+	}
+	if path == c.devicePath {
+		return
+	}
+	c.closeDevice()
+	c.devicePath = path
+	if path == "" {
+		return
+	}
+	c.device = dbus.WatchProperties(busType, nmService, string(path), deviceIface).Add("Interface")
+	c.deviceDone = make(chan struct{})
+	go c.device.Forward(notifyFn, c.deviceDone)
+}
+
+func (c *nmConnection) closeDevice() {
+	if c.device != nil {
+		close(c.deviceDone)
+		c.device.Unsubscribe()
+		c.device = nil
+	}
+}
+
+func (c *nmConnection) close() {
+	c.closeDevice()
+	close(c.done)
+	c.conn.Unsubscribe()
+}
+
+func (n *nmWatcher) close() {
+	for _, c := range n.active {
+		c.close()
+	}
+	close(n.done)
+	n.nm.Unsubscribe()
+}
+
+// connections returns all active VPN connections, ordered by their object
+// path so that the order is stable.
+func (n *nmWatcher) connections() []Connection {
+	var paths []string
+	for path := range n.active {
+		paths = append(paths, string(path))
+	}
+	sort.Strings(paths)
+	var conns []Connection
+	for _, path := range paths {
+		c := n.active[godbus.ObjectPath(path)]
+		props := c.conn.Get()
+		if !isVpnConnection(props) {
+			continue
+		}
+		conn := Connection{NetworkManager: true}
+		conn.Name, _ = props["Id"].(string)
+		switch state, _ := props["State"].(uint32); state {
+		case nmActivating:
+			conn.State = Waiting
+		case nmActivated:
+			conn.State = Connected
+		}
+		if c.device != nil {
+			conn.Interface, _ = c.device.Get()["Interface"].(string)
+		}
+		conns = append(conns, conn)
+	}
+	return conns
+}
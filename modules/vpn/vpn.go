@@ -12,13 +12,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package vpn provides an i3bar module for openvpn information.
+// Package vpn provides i3bar modules for VPN information, either for a single
+// interface, or aggregated across all VPN interfaces and NetworkManager VPN
+// connections.
 package vpn // import "barista.run/modules/vpn"
 
 import (
 	"barista.run/bar"
-	"barista.run/base/value"
 	"barista.run/base/watchers/netlink"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 )
@@ -46,7 +48,7 @@ const (
 // Module represents a VPN bar module.
 type Module struct {
 	intf       string
-	outputFunc value.Value // of func(State) bar.Output
+	outputFunc core.OutputFunc // of func(State) bar.Output
 }
 
 // New constructs an instance of the VPN module for the specified interface.
@@ -21,10 +21,10 @@ package darksky // import "barista.run/modules/weather/darksky"
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"time"
 
+	"barista.run/base/httpclient"
 	"barista.run/modules/weather"
 
 	"github.com/martinlindhe/unit"
@@ -112,7 +112,7 @@ func getCondition(icon string) weather.Condition {
 
 // GetWeather gets weather information from DarkSky.
 func (ds Provider) GetWeather() (weather.Weather, error) {
-	response, err := http.Get(string(ds))
+	response, err := httpclient.Get(string(ds))
 	if err != nil {
 		return weather.Weather{}, err
 	}
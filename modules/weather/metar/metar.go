@@ -23,12 +23,12 @@ import (
 	"encoding/xml"
 	"fmt"
 	"math"
-	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
+	"barista.run/base/httpclient"
 	"barista.run/modules/weather"
 
 	"github.com/martinlindhe/unit"
@@ -91,6 +91,12 @@ func (c *Config) Build() weather.Provider {
 	}
 }
 
+// CacheKey implements weather.CacheKeyer, since the provider also holds the
+// last weather it fetched.
+func (p *provider) CacheKey() string {
+	return fmt.Sprintf("%s %v %v", p.url, p.stripRemarks, p.includeFlightCat)
+}
+
 type skyCondition struct {
 	SkyCover  string `xml:"sky_cover,attr"`
 	CloudBase int    `xml:"cloud_base_ft_agl,attr"`
@@ -296,7 +302,7 @@ func (m metar) getCondition() weather.Condition {
 
 // GetWeather gets weather information from NOAA ADDS.
 func (p *provider) GetWeather() (weather.Weather, error) {
-	response, err := http.Get(p.url)
+	response, err := httpclient.Get(p.url)
 	if err != nil {
 		return weather.Weather{}, err
 	}
@@ -75,3 +75,22 @@ func TestExample(t *testing.T) {
 	wthr, err = provider.GetWeather()
 	require.Error(t, err)
 }
+
+func TestCacheKey(t *testing.T) {
+	ts := testServer.New()
+	defer ts.Close()
+
+	provider := Station("KBFI").Build().(*provider)
+	key := provider.CacheKey()
+	provider.url = ts.URL + "/static/example.xml"
+	other := *provider
+	_, err := provider.GetWeather()
+	require.NoError(t, err)
+	require.Equal(t, other.CacheKey(), provider.CacheKey(),
+		"key does not change with fetched weather")
+
+	require.NotEqual(t, key,
+		Station("KSEA").Build().(weather.CacheKeyer).CacheKey())
+	require.NotEqual(t, key,
+		Station("KBFI").StripRemarks().Build().(weather.CacheKeyer).CacheKey())
+}
@@ -21,10 +21,10 @@ package openweathermap // import "barista.run/modules/weather/openweathermap"
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"time"
 
+	"barista.run/base/httpclient"
 	"barista.run/modules/weather"
 
 	"github.com/martinlindhe/unit"
@@ -166,7 +166,7 @@ func getCondition(owmCondition int) weather.Condition {
 
 // GetWeather gets weather information from OpenWeatherMap.
 func (owm Provider) GetWeather() (weather.Weather, error) {
-	response, err := http.Get(string(owm))
+	response, err := httpclient.Get(string(owm))
 	if err != nil {
 		return weather.Weather{}, err
 	}
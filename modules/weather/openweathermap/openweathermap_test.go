@@ -22,6 +22,7 @@ import (
 
 	"barista.run/modules/weather"
 	"barista.run/testing/cron"
+	"barista.run/testing/httpfake"
 	testServer "barista.run/testing/httpserver"
 
 	"github.com/martinlindhe/unit"
@@ -166,6 +167,30 @@ func TestProviderBuilder(t *testing.T) {
 	}
 }
 
+func TestAPI(t *testing.T) {
+	api := httpfake.New(t)
+	defer api.Close()
+	defer api.Intercept()()
+	api.Get("/data/2.5/weather").
+		Query("id", "2172797").
+		RequireAPIKey("appid", "my-api-key").
+		Fixture("good.json.tpl", map[string]string{"id": "500", "cond": "Rain", "desc": "light rain"})
+
+	wthr, err := New("my-api-key").CityID("2172797").GetWeather()
+	require.NoError(t, err)
+	require.Equal(t, "Cairns", wthr.Location)
+	require.Equal(t, weather.Rain, wthr.Condition)
+	req := api.AssertRequested("GET", "/data/2.5/weather")
+	require.Equal(t, "api.openweathermap.org", req.Host)
+
+	_, err = New("wrong-key").CityID("2172797").GetWeather()
+	require.Error(t, err, "with invalid API key")
+
+	_, err = New("my-api-key").CityName("Cairns", "AU").GetWeather()
+	require.Error(t, err, "for unknown query")
+	require.Equal(t, "Cairns,AU", api.AssertRequested("GET", "/data/2.5/weather").Query.Get("q"))
+}
+
 func TestLive(t *testing.T) {
 	cron.Test(t, func() error {
 		wthr, err := New(os.Getenv("WEATHER_OWM_API_KEY")).
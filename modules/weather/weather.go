@@ -16,16 +16,26 @@
 package weather // import "barista.run/modules/weather"
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"barista.run/bar"
 	"barista.run/base/notifier"
 	"barista.run/base/value"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/base/watchers/metered"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
 	"barista.run/timing"
 
 	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
 )
 
 // Weather represents the current weather conditions.
@@ -42,6 +52,9 @@ type Weather struct {
 	Sunset      time.Time
 	Updated     time.Time
 	Attribution string
+	// Stale is true if the latest update failed, and the information shown
+	// is from an earlier update (or the on-disk cache).
+	Stale bool
 }
 
 // Wind stores the wind speed and direction together.
@@ -88,19 +101,32 @@ type Provider interface {
 	GetWeather() (Weather, error)
 }
 
+// CacheKeyer can be implemented by providers to control which weather cache
+// they use. The key should identify the provider's configuration, and must not
+// change as the provider fetches weather. Without it, the key is computed by
+// formatting the provider, which only works for providers that are plain
+// values (e.g. a URL or API key).
+type CacheKeyer interface {
+	CacheKey() string
+}
+
 // Module represents a bar.Module that displays weather information.
 type Module struct {
 	provider   Provider
+	cacheFile  string
 	scheduler  *timing.Scheduler
+	interval   value.Value // of time.Duration
+	maxStale   value.Value // of time.Duration
 	refreshFn  func()
 	refreshCh  <-chan struct{}
-	outputFunc value.Value // of func(Weather) bar.Output
+	outputFunc core.OutputFunc // of func(Weather) bar.Output
 }
 
 // New constructs an instance of the weather module with the provided configuration.
 func New(provider Provider) *Module {
 	m := &Module{
 		provider:  provider,
+		cacheFile: cacheFilename(provider),
 		scheduler: timing.NewScheduler(),
 	}
 	m.refreshFn, m.refreshCh = notifier.New()
@@ -111,6 +137,7 @@ func New(provider Provider) *Module {
 			w.Temperature.Celsius(), w.Description, w.Attribution)
 	})
 	m.RefreshInterval(10 * time.Minute)
+	m.MaxStale(time.Hour)
 	return m
 }
 
@@ -120,12 +147,21 @@ func (m *Module) Output(outputFunc func(Weather) bar.Output) *Module {
 	return m
 }
 
-// RefreshInterval configures the polling frequency.
+// RefreshInterval configures the polling frequency. The interval is stretched
+// while the connection is metered (see metered.Interval).
 func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.interval.Set(interval)
 	m.scheduler.Every(interval)
 	return m
 }
 
+// MaxStale configures how long the last successfully fetched weather will be
+// shown (marked as stale) when updates fail, before an error is shown instead.
+func (m *Module) MaxStale(maxStale time.Duration) *Module {
+	m.maxStale.Set(maxStale)
+	return m
+}
+
 // Refresh fetches updated weather information.
 func (m *Module) Refresh() {
 	m.refreshFn()
@@ -133,24 +169,155 @@ func (m *Module) Refresh() {
 
 // Stream starts the module.
 func (m *Module) Stream(s bar.Sink) {
-	weather, err := m.provider.GetWeather()
+	interval := metered.Interval(m.interval.Get().(time.Duration))
+	if metered.Metered() {
+		m.scheduler.Every(interval)
+	}
+	weather, fetched, ok := m.readCache()
+	var err error
+	poller := connectivity.NewPoller(func() {
+		weather, fetched, err = m.update(weather, fetched)
+	})
+	if !ok || timing.Now().Sub(fetched) >= interval {
+		poller.Poll()
+	}
 	outputFunc := m.outputFunc.Get().(func(Weather) bar.Output)
 	nextOutputFunc, done := m.outputFunc.Subscribe()
 	defer done()
 	for {
+		// Cached weather is shown without polling, so the poller's output is
+		// not used here.
 		if !s.Error(err) {
-			s.Output(outputFunc(weather))
+			if fetched.IsZero() {
+				s.Output(connectivity.Mark(nil))
+			} else {
+				s.Output(connectivity.Mark(outputFunc(weather)))
+			}
 		}
 		select {
 		case <-nextOutputFunc:
 			outputFunc = m.outputFunc.Get().(func(Weather) bar.Output)
 		case <-m.scheduler.C:
-			weather, err = m.provider.GetWeather()
+			poller.Poll()
+		case <-connectivity.Next():
+			poller.Poll()
+		case <-metered.Next():
+			m.scheduler.Every(metered.Interval(m.interval.Get().(time.Duration)))
 		case <-m.refreshCh:
 			if err != nil {
 				s(nil)
 			}
-			weather, err = m.provider.GetWeather()
+			weather, fetched, err = m.update(weather, fetched)
+		}
+	}
+}
+
+// update fetches the weather from the provider. If that fails, the last
+// weather is returned marked as stale, as long as it's not too old.
+func (m *Module) update(last Weather, lastFetched time.Time) (Weather, time.Time, error) {
+	weather, err := m.provider.GetWeather()
+	if err == nil {
+		now := timing.Now()
+		m.writeCache(weather, now)
+		return weather, now, nil
+	}
+	if lastFetched.IsZero() ||
+		timing.Now().Sub(lastFetched) >= m.maxStale.Get().(time.Duration) {
+		return Weather{}, time.Time{}, err
+	}
+	l.Log("Showing stale weather: %v", err)
+	last.Stale = true
+	return last, lastFetched, nil
+}
+
+// cachedWeather is the on-disk representation of the last fetched weather.
+type cachedWeather struct {
+	Fetched time.Time
+	Weather Weather
+}
+
+// Overridden in tests.
+var (
+	fs       = afero.NewOsFs()
+	cacheDir = getCacheDir()
+)
+
+// getCacheDir gets an XDG compliant directory for caching weather data.
+func getCacheDir() string {
+	cacheRoot := os.ExpandEnv("$HOME/.cache")
+	if xdgCache, ok := os.LookupEnv("XDG_CACHE_HOME"); ok {
+		cacheRoot = xdgCache
+	}
+	return filepath.Join(cacheRoot, "barista", "weather")
+}
+
+// maxCacheAge is the age after which cached weather is removed from disk, to
+// clean up after providers that are no longer configured.
+const maxCacheAge = 7 * 24 * time.Hour
+
+// cacheFilename computes a cache filename for the given provider from its
+// type and configuration, so that each configured provider has its own cache.
+// The configuration is hashed since it usually includes an API key.
+func cacheFilename(provider Provider) string {
+	key := fmt.Sprintf("%+v", provider)
+	if k, ok := provider.(CacheKeyer); ok {
+		key = k.CacheKey()
+	}
+	hash := sha256.Sum224([]byte(fmt.Sprintf("%T %s", provider, key)))
+	return base64.RawURLEncoding.EncodeToString(hash[:]) + ".json"
+}
+
+func readCacheFile(name string) (cachedWeather, error) {
+	var c cachedWeather
+	bytes, err := afero.ReadFile(fs, filepath.Join(cacheDir, name))
+	if err == nil {
+		err = json.Unmarshal(bytes, &c)
+	}
+	return c, err
+}
+
+func (m *Module) readCache() (Weather, time.Time, bool) {
+	c, err := readCacheFile(m.cacheFile)
+	if os.IsNotExist(err) {
+		return Weather{}, time.Time{}, false
+	}
+	if err != nil {
+		l.Log("Ignoring bad weather cache: %v", err)
+		return Weather{}, time.Time{}, false
+	}
+	return c.Weather, c.Fetched, true
+}
+
+func (m *Module) writeCache(weather Weather, fetched time.Time) {
+	bytes, _ := json.Marshal(cachedWeather{fetched, weather})
+	err := fs.MkdirAll(cacheDir, 0700)
+	if err == nil {
+		err = afero.WriteFile(fs, filepath.Join(cacheDir, m.cacheFile), bytes, 0600)
+	}
+	if err != nil {
+		l.Log("Failed to cache weather: %v", err)
+		return
+	}
+	pruneCache(fetched)
+}
+
+// pruneCache removes cached weather fetched more than maxCacheAge ago, along
+// with any cache files that cannot be read.
+func pruneCache(now time.Time) {
+	files, err := afero.ReadDir(fs, cacheDir)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		c, err := readCacheFile(f.Name())
+		if err == nil && now.Sub(c.Fetched) < maxCacheAge {
+			continue
+		}
+		if err := fs.Remove(filepath.Join(cacheDir, f.Name())); err != nil {
+			l.Log("Failed to remove old weather cache: %v", err)
 		}
 	}
 }
@@ -16,29 +16,50 @@ package weather
 
 import (
 	"errors"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"barista.run/bar"
+	"barista.run/base/watchers/connectivity"
+	"barista.run/base/watchers/metered"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
+	"barista.run/timing"
 
 	"github.com/martinlindhe/unit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
 )
 
+func init() {
+	connectivity.SetForTest(true)
+	metered.SetForTest(false)
+}
+
 type testProvider struct {
 	sync.RWMutex
 	Weather
 	error
+	calls int32
+	key   string
+}
+
+func (t *testProvider) CacheKey() string {
+	return t.key
 }
 
 func (t *testProvider) GetWeather() (Weather, error) {
+	atomic.AddInt32(&t.calls, 1)
 	t.RLock()
 	defer t.RUnlock()
 	return t.Weather, t.error
 }
 
 func TestWeather(t *testing.T) {
+	fs = afero.NewMemMapFs()
 	testBar.New(t)
 	p := &testProvider{Weather: Weather{
 		Location:    "Swallow Falls",
@@ -48,7 +69,8 @@ func TestWeather(t *testing.T) {
 		Humidity:    0.7,
 		Attribution: "FLDSMDFR",
 	}}
-	w := New(p)
+	// Disable stale data to test error handling.
+	w := New(p).MaxStale(0)
 	testBar.Run(w)
 
 	testBar.NextOutput().AssertText(
@@ -81,3 +103,144 @@ func TestWeather(t *testing.T) {
 	p.Unlock()
 	testBar.NextOutput().AssertText([]string{"72, by FLDSMDFR"})
 }
+
+func staleOutput(w Weather) bar.Output {
+	return outputs.Textf("%.0f stale=%v", w.Temperature.Celsius(), w.Stale)
+}
+
+func TestStale(t *testing.T) {
+	fs = afero.NewMemMapFs()
+	testBar.New(t)
+	p := &testProvider{Weather: Weather{Temperature: unit.FromCelsius(20)}}
+	testBar.Run(New(p).Output(staleOutput).MaxStale(30 * time.Minute))
+	testBar.NextOutput().AssertText([]string{"20 stale=false"}, "on start")
+
+	p.Lock()
+	p.error = errors.New("foo")
+	p.Unlock()
+
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"20 stale=true"},
+		"last weather on error")
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"20 stale=true"},
+		"last weather on error")
+
+	testBar.Tick()
+	testBar.NextOutput().AssertError("after max stale duration")
+
+	p.Lock()
+	p.error = nil
+	p.Temperature = unit.FromCelsius(25)
+	p.Unlock()
+
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"25 stale=false"})
+}
+
+func TestCache(t *testing.T) {
+	require := require.New(t)
+	fs = afero.NewMemMapFs()
+	testBar.New(t)
+	p := &testProvider{Weather: Weather{Temperature: unit.FromCelsius(20)}}
+	testBar.Run(New(p).Output(staleOutput))
+	testBar.NextOutput().AssertText([]string{"20 stale=false"}, "on start")
+	require.Equal(int32(1), atomic.LoadInt32(&p.calls))
+
+	files, _ := afero.ReadDir(fs, cacheDir)
+	require.Len(files, 1, "weather is cached")
+
+	p.Lock()
+	p.Temperature = unit.FromCelsius(25)
+	p.Unlock()
+
+	testBar.New(t)
+	testBar.Run(New(p).Output(staleOutput))
+	testBar.NextOutput().AssertText([]string{"20 stale=false"},
+		"cached weather on restart")
+	require.Equal(int32(1), atomic.LoadInt32(&p.calls),
+		"no fetch on restart with fresh cache")
+
+	testBar.Tick()
+	testBar.NextOutput().AssertText([]string{"25 stale=false"}, "on tick")
+	require.Equal(int32(2), atomic.LoadInt32(&p.calls))
+
+	testBar.New(t)
+	timing.AdvanceBy(20 * time.Minute)
+	testBar.Run(New(p).Output(staleOutput))
+	testBar.NextOutput().AssertText([]string{"25 stale=false"},
+		"fetch on restart with old cache")
+	require.Equal(int32(3), atomic.LoadInt32(&p.calls))
+
+	p.Lock()
+	p.error = errors.New("foo")
+	p.Unlock()
+
+	testBar.New(t)
+	timing.AdvanceBy(40 * time.Minute)
+	testBar.Run(New(p).Output(staleOutput))
+	testBar.NextOutput().AssertText([]string{"25 stale=true"},
+		"stale cached weather on restart with error")
+
+	other := &testProvider{key: "other",
+		Weather: Weather{Temperature: unit.FromCelsius(10)}}
+	testBar.New(t)
+	testBar.Run(New(other).Output(staleOutput))
+	testBar.NextOutput().AssertText([]string{"10 stale=false"},
+		"separate cache for each provider")
+	files, _ = afero.ReadDir(fs, cacheDir)
+	require.Len(files, 2)
+
+	afero.WriteFile(fs, filepath.Join(cacheDir, "bad.json"), []byte("{"), 0600)
+	testBar.New(t)
+	// Test time is reset by testBar.New, and p's weather is from 20 minutes in.
+	timing.AdvanceBy(maxCacheAge + time.Hour)
+	testBar.Run(New(other).Output(staleOutput))
+	testBar.NextOutput().Expect("fetch on restart with old cache")
+	files, _ = afero.ReadDir(fs, cacheDir)
+	require.Len(files, 1, "old and unreadable caches are removed")
+
+	fs = afero.NewReadOnlyFs(afero.NewMemMapFs())
+	testBar.New(t)
+	testBar.Run(New(other).Output(staleOutput))
+	testBar.NextOutput().AssertText([]string{"10 stale=false"},
+		"works without cache")
+}
+
+func TestMetered(t *testing.T) {
+	require := require.New(t)
+	fs = afero.NewMemMapFs()
+	testBar.New(t)
+	defer metered.SetForTest(false)
+	p := &testProvider{Weather: Weather{Temperature: unit.FromCelsius(20)}}
+	testBar.Run(New(p).Output(staleOutput))
+	testBar.NextOutput().AssertText([]string{"20 stale=false"}, "on start")
+
+	now := timing.Now()
+	require.Equal(10*time.Minute, testBar.Tick().Sub(now), "normal interval")
+	testBar.NextOutput().Expect("on tick")
+
+	metered.SetForTest(true)
+	testBar.NextOutput().Expect("on metered connection")
+	now = timing.Now()
+	require.Equal(40*time.Minute, testBar.Tick().Sub(now),
+		"interval stretched on metered connection")
+	testBar.NextOutput().Expect("on tick")
+	require.Equal(int32(3), atomic.LoadInt32(&p.calls))
+
+	testBar.New(t)
+	timing.AdvanceBy(20 * time.Minute)
+	testBar.Run(New(p).Output(staleOutput))
+	testBar.NextOutput().AssertText([]string{"20 stale=false"},
+		"cached weather on restart")
+	require.Equal(int32(3), atomic.LoadInt32(&p.calls),
+		"no fetch on metered connection with recent cache")
+
+	metered.SetForTest(false)
+	testBar.NextOutput().Expect("on unmetered connection")
+	now = timing.Now()
+	require.Equal(10*time.Minute, testBar.Tick().Sub(now),
+		"normal interval restored")
+	testBar.NextOutput().Expect("on tick")
+	require.Equal(int32(4), atomic.LoadInt32(&p.calls))
+}
@@ -0,0 +1,257 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package websocket provides a bar module that shows values from JSON messages
+received over a websocket, for data sources that push updates:
+
+	websocket.New("wss://feed.example.com/v1").
+		Send(`{"subscribe": "trades", "symbol": "ABC"}`).
+		Filter(rest.Equals("type", "trade")).
+		Text("ABC %.2f", "price").
+		When(rest.Below("price", 100), rest.Color(colors.Scheme("bad")))
+
+Values are selected and formatted as in the rest module. The connection is
+re-established with exponential backoff if it fails, and any messages given
+to Send are sent again on each connection.
+*/
+package websocket // import "barista.run/modules/websocket"
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/notifier"
+	"barista.run/base/value"
+	"barista.run/colors"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/modules/rest"
+	"barista.run/timing"
+
+	"golang.org/x/net/websocket"
+)
+
+// Info represents the latest message received.
+type Info struct {
+	// Info provides access to values in the latest message.
+	rest.Info
+	// Connected is true if the websocket is currently connected.
+	Connected bool
+	// Received is when the latest message was received. It is zero if no
+	// message has been received yet.
+	Received time.Time
+	// Err is the error that caused the last disconnection, if any.
+	Err error
+}
+
+// HasMessage returns true if a message has been received.
+func (i Info) HasMessage() bool {
+	return !i.Received.IsZero()
+}
+
+// Module represents a bar module that shows values from websocket messages.
+type Module struct {
+	url        string
+	origin     string
+	headers    http.Header
+	messages   []string
+	filter     rest.Condition
+	outputFunc core.OutputFunc // of func(Info) bar.Output
+	template   value.Value     // of rest.Template
+
+	mu       sync.Mutex
+	info     Info
+	notifyFn func()
+	notifyCh <-chan struct{}
+}
+
+// Overridden in tests.
+var (
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// New constructs a module that connects to the given websocket URL. By
+// default, each message is shown in full, which is only useful for simple
+// values; use Text to select the values to show.
+func New(url string) *Module {
+	m := &Module{url: url, origin: "http://localhost/", headers: http.Header{}}
+	m.notifyFn, m.notifyCh = notifier.New()
+	l.Label(m, url)
+	l.Register(m, "outputFunc", "template")
+	m.template.Set(rest.Text("%v", ""))
+	m.Output(func(i Info) bar.Output {
+		if !i.HasMessage() {
+			return nil
+		}
+		out := m.template.Get().(rest.Template).Output(i.Info)
+		if !i.Connected && out.GetError() == nil {
+			return out.Color(colors.Scheme("degraded"))
+		}
+		return out
+	})
+	return m
+}
+
+// Origin sets the origin sent when connecting, which some servers check.
+// Defaults to "http://localhost/". It must be called before the module is
+// streamed.
+func (m *Module) Origin(origin string) *Module {
+	m.origin = origin
+	return m
+}
+
+// Header adds an HTTP header to the connection request, e.g. for
+// authentication. It must be called before the module is streamed.
+func (m *Module) Header(name, value string) *Module {
+	m.headers.Add(name, value)
+	return m
+}
+
+// Send adds a message to send after connecting, e.g. to subscribe to a feed.
+// Messages are sent in order each time the connection is established. It
+// must be called before the module is streamed.
+func (m *Module) Send(message string) *Module {
+	m.messages = append(m.messages, message)
+	return m
+}
+
+// Filter ignores all messages that do not match the given condition, e.g. to
+// skip heartbeats or other message types. It must be called before the module
+// is streamed.
+func (m *Module) Filter(cond rest.Condition) *Module {
+	m.filter = cond
+	return m
+}
+
+// Text sets the format string for the default output, and the paths of the
+// values used as its arguments. See rest.Module.Text.
+func (m *Module) Text(text string, paths ...string) *Module {
+	m.template.Set(m.template.Get().(rest.Template).Text(text, paths...))
+	return m
+}
+
+// When adds a rule to the default output. See rest.Module.When.
+func (m *Module) When(cond rest.Condition, formats ...rest.Format) *Module {
+	m.template.Set(m.template.Get().(rest.Template).When(cond, formats...))
+	return m
+}
+
+// Output configures a module to display the output of a user-defined
+// function. This replaces the default output, so Text and When have no
+// effect.
+func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
+	m.outputFunc.Set(outputFunc)
+	return m
+}
+
+// Stream starts the module.
+func (m *Module) Stream(sink bar.Sink) {
+	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
+	nextOutputFunc, done := m.outputFunc.Subscribe()
+	defer done()
+	nextTemplate, done := m.template.Subscribe()
+	defer done()
+	go m.run()
+
+	for {
+		m.mu.Lock()
+		info := m.info
+		m.mu.Unlock()
+		sink.Output(outputFunc(info))
+		select {
+		case <-m.notifyCh:
+		case <-nextTemplate:
+		case <-nextOutputFunc:
+			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
+		}
+	}
+}
+
+func (m *Module) update(fn func(*Info)) {
+	m.mu.Lock()
+	fn(&m.info)
+	m.mu.Unlock()
+	m.notifyFn()
+}
+
+// run connects to the websocket, reconnecting with exponential backoff
+// whenever the connection fails. The backoff is reset once a message has been
+// received.
+func (m *Module) run() {
+	backoff := minBackoff
+	for {
+		received, err := m.listen()
+		l.Log("%s: disconnected: %v", l.ID(m), err)
+		m.update(func(i *Info) {
+			i.Connected = false
+			i.Err = err
+		})
+		if received {
+			backoff = minBackoff
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// listen connects to the websocket and processes messages until the
+// connection fails, returning whether any message was received.
+func (m *Module) listen() (received bool, err error) {
+	cfg, err := websocket.NewConfig(m.url, m.origin)
+	if err != nil {
+		return false, err
+	}
+	for name, vals := range m.headers {
+		cfg.Header[name] = vals
+	}
+	conn, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	for _, msg := range m.messages {
+		if err := websocket.Message.Send(conn, msg); err != nil {
+			return false, err
+		}
+	}
+	m.update(func(i *Info) {
+		i.Connected = true
+		i.Err = nil
+	})
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(conn, &data); err != nil {
+			return received, err
+		}
+		received = true
+		msg, err := rest.Parse(data)
+		if err != nil {
+			l.Log("%s: %v", l.ID(m), err)
+			continue
+		}
+		if m.filter != nil && !m.filter(msg) {
+			continue
+		}
+		m.update(func(i *Info) {
+			i.Info = msg
+			i.Received = timing.Now()
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/modules/rest"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func init() {
+	// Set once, since modules from earlier tests keep reconnecting.
+	minBackoff, maxBackoff = 10*time.Millisecond, 40*time.Millisecond
+}
+
+type fakeServer struct {
+	*httptest.Server
+	conns    chan *websocket.Conn
+	received chan string
+	tokens   chan string
+}
+
+// newServer starts a websocket server that expects the given number of
+// messages from each client before its connection is made available.
+func newServer(t *testing.T, expected int) *fakeServer {
+	f := &fakeServer{
+		conns:    make(chan *websocket.Conn, 10),
+		received: make(chan string, 10),
+		tokens:   make(chan string, 10),
+	}
+	ws := websocket.Handler(func(conn *websocket.Conn) {
+		for i := 0; i < expected; i++ {
+			var msg string
+			if websocket.Message.Receive(conn, &msg) != nil {
+				return
+			}
+			f.received <- msg
+		}
+		f.conns <- conn
+		// Keep the connection open until the client or test closes it.
+		var msg string
+		for websocket.Message.Receive(conn, &msg) == nil {
+		}
+	})
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.tokens <- r.Header.Get("X-Token")
+		ws.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeServer) url() string {
+	return "ws" + strings.TrimPrefix(f.URL, "http")
+}
+
+func (f *fakeServer) next(t *testing.T) *websocket.Conn {
+	select {
+	case conn := <-f.conns:
+		return conn
+	case <-time.After(time.Second):
+		require.Fail(t, "not connected")
+	}
+	return nil
+}
+
+func TestModule(t *testing.T) {
+	testBar.New(t)
+	colors.LoadFromMap(map[string]string{"degraded": "#ffff00"})
+	srv := newServer(t, 1)
+
+	testBar.Run(New(srv.url()).
+		Header("X-Token", "secret").
+		Send(`{"subscribe": "price"}`).
+		Filter(rest.Exists("price")).
+		Text("%.1f", "price").
+		When(rest.Above("price", 100), rest.Urgent()))
+	testBar.NextOutput("on start").AssertEmpty("no message")
+
+	conn := srv.next(t)
+	require.Equal(t, "secret", <-srv.tokens)
+	require.Equal(t, `{"subscribe": "price"}`, <-srv.received)
+	testBar.Drain(50*time.Millisecond, "on connect").AssertEmpty("no message")
+
+	require.NoError(t, websocket.Message.Send(conn, `{"price": 99.5}`))
+	out := testBar.NextOutput("on message")
+	out.AssertText([]string{"99.5"})
+	urgent, _ := out.At(0).Segment().IsUrgent()
+	require.False(t, urgent)
+
+	require.NoError(t, websocket.Message.Send(conn, `{"type": "heartbeat"}`))
+	require.NoError(t, websocket.Message.Send(conn, `not json`))
+	testBar.AssertNoOutput("on filtered or invalid message")
+
+	require.NoError(t, websocket.Message.Send(conn, `{"price": 101}`))
+	out = testBar.NextOutput("on message")
+	out.AssertText([]string{"101.0"})
+	urgent, _ = out.At(0).Segment().IsUrgent()
+	require.True(t, urgent)
+
+	conn.Close()
+	out = testBar.NextOutput("on disconnect")
+	out.AssertText([]string{"101.0"}, "last message kept")
+	c, _ := out.At(0).Segment().GetColor()
+	require.Equal(t, colors.Hex("#ffff00"), c)
+
+	conn = srv.next(t)
+	require.Equal(t, `{"subscribe": "price"}`, <-srv.received, "sent on reconnect")
+	out = testBar.Drain(50*time.Millisecond, "on reconnect")
+	_, hasColor := out.At(0).Segment().GetColor()
+	require.False(t, hasColor)
+
+	require.NoError(t, websocket.Message.Send(conn, `{"price": 12}`))
+	testBar.NextOutput("on message").AssertText([]string{"12.0"})
+}
+
+func TestDefaultOutput(t *testing.T) {
+	testBar.New(t)
+	srv := newServer(t, 0)
+	testBar.Run(New(srv.url()))
+	testBar.NextOutput("on start").AssertEmpty()
+	conn := srv.next(t)
+	testBar.Drain(50*time.Millisecond, "on connect")
+
+	require.NoError(t, websocket.Message.Send(conn, `"ready"`))
+	testBar.NextOutput("on message").AssertText([]string{"ready"})
+}
+
+func TestBackoff(t *testing.T) {
+	testBar.New(t)
+	srv := newServer(t, 0)
+	srv.Close()
+
+	infos := make(chan Info, 100)
+	testBar.Run(New(srv.url()).Output(func(i Info) bar.Output {
+		infos <- i
+		return outputs.Textf("%v", i.Connected)
+	}))
+	var errs int
+	start := time.Now()
+	for errs < 4 {
+		if i := <-infos; i.Err != nil {
+			require.False(t, i.Connected)
+			errs++
+		}
+	}
+	// 10ms + 20ms + 40ms between the four failed attempts.
+	require.True(t, time.Since(start) >= 70*time.Millisecond, "backs off")
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wlan
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"barista.run/base/menu"
+	"barista.run/base/watchers/dbus"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/martinlindhe/unit"
+)
+
+// AccessPoint represents a wireless network visible to NetworkManager.
+type AccessPoint struct {
+	SSID           string
+	AccessPointMAC string
+	// Signal strength in percent.
+	Strength  int
+	Frequency unit.Frequency
+	// Secure is true if the network requires authentication.
+	Secure bool
+
+	path godbus.ObjectPath
+}
+
+// Band returns the frequency band of the network, e.g. "2.4 GHz" or "5 GHz".
+func (a AccessPoint) Band() string {
+	return band(a.Frequency)
+}
+
+// Channel returns the channel number of the network.
+func (a AccessPoint) Channel() int {
+	mhz := int(a.Frequency.Megahertz())
+	switch {
+	case mhz == 2484:
+		return 14
+	case mhz >= 2412 && mhz < 2484:
+		return (mhz - 2407) / 5
+	case mhz >= 5000 && mhz < 5925:
+		return (mhz - 5000) / 5
+	case mhz >= 5955 && mhz <= 7115:
+		return (mhz - 5950) / 5
+	}
+	return 0
+}
+
+func (a AccessPoint) String() string {
+	str := fmt.Sprintf("%s (%d%%, %s", a.SSID, a.Strength, a.Band())
+	if a.Secure {
+		str += ", secured"
+	}
+	return str + ")"
+}
+
+// Overridden in tests.
+var busType = dbus.System
+
+const (
+	nmService       = "org.freedesktop.NetworkManager"
+	nmPath          = "/org/freedesktop/NetworkManager"
+	nmIface         = "org.freedesktop.NetworkManager"
+	wirelessIface   = "org.freedesktop.NetworkManager.Device.Wireless"
+	apIface         = "org.freedesktop.NetworkManager.AccessPoint"
+	settingsPath    = "/org/freedesktop/NetworkManager/Settings"
+	settingsIface   = "org.freedesktop.NetworkManager.Settings"
+	connectionIface = "org.freedesktop.NetworkManager.Settings.Connection"
+)
+
+var apProps = []string{
+	"Ssid", "HwAddress", "Strength", "Frequency", "Flags", "WpaFlags", "RsnFlags",
+}
+
+// nmDevice tracks a NetworkManager wireless device and its active access point.
+// Only iface, path, and device may be used outside the module's goroutine.
+type nmDevice struct {
+	iface    string
+	path     godbus.ObjectPath
+	device   *dbus.PropertiesWatcher
+	done     chan struct{}
+	notifyFn func()
+
+	apPath godbus.ObjectPath
+	ap     *dbus.PropertiesWatcher
+	apDone chan struct{}
+}
+
+func watchDevice(iface string, notifyFn func()) (*nmDevice, error) {
+	nm := dbus.WatchProperties(busType, nmService, nmPath, nmIface)
+	r, err := nm.Call("GetDeviceByIpIface", iface)
+	nm.Unsubscribe()
+	if err != nil {
+		return nil, err
+	}
+	path, _ := r[0].(godbus.ObjectPath)
+	d := &nmDevice{
+		iface:    iface,
+		path:     path,
+		device:   dbus.WatchProperties(busType, nmService, string(path), wirelessIface).Add("ActiveAccessPoint", "AccessPoints"),
+		done:     make(chan struct{}),
+		notifyFn: notifyFn,
+	}
+	go d.device.Forward(notifyFn, d.done)
+	d.updateAccessPoint()
+	return d, nil
+}
+
+// updateAccessPoint watches the current active access point of the device,
+// if it has changed.
+func (d *nmDevice) updateAccessPoint() {
+	path, _ := d.device.Get()["ActiveAccessPoint"].(godbus.ObjectPath)
+	if path == d.apPath {
+		return
+	}
+	d.closeAccessPoint()
+	d.apPath = path
+	if path == "" || path == "/" {
+		return
+	}
+	d.ap = dbus.WatchProperties(busType, nmService, string(path), apIface).Add(apProps...)
+	d.apDone = make(chan struct{})
+	go d.ap.Forward(d.notifyFn, d.apDone)
+}
+
+func (d *nmDevice) closeAccessPoint() {
+	if d.ap != nil {
+		close(d.apDone)
+		d.ap.Unsubscribe()
+		d.ap = nil
+	}
+}
+
+func (d *nmDevice) close() {
+	d.closeAccessPoint()
+	close(d.done)
+	d.device.Unsubscribe()
+}
+
+func (d *nmDevice) fill(info *Info) {
+	info.nm = d
+	if d.ap == nil {
+		return
+	}
+	ap := accessPointFromProps(d.ap.Get())
+	info.SSID = ap.SSID
+	info.AccessPointMAC = ap.AccessPointMAC
+	info.Strength = ap.Strength
+	info.Frequency = ap.Frequency
+	info.Channel = ap.Channel()
+}
+
+func accessPointFromProps(props map[string]interface{}) AccessPoint {
+	var ap AccessPoint
+	ssid, _ := props["Ssid"].([]byte)
+	ap.SSID = string(ssid)
+	ap.AccessPointMAC, _ = props["HwAddress"].(string)
+	strength, _ := props["Strength"].(byte)
+	ap.Strength = int(strength)
+	freq, _ := props["Frequency"].(uint32)
+	ap.Frequency = unit.Frequency(freq) * unit.Megahertz
+	flags, _ := props["Flags"].(uint32)
+	wpaFlags, _ := props["WpaFlags"].(uint32)
+	rsnFlags, _ := props["RsnFlags"].(uint32)
+	// NM_802_11_AP_FLAGS_PRIVACY indicates WEP, the others WPA/WPA2/WPA3.
+	ap.Secure = flags&0x1 != 0 || wpaFlags != 0 || rsnFlags != 0
+	return ap
+}
+
+var errNoNetworkManager = errors.New("NetworkManager is not available")
+
+// AccessPoints returns the wireless networks visible to the device, strongest
+// first. If multiple access points share an SSID, only the strongest is
+// included. Requires NetworkManager.
+func (i Info) AccessPoints() ([]AccessPoint, error) {
+	if i.nm == nil {
+		return nil, errNoNetworkManager
+	}
+	paths, _ := i.nm.device.Get()["AccessPoints"].([]godbus.ObjectPath)
+	strongest := map[string]AccessPoint{}
+	for _, path := range paths {
+		w := dbus.WatchProperties(busType, nmService, string(path), apIface).Fetch(apProps...)
+		ap := accessPointFromProps(w.Get())
+		w.Unsubscribe()
+		ap.path = path
+		if ap.SSID == "" {
+			// Hidden network.
+			continue
+		}
+		if existing, ok := strongest[ap.SSID]; !ok || ap.Strength > existing.Strength {
+			strongest[ap.SSID] = ap
+		}
+	}
+	var aps []AccessPoint
+	for _, ap := range strongest {
+		aps = append(aps, ap)
+	}
+	sort.Slice(aps, func(a, b int) bool {
+		if aps[a].Strength != aps[b].Strength {
+			return aps[a].Strength > aps[b].Strength
+		}
+		return aps[a].SSID < aps[b].SSID
+	})
+	return aps, nil
+}
+
+// Connect connects the device to the given access point, using a saved
+// connection for the network if one exists. For new secured networks,
+// NetworkManager will ask for credentials via its secret agent (e.g. the
+// desktop environment's network applet). Requires NetworkManager.
+func (i Info) Connect(ap AccessPoint) error {
+	if i.nm == nil {
+		return errNoNetworkManager
+	}
+	conn, err := savedConnection(ap.SSID)
+	if err != nil {
+		return err
+	}
+	nm := dbus.WatchProperties(busType, nmService, nmPath, nmIface)
+	defer nm.Unsubscribe()
+	if conn != "" {
+		_, err = nm.Call("ActivateConnection", conn, i.nm.path, ap.path)
+	} else {
+		_, err = nm.Call("AddAndActivateConnection",
+			map[string]map[string]godbus.Variant{}, i.nm.path, ap.path)
+	}
+	return err
+}
+
+// savedConnection returns the path of a saved connection for the given SSID,
+// or an empty path if there is none.
+func savedConnection(ssid string) (godbus.ObjectPath, error) {
+	settings := dbus.WatchProperties(busType, nmService, settingsPath, settingsIface)
+	r, err := settings.Call("ListConnections")
+	settings.Unsubscribe()
+	if err != nil {
+		return "", err
+	}
+	paths, _ := r[0].([]godbus.ObjectPath)
+	for _, path := range paths {
+		c := dbus.WatchProperties(busType, nmService, string(path), connectionIface)
+		r, err := c.Call("GetSettings")
+		c.Unsubscribe()
+		if err != nil || len(r) == 0 {
+			continue
+		}
+		s, _ := r[0].(map[string]map[string]godbus.Variant)
+		if b, ok := s["802-11-wireless"]["ssid"].Value().([]byte); ok && string(b) == ssid {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// ChooseNetwork shows a menu of the available wireless networks (see package
+// menu for configuration), and connects to the chosen one. This is intended
+// for use in click handlers. Requires NetworkManager.
+func (i Info) ChooseNetwork() error {
+	aps, err := i.AccessPoints()
+	if err != nil {
+		return err
+	}
+	// Ask for a fresh scan, so that the list is more up to date next time.
+	i.nm.device.Call("RequestScan", map[string]godbus.Variant{})
+	items := make([]string, len(aps))
+	for idx, ap := range aps {
+		items[idx] = ap.String()
+	}
+	idx, err := menu.Show("Wi-Fi", items...)
+	if err != nil || idx < 0 {
+		return err
+	}
+	return i.Connect(aps[idx])
+}
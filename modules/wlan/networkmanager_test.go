@@ -0,0 +1,240 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wlan
+
+import (
+	"sync"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/base/menu"
+	"barista.run/base/watchers/dbus"
+	"barista.run/base/watchers/netlink"
+	"barista.run/outputs"
+	testBar "barista.run/testing/bar"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
+)
+
+const testDevicePath = godbus.ObjectPath("/org/freedesktop/NetworkManager/Devices/3")
+
+type testNM struct {
+	svc    *dbus.TestBusService
+	device *dbus.TestBusObject
+	aps    []godbus.ObjectPath
+
+	mu        sync.Mutex
+	activated []interface{}
+	added     []interface{}
+	scans     int
+}
+
+func setupTestNM() *testNM {
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	nm := &testNM{svc: bus.RegisterService(nmService)}
+	root := nm.svc.Object(nmPath, nmIface)
+	root.On("GetDeviceByIpIface", func(args ...interface{}) ([]interface{}, error) {
+		return []interface{}{testDevicePath}, nil
+	})
+	root.On("ActivateConnection", func(args ...interface{}) ([]interface{}, error) {
+		nm.mu.Lock()
+		defer nm.mu.Unlock()
+		nm.activated = args
+		return []interface{}{godbus.ObjectPath("/active/1")}, nil
+	})
+	root.On("AddAndActivateConnection", func(args ...interface{}) ([]interface{}, error) {
+		nm.mu.Lock()
+		defer nm.mu.Unlock()
+		nm.added = args
+		return []interface{}{godbus.ObjectPath("/conn/2"), godbus.ObjectPath("/active/2")}, nil
+	})
+
+	saved := nm.svc.Object("/conn/1", connectionIface)
+	saved.On("GetSettings", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{map[string]map[string]godbus.Variant{
+			"802-11-wireless": {"ssid": godbus.MakeVariant([]byte("Home"))},
+		}}, nil
+	})
+	settings := nm.svc.Object(settingsPath, settingsIface)
+	settings.On("ListConnections", func(...interface{}) ([]interface{}, error) {
+		return []interface{}{[]godbus.ObjectPath{"/conn/1"}}, nil
+	})
+
+	nm.device = nm.svc.Object(testDevicePath, wirelessIface)
+	nm.device.On("RequestScan", func(...interface{}) ([]interface{}, error) {
+		nm.mu.Lock()
+		defer nm.mu.Unlock()
+		nm.scans++
+		return nil, nil
+	})
+	nm.device.SetProperties(map[string]interface{}{
+		"ActiveAccessPoint": godbus.ObjectPath("/"),
+		"AccessPoints":      []godbus.ObjectPath{},
+	}, dbus.SignalTypeNone)
+	return nm
+}
+
+func (n *testNM) addAP(path godbus.ObjectPath, ssid string, strength byte, mhz uint32, secure bool) *dbus.TestBusObject {
+	var rsn uint32
+	if secure {
+		rsn = 0x188
+	}
+	ap := n.svc.Object(path, apIface)
+	ap.SetProperties(map[string]interface{}{
+		"Ssid":      []byte(ssid),
+		"HwAddress": "00:11:22:33:44:55",
+		"Strength":  strength,
+		"Frequency": mhz,
+		"Flags":     uint32(0),
+		"WpaFlags":  uint32(0),
+		"RsnFlags":  rsn,
+	}, dbus.SignalTypeNone)
+	n.aps = append(n.aps, path)
+	n.device.SetProperty("AccessPoints",
+		append([]godbus.ObjectPath(nil), n.aps...), dbus.SignalTypeNone)
+	return ap
+}
+
+func TestNetworkManager(t *testing.T) {
+	nlt := netlink.TestMode()
+	nm := setupTestNM()
+	ap := nm.addAP("/ap/1", "Home", 72, 5180, true)
+	nm.addAP("/ap/2", "Cafe", 40, 2437, false)
+	nm.addAP("/ap/3", "Home", 30, 2412, true)
+	nm.addAP("/ap/4", "", 90, 2412, false)
+	nm.device.SetProperty("ActiveAccessPoint", godbus.ObjectPath("/ap/1"), dbus.SignalTypeNone)
+	nlt.AddLink(netlink.Link{Name: "wlan0", State: netlink.Up})
+
+	testBar.New(t)
+	var info Info
+	var infoMu sync.Mutex
+	wl := Named("wlan0").NetworkManager().Output(func(i Info) bar.Output {
+		infoMu.Lock()
+		defer infoMu.Unlock()
+		info = i
+		return outputs.Textf("%s %d%% %s ch%d", i.SSID, i.Strength, i.Band(), i.Channel)
+	})
+	testBar.Run(wl)
+	testBar.LatestOutput().AssertText([]string{"Home 72% 5 GHz ch36"})
+
+	ap.SetProperty("Strength", byte(65), dbus.SignalTypeChanged)
+	testBar.LatestOutput().AssertText([]string{"Home 65% 5 GHz ch36"},
+		"on access point property change")
+
+	nm.device.SetProperty("ActiveAccessPoint", godbus.ObjectPath("/ap/2"), dbus.SignalTypeChanged)
+	testBar.LatestOutput().AssertText([]string{"Cafe 40% 2.4 GHz ch6"},
+		"on active access point change")
+
+	infoMu.Lock()
+	i := info
+	infoMu.Unlock()
+	aps, err := i.AccessPoints()
+	require.NoError(t, err)
+	require.Equal(t, []AccessPoint{
+		{SSID: "Home", AccessPointMAC: "00:11:22:33:44:55", Strength: 65,
+			Frequency: 5180 * unit.Megahertz, Secure: true, path: "/ap/1"},
+		{SSID: "Cafe", AccessPointMAC: "00:11:22:33:44:55", Strength: 40,
+			Frequency: 2437 * unit.Megahertz, path: "/ap/2"},
+	}, aps, "strongest first, without duplicates or hidden networks")
+	require.Equal(t, "Home (65%, 5 GHz, secured)", aps[0].String())
+
+	scansBefore := len(scanned())
+	require.NoError(t, i.Rescan())
+	nm.mu.Lock()
+	require.Equal(t, 1, nm.scans, "rescan via NetworkManager")
+	nm.mu.Unlock()
+	require.Len(t, scanned(), scansBefore, "nl80211 not used with NetworkManager")
+
+	menu.SetCommand("sh", "-c", "sed -n 1p")
+	require.NoError(t, i.ChooseNetwork())
+	nm.mu.Lock()
+	require.Equal(t, []interface{}{godbus.ObjectPath("/conn/1"), testDevicePath, godbus.ObjectPath("/ap/1")},
+		nm.activated, "uses saved connection")
+	nm.mu.Unlock()
+
+	menu.SetCommand("sh", "-c", "sed -n 2p")
+	require.NoError(t, i.ChooseNetwork())
+	nm.mu.Lock()
+	require.Equal(t, testDevicePath, nm.added[1], "adds new connection")
+	require.Equal(t, godbus.ObjectPath("/ap/2"), nm.added[2])
+	nm.mu.Unlock()
+
+	menu.SetCommand("sh", "-c", "exit 1")
+	nm.mu.Lock()
+	nm.added = nil
+	nm.mu.Unlock()
+	require.NoError(t, i.ChooseNetwork(), "menu dismissed")
+	nm.mu.Lock()
+	require.Nil(t, nm.added)
+	nm.mu.Unlock()
+
+	nm.device.SetProperty("ActiveAccessPoint", godbus.ObjectPath("/"), dbus.SignalTypeChanged)
+	testBar.LatestOutput().AssertText([]string{" 0%  ch0"}, "when disconnected")
+}
+
+func TestNetworkManagerUnavailable(t *testing.T) {
+	nlt := netlink.TestMode()
+	dbus.SetupTestBus()
+	busType = dbus.Test
+	iwgetidShouldReturn("wlan2", map[string]string{
+		"-r": "Fallback",
+		"-a": "00:11:22:33:44:66",
+		"-c": "1",
+		"-f": "2.412e+09",
+	})
+	nlt.AddLink(netlink.Link{Name: "wlan2", State: netlink.Up})
+
+	testBar.New(t)
+	var info Info
+	var infoMu sync.Mutex
+	wl := Named("wlan2").NetworkManager().Output(func(i Info) bar.Output {
+		infoMu.Lock()
+		defer infoMu.Unlock()
+		info = i
+		return outputs.Textf("%s %s", i.SSID, i.Band())
+	})
+	testBar.Run(wl)
+	testBar.LatestOutput().AssertText([]string{"Fallback 2.4 GHz"}, "falls back to iwgetid")
+
+	infoMu.Lock()
+	defer infoMu.Unlock()
+	_, err := info.AccessPoints()
+	require.Error(t, err)
+	require.Error(t, info.ChooseNetwork())
+	require.Error(t, info.Connect(AccessPoint{SSID: "Fallback"}))
+}
+
+func TestBand(t *testing.T) {
+	for _, tc := range []struct {
+		mhz     float64
+		band    string
+		channel int
+	}{
+		{0, "", 0},
+		{2412, "2.4 GHz", 1},
+		{2484, "2.4 GHz", 14},
+		{5745, "5 GHz", 149},
+		{5955, "6 GHz", 1},
+		{60480, "60 GHz", 0},
+	} {
+		ap := AccessPoint{Frequency: unit.Frequency(tc.mhz) * unit.Megahertz}
+		require.Equal(t, tc.band, ap.Band(), "%v MHz", tc.mhz)
+		require.Equal(t, tc.channel, ap.Channel(), "%v MHz", tc.mhz)
+		require.Equal(t, tc.band, Info{Frequency: ap.Frequency}.Band())
+	}
+}
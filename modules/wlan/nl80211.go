@@ -0,0 +1,222 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wlan
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/martinlindhe/unit"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Station represents the link statistics for the connection to the access
+// point, as reported by nl80211. The counters are since association, so they
+// reset when roaming to a different access point.
+type Station struct {
+	// Signal strength in dBm, averaged if available.
+	Signal int
+	// Bitrates of the last transmitted and received frames.
+	TxBitrate unit.Datarate
+	RxBitrate unit.Datarate
+	TxPackets uint32
+	// TxRetries is the number of retransmissions, and TxFailed is the number
+	// of frames that could not be delivered even after retrying.
+	TxRetries  uint32
+	TxFailed   uint32
+	BeaconLoss uint32
+	// ConnectedTime is the time since association.
+	ConnectedTime time.Duration
+}
+
+// RetryRate returns the fraction of transmitted packets that were retried.
+// High retry rates usually point to interference, or a distant access point.
+func (s Station) RetryRate() float64 {
+	if s.TxPackets == 0 {
+		return 0
+	}
+	return float64(s.TxRetries) / float64(s.TxPackets)
+}
+
+// FailureRate returns the fraction of transmitted packets that could not be
+// delivered.
+func (s Station) FailureRate() float64 {
+	if s.TxPackets == 0 {
+		return 0
+	}
+	return float64(s.TxFailed) / float64(s.TxPackets)
+}
+
+// From include/uapi/linux/nl80211.h.
+const (
+	nl80211CmdGetStation  = 17
+	nl80211CmdTriggerScan = 33
+
+	nl80211AttrIfindex = 3
+	nl80211AttrStaInfo = 21
+
+	nl80211StaInfoSignal        = 7
+	nl80211StaInfoTxBitrate     = 8
+	nl80211StaInfoTxPackets     = 10
+	nl80211StaInfoTxRetries     = 11
+	nl80211StaInfoTxFailed      = 12
+	nl80211StaInfoSignalAvg     = 13
+	nl80211StaInfoRxBitrate     = 14
+	nl80211StaInfoConnectedTime = 16
+	nl80211StaInfoBeaconLoss    = 18
+
+	nl80211RateInfoBitrate   = 1 // u16, in 100 kbit/s.
+	nl80211RateInfoBitrate32 = 5 // u32, in 100 kbit/s.
+)
+
+var native = nl.NativeEndian()
+
+// Overridden in tests.
+var (
+	getStation  = nl80211Station
+	triggerScan = nl80211TriggerScan
+)
+
+// parseAttrs parses netlink attributes, ignoring the nested flag in types.
+func parseAttrs(b []byte) map[uint16][]byte {
+	attrs, _ := nl.ParseRouteAttr(b)
+	r := map[uint16][]byte{}
+	for _, a := range attrs {
+		r[a.Attr.Type&^unix.NLA_F_NESTED] = a.Value
+	}
+	return r
+}
+
+func u32(b []byte) uint32 {
+	if len(b) < 4 {
+		return 0
+	}
+	return native.Uint32(b)
+}
+
+func bitrate(b []byte) unit.Datarate {
+	attrs := parseAttrs(b)
+	rate := u32(attrs[nl80211RateInfoBitrate32])
+	if v := attrs[nl80211RateInfoBitrate]; rate == 0 && len(v) >= 2 {
+		rate = uint32(native.Uint16(v))
+	}
+	return unit.Datarate(rate) * 100 * unit.KilobitPerSecond
+}
+
+// parseStation parses a station from an NL80211_CMD_NEW_STATION message, which
+// includes the generic netlink header.
+func parseStation(msg []byte) (Station, bool) {
+	if len(msg) < nl.SizeofGenlmsg {
+		return Station{}, false
+	}
+	info, ok := parseAttrs(msg[nl.SizeofGenlmsg:])[nl80211AttrStaInfo]
+	if !ok {
+		return Station{}, false
+	}
+	attrs := parseAttrs(info)
+	var s Station
+	if v := attrs[nl80211StaInfoSignalAvg]; len(v) > 0 {
+		s.Signal = int(int8(v[0]))
+	} else if v := attrs[nl80211StaInfoSignal]; len(v) > 0 {
+		s.Signal = int(int8(v[0]))
+	}
+	s.TxBitrate = bitrate(attrs[nl80211StaInfoTxBitrate])
+	s.RxBitrate = bitrate(attrs[nl80211StaInfoRxBitrate])
+	s.TxPackets = u32(attrs[nl80211StaInfoTxPackets])
+	s.TxRetries = u32(attrs[nl80211StaInfoTxRetries])
+	s.TxFailed = u32(attrs[nl80211StaInfoTxFailed])
+	s.BeaconLoss = u32(attrs[nl80211StaInfoBeaconLoss])
+	s.ConnectedTime = time.Duration(u32(attrs[nl80211StaInfoConnectedTime])) * time.Second
+	return s, true
+}
+
+// nl80211Family returns the generic netlink family ID for nl80211.
+func nl80211Family() (int, error) {
+	req := nl.NewNetlinkRequest(nl.GENL_ID_CTRL, 0)
+	req.AddData(&nl.Genlmsg{
+		Command: nl.GENL_CTRL_CMD_GETFAMILY,
+		Version: nl.GENL_CTRL_VERSION,
+	})
+	req.AddData(nl.NewRtAttr(nl.GENL_CTRL_ATTR_FAMILY_NAME, nl.ZeroTerminated("nl80211")))
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range msgs {
+		if len(msg) < nl.SizeofGenlmsg {
+			continue
+		}
+		id := parseAttrs(msg[nl.SizeofGenlmsg:])[nl.GENL_CTRL_ATTR_FAMILY_ID]
+		if len(id) >= 2 {
+			return int(native.Uint16(id)), nil
+		}
+	}
+	return 0, errors.New("nl80211 is not available")
+}
+
+// nl80211Request builds a request for the given nl80211 command on an
+// interface.
+func nl80211Request(iface string, cmd uint8, flags int) (*nl.NetlinkRequest, error) {
+	intf, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	family, err := nl80211Family()
+	if err != nil {
+		return nil, err
+	}
+	req := nl.NewNetlinkRequest(family, flags)
+	req.AddData(&nl.Genlmsg{Command: cmd})
+	req.AddData(nl.NewRtAttr(nl80211AttrIfindex, nl.Uint32Attr(uint32(intf.Index))))
+	return req, nil
+}
+
+// nl80211Station returns the statistics for the access point that the given
+// interface is connected to.
+func nl80211Station(iface string) (Station, error) {
+	req, err := nl80211Request(iface, nl80211CmdGetStation, unix.NLM_F_DUMP)
+	if err != nil {
+		return Station{}, err
+	}
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return Station{}, err
+	}
+	// In station mode, the only station is the access point.
+	for _, msg := range msgs {
+		if s, ok := parseStation(msg); ok {
+			return s, nil
+		}
+	}
+	return Station{}, nil
+}
+
+// nl80211TriggerScan starts a scan on the given interface, which requires the
+// CAP_NET_ADMIN capability.
+func nl80211TriggerScan(iface string) error {
+	req, err := nl80211Request(iface, nl80211CmdTriggerScan, unix.NLM_F_ACK)
+	if err != nil {
+		return err
+	}
+	_, err = req.Execute(unix.NETLINK_GENERIC, 0)
+	if err == syscall.EBUSY {
+		// A scan is already in progress.
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wlan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+func u16Attr(v uint16) []byte {
+	b := make([]byte, 2)
+	native.PutUint16(b, v)
+	return b
+}
+
+// stationMsg builds an NL80211_CMD_NEW_STATION message with the given
+// station info attributes.
+func stationMsg(build func(info *nl.RtAttr)) []byte {
+	genl := &nl.Genlmsg{Command: 19}
+	msg := genl.Serialize()
+	msg = append(msg, nl.NewRtAttr(6, []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55}).Serialize()...)
+	info := nl.NewRtAttr(nl80211AttrStaInfo|unix.NLA_F_NESTED, nil)
+	build(info)
+	return append(msg, info.Serialize()...)
+}
+
+func TestParseStation(t *testing.T) {
+	s, ok := parseStation(stationMsg(func(info *nl.RtAttr) {
+		info.AddRtAttr(nl80211StaInfoSignal, []byte{byte(0x100 - 62)})
+		info.AddRtAttr(nl80211StaInfoSignalAvg, []byte{byte(0x100 - 60)})
+		tx := info.AddRtAttr(nl80211StaInfoTxBitrate|unix.NLA_F_NESTED, nil)
+		tx.AddRtAttr(nl80211RateInfoBitrate, u16Attr(8667))
+		tx.AddRtAttr(nl80211RateInfoBitrate32, nl.Uint32Attr(8667))
+		rx := info.AddRtAttr(nl80211StaInfoRxBitrate, nil)
+		rx.AddRtAttr(nl80211RateInfoBitrate, u16Attr(540))
+		info.AddRtAttr(nl80211StaInfoTxPackets, nl.Uint32Attr(1000))
+		info.AddRtAttr(nl80211StaInfoTxRetries, nl.Uint32Attr(120))
+		info.AddRtAttr(nl80211StaInfoTxFailed, nl.Uint32Attr(3))
+		info.AddRtAttr(nl80211StaInfoBeaconLoss, nl.Uint32Attr(2))
+		info.AddRtAttr(nl80211StaInfoConnectedTime, nl.Uint32Attr(3600))
+	}))
+	require.True(t, ok)
+	require.Equal(t, -60, s.Signal, "prefers average signal")
+	require.InDelta(t, 866.7, s.TxBitrate.MegabitsPerSecond(), 0.01)
+	require.InDelta(t, 54, s.RxBitrate.MegabitsPerSecond(), 0.01, "16-bit bitrate")
+	require.Equal(t, uint32(1000), s.TxPackets)
+	require.Equal(t, uint32(120), s.TxRetries)
+	require.Equal(t, uint32(3), s.TxFailed)
+	require.Equal(t, uint32(2), s.BeaconLoss)
+	require.Equal(t, time.Hour, s.ConnectedTime)
+	require.InDelta(t, 0.12, s.RetryRate(), 0.0001)
+	require.InDelta(t, 0.003, s.FailureRate(), 0.0001)
+
+	s, ok = parseStation(stationMsg(func(info *nl.RtAttr) {
+		info.AddRtAttr(nl80211StaInfoSignal, []byte{byte(0x100 - 71)})
+		info.AddRtAttr(nl80211StaInfoTxBitrate, nil)
+	}))
+	require.True(t, ok)
+	require.Equal(t, Station{Signal: -71}, s, "partial station info")
+	require.Equal(t, 0.0, s.RetryRate(), "without packets")
+	require.Equal(t, 0.0, s.FailureRate(), "without packets")
+
+	_, ok = parseStation([]byte{19, 0})
+	require.False(t, ok, "truncated message")
+	genl := &nl.Genlmsg{Command: 19}
+	_, ok = parseStation(genl.Serialize())
+	require.False(t, ok, "without station info")
+}
+
+func TestBitrate(t *testing.T) {
+	require.Equal(t, unit.Datarate(0), bitrate(nil))
+	require.Equal(t, 100*unit.KilobitPerSecond,
+		bitrate(nl.NewRtAttr(nl80211RateInfoBitrate, u16Attr(1)).Serialize()))
+}
@@ -14,20 +14,29 @@
 
 // Package wlan provides an i3bar module for wireless information.
 // NOTE: This module REQUIRES the external command "iwgetid",
-// because getting the SSID is a privileged operation.
+// because getting the SSID is a privileged operation, unless
+// NetworkManager is used instead. Link statistics such as the bitrate
+// and retry counters are read from nl80211.
 package wlan // import "barista.run/modules/wlan"
 
 import (
+	"errors"
 	"net"
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 
 	"barista.run/bar"
-	"barista.run/base/value"
+	"barista.run/base/click"
+	"barista.run/base/notifier"
 	"barista.run/base/watchers/netlink"
+	"barista.run/core"
 	l "barista.run/logging"
 	"barista.run/outputs"
+	"barista.run/timing"
+
+	godbus "github.com/godbus/dbus"
 	"github.com/martinlindhe/unit"
 )
 
@@ -40,6 +49,35 @@ type Info struct {
 	AccessPointMAC string
 	Channel        int
 	Frequency      unit.Frequency
+	// Signal strength in percent. Only available with NetworkManager.
+	Strength int
+	// Link statistics for the connection to the access point. These are
+	// only available while connected, and are refreshed periodically.
+	Station Station
+
+	nm *nmDevice
+}
+
+// Band returns the frequency band of the wireless network,
+// e.g. "2.4 GHz" or "5 GHz".
+func (i Info) Band() string {
+	return band(i.Frequency)
+}
+
+func band(freq unit.Frequency) string {
+	ghz := freq.Gigahertz()
+	switch {
+	case ghz <= 0:
+		return ""
+	case ghz < 3:
+		return "2.4 GHz"
+	case ghz < 5.925:
+		return "5 GHz"
+	case ghz < 7.2:
+		return "6 GHz"
+	default:
+		return "60 GHz"
+	}
 }
 
 // Connecting returns true if a connection is in progress.
@@ -57,21 +95,43 @@ func (i Info) Enabled() bool {
 	return i.State > netlink.NotPresent
 }
 
+// Rescan asks for a fresh scan for wireless networks, which can prompt the
+// device to roam to a better access point. With NetworkManager, the scan is
+// requested from NetworkManager, otherwise it is triggered via nl80211, which
+// usually requires the CAP_NET_ADMIN capability.
+func (i Info) Rescan() error {
+	if i.nm != nil {
+		_, err := i.nm.device.Call("RequestScan", map[string]godbus.Variant{})
+		return err
+	}
+	if i.Name == "" {
+		return errors.New("No wireless interface")
+	}
+	return triggerScan(i.Name)
+}
+
 // Module represents a wlan bar module.
 type Module struct {
 	intf       string
-	outputFunc value.Value // of func(Info) bar.Output
+	useNM      bool
+	scheduler  *timing.Scheduler
+	outputFunc core.OutputFunc // of func(Info) bar.Output
 }
 
 // Named constructs an instance of the wlan module for the specified interface.
 func Named(iface string) *Module {
-	m := &Module{intf: iface}
+	m := &Module{intf: iface, scheduler: timing.NewScheduler()}
 	l.Label(m, iface)
-	l.Register(m, "outputFunc")
-	// Default output is just the SSID when connected.
+	l.Register(m, "outputFunc", "scheduler")
+	m.RefreshInterval(5 * time.Second)
+	// Default output is just the SSID when connected, and rescans on click.
 	m.Output(func(i Info) bar.Output {
 		if i.Connected() {
-			return outputs.Text(i.SSID)
+			return outputs.Text(i.SSID).OnClick(click.Left(func() {
+				if err := i.Rescan(); err != nil {
+					l.Log("Failed to rescan %s: %v", i.Name, err)
+				}
+			}))
 		}
 		return nil
 	})
@@ -84,12 +144,29 @@ func Any() *Module {
 	return Named("")
 }
 
+// NetworkManager configures the module to get wireless information from
+// NetworkManager instead of iwgetid. This also provides the signal strength,
+// and allows listing and connecting to networks using Info.AccessPoints,
+// Info.Connect, and Info.ChooseNetwork. It must be called before the module
+// is started.
+func (m *Module) NetworkManager() *Module {
+	m.useNM = true
+	return m
+}
+
 // Output configures a module to display the output of a user-defined function.
 func (m *Module) Output(outputFunc func(Info) bar.Output) *Module {
 	m.outputFunc.Set(outputFunc)
 	return m
 }
 
+// RefreshInterval configures how often the link statistics (Info.Station) are
+// refreshed while connected. Other information is updated on changes.
+func (m *Module) RefreshInterval(interval time.Duration) *Module {
+	m.scheduler.Every(interval)
+	return m
+}
+
 // Stream starts the module.
 func (m *Module) Stream(s bar.Sink) {
 	outputFunc := m.outputFunc.Get().(func(Info) bar.Output)
@@ -104,28 +181,92 @@ func (m *Module) Stream(s bar.Sink) {
 	}
 	defer linkSub.Unsubscribe()
 
-	info := handleUpdate(linkSub.Get())
+	var nm *nmDevice
+	var nmUpdates <-chan struct{}
+	var notifyFn func()
+	if m.useNM {
+		notifyFn, nmUpdates = notifier.New()
+	}
+	defer func() {
+		if nm != nil {
+			nm.close()
+		}
+	}()
+
+	link := linkSub.Get()
+	nm = m.nmDevice(nm, link.Name, notifyFn)
+	info := handleUpdate(link, nm)
 	for {
 		s.Output(outputFunc(info))
 		select {
 		case <-linkSub.C:
-			info = handleUpdate(linkSub.Get())
+			link = linkSub.Get()
+			nm = m.nmDevice(nm, link.Name, notifyFn)
+			info = handleUpdate(link, nm)
+		case <-nmUpdates:
+			if nm != nil {
+				nm.updateAccessPoint()
+			}
+			info = handleUpdate(link, nm)
+		case <-m.scheduler.C:
+			if info.Connected() {
+				fillStation(&info)
+			}
 		case <-nextOutputFunc:
 			outputFunc = m.outputFunc.Get().(func(Info) bar.Output)
 		}
 	}
 }
 
-func handleUpdate(link netlink.Link) Info {
+// nmDevice returns the NetworkManager device for the given interface, reusing
+// the existing device if the interface has not changed. It returns nil if
+// NetworkManager is not used or not available.
+func (m *Module) nmDevice(existing *nmDevice, iface string, notifyFn func()) *nmDevice {
+	if !m.useNM {
+		return nil
+	}
+	if existing != nil {
+		if existing.iface == iface {
+			return existing
+		}
+		existing.close()
+	}
+	if iface == "" {
+		return nil
+	}
+	d, err := watchDevice(iface, notifyFn)
+	if err != nil {
+		l.Log("NetworkManager unavailable for %s: %v", iface, err)
+		return nil
+	}
+	return d
+}
+
+func handleUpdate(link netlink.Link, nm *nmDevice) Info {
 	info := Info{
 		Name:  link.Name,
 		State: link.State,
 		IPs:   link.IPs,
 	}
-	fillWifiInfo(&info)
+	if nm != nil {
+		nm.fill(&info)
+	} else {
+		fillWifiInfo(&info)
+	}
+	if info.Connected() {
+		fillStation(&info)
+	}
 	return info
 }
 
+func fillStation(info *Info) {
+	s, err := getStation(info.Name)
+	if err != nil {
+		l.Fine("No station info for %s: %v", info.Name, err)
+	}
+	info.Station = s
+}
+
 func fillWifiInfo(info *Info) {
 	ssid, err := iwgetid(info.Name, "-r")
 	if err != nil {
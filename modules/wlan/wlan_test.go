@@ -19,11 +19,15 @@ import (
 	"net"
 	"sync"
 	"testing"
+	"time"
 
 	"barista.run/bar"
 	"barista.run/base/watchers/netlink"
 	"barista.run/outputs"
 	testBar "barista.run/testing/bar"
+
+	"github.com/martinlindhe/unit"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNoWlan(t *testing.T) {
@@ -61,8 +65,45 @@ func iwgetidShouldReturn(intf string, data map[string]string) {
 	testData[intf] = data
 }
 
+// Map of interface -> station info, and a list of interfaces scanned.
+var (
+	stations = map[string]Station{}
+	scans    []string
+)
+
+func mockStation(intf string) (Station, error) {
+	testMu.RLock()
+	defer testMu.RUnlock()
+	s, ok := stations[intf]
+	if !ok {
+		return Station{}, errors.New("No station")
+	}
+	return s, nil
+}
+
+func stationShouldReturn(intf string, s Station) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	stations[intf] = s
+}
+
+func mockScan(intf string) error {
+	testMu.Lock()
+	defer testMu.Unlock()
+	scans = append(scans, intf)
+	return nil
+}
+
+func scanned() []string {
+	testMu.RLock()
+	defer testMu.RUnlock()
+	return append([]string(nil), scans...)
+}
+
 func init() {
 	iwgetid = mockIwgetid
+	getStation = mockStation
+	triggerScan = mockScan
 }
 
 func TestWlan(t *testing.T) {
@@ -157,3 +198,75 @@ func TestWlan(t *testing.T) {
 	nlt.RemoveLink(link0)
 	testBar.LatestOutput(0, 2).AssertText([]string{"<no wlan>"}, "when no links remain")
 }
+
+func TestStation(t *testing.T) {
+	nlt := netlink.TestMode()
+	iwgetidShouldReturn("wlan3", map[string]string{
+		"-r": "Roaming",
+		"-a": "00:11:22:33:44:77",
+		"-c": "36",
+		"-f": "5.18e+09",
+	})
+	stationShouldReturn("wlan3", Station{
+		Signal:    -60,
+		TxBitrate: 866.7 * unit.MegabitPerSecond,
+		TxPackets: 1000,
+		TxRetries: 50,
+		TxFailed:  2,
+	})
+	link := nlt.AddLink(netlink.Link{Name: "wlan3", State: netlink.Up})
+
+	testBar.New(t)
+	wl := Named("wlan3").RefreshInterval(time.Minute).Output(func(i Info) bar.Output {
+		return outputs.Textf("%s %s %d dBm %.0f Mbit/s %.1f%% %.1f%%",
+			i.SSID, i.Band(), i.Station.Signal,
+			i.Station.TxBitrate.MegabitsPerSecond(),
+			i.Station.RetryRate()*100, i.Station.FailureRate()*100)
+	})
+	testBar.Run(wl)
+	testBar.NextOutput().AssertText(
+		[]string{"Roaming 5 GHz -60 dBm 867 Mbit/s 5.0% 0.2%"})
+
+	stationShouldReturn("wlan3", Station{
+		Signal:    -75,
+		TxBitrate: 54 * unit.MegabitPerSecond,
+		TxPackets: 2000,
+		TxRetries: 500,
+		TxFailed:  20,
+	})
+	testBar.Tick()
+	testBar.NextOutput("on refresh").AssertText(
+		[]string{"Roaming 5 GHz -75 dBm 54 Mbit/s 25.0% 1.0%"})
+
+	nlt.UpdateLink(link, netlink.Link{Name: "wlan3", State: netlink.Down})
+	testBar.LatestOutput().AssertText(
+		[]string{"Roaming 5 GHz 0 dBm 0 Mbit/s 0.0% 0.0%"},
+		"no station info while disconnected")
+
+	stationShouldReturn("wlan3", Station{Signal: -50})
+	testBar.Tick()
+	testBar.NextOutput("on tick").AssertText(
+		[]string{"Roaming 5 GHz 0 dBm 0 Mbit/s 0.0% 0.0%"},
+		"no refresh while disconnected")
+}
+
+func TestRescan(t *testing.T) {
+	nlt := netlink.TestMode()
+	testMu.Lock()
+	scans = nil
+	testMu.Unlock()
+	iwgetidShouldReturn("wlan4", map[string]string{"-r": "Scanned"})
+	nlt.AddLink(netlink.Link{Name: "wlan4", State: netlink.Up})
+
+	testBar.New(t)
+	testBar.Run(Named("wlan4"))
+	out := testBar.NextOutput()
+	out.AssertText([]string{"Scanned"})
+	out.At(0).LeftClick()
+
+	for i := 0; i < 100 && len(scanned()) == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Equal(t, []string{"wlan4"}, scanned(), "rescan on click")
+	require.Error(t, Info{}.Rescan(), "without an interface")
+}
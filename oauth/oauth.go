@@ -31,6 +31,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"barista.run/base/httpclient"
 	l "barista.run/logging"
 
 	"golang.org/x/oauth2"
@@ -44,6 +45,7 @@ type Config struct {
 	filename string
 	// For more context during interactive auth
 	domain  string
+	account string
 	callers []string
 	// To support automatic saving of refreshed tokens.
 	tokenSource oauth2.TokenSource
@@ -77,16 +79,30 @@ func getConfigDir() string {
 // added to the interactive oauth setup, so modules should usually call this
 // either in init() or in their New() functions.
 func Register(config *oauth2.Config) *Config {
+	return register(config, "")
+}
+
+// RegisterAccount registers an oauth2 configuration for a named account, which
+// allows modules to use the same configuration (and hence the same client ID
+// and scopes) with multiple accounts, each with its own token. The name is
+// only used to identify the account in the interactive setup and the token
+// filename, and need not match the account's username.
+func RegisterAccount(config *oauth2.Config, account string) *Config {
+	return register(config, account)
+}
+
+func register(config *oauth2.Config, account string) *Config {
 	if atomic.LoadInt32(&setupHasBeenCalled) != 0 {
 		panic("Cannot register after setup has been called!")
 	}
 	providerU, _ := url.Parse(config.Endpoint.AuthURL)
 	c := &Config{
-		config: config,
-		domain: providerU.Hostname(),
+		config:  config,
+		domain:  providerU.Hostname(),
+		account: account,
 	}
 	caller := "<unknown>"
-	pc, _, _, ok := runtime.Caller(1)
+	pc, _, _, ok := runtime.Caller(2)
 	if ok {
 		caller = runtime.FuncForPC(pc).Name()
 	}
@@ -100,6 +116,11 @@ func Register(config *oauth2.Config) *Config {
 	for _, scope := range config.Scopes {
 		io.WriteString(hasher, scope)
 	}
+	if account != "" {
+		// Separator, so that the account cannot be confused with a scope.
+		io.WriteString(hasher, "\x00")
+		io.WriteString(hasher, account)
+	}
 	hash := base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
 	filename := filepath.Join(configDir,
 		fmt.Sprintf("%s_%s.json", c.domain, hash))
@@ -175,13 +196,17 @@ func commas(s []string) string {
 }
 
 func (c *Config) prompt(index, total int, force bool) bool {
-	fmt.Fprintf(stdout, "\n[%d of %d] %s\n* Domain: %s\n* Scopes: %s\n",
-		index+1, total, commas(c.callers), c.domain, commas(c.config.Scopes))
+	fmt.Fprintf(stdout, "\n[%d of %d] %s\n* Domain: %s\n",
+		index+1, total, commas(c.callers), c.domain)
+	if c.account != "" {
+		fmt.Fprintf(stdout, "* Account: %s\n", c.account)
+	}
+	fmt.Fprintf(stdout, "* Scopes: %s\n", commas(c.config.Scopes))
 
 	err := c.autoUpdateToken()
 	if err == nil {
 		if force && c.token.RefreshToken != "" {
-			c.tokenSource = c.config.TokenSource(context.Background(), c.token)
+			c.tokenSource = c.config.TokenSource(httpContext(), c.token)
 			c.token.Expiry = time.Now().Add(-time.Hour)
 		}
 		if !c.token.Valid() {
@@ -204,7 +229,7 @@ func (c *Config) prompt(index, total int, force bool) bool {
 	fmt.Fprintf(stdout, "- Visit %v and enter the code here:\n> ", authURL)
 	var authCode string
 	if _, err = fmt.Fscan(stdin, &authCode); err == nil {
-		c.token, err = c.config.Exchange(oauth2.NoContext, authCode)
+		c.token, err = c.config.Exchange(httpContext(), authCode)
 	}
 	if err == nil {
 		err = storeToken(c.filename, c.token)
@@ -240,7 +265,7 @@ func (c *Config) Token() (*oauth2.Token, error) {
 		if err := c.autoUpdateToken(); err != nil {
 			return nil, err
 		}
-		c.tokenSource = c.config.TokenSource(context.Background(), c.token)
+		c.tokenSource = c.config.TokenSource(httpContext(), c.token)
 	}
 	if c.token.Valid() {
 		return c.token, nil
@@ -258,5 +283,11 @@ func (c *Config) Token() (*oauth2.Token, error) {
 func (c *Config) Client() (*http.Client, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return oauth2.NewClient(context.Background(), c), c.autoUpdateToken()
+	return oauth2.NewClient(httpContext(), c), c.autoUpdateToken()
+}
+
+// httpContext returns a context that makes oauth2 use the shared barista http
+// client for token requests and as the base for authenticated clients.
+func httpContext() context.Context {
+	return context.WithValue(context.Background(), oauth2.HTTPClient, httpclient.Client())
 }
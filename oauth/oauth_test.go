@@ -245,6 +245,62 @@ All tokens updated successfully
 	require.Equal(3, len(entries), "All tokens saved to separate files")
 }
 
+func TestOauthAccounts(t *testing.T) {
+	require := require.New(t)
+	mockStdout, mockStdin, exitCode := resetForTest()
+
+	config := func() *oauth2.Config {
+		return &oauth2.Config{
+			Endpoint:     testEndpoint,
+			ClientID:     "ClientID",
+			ClientSecret: "not-really-secret",
+			RedirectURL:  "localhost:1",
+			Scopes:       []string{"a"},
+		}
+	}
+	work := RegisterAccount(config(), "work")
+	require.Equal(work, RegisterAccount(config(), "work"),
+		"same account returns existing config")
+	RegisterAccount(config(), "home")
+	Register(config())
+
+	os.Args = []string{"arg0", "setup-oauth"}
+	go InteractiveSetup()
+	for i := 0; i < 3; i++ {
+		mockStdin.Write([]byte("authcode\n"))
+	}
+	assertExitCode(t, exitCode, 0)
+
+	require.Equal(
+		`Updating registered Oauth configurations:
+
+[1 of 3] #pkg#.#testName#
+* Domain: #host#
+* Account: work
+* Scopes: a
+- Visit #authURL# and enter the code here:
+> + Successfully updated token, expires #expiry#
+
+[2 of 3] #pkg#.#testName#
+* Domain: #host#
+* Account: home
+* Scopes: a
+- Visit #authURL# and enter the code here:
+> + Successfully updated token, expires #expiry#
+
+[3 of 3] #pkg#.#testName#
+* Domain: #host#
+* Scopes: a
+- Visit #authURL# and enter the code here:
+> + Successfully updated token, expires #expiry#
+
+All tokens updated successfully
+`, sanitiseOauthOutput(mockStdout.ReadNow()))
+
+	entries, _ := afero.ReadDir(fs, "/conf/dir/")
+	require.Equal(3, len(entries), "Each account saved to a separate file")
+}
+
 func TestOauthSavedToken(t *testing.T) {
 	require := require.New(t)
 	mockStdout, _, exitCode := resetForTest()
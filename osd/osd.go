@@ -0,0 +1,225 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package osd provides on-screen display indicators that modules can use to
+// briefly show a value whenever it changes, e.g. when the volume or screen
+// brightness is adjusted using hardware keys. Indicators can show the value
+// on the bar itself, replacing the module's output for a short time, or as a
+// desktop notification that acts as an overlay.
+package osd // import "barista.run/osd"
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/value"
+	"barista.run/base/watchers/dbus"
+	"barista.run/core"
+	l "barista.run/logging"
+	"barista.run/outputs"
+
+	godbus "github.com/godbus/dbus"
+)
+
+// Kind identifies the type of value being shown.
+type Kind string
+
+// Kinds of values shown by the modules that support indicators.
+const (
+	Volume           Kind = "volume"
+	Brightness       Kind = "brightness"
+	ColorTemperature Kind = "color-temperature"
+)
+
+// Event represents a change in value to be shown by an indicator.
+type Event struct {
+	Kind Kind
+	// Fraction is the new value as a fraction of its range, from 0 to 1.
+	Fraction float64
+	// Muted is true if the value is muted or disabled, e.g. a muted volume.
+	Muted bool
+	// Text is a short description of the value, e.g. "42%" or "4500K".
+	Text string
+}
+
+// Pct returns the value of the event in the range 0-100.
+func (e Event) Pct() int {
+	return int((e.Fraction * 100) + 0.5)
+}
+
+// Indicator shows the new value whenever it changes.
+type Indicator interface {
+	// Show returns an output that the module sends after its regular output,
+	// or nil if the indicator is not shown on the bar.
+	Show(Event) bar.Output
+}
+
+// Meter returns a horizontal bar of the given width that is filled in
+// proportion to the given fraction, e.g. "██████░░░░" for 0.6.
+func Meter(fraction float64, width int) string {
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction*float64(width) + 0.5)
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
+
+// OnBarIndicator shows the value on the bar, in place of the module's output,
+// for a short time after each change.
+type OnBarIndicator struct {
+	duration   value.Value     // of time.Duration
+	outputFunc core.OutputFunc // of func(Event) bar.Output
+}
+
+// OnBar constructs an indicator that shows the value on the bar. By default,
+// it shows a meter and the value for 2 seconds.
+func OnBar() *OnBarIndicator {
+	o := &OnBarIndicator{}
+	l.Register(o, "duration", "outputFunc")
+	o.Duration(2 * time.Second)
+	o.Output(func(e Event) bar.Output {
+		return outputs.Textf("%s %s", Meter(e.Fraction, 10), e.Text)
+	})
+	return o
+}
+
+// Duration sets how long the indicator is shown after the last change.
+func (o *OnBarIndicator) Duration(duration time.Duration) *OnBarIndicator {
+	o.duration.Set(duration)
+	return o
+}
+
+// Output configures the indicator to display the output of a user-defined
+// function.
+func (o *OnBarIndicator) Output(outputFunc func(Event) bar.Output) *OnBarIndicator {
+	o.outputFunc.Set(outputFunc)
+	return o
+}
+
+// Show returns a transient output that replaces the module's output until
+// the indicator's duration has passed.
+func (o *OnBarIndicator) Show(e Event) bar.Output {
+	outputFunc := o.outputFunc.Get().(func(Event) bar.Output)
+	return outputs.Transient(outputFunc(e), o.duration.Get().(time.Duration))
+}
+
+// Overridden in tests.
+var busType = dbus.Session
+
+const (
+	notifyService = "org.freedesktop.Notifications"
+	notifyPath    = "/org/freedesktop/Notifications"
+	notifyIface   = "org.freedesktop.Notifications"
+)
+
+// OverlayIndicator shows the value as a desktop notification, using the
+// hints supported by dunst, mako, and most other notification daemons to
+// display a progress bar and replace the previous notification of the same
+// kind instead of stacking them.
+type OverlayIndicator struct {
+	timeout value.Value // of time.Duration
+
+	mu  sync.Mutex
+	w   *dbus.PropertiesWatcher
+	ids map[Kind]uint32
+}
+
+// Overlay constructs an indicator that shows the value as a desktop
+// notification, which is dismissed after 2 seconds by default.
+func Overlay() *OverlayIndicator {
+	o := &OverlayIndicator{ids: map[Kind]uint32{}}
+	l.Register(o, "timeout", "w")
+	o.Timeout(2 * time.Second)
+	return o
+}
+
+// Timeout sets how long the notification is shown after the last change.
+func (o *OverlayIndicator) Timeout(timeout time.Duration) *OverlayIndicator {
+	o.timeout.Set(timeout)
+	return o
+}
+
+// Show sends a notification for the event, replacing any previous
+// notification of the same kind. It returns nil since nothing is shown on
+// the bar.
+func (o *OverlayIndicator) Show(e Event) bar.Output {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.w == nil {
+		// The watcher follows the notification daemon if it is restarted,
+		// and lives as long as the indicator.
+		o.w = dbus.WatchProperties(busType, notifyService, notifyPath, notifyIface)
+	}
+	hints := map[string]godbus.Variant{
+		"value":                           godbus.MakeVariant(int32(e.Pct())),
+		"synchronous":                     godbus.MakeVariant(string(e.Kind)),
+		"x-canonical-private-synchronous": godbus.MakeVariant(string(e.Kind)),
+		"x-dunst-stack-tag":               godbus.MakeVariant(string(e.Kind)),
+	}
+	timeout := o.timeout.Get().(time.Duration)
+	res, err := o.w.Call("Notify", "barista", o.ids[e.Kind], iconName(e),
+		summary(e.Kind), e.Text, []string{}, hints,
+		int32(timeout/time.Millisecond))
+	if err != nil {
+		l.Log("Failed to show %s notification: %v", e.Kind, err)
+		return nil
+	}
+	if len(res) > 0 {
+		if id, ok := res[0].(uint32); ok {
+			o.ids[e.Kind] = id
+		}
+	}
+	return nil
+}
+
+func summary(k Kind) string {
+	switch k {
+	case Volume:
+		return "Volume"
+	case Brightness:
+		return "Brightness"
+	case ColorTemperature:
+		return "Color temperature"
+	default:
+		return string(k)
+	}
+}
+
+// iconName returns the freedesktop icon name for the event.
+func iconName(e Event) string {
+	switch e.Kind {
+	case Volume:
+		switch {
+		case e.Muted:
+			return "audio-volume-muted"
+		case e.Fraction < 0.34:
+			return "audio-volume-low"
+		case e.Fraction < 0.67:
+			return "audio-volume-medium"
+		default:
+			return "audio-volume-high"
+		}
+	case Brightness:
+		return "display-brightness"
+	case ColorTemperature:
+		return "night-light"
+	default:
+		return ""
+	}
+}
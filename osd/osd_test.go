@@ -0,0 +1,120 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osd
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/base/watchers/dbus"
+	"barista.run/outputs"
+	testOutput "barista.run/testing/output"
+	"barista.run/timing"
+
+	godbus "github.com/godbus/dbus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeter(t *testing.T) {
+	require.Equal(t, "░░░░░░░░░░", Meter(0, 10))
+	require.Equal(t, "██████░░░░", Meter(0.6, 10))
+	require.Equal(t, "█████", Meter(1.5, 5), "clamped to full")
+	require.Equal(t, "░░░░░", Meter(-1, 5), "clamped to empty")
+	require.Equal(t, 42, Event{Fraction: 0.42}.Pct())
+}
+
+func TestOnBar(t *testing.T) {
+	timing.TestMode()
+	e := Event{Kind: Volume, Fraction: 0.5, Text: "50%"}
+
+	o := OnBar().Show(e)
+	tr, ok := o.(bar.TransientOutput)
+	require.True(t, ok, "on-bar indicator returns transient output")
+	require.Equal(t, 2*time.Second, tr.TransientDuration())
+	testOutput.New(t, o).AssertText([]string{"█████░░░░░ 50%"})
+
+	ind := OnBar().Duration(time.Second).Output(func(e Event) bar.Output {
+		return outputs.Textf("%s: %d", e.Kind, e.Pct())
+	})
+	o = ind.Show(e)
+	require.Equal(t, time.Second, o.(bar.TransientOutput).TransientDuration())
+	testOutput.New(t, o).AssertText([]string{"volume: 50"})
+
+	ind.Output(func(e Event) bar.Output { panic("oops") })
+	testOutput.New(t, ind.Show(e)).AssertText([]string{"█████░░░░░ 50%", "!"},
+		"falls back to default output on panic")
+}
+
+type notification struct {
+	replaces uint32
+	icon     string
+	summary  string
+	body     string
+	value    int32
+	tag      string
+	timeout  int32
+}
+
+func TestOverlay(t *testing.T) {
+	bus := dbus.SetupTestBus()
+	busType = dbus.Test
+	require.Nil(t, Overlay().Show(Event{Kind: Volume, Text: "0%"}),
+		"without a notification daemon")
+
+	obj := bus.RegisterService(notifyService).Object(notifyPath, notifyIface)
+	notifications := make(chan notification, 10)
+	nextID := uint32(0)
+	obj.On("Notify", func(args ...interface{}) ([]interface{}, error) {
+		hints := args[6].(map[string]godbus.Variant)
+		notifications <- notification{
+			replaces: args[1].(uint32),
+			icon:     args[2].(string),
+			summary:  args[3].(string),
+			body:     args[4].(string),
+			value:    hints["value"].Value().(int32),
+			tag:      hints["x-dunst-stack-tag"].Value().(string),
+			timeout:  args[7].(int32),
+		}
+		nextID++
+		return []interface{}{nextID}, nil
+	})
+
+	ind := Overlay()
+	require.Nil(t, ind.Show(Event{Kind: Volume, Fraction: 0.8, Text: "80%"}),
+		"nothing shown on the bar")
+	require.Equal(t, notification{
+		icon: "audio-volume-high", summary: "Volume", body: "80%",
+		value: 80, tag: "volume", timeout: 2000,
+	}, <-notifications)
+
+	ind.Show(Event{Kind: Volume, Fraction: 0.2, Muted: true, Text: "MUT"})
+	require.Equal(t, notification{
+		replaces: 1, icon: "audio-volume-muted", summary: "Volume",
+		body: "MUT", value: 20, tag: "volume", timeout: 2000,
+	}, <-notifications, "replaces previous notification")
+
+	ind.Timeout(500 * time.Millisecond)
+	ind.Show(Event{Kind: Brightness, Fraction: 0.3, Text: "30%"})
+	require.Equal(t, notification{
+		icon: "display-brightness", summary: "Brightness", body: "30%",
+		value: 30, tag: "brightness", timeout: 500,
+	}, <-notifications, "separate notification for each kind")
+
+	ind.Show(Event{Kind: Volume, Fraction: 0.5, Text: "50%"})
+	n := <-notifications
+	require.Equal(t, uint32(2), n.replaces)
+	require.Equal(t, "audio-volume-medium", n.icon)
+}
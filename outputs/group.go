@@ -36,8 +36,10 @@ type SegmentGroup struct {
 	color          color.Color
 	background     color.Color
 	border         color.Color
+	borderWidth    int
 	minWidth       int
 	align          bar.TextAlignment
+	tooltip        string
 	urgent         bool
 	innerSeparator bool
 	innerPadding   int
@@ -52,6 +54,7 @@ const (
 	sgaInnerPadding
 	sgaOuterSeparator
 	sgaOuterPadding
+	sgaBorderWidth
 )
 
 // OnClick sets the default click handler for the group. Any segments
@@ -79,12 +82,26 @@ func (g *SegmentGroup) Border(border color.Color) *SegmentGroup {
 	return g
 }
 
+// BorderWidth sets the border width on all sides for all segments in the group.
+// Segments that already have a width set for any side will keep that width.
+func (g *SegmentGroup) BorderWidth(width int) *SegmentGroup {
+	g.attrSet |= sgaBorderWidth
+	g.borderWidth = width
+	return g
+}
+
 // Align sets the text alignment for all segments in the group.
 func (g *SegmentGroup) Align(align bar.TextAlignment) *SegmentGroup {
 	g.align = align
 	return g
 }
 
+// Tooltip sets the tooltip for all segments in the group.
+func (g *SegmentGroup) Tooltip(tooltip string) *SegmentGroup {
+	g.tooltip = tooltip
+	return g
+}
+
 // Urgent sets the urgency flag for all segments in the group.
 func (g *SegmentGroup) Urgent(urgent bool) *SegmentGroup {
 	g.attrSet |= sgaUrgent
@@ -214,9 +231,26 @@ func (g *SegmentGroup) Segments() []*bar.Segment {
 		if !isSet(s.GetBorder()) && g.border != nil {
 			s.Border(g.border)
 		}
+		if g.attrSet&sgaBorderWidth != 0 {
+			if !isSet(s.GetBorderTop()) {
+				s.BorderTop(g.borderWidth)
+			}
+			if !isSet(s.GetBorderRight()) {
+				s.BorderRight(g.borderWidth)
+			}
+			if !isSet(s.GetBorderBottom()) {
+				s.BorderBottom(g.borderWidth)
+			}
+			if !isSet(s.GetBorderLeft()) {
+				s.BorderLeft(g.borderWidth)
+			}
+		}
 		if !isSet(s.GetAlignment()) && g.align != "" {
 			s.Align(g.align)
 		}
+		if !isSet(s.GetTooltip()) && g.tooltip != "" {
+			s.Tooltip(g.tooltip)
+		}
 		if !isSet(s.IsUrgent()) && g.attrSet&sgaUrgent != 0 {
 			s.Urgent(g.urgent)
 		}
@@ -70,6 +70,27 @@ func TestSegmentGroup(t *testing.T) {
 		func(s *bar.Segment) (interface{}, bool) { return s.GetBorder() },
 		"sets border for all segments")
 
+	out.BorderWidth(2)
+	assertAllEqual(2,
+		func(s *bar.Segment) (interface{}, bool) { return s.GetBorderTop() },
+		"sets border width for all segments")
+	assertAllEqual(2,
+		func(s *bar.Segment) (interface{}, bool) { return s.GetBorderLeft() },
+		"sets border width for all segments")
+	bordered := Group(bar.TextSegment("x").BorderBottom(0)).BorderWidth(3)
+	width, _ := bordered.Segments()[0].GetBorderBottom()
+	require.Equal(0, width, "keeps border width set on segment")
+	width, _ = bordered.Segments()[0].GetBorderTop()
+	require.Equal(3, width, "sets unset border widths")
+
+	out.Tooltip("details")
+	assertAllEqual("details",
+		func(s *bar.Segment) (interface{}, bool) { return s.GetTooltip() },
+		"sets tooltip for all segments")
+	tooltip, _ := Group(bar.TextSegment("x").Tooltip("mine")).
+		Tooltip("group").Segments()[0].GetTooltip()
+	require.Equal("mine", tooltip, "keeps tooltip set on segment")
+
 	out.Urgent(true)
 	assertAllEqual(true,
 		func(s *bar.Segment) (interface{}, bool) { return s.IsUrgent() },
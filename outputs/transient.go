@@ -0,0 +1,57 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outputs
+
+import (
+	"time"
+
+	"barista.run/bar"
+)
+
+// Transient shows the given output for the given duration, after which the
+// module's previous output is shown again. Any other output from the module
+// while the transient output is shown is deferred until it expires, and a new
+// transient output replaces the current one. Timed outputs are supported, e.g.
+// for an animated OSD-style volume bar. The transient output must be sent to
+// the module's sink directly, since grouping it with other outputs will make
+// it permanent.
+func Transient(output bar.Output, duration time.Duration) bar.TransientOutput {
+	return transient{output, duration}
+}
+
+type transient struct {
+	output   bar.Output
+	duration time.Duration
+}
+
+func (t transient) Segments() []*bar.Segment {
+	if t.output == nil {
+		return nil
+	}
+	return t.output.Segments()
+}
+
+// NextRefresh implements bar.TimedOutput, so that timed outputs are refreshed
+// while they are shown.
+func (t transient) NextRefresh() time.Time {
+	if timed, ok := t.output.(bar.TimedOutput); ok {
+		return timed.NextRefresh()
+	}
+	return time.Time{}
+}
+
+func (t transient) TransientDuration() time.Duration {
+	return t.duration
+}
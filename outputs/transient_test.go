@@ -0,0 +1,47 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outputs
+
+import (
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransient(t *testing.T) {
+	timing.TestMode()
+
+	o := Transient(Text("Copied!"), 2*time.Second)
+	require.Equal(t, 2*time.Second, o.TransientDuration())
+	timed, ok := o.(bar.TimedOutput)
+	require.True(t, ok, "transient outputs are timed outputs")
+	require.True(t, timed.NextRefresh().IsZero(), "static transient output")
+	assertCurrentTexts(t, timed, []string{"Copied!"})
+
+	start := timing.Now()
+	o = Transient(Repeat(func(now time.Time) bar.Output {
+		return Textf("%v", now.Sub(start))
+	}).Every(time.Second), time.Minute)
+	timed = o.(bar.TimedOutput)
+	assertCurrentTexts(t, timed, []string{"0s"})
+	assertNextTexts(t, timed, []string{"1s"}, "timed transient output")
+
+	o = Transient(nil, time.Second)
+	require.Empty(t, o.Segments())
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package wayland provides an experimental bar that draws itself on wayland
+compositors that support the wlr-layer-shell protocol (e.g. sway), instead of
+sending output to a status bar such as swaybar using the i3bar protocol.
+
+Text is rendered using pango and cairo, which requires building with
+'-tags pango' (and the pangocairo development files), or a custom TextRenderer
+can be set using Text(...).
+
+Segment tooltips are shown in a popup when the pointer is over the segment, if
+the compositor supports xdg-shell popups. Otherwise, the TooltipHandler is
+called instead (by default, this shows a desktop notification).
+
+A bar is created and run with the same modules as a regular barista bar, and
+is shown on all outputs unless different modules are set for an output:
+
+	wayland.New().Height(22).Font("Fira Sans 10").
+		Output("HDMI-1", clock.Local()).
+		Run(clock.Local(), battery.All())
+*/
+package wayland // import "barista.run/render/wayland"
+
+import (
+	"image/color"
+	"os/exec"
+
+	"barista.run/bar"
+	"barista.run/base/sdnotify"
+	"barista.run/core"
+	"barista.run/oauth"
+)
+
+// Bar is a bar drawn directly on a wayland layer-shell surface.
+type Bar struct {
+	height       int
+	bottom       bool
+	font         string
+	text         TextRenderer
+	textPadding  int
+	colors       colors
+	errorHandler func(bar.ErrorEvent)
+	// Used when the compositor cannot show popups.
+	tooltipHandler func(bar.TooltipEvent)
+	// Modules for specific outputs, by output name.
+	outputs map[string][]bar.Module
+}
+
+type colors struct {
+	foreground       color.Color
+	background       color.Color
+	separator        color.Color
+	urgentForeground color.Color
+	urgentBackground color.Color
+	hover            color.Color
+}
+
+// New creates a new wayland bar, with a default height of 24px at the top of
+// the screen.
+func New() *Bar {
+	return &Bar{
+		height:      24,
+		font:        "monospace 10",
+		textPadding: 4,
+		colors: colors{
+			foreground:       color.White,
+			background:       color.Black,
+			separator:        color.Gray{0x66},
+			urgentForeground: color.White,
+			urgentBackground: color.RGBA{0x90, 0x00, 0x00, 0xff},
+		},
+		errorHandler:   DefaultErrorHandler,
+		tooltipHandler: DefaultTooltipHandler,
+	}
+}
+
+// Height sets the height of the bar, in px.
+func (b *Bar) Height(height int) *Bar {
+	b.height = height
+	return b
+}
+
+// Bottom places the bar at the bottom of the screen.
+func (b *Bar) Bottom() *Bar {
+	b.bottom = true
+	return b
+}
+
+// Font sets the pango font description used for text, e.g. "monospace 10".
+func (b *Bar) Font(font string) *Bar {
+	b.font = font
+	return b
+}
+
+// Text sets a custom renderer for text, replacing pango.
+func (b *Bar) Text(renderer TextRenderer) *Bar {
+	b.text = renderer
+	return b
+}
+
+// TextPadding sets the horizontal space between the text of a segment and its
+// edges (or borders), in px.
+func (b *Bar) TextPadding(padding int) *Bar {
+	b.textPadding = padding
+	return b
+}
+
+// Colors sets the default text colour and the background colour of the bar.
+func (b *Bar) Colors(foreground, background color.Color) *Bar {
+	b.colors.foreground = foreground
+	b.colors.background = background
+	return b
+}
+
+// Separator sets the colour of the separators between segments. A nil colour
+// hides all separators.
+func (b *Bar) Separator(separator color.Color) *Bar {
+	b.colors.separator = separator
+	return b
+}
+
+// Urgent sets the colours used for urgent segments.
+func (b *Bar) Urgent(foreground, background color.Color) *Bar {
+	b.colors.urgentForeground = foreground
+	b.colors.urgentBackground = background
+	return b
+}
+
+// Hover sets the background colour of clickable segments when the pointer is
+// over them. By default, hovered segments are not highlighted.
+func (b *Bar) Hover(background color.Color) *Bar {
+	b.colors.hover = background
+	return b
+}
+
+// ErrorHandler sets the function to be called when an error segment is right
+// clicked. This replaces the DefaultErrorHandler.
+func (b *Bar) ErrorHandler(handler func(bar.ErrorEvent)) *Bar {
+	b.errorHandler = handler
+	return b
+}
+
+// DefaultErrorHandler invokes swaynag to show the full error message.
+func DefaultErrorHandler(e bar.ErrorEvent) {
+	exec.Command("swaynag", "-m", e.Error.Error()).Run()
+}
+
+// TooltipHandler sets the function to be called when the pointer moves over a
+// segment with a tooltip, if the compositor does not support popups. This
+// replaces the DefaultTooltipHandler.
+func (b *Bar) TooltipHandler(handler func(bar.TooltipEvent)) *Bar {
+	b.tooltipHandler = handler
+	return b
+}
+
+// DefaultTooltipHandler invokes notify-send to show the tooltip as a desktop
+// notification.
+func DefaultTooltipHandler(e bar.TooltipEvent) {
+	exec.Command("notify-send", "-a", "barista", e.Tooltip).Run()
+}
+
+// Output sets the modules to show on the named output (e.g. "eDP-1"), instead
+// of the modules given to Run. If no modules are given, the bar is not shown
+// on that output. To show the same module on more than one output, use
+// multicast.New.
+func (b *Bar) Output(name string, modules ...bar.Module) *Bar {
+	if b.outputs == nil {
+		b.outputs = map[string][]bar.Module{}
+	}
+	b.outputs[name] = modules
+	return b
+}
+
+// Run connects to the compositor given by $WAYLAND_DISPLAY, and runs the bar
+// on each output with the given modules (or the modules set for that output
+// using Output) until the connection is closed.
+func (b *Bar) Run(modules ...bar.Module) error {
+	// See barista.Run: all modules are created, so all oauth providers are known.
+	oauth.InteractiveSetup()
+	sdnotify.GenerateUnit()
+	if b.text == nil {
+		text, err := defaultTextRenderer(b.font)
+		if err != nil {
+			return err
+		}
+		b.text = text
+	}
+	c, err := dial()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	return b.run(c, core.NewPerOutput(modules, b.outputs))
+}
@@ -0,0 +1,703 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/core"
+	"barista.run/outputs"
+	testModule "barista.run/testing/module"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+var allGlobals = []string{ifaceCompositor, ifaceShm, ifaceLayerShell, ifaceSeat, ifaceWmBase}
+
+// fakeCompositor implements just enough of a wayland compositor to run a bar,
+// and captures each frame committed by the bar.
+type fakeCompositor struct {
+	t       *testing.T
+	sock    *net.UnixConn
+	globals []string
+	frames  chan fakeFrame
+	popups  chan fakePopup
+	closed  chan struct{}
+	// Receives the output of each layer surface that is destroyed.
+	destroyed chan string
+	// Frames for other outputs received while waiting for a frame. Only used
+	// by the test goroutine.
+	pending []fakeFrame
+
+	mu          sync.Mutex
+	objects     map[uint32]string
+	fds         []int
+	pools       map[uint32][]byte
+	buffers     map[uint32]fakeBuffer
+	surfaces    map[uint32]*fakeSurface
+	xdgSurfaces map[uint32]uint32
+	positioners map[uint32]image.Rectangle
+	registry    uint32
+	outputs     []string
+	outputIDs   map[uint32]string
+	widths      map[string]int
+	// The first surface and layer surface created.
+	surface      uint32
+	layerSurface uint32
+	pointer      uint32
+	acked        uint32
+	anchor       uint32
+	exclusive    int32
+	namespace    string
+	pong         uint32
+}
+
+type fakeBuffer struct {
+	pool []byte
+	rect image.Rectangle // x = offset, y = 0.
+}
+
+type fakeSurface struct {
+	attached     uint32
+	configured   bool
+	layerSurface uint32
+	output       string
+	xdgSurface   uint32
+	anchor       image.Rectangle
+}
+
+// fakeFrame is a frame drawn on the bar's layer surface for an output.
+type fakeFrame struct {
+	img    *argbImage
+	output string
+}
+
+// fakePopup is a frame drawn on a popup surface.
+type fakePopup struct {
+	img    *argbImage
+	anchor image.Rectangle
+}
+
+func newFakeCompositor(t *testing.T, globals ...string) (*fakeCompositor, *conn) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	require.NoError(t, err)
+	socks := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		file := os.NewFile(uintptr(fd), "wayland")
+		c, err := net.FileConn(file)
+		require.NoError(t, err)
+		file.Close()
+		socks[i] = c.(*net.UnixConn)
+	}
+	f := &fakeCompositor{
+		t:       t,
+		sock:    socks[0],
+		globals: globals,
+		frames:  make(chan fakeFrame, 100),
+		popups:  make(chan fakePopup, 100),
+		closed:  make(chan struct{}, 100),
+
+		destroyed: make(chan string, 100),
+		objects:   map[uint32]string{displayID: "wl_display"},
+
+		pools:       map[uint32][]byte{},
+		buffers:     map[uint32]fakeBuffer{},
+		surfaces:    map[uint32]*fakeSurface{},
+		xdgSurfaces: map[uint32]uint32{},
+		positioners: map[uint32]image.Rectangle{},
+		outputIDs:   map[uint32]string{},
+		widths:      map[string]int{},
+	}
+	go f.serve()
+	return f, newConn(socks[1])
+}
+
+func (f *fakeCompositor) serve() {
+	buf := make([]byte, 65536)
+	oob := make([]byte, 1024)
+	var pending []byte
+	for {
+		n, oobn, _, _, err := f.sock.ReadMsgUnix(buf, oob)
+		if err != nil || n == 0 {
+			return
+		}
+		msgs, _ := unix.ParseSocketControlMessage(oob[:oobn])
+		for _, m := range msgs {
+			fds, _ := unix.ParseUnixRights(&m)
+			f.fds = append(f.fds, fds...)
+		}
+		pending = append(pending, buf[:n]...)
+		for len(pending) >= headerSize {
+			sender, opcode, size := parseHeader(pending)
+			if len(pending) < size {
+				break
+			}
+			f.mu.Lock()
+			f.handle(f.objects[sender], sender, opcode, &decoder{data: pending[headerSize:size]})
+			f.mu.Unlock()
+			pending = pending[size:]
+		}
+	}
+}
+
+func (f *fakeCompositor) handle(iface string, sender uint32, opcode uint16, d *decoder) {
+	switch iface {
+	case "wl_display":
+		id := d.uint()
+		switch opcode {
+		case displaySync:
+			f.event(id, 0, new(encoder).uint(0))
+			f.event(displayID, displayDeleteID, new(encoder).uint(id))
+		case displayGetRegistry:
+			f.objects[id] = "wl_registry"
+			f.registry = id
+			for i, g := range f.globals {
+				f.event(id, registryGlobal, new(encoder).uint(uint32(i+1)).string(g).uint(5))
+			}
+			for i := range f.outputs {
+				f.outputGlobalLocked(i)
+			}
+		}
+	case "wl_registry":
+		name := d.uint()
+		iface, version, id := d.string(), d.uint(), d.uint()
+		f.objects[id] = iface
+		if iface == ifaceOutput {
+			require.Equal(f.t, uint32(4), version, "output bound at version 4")
+			output := f.outputs[name-100]
+			f.outputIDs[id] = output
+			f.event(id, outputName, new(encoder).string(output))
+			f.event(id, outputDone, nil)
+			return
+		}
+		require.Equal(f.t, uint32(1), version, "bound at version 1")
+		switch iface {
+		case ifaceSeat:
+			f.event(id, seatCapabilities, new(encoder).uint(seatCapabilityPointer))
+		case ifaceWmBase:
+			f.event(id, wmBasePing, new(encoder).uint(42))
+		}
+	case ifaceCompositor:
+		id := d.uint()
+		f.objects[id] = "wl_surface"
+		f.surfaces[id] = new(fakeSurface)
+		if f.surface == 0 {
+			f.surface = id
+		}
+	case ifaceLayerShell:
+		id := d.uint()
+		f.objects[id] = "zwlr_layer_surface_v1"
+		if f.layerSurface == 0 {
+			f.layerSurface = id
+		}
+		surface := f.surfaces[d.uint()]
+		surface.layerSurface = id
+		surface.output = f.outputIDs[d.uint()]
+		require.Equal(f.t, uint32(layerTop), d.uint(), "layer")
+		f.namespace = d.string()
+	case "zwlr_layer_surface_v1":
+		switch opcode {
+		case layerSurfaceDestroy:
+			for _, surface := range f.surfaces {
+				if surface.layerSurface == sender {
+					f.destroyed <- surface.output
+				}
+			}
+		case layerSurfaceSetAnchor:
+			f.anchor = d.uint()
+		case layerSurfaceSetExclusiveZone:
+			f.exclusive = d.int()
+		case layerSurfaceAckConfigure:
+			f.acked = d.uint()
+		}
+	case "wl_surface":
+		surface := f.surfaces[sender]
+		switch opcode {
+		case surfaceAttach:
+			surface.attached = d.uint()
+		case surfaceDestroy:
+			delete(f.surfaces, sender)
+		case surfaceCommit:
+			if !surface.configured {
+				surface.configured = true
+				if surface.layerSurface != 0 {
+					width := f.widths[surface.output]
+					if width == 0 {
+						width = 200
+					}
+					f.configureLocked(surface.layerSurface, width)
+				} else {
+					f.event(surface.xdgSurface, xdgSurfaceConfigure, new(encoder).uint(7))
+				}
+				return
+			}
+			if surface.attached == 0 {
+				return
+			}
+			b := f.buffers[surface.attached]
+			r := b.rect
+			pix := append([]byte(nil), b.pool[r.Min.X:r.Min.X+r.Dx()*r.Dy()*4]...)
+			img := newARGBImage(pix, r.Dx(), r.Dy())
+			if surface.layerSurface != 0 {
+				f.frames <- fakeFrame{img, surface.output}
+			} else {
+				f.popups <- fakePopup{img, surface.anchor}
+			}
+			f.event(surface.attached, bufferRelease, nil)
+			surface.attached = 0
+		}
+	case ifaceShm:
+		id := d.uint()
+		size := int(d.int())
+		fd := f.fds[0]
+		f.fds = f.fds[1:]
+		data, err := unix.Mmap(fd, 0, size, unix.PROT_READ, unix.MAP_SHARED)
+		require.NoError(f.t, err)
+		unix.Close(fd)
+		f.pools[id] = data
+		f.objects[id] = "wl_shm_pool"
+	case "wl_shm_pool":
+		if opcode != shmPoolCreateBuffer {
+			return
+		}
+		id, offset, width, height := d.uint(), int(d.int()), int(d.int()), int(d.int())
+		require.Equal(f.t, int32(width*4), d.int(), "stride")
+		require.Equal(f.t, uint32(formatARGB8888), d.uint(), "format")
+		f.objects[id] = "wl_buffer"
+		f.buffers[id] = fakeBuffer{f.pools[sender], image.Rect(offset, 0, offset+width, height)}
+	case ifaceWmBase:
+		switch opcode {
+		case wmBaseCreatePositioner:
+			id := d.uint()
+			f.objects[id] = "xdg_positioner"
+		case wmBaseGetXdgSurface:
+			id, surface := d.uint(), d.uint()
+			f.objects[id] = "xdg_surface"
+			f.xdgSurfaces[id] = surface
+			f.surfaces[surface].xdgSurface = id
+		case wmBasePong:
+			f.pong = d.uint()
+		}
+	case "xdg_positioner":
+		if opcode == positionerSetAnchorRect {
+			x, y, w, h := int(d.int()), int(d.int()), int(d.int()), int(d.int())
+			f.positioners[sender] = image.Rect(x, y, x+w, y+h)
+		}
+	case "xdg_surface":
+		if opcode == xdgSurfaceGetPopup {
+			id := d.uint()
+			require.Equal(f.t, uint32(0), d.uint(), "parent set by layer surface")
+			f.objects[id] = "xdg_popup"
+			f.surfaces[f.xdgSurfaces[sender]].anchor = f.positioners[d.uint()]
+		}
+	case "xdg_popup":
+		if opcode == popupDestroy {
+			f.closed <- struct{}{}
+		}
+	case ifaceSeat:
+		f.pointer = d.uint()
+		f.objects[f.pointer] = "wl_pointer"
+	}
+}
+
+func (f *fakeCompositor) event(sender uint32, opcode uint16, args *encoder) {
+	if args == nil {
+		args = new(encoder)
+	}
+	f.sock.Write(args.message(sender, opcode))
+}
+
+// configureLocked configures a layer surface, using the width as the serial.
+func (f *fakeCompositor) configureLocked(layerSurface uint32, width int) {
+	f.event(layerSurface, layerSurfaceConfigure,
+		new(encoder).uint(uint32(width)).uint(uint32(width)).uint(0))
+}
+
+func (f *fakeCompositor) configure(width int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.configureLocked(f.layerSurface, width)
+}
+
+// addOutput adds an output, which is advertised when the bar gets the
+// registry, or immediately if it already has.
+func (f *fakeCompositor) addOutput(name string, width int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.outputs = append(f.outputs, name)
+	f.widths[name] = width
+	if f.registry != 0 {
+		f.outputGlobalLocked(len(f.outputs) - 1)
+	}
+}
+
+func (f *fakeCompositor) outputGlobalLocked(idx int) {
+	f.event(f.registry, registryGlobal,
+		new(encoder).uint(uint32(100+idx)).string(ifaceOutput).uint(4))
+}
+
+func (f *fakeCompositor) removeOutput(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, o := range f.outputs {
+		if o == name {
+			f.event(f.registry, registryGlobalRemove, new(encoder).uint(uint32(100+i)))
+		}
+	}
+}
+
+// pointerEvent sends a pointer event, waiting for the bar to request a pointer
+// if it has not done so yet.
+func (f *fakeCompositor) pointerEvent(opcode uint16, args *encoder) {
+	timeout := time.Now().Add(time.Second)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.pointer == 0 {
+		require.True(f.t, time.Now().Before(timeout), "pointer not requested")
+		f.mu.Unlock()
+		time.Sleep(time.Millisecond)
+		f.mu.Lock()
+	}
+	f.event(f.pointer, opcode, args)
+}
+
+// enter moves the pointer onto the first surface created.
+func (f *fakeCompositor) enter(x, y int) {
+	f.mu.Lock()
+	surface := f.surface
+	f.mu.Unlock()
+	f.pointerEvent(pointerEnter,
+		new(encoder).uint(0).uint(surface).int(int32(x*256)).int(int32(y*256)))
+}
+
+func (f *fakeCompositor) moveTo(x, y int) {
+	f.pointerEvent(pointerMotion, new(encoder).uint(0).int(int32(x*256)).int(int32(y*256)))
+}
+
+func (f *fakeCompositor) press(button uint32) {
+	f.pointerEvent(pointerButton, new(encoder).uint(0).uint(0).uint(button).uint(pointerButtonPressed))
+	f.pointerEvent(pointerButton, new(encoder).uint(0).uint(0).uint(button).uint(0))
+}
+
+// waitFrame waits for a frame where the pixel at (x, y) has the given colour.
+func (f *fakeCompositor) waitFrame(x, y int, col color.Color, args ...interface{}) *argbImage {
+	return f.waitOutputFrame("", x, y, col, args...)
+}
+
+// waitOutputFrame waits for a frame on the given output where the pixel at
+// (x, y) has the given colour.
+func (f *fakeCompositor) waitOutputFrame(output string, x, y int, col color.Color, args ...interface{}) *argbImage {
+	want := color.RGBAModel.Convert(col)
+	pending := f.pending
+	f.pending = nil
+	for i, frame := range pending {
+		if frame.output != output {
+			f.pending = append(f.pending, frame)
+		} else if frame.img.At(x, y) == want {
+			f.pending = append(f.pending, pending[i+1:]...)
+			return frame.img
+		}
+	}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case frame := <-f.frames:
+			if frame.output != output {
+				f.pending = append(f.pending, frame)
+			} else if frame.img.At(x, y) == want {
+				return frame.img
+			}
+		case <-timeout:
+			require.Fail(f.t, "no matching frame", args...)
+			return nil
+		}
+	}
+}
+
+func (f *fakeCompositor) waitPopup(args ...interface{}) fakePopup {
+	select {
+	case p := <-f.popups:
+		return p
+	case <-time.After(time.Second):
+		require.Fail(f.t, "no popup drawn", args...)
+		return fakePopup{}
+	}
+}
+
+func (f *fakeCompositor) waitClosed(args ...interface{}) {
+	select {
+	case <-f.closed:
+	case <-time.After(time.Second):
+		require.Fail(f.t, "popup not closed", args...)
+	}
+}
+
+func runBar(b *Bar, c *conn, modules ...bar.Module) <-chan error {
+	if b.text == nil {
+		b.text = new(fakeText)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- b.run(c, core.NewPerOutput(modules, b.outputs)) }()
+	return errCh
+}
+
+func TestMissingGlobals(t *testing.T) {
+	f, c := newFakeCompositor(t, ifaceCompositor, ifaceShm, ifaceSeat)
+	defer f.sock.Close()
+	err := <-runBar(New(), c)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ifaceLayerShell)
+}
+
+func TestBar(t *testing.T) {
+	f, c := newFakeCompositor(t, allGlobals...)
+	m := testModule.New(t)
+	errCh := runBar(New().Height(20), c, m)
+	m.AssertStarted()
+
+	m.OutputText("abc")
+	// abc is 12px wide, with 4px text padding and the default 9px padding.
+	img := f.waitFrame(175, 10, color.White, "text drawn")
+	require.Equal(t, image.Rect(0, 0, 200, 20), img.Bounds())
+	require.Equal(t, color.RGBAModel.Convert(color.Black), img.At(173, 10))
+
+	f.mu.Lock()
+	require.Equal(t, uint32(200), f.acked, "configure acked")
+	require.Equal(t, uint32(anchorLeft|anchorRight|anchorTop), f.anchor)
+	require.Equal(t, int32(20), f.exclusive)
+	require.Equal(t, "barista", f.namespace)
+	require.Equal(t, uint32(42), f.pong, "ping answered")
+	f.mu.Unlock()
+
+	f.enter(180, 10)
+	f.press(btnLeft)
+	e := m.AssertClicked("on click")
+	require.Equal(t, bar.Event{
+		Button: bar.ButtonLeft,
+		X:      9, Y: 10, Width: 20, Height: 20,
+		ScreenX: 180, ScreenY: 10,
+	}, e)
+
+	f.pointerEvent(pointerAxis,
+		new(encoder).uint(0).uint(pointerAxisVertical).int(-10*256))
+	require.Equal(t, bar.ScrollUp, m.AssertClicked("on scroll").Button)
+	f.pointerEvent(pointerAxis,
+		new(encoder).uint(0).uint(pointerAxisHorizontal).int(10*256))
+	require.Equal(t, bar.ScrollRight, m.AssertClicked("on scroll").Button)
+
+	f.moveTo(195, 10)
+	f.press(btnLeft)
+	m.AssertNotClicked("click in padding")
+
+	f.configure(100)
+	img = f.waitFrame(75, 10, color.White, "redrawn after resize")
+	require.Equal(t, image.Rect(0, 0, 100, 20), img.Bounds())
+
+	f.mu.Lock()
+	f.event(f.layerSurface, layerSurfaceClosed, nil)
+	f.mu.Unlock()
+	select {
+	case err := <-errCh:
+		require.Error(t, err, "surface closed")
+	case <-time.After(time.Second):
+		require.Fail(t, "bar still running after surface closed")
+	}
+	f.sock.Close()
+}
+
+func TestBottomAndHover(t *testing.T) {
+	f, c := newFakeCompositor(t, allGlobals...)
+	defer f.sock.Close()
+	green := color.RGBA{0, 0xff, 0, 0xff}
+	m := testModule.New(t)
+	runBar(New().Bottom().Hover(green), c, m)
+	m.AssertStarted()
+	m.OutputText("abc")
+	f.waitFrame(175, 10, color.White, "text drawn")
+
+	f.mu.Lock()
+	require.Equal(t, uint32(anchorLeft|anchorRight|anchorBottom), f.anchor)
+	f.mu.Unlock()
+
+	f.enter(180, 10)
+	f.waitFrame(172, 1, green, "hovered")
+	f.pointerEvent(pointerLeave, new(encoder).uint(0).uint(0))
+	f.waitFrame(172, 1, color.Black, "not hovered")
+}
+
+func TestErrorHandler(t *testing.T) {
+	f, c := newFakeCompositor(t, allGlobals...)
+	defer f.sock.Close()
+	errs := make(chan bar.ErrorEvent, 1)
+	m := testModule.New(t).SkipClickHandlers()
+	runBar(New().ErrorHandler(func(e bar.ErrorEvent) { errs <- e }), c, m)
+	m.AssertStarted()
+	m.Output(bar.ErrorSegment(errors.New("foo")).Padding(0))
+	f.waitFrame(199, 1, color.RGBA{0x90, 0, 0, 0xff}, "error segment drawn")
+
+	f.enter(199, 5)
+	f.press(btnLeft)
+	f.press(btnRight)
+	select {
+	case e := <-errs:
+		require.EqualError(t, e.Error, "foo")
+		require.Equal(t, bar.ButtonRight, e.Button)
+	case <-time.After(time.Second):
+		require.Fail(t, "error handler not called")
+	}
+	select {
+	case e := <-errs:
+		require.Fail(t, "unexpected error event", "%+v", e)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestTooltip(t *testing.T) {
+	f, c := newFakeCompositor(t, allGlobals...)
+	defer f.sock.Close()
+	m := testModule.New(t)
+	errCh := runBar(New().Height(20), c, m)
+	m.AssertStarted()
+	m.Output(outputs.Group(
+		outputs.Text("abc").Tooltip("details"),
+		outputs.Text("def"),
+	))
+	f.waitFrame(147, 10, color.White, "text drawn")
+
+	f.enter(150, 10)
+	p := f.waitPopup("on hover")
+	require.Equal(t, image.Rect(142, 0, 162, 20), p.anchor)
+	require.Equal(t, image.Rect(0, 0, 36, 18), p.img.Bounds(), "text and padding")
+	require.Equal(t, color.RGBAModel.Convert(color.White), p.img.At(4, 4))
+	require.Equal(t, color.RGBAModel.Convert(color.Black), p.img.At(3, 3))
+
+	f.moveTo(155, 12)
+	f.moveTo(175, 10)
+	f.waitClosed("on hovering segment without tooltip")
+	f.moveTo(150, 10)
+	f.waitPopup("on hover again")
+
+	m.Output(outputs.Text("abc").Tooltip("more details"))
+	f.waitClosed("on output change")
+	f.moveTo(175, 10)
+	p = f.waitPopup("on hover after update")
+	require.Equal(t, image.Rect(0, 0, 56, 18), p.img.Bounds())
+
+	f.pointerEvent(pointerLeave, new(encoder).uint(0).uint(0))
+	f.waitClosed("on leave")
+	select {
+	case p := <-f.popups:
+		require.Fail(t, "unexpected popup", "%+v", p)
+	case err := <-errCh:
+		require.Fail(t, "unexpected error", "%v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestTooltipWithoutPopups(t *testing.T) {
+	f, c := newFakeCompositor(t, ifaceCompositor, ifaceShm, ifaceLayerShell, ifaceSeat)
+	defer f.sock.Close()
+	tooltips := make(chan bar.TooltipEvent, 10)
+	m := testModule.New(t)
+	runBar(New().Height(20).TooltipHandler(func(e bar.TooltipEvent) { tooltips <- e }), c, m)
+	m.AssertStarted()
+	m.Output(outputs.Group(
+		outputs.Text("abc").Tooltip("details"),
+		outputs.Text("def"),
+	))
+	f.waitFrame(147, 10, color.White, "text drawn")
+
+	assertTooltip := func(expected bar.TooltipEvent, args ...interface{}) {
+		select {
+		case e := <-tooltips:
+			require.Equal(t, expected, e, args...)
+		case <-time.After(time.Second):
+			require.Fail(t, "tooltip handler not called", args...)
+		}
+	}
+	assertNoTooltip := func(args ...interface{}) {
+		select {
+		case e := <-tooltips:
+			require.Fail(t, "unexpected tooltip", "%+v", e)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	f.enter(150, 10)
+	assertTooltip(bar.TooltipEvent{
+		Tooltip: "details",
+		Event: bar.Event{
+			X: 8, Y: 10, Width: 20, Height: 20,
+			ScreenX: 150, ScreenY: 10,
+		},
+	}, "on hover")
+	f.moveTo(155, 10)
+	assertNoTooltip("on move within segment")
+	f.moveTo(175, 10)
+	assertNoTooltip("on segment without tooltip")
+	f.moveTo(145, 10)
+	e := <-tooltips
+	require.Equal(t, "details", e.Tooltip, "on hover again")
+	require.Empty(t, f.popups, "no popups without xdg-shell")
+}
+
+func TestOutputs(t *testing.T) {
+	f, c := newFakeCompositor(t, allGlobals...)
+	defer f.sock.Close()
+	f.addOutput("eDP-1", 200)
+	f.addOutput("HDMI-1", 100)
+	f.addOutput("DP-1", 150)
+
+	m1 := testModule.New(t)
+	m2 := testModule.New(t)
+	b := New().Height(20).Output("HDMI-1", m2).Output("DP-1")
+	runBar(b, c, m1)
+	m1.AssertStarted()
+	m2.AssertStarted()
+
+	m1.OutputText("abc")
+	m2.OutputText("abcdef")
+	f.waitOutputFrame("eDP-1", 175, 10, color.White, "default modules drawn")
+	// abcdef is 24px wide, so it extends further left than abc would.
+	f.waitOutputFrame("HDMI-1", 65, 10, color.White, "output modules drawn")
+
+	f.mu.Lock()
+	for _, s := range f.surfaces {
+		require.NotEqual(t, "DP-1", s.output, "no surface on output without modules")
+	}
+	f.mu.Unlock()
+
+	f.removeOutput("HDMI-1")
+	select {
+	case o := <-f.destroyed:
+		require.Equal(t, "HDMI-1", o, "layer surface destroyed with output")
+	case <-time.After(time.Second):
+		require.Fail(t, "layer surface not destroyed")
+	}
+
+	f.addOutput("HDMI-1", 100)
+	f.waitOutputFrame("HDMI-1", 65, 10, color.White, "redrawn on added output")
+	m1.OutputText("def")
+	f.waitOutputFrame("eDP-1", 175, 10, color.White, "default modules still drawn")
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// handler handles events for a single wayland object.
+type handler func(opcode uint16, d *decoder)
+
+// conn is a client connection to a wayland compositor. It allocates object ids,
+// serialises requests, and dispatches events to the handlers of each object.
+type conn struct {
+	sock *net.UnixConn
+
+	mu      sync.Mutex
+	nextID  uint32
+	objects map[uint32]handler
+}
+
+// dial connects to the compositor given by $WAYLAND_DISPLAY, which is either
+// an absolute path or relative to $XDG_RUNTIME_DIR (as libwayland does).
+func dial() (*conn, error) {
+	name := os.Getenv("WAYLAND_DISPLAY")
+	if name == "" {
+		name = "wayland-0"
+	}
+	if !filepath.IsAbs(name) {
+		dir := os.Getenv("XDG_RUNTIME_DIR")
+		if dir == "" {
+			return nil, errors.New("wayland: XDG_RUNTIME_DIR is not set")
+		}
+		name = filepath.Join(dir, name)
+	}
+	sock, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: name, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	return newConn(sock), nil
+}
+
+func newConn(sock *net.UnixConn) *conn {
+	return &conn{
+		sock:    sock,
+		nextID:  displayID,
+		objects: map[uint32]handler{},
+	}
+}
+
+// newObject allocates an id for a new object, with a handler for its events.
+// The handler may be nil for objects that do not emit any events.
+func (c *conn) newObject(h handler) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	if h != nil {
+		c.objects[c.nextID] = h
+	}
+	return c.nextID
+}
+
+// send sends a request from the given object. Requests can be sent from any
+// goroutine, including from within event handlers.
+func (c *conn) send(sender uint32, opcode uint16, args *encoder) error {
+	if args == nil {
+		args = new(encoder)
+	}
+	msg := args.message(sender, opcode)
+	var oob []byte
+	if len(args.fds) > 0 {
+		oob = unix.UnixRights(args.fds...)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _, err := c.sock.WriteMsgUnix(msg, oob, nil)
+	return err
+}
+
+// sync returns a channel that is closed once the compositor has processed all
+// previous requests (and sent any resulting events).
+func (c *conn) sync() (<-chan struct{}, error) {
+	done := make(chan struct{})
+	var once sync.Once
+	id := c.newObject(func(uint16, *decoder) {
+		once.Do(func() { close(done) })
+	})
+	return done, c.send(displayID, displaySync, new(encoder).uint(id))
+}
+
+// dispatch reads events from the compositor and calls the handlers of the
+// objects they're sent to, until the connection is closed or the compositor
+// reports a fatal error.
+func (c *conn) dispatch() error {
+	buf := make([]byte, 4096)
+	oob := make([]byte, unix.CmsgSpace(28*4))
+	var pending []byte
+	for {
+		n, oobn, _, _, err := c.sock.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("wayland: connection closed by compositor")
+		}
+		// None of the events handled by the bar carry file descriptors.
+		closeFds(oob[:oobn])
+		pending = append(pending, buf[:n]...)
+		for len(pending) >= headerSize {
+			sender, opcode, size := parseHeader(pending)
+			if size < headerSize {
+				return fmt.Errorf("wayland: invalid message size %d", size)
+			}
+			if len(pending) < size {
+				break
+			}
+			if err := c.handle(sender, opcode, pending[headerSize:size]); err != nil {
+				return err
+			}
+			pending = pending[size:]
+		}
+		pending = append([]byte(nil), pending...)
+	}
+}
+
+func (c *conn) handle(sender uint32, opcode uint16, body []byte) error {
+	d := &decoder{data: body}
+	if sender == displayID {
+		return c.handleDisplay(opcode, d)
+	}
+	c.mu.Lock()
+	h := c.objects[sender]
+	c.mu.Unlock()
+	if h != nil {
+		h(opcode, d)
+	}
+	return nil
+}
+
+func (c *conn) handleDisplay(opcode uint16, d *decoder) error {
+	switch opcode {
+	case displayError:
+		object, code, msg := d.uint(), d.uint(), d.string()
+		return fmt.Errorf("wayland: error %d on object %d: %s", code, object, msg)
+	case displayDeleteID:
+		id := d.uint()
+		c.mu.Lock()
+		delete(c.objects, id)
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *conn) close() error {
+	return c.sock.Close()
+}
+
+func closeFds(oob []byte) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return
+	}
+	for _, m := range msgs {
+		fds, err := unix.ParseUnixRights(&m)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"image"
+	"image/color"
+)
+
+// argbImage is a draw.Image backed by (shared) memory in the wl_shm ARGB8888
+// format, i.e. premultiplied 32-bit ARGB in native byte order.
+type argbImage struct {
+	pix    []byte
+	stride int
+	rect   image.Rectangle
+}
+
+func newARGBImage(pix []byte, width, height int) *argbImage {
+	return &argbImage{pix: pix, stride: width * 4, rect: image.Rect(0, 0, width, height)}
+}
+
+func (a *argbImage) ColorModel() color.Model { return color.RGBAModel }
+
+func (a *argbImage) Bounds() image.Rectangle { return a.rect }
+
+func (a *argbImage) offset(x, y int) int {
+	return y*a.stride + x*4
+}
+
+func (a *argbImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}).In(a.rect) {
+		return color.RGBA{}
+	}
+	v := byteOrder.Uint32(a.pix[a.offset(x, y):])
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: uint8(v >> 24)}
+}
+
+func (a *argbImage) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}).In(a.rect) {
+		return
+	}
+	a.set(a.offset(x, y), color.RGBAModel.Convert(c).(color.RGBA))
+}
+
+func (a *argbImage) set(i int, c color.RGBA) {
+	byteOrder.PutUint32(a.pix[i:],
+		uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+}
+
+// fill replaces all pixels in the rectangle with the given colour.
+func (a *argbImage) fill(r image.Rectangle, c color.Color) {
+	r = r.Intersect(a.rect)
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			a.set(a.offset(x, y), rgba)
+		}
+	}
+}
+
+// over composites src (premultiplied RGBA) onto the image at pt.
+func (a *argbImage) over(pt image.Point, src *image.RGBA) {
+	sb := src.Bounds()
+	r := sb.Sub(sb.Min).Add(pt).Intersect(a.rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			s := src.RGBAAt(x-pt.X+sb.Min.X, y-pt.Y+sb.Min.Y)
+			if s.A == 0 {
+				continue
+			}
+			i := a.offset(x, y)
+			if s.A < 0xff {
+				v := byteOrder.Uint32(a.pix[i:])
+				inv := uint32(0xff - s.A)
+				s.R += uint8(((v >> 16) & 0xff) * inv / 0xff)
+				s.G += uint8(((v >> 8) & 0xff) * inv / 0xff)
+				s.B += uint8((v & 0xff) * inv / 0xff)
+				s.A += uint8((v >> 24) * inv / 0xff)
+			}
+			a.set(i, s)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"image"
+
+	"barista.run/bar"
+)
+
+func (s *session) handleSeat(opcode uint16, d *decoder) {
+	if opcode != seatCapabilities {
+		return
+	}
+	caps := d.uint()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if caps&seatCapabilityPointer == 0 || s.pointer != 0 {
+		return
+	}
+	s.pointer = s.c.newObject(s.handlePointer)
+	s.c.send(s.seat, seatGetPointer, new(encoder).uint(s.pointer))
+}
+
+func (s *session) handlePointer(opcode uint16, d *decoder) {
+	switch opcode {
+	case pointerEnter:
+		d.uint() // serial
+		surface := d.uint()
+		x, y := d.fixed(), d.fixed()
+		s.mu.Lock()
+		var entered *panel
+		for _, p := range s.panels {
+			if p.surface == surface {
+				entered = p
+			}
+		}
+		s.movePointerLocked(entered, x, y)
+		s.mu.Unlock()
+	case pointerLeave:
+		s.mu.Lock()
+		s.movePointerLocked(nil, 0, 0)
+		s.mu.Unlock()
+	case pointerMotion:
+		d.uint() // time
+		x, y := d.fixed(), d.fixed()
+		s.mu.Lock()
+		s.movePointerLocked(s.pointerPanel, x, y)
+		s.mu.Unlock()
+	case pointerButton:
+		d.uint() // serial
+		d.uint() // time
+		button, state := d.uint(), d.uint()
+		if btn, ok := buttons[button]; ok && state == pointerButtonPressed {
+			s.click(btn)
+		}
+	case pointerAxis:
+		d.uint() // time
+		axis, value := d.uint(), d.fixed()
+		switch {
+		case axis == pointerAxisVertical && value < 0:
+			s.click(bar.ScrollUp)
+		case axis == pointerAxisVertical && value > 0:
+			s.click(bar.ScrollDown)
+		case axis == pointerAxisHorizontal && value < 0:
+			s.click(bar.ScrollLeft)
+		case axis == pointerAxisHorizontal && value > 0:
+			s.click(bar.ScrollRight)
+		}
+	}
+}
+
+var buttons = map[uint32]bar.Button{
+	btnLeft:    bar.ButtonLeft,
+	btnRight:   bar.ButtonRight,
+	btnMiddle:  bar.ButtonMiddle,
+	btnSide:    bar.ButtonBack,
+	btnBack:    bar.ButtonBack,
+	btnExtra:   bar.ButtonForward,
+	btnForward: bar.ButtonForward,
+}
+
+// movePointerLocked moves the pointer to the given position on a panel (or off
+// all panels if nil), and redraws any panel where the hovered block changed,
+// since hovered blocks may be highlighted or show a tooltip.
+func (s *session) movePointerLocked(p *panel, x, y float64) {
+	old := s.pointerPanel
+	oldHover := -1
+	if old != nil {
+		oldHover = s.hoverLocked(old)
+	}
+	s.pointerPanel = p
+	s.pointerPos = image.Pt(int(x), int(y))
+	newHover := -1
+	if p != nil {
+		newHover = s.hoverLocked(p)
+	}
+	if old == p && oldHover == newHover {
+		return
+	}
+	if old != nil {
+		old.dirty = true
+	}
+	if p != nil {
+		p.dirty = true
+	}
+	s.redraw()
+}
+
+// hoverLocked returns the index of the block under the pointer on the given
+// panel, or -1 if the pointer is not over any of its blocks.
+func (s *session) hoverLocked(p *panel) int {
+	if s.pointerPanel != p || p == nil {
+		return -1
+	}
+	return blockAt(p.blocks, s.pointerPos.X)
+}
+
+func (s *session) click(btn bar.Button) {
+	s.mu.Lock()
+	idx := s.hoverLocked(s.pointerPanel)
+	pos := s.pointerPos
+	var blk block
+	if idx >= 0 {
+		blk = s.pointerPanel.blocks[idx]
+	}
+	s.mu.Unlock()
+	if idx < 0 {
+		return
+	}
+	e := event(blk, pos, btn)
+	if err := blk.segment.GetError(); err != nil && btn == bar.ButtonRight {
+		go s.errorHandler(bar.ErrorEvent{Error: err, Event: e})
+		return
+	}
+	go blk.segment.Click(e)
+}
+
+// event creates an event for the pointer at pos on the given block.
+func event(blk block, pos image.Point, btn bar.Button) bar.Event {
+	return bar.Event{
+		Button:  btn,
+		X:       pos.X - blk.rect.Min.X,
+		Y:       pos.Y - blk.rect.Min.Y,
+		Width:   blk.rect.Dx(),
+		Height:  blk.rect.Dy(),
+		ScreenX: pos.X,
+		ScreenY: pos.Y,
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"image"
+	"image/color"
+
+	"barista.run/bar"
+)
+
+// block is a segment positioned on the bar, with everything needed to paint
+// it and to map pointer events to it.
+type block struct {
+	segment *bar.Segment
+	// rect is the area of the block, including borders but not padding.
+	rect image.Rectangle
+	text *image.RGBA
+	// textPos is the position of the text relative to rect.
+	textPos    image.Point
+	background color.Color
+	border     color.Color
+	// An image.Rectangle is used for the border widths, with Min as the
+	// top/left widths and Max as the bottom/right widths.
+	borderWidths image.Rectangle
+	// separatorX is the x position of the separator, or -1 for no separator.
+	separatorX int
+}
+
+func (b block) clickable() bool {
+	return b.segment.HasClick() || b.segment.GetError() != nil
+}
+
+// layout positions the given segments on a bar of the given size. Like i3bar,
+// the segments are aligned to the right edge of the bar, and if they do not
+// all fit, the short text is used for all segments that have one.
+func (b *Bar) layout(segments []*bar.Segment, size image.Point, text *textCache) []block {
+	blocks, width := b.layoutBlocks(segments, size.Y, text, false)
+	if width > size.X && hasShortText(segments) {
+		blocks, width = b.layoutBlocks(segments, size.Y, text, true)
+	}
+	offset := image.Pt(size.X-width, 0)
+	for i := range blocks {
+		blocks[i].rect = blocks[i].rect.Add(offset)
+		if blocks[i].separatorX >= 0 {
+			blocks[i].separatorX += offset.X
+		}
+	}
+	return blocks
+}
+
+func hasShortText(segments []*bar.Segment) bool {
+	for _, s := range segments {
+		if _, ok := s.GetShortText(); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// layoutBlocks lays out the segments starting at x = 0, and returns the blocks
+// along with their total width.
+func (b *Bar) layoutBlocks(segments []*bar.Segment, height int, text *textCache, short bool) ([]block, int) {
+	blocks := make([]block, 0, len(segments))
+	x := 0
+	for _, s := range segments {
+		txt, markup := s.Content()
+		if short {
+			if shortText, ok := s.GetShortText(); ok {
+				txt = shortText
+			}
+		}
+		blk := block{segment: s, separatorX: -1}
+		fg := b.colors.foreground
+		if c, ok := s.GetColor(); ok {
+			fg = c
+		}
+		blk.background, _ = s.GetBackground()
+		var hasBorder bool
+		blk.border, hasBorder = s.GetBorder()
+		if urgent, _ := s.IsUrgent(); urgent {
+			fg = b.colors.urgentForeground
+			blk.background = b.colors.urgentBackground
+			if hasBorder {
+				blk.border = b.colors.urgentBackground
+			}
+		}
+		if hasBorder {
+			top, _ := s.GetBorderTop()
+			right, _ := s.GetBorderRight()
+			bottom, _ := s.GetBorderBottom()
+			left, _ := s.GetBorderLeft()
+			blk.borderWidths = image.Rectangle{Min: image.Pt(left, top), Max: image.Pt(right, bottom)}
+		}
+
+		blk.text = text.render(txt, markup, fg)
+		textSize := blk.text.Bounds().Size()
+		contentWidth := textSize.X + 2*b.textPadding
+		if minWidth, ok := s.GetMinWidth(); ok {
+			switch w := minWidth.(type) {
+			case int:
+				contentWidth = max(contentWidth, w)
+			case string:
+				placeholder := text.render(w, markup, fg).Bounds().Dx()
+				contentWidth = max(contentWidth, placeholder+2*b.textPadding)
+			}
+		}
+		extra := contentWidth - textSize.X - 2*b.textPadding
+		align, _ := s.GetAlignment()
+		switch align {
+		case bar.AlignCenter:
+			extra /= 2
+		case bar.AlignEnd:
+		default:
+			extra = 0
+		}
+		bw := blk.borderWidths
+		blk.textPos = image.Pt(bw.Min.X+b.textPadding+extra, (height-textSize.Y)/2)
+		width := bw.Min.X + contentWidth + bw.Max.X
+		blk.rect = image.Rect(x, 0, x+width, height)
+
+		padding, _ := s.GetPadding()
+		if sep, _ := s.HasSeparator(); sep && b.colors.separator != nil {
+			blk.separatorX = x + width + padding/2
+		}
+		x += width + padding
+		blocks = append(blocks, blk)
+	}
+	return blocks, x
+}
+
+// paint draws the blocks onto the image, highlighting the block at index hover
+// if it can be clicked.
+func (b *Bar) paint(img *argbImage, blocks []block, hover int) {
+	img.fill(img.Bounds(), b.colors.background)
+	for i, blk := range blocks {
+		r := blk.rect
+		background := blk.background
+		if i == hover && blk.clickable() && b.colors.hover != nil {
+			background = b.colors.hover
+		}
+		if background != nil {
+			img.fill(r, background)
+		}
+		if blk.border != nil {
+			bw := blk.borderWidths
+			img.fill(image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+bw.Min.Y), blk.border)
+			img.fill(image.Rect(r.Min.X, r.Max.Y-bw.Max.Y, r.Max.X, r.Max.Y), blk.border)
+			img.fill(image.Rect(r.Min.X, r.Min.Y, r.Min.X+bw.Min.X, r.Max.Y), blk.border)
+			img.fill(image.Rect(r.Max.X-bw.Max.X, r.Min.Y, r.Max.X, r.Max.Y), blk.border)
+		}
+		img.over(r.Min.Add(blk.textPos), blk.text)
+		if blk.separatorX >= 0 {
+			margin := r.Dy() / 5
+			img.fill(image.Rect(blk.separatorX, r.Min.Y+margin,
+				blk.separatorX+1, r.Max.Y-margin), b.colors.separator)
+		}
+	}
+}
+
+// blockAt returns the index of the block at the given x position, or -1 if
+// there is no block there (e.g. in the padding between blocks).
+func blockAt(blocks []block, x int) int {
+	for i, blk := range blocks {
+		if x >= blk.rect.Min.X && x < blk.rect.Max.X {
+			return i
+		}
+	}
+	return -1
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"barista.run/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeText renders each character as a 4x10 block of solid colour.
+type fakeText struct {
+	count int
+}
+
+func (f *fakeText) Render(text string, markup bool, col color.Color) *image.RGBA {
+	f.count++
+	img := image.NewRGBA(image.Rect(0, 0, 4*len(text), 10))
+	draw.Draw(img, img.Bounds(), image.NewUniform(col), image.ZP, draw.Src)
+	return img
+}
+
+func testLayout(t *testing.T, b *Bar, width int, segments ...*bar.Segment) []block {
+	if b.text == nil {
+		b.text = new(fakeText)
+	}
+	return b.layout(segments, image.Pt(width, 20), &textCache{renderer: b.text})
+}
+
+func rects(blocks []block) []image.Rectangle {
+	r := make([]image.Rectangle, len(blocks))
+	for i, b := range blocks {
+		r[i] = b.rect
+	}
+	return r
+}
+
+func TestLayout(t *testing.T) {
+	blocks := testLayout(t, New(), 200,
+		bar.TextSegment("abc"),
+		bar.TextSegment("hello"),
+	)
+	require.Equal(t, []image.Rectangle{
+		image.Rect(134, 0, 154, 20),
+		image.Rect(163, 0, 191, 20),
+	}, rects(blocks), "right aligned, with default padding")
+	require.Equal(t, 158, blocks[0].separatorX)
+	require.Equal(t, image.Pt(4, 5), blocks[0].textPos)
+
+	blocks = testLayout(t, New().TextPadding(0).Separator(nil), 100,
+		bar.TextSegment("abc").Padding(0),
+		bar.TextSegment("hello").Padding(2).Separator(false),
+	)
+	require.Equal(t, []image.Rectangle{
+		image.Rect(66, 0, 78, 20),
+		image.Rect(78, 0, 98, 20),
+	}, rects(blocks))
+	require.Equal(t, -1, blocks[0].separatorX, "separators hidden by bar")
+	require.Equal(t, -1, blocks[1].separatorX, "separator disabled")
+}
+
+func TestLayoutShortText(t *testing.T) {
+	blocks := testLayout(t, New(), 40,
+		bar.TextSegment("abcdefghij").ShortText("ab"),
+	)
+	require.Equal(t, []image.Rectangle{image.Rect(15, 0, 31, 20)}, rects(blocks))
+
+	blocks = testLayout(t, New(), 40, bar.TextSegment("abcdefghij"))
+	require.Equal(t, []image.Rectangle{image.Rect(-17, 0, 31, 20)}, rects(blocks),
+		"overflows without short text")
+}
+
+func TestLayoutWidthAndBorders(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blocks := testLayout(t, New().TextPadding(0), 100,
+		bar.TextSegment("ab").MinWidth(20).Align(bar.AlignCenter).Padding(0),
+		bar.TextSegment("ab").MinWidthPlaceholder("abcd").Align(bar.AlignEnd).Padding(0),
+		bar.TextSegment("ab").Border(red).BorderWidths(1, 2, 3, 4).Padding(0),
+	)
+	require.Equal(t, []image.Rectangle{
+		image.Rect(50, 0, 70, 20),
+		image.Rect(70, 0, 86, 20),
+		image.Rect(86, 0, 100, 20),
+	}, rects(blocks))
+	require.Equal(t, image.Pt(6, 5), blocks[0].textPos, "centered")
+	require.Equal(t, image.Pt(8, 5), blocks[1].textPos, "end aligned")
+	require.Equal(t, image.Pt(4, 5), blocks[2].textPos, "after left border")
+	require.Equal(t, image.Rectangle{Min: image.Pt(4, 1), Max: image.Pt(2, 3)}, blocks[2].borderWidths)
+	require.Equal(t, red, blocks[2].border)
+}
+
+func TestPaint(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	blue := color.RGBA{0, 0, 0xff, 0xff}
+	green := color.RGBA{0, 0xff, 0, 0xff}
+	b := New().Hover(green)
+	blocks := testLayout(t, b, 100,
+		bar.TextSegment("ab").Color(red).Background(blue),
+		bar.TextSegment("cd").Border(red).BorderWidth(2).Separator(false),
+		bar.TextSegment("ef").OnClick(func(bar.Event) {}).Urgent(true),
+	)
+	img := newARGBImage(make([]byte, 100*20*4), 100, 20)
+	pixel := func(x, y int) color.RGBA {
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	black := color.RGBA{0, 0, 0, 0xff}
+
+	b.paint(img, blocks, 2)
+	r := blocks[0].rect
+	require.Equal(t, black, pixel(0, 0), "bar background")
+	require.Equal(t, blue, pixel(r.Min.X+1, 1), "segment background")
+	require.Equal(t, red, pixel(r.Min.X+5, 10), "segment text")
+	require.Equal(t, color.RGBA{0x66, 0x66, 0x66, 0xff},
+		pixel(blocks[0].separatorX, 10), "separator")
+
+	r = blocks[1].rect
+	require.Equal(t, red, pixel(r.Min.X+1, 10), "left border")
+	require.Equal(t, red, pixel(r.Max.X-2, 10), "right border")
+	require.Equal(t, red, pixel(r.Min.X+5, 1), "top border")
+	require.Equal(t, black, pixel(r.Min.X+5, 3), "default background")
+	require.Equal(t, white, pixel(r.Min.X+7, 10), "default text colour")
+
+	r = blocks[2].rect
+	require.Equal(t, green, pixel(r.Min.X+1, 1), "hovered")
+	b.paint(img, blocks, -1)
+	require.Equal(t, color.RGBA{0x90, 0, 0, 0xff}, pixel(r.Min.X+1, 1), "urgent")
+	b.paint(img, blocks, 1)
+	require.Equal(t, black, pixel(blocks[1].rect.Min.X+5, 3),
+		"not highlighted without click handler")
+}
+
+func TestBlockAt(t *testing.T) {
+	blocks := testLayout(t, New(), 200,
+		bar.TextSegment("abc"),
+		bar.TextSegment("hello"),
+	)
+	require.Equal(t, -1, blockAt(blocks, 0))
+	require.Equal(t, 0, blockAt(blocks, 134))
+	require.Equal(t, 0, blockAt(blocks, 153))
+	require.Equal(t, -1, blockAt(blocks, 154), "padding")
+	require.Equal(t, 1, blockAt(blocks, 163))
+	require.Equal(t, -1, blockAt(blocks, 199))
+}
+
+func TestTextCache(t *testing.T) {
+	f := new(fakeText)
+	c := &textCache{renderer: f}
+	a := c.render("a", false, color.White)
+	require.Equal(t, a, c.render("a", false, color.White))
+	c.render("a", true, color.White)
+	c.render("a", false, color.Black)
+	require.Equal(t, 3, f.count)
+
+	c.next()
+	require.Equal(t, a, c.render("a", false, color.White), "kept from previous draw")
+	c.next()
+	c.next()
+	c.render("a", false, color.White)
+	require.Equal(t, 4, f.count, "discarded when not used in a draw")
+}
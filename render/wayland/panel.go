@@ -0,0 +1,301 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"errors"
+	"image"
+
+	"barista.run/bar"
+	"barista.run/core"
+
+	"golang.org/x/sys/unix"
+)
+
+// panel is the bar's layer surface on a single output.
+type panel struct {
+	// The output the panel is on, or nil if the compositor chose the output.
+	output  *output
+	modules *core.ModuleSet
+	// Only used when drawing, so not guarded by the session's lock.
+	text textCache
+
+	surface      uint32
+	layerSurface uint32
+
+	size          image.Point
+	blocks        []block
+	pool          *shmPool
+	tooltip       *tooltip
+	dirty         bool
+	pendingRedraw bool
+	closed        bool
+}
+
+// addPanelLocked creates a panel on the given output, if the output has any
+// modules. The panel is drawn once the compositor configures its size.
+func (s *session) addPanelLocked(o *output) error {
+	var name string
+	var outputID uint32
+	if o != nil {
+		name, outputID = o.name, o.id
+	}
+	modules := s.outputs.For(name)
+	if modules == nil {
+		return nil
+	}
+	p := &panel{
+		output:  o,
+		modules: modules,
+		text:    textCache{renderer: s.text},
+		surface: s.c.newObject(nil),
+	}
+	p.layerSurface = s.c.newObject(func(opcode uint16, d *decoder) {
+		s.handleLayerSurface(p, opcode, d)
+	})
+	if o != nil {
+		o.panel = p
+	}
+	s.panels = append(s.panels, p)
+
+	anchor := uint32(anchorLeft | anchorRight | anchorTop)
+	if s.bottom {
+		anchor = anchorLeft | anchorRight | anchorBottom
+	}
+	for _, req := range []struct {
+		sender uint32
+		opcode uint16
+		args   *encoder
+	}{
+		{s.compositor, compositorCreateSurface, new(encoder).uint(p.surface)},
+		{s.layerShell, layerShellGetLayerSurface, new(encoder).
+			uint(p.layerSurface).uint(p.surface).uint(outputID).uint(layerTop).string("barista")},
+		{p.layerSurface, layerSurfaceSetSize, new(encoder).uint(0).uint(uint32(s.height))},
+		{p.layerSurface, layerSurfaceSetAnchor, new(encoder).uint(anchor)},
+		{p.layerSurface, layerSurfaceSetExclusiveZone, new(encoder).int(int32(s.height))},
+		{p.surface, surfaceCommit, nil},
+	} {
+		if err := s.c.send(req.sender, req.opcode, req.args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removePanelLocked destroys the panel, e.g. when its output is removed.
+func (s *session) removePanelLocked(p *panel) {
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for i, other := range s.panels {
+		if other == p {
+			s.panels = append(s.panels[:i], s.panels[i+1:]...)
+			break
+		}
+	}
+	if s.pointerPanel == p {
+		s.pointerPanel = nil
+	}
+	if p.output != nil {
+		p.output.panel = nil
+	}
+	if p.tooltip != nil {
+		s.hideTooltipLocked(p.tooltip)
+	}
+	s.c.send(p.layerSurface, layerSurfaceDestroy, nil)
+	s.c.send(p.surface, surfaceDestroy, nil)
+	s.destroyPool(p.pool)
+	p.pool = nil
+}
+
+func (s *session) handleLayerSurface(p *panel, opcode uint16, d *decoder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.closed {
+		return
+	}
+	switch opcode {
+	case layerSurfaceConfigure:
+		serial, width, height := d.uint(), int(d.uint()), int(d.uint())
+		if height == 0 {
+			height = s.height
+		}
+		s.c.send(p.layerSurface, layerSurfaceAckConfigure, new(encoder).uint(serial))
+		p.size = image.Pt(width, height)
+		p.dirty = true
+		s.redraw()
+	case layerSurfaceClosed:
+		if p.output == nil {
+			s.errCh <- errors.New("wayland: bar surface closed by compositor")
+			return
+		}
+		// The panel can be shown again if the output is added again.
+		s.removePanelLocked(p)
+	}
+}
+
+// draw lays out the latest output of the panel's modules, and paints it onto a
+// free buffer. If both buffers are still in use by the compositor, the panel
+// will be redrawn when one is released.
+func (s *session) draw(p *panel) error {
+	s.mu.Lock()
+	size := p.size
+	s.mu.Unlock()
+	if size.X <= 0 || size.Y <= 0 {
+		return nil
+	}
+	var segments []*bar.Segment
+	for _, out := range p.modules.LastOutputs() {
+		segments = append(segments, out...)
+	}
+	blocks := s.layout(segments, size, &p.text)
+
+	// Held while painting and sending, since the panel (and its buffers) can be
+	// destroyed by event handlers, e.g. if its output is removed.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.blocks = blocks
+	hover := s.hoverLocked(p)
+	if err := s.updateTooltipLocked(p, hover); err != nil {
+		return err
+	}
+	p.text.next()
+	buf, err := s.freeBufferLocked(p, size)
+	if buf == nil {
+		p.pendingRedraw = err == nil
+		return err
+	}
+	buf.busy = true
+	s.paint(buf.img, blocks, hover)
+	if err := s.c.send(p.surface, surfaceAttach,
+		new(encoder).uint(buf.id).int(0).int(0)); err != nil {
+		return err
+	}
+	if err := s.c.send(p.surface, surfaceDamage, new(encoder).
+		int(0).int(0).int(int32(size.X)).int(int32(size.Y))); err != nil {
+		return err
+	}
+	return s.c.send(p.surface, surfaceCommit, nil)
+}
+
+// shmPool is a shared memory pool holding one or more buffers of equal size.
+type shmPool struct {
+	id      uint32
+	size    image.Point
+	data    []byte
+	buffers []*shmBuffer
+}
+
+type shmBuffer struct {
+	id   uint32
+	img  *argbImage
+	busy bool
+}
+
+// freeBufferLocked returns a buffer of the given size that is not in use by
+// the compositor, creating new buffers if the size has changed. It returns nil
+// if no buffer is free.
+func (s *session) freeBufferLocked(p *panel, size image.Point) (*shmBuffer, error) {
+	if p.pool == nil || p.pool.size != size {
+		s.destroyPool(p.pool)
+		p.pool = nil
+		pool, err := s.createPool(size, 2, func() { s.releasedLocked(p) })
+		if err != nil {
+			return nil, err
+		}
+		p.pool = pool
+	}
+	for _, b := range p.pool.buffers {
+		if !b.busy {
+			return b, nil
+		}
+	}
+	return nil, nil
+}
+
+// releasedLocked redraws the panel if it could not be drawn earlier because no
+// buffers were free.
+func (s *session) releasedLocked(p *panel) {
+	if p.pendingRedraw && !p.closed {
+		p.pendingRedraw = false
+		p.dirty = true
+		s.redraw()
+	}
+}
+
+// createPool creates a pool with count buffers of the given size. When the
+// compositor releases a buffer, onRelease is called with the lock held.
+func (s *session) createPool(size image.Point, count int, onRelease func()) (*shmPool, error) {
+	bufSize := size.X * size.Y * 4
+	fd, err := unix.MemfdCreate("barista-wayland", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+	if err := unix.Ftruncate(fd, int64(count*bufSize)); err != nil {
+		return nil, err
+	}
+	data, err := unix.Mmap(fd, 0, count*bufSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	pool := &shmPool{
+		id:      s.c.newObject(nil),
+		size:    size,
+		data:    data,
+		buffers: make([]*shmBuffer, count),
+	}
+	if err := s.c.send(s.shm, shmCreatePool,
+		new(encoder).uint(pool.id).fd(fd).int(int32(count*bufSize))); err != nil {
+		unix.Munmap(data)
+		return nil, err
+	}
+	for i := range pool.buffers {
+		b := &shmBuffer{img: newARGBImage(data[i*bufSize:(i+1)*bufSize], size.X, size.Y)}
+		b.id = s.c.newObject(func(opcode uint16, _ *decoder) {
+			if opcode != bufferRelease {
+				return
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			b.busy = false
+			if onRelease != nil {
+				onRelease()
+			}
+		})
+		pool.buffers[i] = b
+		if err := s.c.send(pool.id, shmPoolCreateBuffer, new(encoder).
+			uint(b.id).int(int32(i*bufSize)).int(int32(size.X)).int(int32(size.Y)).
+			int(int32(size.X*4)).uint(formatARGB8888)); err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
+
+func (s *session) destroyPool(pool *shmPool) {
+	if pool == nil {
+		return
+	}
+	for _, b := range pool.buffers {
+		s.c.send(b.id, bufferDestroy, nil)
+	}
+	s.c.send(pool.id, shmPoolDestroy, nil)
+	unix.Munmap(pool.data)
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+// Object ids, opcodes, and enum values from the core wayland protocol,
+// xdg-shell, and wlr-layer-shell-unstable-v1, limited to the subset used by
+// the bar.
+
+const displayID = 1
+
+// wl_display
+const (
+	displaySync        = 0
+	displayGetRegistry = 1
+
+	displayError    = 0
+	displayDeleteID = 1
+)
+
+// wl_registry
+const (
+	registryBind = 0
+
+	registryGlobal       = 0
+	registryGlobalRemove = 1
+)
+
+// wl_compositor
+const compositorCreateSurface = 0
+
+// wl_surface
+const (
+	surfaceDestroy = 0
+	surfaceAttach  = 1
+	surfaceDamage  = 2
+	surfaceCommit  = 6
+)
+
+// wl_shm, wl_shm_pool, and wl_buffer
+const (
+	shmCreatePool = 0
+
+	shmPoolCreateBuffer = 0
+	shmPoolDestroy      = 1
+
+	bufferDestroy = 0
+	bufferRelease = 0
+
+	// formatARGB8888 is 32-bit premultiplied ARGB, in native byte order.
+	formatARGB8888 = 0
+)
+
+// wl_output
+const (
+	outputRelease = 0
+
+	outputDone = 2
+	outputName = 4
+)
+
+// wl_seat and wl_pointer
+const (
+	seatGetPointer   = 0
+	seatCapabilities = 0
+
+	seatCapabilityPointer = 1
+
+	pointerEnter  = 0
+	pointerLeave  = 1
+	pointerMotion = 2
+	pointerButton = 3
+	pointerAxis   = 4
+
+	pointerButtonPressed = 1
+
+	pointerAxisVertical   = 0
+	pointerAxisHorizontal = 1
+)
+
+// Linux input event codes for mouse buttons, from linux/input-event-codes.h.
+const (
+	btnLeft    = 0x110
+	btnRight   = 0x111
+	btnMiddle  = 0x112
+	btnSide    = 0x113
+	btnExtra   = 0x114
+	btnForward = 0x115
+	btnBack    = 0x116
+)
+
+// zwlr_layer_shell_v1 and zwlr_layer_surface_v1
+const (
+	layerShellGetLayerSurface = 0
+
+	layerTop = 2
+
+	layerSurfaceSetSize          = 0
+	layerSurfaceSetAnchor        = 1
+	layerSurfaceSetExclusiveZone = 2
+	layerSurfaceGetPopup         = 5
+	layerSurfaceAckConfigure     = 6
+	layerSurfaceDestroy          = 7
+
+	layerSurfaceConfigure = 0
+	layerSurfaceClosed    = 1
+
+	anchorTop    = 1
+	anchorBottom = 2
+	anchorLeft   = 4
+	anchorRight  = 8
+)
+
+// xdg_wm_base, xdg_positioner, xdg_surface, and xdg_popup, used for tooltips.
+const (
+	wmBaseCreatePositioner = 1
+	wmBaseGetXdgSurface    = 2
+	wmBasePong             = 3
+
+	wmBasePing = 0
+
+	positionerDestroy                 = 0
+	positionerSetSize                 = 1
+	positionerSetAnchorRect           = 2
+	positionerSetAnchor               = 3
+	positionerSetGravity              = 4
+	positionerSetConstraintAdjustment = 5
+
+	// Values for both set_anchor and set_gravity.
+	positionerTop    = 1
+	positionerBottom = 2
+
+	positionerSlideX = 1
+	positionerFlipY  = 8
+
+	xdgSurfaceDestroy      = 0
+	xdgSurfaceGetPopup     = 2
+	xdgSurfaceAckConfigure = 4
+
+	xdgSurfaceConfigure = 0
+
+	popupDestroy = 0
+
+	popupDone = 1
+)
+
+// Interface names of the globals used by the bar.
+const (
+	ifaceCompositor = "wl_compositor"
+	ifaceShm        = "wl_shm"
+	ifaceSeat       = "wl_seat"
+	ifaceOutput     = "wl_output"
+	ifaceLayerShell = "zwlr_layer_shell_v1"
+	ifaceWmBase     = "xdg_wm_base"
+)
@@ -0,0 +1,294 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"fmt"
+	"image"
+	"sync"
+
+	"barista.run/base/sdnotify"
+	"barista.run/core"
+	l "barista.run/logging"
+)
+
+type global struct {
+	name    uint32
+	version uint32
+}
+
+// output is a wl_output, which shows a panel if it has any modules.
+type output struct {
+	global
+	id    uint32
+	name  string
+	panel *panel
+}
+
+// session is a running bar, connected to a compositor.
+type session struct {
+	*Bar
+	c       *conn
+	outputs *core.PerOutput
+
+	registry   uint32
+	compositor uint32
+	shm        uint32
+	layerShell uint32
+	seat       uint32
+	wmBase     uint32
+
+	redrawCh chan struct{}
+	errCh    chan error
+
+	// Guards the state below (including the state of each panel), which is
+	// shared with event handlers.
+	mu      sync.Mutex
+	globals map[string]global
+	// Outputs by global name. Outputs are only bound once the globals needed
+	// for panels have been bound.
+	wlOutputs    map[uint32]*output
+	ready        bool
+	panels       []*panel
+	pointer      uint32
+	pointerPanel *panel
+	pointerPos   image.Point
+}
+
+func (b *Bar) run(c *conn, outputs *core.PerOutput) error {
+	s := &session{
+		Bar:       b,
+		c:         c,
+		outputs:   outputs,
+		globals:   map[string]global{},
+		wlOutputs: map[uint32]*output{},
+		redrawCh:  make(chan struct{}, 1),
+		errCh:     make(chan error, 2),
+	}
+	l.Attach(b, s, "~session")
+	go func() { s.errCh <- c.dispatch() }()
+	if err := s.setup(); err != nil {
+		return err
+	}
+	// Panels are created and committed in setup, so the bar is ready.
+	sdnotify.Ready()
+	watchdog := sdnotify.Watchdog()
+	for {
+		select {
+		case <-watchdog:
+			sdnotify.Pet()
+			continue
+		case set := <-outputs.Updates():
+			s.mu.Lock()
+			for _, p := range s.panels {
+				if p.modules == set {
+					p.dirty = true
+				}
+			}
+			s.mu.Unlock()
+		case <-s.redrawCh:
+		case err := <-s.errCh:
+			return err
+		}
+		if err := s.drawPanels(); err != nil {
+			return err
+		}
+	}
+}
+
+// setup binds the required globals and creates a panel on each output.
+func (s *session) setup() error {
+	s.registry = s.c.newObject(s.handleRegistry)
+	if err := s.c.send(displayID, displayGetRegistry,
+		new(encoder).uint(s.registry)); err != nil {
+		return err
+	}
+	if err := s.roundtrip(); err != nil {
+		return err
+	}
+	var err error
+	if s.compositor, err = s.bind(ifaceCompositor, 1, nil); err != nil {
+		return err
+	}
+	if s.shm, err = s.bind(ifaceShm, 1, nil); err != nil {
+		return err
+	}
+	if s.layerShell, err = s.bind(ifaceLayerShell, 1, nil); err != nil {
+		return err
+	}
+	// Without a seat the bar can still be drawn, but will not handle clicks.
+	if s.hasGlobal(ifaceSeat) {
+		if s.seat, err = s.bind(ifaceSeat, 1, s.handleSeat); err != nil {
+			return err
+		}
+	}
+	// Without xdg-shell, tooltips are shown using the tooltip handler.
+	if s.hasGlobal(ifaceWmBase) {
+		if s.wmBase, err = s.bind(ifaceWmBase, 1, s.handleWmBase); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = true
+	if len(s.wlOutputs) == 0 {
+		// Let the compositor choose the output, and show the default modules.
+		return s.addPanelLocked(nil)
+	}
+	for _, o := range s.wlOutputs {
+		if err := s.bindOutputLocked(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *session) hasGlobal(iface string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.globals[iface]
+	return ok
+}
+
+// bind binds a global by interface name, at the given version or the version
+// supported by the compositor, whichever is lower.
+func (s *session) bind(iface string, version uint32, h handler) (uint32, error) {
+	s.mu.Lock()
+	g, ok := s.globals[iface]
+	s.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("wayland: compositor does not support %s", iface)
+	}
+	return s.bindGlobal(g, iface, version, h)
+}
+
+func (s *session) bindGlobal(g global, iface string, version uint32, h handler) (uint32, error) {
+	if g.version < version {
+		version = g.version
+	}
+	id := s.c.newObject(h)
+	return id, s.c.send(s.registry, registryBind,
+		new(encoder).uint(g.name).string(iface).uint(version).uint(id))
+}
+
+func (s *session) roundtrip() error {
+	done, err := s.c.sync()
+	if err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case err := <-s.errCh:
+		return err
+	}
+}
+
+// redraw wakes up the main loop to redraw any panels marked dirty.
+func (s *session) redraw() {
+	select {
+	case s.redrawCh <- struct{}{}:
+	default:
+		// Already queued, and the queued redraw will use the latest output.
+	}
+}
+
+func (s *session) handleRegistry(opcode uint16, d *decoder) {
+	switch opcode {
+	case registryGlobal:
+		name, iface, version := d.uint(), d.string(), d.uint()
+		if d.err() != nil {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if iface != ifaceOutput {
+			s.globals[iface] = global{name, version}
+			return
+		}
+		o := &output{global: global{name, version}}
+		s.wlOutputs[name] = o
+		if s.ready {
+			s.bindOutputLocked(o)
+		}
+	case registryGlobalRemove:
+		name := d.uint()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if o, ok := s.wlOutputs[name]; ok {
+			delete(s.wlOutputs, name)
+			s.removeOutputLocked(o)
+		}
+	}
+}
+
+// bindOutputLocked binds an output, and adds its panel once the output's name
+// is known.
+func (s *session) bindOutputLocked(o *output) error {
+	var err error
+	// Version 4 adds the name event.
+	o.id, err = s.bindGlobal(o.global, ifaceOutput, 4, func(opcode uint16, d *decoder) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch opcode {
+		case outputName:
+			o.name = d.string()
+		case outputDone:
+			if o.panel == nil && s.wlOutputs[o.global.name] == o {
+				s.addPanelLocked(o)
+			}
+		}
+	})
+	if err != nil || o.version >= 2 {
+		return err
+	}
+	// Version 1 outputs have no done event.
+	return s.addPanelLocked(o)
+}
+
+func (s *session) removeOutputLocked(o *output) {
+	if o.panel != nil {
+		s.removePanelLocked(o.panel)
+	}
+	if o.id != 0 && o.version >= 3 {
+		s.c.send(o.id, outputRelease, nil)
+	}
+}
+
+func (s *session) handleWmBase(opcode uint16, d *decoder) {
+	if opcode == wmBasePing {
+		s.c.send(s.wmBase, wmBasePong, new(encoder).uint(d.uint()))
+	}
+}
+
+// drawPanels draws all panels that have been marked dirty.
+func (s *session) drawPanels() error {
+	var dirty []*panel
+	s.mu.Lock()
+	for _, p := range s.panels {
+		if p.dirty {
+			p.dirty = false
+			dirty = append(dirty, p)
+		}
+	}
+	s.mu.Unlock()
+	for _, p := range dirty {
+		if err := s.draw(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"image"
+	"image/color"
+)
+
+// TextRenderer renders the text of segments for the bar.
+type TextRenderer interface {
+	// Render draws the text in the given colour, and returns it as an image
+	// with a transparent background, sized to fit the text. If markup is true,
+	// the text uses pango markup.
+	Render(text string, markup bool, col color.Color) *image.RGBA
+}
+
+// textCache memoises rendered text between redraws, since most segments do not
+// change on each update.
+type textCache struct {
+	renderer TextRenderer
+	current  map[textKey]*image.RGBA
+	previous map[textKey]*image.RGBA
+}
+
+type textKey struct {
+	text   string
+	markup bool
+	color  color.RGBA
+}
+
+func (t *textCache) render(text string, markup bool, col color.Color) *image.RGBA {
+	key := textKey{text, markup, color.RGBAModel.Convert(col).(color.RGBA)}
+	if img, ok := t.current[key]; ok {
+		return img
+	}
+	img, ok := t.previous[key]
+	if !ok {
+		img = t.renderer.Render(text, markup, col)
+	}
+	if t.current == nil {
+		t.current = map[textKey]*image.RGBA{}
+	}
+	t.current[key] = img
+	return img
+}
+
+// next discards any text that was not rendered since the last call to next.
+func (t *textCache) next() {
+	t.previous, t.current = t.current, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build pango
+
+package wayland
+
+/*
+#cgo pkg-config: pangocairo
+#include <stdlib.h>
+#include <pango/pangocairo.h>
+*/
+import "C"
+
+import (
+	"image"
+	"image/color"
+	"sync"
+	"unsafe"
+)
+
+// pangoRenderer renders text using pango and cairo.
+type pangoRenderer struct {
+	mu     sync.Mutex
+	font   *C.PangoFontDescription
+	layout *C.PangoLayout
+	// A 1x1 surface and its context, used to create the layout and measure text.
+	surface *C.cairo_surface_t
+	cr      *C.cairo_t
+}
+
+// PangoText returns a TextRenderer that uses pango and cairo, with the given
+// pango font description (e.g. "DejaVu Sans Mono 10").
+func PangoText(font string) (TextRenderer, error) {
+	p := new(pangoRenderer)
+	cfont := C.CString(font)
+	defer C.free(unsafe.Pointer(cfont))
+	p.font = C.pango_font_description_from_string(cfont)
+	p.surface = C.cairo_image_surface_create(C.CAIRO_FORMAT_ARGB32, 1, 1)
+	p.cr = C.cairo_create(p.surface)
+	p.layout = C.pango_cairo_create_layout(p.cr)
+	C.pango_layout_set_font_description(p.layout, p.font)
+	return p, nil
+}
+
+func defaultTextRenderer(font string) (TextRenderer, error) {
+	return PangoText(font)
+}
+
+func (p *pangoRenderer) Render(text string, markup bool, col color.Color) *image.RGBA {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ctext := C.CString(text)
+	defer C.free(unsafe.Pointer(ctext))
+	if markup {
+		C.pango_layout_set_markup(p.layout, ctext, -1)
+	} else {
+		// Clear any attributes left over from previous markup.
+		C.pango_layout_set_attributes(p.layout, nil)
+		C.pango_layout_set_text(p.layout, ctext, -1)
+	}
+	var w, h C.int
+	C.pango_layout_get_pixel_size(p.layout, &w, &h)
+	img := image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	if w == 0 || h == 0 {
+		return img
+	}
+
+	surface := C.cairo_image_surface_create(C.CAIRO_FORMAT_ARGB32, w, h)
+	defer C.cairo_surface_destroy(surface)
+	cr := C.cairo_create(surface)
+	defer C.cairo_destroy(cr)
+	c := color.NRGBAModel.Convert(col).(color.NRGBA)
+	C.cairo_set_source_rgba(cr,
+		C.double(c.R)/255, C.double(c.G)/255, C.double(c.B)/255, C.double(c.A)/255)
+	C.pango_cairo_update_layout(cr, p.layout)
+	C.pango_cairo_show_layout(cr, p.layout)
+	C.cairo_surface_flush(surface)
+
+	// Cairo's ARGB32 is premultiplied ARGB in native byte order, the same as
+	// wl_shm's ARGB8888, while image.RGBA is premultiplied RGBA in byte order.
+	data := C.cairo_image_surface_get_data(surface)
+	stride := int(C.cairo_image_surface_get_stride(surface))
+	pix := C.GoBytes(unsafe.Pointer(data), C.int(stride*int(h)))
+	for y := 0; y < int(h); y++ {
+		for x := 0; x < int(w); x++ {
+			v := byteOrder.Uint32(pix[y*stride+x*4:])
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: uint8(v >> 24),
+			})
+		}
+	}
+	return img
+}
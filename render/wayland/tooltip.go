@@ -0,0 +1,158 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"image"
+
+	"barista.run/bar"
+)
+
+// tooltip is the tooltip shown for the hovered block of a panel. If the compositor does
+// not support popups, it only tracks the tooltip most recently sent to the
+// tooltip handler.
+type tooltip struct {
+	text   string
+	anchor image.Rectangle
+
+	surface    uint32
+	xdgSurface uint32
+	popup      uint32
+	pool       *shmPool
+	// Set when the popup is destroyed by either the bar or the compositor.
+	closed bool
+}
+
+// updateTooltipLocked shows the tooltip of the hovered block on the panel,
+// replacing any tooltip for a previously hovered block.
+func (s *session) updateTooltipLocked(p *panel, hover int) error {
+	var text string
+	var anchor image.Rectangle
+	if hover >= 0 {
+		text, _ = p.blocks[hover].segment.GetTooltip()
+		anchor = p.blocks[hover].rect
+	}
+	current := p.tooltip
+	if current != nil && current.text == text && current.anchor == anchor {
+		return nil
+	}
+	if current != nil {
+		s.hideTooltipLocked(current)
+		p.tooltip = nil
+	}
+	if text == "" {
+		return nil
+	}
+	p.tooltip = &tooltip{text: text, anchor: anchor}
+	if s.wmBase == 0 {
+		go s.tooltipHandler(bar.TooltipEvent{
+			Tooltip: text,
+			Event:   event(p.blocks[hover], s.pointerPos, 0),
+		})
+		return nil
+	}
+	return s.showTooltipLocked(p, p.tooltip)
+}
+
+// showTooltipLocked creates a popup for the tooltip, positioned beside its
+// block and drawn once the compositor configures it.
+func (s *session) showTooltipLocked(p *panel, t *tooltip) error {
+	text := p.text.render(t.text, false, s.colors.foreground)
+	padding := image.Pt(s.textPadding, s.textPadding)
+	size := text.Bounds().Size().Add(padding.Mul(2))
+	pool, err := s.createPool(size, 1, nil)
+	if err != nil {
+		return err
+	}
+	img := pool.buffers[0].img
+	img.fill(img.Bounds(), s.colors.background)
+	img.over(padding, text)
+
+	t.pool = pool
+	t.surface = s.c.newObject(nil)
+	t.xdgSurface = s.c.newObject(func(opcode uint16, d *decoder) {
+		if opcode == xdgSurfaceConfigure {
+			s.configureTooltip(t, d.uint())
+		}
+	})
+	t.popup = s.c.newObject(func(opcode uint16, _ *decoder) {
+		if opcode == popupDone {
+			s.mu.Lock()
+			t.closed = true
+			s.mu.Unlock()
+		}
+	})
+	positioner := s.c.newObject(nil)
+	edge := uint32(positionerBottom)
+	if s.bottom {
+		edge = positionerTop
+	}
+	a := t.anchor
+	for _, req := range []struct {
+		sender uint32
+		opcode uint16
+		args   *encoder
+	}{
+		{s.compositor, compositorCreateSurface, new(encoder).uint(t.surface)},
+		{s.wmBase, wmBaseCreatePositioner, new(encoder).uint(positioner)},
+		{positioner, positionerSetSize, new(encoder).int(int32(size.X)).int(int32(size.Y))},
+		{positioner, positionerSetAnchorRect, new(encoder).
+			int(int32(a.Min.X)).int(int32(a.Min.Y)).int(int32(a.Dx())).int(int32(a.Dy()))},
+		{positioner, positionerSetAnchor, new(encoder).uint(edge)},
+		{positioner, positionerSetGravity, new(encoder).uint(edge)},
+		{positioner, positionerSetConstraintAdjustment,
+			new(encoder).uint(positionerSlideX | positionerFlipY)},
+		{s.wmBase, wmBaseGetXdgSurface, new(encoder).uint(t.xdgSurface).uint(t.surface)},
+		// The parent is set using the layer surface instead of xdg_surface.
+		{t.xdgSurface, xdgSurfaceGetPopup, new(encoder).uint(t.popup).uint(0).uint(positioner)},
+		{p.layerSurface, layerSurfaceGetPopup, new(encoder).uint(t.popup)},
+		{positioner, positionerDestroy, nil},
+		{t.surface, surfaceCommit, nil},
+	} {
+		if err := s.c.send(req.sender, req.opcode, req.args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configureTooltip acknowledges a configure event for the tooltip's popup,
+// and attaches the tooltip's buffer.
+func (s *session) configureTooltip(t *tooltip, serial uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Held while sending so that the popup cannot be destroyed concurrently.
+	if t.closed {
+		return
+	}
+	size := t.pool.size
+	s.c.send(t.xdgSurface, xdgSurfaceAckConfigure, new(encoder).uint(serial))
+	s.c.send(t.surface, surfaceAttach, new(encoder).uint(t.pool.buffers[0].id).int(0).int(0))
+	s.c.send(t.surface, surfaceDamage, new(encoder).
+		int(0).int(0).int(int32(size.X)).int(int32(size.Y)))
+	s.c.send(t.surface, surfaceCommit, nil)
+}
+
+func (s *session) hideTooltipLocked(t *tooltip) {
+	t.closed = true
+	if t.surface == 0 {
+		return
+	}
+	s.c.send(t.popup, popupDestroy, nil)
+	s.c.send(t.xdgSurface, xdgSurfaceDestroy, nil)
+	s.c.send(t.surface, surfaceDestroy, nil)
+	s.destroyPool(t.pool)
+	t.surface = 0
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"encoding/binary"
+	"errors"
+	"unsafe"
+)
+
+// The wayland wire protocol uses the host's byte order.
+var byteOrder binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		byteOrder = binary.BigEndian
+	}
+}
+
+// headerSize is the size of a message header: the sender's object id, and
+// the message size (including the header) with the opcode.
+const headerSize = 8
+
+var errShortMessage = errors.New("wayland: message too short")
+
+// encoder builds the arguments of a single wayland message.
+type encoder struct {
+	buf []byte
+	fds []int
+}
+
+func (e *encoder) uint(v uint32) *encoder {
+	var b [4]byte
+	byteOrder.PutUint32(b[:], v)
+	e.buf = append(e.buf, b[:]...)
+	return e
+}
+
+func (e *encoder) int(v int32) *encoder {
+	return e.uint(uint32(v))
+}
+
+// string appends a string argument, which is sent as a length (including the
+// NUL terminator) followed by the NUL-terminated string, padded to 32 bits.
+func (e *encoder) string(s string) *encoder {
+	e.uint(uint32(len(s) + 1))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+	for len(e.buf)%4 != 0 {
+		e.buf = append(e.buf, 0)
+	}
+	return e
+}
+
+// fd adds a file descriptor to be sent with the message. File descriptors are
+// not part of the message body; they are sent out-of-band on the socket.
+func (e *encoder) fd(fd int) *encoder {
+	e.fds = append(e.fds, fd)
+	return e
+}
+
+// message returns the complete message, including the header.
+func (e *encoder) message(sender uint32, opcode uint16) []byte {
+	msg := make([]byte, headerSize, headerSize+len(e.buf))
+	byteOrder.PutUint32(msg[0:4], sender)
+	byteOrder.PutUint32(msg[4:8], uint32(headerSize+len(e.buf))<<16|uint32(opcode))
+	return append(msg, e.buf...)
+}
+
+// parseHeader returns the sender, opcode, and total size of the message at the
+// start of buf. The message body may not be complete.
+func parseHeader(buf []byte) (sender uint32, opcode uint16, size int) {
+	sender = byteOrder.Uint32(buf[0:4])
+	sizeOp := byteOrder.Uint32(buf[4:8])
+	return sender, uint16(sizeOp & 0xffff), int(sizeOp >> 16)
+}
+
+// decoder reads the arguments of a single wayland message. Errors are sticky,
+// and should be checked using err() after reading all arguments.
+type decoder struct {
+	data []byte
+	e    error
+}
+
+func (d *decoder) err() error {
+	return d.e
+}
+
+func (d *decoder) uint() uint32 {
+	if len(d.data) < 4 {
+		d.e = errShortMessage
+		return 0
+	}
+	v := byteOrder.Uint32(d.data)
+	d.data = d.data[4:]
+	return v
+}
+
+func (d *decoder) int() int32 {
+	return int32(d.uint())
+}
+
+// fixed reads a signed 24.8 fixed-point number.
+func (d *decoder) fixed() float64 {
+	return float64(d.int()) / 256.0
+}
+
+func (d *decoder) string() string {
+	l := int(d.uint())
+	padded := (l + 3) &^ 3
+	if l == 0 || len(d.data) < padded {
+		if l != 0 {
+			d.e = errShortMessage
+		}
+		return ""
+	}
+	s := string(d.data[:l-1])
+	d.data = d.data[padded:]
+	return s
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wayland
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	msg := new(encoder).uint(42).int(-7).string("wl_seat").string("").
+		int(0x180).message(3, 5)
+	require.Equal(t, 0, len(msg)%4, "messages are 32-bit aligned")
+
+	sender, opcode, size := parseHeader(msg)
+	require.Equal(t, uint32(3), sender)
+	require.Equal(t, uint16(5), opcode)
+	require.Equal(t, len(msg), size)
+
+	d := &decoder{data: msg[headerSize:]}
+	require.Equal(t, uint32(42), d.uint())
+	require.Equal(t, int32(-7), d.int())
+	require.Equal(t, "wl_seat", d.string())
+	require.Equal(t, "", d.string())
+	require.Equal(t, 1.5, d.fixed())
+	require.NoError(t, d.err())
+
+	require.Equal(t, uint32(0), d.uint(), "reading past the end")
+	require.Error(t, d.err())
+}
+
+func TestDecodeShortString(t *testing.T) {
+	msg := new(encoder).string("wl_compositor").message(1, 0)
+	d := &decoder{data: msg[headerSize : len(msg)-4]}
+	require.Equal(t, "", d.string())
+	require.Equal(t, errShortMessage, d.err())
+}
+
+func TestEncodeFds(t *testing.T) {
+	e := new(encoder).uint(1).fd(5).int(10)
+	require.Equal(t, []int{5}, e.fds)
+	require.Len(t, e.message(1, 0), headerSize+8, "fds are not part of the message body")
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package barista
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"barista.run/bar"
+	"barista.run/outputs"
+	"barista.run/testing/mockio"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	stressModules          = 200
+	stressOutputsPerModule = 25
+	stressClicks           = 500
+)
+
+// stressModule emits a fixed number of outputs at random intervals, and an
+// additional output for each click it receives. Each output has the same
+// number of segments, with text "<module>:<seq>:<segment>", so that the bar's
+// output can be checked for ordering and staleness.
+type stressModule struct {
+	idx      int
+	segments int
+	rand     *rand.Rand
+
+	seq    int64 // last emitted sequence number, atomic.
+	clicks int64 // atomic.
+
+	clickCh chan struct{}
+	done    chan struct{}
+}
+
+func newStressModule(idx int, seed int64) *stressModule {
+	return &stressModule{
+		idx:      idx,
+		segments: idx%3 + 1,
+		rand:     rand.New(rand.NewSource(seed)),
+		clickCh:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+func (m *stressModule) Stream(s bar.Sink) {
+	for i := 0; i < stressOutputsPerModule; i++ {
+		time.Sleep(time.Duration(m.rand.Intn(1000)) * time.Microsecond)
+		select {
+		case <-m.clickCh:
+		default:
+		}
+		m.output(s)
+	}
+	close(m.done)
+	for range m.clickCh {
+		m.output(s)
+	}
+}
+
+func (m *stressModule) output(s bar.Sink) {
+	seq := atomic.AddInt64(&m.seq, 1)
+	out := outputs.Group()
+	for j := 0; j < m.segments; j++ {
+		out.Append(outputs.Textf("%d:%d:%d", m.idx, seq, j).OnClick(m.click))
+	}
+	s.Output(out)
+}
+
+func (m *stressModule) click(bar.Event) {
+	atomic.AddInt64(&m.clicks, 1)
+	select {
+	case m.clickCh <- struct{}{}:
+	default:
+	}
+}
+
+// stressReader reads complete lines of bar output without failing when no
+// output is available.
+type stressReader struct {
+	stdout  *mockio.Writable
+	pending string
+}
+
+func (r *stressReader) next(t *testing.T) ([]string, bool) {
+	for {
+		s, err := r.stdout.ReadUntil('\n', 10*time.Millisecond)
+		r.pending += s
+		if err != nil {
+			return nil, false
+		}
+		line := strings.TrimSpace(r.pending)
+		r.pending = ""
+		if line == "," {
+			continue
+		}
+		var segments []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &segments),
+			"output is valid json: %s", line)
+		texts := make([]string, len(segments))
+		for i, s := range segments {
+			texts[i] = s["full_text"].(string)
+		}
+		return texts, true
+	}
+}
+
+// checkStressOutput verifies that the segments in a single bar output are
+// contiguous and in module order, and that no module's output goes backwards.
+// It updates shown with the sequence number displayed for each module.
+func checkStressOutput(t *testing.T, mods []*stressModule, shown []int64, texts []string) {
+	lastModule := -1
+	for i := 0; i < len(texts); {
+		var idx, seq, seg int
+		_, err := fmt.Sscanf(texts[i], "%d:%d:%d", &idx, &seq, &seg)
+		require.NoError(t, err, "unexpected segment %q", texts[i])
+		require.True(t, idx > lastModule,
+			"module %d output after module %d in %v", idx, lastModule, texts)
+		lastModule = idx
+		require.True(t, int64(seq) >= shown[idx],
+			"module %d went from #%d back to #%d", idx, shown[idx], seq)
+		shown[idx] = int64(seq)
+		for j := 0; j < mods[idx].segments; j++ {
+			require.True(t, i+j < len(texts),
+				"module %d is missing segments in %v", idx, texts)
+			require.Equal(t, fmt.Sprintf("%d:%d:%d", idx, seq, j), texts[i+j],
+				"module %d segments are contiguous and consistent", idx)
+		}
+		i += mods[idx].segments
+	}
+}
+
+func TestStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping stress test in short mode")
+	}
+	seed := time.Now().UnixNano()
+	t.Logf("Using seed %d", seed)
+	rnd := rand.New(rand.NewSource(seed))
+
+	mockStdin := mockio.Stdin()
+	mockStdout := mockio.Stdout()
+	TestMode(mockStdin, mockStdout)
+
+	mods := make([]*stressModule, stressModules)
+	modules := make([]bar.Module, stressModules)
+	// Once all modules have output, the index of each segment's click handler
+	// is fixed, since every module always outputs the same number of segments.
+	var handlers []*stressModule
+	for i := range mods {
+		mods[i] = newStressModule(i, rnd.Int63())
+		modules[i] = mods[i]
+		for j := 0; j < mods[i].segments; j++ {
+			handlers = append(handlers, mods[i])
+		}
+	}
+	go Run(modules...)
+
+	_, err := mockStdout.ReadUntil('[', time.Second)
+	require.NoError(t, err, "output array started without any errors")
+	mockStdin.WriteString("[")
+
+	sent := make([]int64, stressModules)
+	startClicks := make(chan struct{})
+	clicksDone := make(chan struct{})
+	go func(rnd *rand.Rand) {
+		defer close(clicksDone)
+		<-startClicks
+		for i := 0; i < stressClicks; i++ {
+			time.Sleep(time.Duration(rnd.Intn(100)) * time.Microsecond)
+			idx := rnd.Intn(len(handlers))
+			sent[handlers[idx].idx]++
+			mockStdin.WriteString(fmt.Sprintf(`{"name": "%d", "button": 1},`, idx))
+		}
+	}(rand.New(rand.NewSource(rnd.Int63())))
+
+	reader := &stressReader{stdout: mockStdout}
+	shown := make([]int64, stressModules)
+	clicking := false
+	// settled returns a description of the first inconsistency between the
+	// modules' state and the bar, or an empty string if everything has been
+	// delivered.
+	settled := func() string {
+		select {
+		case <-clicksDone:
+		default:
+			return "clicks still being sent"
+		}
+		for i, m := range mods {
+			select {
+			case <-m.done:
+			default:
+				return fmt.Sprintf("module %d still running", i)
+			}
+			if c := atomic.LoadInt64(&m.clicks); c != sent[i] {
+				return fmt.Sprintf("module %d received %d of %d clicks", i, c, sent[i])
+			}
+			if len(m.clickCh) > 0 {
+				return fmt.Sprintf("module %d has a pending click", i)
+			}
+			if s := atomic.LoadInt64(&m.seq); s != shown[i] {
+				return fmt.Sprintf("module %d output #%d, bar shows #%d", i, s, shown[i])
+			}
+		}
+		return ""
+	}
+
+	deadline := time.After(time.Minute)
+	for {
+		if texts, ok := reader.next(t); ok {
+			checkStressOutput(t, mods, shown, texts)
+			if !clicking && len(texts) == len(handlers) {
+				clicking = true
+				close(startClicks)
+			}
+		}
+		problem := settled()
+		if problem == "" {
+			break
+		}
+		select {
+		case <-deadline:
+			require.Fail(t, "Bar did not settle", problem)
+		default:
+		}
+	}
+}
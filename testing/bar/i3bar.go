@@ -0,0 +1,141 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bar
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"barista.run"
+	"barista.run/bar"
+	"barista.run/oauth"
+	"barista.run/testing/mockio"
+	"barista.run/timing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// I3Bar runs a complete bar, as barista.Run would, against a fake i3bar
+// connection. Unlike TestBar, which only collects the output of modules, it
+// exercises the full i3bar protocol: the header, the JSON stream of blocks,
+// and click events, which makes it suitable for catching protocol-level
+// regressions across multiple modules and groups.
+type I3Bar struct {
+	require.TestingT
+	stdin  *mockio.Readable
+	stdout *mockio.Writable
+	header map[string]interface{}
+	last   []map[string]interface{}
+}
+
+// NewI3Bar creates a new fake i3bar connection and sets up the bar to use it.
+// Like New, this must be called before any modules are constructed.
+func NewI3Bar(t require.TestingT) *I3Bar {
+	timing.TestMode()
+	encryptionKeySet.Do(func() {
+		oauth.SetEncryptionKey([]byte(`not-an-encryption-key`))
+	})
+	b := &I3Bar{
+		TestingT: t,
+		stdin:    mockio.Stdin(),
+		stdout:   mockio.Stdout(),
+	}
+	barista.TestMode(b.stdin, b.stdout)
+	return b
+}
+
+// Run starts the bar with the given modules, and waits for it to write the
+// protocol header.
+func (b *I3Bar) Run(modules ...bar.Module) {
+	go barista.Run(modules...)
+	header, err := b.stdout.ReadUntil('\n', positiveTimeout)
+	require.NoError(b, err, "Expected a header")
+	require.NoError(b, json.Unmarshal([]byte(header), &b.header), "Header is not valid JSON")
+	start, err := b.stdout.ReadUntil('[', positiveTimeout)
+	require.NoError(b, err, "Expected the start of the output stream")
+	require.Equal(b, "[", start, "Unexpected data before the output stream")
+	// Start the infinite array of click events.
+	b.stdin.WriteString("[")
+}
+
+// Header returns the protocol header sent by the bar, as decoded JSON.
+func (b *I3Bar) Header() map[string]interface{} {
+	return b.header
+}
+
+// NextJSON returns the raw JSON for the next update written by the bar, i.e.
+// the array of blocks for all modules.
+func (b *I3Bar) NextJSON(formatAndArgs ...interface{}) string {
+	out, err := b.stdout.ReadUntil('\n', positiveTimeout)
+	if err != nil {
+		require.Fail(b, "Expected an output, got none", formatAndArgs...)
+	}
+	sep, err := b.stdout.ReadUntil('\n', positiveTimeout)
+	require.NoError(b, err, "Expected a separator after the output")
+	require.Equal(b, ",\n", sep, "Unexpected separator after the output")
+	out = strings.TrimSuffix(out, "\n")
+	var blocks []map[string]interface{}
+	require.NoError(b, json.Unmarshal([]byte(out), &blocks),
+		"Output is not valid JSON: %s", out)
+	b.last = blocks
+	return out
+}
+
+// NextOutput returns the decoded blocks for the next update written by the
+// bar. Numbers are decoded as float64, as with encoding/json.
+func (b *I3Bar) NextOutput(formatAndArgs ...interface{}) []map[string]interface{} {
+	b.NextJSON(formatAndArgs...)
+	return b.last
+}
+
+// NextTexts returns the full_text of each block in the next update written by
+// the bar.
+func (b *I3Bar) NextTexts(formatAndArgs ...interface{}) []string {
+	var texts []string
+	for _, block := range b.NextOutput(formatAndArgs...) {
+		txt, _ := block["full_text"].(string)
+		texts = append(texts, txt)
+	}
+	return texts
+}
+
+// AssertNoOutput asserts that the bar did not write an update.
+func (b *I3Bar) AssertNoOutput(args ...interface{}) {
+	if out, err := b.stdout.ReadUntil('\n', negativeTimeout); err == nil {
+		require.Fail(b, "Expected no output", "Got %s. %s", out, fmt.Sprint(args...))
+	}
+}
+
+// SendEvent sends a raw event to the bar, as i3bar would on stdin. The event
+// must be a JSON object, e.g. `{"name": "0", "button": 1}`.
+func (b *I3Bar) SendEvent(event string) {
+	b.stdin.WriteString(event + ",")
+}
+
+// Click sends a click event with the given button for the block at the given
+// index, as of the most recent output read using NextJSON/NextOutput.
+func (b *I3Bar) Click(block int, button bar.Button) {
+	require.True(b, block >= 0 && block < len(b.last),
+		"Block %d out of range (have %d blocks)", block, len(b.last))
+	name, ok := b.last[block]["name"].(string)
+	require.True(b, ok, "Block %d does not handle clicks", block)
+	b.SendEvent(fmt.Sprintf(`{"name": %q, "button": %d}`, name, button))
+}
+
+// LeftClick sends a left click event for the block at the given index.
+func (b *I3Bar) LeftClick(block int) {
+	b.Click(block, bar.ButtonLeft)
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bar
+
+import (
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/group"
+	"barista.run/outputs"
+	"barista.run/testing/fail"
+	"barista.run/testing/module"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestI3Bar(t *testing.T) {
+	b := NewI3Bar(t)
+	m1 := module.New(t)
+	m2 := module.New(t)
+	m3 := module.New(t).SkipClickHandlers()
+	b.Run(m1, group.Simple(m2, m3))
+
+	require.Equal(t, 1.0, b.Header()["version"], "protocol version")
+	require.Equal(t, true, b.Header()["click_events"], "click events enabled")
+
+	m1.AssertStarted()
+	m2.AssertStarted()
+	m3.AssertStarted()
+	require.Equal(t, "[]", b.NextJSON("group output on start"))
+	b.AssertNoOutput("before any module outputs")
+
+	m1.OutputText("a")
+	require.Equal(t, []string{"a"}, b.NextTexts("on first output"))
+
+	m2.Output(outputs.Group(
+		outputs.Text("b"),
+		outputs.Text("c").Color(colors.Hex("#ff0000")).Urgent(true),
+	))
+	require.Equal(t,
+		`[{"full_text":"a","markup":"none","name":"0"},`+
+			`{"full_text":"b","markup":"none","name":"1"},`+
+			`{"color":"#ff0000","full_text":"c","markup":"none","name":"2","urgent":true}]`,
+		b.NextJSON("on grouped module output"))
+
+	m3.Output(bar.TextSegment("d"))
+	out := b.NextOutput("on output without click handler")
+	require.Len(t, out, 4)
+	require.Equal(t, "d", out[3]["full_text"])
+	require.NotContains(t, out[3], "name", "no name without click handler")
+
+	b.LeftClick(0)
+	require.Equal(t, bar.ButtonLeft, m1.AssertClicked("on left click").Button)
+	m2.AssertNotClicked("when another module is clicked")
+
+	b.Click(2, bar.ButtonRight)
+	require.Equal(t, bar.ButtonRight, m2.AssertClicked("on right click").Button)
+
+	b.SendEvent(`{"name": "1", "button": 4, "x": 120, "relative_x": 5, "width": 30}`)
+	e := m2.AssertClicked("on raw event")
+	require.Equal(t, bar.ScrollUp, e.Button)
+	require.Equal(t, 120, e.ScreenX)
+	require.Equal(t, 5, e.X)
+	require.Equal(t, 30, e.Width)
+
+	b.SendEvent(`{"name": "m/foo/bar", "button": 1}`)
+	b.SendEvent(`{"name": "17", "button": 1}`)
+	m1.AssertNotClicked("with invalid names")
+	m2.AssertNotClicked("with invalid names")
+
+	require.True(t, fail.Failed(func(t *testing.T) {
+		b.TestingT = t
+		b.Click(3, bar.ButtonLeft)
+	}), "clicking a block without a name")
+	require.True(t, fail.Failed(func(t *testing.T) {
+		b.TestingT = t
+		b.LeftClick(10)
+	}), "clicking a block out of range")
+	b.TestingT = t
+
+	m1.Close()
+	out = b.NextOutput("on module finishing")
+	require.Equal(t, "a", out[0]["full_text"], "last output kept")
+	b.LeftClick(0)
+	m1.AssertStarted("restarted on click")
+	b.NextOutput("restart handlers removed")
+	m1.OutputText("restarted")
+	require.Equal(t, []string{"restarted", "b", "c", "d"}, b.NextTexts())
+
+	require.True(t, fail.Failed(func(t *testing.T) {
+		b.TestingT = t
+		b.AssertNoOutput()
+		m1.OutputText("e")
+		b.AssertNoOutput()
+	}), "AssertNoOutput with new output")
+}
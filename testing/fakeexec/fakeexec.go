@@ -0,0 +1,104 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakeexec provides a replacement for exec.Command that returns
+// canned output and records the commands run, for testing modules that
+// shell out to external programs.
+package fakeexec // import "barista.run/testing/fakeexec"
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type result struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// Fake holds the results for commands, and the list of commands run.
+type Fake struct {
+	mu       sync.Mutex
+	results  map[string]result
+	commands [][]string
+}
+
+var instance atomic.Value // of *Fake
+
+// New creates a new fake and makes it the target of Command. Commands started
+// after this call, including those from modules created before it, will use
+// the new fake.
+func New() *Fake {
+	f := &Fake{results: map[string]result{}}
+	instance.Store(f)
+	return f
+}
+
+// Command is a replacement for exec.Command, which runs a shell command
+// producing the output set for the named command on the most recent fake.
+// Commands without a result fail with "command not found".
+func Command(name string, args ...string) *exec.Cmd {
+	f, _ := instance.Load().(*Fake)
+	if f == nil {
+		panic("fakeexec.Command called without fakeexec.New")
+	}
+	return f.command(name, args...)
+}
+
+func (f *Fake) command(name string, args ...string) *exec.Cmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, append([]string{name}, args...))
+	r, ok := f.results[name]
+	if !ok {
+		r = result{"", name + ": command not found", 127}
+	}
+	return exec.Command("sh", "-c", `printf %s "$1"; printf %s "$2" >&2; exit $3`,
+		"sh", r.stdout, r.stderr, strconv.Itoa(r.code))
+}
+
+// Set sets the output and exit code for all future runs of the named command,
+// regardless of its arguments.
+func (f *Fake) Set(name, stdout, stderr string, code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[name] = result{stdout, stderr, code}
+}
+
+// Commands returns all commands run so far, with the name and arguments of
+// each joined by spaces.
+func (f *Fake) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cmds := make([]string, len(f.commands))
+	for i, c := range f.commands {
+		cmds[i] = strings.Join(c, " ")
+	}
+	return cmds
+}
+
+// Last returns the name and arguments of the most recent command run,
+// or nil if no commands have been run.
+func (f *Fake) Last() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.commands) == 0 {
+		return nil
+	}
+	return f.commands[len(f.commands)-1]
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fakeexec
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeExec(t *testing.T) {
+	f := New()
+	require.Nil(t, f.Last())
+	require.Empty(t, f.Commands())
+
+	f.Set("echo", "hello", "", 0)
+	out, err := Command("echo", "-n", "world").Output()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(out), "ignores arguments")
+	require.Equal(t, []string{"echo", "-n", "world"}, f.Last())
+
+	f.Set("false", "partial", "something failed", 3)
+	out, err = Command("false").Output()
+	require.Equal(t, "partial", string(out))
+	exitErr, ok := err.(*exec.ExitError)
+	require.True(t, ok, "exits with error")
+	require.Equal(t, 3, exitErr.ExitCode())
+	require.Equal(t, "something failed", string(exitErr.Stderr))
+
+	_, err = Command("foo", "bar").Output()
+	exitErr, ok = err.(*exec.ExitError)
+	require.True(t, ok, "unknown command fails")
+	require.Equal(t, 127, exitErr.ExitCode())
+	require.Equal(t, "foo: command not found", string(exitErr.Stderr))
+
+	require.Equal(t, []string{"echo -n world", "false", "foo bar"}, f.Commands())
+
+	f2 := New()
+	f2.Set("echo", "new", "", 0)
+	out, _ = Command("echo").Output()
+	require.Equal(t, "new", string(out), "uses most recent fake")
+	require.Equal(t, []string{"echo -n world", "false", "foo bar"}, f.Commands(),
+		"previous fake is not affected")
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package golden provides golden-file snapshots of module output for tests.
+
+A snapshot collects a sequence of labelled outputs, typically each output of a
+module as it is tested, and serializes them to text: the content of each
+segment, along with any attributes that are set (colours, urgency, padding,
+etc.) and whether it has a click handler. When the test finishes, the result is
+compared to testdata/<TestName>.golden, failing the test if they differ.
+
+Golden files are created or updated by running the tests with -update:
+
+	go test ./modules/foo -update
+
+Review any changes to golden files just as carefully as changes to code, since
+they are the expected output of the test.
+*/
+package golden // import "barista.run/testing/golden"
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"barista.run/bar"
+
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// Overridden in tests.
+var testdataDir = "testdata"
+
+// Snapshot collects outputs to compare against a golden file.
+type Snapshot struct {
+	t       testing.TB
+	path    string
+	entries []string
+}
+
+var sanitizeRe = regexp.MustCompile(`[^[:alnum:]-\.]+`)
+
+// New creates a snapshot for the current test, compared against (or, with
+// -update, written to) testdata/<TestName>.golden when the test finishes.
+func New(t testing.TB) *Snapshot {
+	name := sanitizeRe.ReplaceAllString(t.Name(), "_")
+	s := &Snapshot{t: t, path: filepath.Join(testdataDir, name+".golden")}
+	t.Cleanup(s.check)
+	return s
+}
+
+// Add adds an output to the snapshot. The label is included in the golden
+// file to make differences easier to track down, and should describe why the
+// output was expected (e.g. "on start", "after click").
+//
+// Since output.Assertions implements bar.Output, the outputs from
+// testing/bar can be added directly:
+//
+//	snapshot.Add("on start", testBar.NextOutput())
+func (s *Snapshot) Add(label string, out bar.Output) *Snapshot {
+	s.entries = append(s.entries, fmt.Sprintf("== %s\n%s", label, Format(out)))
+	return s
+}
+
+// Format serializes an output to the text used in golden files, with one line
+// per segment.
+func Format(out bar.Output) string {
+	if out == nil {
+		return "(nil)\n"
+	}
+	segments := out.Segments()
+	if len(segments) == 0 {
+		return "(empty)\n"
+	}
+	var b strings.Builder
+	for i, seg := range segments {
+		fmt.Fprintf(&b, "[%d]", i)
+		for _, attr := range attributes(seg) {
+			b.WriteString(" ")
+			b.WriteString(attr)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func attributes(s *bar.Segment) []string {
+	var attrs []string
+	add := func(format string, args ...interface{}) {
+		attrs = append(attrs, fmt.Sprintf(format, args...))
+	}
+	if text, isPango := s.Content(); isPango {
+		add("pango=%q", text)
+	} else {
+		add("text=%q", text)
+	}
+	if short, ok := s.GetShortText(); ok {
+		add("short=%q", short)
+	}
+	if tooltip, ok := s.GetTooltip(); ok {
+		add("tooltip=%q", tooltip)
+	}
+	if err := s.GetError(); err != nil {
+		add("error=%q", err.Error())
+	}
+	if c, ok := s.GetColor(); ok {
+		add("color=%s", hex(c))
+	}
+	if c, ok := s.GetBackground(); ok {
+		add("background=%s", hex(c))
+	}
+	if c, ok := s.GetBorder(); ok {
+		add("border=%s", hex(c))
+	}
+	for _, w := range []struct {
+		name string
+		get  func() (int, bool)
+	}{
+		{"border_top", s.GetBorderTop},
+		{"border_right", s.GetBorderRight},
+		{"border_bottom", s.GetBorderBottom},
+		{"border_left", s.GetBorderLeft},
+	} {
+		if width, ok := w.get(); ok {
+			add("%s=%d", w.name, width)
+		}
+	}
+	if minWidth, ok := s.GetMinWidth(); ok {
+		if placeholder, isString := minWidth.(string); isString {
+			add("min_width=%q", placeholder)
+		} else {
+			add("min_width=%v", minWidth)
+		}
+	}
+	if align, ok := s.GetAlignment(); ok {
+		add("align=%s", align)
+	}
+	if urgent, ok := s.IsUrgent(); ok {
+		add("urgent=%v", urgent)
+	}
+	if separator, ok := s.HasSeparator(); ok {
+		add("separator=%v", separator)
+	}
+	if padding, ok := s.GetPadding(); ok {
+		add("padding=%d", padding)
+	}
+	if s.HasClick() {
+		add("click")
+	}
+	return attrs
+}
+
+func hex(c color.Color) string {
+	if c == nil {
+		return "none"
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+func (s *Snapshot) check() {
+	// Don't compare or update if the test already failed, since the outputs
+	// collected so far are probably incomplete.
+	if s.t.Failed() {
+		return
+	}
+	actual := strings.Join(s.entries, "\n")
+	if *update {
+		err := os.MkdirAll(filepath.Dir(s.path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(s.path, []byte(actual), 0644)
+		}
+		require.NoError(s.t, err, "Failed to update golden file %s", s.path)
+		return
+	}
+	expected, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		require.Fail(s.t, "Missing golden file",
+			"%s does not exist, run the test with -update to create it", s.path)
+	}
+	require.NoError(s.t, err, "Failed to read golden file %s", s.path)
+	require.Equal(s.t, string(expected), actual,
+		"Output does not match %s, run the test with -update to accept changes", s.path)
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golden
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"barista.run/bar"
+	"barista.run/colors"
+	"barista.run/outputs"
+	testOutput "barista.run/testing/output"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	require.Equal(t, "(nil)\n", Format(nil))
+	require.Equal(t, "(empty)\n", Format(outputs.Group()))
+	require.Equal(t, "[0] text=\"foo\"\n", Format(outputs.Text("foo")))
+
+	seg := bar.PangoSegment("<b>foo</b>").
+		ShortText("f").
+		Tooltip("tip").
+		Color(colors.Hex("#ff0000")).
+		Background(color.NRGBA{0, 0xff, 0, 0x80}).
+		Border(colors.Hex("#0000ff")).
+		BorderTop(2).
+		MinWidthPlaceholder("00:00").
+		Align(bar.AlignCenter).
+		Urgent(true).
+		Separator(false).
+		Padding(3).
+		OnClick(func(bar.Event) {})
+	require.Equal(t,
+		`[0] pango="<b>foo</b>" short="f" tooltip="tip"`+
+			` color=#ff0000 background=#00ff0080 border=#0000ff border_top=2`+
+			` min_width="00:00" align=center urgent=false separator=false padding=3 click`+"\n",
+		Format(outputs.Group(seg.Urgent(false))))
+
+	require.Equal(t,
+		"[0] text=\"a\" min_width=40\n[1] text=\"Error\" short=\"!\" error=\"oops\" urgent=true\n",
+		Format(outputs.Group(
+			bar.TextSegment("a").MinWidth(40),
+			bar.ErrorSegment(errors.New("oops")),
+		)))
+}
+
+// fakeT is a testing.TB that records failures, for verifying the behaviour
+// of snapshots without failing the real test.
+type fakeT struct {
+	testing.TB
+	name   string
+	failed bool
+	msgs   []string
+}
+
+func (f *fakeT) Name() string      { return f.name }
+func (f *fakeT) Helper()           {}
+func (f *fakeT) Cleanup(fn func()) {}
+func (f *fakeT) Failed() bool      { return f.failed }
+func (f *fakeT) FailNow()          { f.failed = true }
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.failed = true
+	f.msgs = append(f.msgs, fmt.Sprintf(format, args...))
+}
+
+// snapshot creates a snapshot with the given outputs for a fake test, and
+// returns the fake test after checking the snapshot.
+func snapshot(name string, texts ...string) *fakeT {
+	ft := &fakeT{name: name}
+	s := New(ft)
+	for i, txt := range texts {
+		s.Add(fmt.Sprintf("output %d", i), outputs.Text(txt))
+	}
+	s.check()
+	return ft
+}
+
+func TestGoldenFile(t *testing.T) {
+	testdataDir = t.TempDir()
+	defer func() { testdataDir = "testdata" }()
+
+	ft := snapshot("TestFoo/bar baz", "a", "b")
+	require.True(t, ft.failed, "fails without golden file")
+	require.Contains(t, ft.msgs[0], "-update")
+
+	*update = true
+	ft = snapshot("TestFoo/bar baz", "a", "b")
+	*update = false
+	require.False(t, ft.failed, "golden file created")
+	contents, err := ioutil.ReadFile(filepath.Join(testdataDir, "TestFoo_bar_baz.golden"))
+	require.NoError(t, err)
+	require.Equal(t,
+		"== output 0\n[0] text=\"a\"\n\n== output 1\n[0] text=\"b\"\n",
+		string(contents))
+
+	ft = snapshot("TestFoo/bar baz", "a", "b")
+	require.False(t, ft.failed, "matches golden file")
+
+	ft = snapshot("TestFoo/bar baz", "a", "c")
+	require.True(t, ft.failed, "differs from golden file")
+	require.Contains(t, ft.msgs[0], "TestFoo_bar_baz.golden")
+
+	ft = snapshot("TestFoo/bar baz", "a")
+	require.True(t, ft.failed, "missing outputs")
+
+	*update = true
+	ft = &fakeT{name: "TestFoo/bar baz", failed: true}
+	New(ft).Add("output 0", outputs.Text("x")).check()
+	*update = false
+	contents, _ = ioutil.ReadFile(filepath.Join(testdataDir, "TestFoo_bar_baz.golden"))
+	require.Contains(t, string(contents), `"b"`, "not updated if the test failed")
+}
+
+func TestAssertionsAsOutput(t *testing.T) {
+	out := testOutput.New(t, outputs.Textf("foo").Color(colors.Hex("#abcdef")))
+	require.Equal(t, "[0] text=\"foo\" color=#abcdef\n", Format(out))
+}
@@ -0,0 +1,448 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package httpfake provides a fake HTTP API server for testing modules that are
+backed by web APIs (weather providers, GitHub, Gmail, etc.), without needing
+live credentials.
+
+Routes are registered with canned responses, typically loaded from fixtures in
+testdata, and can simulate common API behaviour such as authentication,
+pagination, and rate limits. All requests received are recorded, and can be
+checked using the assertion methods on Server.
+
+Modules that build their own URLs can be pointed at the server using either
+Intercept, which routes all requests made through http.DefaultTransport (and
+therefore base/httpclient) to the server, or Wrap for a specific *http.Client.
+*/
+package httpfake // import "barista.run/testing/httpfake"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"barista.run/testing/httpclient"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Server is a fake HTTP API server.
+type Server struct {
+	*httptest.Server
+	t require.TestingT
+
+	mu       sync.Mutex
+	routes   []*Route
+	requests []Request
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Host   string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+	// True if the request was handled by one of the registered routes.
+	Handled bool
+}
+
+// New creates and starts a new fake server. The server should be closed when
+// the test completes.
+func New(t require.TestingT) *Server {
+	s := &Server{t: t}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Handle registers a route for requests with the given method and path, and
+// returns it for configuration. Routes registered later take precedence, so
+// tests can override the response for a route by registering it again.
+func (s *Server) Handle(method, path string) *Route {
+	r := &Route{method: method, path: path, status: http.StatusOK,
+		header: http.Header{}, query: url.Values{}}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = append(s.routes, r)
+	return r
+}
+
+// Get is shorthand for Handle("GET", path).
+func (s *Server) Get(path string) *Route {
+	return s.Handle("GET", path)
+}
+
+// Intercept redirects all requests sent using http.DefaultTransport to the
+// server, regardless of their original host, and returns a function that
+// restores the original transport. This allows testing modules that build
+// URLs for a fixed API host.
+func (s *Server) Intercept() (restore func()) {
+	original := http.DefaultTransport
+	c := &http.Client{Transport: original}
+	httpclient.Wrap(c, s.URL)
+	http.DefaultTransport = c.Transport
+	return func() { http.DefaultTransport = original }
+}
+
+// Wrap redirects all requests from the given client to the server.
+func (s *Server) Wrap(c *http.Client) {
+	httpclient.Wrap(c, s.URL)
+}
+
+// Requests returns all requests received by the server so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ClearRequests clears the requests received so far.
+func (s *Server) ClearRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+func (s *Server) matching(method, path string) []Request {
+	var matched []Request
+	for _, r := range s.Requests() {
+		if r.Method == method && r.Path == path {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// AssertRequested asserts that at least one request was received with the
+// given method and path, and returns the most recent such request.
+func (s *Server) AssertRequested(method, path string, formatAndArgs ...interface{}) Request {
+	matched := s.matching(method, path)
+	if len(matched) == 0 {
+		require.Fail(s.t, fmt.Sprintf("Expected a request for %s %s", method, path),
+			formatAndArgs...)
+		return Request{}
+	}
+	return matched[len(matched)-1]
+}
+
+// AssertNotRequested asserts that no requests were received with the given
+// method and path.
+func (s *Server) AssertNotRequested(method, path string, formatAndArgs ...interface{}) {
+	if matched := s.matching(method, path); len(matched) > 0 {
+		require.Fail(s.t, fmt.Sprintf("Expected no requests for %s %s, got %d",
+			method, path, len(matched)), formatAndArgs...)
+	}
+}
+
+// AssertAllHandled asserts that every request received was handled by a
+// registered route, to catch modules requesting unexpected URLs.
+func (s *Server) AssertAllHandled(formatAndArgs ...interface{}) {
+	for _, r := range s.Requests() {
+		if !r.Handled {
+			require.Fail(s.t, fmt.Sprintf("Unexpected request for %s %s", r.Method, r.Path),
+				formatAndArgs...)
+			return
+		}
+	}
+}
+
+func (s *Server) route(r *http.Request) *Route {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.routes) - 1; i >= 0; i-- {
+		if s.routes[i].matches(r) {
+			return s.routes[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	req := Request{
+		Method: r.Method,
+		Host:   r.Host,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   string(body),
+	}
+	route := s.route(r)
+	req.Handled = route != nil
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+	if route == nil {
+		http.Error(w, fmt.Sprintf("no route for %s %s", r.Method, r.URL.Path),
+			http.StatusNotFound)
+		return
+	}
+	route.serve(w, r)
+}
+
+// Route is a canned response for requests matching a method and path, and
+// optionally query parameters.
+type Route struct {
+	method string
+	path   string
+	query  url.Values
+
+	mu       sync.Mutex
+	status   int
+	header   http.Header
+	body     []byte
+	pages    [][]byte
+	auth     func(*http.Request) bool
+	handler  http.HandlerFunc
+	limit    int
+	used     int
+	resetsIn time.Duration
+}
+
+// Query restricts the route to requests with the given query parameter value.
+func (r *Route) Query(key, value string) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.query.Set(key, value)
+	return r
+}
+
+// Status sets the status code of the response.
+func (r *Route) Status(code int) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = code
+	return r
+}
+
+// Header adds a header to the response.
+func (r *Route) Header(key, value string) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.header.Add(key, value)
+	return r
+}
+
+// Body sets the body of the response.
+func (r *Route) Body(body string) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.body = []byte(body)
+	return r
+}
+
+// JSON sets the body of the response to the JSON encoding of the given value.
+func (r *Route) JSON(v interface{}) *Route {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	r.Header("Content-Type", "application/json")
+	return r.Body(string(body))
+}
+
+// Fixture sets the body of the response to the contents of the named file in
+// testdata. If data is given, the file is treated as a text/template and
+// executed with it.
+func (r *Route) Fixture(name string, data ...interface{}) *Route {
+	return r.Body(string(fixture(name, data...)))
+}
+
+func fixture(name string, data ...interface{}) []byte {
+	path := filepath.Join("testdata", name)
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	if len(data) == 0 {
+		return contents
+	}
+	tpl, err := template.New(name).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		panic(err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data[0]); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// Handler uses a custom handler for the route, which replaces the canned
+// response. Authentication and rate limits are still applied.
+func (r *Route) Handler(fn http.HandlerFunc) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handler = fn
+	return r
+}
+
+// Pages serves a paginated response, using the "page" query parameter
+// (starting at 1) and Link headers to the next and last pages, as used by the
+// GitHub API. Requests for pages out of range receive an empty JSON array.
+func (r *Route) Pages(pages ...string) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pages = nil
+	for _, p := range pages {
+		r.pages = append(r.pages, []byte(p))
+	}
+	return r
+}
+
+// RequireBearer rejects requests without the given bearer token with 401, as
+// APIs using OAuth would.
+func (r *Route) RequireBearer(token string) *Route {
+	return r.requireAuth(func(req *http.Request) bool {
+		return req.Header.Get("Authorization") == "Bearer "+token
+	})
+}
+
+// RequireBasic rejects requests without the given basic auth credentials with
+// 401.
+func (r *Route) RequireBasic(user, password string) *Route {
+	return r.requireAuth(func(req *http.Request) bool {
+		u, p, ok := req.BasicAuth()
+		return ok && u == user && p == password
+	})
+}
+
+// RequireAPIKey rejects requests without the given API key in the named query
+// parameter (e.g. "appid" for OpenWeatherMap) with 401.
+func (r *Route) RequireAPIKey(param, key string) *Route {
+	return r.requireAuth(func(req *http.Request) bool {
+		return req.URL.Query().Get(param) == key
+	})
+}
+
+func (r *Route) requireAuth(fn func(*http.Request) bool) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.auth = fn
+	return r
+}
+
+// RateLimit allows up to limit requests to the route, and rejects further
+// requests with 403 until ResetRateLimit is called. Responses include the
+// X-RateLimit-Limit, X-RateLimit-Remaining, and X-RateLimit-Reset headers, as
+// used by the GitHub API, with the reset time resetsIn from now.
+func (r *Route) RateLimit(limit int, resetsIn time.Duration) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limit, r.used, r.resetsIn = limit, 0, resetsIn
+	return r
+}
+
+// ResetRateLimit resets the number of requests made against the rate limit.
+func (r *Route) ResetRateLimit() *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.used = 0
+	return r
+}
+
+func (r *Route) matches(req *http.Request) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.Method != r.method || req.URL.Path != r.path {
+		return false
+	}
+	q := req.URL.Query()
+	for k := range r.query {
+		if q.Get(k) != r.query.Get(k) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Route) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	if r.auth != nil && !r.auth(req) {
+		r.mu.Unlock()
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.limit > 0 {
+		exceeded := r.used >= r.limit
+		if !exceeded {
+			r.used++
+		}
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(r.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(r.limit-r.used))
+		w.Header().Set("X-RateLimit-Reset",
+			strconv.FormatInt(time.Now().Add(r.resetsIn).Unix(), 10))
+		if exceeded {
+			r.mu.Unlock()
+			http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+			return
+		}
+	}
+	for k, vs := range r.header {
+		w.Header()[k] = vs
+	}
+	handler, status, body := r.handler, r.status, r.body
+	if r.pages != nil {
+		body = r.page(w, req)
+	}
+	r.mu.Unlock()
+	if handler != nil {
+		handler(w, req)
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// page returns the requested page of a paginated response, and sets the Link
+// header for navigating to other pages.
+func (r *Route) page(w http.ResponseWriter, req *http.Request) []byte {
+	n, err := strconv.Atoi(req.URL.Query().Get("page"))
+	if err != nil || n < 1 {
+		n = 1
+	}
+	link := func(page int, rel string) string {
+		u := url.URL{Scheme: "http", Host: req.Host, Path: req.URL.Path}
+		q := req.URL.Query()
+		q.Set("page", strconv.Itoa(page))
+		u.RawQuery = q.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel)
+	}
+	var links []string
+	if n < len(r.pages) {
+		links = append(links, link(n+1, "next"), link(len(r.pages), "last"))
+	}
+	if n > 1 {
+		links = append(links, link(1, "first"), link(n-1, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	if n > len(r.pages) {
+		return []byte("[]")
+	}
+	return r.pages[n-1]
+}
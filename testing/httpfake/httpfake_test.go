@@ -0,0 +1,227 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpfake
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"barista.run/testing/fail"
+
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, url string, header ...string) (int, http.Header, string) {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, resp.Header, string(body)
+}
+
+func TestResponses(t *testing.T) {
+	s := New(t)
+	defer s.Close()
+
+	s.Get("/static").Fixture("static.json").Header("X-Foo", "bar")
+	s.Get("/tpl").Fixture("item.json.tpl", map[string]interface{}{"name": "a", "count": 2})
+	s.Get("/json").JSON(map[string]int{"answer": 42})
+	s.Handle("POST", "/created").Status(http.StatusCreated).Body("ok")
+	s.Get("/custom").Handler(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello %s", r.URL.Query().Get("name"))
+	})
+	s.Get("/filter").Body("default")
+	s.Get("/filter").Query("type", "special").Body("special")
+
+	code, hdr, body := get(t, s.URL+"/static")
+	require.Equal(t, 200, code)
+	require.Equal(t, "bar", hdr.Get("X-Foo"))
+	require.Equal(t, "{\"static\": true}\n", body)
+
+	_, _, body = get(t, s.URL+"/tpl")
+	require.Equal(t, "{\"name\": \"a\", \"count\": 2}\n", body)
+
+	_, hdr, body = get(t, s.URL+"/json")
+	require.Equal(t, `{"answer":42}`, body)
+	require.Equal(t, "application/json", hdr.Get("Content-Type"))
+
+	resp, err := http.Post(s.URL+"/created", "text/plain", strings.NewReader("data"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	req := s.AssertRequested("POST", "/created")
+	require.Equal(t, "data", req.Body)
+	require.Equal(t, "text/plain", req.Header.Get("Content-Type"))
+
+	_, _, body = get(t, s.URL+"/custom?name=world")
+	require.Equal(t, "hello world", body)
+
+	_, _, body = get(t, s.URL+"/filter?type=special")
+	require.Equal(t, "special", body)
+	_, _, body = get(t, s.URL+"/filter?type=other")
+	require.Equal(t, "default", body)
+
+	s.Get("/static").Body("overridden")
+	_, _, body = get(t, s.URL+"/static")
+	require.Equal(t, "overridden", body, "later routes take precedence")
+
+	s.AssertAllHandled()
+	code, _, _ = get(t, s.URL+"/missing")
+	require.Equal(t, 404, code)
+	require.True(t, fail.Failed(func(t *testing.T) {
+		s.t = t
+		s.AssertAllHandled()
+	}), "with unhandled request")
+	s.t = t
+}
+
+func TestRequestAssertions(t *testing.T) {
+	s := New(t)
+	defer s.Close()
+	s.Get("/foo").Body("foo")
+
+	s.AssertNotRequested("GET", "/foo")
+	get(t, s.URL+"/foo?a=1", "Accept", "text/plain")
+	get(t, s.URL+"/foo?a=2")
+	req := s.AssertRequested("GET", "/foo")
+	require.Equal(t, "2", req.Query.Get("a"), "returns the latest request")
+	require.Len(t, s.Requests(), 2)
+	require.Equal(t, "text/plain", s.Requests()[0].Header.Get("Accept"))
+	require.True(t, s.Requests()[0].Handled)
+
+	require.True(t, fail.Failed(func(t *testing.T) {
+		s.t = t
+		s.AssertNotRequested("GET", "/foo")
+	}), "AssertNotRequested with matching request")
+	require.True(t, fail.Failed(func(t *testing.T) {
+		s.t = t
+		s.AssertRequested("POST", "/foo")
+	}), "AssertRequested without matching request")
+	s.t = t
+
+	s.ClearRequests()
+	require.Empty(t, s.Requests())
+	s.AssertNotRequested("GET", "/foo")
+}
+
+func TestAuth(t *testing.T) {
+	s := New(t)
+	defer s.Close()
+	s.Get("/bearer").RequireBearer("token").Body("ok")
+	s.Get("/basic").RequireBasic("user", "pass").Body("ok")
+	s.Get("/key").RequireAPIKey("appid", "key").Body("ok")
+
+	code, _, _ := get(t, s.URL+"/bearer")
+	require.Equal(t, 401, code)
+	code, _, _ = get(t, s.URL+"/bearer", "Authorization", "Bearer wrong")
+	require.Equal(t, 401, code)
+	code, _, body := get(t, s.URL+"/bearer", "Authorization", "Bearer token")
+	require.Equal(t, 200, code)
+	require.Equal(t, "ok", body)
+
+	code, _, _ = get(t, s.URL+"/basic")
+	require.Equal(t, 401, code)
+	req, _ := http.NewRequest("GET", s.URL+"/basic", nil)
+	req.SetBasicAuth("user", "pass")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+
+	code, _, _ = get(t, s.URL+"/key?appid=wrong")
+	require.Equal(t, 401, code)
+	code, _, _ = get(t, s.URL+"/key?appid=key")
+	require.Equal(t, 200, code)
+}
+
+func TestPages(t *testing.T) {
+	s := New(t)
+	defer s.Close()
+	s.Get("/items").Pages(`[1, 2]`, `[3, 4]`, `[5]`)
+
+	_, hdr, body := get(t, s.URL+"/items?per_page=2")
+	require.Equal(t, `[1, 2]`, body)
+	require.Equal(t, fmt.Sprintf(`<%[1]s/items?page=2&per_page=2>; rel="next", `+
+		`<%[1]s/items?page=3&per_page=2>; rel="last"`, s.URL), hdr.Get("Link"))
+
+	_, hdr, body = get(t, s.URL+"/items?page=2")
+	require.Equal(t, `[3, 4]`, body)
+	require.Equal(t, fmt.Sprintf(`<%[1]s/items?page=3>; rel="next", `+
+		`<%[1]s/items?page=3>; rel="last", `+
+		`<%[1]s/items?page=1>; rel="first", `+
+		`<%[1]s/items?page=1>; rel="prev"`, s.URL), hdr.Get("Link"))
+
+	_, hdr, body = get(t, s.URL+"/items?page=3")
+	require.Equal(t, `[5]`, body)
+	require.NotContains(t, hdr.Get("Link"), `rel="next"`)
+
+	_, _, body = get(t, s.URL+"/items?page=4")
+	require.Equal(t, `[]`, body, "out of range")
+}
+
+func TestRateLimit(t *testing.T) {
+	s := New(t)
+	defer s.Close()
+	r := s.Get("/limited").RateLimit(2, time.Hour).Body("ok")
+
+	code, hdr, _ := get(t, s.URL+"/limited")
+	require.Equal(t, 200, code)
+	require.Equal(t, "2", hdr.Get("X-RateLimit-Limit"))
+	require.Equal(t, "1", hdr.Get("X-RateLimit-Remaining"))
+	require.NotEmpty(t, hdr.Get("X-RateLimit-Reset"))
+
+	code, hdr, _ = get(t, s.URL+"/limited")
+	require.Equal(t, 200, code)
+	require.Equal(t, "0", hdr.Get("X-RateLimit-Remaining"))
+
+	code, hdr, _ = get(t, s.URL+"/limited")
+	require.Equal(t, 403, code, "rate limit exceeded")
+	require.Equal(t, "0", hdr.Get("X-RateLimit-Remaining"))
+
+	r.ResetRateLimit()
+	code, _, _ = get(t, s.URL+"/limited")
+	require.Equal(t, 200, code, "after reset")
+}
+
+func TestIntercept(t *testing.T) {
+	s := New(t)
+	defer s.Close()
+	s.Get("/api/v1/status").Body("up")
+
+	restore := s.Intercept()
+	_, _, body := get(t, "https://api.example.com/api/v1/status")
+	require.Equal(t, "up", body)
+	req := s.AssertRequested("GET", "/api/v1/status")
+	require.Equal(t, "api.example.com", req.Host, "original host is kept")
+	restore()
+
+	c := &http.Client{Transport: http.DefaultTransport}
+	s.Wrap(c)
+	resp, err := c.Get("https://api.example.com/api/v1/status")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, 200, resp.StatusCode)
+	require.Len(t, s.Requests(), 2)
+}
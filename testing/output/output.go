@@ -37,6 +37,13 @@ type Assertions struct {
 	require *require.Assertions
 }
 
+// Segments implements bar.Output, returning the segments of the actual output.
+// This allows assertions to be used wherever an output is expected, e.g.
+// when adding outputs to a golden snapshot.
+func (a Assertions) Segments() []*bar.Segment {
+	return a.output.Segments()
+}
+
 // AssertEqual asserts that the actual output contains exactly the
 // same segments as the expected output.
 func (a Assertions) AssertEqual(expected bar.Output, args ...interface{}) {
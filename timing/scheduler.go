@@ -33,13 +33,12 @@ type Scheduler struct {
 	// A channel that receives an empty struct for each tick of the scheduler.
 	C <-chan struct{}
 
-	mu      sync.Mutex
-	timer   *time.Timer
-	ticker  *time.Ticker
-	quitter chan struct{}
+	mu    sync.Mutex
+	entry *wheelEntry // guarded by wheel.mu.
 
-	notifyFn func()
-	waiting  int32 // basically bool, but we need atomics.
+	notifyFn    func()
+	waiting     int32 // basically bool, but we need atomics.
+	whilePaused int32 // also bool.
 
 	// For test mode
 	testModeID uint32
@@ -74,11 +73,13 @@ func NewScheduler() *Scheduler {
 	return s
 }
 
-// Pause timing.
+// Pause timing. Schedulers will not trigger until timing is resumed, unless
+// they were set to RunWhilePaused.
 func Pause() {
 	mu.Lock()
 	defer mu.Unlock()
 	paused = true
+	wheel.setPaused(true)
 }
 
 // await executes the given function when the bar is running.
@@ -99,17 +100,33 @@ func await(fn func()) {
 	}()
 }
 
-// Resume timing.
+// Resume timing. Any schedulers that would have triggered while paused will
+// trigger immediately.
 func Resume() {
 	mu.Lock()
 	defer mu.Unlock()
 	paused = false
+	wheel.setPaused(false)
 	for _, ch := range waiters {
 		close(ch)
 	}
 	waiters = nil
 }
 
+// RunWhilePaused allows the scheduler to keep triggering while timing is
+// paused (i.e. the bar is hidden). This should only be used for work that must
+// continue even while the bar is not visible, e.g. a countdown timer that
+// sends a notification when it completes.
+func (s *Scheduler) RunWhilePaused() *Scheduler {
+	atomic.StoreInt32(&s.whilePaused, 1)
+	wheel.update(s)
+	return s
+}
+
+func (s *Scheduler) runsWhilePaused() bool {
+	return atomic.LoadInt32(&s.whilePaused) == 1
+}
+
 // Tick waits until the next tick of the scheduler.
 // Equivalent to <-scheduler.C, but returns true to allow for sch.Tick() { ... }
 func (s *Scheduler) Tick() bool {
@@ -124,10 +141,7 @@ func (s *Scheduler) At(when time.Time) *Scheduler {
 		return s.testModeAt(when)
 	}
 	l.Fine("%s At(%v)", l.ID(s), when)
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.stop()
-	s.timer = time.AfterFunc(when.Sub(Now()), s.maybeTrigger)
+	wheel.schedule(s, when.Sub(Now()), 0)
 	return s
 }
 
@@ -138,10 +152,7 @@ func (s *Scheduler) After(delay time.Duration) *Scheduler {
 		return s.testModeAfter(delay)
 	}
 	l.Fine("%s After(%v)", l.ID(s), delay)
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.stop()
-	s.timer = time.AfterFunc(delay, s.maybeTrigger)
+	wheel.schedule(s, delay, 0)
 	return s
 }
 
@@ -155,29 +166,7 @@ func (s *Scheduler) Every(interval time.Duration) *Scheduler {
 		return s.testModeEvery(interval)
 	}
 	l.Fine("%s Every(%v)", l.ID(s), interval)
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.stop()
-	s.quitter = make(chan struct{})
-	s.ticker = time.NewTicker(interval)
-	go func() {
-		s.mu.Lock()
-		ticker := s.ticker
-		quitter := s.quitter
-		s.mu.Unlock()
-		if ticker == nil || quitter == nil {
-			// Scheduler stopped before goroutine was started.
-			return
-		}
-		for {
-			select {
-			case <-ticker.C:
-				s.maybeTrigger()
-			case <-quitter:
-				return
-			}
-		}
-	}()
+	wheel.schedule(s, interval, interval)
 	return s
 }
 
@@ -188,12 +177,14 @@ func (s *Scheduler) Stop() {
 		return
 	}
 	l.Fine("%s Stop", l.ID(s))
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.stop()
+	wheel.remove(s)
 }
 
 func (s *Scheduler) maybeTrigger() {
+	if s.runsWhilePaused() {
+		s.notifyFn()
+		return
+	}
 	if !atomic.CompareAndSwapInt32(&s.waiting, 0, 1) {
 		return
 	}
@@ -203,18 +194,3 @@ func (s *Scheduler) maybeTrigger() {
 		}
 	})
 }
-
-func (s *Scheduler) stop() {
-	if s.timer != nil {
-		s.timer.Stop()
-		s.timer = nil
-	}
-	if s.ticker != nil {
-		s.ticker.Stop()
-		s.ticker = nil
-	}
-	if s.quitter != nil {
-		close(s.quitter)
-		s.quitter = nil
-	}
-}
@@ -15,6 +15,7 @@
 package timing
 
 import (
+	"errors"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -40,6 +41,19 @@ var (
 	triggersMu sync.Mutex
 )
 
+// pending tracks schedulers that were triggered while auto-advancing, but may
+// not have been received from yet. Guarded by triggersMu.
+var pending []*Scheduler
+
+// activity is incremented on every scheduling call, trigger, and read of the
+// current time in test mode. Auto-advance treats a period without any change
+// as a sign that the test is idle.
+var activity uint64
+
+// stopAutoAdvance stops the running auto-advance goroutine, if any.
+// Guarded by triggersMu.
+var stopAutoAdvance chan struct{}
+
 // nowInTest tracks the current time in test mode.
 var nowInTest atomic.Value // of time.Time
 
@@ -82,13 +96,20 @@ func reset(fn func()) {
 	triggersMu.Lock()
 	defer triggersMu.Unlock()
 	fn()
+	if stopAutoAdvance != nil {
+		close(stopAutoAdvance)
+		stopAutoAdvance = nil
+	}
 	waiters = nil
 	triggers = nil
+	pending = nil
 	paused = false
+	wheel.setPaused(false)
 }
 
 func (s *Scheduler) setNextTrigger(when time.Time) *Scheduler {
 	newTriggers := triggerList{}
+	atomic.AddUint64(&activity, 1)
 	triggersMu.Lock()
 	defer triggersMu.Unlock()
 	for _, t := range triggers {
@@ -185,6 +206,10 @@ func advanceToLocked(newTime time.Time) time.Time {
 			triggers = append(triggers, t)
 		}
 		idx = i + 1
+		atomic.AddUint64(&activity, 1)
+		if stopAutoAdvance != nil {
+			pending = append(pending, t.what)
+		}
 		t.what.maybeTrigger()
 	}
 	triggers = triggers[idx:]
@@ -194,3 +219,106 @@ func advanceToLocked(newTime time.Time) time.Time {
 	}
 	return nextTick
 }
+
+// AutoAdvance makes test time pass on its own, using a quiet-period heuristic:
+// whenever every triggered scheduler has been received from, and there has
+// been no timing activity (scheduling calls, triggers, or calls to Now()) for
+// the given quiet period of real time, test time is fast-forwarded to the next
+// scheduled trigger.
+//
+// Only calls into this package are seen as activity, so a module that is busy
+// with anything else (blocked on I/O, a channel, or a lock) looks idle once
+// the quiet period expires, and time can move on before it has caught up. Use
+// a quiet period longer than any such work, and use NextTick() in tests that
+// need to see the state between specific ticks. Auto-advance is meant for
+// tests that only care about the sequence of updates, not when exactly they
+// happen.
+//
+// Schedulers that trigger while timing is paused hold up auto-advance until
+// timing is resumed. Auto-advance stops when the returned func is called, or
+// when test mode is reset. It panics if not in test mode.
+func AutoAdvance(quiet time.Duration) (stop func()) {
+	if quiet <= 0 {
+		panic(errors.New("non-positive quiet period for AutoAdvance"))
+	}
+	mu.Lock()
+	inTestMode := testMode
+	mu.Unlock()
+	if !inTestMode {
+		panic(errors.New("AutoAdvance called outside of test mode"))
+	}
+	triggersMu.Lock()
+	defer triggersMu.Unlock()
+	if stopAutoAdvance != nil {
+		close(stopAutoAdvance)
+	}
+	done := make(chan struct{})
+	stopAutoAdvance = done
+	go autoAdvance(quiet, done)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			triggersMu.Lock()
+			defer triggersMu.Unlock()
+			if stopAutoAdvance == done {
+				close(done)
+				stopAutoAdvance = nil
+			}
+		})
+	}
+}
+
+func autoAdvance(quiet time.Duration, done <-chan struct{}) {
+	poll := quiet / 4
+	if poll < time.Millisecond {
+		poll = time.Millisecond
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	lastActivity := atomic.LoadUint64(&activity)
+	lastChange := time.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if a := atomic.LoadUint64(&activity); a != lastActivity {
+			lastActivity = a
+			lastChange = time.Now()
+			continue
+		}
+		if time.Since(lastChange) < quiet {
+			continue
+		}
+		triggersMu.Lock()
+		select {
+		case <-done:
+			// Stopped (or test mode was reset) while waiting for the lock.
+			triggersMu.Unlock()
+			return
+		default:
+		}
+		if idleLocked() && len(triggers) > 0 {
+			l.Fine("AutoAdvance[Test](%v)", triggers[0].when)
+			advanceToLocked(triggers[0].when)
+		}
+		triggersMu.Unlock()
+	}
+}
+
+// idleLocked returns true if all schedulers triggered so far have been received
+// from, i.e. no scheduler has a pending tick. Must be called with triggersMu.
+func idleLocked() bool {
+	stillPending := pending[:0]
+	for _, s := range pending {
+		if s.testModeID != testModeID {
+			continue
+		}
+		if len(s.C) > 0 || atomic.LoadInt32(&s.waiting) == 1 {
+			stillPending = append(stillPending, s)
+		}
+	}
+	pending = stillPending
+	return len(pending) == 0
+}
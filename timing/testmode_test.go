@@ -21,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"barista.run/base/watchers/localtz"
 	"barista.run/testing/notifier"
 	"github.com/stretchr/testify/require"
 )
@@ -296,3 +297,97 @@ func TestTestModeReset(t *testing.T) {
 	notifier.AssertNoUpdate(t, sch1.C, "previous scheduler is not triggered")
 	notifier.AssertNoUpdate(t, sch2.C, "previous scheduler is not triggered")
 }
+
+func TestAutoAdvance(t *testing.T) {
+	TestMode()
+	require.Panics(t, func() { AutoAdvance(0) }, "non-positive quiet period")
+
+	startTime := Now()
+	sch := NewScheduler().Every(time.Minute)
+	ticks := make(chan time.Time)
+	go func() {
+		for range sch.C {
+			ticks <- Now()
+		}
+	}()
+
+	stop := AutoAdvance(5 * time.Millisecond)
+	for i := 1; i <= 5; i++ {
+		select {
+		case now := <-ticks:
+			require.Equal(t, startTime.Add(time.Duration(i)*time.Minute), now,
+				"advances to each trigger in turn")
+		case <-time.After(time.Second):
+			require.Fail(t, "auto-advance did not trigger scheduler", "tick #%d", i)
+		}
+	}
+
+	stop()
+	stop() // Safe to call multiple times.
+	select {
+	case <-ticks:
+		// At most one tick can race with stop.
+	case <-time.After(50 * time.Millisecond):
+	}
+	now := Now()
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, now, Now(), "time does not advance after stop")
+
+	ExitTestMode()
+	require.Panics(t, func() { AutoAdvance(time.Millisecond) }, "outside test mode")
+}
+
+func TestAutoAdvanceWaitsForReceive(t *testing.T) {
+	TestMode()
+	startTime := Now()
+	sch1 := NewScheduler().After(time.Second)
+	sch2 := NewScheduler().After(time.Hour)
+	defer AutoAdvance(time.Millisecond)()
+
+	for testNow() == startTime {
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, startTime.Add(time.Second), Now(), "advances to first trigger")
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, startTime.Add(time.Second), Now(),
+		"does not advance while a tick is pending")
+	notifier.AssertNoUpdate(t, sch2.C, "while first tick is pending")
+
+	notifier.AssertNotified(t, sch1.C, "first scheduler triggered")
+	notifier.AssertNotified(t, sch2.C, "advances after first tick is received")
+	require.Equal(t, startTime.Add(time.Hour), Now())
+
+	Pause()
+	sch1.After(time.Minute)
+	sch2.After(2 * time.Minute)
+	for testNow() == startTime.Add(time.Hour) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	require.Equal(t, startTime.Add(time.Hour+time.Minute), Now(),
+		"paused scheduler holds up auto-advance")
+	Resume()
+	notifier.AssertNotified(t, sch1.C, "on resume")
+	notifier.AssertNotified(t, sch2.C, "advances after resume")
+
+	TestMode()
+	sch1 = NewScheduler().After(time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	notifier.AssertNoUpdate(t, sch1.C, "auto-advance stops on reset")
+}
+
+func TestStartOfDay_TestMode(t *testing.T) {
+	TestMode()
+	AdvanceTo(time.Date(2018, 6, 1, 1, 30, 0, 0, time.UTC))
+	require.Equal(t, time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC), StartOfDay())
+
+	tokyo := time.FixedZone("JST", 9*60*60)
+	localtz.SetForTest(tokyo)
+	defer localtz.SetForTest(time.UTC)
+	require.Equal(t, time.Date(2018, 6, 1, 0, 0, 0, 0, tokyo), StartOfDay(),
+		"in the local time zone")
+
+	AdvanceTo(time.Date(2018, 6, 1, 16, 0, 0, 0, time.UTC))
+	require.Equal(t, time.Date(2018, 6, 2, 0, 0, 0, 0, tokyo), StartOfDay(),
+		"local midnight may be a different date from UTC")
+}
@@ -37,6 +37,7 @@ during tests, as well as correctly track the machine's time zone.
 package timing // import "barista.run/timing"
 
 import (
+	"sync/atomic"
 	"time"
 
 	"barista.run/base/watchers/localtz"
@@ -53,9 +54,17 @@ func Now() time.Time {
 	defer mu.Unlock()
 	var now time.Time
 	if testMode {
+		atomic.AddUint64(&activity, 1)
 		now = testNow()
 	} else {
 		now = time.Now()
 	}
 	return now.In(localtz.Get())
 }
+
+// StartOfDay returns midnight at the start of the current day, in the
+// machine's local time zone.
+func StartOfDay() time.Time {
+	now := Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
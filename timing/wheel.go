@@ -0,0 +1,209 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timing
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// wheel is the timer shared by all real (i.e. not test mode) schedulers. It
+// keeps pending triggers in a heap ordered by deadline, and uses a single
+// runtime timer for the earliest one, so idle schedulers do not need their
+// own goroutines or timers.
+var wheel = new(timerWheel)
+
+type wheelEntry struct {
+	sch      *Scheduler
+	when     time.Time
+	interval time.Duration
+	heap     *entryHeap
+	index    int
+}
+
+type entryHeap []*wheelEntry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].when.Before(h[j].when) }
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*wheelEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	e.index = -1
+	return e
+}
+
+func (h entryHeap) first() time.Time {
+	if len(h) == 0 {
+		return time.Time{}
+	}
+	return h[0].when
+}
+
+type timerWheel struct {
+	mu sync.Mutex
+	// entries holds the triggers that are suspended while the bar is paused,
+	// unpausable holds triggers for schedulers that run while paused.
+	entries    entryHeap
+	unpausable entryHeap
+	paused     bool
+	timer      *time.Timer
+	// next is the deadline the timer is currently set for, or zero if the timer
+	// is not running.
+	next time.Time
+}
+
+func (w *timerWheel) heapFor(s *Scheduler) *entryHeap {
+	if s.runsWhilePaused() {
+		return &w.unpausable
+	}
+	return &w.entries
+}
+
+// schedule replaces any pending trigger for the scheduler with one after the
+// given delay, repeating at interval if it is positive.
+func (w *timerWheel) schedule(s *Scheduler, delay, interval time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	when := time.Now().Add(delay)
+	if e := s.entry; e != nil && e.heap == w.heapFor(s) {
+		e.when = when
+		e.interval = interval
+		heap.Fix(e.heap, e.index)
+	} else {
+		w.removeLocked(s)
+		s.entry = &wheelEntry{sch: s, when: when, interval: interval, heap: w.heapFor(s)}
+		heap.Push(s.entry.heap, s.entry)
+	}
+	w.resetLocked()
+}
+
+// update moves any pending trigger for the scheduler to the correct heap after
+// a change to whether it runs while paused.
+func (w *timerWheel) update(s *Scheduler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e := s.entry
+	if e == nil || e.heap == w.heapFor(s) {
+		return
+	}
+	w.removeLocked(s)
+	e.heap = w.heapFor(s)
+	heap.Push(e.heap, e)
+	s.entry = e
+	w.resetLocked()
+}
+
+// remove cancels any pending trigger for the scheduler.
+func (w *timerWheel) remove(s *Scheduler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.removeLocked(s)
+	w.resetLocked()
+}
+
+func (w *timerWheel) removeLocked(s *Scheduler) {
+	if s.entry == nil {
+		return
+	}
+	heap.Remove(s.entry.heap, s.entry.index)
+	s.entry = nil
+}
+
+// setPaused suspends or resumes all triggers other than those of schedulers
+// that run while paused. Any triggers that elapsed while paused will fire
+// immediately on resume.
+func (w *timerWheel) setPaused(paused bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = paused
+	w.resetLocked()
+}
+
+// fire triggers all schedulers whose deadline has passed, reschedules the
+// repeating ones, and sets the timer for the next deadline.
+func (w *timerWheel) fire() {
+	w.mu.Lock()
+	now := time.Now()
+	due := popDue(&w.unpausable, now, nil)
+	if !w.paused {
+		due = popDue(&w.entries, now, due)
+	}
+	w.next = time.Time{}
+	w.resetLocked()
+	w.mu.Unlock()
+	for _, s := range due {
+		s.maybeTrigger()
+	}
+}
+
+// popDue appends the schedulers from h with deadlines before now to due, and
+// removes or reschedules their triggers.
+func popDue(h *entryHeap, now time.Time, due []*Scheduler) []*Scheduler {
+	for len(*h) > 0 && !(*h)[0].when.After(now) {
+		e := (*h)[0]
+		due = append(due, e.sch)
+		if e.interval > 0 {
+			// Like time.Ticker, drop any ticks that were missed entirely.
+			missed := now.Sub(e.when) / e.interval
+			e.when = e.when.Add(e.interval * (missed + 1))
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+			e.sch.entry = nil
+		}
+	}
+	return due
+}
+
+func (w *timerWheel) resetLocked() {
+	when := w.unpausable.first()
+	if next := w.entries.first(); !w.paused && !next.IsZero() &&
+		(when.IsZero() || next.Before(when)) {
+		when = next
+	}
+	if when.IsZero() {
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+		w.next = time.Time{}
+		return
+	}
+	if when.Equal(w.next) {
+		return
+	}
+	w.next = when
+	if w.timer == nil {
+		w.timer = time.AfterFunc(time.Until(when), w.fire)
+	} else {
+		w.timer.Reset(time.Until(when))
+	}
+}
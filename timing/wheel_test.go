@@ -0,0 +1,109 @@
+// Copyright 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timing
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"barista.run/testing/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedWheel(t *testing.T) {
+	ExitTestMode()
+	before := runtime.NumGoroutine()
+
+	var schedulers []*Scheduler
+	for i := 0; i < 50; i++ {
+		schedulers = append(schedulers, NewScheduler().Every(time.Hour))
+	}
+	require.InDelta(t, before, runtime.NumGoroutine(), 5,
+		"repeating schedulers do not start goroutines")
+
+	fast := NewScheduler().After(10 * time.Millisecond)
+	slow := NewScheduler().After(80 * time.Millisecond)
+	notifier.AssertNotified(t, fast.C, "shorter delay fires first")
+	notifier.AssertNoUpdate(t, slow.C, "longer delay is still pending")
+	notifier.AssertNotified(t, slow.C, "longer delay fires")
+
+	for _, s := range schedulers {
+		s.Stop()
+		require.False(t, isPending(s), "stopped schedulers are removed")
+	}
+}
+
+func TestRescheduleOnWheel(t *testing.T) {
+	ExitTestMode()
+	sch := NewScheduler().After(time.Hour)
+	other := NewScheduler().After(2 * time.Hour)
+
+	sch.After(10 * time.Millisecond)
+	notifier.AssertNotified(t, sch.C, "rescheduled earlier")
+
+	sch.Every(20 * time.Millisecond)
+	notifier.AssertNotified(t, sch.C, "first repeating tick")
+	notifier.AssertNotified(t, sch.C, "second repeating tick")
+
+	sch.After(time.Hour)
+	notifier.AssertNoUpdate(t, sch.C, "repeating trigger replaced")
+
+	require.True(t, isPending(other), "other scheduler unaffected")
+	sch.Stop()
+	other.Stop()
+	require.False(t, isPending(sch), "stopped scheduler is removed")
+	require.False(t, isPending(other), "stopped scheduler is removed")
+
+	sch.After(10 * time.Millisecond)
+	notifier.AssertNotified(t, sch.C, "one-off trigger")
+	require.False(t, isPending(sch), "elapsed trigger is removed")
+}
+
+func isPending(s *Scheduler) bool {
+	wheel.mu.Lock()
+	defer wheel.mu.Unlock()
+	return s.entry != nil
+}
+
+func TestWheelPaused(t *testing.T) {
+	ExitTestMode()
+	paused := NewScheduler().Every(20 * time.Millisecond)
+	running := NewScheduler().RunWhilePaused().Every(20 * time.Millisecond)
+	notifier.AssertNotified(t, paused.C, "before pause")
+	notifier.AssertNotified(t, running.C, "before pause")
+
+	Pause()
+	once := NewScheduler().After(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	notifier.AssertNotified(t, running.C, "while paused")
+	notifier.AssertNoUpdate(t, paused.C, "while paused")
+	notifier.AssertNoUpdate(t, once.C, "while paused")
+
+	wheel.mu.Lock()
+	next := wheel.next
+	wheel.mu.Unlock()
+	require.False(t, next.IsZero(), "timer running for unpausable scheduler")
+	running.Stop()
+	wheel.mu.Lock()
+	next = wheel.next
+	wheel.mu.Unlock()
+	require.True(t, next.IsZero(), "no timer while paused")
+
+	Resume()
+	notifier.AssertNotified(t, paused.C, "immediately on resume")
+	notifier.AssertNotified(t, once.C, "immediately on resume")
+	paused.Stop()
+}